@@ -0,0 +1,153 @@
+// Package admission asks an external service whether a join or recording
+// may go ahead, so customers can apply their own business rules without
+// forking the controllers.
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ActionJoin   = "join"
+	ActionRecord = "record"
+)
+
+// ErrUnavailable is returned when the hook could not be reached or answered
+// badly and the deployment fails closed.
+var ErrUnavailable = errors.New("admission hook unavailable")
+
+// Request is the context POSTed to the hook.
+type Request struct {
+	Action  string    `json:"action"`
+	UserID  string    `json:"userID,omitempty"`
+	Account string    `json:"account,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Session string    `json:"session"`
+	Room    string    `json:"room"`
+	Org     string    `json:"org,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Decision is the hook's answer. Modify, when allowed, overrides parts of
+// the request: the display name of a joiner, or the watermark of a
+// recording.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+	Modify struct {
+		Name      string `json:"name,omitempty"`
+		Watermark string `json:"watermark,omitempty"`
+	} `json:"modify"`
+}
+
+// Hooks calls the admission hook of the session's org, or the deployment's
+// when the org has none. Requests are signed with an HMAC-SHA256 of
+// "<timestamp>.<body>" under the hook's secret, sent as X-Videoconf-Timestamp
+// and X-Videoconf-Signature. A nil Hooks allows everything.
+type Hooks struct {
+	db       *mongo.Database
+	client   *http.Client
+	url      string
+	secret   string
+	failOpen bool
+}
+
+// NewHooks returns hooks defaulting to url, which may be empty. With
+// failOpen set, a hook that cannot be reached allows the request instead of
+// denying it.
+func NewHooks(db *mongo.Client, url, secret string, timeout time.Duration, failOpen bool) *Hooks {
+	return &Hooks{
+		db:       db.Database("vidchat"),
+		client:   &http.Client{Timeout: timeout},
+		url:      url,
+		secret:   secret,
+		failOpen: failOpen,
+	}
+}
+
+// Check asks the hook about request. Requests without a hook are allowed.
+func (h *Hooks) Check(ctx context.Context, request Request) (Decision, error) {
+	allowed := Decision{Allow: true}
+	if h == nil {
+		return allowed, nil
+	}
+
+	url, secret := h.url, h.secret
+	if request.Org != "" {
+		var org interfaces.Organization
+		if h.db.Collection("orgs").FindOne(ctx, bson.M{"_id": request.Org}).Decode(&org) == nil && org.AdmissionURL != "" {
+			url, secret = org.AdmissionURL, org.AdmissionSecret
+		}
+	}
+	if url == "" {
+		return allowed, nil
+	}
+
+	request.At = time.Now()
+	decision, err := h.call(ctx, url, secret, request)
+	if err != nil {
+		if h.failOpen {
+			return allowed, nil
+		}
+		return Decision{Reason: "admission_unavailable"}, fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	return decision, nil
+}
+
+func (h *Hooks) call(ctx context.Context, url, secret string, request Request) (Decision, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, err
+	}
+	timestamp := strconv.FormatInt(request.At.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Videoconf-Timestamp", timestamp)
+	utils.PropagateRequestID(req)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Videoconf-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer resp.Body.Close()
+
+	// A 403 is an answer too: deny with whatever reason came with it.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusForbidden {
+		return Decision{}, fmt.Errorf("hook answered %s", resp.Status)
+	}
+	var decision Decision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return Decision{}, err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		decision.Allow = false
+	}
+	return decision, nil
+}
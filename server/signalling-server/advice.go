@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/quality"
+)
+
+// advisor rates participants' connections from the quality_stats they
+// report.
+var advisor *quality.Advisor
+
+// adviseQuality handles a quality_stats report. When the participant's
+// connection changes level they are sent suggest_quality, e.g. to turn off
+// incoming video or drop to audio only; hosts are sent participant_quality
+// when it becomes severe, and again when it recovers.
+func adviseQuality(socket string, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) {
+	var report struct {
+		Data quality.Stats `json:"data"`
+	}
+	if json.Unmarshal(frame, &report) != nil {
+		return
+	}
+	advice, changed := advisor.Observe(socket, envelope.UserID, report.Data)
+	if !changed {
+		return
+	}
+
+	client := clients.Get(envelope.UserID)
+	if client == nil {
+		return
+	}
+	client.Send(interfaces.Message{Type: "suggest_quality", UserID: envelope.UserID, Data: advice})
+
+	if advice.Level != quality.Severe && advice.Previous != quality.Severe {
+		return
+	}
+	participant, _ := clients.Participant(envelope.UserID)
+	message := interfaces.Message{Type: "participant_quality", UserID: envelope.UserID, Data: gin.H{
+		"participantID": participant.ID,
+		"name":          participant.Name,
+		"level":         advice.Level,
+		"reasons":       advice.Reasons,
+	}}
+	for _, host := range clients.Hosts() {
+		if host != client {
+			host.Send(message)
+		}
+	}
+}
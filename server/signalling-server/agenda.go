@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// agendaControl handles a host's set_agenda, agenda_start, agenda_next and
+// agenda_stop. Each change is sent to the room as agenda, and each item
+// that ends is recorded on the timeline with its planned and actual
+// duration.
+func agendaControl(socket string, clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if !hostOn(clients, connection, envelope.UserID) {
+		return
+	}
+	var request struct {
+		Data struct {
+			Items []interfaces.AgendaItem `json:"items"`
+			Index *int                    `json:"index"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &request) != nil {
+		return
+	}
+
+	now := time.Now()
+	var ended *interfaces.AgendaItem
+	var err error
+	switch envelope.Type {
+	case "set_agenda":
+		if err = interfaces.ValidateAgenda(request.Data.Items); err == nil {
+			err = clients.SetAgenda(request.Data.Items)
+		}
+		if err == nil {
+			go saveAgenda(clients.Session, request.Data.Items)
+		}
+	case "agenda_start":
+		index := 0
+		if request.Data.Index != nil {
+			index = *request.Data.Index
+		}
+		ended, err = clients.StartAgendaItem(index, now)
+	case "agenda_next":
+		ended, err = clients.NextAgendaItem(now)
+	case "agenda_stop":
+		ended = clients.EndAgendaItem(now)
+	}
+	if err != nil {
+		if client := clients.Get(envelope.UserID); client != nil {
+			client.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "invalid_agenda", Data: gin.H{"reason": err.Error()}})
+		}
+		return
+	}
+
+	if ended != nil {
+		recordAgendaItem(clients, envelope.UserID, *ended)
+	}
+	broadcast(socket, interfaces.Message{Type: "agenda", UserID: envelope.UserID, Data: clients.Agenda()})
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+}
+
+// recordAgendaItem adds an agenda item that ended to the room's timeline.
+func recordAgendaItem(clients *interfaces.Room, userID string, item interfaces.AgendaItem) {
+	recordEvent(clients, analytics.EventAgendaItem, userID, map[string]interface{}{
+		"item":           item.ID,
+		"title":          item.Title,
+		"plannedSeconds": int(item.Planned().Seconds()),
+		"actualSeconds":  int(item.EndedAt.Sub(*item.StartedAt).Seconds()),
+	})
+}
+
+// saveAgenda keeps an agenda set during the meeting on its session.
+func saveAgenda(session string, items []interfaces.AgendaItem) {
+	id, err := primitive.ObjectIDFromHex(session)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := database.Database("vidchat").Collection("sessions").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"agenda": items}}); err != nil {
+		log.Printf("Error saving agenda of %s: %s", session, err)
+	}
+}
+
+// watchAgendas sends agenda_warning to rooms whose running agenda item is
+// nearly out of time, checking every interval. The last warning, with no
+// time left, says the item ran over.
+func watchAgendas(interval time.Duration) {
+	for range time.Tick(interval) {
+		socketsMu.Lock()
+		rooms := make(map[string]*interfaces.Room, len(sockets))
+		for socket, clients := range sockets {
+			rooms[socket] = clients
+		}
+		socketsMu.Unlock()
+
+		for socket, clients := range rooms {
+			item, left, ok := clients.AgendaWarning(time.Now())
+			if !ok {
+				continue
+			}
+			broadcast(socket, interfaces.Message{Type: "agenda_warning", Data: gin.H{
+				"item":        item.ID,
+				"title":       item.Title,
+				"secondsLeft": max(int(left.Seconds()), 0),
+			}})
+			snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AttendanceRecord is one participant's attendance of a session, across
+// reconnects: when they first joined, how often, when they last left, and
+// how long they were in the room until then.
+type AttendanceRecord struct {
+	ID            string            `bson:"_id" json:"-"`
+	SessionID     string            `bson:"sessionID" json:"sessionID"`
+	Socket        string            `bson:"socket" json:"-"`
+	ParticipantID string            `bson:"participantID" json:"participantID"`
+	UserID        string            `bson:"userID" json:"userID"`
+	Account       string            `bson:"account,omitempty" json:"account,omitempty"`
+	Name          string            `bson:"name,omitempty" json:"name,omitempty"`
+	Role          string            `bson:"role,omitempty" json:"role,omitempty"`
+	Phone         bool              `bson:"phone,omitempty" json:"phone,omitempty"`
+	Metadata      map[string]string `bson:"metadata,omitempty" json:"metadata,omitempty"`
+	Joins         int               `bson:"joins" json:"joins"`
+	JoinedAt      time.Time         `bson:"joinedAt" json:"joinedAt"`
+	LastJoinedAt  time.Time         `bson:"lastJoinedAt" json:"lastJoinedAt"`
+	LeftAt        *time.Time        `bson:"leftAt,omitempty" json:"leftAt,omitempty"`
+	Seconds       float64           `bson:"seconds,omitempty" json:"seconds"`
+}
+
+// Attended is how long the participant has been in the room as of now,
+// counting their time since rejoining if they are still there.
+func (r AttendanceRecord) Attended(now time.Time) time.Duration {
+	attended := time.Duration(r.Seconds * float64(time.Second))
+	if r.LeftAt == nil {
+		attended += now.Sub(r.LastJoinedAt)
+	}
+	return attended
+}
+
+// Attendance records who attended each session in the attendance
+// collection. Writes happen in the background so a slow database does not
+// hold up joins. A nil Attendance records nothing.
+type Attendance struct {
+	collection *mongo.Collection
+}
+
+func NewAttendance(db *mongo.Client) *Attendance {
+	return &Attendance{collection: db.Database("vidchat").Collection("attendance")}
+}
+
+// Join records that the participant joined the session. account is the
+// signed-in user on the connection, empty for guests.
+func (a *Attendance) Join(sessionID, socket, account string, participant interfaces.Participant) {
+	if a == nil || sessionID == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		set := bson.M{
+			"socket":       socket,
+			"userID":       participant.UserID,
+			"name":         participant.Name,
+			"role":         participant.Role,
+			"lastJoinedAt": now,
+		}
+		if account != "" {
+			set["account"] = account
+		}
+		if participant.Phone != "" {
+			set["phone"] = true
+		}
+		if participant.Metadata != nil {
+			set["metadata"] = participant.Metadata
+		}
+		_, err := a.collection.UpdateOne(ctx,
+			bson.M{"_id": sessionID + "|" + participant.ID},
+			bson.M{
+				"$set":         set,
+				"$setOnInsert": bson.M{"sessionID": sessionID, "participantID": participant.ID, "joinedAt": now},
+				"$inc":         bson.M{"joins": 1},
+				"$unset":       bson.M{"leftAt": ""},
+			},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Error recording attendance of %s in %s: %s", participant.ID, sessionID, err)
+		}
+	}()
+}
+
+// Leave records that the participant left the session, adding the time
+// since they last joined to their attendance.
+func (a *Attendance) Leave(sessionID, participantID string) {
+	if a == nil || sessionID == "" || participantID == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		_, err := a.collection.UpdateOne(ctx,
+			bson.M{"_id": sessionID + "|" + participantID, "leftAt": bson.M{"$exists": false}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{
+				"leftAt": now,
+				"seconds": bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$seconds", 0}},
+					bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, "$lastJoinedAt"}}, 1000}},
+				}},
+			}}}})
+		if err != nil {
+			log.Printf("Error recording leave of %s from %s: %s", participantID, sessionID, err)
+		}
+	}()
+}
+
+// LoadAttendance returns the session's attendance, earliest first, keeping
+// only participants whose metadata has every key of filter set to its
+// value.
+func LoadAttendance(ctx context.Context, db *mongo.Client, sessionID string, filter map[string]string) ([]AttendanceRecord, error) {
+	query := bson.M{"sessionID": sessionID}
+	for key, value := range filter {
+		query["metadata."+key] = value
+	}
+	cursor, err := db.Database("vidchat").Collection("attendance").Find(ctx, query, options.Find().SetSort(bson.M{"joinedAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	records := []AttendanceRecord{}
+	err = cursor.All(ctx, &records)
+	return records, err
+}
+
+// AttendanceSummary is how a participant attended a meeting that ended:
+// how long they were there, how late they joined and how early they left.
+type AttendanceSummary struct {
+	Record   AttendanceRecord
+	Attended time.Duration
+	Late     time.Duration
+	Early    time.Duration
+}
+
+// Meeting is when a meeting that ended ran and who attended it.
+type Meeting struct {
+	Start, End time.Time
+	Attendees  []AttendanceSummary
+}
+
+// Length is how long the meeting ran.
+func (m Meeting) Length() time.Duration {
+	return max(m.End.Sub(m.Start), 0)
+}
+
+// SummarizeAttendance works out how each participant attended a meeting
+// that ended, as of now. The meeting is taken to run from startsAt, when
+// it was scheduled, or its first join, to its last leave, or endsAt if
+// that came first.
+func SummarizeAttendance(records []AttendanceRecord, startsAt, endsAt *time.Time, now time.Time) Meeting {
+	var meeting Meeting
+	if len(records) == 0 {
+		return meeting
+	}
+	meeting.Start = records[0].JoinedAt
+	if startsAt != nil {
+		meeting.Start = *startsAt
+	}
+	for _, record := range records {
+		left := now
+		if record.LeftAt != nil {
+			left = *record.LeftAt
+		}
+		if left.After(meeting.End) {
+			meeting.End = left
+		}
+	}
+	if endsAt != nil && endsAt.Before(meeting.End) {
+		meeting.End = *endsAt
+	}
+
+	for _, record := range records {
+		summary := AttendanceSummary{
+			Record:   record,
+			Attended: record.Attended(now),
+			Late:     max(record.JoinedAt.Sub(meeting.Start), 0),
+		}
+		if record.LeftAt != nil {
+			summary.Early = max(meeting.End.Sub(*record.LeftAt), 0)
+		}
+		meeting.Attendees = append(meeting.Attendees, summary)
+	}
+	return meeting
+}
@@ -0,0 +1,220 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bounds on the reaction kinds counted per minute; longer kinds, and kinds
+// beyond the limit, are counted as "other".
+const (
+	maxReactionKind  = 16
+	maxReactionKinds = 20
+)
+
+// AudienceSample is a minute of a broadcast's audience: how many viewers
+// watched, how many came and went, and how they reacted.
+type AudienceSample struct {
+	SessionID string         `bson:"sessionID" json:"-"`
+	Socket    string         `bson:"socket" json:"-"`
+	Minute    time.Time      `bson:"minute" json:"minute"`
+	Viewers   int            `bson:"viewers" json:"viewers"`
+	Peak      int            `bson:"peak" json:"peak"`
+	Joins     int            `bson:"joins" json:"joins"`
+	Leaves    int            `bson:"leaves" json:"leaves"`
+	Reactions int            `bson:"reactions" json:"reactions"`
+	ByKind    map[string]int `bson:"byKind,omitempty" json:"byKind,omitempty"`
+}
+
+// LiveAudience is what a host is shown while broadcasting.
+type LiveAudience struct {
+	Viewers int `json:"viewers"`
+	Peak    int `json:"peak"`
+	// ReactionsPerMinute counts reactions over the last full minute and
+	// the current one so far.
+	ReactionsPerMinute int `json:"reactionsPerMinute"`
+}
+
+type broadcast struct {
+	sessionID string
+	viewers   map[string]bool
+	peak      int
+	current   AudienceSample
+	last      AudienceSample
+}
+
+// Audience tracks the viewers of the broadcasts running on this node and
+// saves a sample per minute in the audience collection. A nil Audience
+// records nothing.
+type Audience struct {
+	collection *mongo.Collection
+
+	mu         sync.Mutex
+	broadcasts map[string]*broadcast
+}
+
+func NewAudience(db *mongo.Client) *Audience {
+	return &Audience{
+		collection: db.Database("vidchat").Collection("audience"),
+		broadcasts: make(map[string]*broadcast),
+	}
+}
+
+// broadcast returns the room's broadcast with its current sample for now,
+// saving the previous minute's sample if it just ended.
+func (a *Audience) broadcast(socket, sessionID string, now time.Time) *broadcast {
+	b := a.broadcasts[socket]
+	if b == nil {
+		b = &broadcast{sessionID: sessionID, viewers: make(map[string]bool)}
+		a.broadcasts[socket] = b
+	}
+	minute := now.Truncate(time.Minute)
+	if !b.current.Minute.Equal(minute) {
+		if !b.current.Minute.IsZero() {
+			b.last = b.current
+			go a.save(b.last)
+		}
+		b.current = AudienceSample{SessionID: sessionID, Socket: socket, Minute: minute, Viewers: len(b.viewers), Peak: len(b.viewers)}
+	}
+	return b
+}
+
+// Join counts the user as a viewer of the room's broadcast. Joining again
+// without leaving counts once.
+func (a *Audience) Join(socket, sessionID, userID string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.broadcast(socket, sessionID, time.Now())
+	if b.viewers[userID] {
+		return
+	}
+	b.viewers[userID] = true
+	b.current.Joins++
+	b.current.Viewers = len(b.viewers)
+	if b.current.Viewers > b.current.Peak {
+		b.current.Peak = b.current.Viewers
+	}
+	if b.current.Viewers > b.peak {
+		b.peak = b.current.Viewers
+	}
+}
+
+// Leave stops counting the user as a viewer.
+func (a *Audience) Leave(socket, userID string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.broadcasts[socket]
+	if b == nil || !b.viewers[userID] {
+		return
+	}
+	b = a.broadcast(socket, b.sessionID, time.Now())
+	delete(b.viewers, userID)
+	b.current.Leaves++
+	b.current.Viewers = len(b.viewers)
+}
+
+// React counts a reaction of the given kind, e.g. an emoji, in the room's
+// broadcast.
+func (a *Audience) React(socket, sessionID, kind string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.broadcast(socket, sessionID, time.Now())
+	b.current.Reactions++
+	if b.current.ByKind == nil {
+		b.current.ByKind = make(map[string]int)
+	}
+	if _, ok := b.current.ByKind[kind]; !ok && (len(kind) > maxReactionKind || len(b.current.ByKind) >= maxReactionKinds) {
+		kind = "other"
+	}
+	b.current.ByKind[kind]++
+}
+
+// Live returns the room's audience now, false if it has no broadcast on
+// this node.
+func (a *Audience) Live(socket string) (LiveAudience, bool) {
+	if a == nil {
+		return LiveAudience{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.broadcasts[socket]
+	if b == nil {
+		return LiveAudience{}, false
+	}
+	b = a.broadcast(socket, b.sessionID, time.Now())
+	live := LiveAudience{Viewers: len(b.viewers), Peak: b.peak, ReactionsPerMinute: b.current.Reactions}
+	if b.last.Minute.Equal(b.current.Minute.Add(-time.Minute)) {
+		live.ReactionsPerMinute += b.last.Reactions
+	}
+	return live, true
+}
+
+// End saves the room's current minute and forgets its broadcast.
+func (a *Audience) End(socket string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	b := a.broadcasts[socket]
+	delete(a.broadcasts, socket)
+	a.mu.Unlock()
+	if b != nil && !b.current.Minute.IsZero() {
+		a.save(b.current)
+	}
+}
+
+func (a *Audience) save(sample AudienceSample) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := a.collection.ReplaceOne(ctx,
+		bson.M{"_id": sample.Socket + "|" + sample.Minute.UTC().Format(time.RFC3339)},
+		sample,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error saving audience of %s: %s", sample.Socket, err)
+	}
+}
+
+// AudienceSummary totals a broadcast's samples.
+type AudienceSummary struct {
+	Peak      int `json:"peak"`
+	Joins     int `json:"joins"`
+	Reactions int `json:"reactions"`
+}
+
+// LoadAudience returns the session's audience samples, earliest first, with
+// their totals.
+func LoadAudience(ctx context.Context, db *mongo.Client, sessionID string) ([]AudienceSample, AudienceSummary, error) {
+	var summary AudienceSummary
+	cursor, err := db.Database("vidchat").Collection("audience").Find(ctx, bson.M{"sessionID": sessionID}, options.Find().SetSort(bson.M{"minute": 1}))
+	if err != nil {
+		return nil, summary, err
+	}
+	samples := []AudienceSample{}
+	if err := cursor.All(ctx, &samples); err != nil {
+		return nil, summary, err
+	}
+	for _, sample := range samples {
+		if sample.Peak > summary.Peak {
+			summary.Peak = sample.Peak
+		}
+		summary.Joins += sample.Joins
+		summary.Reactions += sample.Reactions
+	}
+	return samples, summary, nil
+}
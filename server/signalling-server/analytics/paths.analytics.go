@@ -0,0 +1,161 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Candidate is one end of a selected ICE candidate pair, as reported by the
+// browser's getStats.
+type Candidate struct {
+	// Type is "host", "srflx", "prflx" or "relay".
+	Type string `bson:"type" json:"type"`
+	// Protocol is "udp" or "tcp".
+	Protocol string `bson:"protocol" json:"protocol"`
+	// RelayProtocol is how a relay candidate reaches its TURN server:
+	// "udp", "tcp" or "tls".
+	RelayProtocol string `bson:"relayProtocol,omitempty" json:"relayProtocol,omitempty"`
+}
+
+// Path is the candidate pair a participant's connection to a peer, or to
+// the SFU, settled on.
+type Path struct {
+	SessionID string    `bson:"sessionID" json:"-"`
+	Socket    string    `bson:"socket" json:"-"`
+	UserID    string    `bson:"userID" json:"userID"`
+	Peer      string    `bson:"peer" json:"peer"`
+	Local     Candidate `bson:"local" json:"local"`
+	Remote    Candidate `bson:"remote" json:"remote"`
+	RTT       float64   `bson:"rtt,omitempty" json:"rtt,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Relayed reports whether the path goes through TURN.
+func (p Path) Relayed() bool {
+	return p.Local.Type == "relay" || p.Remote.Type == "relay"
+}
+
+var candidateTypes = map[string]bool{"host": true, "srflx": true, "prflx": true, "relay": true}
+
+// Valid reports whether the path uses known candidate types and protocols.
+func (p Path) Valid() bool {
+	for _, candidate := range []Candidate{p.Local, p.Remote} {
+		if !candidateTypes[candidate.Type] || (candidate.Protocol != "udp" && candidate.Protocol != "tcp") {
+			return false
+		}
+	}
+	switch p.Local.RelayProtocol {
+	case "", "udp", "tcp", "tls":
+		return true
+	}
+	return false
+}
+
+type pathKey struct {
+	local, remote, protocol, relayProtocol string
+}
+
+// Paths records the connection paths participants report, saving each
+// participant's latest path per peer and counting selected pairs by type for
+// the metrics endpoint. A nil Paths records nothing.
+type Paths struct {
+	collection *mongo.Collection
+
+	mu     sync.Mutex
+	counts map[pathKey]int
+}
+
+func NewPaths(db *mongo.Client) *Paths {
+	return &Paths{
+		collection: db.Database("vidchat").Collection("connection_paths"),
+		counts:     make(map[pathKey]int),
+	}
+}
+
+// Record saves a reported path. A path reported again, e.g. after an ICE
+// restart, replaces the previous one and counts again.
+func (p *Paths) Record(path Path) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.counts[pathKey{path.Local.Type, path.Remote.Type, path.Local.Protocol, path.Local.RelayProtocol}]++
+	p.mu.Unlock()
+
+	path.UpdatedAt = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := p.collection.ReplaceOne(ctx,
+		bson.M{"_id": path.Socket + "|" + path.UserID + "|" + path.Peer},
+		path,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error saving connection path of %s: %s", path.UserID, err)
+	}
+}
+
+// WriteMetrics writes the selected pair counts in the Prometheus text
+// format.
+func (p *Paths) WriteMetrics(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	lines := make([]string, 0, len(p.counts))
+	for key, count := range p.counts {
+		lines = append(lines, fmt.Sprintf("videoconf_ice_selected_pairs_total{local=%q,remote=%q,protocol=%q,relay_protocol=%q} %d",
+			key.local, key.remote, key.protocol, key.relayProtocol, count))
+	}
+	p.mu.Unlock()
+	sort.Strings(lines)
+
+	fmt.Fprintln(w, "# HELP videoconf_ice_selected_pairs_total ICE candidate pairs selected by participants, by candidate type and transport.")
+	fmt.Fprintln(w, "# TYPE videoconf_ice_selected_pairs_total counter")
+	if len(lines) > 0 {
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	}
+}
+
+// PathSummary aggregates a session's paths for its quality report.
+type PathSummary struct {
+	Paths   int            `json:"paths"`
+	Relayed int            `json:"relayed"`
+	TCP     int            `json:"tcp"`
+	ByType  map[string]int `json:"byType"`
+}
+
+// LoadPaths returns the latest paths reported in a room, with a summary.
+func LoadPaths(ctx context.Context, db *mongo.Client, socket string) ([]Path, PathSummary, error) {
+	summary := PathSummary{ByType: make(map[string]int)}
+
+	cursor, err := db.Database("vidchat").Collection("connection_paths").Find(ctx, bson.M{"socket": socket})
+	if err != nil {
+		return nil, summary, err
+	}
+	paths := []Path{}
+	if err := cursor.All(ctx, &paths); err != nil {
+		return nil, summary, err
+	}
+
+	for _, path := range paths {
+		summary.Paths++
+		if path.Relayed() {
+			summary.Relayed++
+		}
+		if path.Local.Protocol == "tcp" || path.Local.RelayProtocol == "tcp" || path.Local.RelayProtocol == "tls" {
+			summary.TCP++
+		}
+		summary.ByType[path.Local.Type+"/"+path.Remote.Type]++
+	}
+	return paths, summary, nil
+}
@@ -0,0 +1,273 @@
+// Package analytics keeps per-participant records of sessions: who attended,
+// and speaking statistics derived from the audio_level messages clients
+// relay through the signalling socket.
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SpeakerStats is one participant's share of a session. Totals accumulate
+// across reconnects and across nodes the room moved between.
+type SpeakerStats struct {
+	SessionID      string  `bson:"sessionID" json:"-"`
+	Socket         string  `bson:"socket" json:"-"`
+	UserID         string  `bson:"userID" json:"userID"`
+	TalkSeconds    float64 `bson:"talkSeconds" json:"talkSeconds"`
+	PresentSeconds float64 `bson:"presentSeconds" json:"presentSeconds"`
+	Interruptions  int     `bson:"interruptions" json:"interruptions"`
+	SilenceRatio   float64 `bson:"-" json:"silenceRatio"`
+}
+
+type speaker struct {
+	joined        time.Time
+	present       time.Duration
+	talkingSince  time.Time
+	talk          time.Duration
+	interruptions int
+}
+
+func (s *speaker) talking() bool {
+	return !s.talkingSince.IsZero()
+}
+
+// stop ends the speaker's current turn and presence, if any, at now.
+func (s *speaker) stop(now time.Time) {
+	if s.talking() {
+		s.talk += now.Sub(s.talkingSince)
+		s.talkingSince = time.Time{}
+	}
+	if !s.joined.IsZero() {
+		s.present += now.Sub(s.joined)
+		s.joined = time.Time{}
+	}
+}
+
+type meeting struct {
+	sessionID string
+	speakers  map[string]*speaker
+}
+
+// Speakers tracks who is talking in each room on this node. A nil Speakers
+// records nothing.
+type Speakers struct {
+	collection *mongo.Collection
+	threshold  float64
+
+	mu       sync.Mutex
+	meetings map[string]*meeting
+}
+
+// NewSpeakers returns a tracker treating audio levels at or above threshold
+// (0-1) as speech.
+func NewSpeakers(db *mongo.Client, threshold float64) *Speakers {
+	return &Speakers{
+		collection: db.Database("vidchat").Collection("speaker_stats"),
+		threshold:  threshold,
+		meetings:   make(map[string]*meeting),
+	}
+}
+
+func (s *Speakers) speaker(socket, sessionID, userID string, now time.Time) *speaker {
+	m := s.meetings[socket]
+	if m == nil {
+		m = &meeting{sessionID: sessionID, speakers: make(map[string]*speaker)}
+		s.meetings[socket] = m
+	}
+	p := m.speakers[userID]
+	if p == nil {
+		p = &speaker{}
+		m.speakers[userID] = p
+	}
+	if p.joined.IsZero() {
+		p.joined = now
+	}
+	return p
+}
+
+// Join starts counting the user's presence in the room.
+func (s *Speakers) Join(socket, sessionID, userID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speaker(socket, sessionID, userID, time.Now())
+}
+
+// Level records an audio level reported by the user. Starting to speak while
+// someone else holds the floor counts as an interruption.
+func (s *Speakers) Level(socket, sessionID, userID string, level float64) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.speaker(socket, sessionID, userID, now)
+
+	if level < s.threshold {
+		if p.talking() {
+			p.talk += now.Sub(p.talkingSince)
+			p.talkingSince = time.Time{}
+		}
+		return
+	}
+	if p.talking() {
+		return
+	}
+
+	for other, o := range s.meetings[socket].speakers {
+		if other != userID && o.talking() {
+			p.interruptions++
+			break
+		}
+	}
+	p.talkingSince = now
+}
+
+// Leave stops counting the user's presence and any turn they were taking.
+func (s *Speakers) Leave(socket, userID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.meetings[socket]; m != nil {
+		if p := m.speakers[userID]; p != nil {
+			p.stop(time.Now())
+		}
+	}
+}
+
+// Stats returns the live statistics for the room, or nil if it isn't
+// running on this node.
+func (s *Speakers) Stats(socket string) []SpeakerStats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats(socket, time.Now())
+}
+
+func (s *Speakers) stats(socket string, now time.Time) []SpeakerStats {
+	m := s.meetings[socket]
+	if m == nil {
+		return nil
+	}
+
+	stats := make([]SpeakerStats, 0, len(m.speakers))
+	for userID, p := range m.speakers {
+		current := *p
+		current.stop(now)
+		stats = append(stats, SpeakerStats{
+			SessionID:      m.sessionID,
+			Socket:         socket,
+			UserID:         userID,
+			TalkSeconds:    current.talk.Seconds(),
+			PresentSeconds: current.present.Seconds(),
+			Interruptions:  current.interruptions,
+		})
+	}
+	return Finish(stats)
+}
+
+// End persists the room's statistics and forgets it. Totals are added to
+// whatever earlier nodes recorded for the same session.
+func (s *Speakers) End(socket string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	stats := s.stats(socket, time.Now())
+	delete(s.meetings, socket)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, stat := range stats {
+		_, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": socket + "|" + stat.UserID},
+			bson.M{
+				"$set": bson.M{"sessionID": stat.SessionID, "socket": socket, "userID": stat.UserID, "updatedAt": time.Now()},
+				"$inc": bson.M{"talkSeconds": stat.TalkSeconds, "presentSeconds": stat.PresentSeconds, "interruptions": stat.Interruptions},
+			},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Error saving speaker stats for %s: %s", socket, err)
+		}
+	}
+}
+
+// Flush persists every room still running, e.g. before the node shuts down.
+func (s *Speakers) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	var sockets []string
+	for socket := range s.meetings {
+		sockets = append(sockets, socket)
+	}
+	s.mu.Unlock()
+
+	for _, socket := range sockets {
+		s.End(socket)
+	}
+}
+
+// Load returns the saved statistics for a room.
+func Load(ctx context.Context, db *mongo.Client, socket string) ([]SpeakerStats, error) {
+	cursor, err := db.Database("vidchat").Collection("speaker_stats").Find(ctx, bson.M{"socket": socket})
+	if err != nil {
+		return nil, err
+	}
+	var stats []SpeakerStats
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return Finish(stats), nil
+}
+
+// Merge adds live statistics onto saved ones.
+func Merge(saved, live []SpeakerStats) []SpeakerStats {
+	byUser := make(map[string]int, len(saved))
+	for i, stat := range saved {
+		byUser[stat.UserID] = i
+	}
+	for _, stat := range live {
+		i, ok := byUser[stat.UserID]
+		if !ok {
+			byUser[stat.UserID] = len(saved)
+			saved = append(saved, stat)
+			continue
+		}
+		saved[i].TalkSeconds += stat.TalkSeconds
+		saved[i].PresentSeconds += stat.PresentSeconds
+		saved[i].Interruptions += stat.Interruptions
+	}
+	return Finish(saved)
+}
+
+// Finish fills in the derived silence ratios.
+func Finish(stats []SpeakerStats) []SpeakerStats {
+	for i := range stats {
+		stats[i].SilenceRatio = 0
+		if stats[i].PresentSeconds > 0 {
+			stats[i].SilenceRatio = 1 - stats[i].TalkSeconds/stats[i].PresentSeconds
+			if stats[i].SilenceRatio < 0 {
+				stats[i].SilenceRatio = 0
+			}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,128 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Timeline event types.
+const (
+	EventJoin    = "join"
+	EventLeave   = "leave"
+	EventDropped = "dropped"
+	EventResumed = "resumed"
+
+	EventMute   = "mute"
+	EventUnmute = "unmute"
+
+	EventScreenShareStart = "screen_share_start"
+	EventScreenShareStop  = "screen_share_stop"
+
+	// EventReaction is a reaction sent to the room, e.g. an emoji.
+	EventReaction = "reaction"
+
+	EventRecordingStart = "recording_start"
+	EventRecordingStop  = "recording_stop"
+
+	// EventFloor is a webinar floor control transition; its data says which
+	// and which host made it.
+	EventFloor = "floor"
+
+	// EventAgendaItem is an agenda item that ended; its data compares its
+	// planned and actual duration in seconds.
+	EventAgendaItem = "agenda_item"
+
+	// EventInactive is a participant warned of being inactive; its data
+	// says whether they were then removed.
+	EventInactive = "inactive"
+
+	// EventMarker is a chapter marker, dropped by a host or added for an
+	// event such as a screen share starting.
+	EventMarker = "marker"
+)
+
+// TimelineEvent is something that happened in a session's room. UserID is
+// empty for events that are not about a participant, such as a recording
+// started through the API.
+type TimelineEvent struct {
+	SessionID     string                 `bson:"sessionID" json:"-"`
+	At            time.Time              `bson:"at" json:"at"`
+	Seq           int64                  `bson:"seq" json:"-"`
+	Type          string                 `bson:"type" json:"type"`
+	UserID        string                 `bson:"userID,omitempty" json:"userID,omitempty"`
+	ParticipantID string                 `bson:"participantID,omitempty" json:"participantID,omitempty"`
+	Data          map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+}
+
+// Timeline records room events in the timeline collection, for reviewing a
+// meeting afterwards. Writes happen in the background; events keep the
+// order they were recorded in even if the writes complete out of order. A
+// nil Timeline records nothing.
+type Timeline struct {
+	collection *mongo.Collection
+	seq        atomic.Int64
+}
+
+func NewTimeline(db *mongo.Client) *Timeline {
+	t := &Timeline{collection: db.Database("vidchat").Collection("timeline")}
+	t.seq.Store(time.Now().UnixNano())
+	return t
+}
+
+// Record adds event to the session's timeline, stamped with the current
+// time.
+func (t *Timeline) Record(sessionID string, event TimelineEvent) {
+	if t == nil || sessionID == "" {
+		return
+	}
+	event.SessionID = sessionID
+	event.At = time.Now()
+	event.Seq = t.seq.Add(1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := t.collection.InsertOne(ctx, event); err != nil {
+			log.Printf("Error recording %s in the timeline of %s: %s", event.Type, sessionID, err)
+		}
+	}()
+}
+
+// LoadTimeline returns the session's events in the order they happened,
+// optionally only those of the given types.
+func LoadTimeline(ctx context.Context, db *mongo.Client, sessionID string, types []string) ([]TimelineEvent, error) {
+	query := bson.M{"sessionID": sessionID}
+	if len(types) > 0 {
+		query["type"] = bson.M{"$in": types}
+	}
+	cursor, err := db.Database("vidchat").Collection("timeline").Find(ctx, query, options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	events := []TimelineEvent{}
+	err = cursor.All(ctx, &events)
+	return events, err
+}
+
+// RecentTimeline returns the session's last limit events, in the order they
+// happened.
+func RecentTimeline(ctx context.Context, db *mongo.Client, sessionID string, limit int64) ([]TimelineEvent, error) {
+	cursor, err := db.Database("vidchat").Collection("timeline").Find(ctx, bson.M{"sessionID": sessionID},
+		options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "seq", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	events := []TimelineEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
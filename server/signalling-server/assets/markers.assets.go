@@ -0,0 +1,57 @@
+package assets
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxMarkers bounds the markers of a recording.
+const maxMarkers = 1000
+
+// Markers adds chapter markers to a session's running recordings.
+type Markers struct {
+	recordings *mongo.Collection
+}
+
+func NewMarkers(db *mongo.Client) *Markers {
+	return &Markers{recordings: db.Database("vidchat").Collection("recordings")}
+}
+
+// Add appends the marker to every recording of the session running now,
+// each at its own offset, and returns how many recordings it marked.
+// Markers outside a recording have nothing to mark and are dropped.
+func (m *Markers) Add(ctx context.Context, sessionID string, marker interfaces.RecordingMarker) (int64, error) {
+	// The offset is worked out by the database from each recording's start,
+	// so concurrent recordings of the session each get theirs in one update.
+	// Strings are literals, or a title starting with $ would name a field.
+	entry := bson.M{
+		"offset": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{marker.At, "$startedAt"}}, 1000}},
+		"kind":   bson.M{"$literal": marker.Kind},
+		"title":  bson.M{"$literal": marker.Title},
+		"at":     marker.At,
+	}
+	if marker.UserID != "" {
+		entry["userID"] = bson.M{"$literal": marker.UserID}
+	}
+	result, err := m.recordings.UpdateMany(ctx,
+		bson.M{
+			"sessionID":                             sessionID,
+			"status":                                interfaces.RecordingActive,
+			"markers." + strconv.Itoa(maxMarkers-1): bson.M{"$exists": false},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"markers": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$markers", bson.A{}}},
+				bson.A{entry},
+			}},
+		}}}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
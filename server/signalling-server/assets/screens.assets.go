@@ -0,0 +1,147 @@
+// Package assets adds to a meeting's composite recordings what playback
+// needs beyond them: each shared screen recorded on its own at full
+// resolution, and chapter markers.
+package assets
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Screens records every screen shared during a recording as an asset of
+// the recording. Shares are recorded from when they start, or from when
+// the recording does if they were already running.
+type Screens struct {
+	recordings *mongo.Collection
+	recorder   media.Recorder
+	screens    media.ScreenRecorder
+}
+
+// NewScreens returns nil, which records nothing, when the backend cannot
+// record screen shares on their own.
+func NewScreens(db *mongo.Client, backend media.Backend) *Screens {
+	recorder, ok := backend.(media.Recorder)
+	screens, ok2 := backend.(media.ScreenRecorder)
+	if !ok || !ok2 {
+		return nil
+	}
+	return &Screens{
+		recordings: db.Database("vidchat").Collection("recordings"),
+		recorder:   recorder,
+		screens:    screens,
+	}
+}
+
+// Start records the user's screen share in every recording of the session
+// running to a file.
+func (s *Screens) Start(ctx context.Context, sessionID, userID string) {
+	if s == nil {
+		return
+	}
+	cursor, err := s.recordings.Find(ctx, bson.M{
+		"sessionID": sessionID,
+		"status":    interfaces.RecordingActive,
+		"streams":   bson.M{"$exists": false},
+	})
+	if err != nil {
+		log.Printf("Error loading recordings of %s: %s", sessionID, err)
+		return
+	}
+	var recordings []interfaces.Recording
+	if err := cursor.All(ctx, &recordings); err != nil {
+		log.Printf("Error loading recordings of %s: %s", sessionID, err)
+		return
+	}
+
+	for _, recording := range recordings {
+		if len(open(recording, userID)) > 0 {
+			continue
+		}
+		started, err := s.screens.StartScreenRecording(ctx, sessionID, userID)
+		if err != nil {
+			log.Printf("Error recording the screen of %s in %s: %s", userID, recording.ID, err)
+			continue
+		}
+		now := time.Now()
+		asset := interfaces.RecordingAsset{
+			ID:          started.ID,
+			Kind:        interfaces.AssetScreenShare,
+			UserID:      userID,
+			Location:    started.Location,
+			StartOffset: now.Sub(recording.StartedAt).Seconds(),
+			StartedAt:   now,
+		}
+		_, err = s.recordings.UpdateOne(ctx, bson.M{"_id": recording.ID}, bson.M{"$push": bson.M{"assets": asset}})
+		if err != nil {
+			log.Printf("Error saving the screen recording of %s in %s: %s", userID, recording.ID, err)
+		}
+	}
+}
+
+// Stop ends the user's screen share assets in the session's recordings.
+func (s *Screens) Stop(ctx context.Context, sessionID, userID string) {
+	if s == nil {
+		return
+	}
+	cursor, err := s.recordings.Find(ctx, bson.M{
+		"sessionID": sessionID,
+		"assets":    bson.M{"$elemMatch": bson.M{"userID": userID, "stoppedAt": bson.M{"$exists": false}}},
+	})
+	if err != nil {
+		log.Printf("Error loading recordings of %s: %s", sessionID, err)
+		return
+	}
+	var recordings []interfaces.Recording
+	if err := cursor.All(ctx, &recordings); err != nil {
+		log.Printf("Error loading recordings of %s: %s", sessionID, err)
+		return
+	}
+	for _, recording := range recordings {
+		for _, asset := range open(recording, userID) {
+			s.end(ctx, recording, asset)
+		}
+	}
+}
+
+// StopAll ends every asset of a recording that is stopping.
+func (s *Screens) StopAll(ctx context.Context, recording interfaces.Recording) {
+	if s == nil {
+		return
+	}
+	for _, asset := range open(recording, "") {
+		s.end(ctx, recording, asset)
+	}
+}
+
+func (s *Screens) end(ctx context.Context, recording interfaces.Recording, asset interfaces.RecordingAsset) {
+	// The egress ends by itself when the participant leaves the media room.
+	if err := s.recorder.StopRecording(ctx, asset.ID); err != nil {
+		log.Printf("Error stopping the screen recording %s: %s", asset.ID, err)
+	}
+	now := time.Now()
+	_, err := s.recordings.UpdateOne(ctx,
+		bson.M{"_id": recording.ID, "assets.id": asset.ID},
+		bson.M{"$set": bson.M{"assets.$.stoppedAt": now, "assets.$.endOffset": now.Sub(recording.StartedAt).Seconds()}})
+	if err != nil {
+		log.Printf("Error saving the screen recording %s: %s", asset.ID, err)
+	}
+}
+
+// open returns the recording's assets still running, of userID or of
+// everyone when it is empty.
+func open(recording interfaces.Recording, userID string) []interfaces.RecordingAsset {
+	var running []interfaces.RecordingAsset
+	for _, asset := range recording.Assets {
+		if asset.StoppedAt == nil && (userID == "" || asset.UserID == userID) {
+			running = append(running, asset)
+		}
+	}
+	return running
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/crm"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+)
+
+// automations delivers events to users' and orgs' REST hooks.
+var automations *automation.Hooks
+
+// courses posts attendance to the gradebooks of LTI course meetings, when
+// LTI_PRIVATE_KEY is set.
+var courses *lti.Tool
+
+// crms records meetings with external participants in their orgs' CRMs.
+var crms *crm.Sync
+
+// attendanceDelay is how long a room stays empty before its meeting counts
+// as ended, so everyone reconnecting at once does not end it.
+const attendanceDelay = time.Minute
+
+var (
+	attendanceMu     sync.Mutex
+	attendanceTimers = make(map[string]*time.Timer)
+)
+
+// endAttendance reports the attendance of the room's meeting once the room
+// has stayed empty for attendanceDelay. A room emptying again before then
+// starts the wait over, so its meeting is reported once.
+func endAttendance(socket string, clients *interfaces.Room) {
+	attendanceMu.Lock()
+	defer attendanceMu.Unlock()
+
+	if timer := attendanceTimers[socket]; timer != nil {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(attendanceDelay, func() {
+		attendanceMu.Lock()
+		if attendanceTimers[socket] == timer {
+			delete(attendanceTimers, socket)
+		}
+		attendanceMu.Unlock()
+		reportAttendance(socket, clients)
+	})
+	attendanceTimers[socket] = timer
+}
+
+// reportAttendance marks the room's session ended, fires
+// attendance.recorded for the students of its meeting, posts their scores
+// to its course and records it in its org's CRM, unless someone came back
+// or the room moved to another node.
+func reportAttendance(socket string, clients *interfaces.Room) {
+	socketsMu.Lock()
+	current := sockets[socket] == clients
+	socketsMu.Unlock()
+	if !current || clients.Len() > 0 {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(clients.Session)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var session interfaces.Session
+	if err := database.Database("vidchat").Collection("sessions").FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		log.Printf("Error loading session %s to report attendance: %s", clients.Session, err)
+		return
+	}
+	var record interfaces.Socket
+	database.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"socketUrl": socket}).Decode(&record)
+	records, err := analytics.LoadAttendance(ctx, database, clients.Session, nil)
+	if err != nil {
+		log.Printf("Error loading attendance of %s: %s", clients.Session, err)
+		return
+	}
+	endSession(ctx, id, session)
+	meeting := analytics.SummarizeAttendance(records, session.StartsAt, session.EndsAt, time.Now())
+	automations.AttendanceRecorded(ctx, session, clients.Session, record.HashedURL, meeting)
+	courses.PostScores(ctx, clients.Session, meeting)
+	crms.MeetingEnded(session, clients.Session, record.HashedURL, meeting)
+}
+
+// endSession marks a session ended, so the endedAt index removes it
+// EndedSessionTTL later. Sessions still scheduled to run are left alone,
+// so a host trying the link early does not end them, and cancelled ones
+// were marked when cancelled.
+func endSession(ctx context.Context, id primitive.ObjectID, session interfaces.Session) {
+	now := time.Now()
+	if session.CancelledAt != nil || (session.EndsAt != nil && session.EndsAt.After(now)) {
+		return
+	}
+	if _, err := database.Database("vidchat").Collection("sessions").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"endedAt": now}}); err != nil {
+		log.Printf("Error ending session %s: %s", id.Hex(), err)
+	}
+}
+
+// reopenSession clears the end of a session whose room is joined again, so
+// it is not removed while still in use.
+func reopenSession(sessionID string) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = database.Database("vidchat").Collection("sessions").UpdateOne(ctx,
+		bson.M{"_id": id, "endedAt": bson.M{"$exists": true}, "cancelledAt": bson.M{"$exists": false}},
+		bson.M{"$unset": bson.M{"endedAt": ""}})
+	if err != nil {
+		log.Printf("Error reopening session %s: %s", sessionID, err)
+	}
+}
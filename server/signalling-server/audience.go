@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// audience counts the viewers of webinars on this node.
+var audience *analytics.Audience
+
+// viewerJoined counts a webinar attendee as a viewer.
+func viewerJoined(socket string, clients *interfaces.Room, participant interfaces.Participant) {
+	if clients.Settings.Webinar && participant.Role == interfaces.RoleAttendee {
+		audience.Join(socket, clients.Session, participant.UserID)
+	}
+}
+
+// react counts a reaction relayed in a webinar, by its data.emoji.
+func react(socket string, clients *interfaces.Room, frame json.RawMessage) {
+	if !clients.Settings.Webinar {
+		return
+	}
+	var reaction struct {
+		Data struct {
+			Emoji string `json:"emoji"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &reaction)
+	audience.React(socket, clients.Session, reaction.Data.Emoji)
+}
+
+// watchAudience sends the hosts of every webinar on this node its audience
+// every interval, when it changed.
+func watchAudience(interval time.Duration) {
+	sent := make(map[string]analytics.LiveAudience)
+	for range time.Tick(interval) {
+		rooms := localRooms()
+		for socket := range sent {
+			if rooms[socket] == nil {
+				delete(sent, socket)
+			}
+		}
+		for socket, clients := range rooms {
+			live, ok := audience.Live(socket)
+			if !ok || live == sent[socket] {
+				continue
+			}
+			sent[socket] = live
+			message := interfaces.Message{Type: "audience", Data: live}
+			for _, host := range clients.Hosts() {
+				host.Send(message)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package auth ties signalling sockets to the login sessions issued by the
+// users service, so that signing a device out also drops its live sockets.
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// RoleDevice is the role of meeting-room hardware, which may join meetings
+// but not host or run them.
+const RoleDevice = "device"
+
+// Claims mirrors the access tokens minted by the users service.
+type Claims struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// Impersonator is set when an admin is acting as the user.
+	Impersonator string `json:"imp,omitempty"`
+	jwt_lib.StandardClaims
+}
+
+// Device reports whether the token belongs to a device account.
+func (c *Claims) Device() bool {
+	return c != nil && c.Role == RoleDevice
+}
+
+// Sessions authenticates sockets and kicks the ones whose login session has
+// been revoked. Sockets without a token stay anonymous. A nil Sessions
+// accepts every socket anonymously.
+type Sessions struct {
+	secret     []byte
+	collection *mongo.Collection
+	audit      *mongo.Collection
+
+	mu      sync.Mutex
+	sockets map[string]map[*interfaces.Connection]bool
+}
+
+func NewSessions(db *mongo.Client, secret string) *Sessions {
+	return &Sessions{
+		secret:     []byte(secret),
+		collection: db.Database("vidchat").Collection("login_sessions"),
+		audit:      db.Database("vidchat").Collection("audit_log"),
+		sockets:    make(map[string]map[*interfaces.Connection]bool),
+	}
+}
+
+// Authenticate returns the claims of the access token presented with a
+// socket request, in the token query parameter (browsers cannot set headers
+// on WebSocket requests) or the Authorization header. It returns nil for
+// anonymous requests. Requests made with impersonation tokens are audited.
+func (s *Sessions) Authenticate(r *http.Request) (*Claims, error) {
+	if s == nil {
+		return nil, nil
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return nil, nil
+	}
+
+	claims := &Claims{}
+	_, err := jwt_lib.ParseWithClaims(token, claims, func(token *jwt_lib.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt_lib.SigningMethodHMAC); !ok {
+			return nil, ErrUnauthorized
+		}
+		return s.secret, nil
+	})
+	if err != nil || claims.SessionID == "" || claims.Subject == "" {
+		return nil, ErrUnauthorized
+	}
+
+	id, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	var session struct {
+		RevokedAt *time.Time `bson:"revokedAt"`
+	}
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil || session.RevokedAt != nil {
+		return nil, ErrUnauthorized
+	}
+
+	if claims.Impersonator != "" {
+		s.auditImpersonated(ctx, r, claims)
+	}
+	return claims, nil
+}
+
+// auditImpersonated records a request made with an impersonation token in
+// the audit log the users service keeps.
+func (s *Sessions) auditImpersonated(ctx context.Context, r *http.Request, claims *Claims) {
+	_, err := s.audit.InsertOne(ctx, bson.M{
+		"_id":       primitive.NewObjectID(),
+		"at":        time.Now(),
+		"action":    "impersonated_request",
+		"actor":     claims.Impersonator,
+		"userID":    claims.Subject,
+		"sessionID": claims.SessionID,
+		"service":   "signalling",
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"ip":        r.RemoteAddr,
+		"requestID": utils.RequestID(r.Context()),
+	})
+	if err != nil {
+		log.Printf("Error auditing impersonated request by %s: %s", claims.Impersonator, err)
+	}
+}
+
+// Track registers a socket under its login session and returns a function
+// removing it again.
+func (s *Sessions) Track(claims *Claims, connection *interfaces.Connection) func() {
+	if s == nil || claims == nil {
+		return func() {}
+	}
+	sessionID := claims.SessionID
+
+	s.mu.Lock()
+	if s.sockets[sessionID] == nil {
+		s.sockets[sessionID] = make(map[*interfaces.Connection]bool)
+	}
+	s.sockets[sessionID][connection] = true
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.sockets[sessionID], connection)
+		if len(s.sockets[sessionID]) == 0 {
+			delete(s.sockets, sessionID)
+		}
+	}
+}
+
+// Watch polls for revoked login sessions and closes their sockets.
+func (s *Sessions) Watch(interval time.Duration) {
+	if s == nil {
+		return
+	}
+	since := time.Now()
+	for {
+		time.Sleep(interval)
+		since = s.kickRevoked(since)
+	}
+}
+
+func (s *Sessions) kickRevoked(since time.Time) time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"revokedAt": bson.M{"$gt": since}})
+	if err != nil {
+		log.Printf("Auth: polling revoked sessions: %s", err)
+		return since
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var session struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			RevokedAt time.Time          `bson:"revokedAt"`
+		}
+		if cursor.Decode(&session) != nil {
+			continue
+		}
+		if session.RevokedAt.After(since) {
+			since = session.RevokedAt
+		}
+
+		s.mu.Lock()
+		var kicked []*interfaces.Connection
+		for connection := range s.sockets[session.ID.Hex()] {
+			kicked = append(kicked, connection)
+		}
+		s.mu.Unlock()
+
+		for _, connection := range kicked {
+			connection.Disconnect(interfaces.CloseSessionRevoked, "session_revoked")
+		}
+	}
+	return since
+}
@@ -0,0 +1,90 @@
+package automation
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// AttendanceGrace is how late a student may join, or how early they may
+// leave, without being reported as late or as leaving early.
+var AttendanceGrace = 5 * time.Minute
+
+// AttendanceRecorded fires attendance.recorded once for every student of
+// the session's meeting that just ended, to its owner's hooks and its
+// org's. Hosts are the teachers, so they are left out.
+//
+// Each item carries an LTI Assignment and Grade Services score, the minutes
+// attended out of the meeting's, so a learning platform can pass it on to
+// its gradebook as is.
+func (h *Hooks) AttendanceRecorded(ctx context.Context, session interfaces.Session, sessionID, hashedURL string, meeting analytics.Meeting) {
+	if h == nil {
+		return
+	}
+	now := time.Now()
+
+	for _, attendee := range meeting.Attendees {
+		record := attendee.Record
+		if record.Role == interfaces.RoleHost {
+			continue
+		}
+		learner := record.Account
+		if learner == "" {
+			learner = record.UserID
+		}
+
+		item := Item{
+			"sessionID":     sessionID,
+			"url":           hashedURL,
+			"title":         session.Title,
+			"participantID": record.ParticipantID,
+			"userID":        record.UserID,
+			"name":          record.Name,
+			"joins":         record.Joins,
+			"joinedAt":      record.JoinedAt,
+			"meetingStart":  meeting.Start,
+			"meetingEnd":    meeting.End,
+			"minutes":       Minutes(attendee.Attended),
+			"late":          attendee.Late > AttendanceGrace,
+			"minutesLate":   Minutes(attendee.Late),
+			"leftEarly":     attendee.Early > AttendanceGrace,
+			"minutesEarly":  Minutes(attendee.Early),
+			"score":         Score(learner, attendee, meeting, now),
+		}
+		if record.Account != "" {
+			item["account"] = record.Account
+		}
+		if record.LeftAt != nil {
+			item["leftAt"] = *record.LeftAt
+		}
+		if len(record.Metadata) > 0 {
+			item["metadata"] = record.Metadata
+		}
+
+		h.Fire(ctx, session.OwnerID, EventAttendanceRecorded, item)
+		if session.OrgID != "" {
+			h.Fire(ctx, OrgOwner(session.OrgID), EventAttendanceRecorded, item)
+		}
+	}
+}
+
+// Score is an LTI Assignment and Grade Services score for the learner: the
+// minutes they attended out of the meeting's length.
+func Score(learner string, attendee analytics.AttendanceSummary, meeting analytics.Meeting, now time.Time) Item {
+	return Item{
+		"userId":           learner,
+		"scoreGiven":       Minutes(min(attendee.Attended, meeting.Length())),
+		"scoreMaximum":     Minutes(meeting.Length()),
+		"activityProgress": "Completed",
+		"gradingProgress":  "FullyGraded",
+		"timestamp":        now.UTC().Format(time.RFC3339),
+	}
+}
+
+// Minutes rounds d to a tenth of a minute.
+func Minutes(d time.Duration) float64 {
+	return math.Round(d.Minutes()*10) / 10
+}
@@ -0,0 +1,389 @@
+package automation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Events automations can subscribe to. EventAttendanceRecorded is fired
+// for each student of a meeting once it ends.
+const (
+	EventMeetingScheduled   = "meeting.scheduled"
+	EventRecordingReady     = "recording.ready"
+	EventAttendanceRecorded = "attendance.recorded"
+)
+
+// Events lists every event, for validating subscriptions.
+var Events = []string{EventMeetingScheduled, EventRecordingReady, EventAttendanceRecorded}
+
+// Events fired to an org's hooks. EventStorageWarning is fired when its
+// recordings grow past a share of its storage quota, EventKeywordAlert when
+// something said in one of its meetings matches a watchlist.
+const (
+	EventStorageWarning = "storage.warning"
+	EventKeywordAlert   = "keyword.alert"
+)
+
+// OrgEvents lists the events org admins can subscribe their org to. Their
+// orgs' meetings also fire EventAttendanceRecorded.
+var OrgEvents = []string{EventStorageWarning, EventKeywordAlert, EventAttendanceRecorded}
+
+// OrgOwner is the owner of an org's hooks, which admins manage rather than
+// a user.
+func OrgOwner(orgID string) string {
+	return "org:" + orgID
+}
+
+const (
+	maxAttempts = 5
+	// playbackTTL is how long recording links handed to automations stay
+	// valid.
+	playbackTTL = 7 * 24 * time.Hour
+)
+
+// Item is one trigger item: a meeting or a recording. Feeds and webhooks
+// carry the same items so a platform can switch between polling and hooks.
+type Item map[string]interface{}
+
+// Subscription is a REST hook: deliver every event of a kind for its owner
+// to TargetURL.
+type Subscription struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	OwnerID   string             `bson:"ownerID" json:"-"`
+	Event     string             `bson:"event" json:"event"`
+	TargetURL string             `bson:"targetUrl" json:"targetUrl"`
+	Secret    string             `bson:"secret" json:"secret,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// delivery is one queued webhook call. Deliveries are leased by whichever
+// node gets to them first, like transcoding jobs.
+type delivery struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	SubscriptionID primitive.ObjectID `bson:"subscriptionID"`
+	Event          string             `bson:"event"`
+	TargetURL      string             `bson:"targetUrl"`
+	Secret         string             `bson:"secret"`
+	Item           Item               `bson:"item"`
+	Status         string             `bson:"status"`
+	Attempts       int                `bson:"attempts"`
+	Error          string             `bson:"error,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt"`
+	NextAttemptAt  time.Time          `bson:"nextAttemptAt"`
+}
+
+// errGone marks a target that asked to be unsubscribed.
+var errGone = errors.New("target is gone")
+
+// Hooks manages REST hook subscriptions and delivers events to them. Calls
+// are signed like admission hooks: an HMAC-SHA256 of "<timestamp>.<body>"
+// under the subscription's secret, in X-Videoconf-Timestamp and
+// X-Videoconf-Signature. A target answering 410 Gone is unsubscribed. A nil
+// Hooks delivers nothing.
+type Hooks struct {
+	db     *mongo.Database
+	client *http.Client
+	signer *utils.URLSigner
+	brands *branding.Store
+}
+
+func NewHooks(db *mongo.Client, signer *utils.URLSigner, brands *branding.Store) *Hooks {
+	return &Hooks{
+		db:     db.Database("vidchat"),
+		client: &http.Client{Timeout: 10 * time.Second},
+		signer: signer,
+		brands: brands,
+	}
+}
+
+// ValidEvent reports whether event can be subscribed to.
+func ValidEvent(event string) bool {
+	return known(Events, event)
+}
+
+// ValidOrgEvent reports whether an org can be subscribed to event.
+func ValidOrgEvent(event string) bool {
+	return known(OrgEvents, event)
+}
+
+func known(events []string, event string) bool {
+	for _, known := range events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe registers a hook and returns it with the secret its calls are
+// signed with.
+func (h *Hooks) Subscribe(ctx context.Context, owner, event, targetURL string) (Subscription, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return Subscription{}, err
+	}
+	subscription := Subscription{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   owner,
+		Event:     event,
+		TargetURL: targetURL,
+		Secret:    hex.EncodeToString(random),
+		CreatedAt: time.Now(),
+	}
+	_, err := h.db.Collection("hooks").InsertOne(ctx, subscription)
+	return subscription, err
+}
+
+// Unsubscribe removes one of owner's hooks.
+func (h *Hooks) Unsubscribe(ctx context.Context, owner string, id primitive.ObjectID) error {
+	result, err := h.db.Collection("hooks").DeleteOne(ctx, bson.M{"_id": id, "ownerID": owner})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Subscriptions lists owner's hooks, without their secrets.
+func (h *Hooks) Subscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	cursor, err := h.db.Collection("hooks").Find(ctx, bson.M{"ownerID": owner}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := []Subscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// Fire queues item for every hook owner has on event.
+func (h *Hooks) Fire(ctx context.Context, owner, event string, item Item) {
+	if h == nil || owner == "" {
+		return
+	}
+	cursor, err := h.db.Collection("hooks").Find(ctx, bson.M{"ownerID": owner, "event": event})
+	if err != nil {
+		log.Printf("Automation: loading hooks for %s: %s", owner, err)
+		return
+	}
+	var subscriptions []Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		log.Printf("Automation: loading hooks for %s: %s", owner, err)
+		return
+	}
+
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		_, err := h.db.Collection("hook_deliveries").InsertOne(ctx, delivery{
+			ID:             primitive.NewObjectID(),
+			SubscriptionID: subscription.ID,
+			Event:          event,
+			TargetURL:      subscription.TargetURL,
+			Secret:         subscription.Secret,
+			Item:           item,
+			Status:         "pending",
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		})
+		if err != nil {
+			log.Printf("Automation: queueing %s for %s: %s", event, subscription.TargetURL, err)
+		}
+	}
+}
+
+// MeetingItem describes a session created at createdAt.
+func (h *Hooks) MeetingItem(ctx context.Context, id string, session interfaces.Session, hashedURL string, createdAt time.Time) Item {
+	item := Item{
+		"id":        id,
+		"title":     session.Title,
+		"url":       hashedURL,
+		"joinUrl":   h.brands.Links(ctx, session.OrgID).Join(hashedURL),
+		"access":    session.Access,
+		"createdAt": createdAt,
+	}
+	if session.StartsAt != nil {
+		item["startsAt"] = *session.StartsAt
+	}
+	return item
+}
+
+// RecordingItem describes a ready recording of the session at hashedURL,
+// with playback links valid for a week.
+func (h *Hooks) RecordingItem(recording interfaces.Recording, hashedURL string) Item {
+	item := Item{
+		"id":              recording.ID,
+		"sessionID":       recording.SessionID,
+		"url":             hashedURL,
+		"startedAt":       recording.StartedAt,
+		"stoppedAt":       recording.StoppedAt,
+		"durationSeconds": recording.DurationSeconds,
+		"size":            recording.Size,
+	}
+	if len(recording.Streams) > 0 {
+		item["streams"] = recording.Streams
+	}
+	if recording.Output != "" {
+		base := "/recordings/" + recording.ID
+		public := strings.TrimRight(h.brands.Default().PublicURL, "/")
+		item["playUrl"] = public + h.signer.Sign(base+"/play", "automation", playbackTTL)
+		item["thumbnailUrl"] = public + h.signer.Sign(base+"/thumbnail", "automation", playbackTTL)
+	}
+	return item
+}
+
+// RecordingReady fires recording.ready for the owner of the recording's
+// session. Sessions without an owner have nobody to notify.
+func (h *Hooks) RecordingReady(recording interfaces.Recording) {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(recording.SessionID)
+	if err != nil {
+		return
+	}
+	var session interfaces.Session
+	if err := h.db.Collection("sessions").FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil || session.OwnerID == "" {
+		return
+	}
+	var socket interfaces.Socket
+	h.db.Collection("sockets").FindOne(ctx, bson.M{"sessionID": recording.SessionID}).Decode(&socket)
+
+	h.Fire(ctx, session.OwnerID, EventRecordingReady, h.RecordingItem(recording, socket.HashedURL))
+}
+
+// Run delivers queued events until the process exits, polling every
+// interval when there is nothing to do.
+func (h *Hooks) Run(interval time.Duration) {
+	if h == nil {
+		return
+	}
+	for {
+		next, err := h.claim()
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Automation: claiming delivery: %s", err)
+		}
+		if next == nil {
+			time.Sleep(interval)
+			continue
+		}
+		h.deliver(next)
+	}
+}
+
+func (h *Hooks) claim() (*delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var next delivery
+	err := h.db.Collection("hook_deliveries").FindOneAndUpdate(ctx,
+		bson.M{"status": "pending", "nextAttemptAt": bson.M{"$lte": now}},
+		// Pushing the next attempt out leases the delivery; a node dying
+		// mid-call leaves it to be retried then.
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(time.Minute)}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextAttemptAt": 1}).SetReturnDocument(options.After),
+	).Decode(&next)
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+func (h *Hooks) deliver(next *delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	err := h.call(ctx, next)
+	update := bson.M{"status": "delivered"}
+	switch {
+	case err == errGone:
+		update = bson.M{"status": "unsubscribed"}
+		h.db.Collection("hooks").DeleteOne(ctx, bson.M{"_id": next.SubscriptionID})
+		log.Printf("Automation: %s is gone, unsubscribed", next.TargetURL)
+	case err != nil && next.Attempts >= maxAttempts:
+		update = bson.M{"status": "failed", "error": err.Error()}
+		log.Printf("Automation: delivering %s to %s failed after %d attempts: %s", next.Event, next.TargetURL, next.Attempts, err)
+	case err != nil:
+		backoff := time.Duration(1<<uint(next.Attempts)) * 30 * time.Second
+		update = bson.M{"status": "pending", "error": err.Error(), "nextAttemptAt": time.Now().Add(backoff)}
+	}
+
+	if _, err := h.db.Collection("hook_deliveries").UpdateOne(ctx, bson.M{"_id": next.ID}, bson.M{"$set": update}); err != nil {
+		log.Printf("Automation: updating delivery %s: %s", next.ID.Hex(), err)
+	}
+}
+
+func (h *Hooks) call(ctx context.Context, next *delivery) error {
+	body, err := json.Marshal(envelope(next))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, next.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Videoconf-Event", next.Event)
+	Sign(req, next.Secret, body)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return errGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("target answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign signs a call carrying body under secret, the way hook calls are
+// signed, so other integrations posting to their own endpoints can be
+// verified the same way.
+func Sign(req *http.Request, secret string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	req.Header.Set("X-Videoconf-Timestamp", timestamp)
+	req.Header.Set("X-Videoconf-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// envelope wraps the item the way REST hook consumers expect: one event per
+// call, named, with the item as the payload.
+func envelope(next *delivery) map[string]interface{} {
+	return map[string]interface{}{"id": next.ID.Hex(), "event": next.Event, "data": next.Item}
+}
@@ -0,0 +1,122 @@
+// Package automation is the surface no-code automation platforms integrate
+// with: API keys, polling-friendly trigger feeds and REST hook
+// subscriptions delivering the same items as webhooks.
+package automation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KeyHeader carries the API key on automation requests.
+const KeyHeader = "X-API-Key"
+
+const keyPrefix = "vck_"
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// APIKey lets an automation act as the user who created it. Only a hash of
+// the key is stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	OwnerID    string             `bson:"ownerID" json:"-"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	Hash       string             `bson:"hash" json:"-"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// Keys issues and checks API keys.
+type Keys struct {
+	collection *mongo.Collection
+}
+
+func NewKeys(db *mongo.Client) *Keys {
+	return &Keys{collection: db.Database("vidchat").Collection("api_keys")}
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a key for owner. The key itself is only returned here.
+func (k *Keys) Create(ctx context.Context, owner, name string) (string, APIKey, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", APIKey{}, err
+	}
+	key := keyPrefix + hex.EncodeToString(random)
+
+	record := APIKey{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   owner,
+		Name:      name,
+		Prefix:    key[:len(keyPrefix)+6],
+		Hash:      hashKey(key),
+		CreatedAt: time.Now(),
+	}
+	if _, err := k.collection.InsertOne(ctx, record); err != nil {
+		return "", APIKey{}, err
+	}
+	return key, record, nil
+}
+
+// List returns owner's keys, newest first.
+func (k *Keys) List(ctx context.Context, owner string) ([]APIKey, error) {
+	cursor, err := k.collection.Find(ctx, bson.M{"ownerID": owner}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	keys := []APIKey{}
+	err = cursor.All(ctx, &keys)
+	return keys, err
+}
+
+// Revoke deletes one of owner's keys.
+func (k *Keys) Revoke(ctx context.Context, owner string, id primitive.ObjectID) error {
+	result, err := k.collection.DeleteOne(ctx, bson.M{"_id": id, "ownerID": owner})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Authenticate returns the key presented in the X-API-Key header, or nil
+// when there is none.
+func (k *Keys) Authenticate(r *http.Request) (*APIKey, error) {
+	key := strings.TrimSpace(r.Header.Get(KeyHeader))
+	if key == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	var record APIKey
+	err := k.collection.FindOneAndUpdate(ctx,
+		bson.M{"hash": hashKey(key)},
+		bson.M{"$set": bson.M{"lastUsedAt": time.Now()}},
+	).Decode(&record)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &record, nil
+}
@@ -0,0 +1,109 @@
+// Package branding serves organizations' white-labeling settings to the
+// rest of the server, chiefly the links handed out for their meetings.
+package branding
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/domains"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type cachedBranding struct {
+	branding interfaces.Branding
+	domain   string
+	fetched  time.Time
+}
+
+// Store reads orgs' branding from the branding collection, and their
+// verified domains from the registry, caching each org's for a short while.
+type Store struct {
+	collection *mongo.Collection
+	links      utils.Links
+	domains    *domains.Registry
+
+	mu   sync.Mutex
+	orgs map[string]cachedBranding
+}
+
+// NewStore returns a store whose orgs without branding use links.
+func NewStore(db *mongo.Client, links utils.Links, registry *domains.Registry) *Store {
+	return &Store{
+		collection: db.Database("vidchat").Collection("branding"),
+		links:      links,
+		domains:    registry,
+		orgs:       make(map[string]cachedBranding),
+	}
+}
+
+// Get returns the org's branding, which is empty apart from OrgID when it
+// has none or it could not be loaded.
+func (s *Store) Get(ctx context.Context, org string) interfaces.Branding {
+	return s.get(ctx, org).branding
+}
+
+func (s *Store) get(ctx context.Context, org string) cachedBranding {
+	if org == "" {
+		return cachedBranding{}
+	}
+
+	s.mu.Lock()
+	cached, ok := s.orgs[org]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetched) < 30*time.Second {
+		return cached
+	}
+
+	cached = cachedBranding{fetched: time.Now()}
+	err := s.collection.FindOne(ctx, bson.M{"_id": org}).Decode(&cached.branding)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Error loading branding of %s: %s", org, err)
+		return cachedBranding{branding: interfaces.Branding{OrgID: org}}
+	}
+	cached.branding.OrgID = org
+	cached.domain = s.domains.Primary(ctx, org)
+
+	s.mu.Lock()
+	s.orgs[org] = cached
+	s.mu.Unlock()
+	return cached
+}
+
+// Default returns the deployment's own links.
+func (s *Store) Default() utils.Links {
+	return s.links
+}
+
+// Links returns the links for the org's sessions: join links start with
+// its meeting URL prefix and short links are on its domain, when it has
+// them.
+func (s *Store) Links(ctx context.Context, org string) utils.Links {
+	links := s.links
+	cached := s.get(ctx, org)
+	if prefix := cached.branding.MeetingURLPrefix; prefix != "" {
+		links.JoinURL = prefix + "{url}"
+	}
+	// The domain is routed to the deployment like its own host, so only
+	// the host changes.
+	if public, err := url.Parse(links.PublicURL); err == nil && cached.domain != "" {
+		public.Scheme, public.Host = "https", cached.domain
+		links.PublicURL = public.String()
+	}
+	return links
+}
+
+// Forget drops the org's cached branding so an admin change applies
+// immediately on this node.
+func (s *Store) Forget(org string) {
+	s.mu.Lock()
+	delete(s.orgs, org)
+	s.mu.Unlock()
+}
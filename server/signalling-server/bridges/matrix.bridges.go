@@ -0,0 +1,263 @@
+package bridges
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MatrixConfig holds the application service registration used to talk to
+// the homeserver. Puppets are created as @<PuppetPrefix><userID>:<ServerName>.
+type MatrixConfig struct {
+	HomeserverURL string
+	ServerName    string
+	ASToken       string
+	HSToken       string
+	PuppetPrefix  string
+}
+
+// MatrixBridge mirrors in-meeting chat to the Matrix room linked to a session
+// and relays messages posted in that room back to the meeting.
+type MatrixBridge struct {
+	config  MatrixConfig
+	db      *mongo.Client
+	client  *http.Client
+	deliver func(socket string, message interfaces.Message)
+
+	mu      sync.RWMutex
+	rooms   map[string]string // socket url -> matrix room id
+	sockets map[string]string // matrix room id -> socket url
+	puppets map[string]bool   // puppet user ids known to be registered and joined, keyed by room
+
+	txn uint64
+}
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	RoomID  string `json:"room_id"`
+	Sender  string `json:"sender"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		Body    string `json:"body"`
+	} `json:"content"`
+}
+
+// NewMatrixBridge returns a bridge delivering inbound Matrix messages through
+// deliver. It returns nil when no homeserver is configured. Both tokens are
+// required: without HSToken anyone could push events into meeting chat.
+func NewMatrixBridge(config MatrixConfig, db *mongo.Client, deliver func(string, interfaces.Message)) (*MatrixBridge, error) {
+	if config.HomeserverURL == "" {
+		return nil, nil
+	}
+	if config.ASToken == "" || config.HSToken == "" {
+		return nil, errors.New("the AS and HS tokens of the registration are required")
+	}
+	if config.PuppetPrefix == "" {
+		config.PuppetPrefix = "videoconf_"
+	}
+
+	return &MatrixBridge{
+		config:  config,
+		db:      db,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		deliver: deliver,
+		rooms:   make(map[string]string),
+		sockets: make(map[string]string),
+		puppets: make(map[string]bool),
+	}, nil
+}
+
+// Forward posts a meeting chat message to the linked Matrix room as the
+// puppet of the sending participant.
+func (b *MatrixBridge) Forward(socket string, message interfaces.Message) {
+	roomID, err := b.roomFor(socket)
+	if err != nil || roomID == "" {
+		return
+	}
+
+	puppet := b.puppetID(message.UserID)
+	if err := b.ensurePuppet(puppet, roomID); err != nil {
+		log.Printf("Matrix bridge: puppet %s: %s", puppet, err)
+		return
+	}
+
+	txnID := fmt.Sprintf("vc%d.%d", time.Now().UnixNano(), atomic.AddUint64(&b.txn, 1))
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + txnID
+	body := map[string]string{"msgtype": "m.text", "body": message.Text}
+	if err := b.request(http.MethodPut, path, puppet, body); err != nil {
+		log.Printf("Matrix bridge: sending to %s: %s", roomID, err)
+	}
+}
+
+// Transactions handles the application service push endpoint
+// (PUT /_matrix/app/v1/transactions/:txnId).
+func (b *MatrixBridge) Transactions(ctx *gin.Context) {
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = ctx.Query("access_token")
+	}
+	if b.config.HSToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(b.config.HSToken)) != 1 {
+		ctx.JSON(http.StatusForbidden, gin.H{"errcode": "M_FORBIDDEN"})
+		return
+	}
+
+	var txn struct {
+		Events []matrixEvent `json:"events"`
+	}
+	if err := ctx.ShouldBindJSON(&txn); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errcode": "M_NOT_JSON"})
+		return
+	}
+
+	for _, event := range txn.Events {
+		if event.Type != "m.room.message" || event.Content.Body == "" || b.isPuppet(event.Sender) {
+			continue
+		}
+
+		socket, err := b.socketFor(event.RoomID)
+		if err != nil || socket == "" {
+			continue
+		}
+
+		b.deliver(socket, interfaces.Message{
+			Type:   "chat",
+			UserID: event.Sender,
+			Text:   event.Content.Body,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{})
+}
+
+func (b *MatrixBridge) puppetID(userID string) string {
+	return "@" + b.config.PuppetPrefix + strings.ToLower(userID) + ":" + b.config.ServerName
+}
+
+func (b *MatrixBridge) isPuppet(sender string) bool {
+	return strings.HasPrefix(sender, "@"+b.config.PuppetPrefix)
+}
+
+func (b *MatrixBridge) ensurePuppet(puppet, roomID string) error {
+	key := puppet + "|" + roomID
+	b.mu.RLock()
+	ok := b.puppets[key]
+	b.mu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	localpart := strings.TrimPrefix(strings.SplitN(puppet, ":", 2)[0], "@")
+	err := b.request(http.MethodPost, "/_matrix/client/v3/register", "", map[string]string{
+		"type":     "m.login.application_service",
+		"username": localpart,
+	})
+	if err != nil && !strings.Contains(err.Error(), "M_USER_IN_USE") {
+		return err
+	}
+
+	if err := b.request(http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/join", puppet, struct{}{}); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.puppets[key] = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MatrixBridge) request(method, path, asUser string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(b.config.HomeserverURL, "/") + path
+	if asUser != "" {
+		endpoint += "?user_id=" + url.QueryEscape(asUser)
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.config.ASToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var matrixErr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&matrixErr)
+		return fmt.Errorf("%s %s: %d %s %s", method, path, resp.StatusCode, matrixErr.ErrCode, matrixErr.Error)
+	}
+
+	return nil
+}
+
+func (b *MatrixBridge) roomFor(socket string) (string, error) {
+	b.mu.RLock()
+	roomID, ok := b.rooms[socket]
+	b.mu.RUnlock()
+	if ok {
+		return roomID, nil
+	}
+
+	var record interfaces.Socket
+	err := b.db.Database("vidchat").Collection("sockets").FindOne(context.TODO(), bson.M{"socketUrl": socket}).Decode(&record)
+	if err != nil {
+		return "", err
+	}
+
+	b.link(socket, record.MatrixRoom)
+	return record.MatrixRoom, nil
+}
+
+func (b *MatrixBridge) socketFor(roomID string) (string, error) {
+	b.mu.RLock()
+	socket, ok := b.sockets[roomID]
+	b.mu.RUnlock()
+	if ok {
+		return socket, nil
+	}
+
+	var record interfaces.Socket
+	err := b.db.Database("vidchat").Collection("sockets").FindOne(context.TODO(), bson.M{"matrixRoom": roomID}).Decode(&record)
+	if err != nil {
+		return "", err
+	}
+
+	b.link(record.SocketURL, roomID)
+	return record.SocketURL, nil
+}
+
+func (b *MatrixBridge) link(socket, roomID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rooms[socket] = roomID
+	if roomID != "" {
+		b.sockets[roomID] = socket
+	}
+}
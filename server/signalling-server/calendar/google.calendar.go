@@ -0,0 +1,110 @@
+package calendar
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const googleEvents = "https://www.googleapis.com/calendar/v3/calendars/primary/events"
+
+// NewGoogle returns the Google Calendar provider.
+func NewGoogle(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name: "google",
+		OAuth: &OAuth{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:     "https://oauth2.googleapis.com/token",
+			Scopes:       []string{"https://www.googleapis.com/auth/calendar.events"},
+			RedirectURL:  redirectURL,
+			// Google only hands out a refresh token for offline access, and
+			// only on consent.
+			AuthParams: url.Values{"access_type": {"offline"}, "prompt": {"consent"}},
+		},
+		API: &google{client: &http.Client{Timeout: 15 * time.Second}},
+	}
+}
+
+type google struct {
+	client *http.Client
+}
+
+type googleTime struct {
+	DateTime time.Time `json:"dateTime"`
+}
+
+type googleEvent struct {
+	ID          string     `json:"id,omitempty"`
+	Summary     string     `json:"summary"`
+	Description string     `json:"description,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Start       googleTime `json:"start"`
+	End         googleTime `json:"end"`
+	Status      string     `json:"status,omitempty"`
+}
+
+func toGoogle(event Event) googleEvent {
+	return googleEvent{
+		Summary:     event.Title,
+		Description: event.Description,
+		Location:    event.Location,
+		Start:       googleTime{DateTime: event.Start.UTC()},
+		End:         googleTime{DateTime: event.End.UTC()},
+	}
+}
+
+func (g *google) Create(ctx context.Context, token string, event Event) (string, error) {
+	var created googleEvent
+	err := call(ctx, g.client, http.MethodPost, googleEvents, token, toGoogle(event), &created)
+	return created.ID, err
+}
+
+func (g *google) Update(ctx context.Context, token string, id string, event Event) error {
+	return call(ctx, g.client, http.MethodPatch, googleEvents+"/"+url.PathEscape(id), token, toGoogle(event), nil)
+}
+
+func (g *google) Delete(ctx context.Context, token string, id string) error {
+	return call(ctx, g.client, http.MethodDelete, googleEvents+"/"+url.PathEscape(id), token, nil, nil)
+}
+
+func (g *google) List(ctx context.Context, token string, from, to time.Time) ([]Event, error) {
+	query := url.Values{
+		"timeMin":      {from.UTC().Format(time.RFC3339)},
+		"timeMax":      {to.UTC().Format(time.RFC3339)},
+		"singleEvents": {"true"},
+		"maxResults":   {"250"},
+	}
+
+	var events []Event
+	for {
+		var page struct {
+			Items         []googleEvent `json:"items"`
+			NextPageToken string        `json:"nextPageToken"`
+		}
+		if err := call(ctx, g.client, http.MethodGet, googleEvents+"?"+query.Encode(), token, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			// All-day events have no dateTime and cannot be meetings.
+			if item.Start.DateTime.IsZero() {
+				continue
+			}
+			events = append(events, Event{
+				ID:          item.ID,
+				Title:       item.Summary,
+				Description: item.Description,
+				Location:    item.Location,
+				Start:       item.Start.DateTime,
+				End:         item.End.DateTime,
+				Cancelled:   item.Status == "cancelled",
+			})
+		}
+		if page.NextPageToken == "" {
+			return events, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
@@ -0,0 +1,127 @@
+package calendar
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	graphEvents = "https://graph.microsoft.com/v1.0/me/events"
+	graphView   = "https://graph.microsoft.com/v1.0/me/calendarView"
+	// graphTime is how Graph writes times: no offset, in the event's
+	// timeZone, which is UTC unless the request asked otherwise.
+	graphTime = "2006-01-02T15:04:05.9999999"
+)
+
+// NewMicrosoft returns the Outlook calendar provider, via Microsoft Graph.
+// Tenant is "common" for any work, school or personal account.
+func NewMicrosoft(clientID, clientSecret, tenant, redirectURL string) *Provider {
+	base := "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0"
+	return &Provider{
+		Name: "microsoft",
+		OAuth: &OAuth{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			AuthURL:      base + "/authorize",
+			TokenURL:     base + "/token",
+			Scopes:       []string{"offline_access", "Calendars.ReadWrite"},
+			RedirectURL:  redirectURL,
+		},
+		API: &microsoft{client: &http.Client{Timeout: 15 * time.Second}},
+	}
+}
+
+type microsoft struct {
+	client *http.Client
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphEvent struct {
+	ID      string `json:"id,omitempty"`
+	Subject string `json:"subject"`
+	Body    struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	} `json:"body"`
+	Location struct {
+		DisplayName string `json:"displayName"`
+	} `json:"location"`
+	Start       graphDateTime `json:"start"`
+	End         graphDateTime `json:"end"`
+	IsCancelled bool          `json:"isCancelled,omitempty"`
+}
+
+func toGraph(event Event) graphEvent {
+	var converted graphEvent
+	converted.Subject = event.Title
+	converted.Body.ContentType = "text"
+	converted.Body.Content = event.Description
+	converted.Location.DisplayName = event.Location
+	converted.Start = graphDateTime{DateTime: event.Start.UTC().Format(graphTime), TimeZone: "UTC"}
+	converted.End = graphDateTime{DateTime: event.End.UTC().Format(graphTime), TimeZone: "UTC"}
+	return converted
+}
+
+func fromGraph(value graphDateTime) time.Time {
+	location := time.UTC
+	if value.TimeZone != "" && value.TimeZone != "UTC" {
+		if loaded, err := time.LoadLocation(value.TimeZone); err == nil {
+			location = loaded
+		}
+	}
+	parsed, _ := time.ParseInLocation(graphTime, value.DateTime, location)
+	return parsed
+}
+
+func (m *microsoft) Create(ctx context.Context, token string, event Event) (string, error) {
+	var created graphEvent
+	err := call(ctx, m.client, http.MethodPost, graphEvents, token, toGraph(event), &created)
+	return created.ID, err
+}
+
+func (m *microsoft) Update(ctx context.Context, token string, id string, event Event) error {
+	return call(ctx, m.client, http.MethodPatch, graphEvents+"/"+url.PathEscape(id), token, toGraph(event), nil)
+}
+
+func (m *microsoft) Delete(ctx context.Context, token string, id string) error {
+	return call(ctx, m.client, http.MethodDelete, graphEvents+"/"+url.PathEscape(id), token, nil, nil)
+}
+
+func (m *microsoft) List(ctx context.Context, token string, from, to time.Time) ([]Event, error) {
+	query := url.Values{
+		"startDateTime": {from.UTC().Format(time.RFC3339)},
+		"endDateTime":   {to.UTC().Format(time.RFC3339)},
+		"$top":          {"250"},
+	}
+	next := graphView + "?" + query.Encode()
+
+	var events []Event
+	for next != "" {
+		var page struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if err := call(ctx, m.client, http.MethodGet, next, token, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Value {
+			events = append(events, Event{
+				ID:          item.ID,
+				Title:       item.Subject,
+				Description: item.Body.Content,
+				Location:    item.Location.DisplayName,
+				Start:       fromGraph(item.Start),
+				End:         fromGraph(item.End),
+				Cancelled:   item.IsCancelled,
+			})
+		}
+		next = page.NextLink
+	}
+	return events, nil
+}
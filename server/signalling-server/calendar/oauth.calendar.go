@@ -0,0 +1,116 @@
+// Package calendar syncs scheduled sessions with users' Google and Outlook
+// calendars: sessions they schedule become events, rescheduling or
+// cancelling updates them, and external events carrying a join link show up
+// in their upcoming meetings.
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrRevoked is returned when the user withdrew the grant; only connecting
+// the calendar again helps.
+var ErrRevoked = errors.New("calendar grant revoked")
+
+// Token is an OAuth token pair.
+type Token struct {
+	AccessToken  string    `bson:"accessToken"`
+	RefreshToken string    `bson:"refreshToken"`
+	Expiry       time.Time `bson:"expiry"`
+}
+
+// OAuth is a provider's authorization-code flow.
+type OAuth struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+	// RedirectURL is the callback the provider sends users back to.
+	RedirectURL string
+	// AuthParams are extra parameters the provider needs to hand out a
+	// refresh token.
+	AuthParams url.Values
+}
+
+// AuthCodeURL is where to send the user to grant access.
+func (o *OAuth) AuthCodeURL(state string) string {
+	query := url.Values{}
+	for key, values := range o.AuthParams {
+		query[key] = values
+	}
+	query.Set("response_type", "code")
+	query.Set("client_id", o.ClientID)
+	query.Set("redirect_uri", o.RedirectURL)
+	query.Set("scope", strings.Join(o.Scopes, " "))
+	query.Set("state", state)
+	return o.AuthURL + "?" + query.Encode()
+}
+
+// Exchange trades an authorization code for a token.
+func (o *OAuth) Exchange(ctx context.Context, client *http.Client, code string) (Token, error) {
+	return o.token(ctx, client, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.RedirectURL},
+	})
+}
+
+// Refresh renews an expired access token. Providers that do not rotate
+// refresh tokens omit one, so the old one is kept.
+func (o *OAuth) Refresh(ctx context.Context, client *http.Client, refreshToken string) (Token, error) {
+	token, err := o.token(ctx, client, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err == nil && token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, err
+}
+
+func (o *OAuth) token(ctx context.Context, client *http.Client, form url.Values) (Token, error) {
+	form.Set("client_id", o.ClientID)
+	form.Set("client_secret", o.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Error        string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Token{}, fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+	if body.Error == "invalid_grant" {
+		return Token{}, ErrRevoked
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return Token{}, fmt.Errorf("token endpoint answered %s: %s", resp.Status, body.Error)
+	}
+	return Token{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	// errNotFound is returned for events deleted on the provider's side.
+	errNotFound = errors.New("event not found")
+	// errUnauthorized is returned when the access token was refused before
+	// it expired; the next sync refreshes it.
+	errUnauthorized = errors.New("access token refused")
+)
+
+// Event is a calendar event as far as syncing cares.
+type Event struct {
+	ID          string
+	Title       string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Cancelled   bool
+}
+
+// API is a provider's calendar API, acting on the user's primary calendar
+// with an access token.
+type API interface {
+	Create(ctx context.Context, token string, event Event) (string, error)
+	Update(ctx context.Context, token string, id string, event Event) error
+	Delete(ctx context.Context, token string, id string) error
+	List(ctx context.Context, token string, from, to time.Time) ([]Event, error)
+}
+
+// Provider is a calendar users can connect.
+type Provider struct {
+	Name  string
+	OAuth *OAuth
+	API   API
+}
+
+// call sends a JSON request to a calendar API and decodes the answer into
+// out, when given.
+func call(ctx context.Context, client *http.Client, method, url, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errNotFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errUnauthorized
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("%s %s answered %s", method, url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,423 @@
+package calendar
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Grant states. A revoked grant is not synced until the user connects the
+// calendar again.
+const (
+	GrantActive  = "active"
+	GrantRevoked = "revoked"
+)
+
+const (
+	// defaultLength is how long the event of a session without an end is.
+	defaultLength = time.Hour
+	// importWindow is how far ahead external events are imported.
+	importWindow = 30 * 24 * time.Hour
+	// lease is how long a node has to sync a grant before another may.
+	lease = 5 * time.Minute
+)
+
+// Grant is a user's permission to use one of their calendars.
+type Grant struct {
+	ID          string     `bson:"_id" json:"-"`
+	UserID      string     `bson:"userID" json:"-"`
+	Provider    string     `bson:"provider" json:"provider"`
+	Token       Token      `bson:"token" json:"-"`
+	Status      string     `bson:"status" json:"status"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	ConnectedAt time.Time  `bson:"connectedAt" json:"connectedAt"`
+	LastSyncAt  *time.Time `bson:"lastSyncAt,omitempty" json:"lastSyncAt,omitempty"`
+	NextSyncAt  time.Time  `bson:"nextSyncAt" json:"-"`
+}
+
+// Imported is an external event carrying a join link, listed among the
+// user's upcoming meetings.
+type Imported struct {
+	ID       string    `bson:"_id" json:"-"`
+	UserID   string    `bson:"userID" json:"-"`
+	Grant    string    `bson:"grant" json:"-"`
+	Provider string    `bson:"provider" json:"provider"`
+	EventID  string    `bson:"eventID" json:"eventID"`
+	Title    string    `bson:"title" json:"title"`
+	StartsAt time.Time `bson:"startsAt" json:"startsAt"`
+	EndsAt   time.Time `bson:"endsAt" json:"endsAt"`
+	URL      string    `bson:"url" json:"url"`
+	JoinURL  string    `bson:"joinUrl" json:"joinUrl"`
+	SyncedAt time.Time `bson:"syncedAt" json:"-"`
+}
+
+// synced records the event a session was written to in one grant's
+// calendar, and what it last said.
+type synced struct {
+	ID        string    `bson:"_id"`
+	Grant     string    `bson:"grant"`
+	SessionID string    `bson:"sessionID"`
+	EventID   string    `bson:"eventID"`
+	Title     string    `bson:"title"`
+	StartsAt  time.Time `bson:"startsAt"`
+	EndsAt    time.Time `bson:"endsAt"`
+}
+
+// Syncer keeps connected calendars in step with scheduled sessions. Grants
+// are leased like transcoding jobs, so every node can run a Syncer. A nil
+// Syncer has no providers.
+type Syncer struct {
+	db        *mongo.Database
+	client    *http.Client
+	brands    *branding.Store
+	interval  time.Duration
+	providers map[string]*Provider
+	joinLink  *regexp.Regexp
+}
+
+// NewSyncer syncs each grant every interval, and sooner when nudged.
+func NewSyncer(db *mongo.Client, brands *branding.Store, interval time.Duration, providers ...*Provider) *Syncer {
+	s := &Syncer{
+		db:        db.Database("vidchat"),
+		client:    &http.Client{Timeout: 15 * time.Second},
+		brands:    brands,
+		interval:  interval,
+		providers: make(map[string]*Provider),
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name] = provider
+	}
+	// Hashed session URLs are hex SHA-1s.
+	prefix, _, _ := strings.Cut(brands.Default().JoinURL, "{url}")
+	s.joinLink = regexp.MustCompile(regexp.QuoteMeta(prefix) + "([0-9a-f]{40})")
+	return s
+}
+
+// Provider returns the named provider, or nil if it is not configured.
+func (s *Syncer) Provider(name string) *Provider {
+	if s == nil {
+		return nil
+	}
+	return s.providers[name]
+}
+
+func grantID(userID, provider string) string {
+	return userID + "|" + provider
+}
+
+// Connect finishes the OAuth flow, storing the user's grant and syncing it
+// straight away.
+func (s *Syncer) Connect(ctx context.Context, userID string, provider *Provider, code string) error {
+	token, err := provider.OAuth.Exchange(ctx, s.client, code)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = s.db.Collection("calendar_grants").UpdateOne(ctx,
+		bson.M{"_id": grantID(userID, provider.Name)},
+		bson.M{
+			"$set":         bson.M{"userID": userID, "provider": provider.Name, "token": token, "status": GrantActive, "nextSyncAt": now},
+			"$unset":       bson.M{"error": ""},
+			"$setOnInsert": bson.M{"connectedAt": now},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// Disconnect forgets the grant and what was synced with it. Events already
+// written to the calendar are left there.
+func (s *Syncer) Disconnect(ctx context.Context, userID, provider string) error {
+	id := grantID(userID, provider)
+	result, err := s.db.Collection("calendar_grants").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	s.db.Collection("calendar_events").DeleteMany(ctx, bson.M{"grant": id})
+	s.db.Collection("upcoming_meetings").DeleteMany(ctx, bson.M{"grant": id})
+	return nil
+}
+
+// Grants lists the calendars the user connected.
+func (s *Syncer) Grants(ctx context.Context, userID string) ([]Grant, error) {
+	cursor, err := s.db.Collection("calendar_grants").Find(ctx, bson.M{"userID": userID})
+	if err != nil {
+		return nil, err
+	}
+	grants := []Grant{}
+	err = cursor.All(ctx, &grants)
+	return grants, err
+}
+
+// Nudge syncs the user's calendars soon, after a session of theirs was
+// scheduled, moved or cancelled.
+func (s *Syncer) Nudge(ctx context.Context, userID string) {
+	if s == nil || userID == "" {
+		return
+	}
+	_, err := s.db.Collection("calendar_grants").UpdateMany(ctx,
+		bson.M{"userID": userID, "status": GrantActive},
+		bson.M{"$set": bson.M{"nextSyncAt": time.Now()}})
+	if err != nil {
+		log.Printf("Calendar: nudging %s: %s", userID, err)
+	}
+}
+
+// Upcoming lists the external meetings imported for the user between from
+// and to.
+func (s *Syncer) Upcoming(ctx context.Context, userID string, from, to time.Time) ([]Imported, error) {
+	cursor, err := s.db.Collection("upcoming_meetings").Find(ctx,
+		bson.M{"userID": userID, "startsAt": bson.M{"$gte": from, "$lte": to}},
+		options.Find().SetSort(bson.D{{Key: "startsAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	imported := []Imported{}
+	err = cursor.All(ctx, &imported)
+	return imported, err
+}
+
+// Run syncs due grants until the process exits, polling every poll when
+// none are due.
+func (s *Syncer) Run(poll time.Duration) {
+	if s == nil || len(s.providers) == 0 {
+		return
+	}
+	for {
+		grant, err := s.claim()
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Calendar: claiming grant: %s", err)
+		}
+		if grant == nil {
+			time.Sleep(poll)
+			continue
+		}
+		s.sync(grant)
+	}
+}
+
+func (s *Syncer) claim() (*Grant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var grant Grant
+	err := s.db.Collection("calendar_grants").FindOneAndUpdate(ctx,
+		bson.M{"status": GrantActive, "nextSyncAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextSyncAt": now.Add(lease)}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextSyncAt": 1}).SetReturnDocument(options.After),
+	).Decode(&grant)
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (s *Syncer) sync(grant *Grant) {
+	ctx, cancel := context.WithTimeout(context.Background(), lease)
+	defer cancel()
+
+	provider := s.providers[grant.Provider]
+	if provider == nil {
+		return
+	}
+
+	now := time.Now()
+	update := bson.M{"lastSyncAt": now, "nextSyncAt": now.Add(s.interval), "error": ""}
+	err := s.fresh(ctx, provider, grant)
+	if err == nil {
+		err = s.push(ctx, provider, grant)
+	}
+	if err == nil {
+		err = s.pull(ctx, provider, grant, now)
+	}
+
+	switch {
+	case err == ErrRevoked:
+		update = bson.M{"status": GrantRevoked, "error": "Calendar access was revoked, connect it again."}
+	case err == errUnauthorized:
+		// Refresh the token and try again shortly.
+		update = bson.M{"token.expiry": time.Time{}, "nextSyncAt": now.Add(time.Minute), "error": err.Error()}
+	case err != nil:
+		update["error"] = err.Error()
+		log.Printf("Calendar: syncing %s: %s", grant.ID, err)
+	}
+
+	done, cancelDone := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelDone()
+	if _, err := s.db.Collection("calendar_grants").UpdateOne(done, bson.M{"_id": grant.ID}, bson.M{"$set": update}); err != nil {
+		log.Printf("Calendar: updating %s: %s", grant.ID, err)
+	}
+}
+
+// fresh refreshes the grant's access token when it is about to expire.
+func (s *Syncer) fresh(ctx context.Context, provider *Provider, grant *Grant) error {
+	if time.Until(grant.Token.Expiry) > time.Minute {
+		return nil
+	}
+	token, err := provider.OAuth.Refresh(ctx, s.client, grant.Token.RefreshToken)
+	if err != nil {
+		return err
+	}
+	grant.Token = token
+	_, err = s.db.Collection("calendar_grants").UpdateOne(ctx, bson.M{"_id": grant.ID}, bson.M{"$set": bson.M{"token": token}})
+	return err
+}
+
+// push writes the user's scheduled sessions to the calendar: new ones are
+// created, moved or renamed ones updated and cancelled ones deleted.
+// Sessions that started more than a day ago are left alone.
+func (s *Syncer) push(ctx context.Context, provider *Provider, grant *Grant) error {
+	cursor, err := s.db.Collection("sessions").Find(ctx, bson.M{
+		"ownerID":  grant.UserID,
+		"startsAt": bson.M{"$gte": time.Now().Add(-24 * time.Hour)},
+	})
+	if err != nil {
+		return err
+	}
+	var sessions []struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		interfaces.Session `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return err
+	}
+
+	events := s.db.Collection("calendar_events")
+	for _, session := range sessions {
+		sessionID := session.ID.Hex()
+		var current synced
+		err := events.FindOne(ctx, bson.M{"_id": grant.ID + "|" + sessionID}).Decode(&current)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		exists := err == nil
+
+		if session.CancelledAt != nil {
+			if exists {
+				if err := provider.API.Delete(ctx, grant.Token.AccessToken, current.EventID); err != nil && err != errNotFound {
+					return err
+				}
+				events.DeleteOne(ctx, bson.M{"_id": current.ID})
+			}
+			continue
+		}
+
+		event := s.event(ctx, sessionID, session.Session)
+		if exists && current.Title == event.Title && current.StartsAt.Equal(event.Start) && current.EndsAt.Equal(event.End) {
+			continue
+		}
+
+		if exists {
+			// An event the user deleted from their calendar stays deleted.
+			err = provider.API.Update(ctx, grant.Token.AccessToken, current.EventID, event)
+			if err != nil && err != errNotFound {
+				return err
+			}
+		} else {
+			if event.Start.Before(time.Now()) {
+				continue
+			}
+			current = synced{ID: grant.ID + "|" + sessionID, Grant: grant.ID, SessionID: sessionID}
+			current.EventID, err = provider.API.Create(ctx, grant.Token.AccessToken, event)
+			if err != nil {
+				return err
+			}
+		}
+
+		current.Title, current.StartsAt, current.EndsAt = event.Title, event.Start, event.End
+		if _, err := events.ReplaceOne(ctx, bson.M{"_id": current.ID}, current, options.Replace().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// event describes a scheduled session as a calendar event.
+func (s *Syncer) event(ctx context.Context, sessionID string, session interfaces.Session) Event {
+	var socket interfaces.Socket
+	s.db.Collection("sockets").FindOne(ctx, bson.M{"sessionID": sessionID}).Decode(&socket)
+	join := s.brands.Links(ctx, socket.OrgID).Join(socket.HashedURL)
+
+	title := session.Title
+	if title == "" {
+		title = "Video meeting"
+	}
+	end := session.StartsAt.Add(defaultLength)
+	if session.EndsAt != nil {
+		end = *session.EndsAt
+	}
+	return Event{
+		Title:       title,
+		Description: "Join the meeting: " + join,
+		Location:    join,
+		Start:       session.StartsAt.UTC().Truncate(time.Second),
+		End:         end.UTC().Truncate(time.Second),
+	}
+}
+
+// pull imports the calendar's upcoming events that carry a join link, and
+// drops imported events that have since gone. Events this syncer wrote are
+// skipped: the sessions behind them are listed already.
+func (s *Syncer) pull(ctx context.Context, provider *Provider, grant *Grant, now time.Time) error {
+	events, err := provider.API.List(ctx, grant.Token.AccessToken, now.Add(-time.Hour), now.Add(importWindow))
+	if err != nil {
+		return err
+	}
+
+	ours := make(map[string]bool)
+	cursor, err := s.db.Collection("calendar_events").Find(ctx, bson.M{"grant": grant.ID})
+	if err != nil {
+		return err
+	}
+	var written []synced
+	if err := cursor.All(ctx, &written); err != nil {
+		return err
+	}
+	for _, event := range written {
+		ours[event.EventID] = true
+	}
+
+	upcoming := s.db.Collection("upcoming_meetings")
+	for _, event := range events {
+		if event.Cancelled || ours[event.ID] {
+			continue
+		}
+		match := s.joinLink.FindStringSubmatch(event.Location + "\n" + event.Description)
+		if match == nil {
+			continue
+		}
+		imported := Imported{
+			ID:       grant.ID + "|" + event.ID,
+			UserID:   grant.UserID,
+			Grant:    grant.ID,
+			Provider: provider.Name,
+			EventID:  event.ID,
+			Title:    event.Title,
+			StartsAt: event.Start,
+			EndsAt:   event.End,
+			URL:      match[1],
+			JoinURL:  s.brands.Default().Join(match[1]),
+			SyncedAt: now,
+		}
+		if _, err := upcoming.ReplaceOne(ctx, bson.M{"_id": imported.ID}, imported, options.Replace().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+
+	_, err = upcoming.DeleteMany(ctx, bson.M{"grant": grant.ID, "syncedAt": bson.M{"$lt": now}})
+	return err
+}
@@ -0,0 +1,393 @@
+// Package calls carries direct 1:1 calls between signed-in users over their
+// presence sockets: invites ring the callee on every device until they
+// answer, decline, the caller hangs up or the ring times out. Calls that
+// are not answered leave a missed-call notification.
+package calls
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A call is "ringing" until it is "accepted", "rejected" by the callee,
+// "cancelled" by the caller or "missed" when nobody answers in time.
+// Callees with do-not-disturb on, or who blocked the caller, never ring:
+// their calls are "rejected" at once, the former also counting as missed.
+const (
+	Ringing   = "ringing"
+	Accepted  = "accepted"
+	Rejected  = "rejected"
+	Cancelled = "cancelled"
+	Missed    = "missed"
+)
+
+var ErrNotFound = errors.New("call not found")
+
+type Call struct {
+	ID         string     `bson:"_id" json:"id"`
+	Caller     string     `bson:"caller" json:"caller"`
+	Callee     string     `bson:"callee" json:"callee"`
+	Video      bool       `bson:"video" json:"video"`
+	Status     string     `bson:"status" json:"status"`
+	Reason     string     `bson:"reason,omitempty" json:"reason,omitempty"`
+	Session    string     `bson:"session" json:"-"`
+	Password   string     `bson:"password" json:"-"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	RingUntil  time.Time  `bson:"ringUntil" json:"ringUntil"`
+	UpdatedAt  time.Time  `bson:"updatedAt" json:"updatedAt"`
+	AnsweredAt *time.Time `bson:"answeredAt,omitempty" json:"answeredAt,omitempty"`
+}
+
+// Ringer places calls and delivers their state changes to the presence
+// sockets of both parties on this node. Every node runs one; changes made on
+// one node reach the others through the calls collection. A nil Ringer
+// refuses every call.
+type Ringer struct {
+	db          *mongo.Database
+	ringTimeout time.Duration
+
+	// Blocked reports whether user has blocked other.
+	Blocked func(ctx context.Context, user, other string) bool
+
+	mu        sync.Mutex
+	sockets   map[string]map[*interfaces.Connection]bool
+	delivered map[string]string
+}
+
+func NewRinger(db *mongo.Client, ringTimeout time.Duration) *Ringer {
+	return &Ringer{
+		db:          db.Database("vidchat"),
+		ringTimeout: ringTimeout,
+		sockets:     make(map[string]map[*interfaces.Connection]bool),
+		delivered:   make(map[string]string),
+	}
+}
+
+// Register lets calls reach user on connection until the returned function
+// is called.
+func (r *Ringer) Register(user string, connection *interfaces.Connection) func() {
+	if r == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	if r.sockets[user] == nil {
+		r.sockets[user] = make(map[*interfaces.Connection]bool)
+	}
+	r.sockets[user][connection] = true
+	r.mu.Unlock()
+
+	return func() {
+		r.mu.Lock()
+		delete(r.sockets[user], connection)
+		if len(r.sockets[user]) == 0 {
+			delete(r.sockets, user)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Invite starts ringing callee. The call gets a private two-person session
+// both sides join once it is accepted.
+func (r *Ringer) Invite(ctx context.Context, caller, callee string, video bool) (Call, error) {
+	if r == nil {
+		return Call{}, ErrNotFound
+	}
+	now := time.Now()
+	call := Call{
+		ID:        primitive.NewObjectID().Hex(),
+		Caller:    caller,
+		Callee:    callee,
+		Video:     video,
+		Status:    Ringing,
+		CreatedAt: now,
+		RingUntil: now.Add(r.ringTimeout),
+		UpdatedAt: now,
+	}
+
+	switch {
+	case r.Blocked != nil && r.Blocked(ctx, callee, caller):
+		// The caller is not told they are blocked.
+		call.Status, call.Reason = Rejected, "unavailable"
+	case r.doNotDisturb(ctx, callee):
+		call.Status, call.Reason = Rejected, "dnd"
+	default:
+		session, password, err := r.createSession(ctx, caller)
+		if err != nil {
+			return call, err
+		}
+		call.Session, call.Password = session, password
+	}
+
+	if _, err := r.db.Collection("calls").InsertOne(ctx, call); err != nil {
+		return call, err
+	}
+	if call.Reason == "dnd" {
+		r.notifyMissed(ctx, call)
+	}
+	return call, nil
+}
+
+// Answer moves a ringing call to status on behalf of user: the callee
+// accepts or rejects, the caller cancels.
+func (r *Ringer) Answer(ctx context.Context, user, callID, status string) error {
+	if r == nil {
+		return ErrNotFound
+	}
+	party := "callee"
+	if status == Cancelled {
+		party = "caller"
+	}
+
+	now := time.Now()
+	set := bson.M{"status": status, "updatedAt": now}
+	if status == Accepted {
+		set["answeredAt"] = now
+	}
+
+	var call Call
+	err := r.db.Collection("calls").FindOneAndUpdate(ctx,
+		bson.M{"_id": callID, party: user, "status": Ringing},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&call)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == Cancelled {
+		r.notifyMissed(ctx, call)
+	}
+	return nil
+}
+
+// History lists the user's recent calls, only the missed ones if missed is
+// set.
+func (r *Ringer) History(ctx context.Context, user string, missed bool) ([]Call, error) {
+	if r == nil {
+		return []Call{}, nil
+	}
+	filter := bson.M{"$or": bson.A{bson.M{"caller": user}, bson.M{"callee": user}}}
+	if missed {
+		filter = bson.M{"callee": user, "$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{Missed, Cancelled}}},
+			bson.M{"status": Rejected, "reason": "dnd"},
+		}}
+	}
+	cursor, err := r.db.Collection("calls").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(100))
+	if err != nil {
+		return nil, err
+	}
+	calls := []Call{}
+	err = cursor.All(ctx, &calls)
+	return calls, err
+}
+
+// Run delivers call changes to local sockets and times out unanswered calls.
+// Changes are followed with a change stream when MongoDB runs as a replica
+// set, and by polling otherwise.
+func (r *Ringer) Run() {
+	if r == nil {
+		return
+	}
+	go r.expire()
+
+	pipeline := mongo.Pipeline{}
+	for {
+		stream, err := r.db.Collection("calls").Watch(context.Background(), pipeline,
+			options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		if err != nil {
+			log.Printf("Calls: change stream unavailable, polling instead: %s", err)
+			r.poll()
+			return
+		}
+		for stream.Next(context.Background()) {
+			var change struct {
+				FullDocument *Call `bson:"fullDocument"`
+			}
+			if stream.Decode(&change) == nil && change.FullDocument != nil {
+				r.deliver(*change.FullDocument)
+			}
+		}
+		log.Printf("Calls: change stream closed: %v", stream.Err())
+		stream.Close(context.Background())
+		time.Sleep(time.Second)
+	}
+}
+
+func (r *Ringer) poll() {
+	since := time.Now().Add(-time.Minute)
+	for {
+		time.Sleep(time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cursor, err := r.db.Collection("calls").Find(ctx, bson.M{"updatedAt": bson.M{"$gte": since}})
+		var changed []Call
+		if err == nil {
+			err = cursor.All(ctx, &changed)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Calls: polling: %s", err)
+			continue
+		}
+		// Overlap a little so writes racing the previous poll are not lost;
+		// deliver drops repeats.
+		since = time.Now().Add(-5 * time.Second)
+		for _, call := range changed {
+			r.deliver(call)
+		}
+	}
+}
+
+// expire turns calls that rang out into missed calls. Every node runs it;
+// the conditional update lets only one of them record each call.
+func (r *Ringer) expire() {
+	for range time.Tick(time.Second) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cursor, err := r.db.Collection("calls").Find(ctx, bson.M{"status": Ringing, "ringUntil": bson.M{"$lt": time.Now()}})
+		var expired []Call
+		if err == nil {
+			err = cursor.All(ctx, &expired)
+		}
+		if err != nil {
+			log.Printf("Calls: expiring: %s", err)
+		}
+		for _, call := range expired {
+			result, err := r.db.Collection("calls").UpdateOne(ctx,
+				bson.M{"_id": call.ID, "status": Ringing},
+				bson.M{"$set": bson.M{"status": Missed, "reason": "timeout", "updatedAt": time.Now()}})
+			if err == nil && result.ModifiedCount == 1 {
+				r.notifyMissed(ctx, call)
+			}
+		}
+		cancel()
+	}
+}
+
+// deliver sends a call's new state to the parties' sockets on this node,
+// once per state.
+func (r *Ringer) deliver(call Call) {
+	r.mu.Lock()
+	if r.delivered[call.ID] == call.Status {
+		r.mu.Unlock()
+		return
+	}
+	r.delivered[call.ID] = call.Status
+	if call.Status != Ringing {
+		// Final states are delivered once; forget them after a while.
+		id := call.ID
+		time.AfterFunc(time.Minute, func() {
+			r.mu.Lock()
+			delete(r.delivered, id)
+			r.mu.Unlock()
+		})
+	}
+	callers := r.connections(call.Caller)
+	callees := r.connections(call.Callee)
+	r.mu.Unlock()
+
+	data := map[string]interface{}{"callID": call.ID, "video": call.Video, "status": call.Status}
+	if call.Reason != "" {
+		data["reason"] = call.Reason
+	}
+	joinable := map[string]interface{}{"callID": call.ID, "video": call.Video, "status": call.Status, "session": call.Session, "password": call.Password}
+
+	switch call.Status {
+	case Ringing:
+		send(callees, interfaces.Message{Type: "call_invite", UserID: call.Caller, To: call.Callee, Data: joinable})
+		send(callers, interfaces.Message{Type: "call_ringing", UserID: call.Caller, To: call.Callee, Data: joinable})
+	case Accepted:
+		// The callee's other devices stop ringing too.
+		send(callers, interfaces.Message{Type: "call_accept", UserID: call.Callee, To: call.Caller, Data: joinable})
+		send(callees, interfaces.Message{Type: "call_accept", UserID: call.Callee, To: call.Caller, Data: data})
+	case Rejected, Missed:
+		send(callers, interfaces.Message{Type: "call_reject", UserID: call.Callee, To: call.Caller, Data: data})
+		send(callees, interfaces.Message{Type: "call_cancel", UserID: call.Caller, To: call.Callee, Data: data})
+	case Cancelled:
+		send(callees, interfaces.Message{Type: "call_cancel", UserID: call.Caller, To: call.Callee, Data: data})
+		send(callers, interfaces.Message{Type: "call_cancel", UserID: call.Caller, To: call.Callee, Data: data})
+	}
+}
+
+// connections returns user's sockets on this node. Callers must hold r.mu.
+func (r *Ringer) connections(user string) []*interfaces.Connection {
+	var connections []*interfaces.Connection
+	for connection := range r.sockets[user] {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+func send(connections []*interfaces.Connection, message interfaces.Message) {
+	for _, connection := range connections {
+		connection.Send(message)
+	}
+}
+
+func (r *Ringer) doNotDisturb(ctx context.Context, user string) bool {
+	id, err := primitive.ObjectIDFromHex(user)
+	if err != nil {
+		return false
+	}
+	var preferences interfaces.Preferences
+	r.db.Collection("preferences").FindOne(ctx, bson.M{"_id": id}).Decode(&preferences)
+	return preferences.DoNotDisturb
+}
+
+// notifyMissed records a missed call in the callee's notifications.
+func (r *Ringer) notifyMissed(ctx context.Context, call Call) {
+	_, err := r.db.Collection("notifications").InsertOne(ctx, bson.M{
+		"_id":       primitive.NewObjectID(),
+		"userID":    call.Callee,
+		"type":      "missed_call",
+		"data":      bson.M{"callID": call.ID, "from": call.Caller, "video": call.Video},
+		"createdAt": time.Now(),
+	})
+	if err != nil {
+		log.Printf("Calls: recording missed call %s: %s", call.ID, err)
+	}
+}
+
+// createSession provisions the private session a call takes place in,
+// owned by the caller and capped at the two parties.
+func (r *Ringer) createSession(ctx context.Context, caller string) (string, string, error) {
+	password, hashedURL, socketURL := token(), token(), token()
+
+	session := interfaces.Session{
+		Host:     caller,
+		Title:    "Call",
+		Password: utils.HashPassword(password),
+		OwnerID:  caller,
+		Settings: interfaces.SessionSettings{MaxParticipants: 2},
+	}
+	result, err := r.db.Collection("sessions").InsertOne(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = r.db.Collection("sockets").InsertOne(ctx, interfaces.Socket{
+		SessionID: result.InsertedID.(primitive.ObjectID).Hex(),
+		HashedURL: hashedURL,
+		SocketURL: socketURL,
+	})
+	return hashedURL, password, err
+}
+
+func token() string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// ipFamily is the IP version(s) this deployment runs on, from IP_FAMILY.
+var ipFamily = utils.DualStack
+
+var candidatePrefix = []byte("candidate:")
+
+// relayable reports whether a frame may be relayed. ICE candidates for an IP
+// version the deployment does not run on are dropped, so peers don't spend
+// connectivity checks on paths that cannot work. In relay only rooms every
+// candidate but relayed ones is dropped, so peers never learn each other's
+// addresses even from a client that ignores the relay policy. A candidate
+// is the raw "candidate:" line or a JSON RTCIceCandidateInit.
+func relayable(clients *interfaces.Room, frame json.RawMessage) bool {
+	relayOnly := clients.Settings.RelayOnly
+	if (ipFamily == utils.DualStack && !relayOnly) || !bytes.Contains(frame, candidatePrefix) {
+		return true
+	}
+
+	var message interfaces.Message
+	if json.Unmarshal(frame, &message) != nil {
+		return true
+	}
+	candidate := message.Candidate
+	if strings.HasPrefix(candidate, "{") {
+		var init struct {
+			Candidate string `json:"candidate"`
+		}
+		json.Unmarshal([]byte(candidate), &init)
+		candidate = init.Candidate
+	}
+	// An empty candidate marks the end of candidates.
+	if relayOnly && candidate != "" && media.CandidateType(candidate) != "relay" {
+		return false
+	}
+	return ipFamily.Allows(media.CandidateIP(candidate))
+}
+
+// hideRelatedAddress blanks the related address of the relayed candidate a
+// frame carries in a relay only room, which would otherwise tell the other
+// peer where the sender connected to TURN from. Any other frame is returned
+// as is.
+func hideRelatedAddress(clients *interfaces.Room, frame json.RawMessage) json.RawMessage {
+	if !clients.Settings.RelayOnly || !bytes.Contains(frame, candidatePrefix) {
+		return frame
+	}
+
+	var message map[string]json.RawMessage
+	var candidate string
+	if json.Unmarshal(frame, &message) != nil || json.Unmarshal(message["candidate"], &candidate) != nil {
+		return frame
+	}
+	if strings.HasPrefix(candidate, "{") {
+		var init map[string]interface{}
+		if json.Unmarshal([]byte(candidate), &init) != nil {
+			return frame
+		}
+		line, _ := init["candidate"].(string)
+		init["candidate"] = media.HideRelatedAddress(line)
+		encoded, err := json.Marshal(init)
+		if err != nil {
+			return frame
+		}
+		candidate = string(encoded)
+	} else {
+		candidate = media.HideRelatedAddress(candidate)
+	}
+
+	encoded, err := json.Marshal(candidate)
+	if err != nil {
+		return frame
+	}
+	message["candidate"] = encoded
+	rewritten, err := json.Marshal(message)
+	if err != nil {
+		return frame
+	}
+	return rewritten
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/chaos"
+)
+
+// injector injects failures in binaries built with the chaos tag.
+var injector *chaos.Injector
+
+// faultsJSON is Faults with durations written like "250ms".
+type faultsJSON struct {
+	chaos.Faults
+	Delay        string `json:"delay"`
+	Jitter       string `json:"jitter"`
+	MongoLatency string `json:"mongoLatency"`
+}
+
+func getChaos(ctx *gin.Context) {
+	faults := injector.Faults()
+	ctx.JSON(http.StatusOK, faultsJSON{
+		Faults:       faults,
+		Delay:        faults.Delay.String(),
+		Jitter:       faults.Jitter.String(),
+		MongoLatency: faults.MongoLatency.String(),
+	})
+}
+
+// putChaos replaces the injected faults. An empty body clears them.
+func putChaos(ctx *gin.Context) {
+	var input faultsJSON
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	faults := input.Faults
+	for _, field := range []struct {
+		value string
+		into  *time.Duration
+	}{{input.Delay, &faults.Delay}, {input.Jitter, &faults.Jitter}, {input.MongoLatency, &faults.MongoLatency}} {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duration " + field.value + "."})
+			return
+		}
+		*field.into = duration
+	}
+	if err := faults.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	injector.Set(faults)
+	log.Printf("Chaos: injecting %+v", faults)
+	getChaos(ctx)
+}
+
+// postChaosDisconnect drops every connection of a room, or of the node when
+// no room is given, without the close handshake, as a network failure
+// would. Clients are expected to come back with their resume tokens.
+func postChaosDisconnect(ctx *gin.Context) {
+	dropped := 0
+	for socket, clients := range localRooms() {
+		if room := ctx.Query("socket"); room != "" && room != socket {
+			continue
+		}
+		for _, client := range clients.Clients() {
+			client.Close()
+			dropped++
+		}
+	}
+	log.Printf("Chaos: dropped %d connections", dropped)
+	ctx.JSON(http.StatusOK, gin.H{"dropped": dropped})
+}
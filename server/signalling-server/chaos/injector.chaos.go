@@ -0,0 +1,130 @@
+// Package chaos injects failures into the signalling path so that
+// resilience features, such as resume tokens and acknowledgements, can be
+// exercised under realistic conditions. It is compiled in only with the
+// chaos build tag; in other builds NewInjector returns nil and every hook is
+// a no-op.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Faults is the set of failures being injected. Rates are probabilities
+// between 0 and 1. Types limits relay delays and drops to the given message
+// types; empty means every type.
+type Faults struct {
+	Delay          time.Duration `json:"-"`
+	Jitter         time.Duration `json:"-"`
+	DropRate       float64       `json:"dropRate"`
+	DisconnectRate float64       `json:"disconnectRate"`
+	MongoLatency   time.Duration `json:"-"`
+	Types          []string      `json:"types,omitempty"`
+}
+
+func (f Faults) Validate() error {
+	if f.Delay < 0 || f.Jitter < 0 || f.MongoLatency < 0 {
+		return errors.New("durations must not be negative")
+	}
+	if f.DropRate < 0 || f.DropRate > 1 || f.DisconnectRate < 0 || f.DisconnectRate > 1 {
+		return errors.New("rates must be between 0 and 1")
+	}
+	return nil
+}
+
+func (f Faults) applies(messageType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == messageType {
+			return true
+		}
+	}
+	return false
+}
+
+// Injector holds the current faults. A nil Injector injects nothing.
+type Injector struct {
+	mu     sync.RWMutex
+	faults Faults
+}
+
+// NewInjector returns an injector with no faults, or nil when the binary was
+// built without the chaos tag.
+func NewInjector() *Injector {
+	if !Enabled {
+		return nil
+	}
+	return &Injector{}
+}
+
+func (i *Injector) Faults() Faults {
+	if i == nil {
+		return Faults{}
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.faults
+}
+
+func (i *Injector) Set(faults Faults) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	i.faults = faults
+	i.mu.Unlock()
+}
+
+// Delay holds a relayed message of the given type for the configured delay
+// plus up to the jitter.
+func (i *Injector) Delay(messageType string) {
+	faults := i.Faults()
+	if !faults.applies(messageType) || faults.Delay+faults.Jitter <= 0 {
+		return
+	}
+	delay := faults.Delay
+	if faults.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(faults.Jitter)))
+	}
+	time.Sleep(delay)
+}
+
+// Drop reports whether a relayed message of the given type should be lost.
+func (i *Injector) Drop(messageType string) bool {
+	faults := i.Faults()
+	return faults.applies(messageType) && faults.DropRate > 0 && rand.Float64() < faults.DropRate
+}
+
+// Disconnect reports whether the connection a frame arrived on should be
+// dropped, as a flaky network would.
+func (i *Injector) Disconnect() bool {
+	faults := i.Faults()
+	return faults.DisconnectRate > 0 && rand.Float64() < faults.DisconnectRate
+}
+
+// Monitor returns a command monitor delaying every MongoDB command by the
+// configured latency, or nil for a nil Injector.
+func (i *Injector) Monitor() *event.CommandMonitor {
+	if i == nil {
+		return nil
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, _ *event.CommandStartedEvent) {
+			latency := i.Faults().MongoLatency
+			if latency <= 0 {
+				return
+			}
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+			}
+		},
+	}
+}
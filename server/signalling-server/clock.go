@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// clockSync answers a clock_sync message, which clients send a few times
+// after connecting, and again now and then, to measure the offset between
+// their clock and the server's the way NTP does. The client sends its clock
+// as t0; the server echoes it with t1, its clock when the message arrived,
+// and t2, its clock when replying, all in Unix milliseconds. With t3 the
+// client's clock on receiving the reply:
+//
+//	offset = ((t1 - t0) + (t2 - t3)) / 2
+//	delay  = (t3 - t0) - (t2 - t1)
+//
+// Clients keep the offset measured with the smallest delay. It does not
+// need the client to have joined, so it can run before connect.
+func clockSync(connection *interfaces.Connection, frame json.RawMessage, received time.Time) {
+	var request struct {
+		Data struct {
+			T0 float64 `json:"t0"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &request) != nil {
+		return
+	}
+	connection.Send(interfaces.Message{Type: "clock_sync", Data: gin.H{
+		"t0": request.Data.T0,
+		"t1": received.UnixMilli(),
+		"t2": time.Now().UnixMilli(),
+	}})
+}
@@ -0,0 +1,42 @@
+// Command prober runs synthetic meetings against a signalling server and
+// serves the results on /metrics for Prometheus to scrape, giving black-box
+// health beyond /health. Each probe creates a session, joins it with two
+// bots, relays an offer and an answer between them and checks the STUN
+// server the session hands out.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/probe"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "signalling server base URL")
+	interval := flag.Duration("interval", time.Minute, "delay between probes")
+	timeout := flag.Duration("timeout", 15*time.Second, "time allowed for one probe")
+	listen := flag.String("listen", ":9102", "address to serve /metrics on")
+	once := flag.Bool("once", false, "run a single probe and exit non-zero if it fails")
+	flag.Parse()
+
+	prober := probe.NewProber(*url, *interval, *timeout)
+	if *once {
+		if err := prober.Probe(); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Probe succeeded")
+		return
+	}
+
+	go prober.Run()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		prober.WriteMetrics(w)
+	})
+	log.Printf("Probing %s every %s, metrics on %s", *url, *interval, *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
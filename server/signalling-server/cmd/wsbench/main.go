@@ -0,0 +1,161 @@
+// Command wsbench loads a signalling server with many WebSocket clients in one
+// room and reports broadcast latency and, when given the server's pid, its
+// resident memory. Run it once against a server started with WS_MODE=gorilla
+// and once with WS_MODE=epoll to compare the two modes.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws/bench", "room WebSocket URL")
+	clients := flag.Int("clients", 100, "number of connected clients")
+	idle := flag.Int("idle", 0, "additional connected clients that never send or read")
+	messages := flag.Int("messages", 200, "number of broadcasts to time")
+	interval := flag.Duration("interval", 10*time.Millisecond, "delay between broadcasts")
+	pid := flag.Int("pid", 0, "server pid to sample resident memory from (Linux only)")
+	flag.Parse()
+
+	baseline := rss(*pid)
+
+	for i := 0; i < *idle; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(*url, nil)
+		if err != nil {
+			log.Fatalf("idle client %d: %s", i, err)
+		}
+		defer conn.Close()
+	}
+
+	conns := make([]*websocket.Conn, *clients)
+	for i := range conns {
+		conn, _, err := websocket.DefaultDialer.Dial(*url, nil)
+		if err != nil {
+			log.Fatalf("client %d: %s", i, err)
+		}
+		defer conn.Close()
+
+		err = conn.WriteJSON(interfaces.Message{Type: "connect", UserID: "bench-" + strconv.Itoa(i)})
+		if err != nil {
+			log.Fatalf("client %d: %s", i, err)
+		}
+		conns[i] = conn
+	}
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		wg        sync.WaitGroup
+	)
+
+	for _, conn := range conns[1:] {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			received := 0
+			for received < *messages {
+				var message interfaces.Message
+				if err := conn.ReadJSON(&message); err != nil {
+					return
+				}
+				if message.Type != "bench" {
+					continue
+				}
+
+				sent, err := strconv.ParseInt(message.Description, 10, 64)
+				if err != nil {
+					continue
+				}
+
+				mu.Lock()
+				latencies = append(latencies, time.Since(time.Unix(0, sent)))
+				mu.Unlock()
+				received++
+			}
+		}(conn)
+	}
+
+	// Let the connect replies drain before timing broadcasts.
+	time.Sleep(500 * time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < *messages; i++ {
+		frame, _ := json.Marshal(interfaces.Message{
+			Type:        "bench",
+			UserID:      "bench-0",
+			Description: strconv.FormatInt(time.Now().UnixNano(), 10),
+		})
+		if err := conns[0].WriteMessage(websocket.TextMessage, frame); err != nil {
+			log.Fatalf("sender: %s", err)
+		}
+		time.Sleep(*interval)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		log.Println("timed out waiting for broadcasts")
+	}
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("clients:     %d (+%d idle)\n", *clients, *idle)
+	fmt.Printf("broadcasts:  %d in %s\n", *messages, elapsed)
+	fmt.Printf("deliveries:  %d\n", len(latencies))
+	if len(latencies) > 0 {
+		fmt.Printf("latency p50: %s\n", percentile(latencies, 50))
+		fmt.Printf("latency p99: %s\n", percentile(latencies, 99))
+		fmt.Printf("latency max: %s\n", latencies[len(latencies)-1])
+	}
+	if *pid != 0 {
+		loaded := rss(*pid)
+		fmt.Printf("server rss:  %d KiB -> %d KiB (%.1f KiB/conn)\n", baseline, loaded,
+			float64(loaded-baseline)/float64(*clients+*idle))
+	}
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func rss(pid int) int {
+	if pid == 0 {
+		return 0
+	}
+
+	file, err := os.Open("/proc/" + strconv.Itoa(pid) + "/status")
+	if err != nil {
+		log.Printf("reading server memory: %s", err)
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, _ := strconv.Atoi(fields[1])
+			return kb
+		}
+	}
+	return 0
+}
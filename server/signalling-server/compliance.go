@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/compliance"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// watchlists checks what is said in meetings against their org's
+// watchlists.
+var watchlists *compliance.Monitor
+
+// watchChat checks a chat message against the org's watchlists.
+func watchChat(clients *interfaces.Room, userID string, frame json.RawMessage) {
+	if clients.Org == "" {
+		return
+	}
+	var message interfaces.Message
+	if json.Unmarshal(frame, &message) != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	watchlists.Check(ctx, clients.Org, clients.Session, compliance.SourceChat, userID, message.Text)
+}
@@ -0,0 +1,212 @@
+// Package compliance watches what is said in an org's meetings for the
+// keywords and patterns on its watchlists, keeping every match as an alert
+// for review and telling the org's compliance team as it happens.
+package compliance
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Bounds on a watchlist, so matching stays cheap on every message.
+const (
+	maxTerms      = 200
+	maxTermLength = 200
+	// maxAlertText bounds the text kept with an alert, in bytes.
+	maxAlertText = 1000
+)
+
+// Sources of what is watched.
+const (
+	SourceChat = "chat"
+)
+
+// term is a keyword or pattern of a watchlist, compiled.
+type term struct {
+	text string
+	expr *regexp.Regexp
+}
+
+type compiled struct {
+	watchlist interfaces.Watchlist
+	terms     []term
+}
+
+// Validate compiles a watchlist's keywords and patterns.
+func Validate(watchlist interfaces.Watchlist) error {
+	_, err := compile(watchlist)
+	return err
+}
+
+func compile(watchlist interfaces.Watchlist) ([]term, error) {
+	if len(watchlist.Keywords)+len(watchlist.Patterns) > maxTerms {
+		return nil, errors.New("a watchlist holds at most 200 keywords and patterns")
+	}
+	var terms []term
+	for _, keyword := range watchlist.Keywords {
+		if keyword == "" || len(keyword) > maxTermLength {
+			return nil, errors.New("keywords must be 1 to 200 characters")
+		}
+		terms = append(terms, term{text: keyword, expr: regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(keyword) + `\b`)})
+	}
+	for _, pattern := range watchlist.Patterns {
+		if pattern == "" || len(pattern) > maxTermLength {
+			return nil, errors.New("patterns must be 1 to 200 characters")
+		}
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term{text: pattern, expr: expr})
+	}
+	return terms, nil
+}
+
+type cachedWatchlists struct {
+	watchlists []compiled
+	fetched    time.Time
+}
+
+// Monitor matches text said in meetings against the org's watchlists,
+// caching each org's watchlists for a short while. Matches are saved in
+// the keyword_alerts collection, fired to the org's keyword.alert hooks and
+// left in the notifications of the watchlist's Notify users. A nil Monitor
+// watches nothing.
+type Monitor struct {
+	db    *mongo.Database
+	hooks *automation.Hooks
+
+	mu   sync.Mutex
+	orgs map[string]cachedWatchlists
+}
+
+func NewMonitor(db *mongo.Client, hooks *automation.Hooks) *Monitor {
+	return &Monitor{
+		db:    db.Database("vidchat"),
+		hooks: hooks,
+		orgs:  make(map[string]cachedWatchlists),
+	}
+}
+
+// Check matches text said by userID in the session against the org's
+// watchlists, raising an alert for each watchlist it matches.
+func (m *Monitor) Check(ctx context.Context, org, sessionID, source, userID, text string) {
+	if m == nil || org == "" || text == "" {
+		return
+	}
+	for _, c := range m.watchlists(ctx, org) {
+		var matches []string
+		for _, term := range c.terms {
+			if term.expr.MatchString(text) {
+				matches = append(matches, term.text)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if len(text) > maxAlertText {
+			text = strings.ToValidUTF8(text[:maxAlertText], "")
+		}
+		m.alert(ctx, c.watchlist, interfaces.KeywordAlert{
+			ID:          primitive.NewObjectID().Hex(),
+			OrgID:       org,
+			WatchlistID: c.watchlist.ID,
+			Watchlist:   c.watchlist.Name,
+			SessionID:   sessionID,
+			Source:      source,
+			UserID:      userID,
+			Text:        text,
+			Matches:     matches,
+			At:          time.Now(),
+		})
+	}
+}
+
+func (m *Monitor) alert(ctx context.Context, watchlist interfaces.Watchlist, alert interfaces.KeywordAlert) {
+	if _, err := m.db.Collection("keyword_alerts").InsertOne(ctx, alert); err != nil {
+		log.Printf("Error saving keyword alert of %s: %s", alert.OrgID, err)
+	}
+
+	m.hooks.Fire(ctx, automation.OrgOwner(alert.OrgID), automation.EventKeywordAlert, automation.Item{
+		"id":          alert.ID,
+		"orgID":       alert.OrgID,
+		"watchlistID": alert.WatchlistID,
+		"watchlist":   alert.Watchlist,
+		"sessionID":   alert.SessionID,
+		"source":      alert.Source,
+		"userID":      alert.UserID,
+		"text":        alert.Text,
+		"matches":     alert.Matches,
+		"at":          alert.At,
+	})
+
+	for _, user := range watchlist.Notify {
+		_, err := m.db.Collection("notifications").InsertOne(ctx, bson.M{
+			"_id":       primitive.NewObjectID(),
+			"userID":    user,
+			"type":      "keyword_alert",
+			"data":      bson.M{"alertID": alert.ID, "orgID": alert.OrgID, "sessionID": alert.SessionID, "watchlist": alert.Watchlist, "matches": alert.Matches},
+			"createdAt": alert.At,
+		})
+		if err != nil {
+			log.Printf("Error notifying %s of keyword alert %s: %s", user, alert.ID, err)
+		}
+	}
+}
+
+func (m *Monitor) watchlists(ctx context.Context, org string) []compiled {
+	m.mu.Lock()
+	cached, ok := m.orgs[org]
+	m.mu.Unlock()
+	if ok && time.Since(cached.fetched) < 30*time.Second {
+		return cached.watchlists
+	}
+
+	cached = cachedWatchlists{fetched: time.Now()}
+	cursor, err := m.db.Collection("watchlists").Find(ctx, bson.M{"orgID": org, "disabled": bson.M{"$ne": true}})
+	if err != nil {
+		log.Printf("Error loading watchlists of %s: %s", org, err)
+		return nil
+	}
+	var saved []interfaces.Watchlist
+	if err := cursor.All(ctx, &saved); err != nil {
+		log.Printf("Error loading watchlists of %s: %s", org, err)
+		return nil
+	}
+	for _, watchlist := range saved {
+		terms, err := compile(watchlist)
+		if err != nil {
+			log.Printf("Skipping invalid watchlist %s of %s: %s", watchlist.ID, org, err)
+			continue
+		}
+		cached.watchlists = append(cached.watchlists, compiled{watchlist: watchlist, terms: terms})
+	}
+
+	m.mu.Lock()
+	m.orgs[org] = cached
+	m.mu.Unlock()
+	return cached.watchlists
+}
+
+// Forget drops the org's cached watchlists so an admin change applies
+// immediately on this node.
+func (m *Monitor) Forget(org string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.orgs, org)
+	m.mu.Unlock()
+}
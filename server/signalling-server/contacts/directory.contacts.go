@@ -0,0 +1,107 @@
+// Package contacts reads the contact lists and blocks kept by the users
+// service.
+package contacts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const cacheTTL = 30 * time.Second
+
+const cacheLimit = 10000
+
+type cached struct {
+	blocked bool
+	expires time.Time
+}
+
+// Directory answers block lookups for the relay, caching them briefly since
+// they sit on the message path. A nil Directory blocks nothing.
+type Directory struct {
+	collection *mongo.Collection
+
+	mu     sync.Mutex
+	blocks map[string]cached
+}
+
+func NewDirectory(db *mongo.Client) *Directory {
+	return &Directory{
+		collection: db.Database("vidchat").Collection("contacts"),
+		blocks:     make(map[string]cached),
+	}
+}
+
+// Blocked reports whether owner has blocked other. IDs that aren't user IDs,
+// such as those of anonymous guests, are never blocked.
+func (d *Directory) Blocked(ctx context.Context, owner, other string) bool {
+	if d == nil || owner == "" || other == "" || owner == other {
+		return false
+	}
+	key := owner + "|" + other
+
+	d.mu.Lock()
+	entry, ok := d.blocks[key]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.blocked
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(owner)
+	if err != nil {
+		return false
+	}
+	otherID, err := primitive.ObjectIDFromHex(other)
+	if err != nil {
+		return false
+	}
+
+	count, err := d.collection.CountDocuments(ctx, bson.M{"ownerID": ownerID, "contactID": otherID, "blocked": true})
+	if err != nil {
+		return ok && entry.blocked
+	}
+
+	d.mu.Lock()
+	if len(d.blocks) >= cacheLimit {
+		d.blocks = make(map[string]cached)
+	}
+	d.blocks[key] = cached{blocked: count > 0, expires: time.Now().Add(cacheTTL)}
+	d.mu.Unlock()
+	return count > 0
+}
+
+// Contacts returns the IDs on owner's contact list, leaving out anyone who
+// has blocked owner.
+func (d *Directory) Contacts(ctx context.Context, owner string) ([]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	ownerID, err := primitive.ObjectIDFromHex(owner)
+	if err != nil {
+		return nil, nil
+	}
+
+	cursor, err := d.collection.Find(ctx, bson.M{"ownerID": ownerID, "listed": true, "blocked": false})
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		ContactID primitive.ObjectID `bson:"contactID"`
+	}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	contacts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id := entry.ContactID.Hex(); !d.Blocked(ctx, id, owner) {
+			contacts = append(contacts, id)
+		}
+	}
+	return contacts, nil
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+)
+
+// invitePath is what invites to a session are signed over.
+func invitePath(hashedURL string) string {
+	return "/invite/" + hashedURL
+}
+
+// decoyHash is compared against when a session does not exist, so that a
+// wrong URL takes as long to refuse as a wrong password.
+var decoyHash = utils.HashPassword("decoy")
+
+// lookupFailed refuses a request for a session URL that does not exist the
+// same way as a wrong password, so guessing URLs tells nothing, and counts
+// the failure against the caller's IP.
+func lookupFailed(ctx *gin.Context, password string) {
+	utils.ComparePasswords(decoyHash, []byte(password))
+	ctx.MustGet("lookups").(*utils.Throttle).Fail(ctx.ClientIP())
+	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password."})
+}
+
+// joiningUser returns who is joining a session: the signed-in account,
+// which clients cannot choose, or the userID a guest picked for the room.
+// account is empty for guests.
+func joiningUser(ctx *gin.Context) (userID, account string) {
+	if claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request); err == nil && claims != nil {
+		return claims.Subject, claims.Subject
+	}
+	return ctx.Query("userID"), ""
+}
+
+// userDeactivated reports whether the users service deactivated the
+// account. Guests, who have none, are not.
+func userDeactivated(ctx *gin.Context, db *mongo.Client, account string) bool {
+	id, err := primitive.ObjectIDFromHex(account)
+	if err != nil {
+		return false
+	}
+	var user struct {
+		DeactivatedAt *time.Time `bson:"deactivatedAt"`
+	}
+	db.Database("vidchat").Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user.DeactivatedAt != nil
+}
+
+// sessionAccess checks the caller may enter the session, writing the error
+// response when not. A valid invite (expires, viewer and sig query
+// parameters) always admits, as does a valid embed token; otherwise the
+// session's access mode decides.
+func sessionAccess(ctx *gin.Context, socket interfaces.Socket, session interfaces.Session, password string) bool {
+	if session.CancelledAt != nil {
+		ctx.JSON(http.StatusGone, gin.H{"error": "Session was cancelled."})
+		return false
+	}
+
+	if ctx.Query("embed") != "" {
+		if _, ok := embedGrant(ctx, socket); !ok {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired embed token."})
+			return false
+		}
+		return true
+	}
+
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	if ctx.Query("sig") != "" && signer.Verify(invitePath(socket.HashedURL), ctx.Request.URL.Query()) {
+		return true
+	}
+
+	switch session.Access {
+	case interfaces.AccessInvite:
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "A valid invitation is required."})
+		return false
+	case interfaces.AccessOrg:
+		claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+		if err != nil || claims == nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in or use an invitation to join."})
+			return false
+		}
+		if userOrg(ctx, ctx.MustGet("db").(*mongo.Client), claims.Subject) != session.OrgID {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only members of the organization may join."})
+			return false
+		}
+		return true
+	}
+
+	if !utils.ComparePasswords(session.Password, []byte(password)) {
+		ctx.MustGet("lookups").(*utils.Throttle).Fail(ctx.ClientIP())
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password."})
+		return false
+	}
+	return true
+}
+
+// CreateInvite issues a signed invite to the session for one invitee. Only
+// the session's owner may invite. Invites expire after the requested ttl,
+// seven days by default and at most thirty.
+func CreateInvite(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Invitee string `json:"invitee"`
+		TTL     string `json:"ttl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Invitee = strings.TrimSpace(input.Invitee)
+	if input.Invitee == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invitee is required."})
+		return
+	}
+	ttl := defaultInviteTTL
+	if input.TTL != "" {
+		parsed, err := time.ParseDuration(input.TTL)
+		if err != nil || parsed <= 0 || parsed > maxInviteTTL {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invite ttl must be a duration of at most 720h."})
+			return
+		}
+		ttl = parsed
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can invite."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, signInvite(ctx, socket, input.Invitee, ttl))
+}
+
+// signInvite issues an invite to the socket's session, returning the token
+// and the join page URL carrying it.
+func signInvite(ctx *gin.Context, socket interfaces.Socket, invitee string, ttl time.Duration) gin.H {
+	signed := ctx.MustGet("signer").(*utils.URLSigner).Sign(invitePath(socket.HashedURL), invitee, ttl)
+	_, query, _ := strings.Cut(signed, "?")
+
+	join := ctx.MustGet("branding").(*branding.Store).Links(ctx, socket.OrgID).Join(socket.HashedURL)
+	separator := "?"
+	if strings.Contains(join, "?") {
+		separator = "&"
+	}
+	return gin.H{
+		"invitee":   invitee,
+		"expiresAt": time.Now().Add(ttl),
+		"token":     query,
+		"url":       join + separator + query,
+	}
+}
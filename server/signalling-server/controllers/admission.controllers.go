@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/admission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// admit asks the admission hook about request, filling in the caller's IP,
+// and writes the error response when it is refused.
+func admit(ctx *gin.Context, request admission.Request) (admission.Decision, bool) {
+	hooks := ctx.MustGet("admission").(*admission.Hooks)
+	request.IP = ctx.ClientIP()
+
+	decision, err := hooks.Check(ctx, request)
+	if errors.Is(err, admission.ErrUnavailable) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Admission check unavailable.", "reason": decision.Reason})
+		return decision, false
+	}
+	if !decision.Allow {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Not allowed.", "reason": decision.Reason})
+		return decision, false
+	}
+	return decision, true
+}
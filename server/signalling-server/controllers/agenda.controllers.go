@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SetAgenda plans the session's agenda. Its room starts with it; once the
+// meeting runs, hosts change it with set_agenda instead.
+func SetAgenda(ctx *gin.Context) {
+	var input struct {
+		Items []interfaces.AgendaItem `json:"items"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := interfaces.ValidateAgenda(input.Items); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agenda: " + err.Error() + "."})
+		return
+	}
+
+	_, session, id, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	if session.CancelledAt != nil {
+		ctx.JSON(http.StatusGone, gin.H{"error": "Session was cancelled."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	if _, err := db.Database("vidchat").Collection("sessions").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"agenda": input.Items}}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save agenda."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"items": input.Items})
+}
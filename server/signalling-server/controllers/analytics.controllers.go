@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetSpeakerStats reports talk time, interruptions and silence ratio for
+// each participant of a session, including the meeting in progress when it
+// is running on this node, for its owner.
+func GetSpeakerStats(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can see its speaker statistics."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	saved, err := analytics.Load(ctx, db, socket.SocketURL)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load speaker statistics."})
+		return
+	}
+
+	speakers := ctx.MustGet("speakers").(*analytics.Speakers)
+	stats := analytics.Merge(saved, speakers.Stats(socket.SocketURL))
+
+	var talk float64
+	for _, stat := range stats {
+		talk += stat.TalkSeconds
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"speakers": stats, "talkSeconds": talk})
+}
+
+// GetAttendance lists who attended a session, for its owner. Query
+// parameters such as metadata.crmId=42 keep only participants who joined
+// with that metadata.
+func GetAttendance(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can see its attendance."})
+		return
+	}
+
+	filter := make(map[string]string)
+	for param, values := range ctx.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, "metadata.")
+		if !ok {
+			continue
+		}
+		if !interfaces.MetadataKey.MatchString(key) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid metadata key " + key + "."})
+			return
+		}
+		filter[key] = values[0]
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	records, err := analytics.LoadAttendance(ctx, db, socket.SessionID, filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load attendance."})
+		return
+	}
+	ctx.JSON(http.StatusOK, records)
+}
+
+// GetAudience reports a webinar's audience minute by minute: viewers, joins
+// and leaves, and reactions, with totals.
+func GetAudience(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can see its audience."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	samples, summary, err := analytics.LoadAudience(ctx, db, socket.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load audience."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"summary": summary, "minutes": samples})
+}
+
+// GetTimeline lists what happened in a session's room, oldest first: joins,
+// leaves and dropped connections, mutes, screen shares and recordings.
+// ?type=join,leave narrows it to some event types.
+func GetTimeline(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can see its timeline."})
+		return
+	}
+
+	var types []string
+	if param := ctx.Query("type"); param != "" {
+		types = strings.Split(param, ",")
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	events, err := analytics.LoadTimeline(ctx, db, socket.SessionID, types)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load timeline."})
+		return
+	}
+	ctx.JSON(http.StatusOK, events)
+}
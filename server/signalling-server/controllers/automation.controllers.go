@@ -0,0 +1,411 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultTriggerLimit = 50
+	maxTriggerLimit     = 100
+)
+
+// CreateAPIKey issues an API key acting as the signed-in user. The key is
+// only shown in this response.
+func CreateAPIKey(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Name is required."})
+		return
+	}
+
+	key, record, err := ctx.MustGet("keys").(*automation.Keys).Create(ctx, claims.Subject, input.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"key": key, "apiKey": record})
+}
+
+// ListAPIKeys lists the signed-in user's API keys.
+func ListAPIKeys(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	keys, err := ctx.MustGet("keys").(*automation.Keys).List(ctx, claims.Subject)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load API keys."})
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// DeleteAPIKey revokes one of the signed-in user's API keys.
+func DeleteAPIKey(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err == nil {
+		err = ctx.MustGet("keys").(*automation.Keys).Revoke(ctx, claims.Subject, id)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "API key not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// requireAPIKey authenticates an automation request, writing a 401 when it
+// carries no valid key.
+func requireAPIKey(ctx *gin.Context) (*automation.APIKey, bool) {
+	key, err := ctx.MustGet("keys").(*automation.Keys).Authenticate(ctx.Request)
+	if err != nil || key == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "A valid API key is required."})
+		return nil, false
+	}
+	return key, true
+}
+
+// triggerLimit parses the limit query parameter of trigger feeds.
+func triggerLimit(ctx *gin.Context) (int64, bool) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultTriggerLimit)))
+	if err != nil || limit < 1 || limit > maxTriggerLimit {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit."})
+		return 0, false
+	}
+	return int64(limit), true
+}
+
+// GetAutomationMe identifies the key's user, for platforms testing a
+// connection.
+func GetAutomationMe(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"userID": key.OwnerID, "key": key.Name})
+}
+
+// hashedURLs maps session IDs to their sessions' hashed URLs.
+func hashedURLs(ctx *gin.Context, db *mongo.Client, sessionIDs []string) (map[string]string, error) {
+	var sockets []interfaces.Socket
+	cursor, err := db.Database("vidchat").Collection("sockets").Find(ctx, bson.M{"sessionID": bson.M{"$in": sessionIDs}})
+	if err == nil {
+		err = cursor.All(ctx, &sockets)
+	}
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string, len(sockets))
+	for _, socket := range sockets {
+		urls[socket.SessionID] = socket.HashedURL
+	}
+	return urls, nil
+}
+
+// ListMeetingsTrigger is the polling feed of the key user's meetings, newest
+// first. Item IDs are stable, so platforms can dedupe on them.
+func ListMeetingsTrigger(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	limit, ok := triggerLimit(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("sessions").Find(ctx,
+		bson.M{"ownerID": key.OwnerID},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit))
+	var sessions []struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		interfaces.Session `bson:",inline"`
+	}
+	if err == nil {
+		err = cursor.All(ctx, &sessions)
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID.Hex())
+	}
+	var urls map[string]string
+	if err == nil {
+		urls, err = hashedURLs(ctx, db, ids)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load meetings."})
+		return
+	}
+
+	hooks := ctx.MustGet("hooks").(*automation.Hooks)
+	items := make([]automation.Item, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, hooks.MeetingItem(ctx, session.ID.Hex(), session.Session, urls[session.ID.Hex()], session.ID.Timestamp()))
+	}
+	ctx.JSON(http.StatusOK, items)
+}
+
+// ListRecordingsTrigger is the polling feed of ready recordings of the key
+// user's meetings, most recently finished first.
+func ListRecordingsTrigger(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	limit, ok := triggerLimit(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("sessions").Find(ctx,
+		bson.M{"ownerID": key.OwnerID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	var sessions []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err == nil {
+		err = cursor.All(ctx, &sessions)
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID.Hex())
+	}
+
+	var recordings []interfaces.Recording
+	if err == nil {
+		cursor, err = db.Database("vidchat").Collection("recordings").Find(ctx,
+			bson.M{"sessionID": bson.M{"$in": ids}, "status": interfaces.RecordingReady},
+			options.Find().SetSort(bson.D{{Key: "stoppedAt", Value: -1}}).SetLimit(limit))
+	}
+	if err == nil {
+		err = cursor.All(ctx, &recordings)
+	}
+	var urls map[string]string
+	if err == nil {
+		urls, err = hashedURLs(ctx, db, ids)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load recordings."})
+		return
+	}
+
+	hooks := ctx.MustGet("hooks").(*automation.Hooks)
+	items := make([]automation.Item, 0, len(recordings))
+	for _, recording := range recordings {
+		items = append(items, hooks.RecordingItem(recording, urls[recording.SessionID]))
+	}
+	ctx.JSON(http.StatusOK, items)
+}
+
+// ListHooks lists the key user's REST hook subscriptions.
+func ListHooks(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	subscriptions, err := ctx.MustGet("hooks").(*automation.Hooks).Subscriptions(ctx, key.OwnerID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load hooks."})
+		return
+	}
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+// SubscribeHook subscribes targetUrl to an event. The response carries the
+// secret deliveries are signed with.
+func SubscribeHook(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Event     string `json:"event"`
+		TargetURL string `json:"targetUrl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !automation.ValidEvent(input.Event) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event.", "events": automation.Events})
+		return
+	}
+	if parsed, err := url.Parse(input.TargetURL); err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "targetUrl must be an http(s) URL."})
+		return
+	}
+
+	subscription, err := ctx.MustGet("hooks").(*automation.Hooks).Subscribe(ctx, key.OwnerID, input.Event, input.TargetURL)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not subscribe."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, subscription)
+}
+
+// UnsubscribeHook removes one of the key user's hooks.
+func UnsubscribeHook(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err == nil {
+		err = ctx.MustGet("hooks").(*automation.Hooks).Unsubscribe(ctx, key.OwnerID, id)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Hook not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// CreateMeetingAction creates a meeting owned by the key's user and returns
+// it as a trigger item.
+func CreateMeetingAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+
+	var session interfaces.Session
+	if err := ctx.ShouldBindJSON(&session); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	session.OwnerID = key.OwnerID
+	if session.Title == "" {
+		session.Title = "Meeting " + time.Now().UTC().Format("2006-01-02 15:04")
+	}
+
+	id, socket, _, ok := createSession(ctx, session)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusCreated, ctx.MustGet("hooks").(*automation.Hooks).MeetingItem(ctx, id.Hex(), session, socket.HashedURL, id.Timestamp()))
+}
+
+// InviteAction invites someone to one of the key user's meetings.
+func InviteAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Invitee string `json:"invitee"`
+		TTL     string `json:"ttl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Invitee = strings.TrimSpace(input.Invitee)
+	if input.Invitee == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invitee is required."})
+		return
+	}
+	ttl := defaultInviteTTL
+	if input.TTL != "" {
+		parsed, err := time.ParseDuration(input.TTL)
+		if err != nil || parsed <= 0 || parsed > maxInviteTTL {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invite ttl must be a duration of at most 720h."})
+			return
+		}
+		ttl = parsed
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID != key.OwnerID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can invite."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, signInvite(ctx, socket, input.Invitee, ttl))
+}
+
+// ListOrgHooks lists the hooks an org is subscribed to.
+func ListOrgHooks(ctx *gin.Context) {
+	subscriptions, err := ctx.MustGet("hooks").(*automation.Hooks).Subscriptions(ctx, automation.OrgOwner(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load hooks."})
+		return
+	}
+	ctx.JSON(http.StatusOK, subscriptions)
+}
+
+// SubscribeOrgHook subscribes targetUrl to one of an org's events, such as
+// its storage warnings. The response carries the secret deliveries are
+// signed with.
+func SubscribeOrgHook(ctx *gin.Context) {
+	var input struct {
+		Event     string `json:"event"`
+		TargetURL string `json:"targetUrl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !automation.ValidOrgEvent(input.Event) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event.", "events": automation.OrgEvents})
+		return
+	}
+	if !httpURL(input.TargetURL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "targetUrl must be an http(s) URL."})
+		return
+	}
+
+	subscription, err := ctx.MustGet("hooks").(*automation.Hooks).Subscribe(ctx, automation.OrgOwner(ctx.Param("id")), input.Event, input.TargetURL)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not subscribe."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, subscription)
+}
+
+// UnsubscribeOrgHook removes one of an org's hooks.
+func UnsubscribeOrgHook(ctx *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("hook"))
+	if err == nil {
+		err = ctx.MustGet("hooks").(*automation.Hooks).Unsubscribe(ctx, automation.OrgOwner(ctx.Param("id")), id)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Hook not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
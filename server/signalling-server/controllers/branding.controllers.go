@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func httpURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "https" || parsed.Scheme == "http") && parsed.Host != ""
+}
+
+// publicBranding is what clients need to brand an org's pages. Email
+// templates are left out; they are only of use to the users service.
+func publicBranding(brand interfaces.Branding) gin.H {
+	return gin.H{
+		"orgID":            brand.OrgID,
+		"name":             brand.Name,
+		"logoUrl":          brand.LogoURL,
+		"colors":           brand.Colors,
+		"meetingUrlPrefix": brand.MeetingURLPrefix,
+	}
+}
+
+// GetBranding returns an org's branding for clients; orgs without any get
+// empty fields and the default look.
+func GetBranding(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, publicBranding(ctx.MustGet("branding").(*branding.Store).Get(ctx, ctx.Param("id"))))
+}
+
+// GetOrgBranding returns an org's branding in full, for admins.
+func GetOrgBranding(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ctx.MustGet("branding").(*branding.Store).Get(ctx, ctx.Param("id")))
+}
+
+// UpdateOrgBranding replaces an org's branding.
+func UpdateOrgBranding(ctx *gin.Context) {
+	var brand interfaces.Branding
+	if err := ctx.ShouldBindJSON(&brand); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	brand.OrgID = ctx.Param("id")
+	brand.UpdatedAt = time.Now()
+
+	// The name ends up in email subjects.
+	if strings.ContainsAny(brand.Name, "\r\n") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Name must be a single line."})
+		return
+	}
+	if brand.LogoURL != "" && !httpURL(brand.LogoURL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "logoUrl must be an http(s) URL."})
+		return
+	}
+	if brand.MeetingURLPrefix != "" && !httpURL(brand.MeetingURLPrefix) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "meetingUrlPrefix must be an http(s) URL."})
+		return
+	}
+	for _, color := range []string{brand.Colors.Primary, brand.Colors.Accent, brand.Colors.Background} {
+		if color != "" && !hexColor.MatchString(color) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Colors must be written as #rrggbb."})
+			return
+		}
+	}
+	for email, template := range brand.EmailTemplates {
+		if _, ok := interfaces.EmailPlaceholders[email]; !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown email template " + email + "."})
+			return
+		}
+		if strings.ContainsAny(template.Subject, "\r\n") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Email subjects must be a single line."})
+			return
+		}
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("branding")
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": brand.OrgID}, brand, options.Replace().SetUpsert(true))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save branding."})
+		return
+	}
+
+	ctx.MustGet("branding").(*branding.Store).Forget(brand.OrgID)
+	ctx.JSON(http.StatusOK, brand)
+}
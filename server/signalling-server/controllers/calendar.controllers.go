@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/calendar"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// calendarStateTTL bounds how long a user has to grant calendar access.
+	calendarStateTTL = 10 * time.Minute
+	// upcomingWindow is how far ahead the upcoming meetings list looks.
+	upcomingWindow = 30 * 24 * time.Hour
+)
+
+func calendarCallbackPath(provider string) string {
+	return "/calendar/" + provider + "/callback"
+}
+
+// calendarProvider resolves the :provider param, writing a 404 when it is
+// not configured.
+func calendarProvider(ctx *gin.Context) (*calendar.Provider, bool) {
+	provider := ctx.MustGet("calendars").(*calendar.Syncer).Provider(ctx.Param("provider"))
+	if provider == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Calendar provider is not available."})
+		return nil, false
+	}
+	return provider, true
+}
+
+// ConnectCalendar returns the provider's consent page for the signed-in
+// user. The OAuth state is a signed, short-lived token naming the user, so
+// the callback needs no session of its own.
+func ConnectCalendar(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	provider, ok := calendarProvider(ctx)
+	if !ok {
+		return
+	}
+
+	signed := ctx.MustGet("signer").(*utils.URLSigner).Sign(calendarCallbackPath(provider.Name), claims.Subject, calendarStateTTL)
+	state := base64.RawURLEncoding.EncodeToString([]byte(signed))
+	ctx.JSON(http.StatusOK, gin.H{"url": provider.OAuth.AuthCodeURL(state)})
+}
+
+// CalendarCallback is where the provider sends the user back to after
+// consent.
+func CalendarCallback(ctx *gin.Context) {
+	provider, ok := calendarProvider(ctx)
+	if !ok {
+		return
+	}
+	if reason := ctx.Query("error"); reason != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Calendar access was not granted.", "reason": reason})
+		return
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(ctx.Query("state"))
+	var state *url.URL
+	if err == nil {
+		state, err = url.Parse(string(decoded))
+	}
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	if err != nil || state.Path != calendarCallbackPath(provider.Name) || !signer.Verify(state.Path, state.Query()) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state."})
+		return
+	}
+	userID := state.Query().Get("viewer")
+
+	if err := ctx.MustGet("calendars").(*calendar.Syncer).Connect(ctx, userID, provider, ctx.Query("code")); err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not connect the calendar."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"provider": provider.Name, "connected": true})
+}
+
+// ListCalendars lists the signed-in user's connected calendars.
+func ListCalendars(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	grants, err := ctx.MustGet("calendars").(*calendar.Syncer).Grants(ctx, claims.Subject)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load calendars."})
+		return
+	}
+	ctx.JSON(http.StatusOK, grants)
+}
+
+// DisconnectCalendar stops syncing one of the signed-in user's calendars.
+func DisconnectCalendar(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	err := ctx.MustGet("calendars").(*calendar.Syncer).Disconnect(ctx, claims.Subject, ctx.Param("provider"))
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Calendar not connected."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disconnect the calendar."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ownedSession loads the session at :url for its signed-in owner or one of
+// the owner's delegates, writing the error response otherwise.
+func ownedSession(ctx *gin.Context) (interfaces.Socket, interfaces.Session, primitive.ObjectID, bool) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return interfaces.Socket{}, interfaces.Session{}, primitive.NilObjectID, false
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return socket, session, primitive.NilObjectID, false
+	}
+	if !schedulesFor(ctx, ctx.MustGet("db").(*mongo.Client), session.OwnerID, claims.Subject) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner or their delegates can schedule it."})
+		return socket, session, primitive.NilObjectID, false
+	}
+	id, _ := primitive.ObjectIDFromHex(socket.SessionID)
+	return socket, session, id, true
+}
+
+// RescheduleSession sets when the session starts and, optionally, ends.
+// Connected calendars are updated on their next sync, which this brings
+// forward.
+func RescheduleSession(ctx *gin.Context) {
+	var input struct {
+		StartsAt time.Time  `json:"startsAt"`
+		EndsAt   *time.Time `json:"endsAt"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.StartsAt.IsZero() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "startsAt is required."})
+		return
+	}
+	if input.EndsAt != nil && !input.EndsAt.After(input.StartsAt) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "endsAt must be after startsAt."})
+		return
+	}
+
+	_, session, id, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	if session.CancelledAt != nil {
+		ctx.JSON(http.StatusGone, gin.H{"error": "Session was cancelled."})
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"startsAt": input.StartsAt}}
+	if input.EndsAt != nil {
+		update["$set"].(bson.M)["endsAt"] = *input.EndsAt
+	} else {
+		update["$unset"] = bson.M{"endsAt": ""}
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	if _, err := db.Database("vidchat").Collection("sessions").UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reschedule session."})
+		return
+	}
+
+	ctx.MustGet("calendars").(*calendar.Syncer).Nudge(ctx, session.OwnerID)
+	ctx.JSON(http.StatusOK, gin.H{"startsAt": input.StartsAt, "endsAt": input.EndsAt})
+}
+
+// CancelSession calls a scheduled session off. It can no longer be joined,
+// and its calendar events are deleted on the next sync.
+func CancelSession(ctx *gin.Context) {
+	_, session, id, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	if session.CancelledAt != nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	now := time.Now()
+	db := ctx.MustGet("db").(*mongo.Client)
+	_, err := db.Database("vidchat").Collection("sessions").UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"cancelledAt": now, "endedAt": now}})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel session."})
+		return
+	}
+
+	ctx.MustGet("calendars").(*calendar.Syncer).Nudge(ctx, session.OwnerID)
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListUpcomingMeetings lists the signed-in user's meetings over the next 30
+// days: sessions they scheduled, and external calendar events carrying a
+// join link. Events for a session the user scheduled are listed once. With
+// ?onBehalfOf a delegate lists the meetings of the user they schedule for.
+func ListUpcomingMeetings(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	// Delegates see the meetings of whom they schedule for.
+	owner := claims.Subject
+	if principal := ctx.Query("onBehalfOf"); principal != "" {
+		if !schedulesFor(ctx, ctx.MustGet("db").(*mongo.Client), principal, claims.Subject) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Not a delegate of that user."})
+			return
+		}
+		owner = principal
+	}
+
+	now := time.Now()
+	from, to := now.Add(-time.Hour), now.Add(upcomingWindow)
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("sessions").Find(ctx, bson.M{
+		"ownerID":     owner,
+		"startsAt":    bson.M{"$gte": from, "$lte": to},
+		"cancelledAt": bson.M{"$exists": false},
+	})
+	var sessions []struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		interfaces.Session `bson:",inline"`
+	}
+	if err == nil {
+		err = cursor.All(ctx, &sessions)
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID.Hex())
+	}
+	var urls map[string]string
+	if err == nil {
+		urls, err = hashedURLs(ctx, db, ids)
+	}
+	var imported []calendar.Imported
+	if err == nil {
+		imported, err = ctx.MustGet("calendars").(*calendar.Syncer).Upcoming(ctx, owner, from, to)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load meetings."})
+		return
+	}
+
+	brands := ctx.MustGet("branding").(*branding.Store)
+	meetings := make([]gin.H, 0, len(sessions)+len(imported))
+	listed := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		url := urls[session.ID.Hex()]
+		listed[url] = true
+		meetings = append(meetings, gin.H{
+			"title":    session.Title,
+			"startsAt": *session.StartsAt,
+			"endsAt":   session.EndsAt,
+			"url":      url,
+			"joinUrl":  brands.Links(ctx, session.OrgID).Join(url),
+			"source":   "scheduled",
+		})
+	}
+	for _, event := range imported {
+		if listed[event.URL] {
+			continue
+		}
+		meetings = append(meetings, gin.H{
+			"title":    event.Title,
+			"startsAt": event.StartsAt,
+			"endsAt":   event.EndsAt,
+			"url":      event.URL,
+			"joinUrl":  event.JoinURL,
+			"source":   event.Provider,
+		})
+	}
+	sort.SliceStable(meetings, func(i, j int) bool {
+		return meetings[i]["startsAt"].(time.Time).Before(meetings[j]["startsAt"].(time.Time))
+	})
+	ctx.JSON(http.StatusOK, meetings)
+}
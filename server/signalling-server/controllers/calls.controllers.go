@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/calls"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListCalls returns the signed-in user's recent direct calls, or only the
+// ones they missed with ?missed=1.
+func ListCalls(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	ringer := ctx.MustGet("calls").(*calls.Ringer)
+
+	history, err := ringer.History(ctx, claims.Subject, ctx.Query("missed") == "1")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load calls."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"calls": history})
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetOrgConsent returns the notices an org's participants are shown
+// before joining.
+func GetOrgConsent(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	consent := interfaces.Consent{OrgID: ctx.Param("id"), Notices: []interfaces.ConsentItem{}}
+	err := db.Database("vidchat").Collection("consent").FindOne(ctx, bson.M{"_id": consent.OrgID}).Decode(&consent)
+	if err != nil && err != mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent."})
+		return
+	}
+	ctx.JSON(http.StatusOK, consent)
+}
+
+// UpdateOrgConsent replaces an org's notices. Acceptances of earlier
+// versions stay on record but no longer admit anyone.
+func UpdateOrgConsent(ctx *gin.Context) {
+	var consent interfaces.Consent
+	if err := ctx.ShouldBindJSON(&consent); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	consent.OrgID = ctx.Param("id")
+	consent.UpdatedAt = time.Now()
+	if consent.Notices == nil {
+		consent.Notices = []interfaces.ConsentItem{}
+	}
+	if err := consent.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	_, err := db.Database("vidchat").Collection("consent").ReplaceOne(ctx, bson.M{"_id": consent.OrgID}, consent, options.Replace().SetUpsert(true))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save consent."})
+		return
+	}
+	ctx.JSON(http.StatusOK, consent)
+}
+
+// ListConsentRecords returns an org's acceptance records, newest first,
+// optionally for one session (its hashed URL) or user, for audits.
+func ListConsentRecords(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	filter := bson.M{"orgID": ctx.Param("id")}
+	if url := ctx.Query("session"); url != "" {
+		var socket interfaces.Socket
+		if err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": url}).Decode(&socket); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+			return
+		}
+		filter["sessionID"] = socket.SessionID
+	}
+	if user := ctx.Query("userID"); user != "" {
+		filter["userID"] = user
+	}
+
+	cursor, err := db.Database("vidchat").Collection("consent_records").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "acceptedAt", Value: -1}}).SetLimit(1000))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent records."})
+		return
+	}
+	records := []interfaces.ConsentRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent records."})
+		return
+	}
+	ctx.JSON(http.StatusOK, records)
+}
+
+// consentFor returns the notices the org shows a caller, by where they
+// connect from. The region clients may pass to pick a media region is
+// ignored here, so a client cannot opt out of a regional notice.
+func consentFor(ctx *gin.Context, db *mongo.Client, orgID string) ([]interfaces.ConsentItem, string, string, error) {
+	geo := ctx.MustGet("geo").(*utils.GeoResolver)
+	region := geo.Region("", ctx.GetHeader("CF-IPCountry"), ctx.ClientIP())
+	country := geo.Country(ctx.GetHeader("CF-IPCountry"), ctx.ClientIP())
+	if orgID == "" {
+		return []interfaces.ConsentItem{}, region, country, nil
+	}
+
+	var consent interfaces.Consent
+	err := db.Database("vidchat").Collection("consent").FindOne(ctx, bson.M{"_id": orgID}).Decode(&consent)
+	if err == mongo.ErrNoDocuments {
+		return []interfaces.ConsentItem{}, region, country, nil
+	}
+	if err != nil {
+		return nil, region, country, err
+	}
+	return consent.For(region, country), region, country, nil
+}
+
+// missingConsent returns the required notices the user has not accepted,
+// in their current version, for the session.
+func missingConsent(ctx *gin.Context, db *mongo.Client, socket interfaces.Socket, userID string) ([]interfaces.ConsentItem, error) {
+	notices, _, _, err := consentFor(ctx, db, socket.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	missing := []interfaces.ConsentItem{}
+	for _, notice := range notices {
+		if !notice.Required {
+			continue
+		}
+		count, err := db.Database("vidchat").Collection("consent_records").CountDocuments(ctx, bson.M{
+			"sessionID": socket.SessionID,
+			"userID":    userID,
+			"noticeID":  notice.ID,
+			"version":   notice.Version,
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			missing = append(missing, notice)
+		}
+	}
+	return missing, nil
+}
+
+// AcceptConsent records the notices a participant accepted before joining
+// a session. Only notices the participant is shown, in their current
+// version, are recorded; it returns the required ones still missing.
+func AcceptConsent(ctx *gin.Context) {
+	var input struct {
+		UserID  string `json:"userID"`
+		Notices []struct {
+			ID      string `json:"id"`
+			Version int    `json:"version"`
+		} `json:"notices"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.UserID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "userID is required."})
+		return
+	}
+
+	socket, _, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	notices, region, country, err := consentFor(ctx, db, socket.OrgID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent."})
+		return
+	}
+
+	// Signed-in users accept as their account, which is who joins.
+	userID, account := input.UserID, ""
+	if claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request); err == nil && claims != nil {
+		userID, account = claims.Subject, claims.Subject
+	}
+	now := time.Now()
+	var records []interface{}
+	for _, accepted := range input.Notices {
+		for _, notice := range notices {
+			if notice.ID != accepted.ID || notice.Version != accepted.Version {
+				continue
+			}
+			records = append(records, interfaces.ConsentRecord{
+				ID:         primitive.NewObjectID().Hex(),
+				OrgID:      socket.OrgID,
+				SessionID:  socket.SessionID,
+				UserID:     userID,
+				Account:    account,
+				NoticeID:   notice.ID,
+				Kind:       notice.Kind,
+				Version:    notice.Version,
+				Region:     region,
+				Country:    country,
+				IP:         ctx.ClientIP(),
+				UserAgent:  ctx.Request.UserAgent(),
+				AcceptedAt: now,
+			})
+		}
+	}
+	if len(records) > 0 {
+		if _, err := db.Database("vidchat").Collection("consent_records").InsertMany(ctx, records); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not record consent."})
+			return
+		}
+	}
+
+	missing, err := missingConsent(ctx, db, socket, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"accepted": len(records), "missing": missing})
+}
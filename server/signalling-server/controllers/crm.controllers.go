@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/crm"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetOrgCRM returns the CRM an org records its external meetings in,
+// without its secrets.
+func GetOrgCRM(ctx *gin.Context) {
+	conn, err := ctx.MustGet("crm").(*crm.Sync).Connection(ctx, ctx.Param("id"))
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No CRM connected."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load the CRM."})
+		return
+	}
+	ctx.JSON(http.StatusOK, conn)
+}
+
+// UpdateOrgCRM connects an org's CRM, replacing any connected before. A
+// webhook's response carries the secret its calls are signed with when one
+// was generated.
+func UpdateOrgCRM(ctx *gin.Context) {
+	var conn crm.Connection
+	if err := ctx.ShouldBindJSON(&conn); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conn.OrgID = ctx.Param("id")
+
+	connected, err := ctx.MustGet("crm").(*crm.Sync).Connect(ctx, conn)
+	if err != nil {
+		if errors.Is(err, crm.ErrInvalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "placeholders": crm.Placeholders})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save the CRM."})
+		return
+	}
+	ctx.JSON(http.StatusOK, connected)
+}
+
+// DeleteOrgCRM disconnects an org's CRM.
+func DeleteOrgCRM(ctx *gin.Context) {
+	if err := ctx.MustGet("crm").(*crm.Sync).Disconnect(ctx, ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No CRM connected."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
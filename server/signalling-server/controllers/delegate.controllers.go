@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ListDelegates lists who may schedule meetings on the signed-in user's
+// behalf.
+func ListDelegates(ctx *gin.Context) {
+	listDelegates(ctx, "ownerID")
+}
+
+// ListPrincipals lists whose meetings the signed-in user may schedule.
+func ListPrincipals(ctx *gin.Context) {
+	listDelegates(ctx, "delegateID")
+}
+
+func listDelegates(ctx *gin.Context, field string) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("delegates").Find(ctx, bson.M{field: claims.Subject})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load delegates."})
+		return
+	}
+	delegates := []interfaces.Delegate{}
+	if err := cursor.All(ctx, &delegates); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load delegates."})
+		return
+	}
+	ctx.JSON(http.StatusOK, delegates)
+}
+
+// GrantDelegate lets another user schedule meetings on the signed-in
+// user's behalf. Users in an org can only pick delegates in the same org.
+func GrantDelegate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	var input struct {
+		UserID string `json:"userID"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil || input.UserID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "userID is required."})
+		return
+	}
+	if input.UserID == claims.Subject {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Users cannot be their own delegate."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	id, err := primitive.ObjectIDFromHex(input.UserID)
+	var delegate struct {
+		OrgID         string     `bson:"orgID"`
+		Kind          string     `bson:"kind"`
+		DeactivatedAt *time.Time `bson:"deactivatedAt"`
+	}
+	if err == nil {
+		err = db.Database("vidchat").Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&delegate)
+	}
+	if err != nil || delegate.Kind == "device" || delegate.DeactivatedAt != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found."})
+		return
+	}
+	if org := userOrg(ctx, db, claims.Subject); org != "" && delegate.OrgID != org {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Delegates must be in your organization."})
+		return
+	}
+
+	grant := interfaces.Delegate{
+		ID:         primitive.NewObjectID().Hex(),
+		OwnerID:    claims.Subject,
+		DelegateID: input.UserID,
+		CreatedAt:  time.Now(),
+	}
+	_, err = db.Database("vidchat").Collection("delegates").InsertOne(ctx, grant)
+	if mongo.IsDuplicateKeyError(err) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User is already a delegate."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not add delegate."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, grant)
+}
+
+// RevokeDelegate stops a user scheduling on the signed-in user's behalf.
+// Meetings they already scheduled stay as they are.
+func RevokeDelegate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	result, err := db.Database("vidchat").Collection("delegates").DeleteOne(ctx, bson.M{"ownerID": claims.Subject, "delegateID": ctx.Param("user")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove delegate."})
+		return
+	}
+	if result.DeletedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Delegate not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// isDelegate reports whether user may schedule meetings for owner.
+func isDelegate(ctx *gin.Context, db *mongo.Client, owner, user string) bool {
+	if owner == "" || user == "" {
+		return false
+	}
+	count, err := db.Database("vidchat").Collection("delegates").CountDocuments(ctx, bson.M{"ownerID": owner, "delegateID": user})
+	return err == nil && count > 0
+}
+
+// schedulesFor reports whether user may schedule the owner's meetings: they
+// are the owner, or one of the owner's delegates.
+func schedulesFor(ctx *gin.Context, db *mongo.Client, owner, user string) bool {
+	return owner != "" && (owner == user || isDelegate(ctx, db, owner, user))
+}
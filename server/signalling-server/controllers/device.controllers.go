@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// deviceLookahead and deviceLookbehind bound the meetings listed on a
+	// device's calendar around now.
+	deviceLookahead  = 24 * time.Hour
+	deviceLookbehind = 12 * time.Hour
+)
+
+// validDevices checks that every device booked for a new session is an
+// active device account, of the session's org when it has one, writing the
+// error response when not. Only signed-in hosts may book devices.
+func validDevices(ctx *gin.Context, session interfaces.Session) bool {
+	if session.OwnerID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Sign in to book room devices."})
+		return false
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(session.Devices))
+	for _, device := range session.Devices {
+		id, err := primitive.ObjectIDFromHex(device)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown device " + device + "."})
+			return false
+		}
+		ids = append(ids, id)
+	}
+
+	filter := bson.M{
+		"_id":           bson.M{"$in": ids},
+		"kind":          auth.RoleDevice,
+		"deactivatedAt": bson.M{"$exists": false},
+	}
+	if session.OrgID != "" {
+		filter["orgID"] = session.OrgID
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	count, err := db.Database("vidchat").Collection("users").CountDocuments(ctx, filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check devices."})
+		return false
+	}
+	if int(count) != len(ids) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Devices must be active room devices of the session's org."})
+		return false
+	}
+	return true
+}
+
+// GetDeviceMeetings lists the meetings a room device is booked for: ones
+// starting in the next day, started in the last twelve hours or not
+// scheduled at all, soonest first. Each comes with an invite the device
+// passes to /connect when the meeting starts, so it can join unattended.
+func GetDeviceMeetings(ctx *gin.Context) {
+	claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+	if err != nil || claims == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized."})
+		return
+	}
+	if !claims.Device() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only room devices have a meeting calendar."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	now := time.Now()
+	cursor, err := db.Database("vidchat").Collection("sessions").Find(ctx, bson.M{
+		"devices": claims.Subject,
+		"endedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"startsAt": bson.M{"$exists": false}},
+			{"startsAt": bson.M{"$gte": now.Add(-deviceLookbehind), "$lte": now.Add(deviceLookahead)}},
+		},
+	}, options.Find().SetSort(bson.D{{Key: "startsAt", Value: 1}}))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load meetings."})
+		return
+	}
+	var sessions []struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		interfaces.Session `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load meetings."})
+		return
+	}
+
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID.Hex())
+	}
+	var sockets []interfaces.Socket
+	cursor, err = db.Database("vidchat").Collection("sockets").Find(ctx, bson.M{"sessionID": bson.M{"$in": ids}})
+	if err == nil {
+		err = cursor.All(ctx, &sockets)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load meetings."})
+		return
+	}
+	urls := make(map[string]string, len(sockets))
+	for _, socket := range sockets {
+		urls[socket.SessionID] = socket.HashedURL
+	}
+
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	meetings := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		url, ok := urls[session.ID.Hex()]
+		if !ok {
+			continue
+		}
+		signed := signer.Sign(invitePath(url), "device:"+claims.Name, deviceInviteTTL)
+		_, query, _ := strings.Cut(signed, "?")
+		meetings = append(meetings, gin.H{
+			"url":      url,
+			"title":    session.Title,
+			"startsAt": session.StartsAt,
+			"token":    query,
+		})
+	}
+	ctx.JSON(http.StatusOK, meetings)
+}
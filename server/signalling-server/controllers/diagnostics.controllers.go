@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListDiagnostics lists the diagnostics bundles uploaded in a session,
+// newest first, optionally for one participant. Logs and stats are left
+// out; GetDiagnostics returns a whole bundle.
+func ListDiagnostics(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var socket interfaces.Socket
+	if err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": ctx.Param("url")}).Decode(&socket); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return
+	}
+
+	filter := bson.M{"sessionID": socket.SessionID}
+	if participant := ctx.Query("participantID"); participant != "" {
+		filter["participantID"] = participant
+	}
+	cursor, err := db.Database("vidchat").Collection("diagnostics").Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+			SetLimit(200).
+			SetProjection(bson.M{"logs": 0, "stats": 0}))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load diagnostics."})
+		return
+	}
+	bundles := []interfaces.DiagnosticsBundle{}
+	if err := cursor.All(ctx, &bundles); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load diagnostics."})
+		return
+	}
+	ctx.JSON(http.StatusOK, bundles)
+}
+
+// GetDiagnostics returns a diagnostics bundle with its logs and stats, and
+// the preflight report it refers to.
+func GetDiagnostics(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var bundle interfaces.DiagnosticsBundle
+	if err := db.Database("vidchat").Collection("diagnostics").FindOne(ctx, bson.M{"_id": ctx.Param("id")}).Decode(&bundle); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Diagnostics not found."})
+		return
+	}
+
+	var preflight *interfaces.PreflightReport
+	if bundle.PreflightID != "" {
+		var report interfaces.PreflightReport
+		if db.Database("vidchat").Collection("preflight").FindOne(ctx, bson.M{"_id": bundle.PreflightID}).Decode(&report) == nil {
+			preflight = &report
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"bundle": bundle, "preflight": preflight})
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/domains"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hostOrg returns the org whose verified domain the request was made to,
+// or "" for the deployment's own hosts.
+func hostOrg(ctx *gin.Context) string {
+	return ctx.MustGet("domains").(*domains.Registry).Org(ctx, ctx.Request.Host)
+}
+
+// domainView adds the DNS record proving ownership to a domain.
+func domainView(domain interfaces.Domain) gin.H {
+	name, value := domains.Record(domain)
+	return gin.H{
+		"name":       domain.Name,
+		"orgID":      domain.OrgID,
+		"createdAt":  domain.CreatedAt,
+		"verifiedAt": domain.VerifiedAt,
+		"record":     gin.H{"type": "TXT", "name": name, "value": value},
+	}
+}
+
+func ListOrgDomains(ctx *gin.Context) {
+	list, err := ctx.MustGet("domains").(*domains.Registry).List(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load domains."})
+		return
+	}
+	views := make([]gin.H, 0, len(list))
+	for _, domain := range list {
+		views = append(views, domainView(domain))
+	}
+	ctx.JSON(http.StatusOK, views)
+}
+
+// AddOrgDomain registers a domain for the org. It is not used until the
+// TXT record in the response is published and the domain verified.
+func AddOrgDomain(ctx *gin.Context) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := ctx.MustGet("domains").(*domains.Registry).Add(ctx, ctx.Param("id"), input.Name)
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusCreated, domainView(domain))
+	case domains.ErrInvalid:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain name."})
+	case domains.ErrTaken:
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Domain is registered to another organization."})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not register domain."})
+	}
+}
+
+// VerifyOrgDomain checks the domain's TXT record. Once verified, requests
+// to the domain are routed to the org and it gets a certificate on first
+// use.
+func VerifyOrgDomain(ctx *gin.Context) {
+	domain, err := ctx.MustGet("domains").(*domains.Registry).Verify(ctx, ctx.Param("id"), ctx.Param("domain"))
+	switch err {
+	case nil:
+		ctx.MustGet("branding").(*branding.Store).Forget(domain.OrgID)
+		ctx.JSON(http.StatusOK, domainView(domain))
+	case domains.ErrNotFound:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Domain not found."})
+	case domains.ErrUnverified:
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Verification record not found.", "domain": domainView(domain)})
+	default:
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not look up the verification record."})
+	}
+}
+
+func DeleteOrgDomain(ctx *gin.Context) {
+	err := ctx.MustGet("domains").(*domains.Registry).Remove(ctx, ctx.Param("id"), ctx.Param("domain"))
+	switch err {
+	case nil:
+		ctx.MustGet("branding").(*branding.Store).Forget(ctx.Param("id"))
+		ctx.Status(http.StatusNoContent)
+	case domains.ErrNotFound:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Domain not found."})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove domain."})
+	}
+}
+
+// GetDomain tells a client served from an org's domain which org it
+// belongs to, and how to brand itself.
+func GetDomain(ctx *gin.Context) {
+	org := hostOrg(ctx)
+	if org == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not an organization domain."})
+		return
+	}
+	ctx.JSON(http.StatusOK, publicBranding(ctx.MustGet("branding").(*branding.Store).Get(ctx, org)))
+}
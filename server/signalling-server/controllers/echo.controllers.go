@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EchoTestLength is how long an echo test runs unless stopped sooner.
+const EchoTestLength = 2 * time.Minute
+
+// StartEchoTest starts an echo test: a room of its own on a media node of
+// the nearest region that sends the user's media back to them, so they can
+// check their camera, microphone and connection before a meeting.
+func StartEchoTest(ctx *gin.Context) {
+	now := time.Now()
+	test := interfaces.EchoTest{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    ctx.Query("userID"),
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(EchoTestLength),
+	}
+	test.Room = "echo-" + test.ID
+	test.Identity = test.UserID
+	if test.Identity == "" {
+		test.Identity = test.Room
+	}
+
+	geo := ctx.MustGet("geo").(*utils.GeoResolver)
+	topology := ctx.MustGet("topology").(*media.Topology)
+	hint := geo.Region(ctx.Query("region"), ctx.GetHeader("CF-IPCountry"), ctx.ClientIP())
+	region := topology.SelectRegion(parseRTTs(ctx.Query("rtt")), hint)
+	node, ok := topology.EchoNode(test.Room, region)
+	if !ok {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "No media node can run an echo test."})
+		return
+	}
+	if err := topology.Echo(ctx, node, test.Room, test.Identity, true); err != nil {
+		log.Printf("Error starting echo test on %s: %s", node.ID, err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not start echo test."})
+		return
+	}
+	test.NodeID, test.NodeURL, test.Region = node.ID, node.URL, node.Region
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	if _, err := db.Database("vidchat").Collection("echo_tests").InsertOne(ctx, test); err != nil {
+		topology.Echo(ctx, node, test.Room, test.Identity, false)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start echo test."})
+		return
+	}
+
+	ice := ctx.MustGet("ice").(*media.ICE)
+	ctx.JSON(http.StatusCreated, gin.H{
+		"id":                 test.ID,
+		"room":               test.Room,
+		"identity":           test.Identity,
+		"sfu":                node,
+		"iceServers":         ice.Servers(turn.User(test.Room, test.Identity)),
+		"iceTransportPolicy": "all",
+		"expiresAt":          test.ExpiresAt,
+	})
+}
+
+// StopEchoTest ends an echo test, keeping what the media node measured
+// alongside what the client reports it heard and saw, and returns both.
+func StopEchoTest(ctx *gin.Context) {
+	var report interfaces.EchoReport
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&report); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("echo_tests")
+	var test interfaces.EchoTest
+	if err := collection.FindOne(ctx, bson.M{"_id": ctx.Param("id"), "stoppedAt": bson.M{"$exists": false}}).Decode(&test); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Echo test not found or already stopped."})
+		return
+	}
+
+	topology := ctx.MustGet("topology").(*media.Topology)
+	stats := topology.EndEchoTest(ctx, test)
+	now := time.Now()
+	set := bson.M{"stoppedAt": now, "reported": report}
+	if stats != nil {
+		set["stats"] = stats
+	}
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": test.ID, "stoppedAt": bson.M{"$exists": false}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&test)
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Echo test not found or already stopped."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save echo test."})
+		return
+	}
+	ctx.JSON(http.StatusOK, test)
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultEmbedTTL = time.Hour
+	maxEmbedTTL     = 24 * time.Hour
+
+	// embedSocketTTL is how long a holder can keep reconnecting to the
+	// embed socket they joined with, outliving the token for long meetings.
+	embedSocketTTL = 24 * time.Hour
+)
+
+// EmbedAction mints a token admitting one of the key user's end users to
+// one of their meetings, for products embedding it in their own pages.
+// The token fixes the holder's name and role and the features they cannot
+// use; it expires after the requested ttl, an hour by default and at most
+// a day. Only the session's owner may mint them.
+func EmbedAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		interfaces.EmbedGrant
+		TTL string `json:"ttl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	grant := input.EmbedGrant
+	if err := grant.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := defaultEmbedTTL
+	if input.TTL != "" {
+		parsed, err := time.ParseDuration(input.TTL)
+		if err != nil || parsed <= 0 || parsed > maxEmbedTTL {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Embed ttl must be a duration of at most 24h."})
+			return
+		}
+		ttl = parsed
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID != key.OwnerID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can embed it."})
+		return
+	}
+
+	viewer, _ := json.Marshal(grant)
+	token := ctx.MustGet("signer").(*utils.URLSigner).Token(interfaces.EmbedPath(socket.HashedURL), string(viewer), ttl)
+
+	join := ctx.MustGet("branding").(*branding.Store).Links(ctx, socket.OrgID).Join(socket.HashedURL)
+	separator := "?"
+	if strings.Contains(join, "?") {
+		separator = "&"
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"grant":     grant,
+		"expiresAt": time.Now().Add(ttl),
+		"token":     token,
+		"url":       join + separator + "embed=" + token,
+	})
+}
+
+// embedGrant returns the grant of the request's embed query parameter, if
+// it carries a valid token to the socket's room.
+func embedGrant(ctx *gin.Context, socket interfaces.Socket) (*interfaces.EmbedGrant, bool) {
+	viewer, ok := ctx.MustGet("signer").(*utils.URLSigner).VerifyToken(interfaces.EmbedPath(socket.HashedURL), ctx.Query("embed"))
+	if !ok {
+		return nil, false
+	}
+	var grant interfaces.EmbedGrant
+	if json.Unmarshal([]byte(viewer), &grant) != nil {
+		return nil, false
+	}
+	return &grant, true
+}
+
+// embedUserID is the user ID the holder of an embed token joins as. It is
+// derived from the token, so they keep it across joins and cannot pick
+// another participant's.
+func embedUserID(ctx *gin.Context) string {
+	sum := sha256.Sum256([]byte(ctx.Query("embed")))
+	return interfaces.EmbedSocketPrefix + hex.EncodeToString(sum[:10])
+}
+
+// issueEmbedSocket stores an embed socket binding the grant and user ID to
+// the socket's room, returning the socket parameter the holder connects
+// with.
+func issueEmbedSocket(ctx *gin.Context, db *mongo.Client, socket interfaces.Socket, userID string, grant *interfaces.EmbedGrant) (string, error) {
+	random := make([]byte, 20)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	embed := interfaces.EmbedSocket{
+		ID:        hex.EncodeToString(random),
+		Socket:    socket.SocketURL,
+		UserID:    userID,
+		Grant:     *grant,
+		ExpiresAt: time.Now().Add(embedSocketTTL),
+	}
+	if _, err := db.Database("vidchat").Collection("embed_sockets").InsertOne(ctx, embed); err != nil {
+		return "", err
+	}
+	return interfaces.EmbedSocketPrefix + embed.ID, nil
+}
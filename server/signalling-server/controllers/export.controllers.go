@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/export"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const exportLinkTTL = time.Hour
+
+// GetExport returns the state of the user's latest data export, starting a
+// new one when there is none in progress or still downloadable. Clients poll
+// it until the export is ready and then follow the signed download link.
+func GetExport(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	if claims.Impersonator != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating."})
+		return
+	}
+	if id := ctx.Param("id"); id != "me" && id != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You can only export your own data."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("exports")
+
+	var latest interfaces.Export
+	err := collection.FindOne(ctx, bson.M{"userID": claims.Subject},
+		options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})).Decode(&latest)
+	if err != nil && err != mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load export."})
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil && latest.Status == interfaces.ExportPending && now.Sub(latest.CreatedAt) < export.StaleAfter:
+		ctx.JSON(http.StatusAccepted, latest)
+		return
+	case err == nil && latest.Status == interfaces.ExportReady && now.Before(latest.ExpiresAt) && ctx.Query("refresh") == "":
+		signer := ctx.MustGet("signer").(*utils.URLSigner)
+		ctx.JSON(http.StatusOK, gin.H{
+			"export":       latest,
+			"url":          signer.Sign("/exports/"+latest.ID+"/download", claims.Subject, exportLinkTTL),
+			"urlExpiresAt": now.Add(exportLinkTTL),
+		})
+		return
+	}
+
+	started := interfaces.Export{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    claims.Subject,
+		Status:    interfaces.ExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(export.StaleAfter),
+	}
+	if _, err := collection.InsertOne(ctx, started); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start export."})
+		return
+	}
+	go ctx.MustGet("exports").(*export.Exporter).Run(started)
+
+	ctx.JSON(http.StatusAccepted, started)
+}
+
+// DownloadExport serves a ready archive to the holder of a signed link.
+func DownloadExport(ctx *gin.Context) {
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	if !signer.Verify(ctx.Request.URL.Path, ctx.Request.URL.Query()) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Link is invalid or has expired."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	var ready interfaces.Export
+	err := db.Database("vidchat").Collection("exports").FindOne(ctx, bson.M{
+		"_id":       ctx.Param("id"),
+		"userID":    ctx.Query("viewer"),
+		"status":    interfaces.ExportReady,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&ready)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Export not found."})
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="export.zip"`)
+	serveBlob(ctx, ready.Key, nil)
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxFeeds caps the pending and active feeds of a session, so integrators
+// cannot flood its hosts with requests.
+const maxFeeds = 5
+
+// feedSocketTTL is how long the signed URL of a feed's WebSocket stays
+// valid; integrators look the feed up again for a fresh one.
+const feedSocketTTL = 24 * time.Hour
+
+// RequestFeedAction asks the hosts of a meeting to stream its events to
+// the key's integration. Nothing is streamed until a host approves it. The
+// response carries the secret calls to targetUrl are signed with.
+func RequestFeedAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name      string   `json:"name"`
+		TargetURL string   `json:"targetUrl"`
+		Events    []string `json:"events"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Hosts decide on the feed by its name.
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || utf8.RuneCountInString(input.Name) > 80 || strings.ContainsAny(input.Name, "\r\n") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Name must be a single line of at most 80 characters."})
+		return
+	}
+	if input.TargetURL != "" && !httpURL(input.TargetURL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "targetUrl must be an http(s) URL."})
+		return
+	}
+	for _, event := range input.Events {
+		if !interfaces.ValidFeedEvent(event) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event.", "events": interfaces.FeedEvents})
+			return
+		}
+	}
+
+	socket, _, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("feeds")
+	count, err := collection.CountDocuments(ctx, bson.M{
+		"sessionID": socket.SessionID,
+		"status":    bson.M{"$in": bson.A{interfaces.FeedPending, interfaces.FeedActive}},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request the feed."})
+		return
+	}
+	if count >= maxFeeds {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "This session has too many feeds."})
+		return
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request the feed."})
+		return
+	}
+	feed := interfaces.Feed{
+		ID:        primitive.NewObjectID(),
+		SessionID: socket.SessionID,
+		Socket:    socket.SocketURL,
+		OwnerID:   key.OwnerID,
+		Name:      input.Name,
+		TargetURL: input.TargetURL,
+		Secret:    hex.EncodeToString(random),
+		Events:    input.Events,
+		Status:    interfaces.FeedPending,
+		CreatedAt: time.Now(),
+	}
+	if _, err := collection.InsertOne(ctx, feed); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request the feed."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, feedResponse(ctx, feed))
+}
+
+// GetFeedAction returns one of the key's feeds, with a fresh URL of its
+// WebSocket.
+func GetFeedAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	var feed interfaces.Feed
+	if err == nil {
+		err = ctx.MustGet("db").(*mongo.Client).Database("vidchat").Collection("feeds").FindOne(ctx, bson.M{"_id": id, "ownerID": key.OwnerID}).Decode(&feed)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Feed not found."})
+		return
+	}
+	feed.Secret = ""
+	ctx.JSON(http.StatusOK, feedResponse(ctx, feed))
+}
+
+// StopFeedAction stops one of the key's feeds, or withdraws its request.
+func StopFeedAction(ctx *gin.Context) {
+	key, ok := requireAPIKey(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil || !stopFeed(ctx, bson.M{"_id": id, "ownerID": key.OwnerID}) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Feed not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListSessionFeeds lists the feeds integrators requested of a session,
+// newest first.
+func ListSessionFeeds(ctx *gin.Context) {
+	socket, _, _, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	cursor, err := ctx.MustGet("db").(*mongo.Client).Database("vidchat").Collection("feeds").Find(ctx,
+		bson.M{"sessionID": socket.SessionID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	feeds := []interfaces.Feed{}
+	if err == nil {
+		err = cursor.All(ctx, &feeds)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load feeds."})
+		return
+	}
+	for i := range feeds {
+		feeds[i].Secret = ""
+	}
+	ctx.JSON(http.StatusOK, feeds)
+}
+
+// ApproveSessionFeed starts a pending feed of a session, on behalf of its
+// hosts.
+func ApproveSessionFeed(ctx *gin.Context) {
+	decideFeed(ctx, interfaces.FeedActive)
+}
+
+// DenySessionFeed refuses a pending feed of a session.
+func DenySessionFeed(ctx *gin.Context) {
+	decideFeed(ctx, interfaces.FeedDenied)
+}
+
+func decideFeed(ctx *gin.Context, status string) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, _, _, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	var result *mongo.UpdateResult
+	if err == nil {
+		result, err = ctx.MustGet("db").(*mongo.Client).Database("vidchat").Collection("feeds").UpdateOne(ctx,
+			bson.M{"_id": id, "sessionID": socket.SessionID, "status": interfaces.FeedPending},
+			bson.M{"$set": bson.M{"status": status, "decidedBy": claims.Subject, "decidedAt": time.Now()}})
+	}
+	if err != nil || result.MatchedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No such pending feed."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// StopSessionFeed stops a feed of a session, or refuses it if pending.
+func StopSessionFeed(ctx *gin.Context) {
+	socket, _, _, ok := ownedSession(ctx)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil || !stopFeed(ctx, bson.M{"_id": id, "sessionID": socket.SessionID}) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Feed not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// stopFeed stops the pending or active feed matching filter. The node
+// running it notices within seconds.
+func stopFeed(ctx *gin.Context, filter bson.M) bool {
+	filter["status"] = bson.M{"$in": bson.A{interfaces.FeedPending, interfaces.FeedActive}}
+	result, err := ctx.MustGet("db").(*mongo.Client).Database("vidchat").Collection("feeds").UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"status": interfaces.FeedStopped, "stoppedAt": time.Now()}})
+	return err == nil && result.MatchedCount > 0
+}
+
+// feedResponse is the feed with, until it stops, the signed URL of its
+// WebSocket on the node its room is placed on. The WebSocket can be opened
+// while the feed waits for a host, and carries events once approved.
+func feedResponse(ctx *gin.Context, feed interfaces.Feed) gin.H {
+	response := gin.H{"feed": feed}
+	if feed.Status == interfaces.FeedPending || feed.Status == interfaces.FeedActive {
+		node := ctx.MustGet("placement").(*placement.Ring).Owner(feed.Socket).URL
+		signer := ctx.MustGet("signer").(*utils.URLSigner)
+		response["socketUrl"] = node + signer.Sign(interfaces.FeedSocketPath(feed.ID.Hex()), "feed", feedSocketTTL)
+	}
+	return response
+}
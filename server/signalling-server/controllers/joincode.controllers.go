@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	joinCodeDigits = 6
+	joinCodeTTL    = 5 * time.Minute
+	// deviceInviteTTL bounds how long a device that redeemed a code can keep
+	// reconnecting to the session.
+	deviceInviteTTL = 12 * time.Hour
+)
+
+// CreateJoinCode issues a short single-use code for the session that a
+// conference-room device can enter instead of the URL and password. Only the
+// session's owner may create codes; each expires after a few minutes.
+func CreateJoinCode(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can create join codes."})
+		return
+	}
+	if session.EndedAt != nil {
+		ctx.JSON(http.StatusGone, gin.H{"error": "Session has ended."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("join_codes")
+
+	now := time.Now()
+	for attempt := 0; attempt < 5; attempt++ {
+		code := interfaces.JoinCode{
+			Code:      utils.NumericCode(joinCodeDigits),
+			HashedURL: socket.HashedURL,
+			CreatedBy: claims.Subject,
+			CreatedAt: now,
+			ExpiresAt: now.Add(joinCodeTTL),
+		}
+		// A clash with a live code just retries with a new one.
+		_, err := collection.InsertOne(ctx, code)
+		if err == nil {
+			ctx.JSON(http.StatusOK, code)
+			return
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create join code."})
+}
+
+// RedeemJoinCode exchanges a join code for the session's URL and an invite
+// the device passes to /connect. The code is consumed whether or not the
+// device goes on to join.
+func RedeemJoinCode(ctx *gin.Context) {
+	var input struct {
+		Code   string `json:"code"`
+		Device string `json:"device"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Code = strings.TrimSpace(input.Code)
+	if input.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Code is required."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("join_codes")
+
+	// Deleting on read makes the code single-use even if two devices enter
+	// it at once. The TTL index removes expired codes lazily, so expiry is
+	// checked here too.
+	var code interfaces.JoinCode
+	err := collection.FindOneAndDelete(ctx, bson.M{
+		"_id":       input.Code,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&code)
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired code."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not redeem code."})
+		return
+	}
+
+	device := strings.TrimSpace(input.Device)
+	if device == "" {
+		device = "room device"
+	}
+	signed := ctx.MustGet("signer").(*utils.URLSigner).Sign(invitePath(code.HashedURL), "device:"+device, deviceInviteTTL)
+	_, query, _ := strings.Cut(signed, "?")
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"url":       code.HashedURL,
+		"token":     query,
+		"expiresAt": time.Now().Add(deviceInviteTTL),
+	})
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetShortLink returns the session's short join link, creating it on first use.
+func GetShortLink(ctx *gin.Context) {
+	link, links, ok := shortLink(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"url": links.Short(link.Code), "link": link})
+}
+
+// GetSessionQR renders the short join link as a QR code, as a PNG or, with
+// format=svg, an SVG.
+func GetSessionQR(ctx *gin.Context) {
+	link, links, ok := shortLink(ctx)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "256"))
+	if err != nil || size < 64 || size > 2048 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size."})
+		return
+	}
+
+	code, err := qr.Encode(links.Short(link.Code)+"?s=qr", qr.M, qr.Auto)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not encode QR code."})
+		return
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=86400")
+	if ctx.Query("format") == "svg" {
+		ctx.Data(http.StatusOK, "image/svg+xml", qrSVG(code, size))
+		return
+	}
+
+	scaled, err := barcode.Scale(code, size, size)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not encode QR code."})
+		return
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, scaled)
+	ctx.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// FollowShortLink redirects a short link to the join page, counting the
+// click against its source. On an org's domain only the org's links are
+// followed.
+func FollowShortLink(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("short_links")
+
+	source := "link"
+	if ctx.Query("s") == "qr" {
+		source = "qr"
+	}
+
+	var link interfaces.ShortLink
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": ctx.Param("code")},
+		bson.M{"$inc": bson.M{"clicks." + source: 1}, "$set": bson.M{"lastClickedAt": time.Now()}},
+	).Decode(&link)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Link not found."})
+		return
+	}
+
+	var socket interfaces.Socket
+	db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": link.HashedURL}).Decode(&socket)
+	if org := hostOrg(ctx); org != "" && org != socket.OrgID {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Link not found."})
+		return
+	}
+	links := ctx.MustGet("branding").(*branding.Store).Links(ctx, socket.OrgID)
+	ctx.Redirect(http.StatusFound, links.Join(link.HashedURL))
+}
+
+// shortLink returns the session's short link, creating it on first use, and
+// the links of the session's org.
+func shortLink(ctx *gin.Context) (interfaces.ShortLink, utils.Links, bool) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var link interfaces.ShortLink
+	var socket interfaces.Socket
+	hashedURL := ctx.Param("url")
+	err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": hashedURL}).Decode(&socket)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return link, utils.Links{}, false
+	}
+	links := ctx.MustGet("branding").(*branding.Store).Links(ctx, socket.OrgID)
+
+	collection := db.Database("vidchat").Collection("short_links")
+	for attempt := 0; attempt < 5; attempt++ {
+		// The unique index on hashedUrl makes concurrent first requests
+		// converge on one code; a clash on _id just retries with a new one.
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"hashedUrl": hashedURL},
+			bson.M{"$setOnInsert": bson.M{"_id": utils.ShortCode(7), "createdAt": time.Now()}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&link)
+		if err == nil {
+			return link, links, true
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create short link."})
+	return link, links, false
+}
+
+// qrSVG draws one rect per dark module, with a four module quiet zone.
+func qrSVG(code barcode.Barcode, size int) []byte {
+	bounds := code.Bounds()
+	modules := bounds.Dx() + 8
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := code.At(x, y).RGBA(); r == 0 {
+				fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="1" height="1"/>`, x-bounds.Min.X+4, y-bounds.Min.Y+4)
+			}
+		}
+	}
+	svg.WriteString(`</svg>`)
+	return svg.Bytes()
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ltiInviteTTL is how long the invite a launch hands out stays valid, and
+// with it the identity token joining with it gives.
+const ltiInviteTTL = 12 * time.Hour
+
+// ltiIdentity returns the identity token binding the learner a launch's
+// invite names to the socket's room, if the request carries such an
+// invite. The learner connects with it, so nobody else can join as them.
+func ltiIdentity(ctx *gin.Context, socket interfaces.Socket) (string, bool) {
+	viewer := ctx.Query("viewer")
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	if !lti.Reserved(viewer) || !signer.Verify(invitePath(socket.HashedURL), ctx.Request.URL.Query()) {
+		return "", false
+	}
+	return signer.Token(lti.IdentityPath(socket.SocketURL), viewer, ltiInviteTTL), true
+}
+
+// ltiTool returns the LTI tool, writing the error response when LTI is not
+// configured.
+func ltiTool(ctx *gin.Context) (*lti.Tool, bool) {
+	tool := ctx.MustGet("lti").(*lti.Tool)
+	if tool == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "LTI is not configured."})
+		return nil, false
+	}
+	return tool, true
+}
+
+// LTILogin answers a platform's third party login initiation, sending the
+// user on to the platform's login.
+func LTILogin(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	ctx.Request.ParseForm()
+	redirect, err := tool.Login(ctx, ctx.Request.Form)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login: " + err.Error() + "."})
+		return
+	}
+	ctx.Redirect(http.StatusFound, redirect)
+}
+
+// LTILaunch takes a resource link launch into the link's meeting, creating
+// the meeting on the link's first launch. Course meetings are invite only:
+// a launch, which proves the user is on the course roster, is what hands
+// out the invite. Instructors join as hosts.
+func LTILaunch(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	launch, err := tool.Launch(ctx, ctx.PostForm("id_token"), ctx.PostForm("state"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid launch: " + err.Error() + "."})
+		return
+	}
+
+	link, err := tool.Link(ctx, launch)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load the course meeting."})
+		return
+	}
+	if link == nil {
+		title := launch.ResourceLinkTitle
+		if title == "" {
+			title = launch.ContextTitle
+		}
+		// The platform's owner is named host so the first student to join
+		// is not made one; instructors are added as they enroll.
+		_, socket, _, ok := createSession(ctx, interfaces.Session{
+			Host:      lti.LinkID(launch),
+			Title:     title,
+			Access:    interfaces.AccessInvite,
+			OwnerID:   launch.Platform.OwnerID,
+			CreatorID: launch.Platform.OwnerID,
+			OrgID:     launch.Platform.OrgID,
+			Settings:  interfaces.SessionSettings{Hosts: []string{launch.Platform.OwnerID}},
+		})
+		if !ok {
+			return
+		}
+		saved, err := tool.SaveLink(ctx, launch, socket.SessionID, socket.HashedURL)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save the course meeting."})
+			return
+		}
+		link = &saved
+	}
+	if err := tool.Enroll(ctx, launch, *link); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enroll in the course meeting."})
+		return
+	}
+
+	userID := launch.UserID()
+	invite := signInvite(ctx, interfaces.Socket{HashedURL: link.HashedURL, OrgID: launch.Platform.OrgID}, userID, ltiInviteTTL)
+	join := invite["url"].(string) + "&" + url.Values{"userID": {userID}, "name": {launch.Name}}.Encode()
+	ctx.Redirect(http.StatusSeeOther, join)
+}
+
+// LTIKeySet publishes the tool's public key for platforms.
+func LTIKeySet(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, tool.KeySet())
+}
+
+// ListLTIPlatforms lists the platforms registered to launch the tool.
+func ListLTIPlatforms(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	platforms, err := tool.Platforms(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load platforms."})
+		return
+	}
+	ctx.JSON(http.StatusOK, platforms)
+}
+
+// RegisterLTIPlatform registers a platform with the details its admin gave
+// when adding the tool.
+func RegisterLTIPlatform(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	var platform lti.Platform
+	if err := ctx.ShouldBindJSON(&platform); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := platform.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid platform: " + err.Error() + "."})
+		return
+	}
+	platform, err := tool.Register(ctx, platform)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not register platform."})
+		return
+	}
+	ctx.JSON(http.StatusCreated, platform)
+}
+
+func UnregisterLTIPlatform(ctx *gin.Context) {
+	tool, ok := ltiTool(ctx)
+	if !ok {
+		return
+	}
+	err := tool.Unregister(ctx, ctx.Param("id"))
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Platform not found."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unregister platform."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
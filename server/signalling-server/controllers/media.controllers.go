@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMediaRegions lists one SFU per region for clients to probe before
+// connecting to a session.
+func GetMediaRegions(ctx *gin.Context) {
+	topology := ctx.MustGet("topology").(*media.Topology)
+	ctx.JSON(http.StatusOK, gin.H{"regions": topology.Regions()})
+}
+
+// placeParticipant assigns the caller to the SFU nearest to them, using the
+// "rtt" probe results and falling back to their GeoIP region.
+func placeParticipant(ctx *gin.Context, room string, identity string, settings interfaces.SessionSettings) (media.SFUNode, bool) {
+	topology := ctx.MustGet("topology").(*media.Topology)
+	geo := ctx.MustGet("geo").(*utils.GeoResolver)
+
+	hint := geo.Region(ctx.Query("region"), ctx.GetHeader("CF-IPCountry"), ctx.ClientIP())
+	region := topology.SelectRegion(parseRTTs(ctx.Query("rtt")), hint)
+	return topology.Join(room, identity, region, requiredCapabilities(settings))
+}
+
+// requiredCapabilities returns the capabilities the session's media nodes
+// need.
+func requiredCapabilities(settings interfaces.SessionSettings) []string {
+	required := append([]string{}, settings.Capabilities...)
+	if settings.AutoRecord {
+		for _, capability := range required {
+			if capability == media.CapabilityRecording {
+				return required
+			}
+		}
+		required = append(required, media.CapabilityRecording)
+	}
+	return required
+}
+
+// parseRTTs parses client probe results of the form "eu-west:35,us-east:120"
+// (milliseconds per region).
+func parseRTTs(query string) map[string]float64 {
+	rtts := make(map[string]float64)
+	for _, probe := range strings.Split(query, ",") {
+		parts := strings.SplitN(probe, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if rtt, err := strconv.ParseFloat(parts[1], 64); err == nil {
+			rtts[parts[0]] = rtt
+		}
+	}
+	return rtts
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/quota"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func GetOrganization(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("orgs")
+
+	var org interfaces.Organization
+	err := collection.FindOne(ctx, bson.M{"_id": ctx.Param("id")}).Decode(&org)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Organization not found."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization sets an org's plan, quota overrides, storage policy,
+// registration policy, admission hook and log retention. Setting
+// "unlimited" lifts its quotas entirely. Only the fields sent change; the
+// rest of the org, including fields other services keep in it, is left
+// alone.
+func UpdateOrganization(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("orgs")
+
+	body, err := ctx.GetRawData()
+	var org interfaces.Organization
+	var sent map[string]json.RawMessage
+	if err == nil {
+		if err = json.Unmarshal(body, &org); err == nil {
+			err = json.Unmarshal(body, &sent)
+		}
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	org.ID = ctx.Param("id")
+
+	switch org.Registration {
+	case "", "open", "invite":
+	case "domain":
+		if len(org.AllowedDomains) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Domain registration needs allowedDomains."})
+			return
+		}
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Registration must be open, invite or domain."})
+		return
+	}
+
+	if org.AuditRetentionDays < 0 || org.AccessRetentionDays < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Retention must be a number of days, or 0 to keep logs forever."})
+		return
+	}
+
+	switch org.StoragePolicy {
+	case "", quota.StorageBlock, quota.StorageDeleteOldest:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "storagePolicy must be block or delete_oldest."})
+		return
+	}
+	if org.MaxStorageBytes < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "maxStorageBytes cannot be negative."})
+		return
+	}
+
+	if org.AdmissionURL != "" {
+		if !httpURL(org.AdmissionURL) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "admissionURL must be an http(s) URL."})
+			return
+		}
+	}
+
+	fields := bson.M{
+		"plan":                org.Plan,
+		"maxMeetings":         org.MaxMeetings,
+		"maxParticipants":     org.MaxParticipants,
+		"unlimited":           org.Unlimited,
+		"maxStorageBytes":     org.MaxStorageBytes,
+		"storagePolicy":       org.StoragePolicy,
+		"registration":        org.Registration,
+		"allowedDomains":      org.AllowedDomains,
+		"admissionURL":        org.AdmissionURL,
+		"admissionSecret":     org.AdmissionSecret,
+		"relayOnly":           org.RelayOnly,
+		"auditRetentionDays":  org.AuditRetentionDays,
+		"accessRetentionDays": org.AccessRetentionDays,
+	}
+	set := bson.M{}
+	for field := range sent {
+		if value, ok := fields[field]; ok {
+			set[field] = value
+		}
+	}
+	if len(set) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update."})
+		return
+	}
+
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": org.ID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&org)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save organization."})
+		return
+	}
+
+	ctx.MustGet("quota").(*quota.Tracker).Forget(org.ID)
+	ctx.JSON(http.StatusOK, org)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/storage"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxPlaybackLinkTTL = 7 * 24 * time.Hour
+
+// CreatePlaybackLink lets a host share a ready recording through a signed
+// link that expires, instead of handing out storage access. Only the
+// session's owner and the users its settings make hosts may: knowing the
+// meeting's password is not enough.
+func CreatePlaybackLink(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	var input struct {
+		Viewer string `json:"viewer"`
+		TTL    string `json:"ttl"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if !sessionHost(session, claims.Subject) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner or hosts can share its recordings."})
+		return
+	}
+
+	ttl := 24 * time.Hour
+	if input.TTL != "" {
+		parsed, err := time.ParseDuration(input.TTL)
+		if err != nil || parsed <= 0 || parsed > maxPlaybackLinkTTL {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl."})
+			return
+		}
+		ttl = parsed
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	var recording interfaces.Recording
+	err := db.Database("vidchat").Collection("recordings").FindOne(ctx, bson.M{"_id": ctx.Param("id"), "sessionID": socket.SessionID}).Decode(&recording)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found."})
+		return
+	}
+	if recording.Status != interfaces.RecordingReady || recording.Output == "" {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Recording is not ready."})
+		return
+	}
+
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	base := "/recordings/" + recording.ID
+	highlights := make([]gin.H, 0, len(recording.Highlights))
+	for _, highlight := range recording.Highlights {
+		highlights = append(highlights, gin.H{
+			"id":          highlight.ID,
+			"reason":      highlight.Reason,
+			"title":       highlight.Title,
+			"startOffset": highlight.StartOffset,
+			"endOffset":   highlight.EndOffset,
+			"url":         signer.Sign(base+"/highlights/"+highlight.ID, input.Viewer, ttl),
+		})
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"url":        signer.Sign(base+"/play", input.Viewer, ttl),
+		"thumbnail":  signer.Sign(base+"/thumbnail", input.Viewer, ttl),
+		"highlights": highlights,
+		"expiresAt":  time.Now().Add(ttl),
+	})
+}
+
+// sessionHost reports whether the user owns the session or is one of the
+// hosts its settings name.
+func sessionHost(session interfaces.Session, userID string) bool {
+	if session.OwnerID != "" && session.OwnerID == userID {
+		return true
+	}
+	for _, host := range session.Settings.Hosts {
+		if host == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// PlayRecording streams a processed recording. Range requests are honoured
+// so players can seek; every view started is written to the audit log.
+func PlayRecording(ctx *gin.Context) {
+	recording, ok := signedRecording(ctx)
+	if !ok {
+		return
+	}
+
+	serveBlob(ctx, recording.Output, func() {
+		// Seeking issues further range requests; only the opening one is a view.
+		if rangeHeader := ctx.GetHeader("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+			auditView(ctx, recording)
+		}
+	})
+}
+
+func GetRecordingThumbnail(ctx *gin.Context) {
+	recording, ok := signedRecording(ctx)
+	if !ok {
+		return
+	}
+	if recording.Thumbnail == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found."})
+		return
+	}
+	serveBlob(ctx, recording.Thumbnail, nil)
+}
+
+// PlayHighlight streams a highlight clip of a processed recording. Views
+// are audited as views of the recording.
+func PlayHighlight(ctx *gin.Context) {
+	recording, ok := signedRecording(ctx)
+	if !ok {
+		return
+	}
+	for _, highlight := range recording.Highlights {
+		if highlight.ID == ctx.Param("clip") {
+			serveBlob(ctx, highlight.Output, func() {
+				if rangeHeader := ctx.GetHeader("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+					auditView(ctx, recording)
+				}
+			})
+			return
+		}
+	}
+	ctx.JSON(http.StatusNotFound, gin.H{"error": "Highlight not found."})
+}
+
+// serveBlob streams a stored object with Range support, calling opened once
+// the object is known to exist.
+func serveBlob(ctx *gin.Context, key string, opened func()) {
+	store := ctx.MustGet("storage").(storage.BlobStore)
+	object, err := storage.Open(ctx, store, key)
+	if err == storage.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found."})
+		return
+	}
+	if err != nil {
+		log.Printf("Playback: opening %s: %s", key, err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not read recording."})
+		return
+	}
+	defer object.Close()
+
+	if opened != nil {
+		opened()
+	}
+
+	if object.ContentType != "" {
+		ctx.Header("Content-Type", object.ContentType)
+	}
+	ctx.Header("Cache-Control", "private, no-store")
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(key), object.Modified, object)
+}
+
+func signedRecording(ctx *gin.Context) (interfaces.Recording, bool) {
+	var recording interfaces.Recording
+
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	if !signer.Verify(ctx.Request.URL.Path, ctx.Request.URL.Query()) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Link is invalid or has expired."})
+		return recording, false
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	err := db.Database("vidchat").Collection("recordings").FindOne(ctx, bson.M{"_id": ctx.Param("id"), "status": interfaces.RecordingReady}).Decode(&recording)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found."})
+		return recording, false
+	}
+	return recording, true
+}
+
+// auditView records a view in the recording access log. The org is kept
+// with it so the org's access log retention applies.
+func auditView(ctx *gin.Context, recording interfaces.Recording) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	var socket interfaces.Socket
+	db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"sessionID": recording.SessionID}).Decode(&socket)
+	_, err := db.Database("vidchat").Collection("recording_views").InsertOne(ctx, bson.M{
+		"recordingID": recording.ID,
+		"sessionID":   recording.SessionID,
+		"orgID":       socket.OrgID,
+		"viewer":      ctx.Query("viewer"),
+		"ip":          ctx.ClientIP(),
+		"userAgent":   ctx.Request.UserAgent(),
+		"viewedAt":    time.Now(),
+	})
+	if err != nil {
+		log.Printf("Playback: auditing view of %s: %s", recording.ID, err)
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxPreflightRTTs bounds the echo samples a client may submit.
+const maxPreflightRTTs = 100
+
+// StartPreflight hands a client what it needs to test its network before
+// joining: the ICE servers, the WebSocket echo probe and the STUN address of
+// the media node it would use. Passing the session URL and user ID attaches
+// the results to that participant.
+func StartPreflight(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	report := interfaces.PreflightReport{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    ctx.Query("userID"),
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		CreatedAt: time.Now(),
+	}
+
+	// A relay only session is tested over TURN, the way it will run.
+	relay := false
+	consent := []interfaces.ConsentItem{}
+	if url := ctx.Query("session"); url != "" {
+		var socket interfaces.Socket
+		if err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": url}).Decode(&socket); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+			return
+		}
+		report.SessionID = socket.SessionID
+
+		var session interfaces.Session
+		if id, err := primitive.ObjectIDFromHex(socket.SessionID); err == nil {
+			db.Database("vidchat").Collection("sessions").FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+		}
+		relay = relayOnly(ctx, db, session.Settings, socket.OrgID)
+
+		// The notices to accept before joining, shown alongside the checks.
+		var err error
+		if consent, _, _, err = consentFor(ctx, db, socket.OrgID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent."})
+			return
+		}
+	}
+
+	geo := ctx.MustGet("geo").(*utils.GeoResolver)
+	topology := ctx.MustGet("topology").(*media.Topology)
+	report.Region = topology.SelectRegion(nil, geo.Region(ctx.Query("region"), ctx.GetHeader("CF-IPCountry"), ctx.ClientIP()))
+
+	if _, err := db.Database("vidchat").Collection("preflight").InsertOne(ctx, report); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start preflight."})
+		return
+	}
+
+	var stun []string
+	for _, node := range topology.Nearest(nil, report.Region) {
+		if node.STUN != "" {
+			stun = append(stun, node.STUN)
+		}
+	}
+
+	ice := ctx.MustGet("ice").(*media.ICE)
+	servers, policy := ice.Servers(turn.User(report.SessionID, report.UserID)), "all"
+	if relay {
+		servers, policy, stun = ice.RelayServers(turn.User(report.SessionID, report.UserID)), "relay", nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":                 report.ID,
+		"iceServers":         servers,
+		"iceTransportPolicy": policy,
+		"echo":               "/preflight/ws",
+		"udp":                stun,
+		"region":             report.Region,
+		"consent":            consent,
+	})
+}
+
+// SubmitPreflight stores the results of a client's checks. Each preflight
+// takes one submission.
+func SubmitPreflight(ctx *gin.Context) {
+	var results interfaces.PreflightResult
+	if err := ctx.ShouldBindJSON(&results); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(results.SignallingRTT) > maxPreflightRTTs {
+		results.SignallingRTT = results.SignallingRTT[:maxPreflightRTTs]
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	now := time.Now()
+	result, err := db.Database("vidchat").Collection("preflight").UpdateOne(ctx,
+		bson.M{"_id": ctx.Param("id"), "submittedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"results": results, "submittedAt": now}})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save results."})
+		return
+	}
+	if result.MatchedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Preflight not found or already submitted."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetPreflightReports lists the preflight results of a session, newest
+// first, optionally for one participant.
+func GetPreflightReports(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var socket interfaces.Socket
+	if err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": ctx.Param("url")}).Decode(&socket); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return
+	}
+
+	filter := bson.M{"sessionID": socket.SessionID}
+	if userID := ctx.Query("userID"); userID != "" {
+		filter["userID"] = userID
+	}
+	cursor, err := db.Database("vidchat").Collection("preflight").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(200))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load preflight results."})
+		return
+	}
+	reports := []interfaces.PreflightReport{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load preflight results."})
+		return
+	}
+	ctx.JSON(http.StatusOK, reports)
+}
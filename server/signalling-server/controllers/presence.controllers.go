@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/presence"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetPresence(ctx *gin.Context) {
+	tracker := ctx.MustGet("presence").(*presence.Tracker)
+
+	status, err := tracker.Get(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read presence."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"userID": ctx.Param("id"), "status": status})
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/metering"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetQualityReport reports how a session's participants connected: the
+// candidate pair each connection settled on and how many went through TURN
+// or fell back to TCP, the TURN allocations it holds right now, and the
+// bytes each participant sent and received through the SFU.
+func GetQualityReport(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var socket interfaces.Socket
+	if err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": ctx.Param("url")}).Decode(&socket); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return
+	}
+
+	paths, summary, err := analytics.LoadPaths(ctx, db, socket.SocketURL)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load connection paths."})
+		return
+	}
+	allocations, err := ctx.MustGet("turn").(*turn.Monitor).Live(ctx, socket.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load TURN allocations."})
+		return
+	}
+	bandwidth, err := metering.SessionBandwidth(ctx, db, socket.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load bandwidth."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"paths": paths, "summary": summary, "turnAllocations": allocations, "bandwidth": bandwidth})
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/admission"
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/assets"
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/crm"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/quota"
+	"github.com/r3tr056/go-videoconf/signalling-server/rules"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type recordingInput struct {
+	Streams []string `json:"streams"`
+}
+
+// StartRecording composites the session into a recording, or into live
+// streams when RTMP URLs are given. Only the session's owner and hosts may
+// record, and only the owner may stream it elsewhere. Confidential
+// sessions are watermarked with the account details of whoever started
+// the egress.
+func StartRecording(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	var input recordingInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if !sessionHost(session, claims.Subject) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner or hosts can record it."})
+		return
+	}
+	if len(input.Streams) > 0 {
+		if session.OwnerID != claims.Subject {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can stream it."})
+			return
+		}
+		for _, stream := range input.Streams {
+			if !rtmpURL(stream) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Streams must be rtmp(s) URLs."})
+				return
+			}
+		}
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	name, email := accountDetails(ctx, db, claims.Subject)
+
+	recorder, ok := ctx.MustGet("media").(media.Recorder)
+	if !ok {
+		ctx.JSON(http.StatusNotImplemented, gin.H{"error": "Recording is not supported by this media backend."})
+		return
+	}
+
+	if rule := recordingRule(ctx, socket); rule != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Not allowed.", "rule": rule.Name, "reason": rule.Message})
+		return
+	}
+
+	if err := ctx.MustGet("storageQuota").(*quota.Storage).Admit(ctx, socket.OrgID); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Storage quota exceeded."})
+		return
+	}
+
+	decision, ok := admit(ctx, admission.Request{
+		Action:  admission.ActionRecord,
+		UserID:  claims.Subject,
+		Name:    name,
+		Session: socket.SessionID,
+		Room:    socket.HashedURL,
+		Org:     socket.OrgID,
+	})
+	if !ok {
+		return
+	}
+
+	options := media.RecordingOptions{Streams: input.Streams}
+	// The room's layout is known here from its last snapshot.
+	var snapshot interfaces.RoomSnapshot
+	db.Database("vidchat").Collection("room_snapshots").FindOne(ctx, bson.M{"_id": socket.SocketURL}).Decode(&snapshot)
+	if layout := snapshot.Layout; layout != nil {
+		options.Layout = &media.Layout{
+			Mode:   layout.Mode,
+			Pinned: snapshot.Identities(layout.Pinned),
+			Order:  snapshot.Identities(layout.Order),
+		}
+	}
+	if session.Watermark != nil {
+		options.Watermark = &media.Overlay{
+			Text:     media.RenderWatermark(session.Watermark.Text, name, email, session.Title),
+			Opacity:  session.Watermark.Opacity,
+			Position: session.Watermark.Position,
+		}
+	}
+	if decision.Modify.Watermark != "" {
+		if options.Watermark == nil {
+			options.Watermark = &media.Overlay{Opacity: 0.5}
+		}
+		options.Watermark.Text = decision.Modify.Watermark
+	}
+
+	started, err := recorder.StartRecording(ctx, socket.SessionID, options)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not start recording."})
+		return
+	}
+
+	recording := interfaces.Recording{
+		ID:        started.ID,
+		SessionID: socket.SessionID,
+		OrgID:     socket.OrgID,
+		Socket:    socket.SocketURL,
+		Backend:   started.Backend,
+		Status:    interfaces.RecordingActive,
+		Location:  started.Location,
+		Streams:   input.Streams,
+		StartedAt: time.Now(),
+	}
+	if options.Watermark != nil {
+		recording.Watermark = options.Watermark.Text
+	}
+
+	if _, err := db.Database("vidchat").Collection("recordings").InsertOne(ctx, recording); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save recording."})
+		return
+	}
+	ctx.MustGet("timeline").(*analytics.Timeline).Record(socket.SessionID, analytics.TimelineEvent{
+		Type: analytics.EventRecordingStart,
+		Data: map[string]interface{}{"recordingID": recording.ID, "streams": len(recording.Streams) > 0},
+	})
+	// Screens already shared are recorded from here on.
+	if len(recording.Streams) == 0 {
+		for _, sharing := range snapshot.Sharing {
+			ctx.MustGet("screens").(*assets.Screens).Start(ctx, socket.SessionID, sharing)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, recording)
+}
+
+// recordingRule checks a recording request against the org's rules. The
+// room is described from its last snapshot, so every participant the room
+// knows counts, connected or not.
+func recordingRule(ctx *gin.Context, socket interfaces.Socket) *interfaces.Rule {
+	if socket.OrgID == "" {
+		return nil
+	}
+	db := ctx.MustGet("db").(*mongo.Client)
+	claims, _ := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+
+	var snapshot interfaces.RoomSnapshot
+	db.Database("vidchat").Collection("room_snapshots").FindOne(ctx, bson.M{"_id": socket.SocketURL}).Decode(&snapshot)
+
+	vars := map[string]interface{}{
+		"user.id":           "",
+		"user.role":         "",
+		"user.guest":        claims == nil,
+		"room.participants": len(snapshot.Participants),
+		"room.host_present": false,
+		"recording.auto":    false,
+	}
+	if claims != nil {
+		vars["user.id"] = claims.Subject
+	}
+	for _, participant := range snapshot.Participants {
+		if claims != nil && participant.UserID == claims.Subject {
+			vars["user.role"] = participant.Role
+		}
+		if participant.Role == interfaces.RoleHost {
+			vars["room.host_present"] = true
+		}
+	}
+	return ctx.MustGet("rules").(*rules.Engine).Check(ctx, socket.OrgID, rules.Record, vars)
+}
+
+// StopRecording stops a recording or stream of the session. Only the
+// session's owner and hosts may.
+func StopRecording(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if !sessionHost(session, claims.Subject) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner or hosts can stop recording it."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("recordings")
+
+	var recording interfaces.Recording
+	err := collection.FindOne(ctx, bson.M{"_id": ctx.Param("id"), "sessionID": socket.SessionID}).Decode(&recording)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found."})
+		return
+	}
+
+	recorder, ok := ctx.MustGet("media").(media.Recorder)
+	if !ok {
+		ctx.JSON(http.StatusNotImplemented, gin.H{"error": "Recording is not supported by this media backend."})
+		return
+	}
+	if err := recorder.StopRecording(ctx, recording.ID); err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not stop recording."})
+		return
+	}
+	ctx.MustGet("screens").(*assets.Screens).StopAll(ctx, recording)
+
+	// File recordings are queued for the transcoding workers; streams have
+	// nothing left to process.
+	now := time.Now()
+	recording.Status = interfaces.RecordingProcessing
+	if len(recording.Streams) > 0 {
+		recording.Status = interfaces.RecordingReady
+	}
+	recording.StoppedAt = &now
+	collection.UpdateOne(ctx, bson.M{"_id": recording.ID}, bson.M{"$set": bson.M{"status": recording.Status, "stoppedAt": now, "nextAttemptAt": now}})
+	ctx.MustGet("timeline").(*analytics.Timeline).Record(socket.SessionID, analytics.TimelineEvent{
+		Type: analytics.EventRecordingStop,
+		Data: map[string]interface{}{"recordingID": recording.ID},
+	})
+	if recording.Status == interfaces.RecordingReady {
+		go ctx.MustGet("hooks").(*automation.Hooks).RecordingReady(recording)
+		go ctx.MustGet("crm").(*crm.Sync).RecordingReady(recording)
+	}
+
+	ctx.JSON(http.StatusOK, recording)
+}
+
+// rtmpURL reports whether raw is an RTMP URL that live streams can be
+// sent to.
+func rtmpURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "rtmp" || parsed.Scheme == "rtmps") && parsed.Host != ""
+}
+
+// accountDetails returns the display name and email of the user's account,
+// as watermarks identify them by.
+func accountDetails(ctx *gin.Context, db *mongo.Client, userID string) (string, string) {
+	var user struct {
+		Name        string `bson:"name"`
+		DisplayName string `bson:"displayName"`
+		Email       string `bson:"email"`
+	}
+	if id, err := primitive.ObjectIDFromHex(userID); err == nil {
+		db.Database("vidchat").Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName, user.Email
+	}
+	return user.Name, user.Email
+}
+
+// findSession loads the session at the :url parameter, writing a 404 when
+// there is none.
+func findSession(ctx *gin.Context) (interfaces.Socket, interfaces.Session, bool) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var socket interfaces.Socket
+	err := db.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"hashedUrl": ctx.Param("url")}).Decode(&socket)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return socket, interfaces.Session{}, false
+	}
+
+	var session interfaces.Session
+	objectID, err := primitive.ObjectIDFromHex(socket.SessionID)
+	if err == nil {
+		err = db.Database("vidchat").Collection("sessions").FindOne(ctx, bson.M{"_id": objectID}).Decode(&session)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return socket, session, false
+	}
+
+	return socket, session, true
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRedactionReason bounds the length of a redaction's reason.
+const maxRedactionReason = 500
+
+type redactionInput struct {
+	StartOffset float64 `json:"startOffset"`
+	EndOffset   float64 `json:"endOffset"`
+	Bleep       bool    `json:"bleep"`
+	Reason      string  `json:"reason"`
+}
+
+// RedactRecording lets the session's owner redact a span of one of its
+// recordings.
+func RedactRecording(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	socket, session, ok := findSession(ctx)
+	if !ok {
+		return
+	}
+	if session.OwnerID == "" || session.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the session's owner can redact its recordings."})
+		return
+	}
+	redact(ctx, bson.M{"_id": ctx.Param("id"), "sessionID": socket.SessionID}, claims.Subject)
+}
+
+// AdminRedactRecording lets an admin redact a span of any recording.
+func AdminRedactRecording(ctx *gin.Context) {
+	redact(ctx, bson.M{"_id": ctx.Param("id")}, "admin")
+}
+
+// redact records a redaction of the recording matching filter, made by by.
+// The redaction is kept on the recording as its audit trail. A ready
+// recording with audio to bleep goes back to processing, and is ready
+// again once the transcoding workers applied its redactions.
+func redact(ctx *gin.Context, filter bson.M, by string) {
+	var input redactionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" || len(input.Reason) > maxRedactionReason {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A reason of at most 500 characters is required."})
+		return
+	}
+	if input.StartOffset < 0 || input.EndOffset <= input.StartOffset {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "endOffset must be after startOffset."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("recordings")
+	var recording interfaces.Recording
+	if err := collection.FindOne(ctx, filter).Decode(&recording); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Recording not found."})
+		return
+	}
+	if recording.Status == interfaces.RecordingDeleted || len(recording.Streams) > 0 {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Recording has nothing to redact."})
+		return
+	}
+	if recording.DurationSeconds > 0 && input.StartOffset >= recording.DurationSeconds {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "startOffset is past the end of the recording."})
+		return
+	}
+
+	redaction := interfaces.RecordingRedaction{
+		ID:          primitive.NewObjectID().Hex(),
+		StartOffset: input.StartOffset,
+		EndOffset:   input.EndOffset,
+		Bleep:       input.Bleep,
+		Reason:      input.Reason,
+		By:          by,
+		At:          time.Now(),
+	}
+	update := bson.M{"$push": bson.M{"redactions": redaction}}
+	// The status is matched so a recording deleted meanwhile is left alone.
+	filter = bson.M{"_id": recording.ID, "status": recording.Status}
+	if redaction.Bleep && recording.Status == interfaces.RecordingReady {
+		update["$set"] = bson.M{"status": interfaces.RecordingProcessing, "attempts": 0, "nextAttemptAt": redaction.At}
+		recording.Status = interfaces.RecordingProcessing
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err == nil && result.MatchedCount == 0 {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Recording changed, try again."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save redaction."})
+		return
+	}
+	log.Printf("Recording %s redacted from %.3fs to %.3fs by %s: %s", recording.ID, redaction.StartOffset, redaction.EndOffset, by, redaction.Reason)
+
+	ctx.JSON(http.StatusCreated, gin.H{"redaction": redaction, "status": recording.Status})
+}
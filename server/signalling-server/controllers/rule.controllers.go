@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/rules"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ruleInput struct {
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Condition string `json:"condition"`
+	Message   string `json:"message"`
+	Disabled  bool   `json:"disabled"`
+}
+
+// ListOrgRules returns the org's rules.
+func ListOrgRules(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("rules").Find(ctx, bson.M{"orgID": ctx.Param("id")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load rules."})
+		return
+	}
+	list := []interfaces.Rule{}
+	if err := cursor.All(ctx, &list); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load rules."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"rules": list, "variables": rules.Variables})
+}
+
+func CreateOrgRule(ctx *gin.Context) {
+	saveRule(ctx, interfaces.Rule{ID: primitive.NewObjectID().Hex(), OrgID: ctx.Param("id")})
+}
+
+func UpdateOrgRule(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var rule interfaces.Rule
+	err := db.Database("vidchat").Collection("rules").FindOne(ctx, bson.M{"_id": ctx.Param("rule"), "orgID": ctx.Param("id")}).Decode(&rule)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Rule not found."})
+		return
+	}
+	saveRule(ctx, rule)
+}
+
+func DeleteOrgRule(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	result, err := db.Database("vidchat").Collection("rules").DeleteOne(ctx, bson.M{"_id": ctx.Param("rule"), "orgID": ctx.Param("id")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete rule."})
+		return
+	}
+	if result.DeletedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Rule not found."})
+		return
+	}
+	ctx.MustGet("rules").(*rules.Engine).Forget(ctx.Param("id"))
+	ctx.Status(http.StatusNoContent)
+}
+
+// saveRule validates the request body into rule and upserts it. Other
+// nodes pick up the change within their cache lifetime.
+func saveRule(ctx *gin.Context, rule interfaces.Rule) {
+	var input ruleInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Rule name is required."})
+		return
+	}
+	if _, ok := rules.Variables[input.Action]; !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Rule action must be join or record."})
+		return
+	}
+
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+	rule.Name = input.Name
+	rule.Action = input.Action
+	rule.Condition = input.Condition
+	rule.Message = input.Message
+	rule.Disabled = input.Disabled
+	if err := rules.Validate(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition: " + err.Error() + "."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	_, err := db.Database("vidchat").Collection("rules").ReplaceOne(ctx, bson.M{"_id": rule.ID}, rule, options.Replace().SetUpsert(true))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save rule."})
+		return
+	}
+	ctx.MustGet("rules").(*rules.Engine).Forget(rule.OrgID)
+	ctx.JSON(http.StatusOK, rule)
+}
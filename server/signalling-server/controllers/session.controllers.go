@@ -2,30 +2,201 @@ package controllers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/calendar"
 	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/maintenance"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
 	"github.com/r3tr056/go-videoconf/signalling-server/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func CreateSession(ctx *gin.Context) {
-	db := ctx.MustGet("db").(*mongo.Client)
-	collection := db.Database("vidchat").Collection("sessions")
-
 	var session interfaces.Session
 	if err := ctx.ShouldBindJSON(&session); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	session.Password = utils.HashPassword(session.Password)
+	// Signed-in hosts own the session, which puts it in their data export.
+	claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+	if claims.Device() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Not allowed for devices."})
+		return
+	}
+	if err == nil && claims != nil {
+		session.OwnerID = claims.Subject
+		session.CreatorID = claims.Subject
+	}
+	// Delegates schedule on the owner's behalf; the owner owns the session.
+	if owner := ctx.Query("onBehalfOf"); owner != "" && owner != session.CreatorID {
+		if session.CreatorID == "" || !isDelegate(ctx, ctx.MustGet("db").(*mongo.Client), owner, session.CreatorID) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Not a delegate of that user."})
+			return
+		}
+		session.OwnerID = owner
+	}
+
+	_, socket, room, ok := createSession(ctx, session)
+	if !ok {
+		return
+	}
+	// Hosts can connect straight to the node the room was placed on.
+	node := ctx.MustGet("placement").(*placement.Ring).Owner(socket.SocketURL).URL
+	ctx.JSON(http.StatusOK, gin.H{"socket": socket.HashedURL, "media": room, "node": node})
+}
+
+// createSession validates and stores a new session owned by
+// session.OwnerID, if anyone, in the org of its template or owner, and
+// provisions its media room, writing the error response when that fails.
+// It returns the session's ID and socket.
+func createSession(ctx *gin.Context, session interfaces.Session) (primitive.ObjectID, interfaces.Socket, media.Room, bool) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("sessions")
+
+	if !validSettings(ctx, session.Settings) {
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+
+	if window := ctx.MustGet("maintenance").(*maintenance.Scheduler).Active(); window != nil {
+		// Meetings created now would be cut short, so they wait until after.
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":    "Scheduled maintenance is under way, please try again later.",
+			"message":  window.Message,
+			"deadline": window.Deadline,
+		})
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+
+	if session.TemplateID != "" {
+		template, ok := findTemplate(ctx, session.TemplateID, session.OwnerID)
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found."})
+			return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+		}
+		if session.Title == "" {
+			session.Title = template.Title(session.Host, time.Now())
+		}
+		if session.OrgID == "" {
+			session.OrgID = template.OrgID
+		}
+		session.Settings = template.Settings
+	}
+	// Sessions count against, and follow the policies of, their owner's
+	// org; anonymous sessions belong to none.
+	if session.OrgID == "" && session.OwnerID != "" {
+		session.OrgID = userOrg(ctx, db, session.OwnerID)
+	}
+
+	switch session.Access {
+	case "", interfaces.AccessPassword:
+		session.Password = utils.HashPassword(session.Password)
+	case interfaces.AccessInvite, interfaces.AccessOrg:
+		if session.Password != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Sessions without a password cannot set one."})
+			return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+		}
+		if session.OwnerID == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Sign in to create a session without a password."})
+			return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+		}
+		if session.Access == interfaces.AccessOrg && session.OrgID == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Only members of an organization can create org sessions."})
+			return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+		}
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Access must be password, invite or org."})
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+
+	if len(session.Devices) > 0 && !validDevices(ctx, session) {
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+
+	result, err := collection.InsertOne(ctx, session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create the session."})
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+	objectID := result.InsertedID.(primitive.ObjectID)
+	insertedID := objectID.Hex()
+
+	// A session that cannot be joined is removed rather than left behind.
+	backend := ctx.MustGet("media").(media.Backend)
+	room, err := backend.CreateRoom(ctx, insertedID)
+	if err != nil {
+		collection.DeleteOne(ctx, bson.M{"_id": objectID})
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not provision media room."})
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+
+	socket, err := CreateSocket(session, ctx, insertedID)
+	if err != nil {
+		backend.DeleteRoom(ctx, insertedID)
+		collection.DeleteOne(ctx, bson.M{"_id": objectID})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create the session."})
+		return primitive.NilObjectID, interfaces.Socket{}, media.Room{}, false
+	}
+	url := socket.HashedURL
+
+	hooks := ctx.MustGet("hooks").(*automation.Hooks)
+	hooks.Fire(ctx, session.OwnerID, automation.EventMeetingScheduled, hooks.MeetingItem(ctx, insertedID, session, url, objectID.Timestamp()))
+	if session.StartsAt != nil {
+		ctx.MustGet("calendars").(*calendar.Syncer).Nudge(ctx, session.OwnerID)
+	}
+	return objectID, socket, room, true
+}
+
+// GetJoinInfo tells a caller which signalling node owns the session and
+// which media region is nearest to them, ordered by preference, so clients
+// in multi-region deployments connect to the right endpoints directly.
+func GetJoinInfo(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	collection := db.Database("vidchat").Collection("sockets")
+
+	// An unknown URL gets the answer a password protected session would,
+	// so that probing for sessions tells nothing; joining then fails as
+	// with a wrong password.
+	var socket interfaces.Socket
+	err := collection.FindOne(ctx, bson.M{"hashedUrl": ctx.Param("url")}).Decode(&socket)
+	if err != nil {
+		ctx.MustGet("lookups").(*utils.Throttle).Fail(ctx.ClientIP())
+		socket = interfaces.Socket{SocketURL: ctx.Param("url")}
+	}
+
+	geo := ctx.MustGet("geo").(*utils.GeoResolver)
+	region := geo.Region(ctx.Query("region"), ctx.GetHeader("CF-IPCountry"), ctx.ClientIP())
 
-	result, _ := collection.InsertOne(ctx, session)
-	insertedID := result.InsertedID.(primitive.ObjectID).Hex()
+	topology := ctx.MustGet("topology").(*media.Topology)
+	rtts := parseRTTs(ctx.Query("rtt"))
+	region = topology.SelectRegion(rtts, region)
+
+	ring := ctx.MustGet("placement").(*placement.Ring)
+
+	// Clients ask for a password only when the session takes one.
+	var session interfaces.Session
+	if objectID, err := primitive.ObjectIDFromHex(socket.SessionID); err == nil {
+		db.Database("vidchat").Collection("sessions").FindOne(ctx, bson.M{"_id": objectID}).Decode(&session)
+	}
+	access := session.Access
+	if session.NeedsPassword() {
+		access = interfaces.AccessPassword
+	}
 
-	url := CreateSocket(session, ctx, insertedID)
-	ctx.JSON(http.StatusOK, gin.H{"socket": url})
+	ctx.JSON(http.StatusOK, gin.H{
+		"signalling": ring.Owner(socket.SocketURL).URL,
+		"region":     region,
+		"media":      topology.Nearest(rtts, region),
+		"access":     access,
+		// Invitees see that the meeting may not go ahead as planned.
+		"ownerDeactivated": session.OwnerDeactivatedAt != nil,
+	})
 }
@@ -1,11 +1,20 @@
 package controllers
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
 	"net/http"
+	"strconv"
 
+	"github.com/r3tr056/go-videoconf/signalling-server/admission"
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
 	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
 	"github.com/r3tr056/go-videoconf/signalling-server/utils"
 
 	"github.com/gin-gonic/gin"
@@ -28,7 +37,8 @@ func ConnectSession(ctx *gin.Context) {
 	}
 
 	if result.Err() != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Socket connection not found."})
+		lookupFailed(ctx, input.Password)
+		return
 	}
 
 	var socket interfaces.Socket
@@ -37,59 +47,220 @@ func ConnectSession(ctx *gin.Context) {
 	collection = db.Database("vidchat").Collection("sessions")
 	objectID, err := primitive.ObjectIDFromHex(socket.SessionID)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Session not found."})
+		lookupFailed(ctx, input.Password)
 		return
 	}
 
 	result = collection.FindOne(ctx, bson.M{"_id": objectID})
 	if result.Err() != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Session not found."})
+		lookupFailed(ctx, input.Password)
 		return
 	}
 
 	var session interfaces.Session
 	result.Decode(&session)
 
-	if !utils.ComparePasswords(session.Password, []byte(input.Password)) {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password."})
+	if !sessionAccess(ctx, socket, session, input.Password) {
+		return
+	}
+
+	// Signed-in users join as their account, whatever userID they send, and
+	// embed token holders as the user ID the token gives them.
+	userID, account := joiningUser(ctx)
+	if userDeactivated(ctx, db, account) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "This account is deactivated."})
+		return
+	}
+	// LTI learners join as the user their launch's invite names, which only
+	// the identity token lets them connect as.
+	embed, embedded := embedGrant(ctx, socket)
+	identity, launched := "", false
+	if embedded {
+		userID = embedUserID(ctx)
+	} else if identity, launched = ltiIdentity(ctx, socket); launched {
+		userID = ctx.Query("viewer")
+	} else if lti.Reserved(userID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Launch the meeting from your course to join as this user."})
+		return
+	}
+
+	// The org's required notices are accepted through AcceptConsent first.
+	missing, err := missingConsent(ctx, db, socket, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load consent."})
+		return
+	}
+	if len(missing) > 0 {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Consent is required to join.", "consent": missing, "userID": userID})
+		return
+	}
+
+	// An embed token fixes the name its holder joins under.
+	name := ctx.Query("name")
+	if embedded {
+		name = embed.Name
+	}
+
+	decision, ok := admit(ctx, admission.Request{
+		Action:  admission.ActionJoin,
+		UserID:  userID,
+		Name:    name,
+		Session: socket.SessionID,
+		Room:    socket.HashedURL,
+		Org:     socket.OrgID,
+	})
+	if !ok {
+		return
+	}
+	if decision.Modify.Name != "" {
+		name = decision.Modify.Name
+	}
+
+	backend := ctx.MustGet("media").(media.Backend)
+	room, err := backend.JoinRoom(ctx, socket.SessionID, userID, name)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not join media room."})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	ring := ctx.MustGet("placement").(*placement.Ring)
+
+	response := gin.H{
 		"title":  session.Title,
 		"socket": socket.SocketURL,
-	})
+		"media":  room,
+		"node":   ring.Owner(socket.SocketURL).URL,
+		"name":   name,
+		"userID": userID,
+	}
+	// Embed token holders are only told their embed socket, so they cannot
+	// connect to the room without the grant's restrictions.
+	if embedded {
+		embedSocket, err := issueEmbedSocket(ctx, db, socket, userID, embed)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not join the session."})
+			return
+		}
+		response["socket"] = embedSocket
+		response["embed"] = embed
+	}
+	if launched {
+		response["identity"] = identity
+	}
+	if sfu, ok := placeParticipant(ctx, socket.SocketURL, userID, session.Settings); ok {
+		response["sfu"] = sfu
+	}
+	response["preferences"] = joinPreferences(ctx, db)
+	response["settings"] = session.Settings
+	if socket.OrgID != "" {
+		response["branding"] = publicBranding(ctx.MustGet("branding").(*branding.Store).Get(ctx, socket.OrgID))
+	}
+	// SFU clients apply the codec policy themselves when publishing.
+	response["codecs"] = session.Settings.Codecs.Within(ctx.MustGet("codecs").(interfaces.CodecPolicy))
+	ice := ctx.MustGet("ice").(*media.ICE)
+	if relayOnly(ctx, db, session.Settings, socket.OrgID) {
+		// Without TURN a relay only participant could not connect at all.
+		servers := ice.RelayServers(turn.User(socket.SessionID, userID))
+		if len(servers) == 0 {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "This session only allows relayed media, and no TURN server is configured."})
+			return
+		}
+		session.Settings.RelayOnly = true
+		response["settings"] = session.Settings
+		response["iceServers"] = servers
+		response["iceTransportPolicy"] = "relay"
+	} else {
+		response["iceServers"] = ice.Servers(turn.User(socket.SessionID, userID))
+		response["iceTransportPolicy"] = "all"
+	}
+	if session.Watermark != nil {
+		// Live views are watermarked client-side with the viewer's own details.
+		response["watermark"] = media.Overlay{
+			Text:     media.RenderWatermark(session.Watermark.Text, name, ctx.Query("email"), session.Title),
+			Opacity:  session.Watermark.Opacity,
+			Position: session.Watermark.Position,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// relayOnly reports whether a session's media must be relayed, by its own
+// settings or its org's.
+func relayOnly(ctx *gin.Context, db *mongo.Client, settings interfaces.SessionSettings, orgID string) bool {
+	if settings.RelayOnly || orgID == "" {
+		return settings.RelayOnly
+	}
+	var org interfaces.Organization
+	db.Database("vidchat").Collection("orgs").FindOne(ctx, bson.M{"_id": orgID}).Decode(&org)
+	return org.RelayOnly
 }
 
+// GetSession reports whether the session at the url query parameter
+// exists. Only signed in users and callers holding a valid invite to it may
+// ask; everyone else gets the same 404 as for a URL that does not exist,
+// and each such answer counts against their IP.
 func GetSession(ctx *gin.Context) {
 	db := ctx.MustGet("db").(*mongo.Client)
 	collection := db.Database("vidchat").Collection("sockets")
 
-	id := ctx.Request.URL.Query()["url"][0]
-	result := collection.FindOne(ctx, bson.M{"hashedUrl": id})
+	id := ctx.Query("url")
+	signer := ctx.MustGet("signer").(*utils.URLSigner)
+	allowed := ctx.Query("sig") != "" && signer.Verify(invitePath(id), ctx.Request.URL.Query())
+	if !allowed {
+		claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+		allowed = err == nil && claims != nil
+	}
 
-	if result.Err() != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Socket connection not found."})
+	if !allowed || id == "" || collection.FindOne(ctx, bson.M{"hashedUrl": id}).Err() != nil {
+		ctx.MustGet("lookups").(*utils.Throttle).Fail(ctx.ClientIP())
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
 		return
 	}
 
 	ctx.Status(http.StatusOK)
 }
 
-func CreateSocket(session interfaces.Session, ctx *gin.Context, id string) string {
+// CreateSocket stores the socket of a new session. Its hashed URL and
+// socket URL are random, so neither can be guessed or computed from the
+// session: nobody finds the session or opens the room's WebSocket without
+// having been given them, whatever its access mode. URLs that happen to be
+// taken already are drawn again.
+func CreateSocket(session interfaces.Session, ctx *gin.Context, id string) (interfaces.Socket, error) {
 	db := ctx.MustGet("db").(*mongo.Client)
 	collection := db.Database("vidchat").Collection("sockets")
 
-	var socket interfaces.Socket
-	hashURL := hashSession(session.Host + session.Title)
-	socketURL := hashSession(session.Host + session.Password)
-	socket.SessionID = id
-	socket.HashedURL = hashURL
-	socket.SocketURL = socketURL
+	var err error
+	for draw := 0; draw < 3; draw++ {
+		random := make([]byte, 40)
+		if _, err = rand.Read(random); err != nil {
+			return interfaces.Socket{}, err
+		}
+		hashURL := hex.EncodeToString(random[:20])
+		seed := hex.EncodeToString(random[20:])
 
-	collection.InsertOne(ctx, socket)
+		var socket interfaces.Socket
+		// The room starts on the least loaded signalling node.
+		socketURL := ctx.MustGet("placement").(*placement.Ring).Place(func(attempt int) string {
+			if attempt == 0 {
+				return seed
+			}
+			return hashSession(seed + "#" + strconv.Itoa(attempt))
+		})
+		socket.SessionID = id
+		socket.HashedURL = hashURL
+		socket.SocketURL = socketURL
+		socket.MatrixRoom = session.MatrixRoom
+		socket.OrgID = session.OrgID
 
-	return hashURL
+		if _, err = collection.InsertOne(ctx, socket); err == nil {
+			return socket, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	return interfaces.Socket{}, err
 }
 
 func hashSession(str string) string {
@@ -97,3 +268,21 @@ func hashSession(str string) string {
 	hash.Write([]byte(str))
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// joinPreferences returns the meeting defaults the client should apply: the
+// signed-in caller's saved preferences, or the defaults for guests.
+func joinPreferences(ctx *gin.Context, db *mongo.Client) interfaces.Preferences {
+	preferences := interfaces.DefaultPreferences
+
+	claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+	if err != nil || claims == nil {
+		return preferences
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return preferences
+	}
+
+	db.Database("vidchat").Collection("preferences").FindOne(ctx, bson.M{"_id": userID}).Decode(&preferences)
+	return preferences
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type templateInput struct {
+	Name         string                     `json:"name"`
+	TitlePattern string                     `json:"titlePattern"`
+	Settings     interfaces.SessionSettings `json:"settings"`
+}
+
+// CreateTemplate saves a template owned by the caller.
+func CreateTemplate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	saveTemplate(ctx, interfaces.Template{ID: primitive.NewObjectID().Hex(), OwnerID: claims.Subject})
+}
+
+// CreateOrgTemplate saves a template shared by every member of the org.
+func CreateOrgTemplate(ctx *gin.Context) {
+	saveTemplate(ctx, interfaces.Template{ID: primitive.NewObjectID().Hex(), OrgID: ctx.Param("id")})
+}
+
+// ListTemplates returns the caller's templates and their org's.
+func ListTemplates(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	owners := bson.A{bson.M{"ownerID": claims.Subject}}
+	if org := userOrg(ctx, db, claims.Subject); org != "" {
+		owners = append(owners, bson.M{"orgID": org})
+	}
+
+	cursor, err := db.Database("vidchat").Collection("templates").Find(ctx, bson.M{"$or": owners})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load templates."})
+		return
+	}
+	templates := []interfaces.Template{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load templates."})
+		return
+	}
+	ctx.JSON(http.StatusOK, templates)
+}
+
+func GetTemplate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	template, ok := findTemplate(ctx, ctx.Param("id"), claims.Subject)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found."})
+		return
+	}
+	ctx.JSON(http.StatusOK, template)
+}
+
+// UpdateTemplate replaces one of the caller's own templates. Org templates
+// are managed through the admin API.
+func UpdateTemplate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	template, ok := findTemplate(ctx, ctx.Param("id"), claims.Subject)
+	if !ok || template.OwnerID != claims.Subject {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found."})
+		return
+	}
+	saveTemplate(ctx, template)
+}
+
+func DeleteTemplate(ctx *gin.Context) {
+	claims, ok := requireLogin(ctx)
+	if !ok {
+		return
+	}
+	deleteTemplate(ctx, bson.M{"_id": ctx.Param("id"), "ownerID": claims.Subject})
+}
+
+func DeleteOrgTemplate(ctx *gin.Context) {
+	deleteTemplate(ctx, bson.M{"_id": ctx.Param("template"), "orgID": ctx.Param("id")})
+}
+
+func deleteTemplate(ctx *gin.Context, filter bson.M) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	result, err := db.Database("vidchat").Collection("templates").DeleteOne(ctx, filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete template."})
+		return
+	}
+	if result.DeletedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// saveTemplate validates the request body into template and upserts it.
+func saveTemplate(ctx *gin.Context, template interfaces.Template) {
+	var input templateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Template name is required."})
+		return
+	}
+	if !validSettings(ctx, input.Settings) {
+		return
+	}
+
+	now := time.Now()
+	if template.CreatedAt.IsZero() {
+		template.CreatedAt = now
+	}
+	template.UpdatedAt = now
+	template.Name = input.Name
+	template.TitlePattern = input.TitlePattern
+	template.Settings = input.Settings
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	_, err := db.Database("vidchat").Collection("templates").ReplaceOne(ctx, bson.M{"_id": template.ID}, template, options.Replace().SetUpsert(true))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save template."})
+		return
+	}
+	ctx.JSON(http.StatusOK, template)
+}
+
+// validSettings checks session settings, writing the error response itself
+// when they are invalid.
+func validSettings(ctx *gin.Context, settings interfaces.SessionSettings) bool {
+	if err := settings.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	for _, codec := range append(append([]string{}, settings.Codecs.Allowed...), settings.Codecs.Preferred...) {
+		if !media.KnownCodec(codec) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown codec " + codec + "."})
+			return false
+		}
+	}
+	for _, capability := range settings.Capabilities {
+		if !media.KnownCapability(capability) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown capability " + capability + "."})
+			return false
+		}
+	}
+	return true
+}
+
+// findTemplate loads a template the user may use: their own or their org's.
+func findTemplate(ctx *gin.Context, id, userID string) (interfaces.Template, bool) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var template interfaces.Template
+	if err := db.Database("vidchat").Collection("templates").FindOne(ctx, bson.M{"_id": id}).Decode(&template); err != nil {
+		return template, false
+	}
+	if userID == "" {
+		return template, false
+	}
+	if template.OwnerID == userID {
+		return template, true
+	}
+	return template, template.OrgID != "" && template.OrgID == userOrg(ctx, db, userID)
+}
+
+// userOrg returns the organization the users service signed the user up to.
+func userOrg(ctx *gin.Context, db *mongo.Client, userID string) string {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ""
+	}
+	var user struct {
+		OrgID string `bson:"orgID"`
+	}
+	db.Database("vidchat").Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	return user.OrgID
+}
+
+// requireLogin authenticates the caller's access token, writing a 401 when
+// there is none. Devices are refused: everything behind a login is for
+// people.
+func requireLogin(ctx *gin.Context) (*auth.Claims, bool) {
+	claims, err := ctx.MustGet("logins").(*auth.Sessions).Authenticate(ctx.Request)
+	if err != nil || claims == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized."})
+		return nil, false
+	}
+	if claims.Device() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Not allowed for devices."})
+		return nil, false
+	}
+	return claims, true
+}
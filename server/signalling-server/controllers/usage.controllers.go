@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/metering"
+	"github.com/r3tr056/go-videoconf/signalling-server/quota"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetOrgTURNUsage sums the relay usage of an org's participants, for
+// billing: allocations started in the period of billingPeriod.
+func GetOrgTURNUsage(ctx *gin.Context) {
+	from, to, ok := billingPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	usage, err := turn.OrgUsage(ctx, db, ctx.Param("id"), from, to)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load TURN usage."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"from": from, "to": to, "usage": usage})
+}
+
+// GetOrgUsage returns an org's metered usage, per day and in total, over
+// the period of billingPeriod.
+func GetOrgUsage(ctx *gin.Context) {
+	from, to, ok := billingPeriod(ctx)
+	if !ok {
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	readings, totals, err := metering.Readings(ctx, db, ctx.Param("id"), from, to)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load usage."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"from": from, "to": to, "days": readings, "totals": totals})
+}
+
+// GetOrgStorage returns what an org's recordings take up in storage,
+// against its quota.
+func GetOrgStorage(ctx *gin.Context) {
+	usage, err := ctx.MustGet("storageQuota").(*quota.Storage).Usage(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load storage usage."})
+		return
+	}
+	ctx.JSON(http.StatusOK, usage)
+}
+
+// billingPeriod reads the from and to query parameters (RFC 3339), the
+// current calendar month (UTC) by default, writing a 400 when they are
+// invalid.
+func billingPeriod(ctx *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	for param, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := ctx.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected an RFC 3339 time."})
+				return from, to, false
+			}
+			*bound = parsed
+		}
+	}
+	return from, to, true
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/compliance"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type watchlistInput struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+	Patterns []string `json:"patterns"`
+	Notify   []string `json:"notify"`
+	Disabled bool     `json:"disabled"`
+}
+
+// ListOrgWatchlists returns the org's watchlists.
+func ListOrgWatchlists(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("watchlists").Find(ctx, bson.M{"orgID": ctx.Param("id")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load watchlists."})
+		return
+	}
+	list := []interfaces.Watchlist{}
+	if err := cursor.All(ctx, &list); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load watchlists."})
+		return
+	}
+	ctx.JSON(http.StatusOK, list)
+}
+
+func CreateOrgWatchlist(ctx *gin.Context) {
+	saveWatchlist(ctx, interfaces.Watchlist{ID: primitive.NewObjectID().Hex(), OrgID: ctx.Param("id")})
+}
+
+func UpdateOrgWatchlist(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+
+	var watchlist interfaces.Watchlist
+	err := db.Database("vidchat").Collection("watchlists").FindOne(ctx, bson.M{"_id": ctx.Param("watchlist"), "orgID": ctx.Param("id")}).Decode(&watchlist)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found."})
+		return
+	}
+	saveWatchlist(ctx, watchlist)
+}
+
+func DeleteOrgWatchlist(ctx *gin.Context) {
+	db := ctx.MustGet("db").(*mongo.Client)
+	result, err := db.Database("vidchat").Collection("watchlists").DeleteOne(ctx, bson.M{"_id": ctx.Param("watchlist"), "orgID": ctx.Param("id")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete watchlist."})
+		return
+	}
+	if result.DeletedCount == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found."})
+		return
+	}
+	ctx.MustGet("compliance").(*compliance.Monitor).Forget(ctx.Param("id"))
+	ctx.Status(http.StatusNoContent)
+}
+
+// saveWatchlist validates the request body into watchlist and upserts it.
+// Other nodes pick up the change within their cache lifetime.
+func saveWatchlist(ctx *gin.Context, watchlist interfaces.Watchlist) {
+	var input watchlistInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Watchlist name is required."})
+		return
+	}
+	if len(input.Keywords)+len(input.Patterns) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A watchlist needs keywords or patterns."})
+		return
+	}
+
+	now := time.Now()
+	if watchlist.CreatedAt.IsZero() {
+		watchlist.CreatedAt = now
+	}
+	watchlist.UpdatedAt = now
+	watchlist.Name = input.Name
+	watchlist.Keywords = input.Keywords
+	watchlist.Patterns = input.Patterns
+	watchlist.Notify = input.Notify
+	watchlist.Disabled = input.Disabled
+	if err := compliance.Validate(watchlist); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid watchlist: " + err.Error() + "."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	_, err := db.Database("vidchat").Collection("watchlists").ReplaceOne(ctx, bson.M{"_id": watchlist.ID}, watchlist, options.Replace().SetUpsert(true))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save watchlist."})
+		return
+	}
+	ctx.MustGet("compliance").(*compliance.Monitor).Forget(watchlist.OrgID)
+	ctx.JSON(http.StatusOK, watchlist)
+}
+
+// ListOrgAlerts returns the org's keyword alerts, newest first, only those
+// not yet reviewed with ?unreviewed=true.
+func ListOrgAlerts(ctx *gin.Context) {
+	query := bson.M{"orgID": ctx.Param("id")}
+	if unreviewed, _ := strconv.ParseBool(ctx.Query("unreviewed")); unreviewed {
+		query["reviewedAt"] = bson.M{"$exists": false}
+	}
+	if session := ctx.Query("session"); session != "" {
+		query["sessionID"] = session
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	cursor, err := db.Database("vidchat").Collection("keyword_alerts").Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(500))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load alerts."})
+		return
+	}
+	alerts := []interfaces.KeywordAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load alerts."})
+		return
+	}
+	ctx.JSON(http.StatusOK, alerts)
+}
+
+// ReviewOrgAlert marks one of the org's alerts reviewed by the named
+// reviewer.
+func ReviewOrgAlert(ctx *gin.Context) {
+	var input struct {
+		Reviewer string `json:"reviewer"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil || input.Reviewer == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Reviewer is required."})
+		return
+	}
+
+	db := ctx.MustGet("db").(*mongo.Client)
+	var alert interfaces.KeywordAlert
+	err := db.Database("vidchat").Collection("keyword_alerts").FindOneAndUpdate(ctx,
+		bson.M{"_id": ctx.Param("alert"), "orgID": ctx.Param("id")},
+		bson.M{"$set": bson.M{"reviewedAt": time.Now(), "reviewedBy": input.Reviewer}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&alert)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Alert not found."})
+		return
+	}
+	ctx.JSON(http.StatusOK, alert)
+}
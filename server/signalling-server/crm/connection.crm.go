@@ -0,0 +1,221 @@
+// Package crm records an org's meetings with outside contacts in its CRM:
+// once a meeting with external participants ends, each of them, found by
+// email, gets an activity saying when the meeting ran and how long they
+// attended, which later gains links to the meeting's recordings.
+package crm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// CRMs an org can connect. ProviderWebhook posts activities to an endpoint
+// of the org's own, for CRMs without a built-in integration.
+const (
+	ProviderHubSpot    = "hubspot"
+	ProviderSalesforce = "salesforce"
+	ProviderWebhook    = "webhook"
+)
+
+var (
+	// ErrInvalid is returned for connections missing what their provider
+	// needs.
+	ErrInvalid = errors.New("invalid CRM connection")
+	// errNoContact is returned for emails the CRM has no contact for;
+	// contacts are never created, so the CRM only gains activities.
+	errNoContact = errors.New("no contact with that email")
+	// errNotFound is returned for activities deleted in the CRM.
+	errNotFound = errors.New("activity not found")
+)
+
+// Connection is the CRM an org records its external meetings in.
+//
+// Token is a HubSpot private app token, a Salesforce refresh token issued
+// to the connected app ClientID, or the secret webhook calls are signed
+// with. URL is the Salesforce instance or the webhook's endpoint.
+//
+// Fields maps CRM fields to values, set on every activity on top of the
+// provider's own. Values may use the placeholders in Placeholders, so a
+// webhook can be sent exactly the body its endpoint expects.
+type Connection struct {
+	OrgID        string            `bson:"_id" json:"orgID"`
+	Provider     string            `bson:"provider" json:"provider"`
+	URL          string            `bson:"url,omitempty" json:"url,omitempty"`
+	Token        string            `bson:"token,omitempty" json:"token,omitempty"`
+	ClientID     string            `bson:"clientID,omitempty" json:"clientID,omitempty"`
+	ClientSecret string            `bson:"clientSecret,omitempty" json:"clientSecret,omitempty"`
+	Fields       map[string]string `bson:"fields,omitempty" json:"fields,omitempty"`
+
+	// InternalDomains are the email domains of the org's own people, who
+	// are never recorded. Without them the org's allowed signup domains
+	// are used.
+	InternalDomains []string `bson:"internalDomains,omitempty" json:"internalDomains,omitempty"`
+
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Placeholders lists what Fields values may refer to.
+var Placeholders = []string{"{title}", "{email}", "{name}", "{url}", "{start}", "{end}", "{minutes}", "{late}", "{leftEarly}", "{recordings}"}
+
+// maxFields caps Fields, each of which is sent on every activity.
+const maxFields = 32
+
+// Validate checks the connection has what its provider needs.
+func (c Connection) Validate() error {
+	switch c.Provider {
+	case ProviderHubSpot:
+		if c.Token == "" {
+			return errors.New("token must be a HubSpot private app token")
+		}
+	case ProviderSalesforce:
+		if !httpsURL(c.URL) {
+			return errors.New("url must be the https URL of the Salesforce instance")
+		}
+		if c.Token == "" || c.ClientID == "" || c.ClientSecret == "" {
+			return errors.New("token, clientID and clientSecret are required for Salesforce")
+		}
+	case ProviderWebhook:
+		if !httpsURL(c.URL) {
+			return errors.New("url must be an https URL")
+		}
+	default:
+		return fmt.Errorf("provider must be %s, %s or %s", ProviderHubSpot, ProviderSalesforce, ProviderWebhook)
+	}
+	if len(c.Fields) > maxFields {
+		return fmt.Errorf("at most %d fields are allowed", maxFields)
+	}
+	for field := range c.Fields {
+		if !interfaces.MetadataKey.MatchString(field) {
+			return fmt.Errorf("invalid field name %q", field)
+		}
+	}
+	for _, domain := range c.InternalDomains {
+		if domain == "" || strings.ContainsAny(domain, "@/ ") {
+			return fmt.Errorf("invalid internal domain %q", domain)
+		}
+	}
+	return nil
+}
+
+func httpsURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && parsed.Scheme == "https" && parsed.Host != ""
+}
+
+// Activity is what an external participant's CRM activity says about a
+// meeting.
+type Activity struct {
+	SessionID  string    `bson:"sessionID" json:"sessionID"`
+	Title      string    `bson:"title" json:"title"`
+	URL        string    `bson:"url" json:"url"`
+	Email      string    `bson:"email" json:"email"`
+	Name       string    `bson:"name,omitempty" json:"name,omitempty"`
+	Start      time.Time `bson:"start" json:"start"`
+	End        time.Time `bson:"end" json:"end"`
+	Minutes    float64   `bson:"minutes" json:"minutes"`
+	Late       bool      `bson:"late" json:"late"`
+	LeftEarly  bool      `bson:"leftEarly" json:"leftEarly"`
+	Recordings []string  `bson:"recordings,omitempty" json:"recordings,omitempty"`
+}
+
+// Render fills the placeholders of a Fields value.
+func (a Activity) Render(value string) string {
+	return strings.NewReplacer(
+		"{title}", a.Title,
+		"{email}", a.Email,
+		"{name}", a.Name,
+		"{url}", a.URL,
+		"{start}", a.Start.UTC().Format(time.RFC3339),
+		"{end}", a.End.UTC().Format(time.RFC3339),
+		"{minutes}", fmt.Sprint(a.Minutes),
+		"{late}", fmt.Sprint(a.Late),
+		"{leftEarly}", fmt.Sprint(a.LeftEarly),
+		"{recordings}", strings.Join(a.Recordings, "\n"),
+	).Replace(value)
+}
+
+// Description is the activity's notes in the CRM.
+func (a Activity) Description() string {
+	who := a.Name
+	if who == "" {
+		who = a.Email
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s attended %g of %g minutes.", who, a.Minutes, a.End.Sub(a.Start).Round(time.Minute).Minutes())
+	if a.Late {
+		b.WriteString(" Joined late.")
+	}
+	if a.LeftEarly {
+		b.WriteString(" Left early.")
+	}
+	b.WriteString("\nMeeting: " + a.URL)
+	for _, recording := range a.Recordings {
+		b.WriteString("\nRecording: " + recording)
+	}
+	return b.String()
+}
+
+// fields renders the connection's Fields for the activity.
+func (c Connection) fields(activity Activity) map[string]string {
+	rendered := make(map[string]string, len(c.Fields))
+	for field, value := range c.Fields {
+		rendered[field] = activity.Render(value)
+	}
+	return rendered
+}
+
+// api is a CRM's API. Save creates the contact's activity when id is
+// empty, and updates the one created before otherwise, returning its ID.
+type api interface {
+	Save(ctx context.Context, conn Connection, id string, activity Activity) (string, error)
+}
+
+// call sends a JSON request to a CRM's API and decodes the answer into out,
+// when given.
+func call(ctx context.Context, client *http.Client, method, url, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("%s %s answered %s", method, url, resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
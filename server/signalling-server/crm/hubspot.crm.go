@@ -0,0 +1,81 @@
+package crm
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	hubspotAPI = "https://api.hubapi.com/crm/v3/objects"
+	// hubspotMeetingToContact is HubSpot's association type of a meeting
+	// with a contact.
+	hubspotMeetingToContact = 200
+)
+
+// hubspot records activities as meetings on the contact's timeline.
+type hubspot struct {
+	client *http.Client
+}
+
+type hubspotObject struct {
+	ID string `json:"id"`
+}
+
+func (h *hubspot) Save(ctx context.Context, conn Connection, id string, activity Activity) (string, error) {
+	properties := map[string]string{
+		"hs_timestamp":            activity.Start.UTC().Format(time.RFC3339),
+		"hs_meeting_title":        activity.Title,
+		"hs_meeting_body":         activity.Description(),
+		"hs_meeting_start_time":   activity.Start.UTC().Format(time.RFC3339),
+		"hs_meeting_end_time":     activity.End.UTC().Format(time.RFC3339),
+		"hs_meeting_external_url": activity.URL,
+		"hs_meeting_outcome":      "COMPLETED",
+	}
+	for field, value := range conn.fields(activity) {
+		properties[field] = value
+	}
+
+	if id != "" {
+		err := call(ctx, h.client, http.MethodPatch, hubspotAPI+"/meetings/"+url.PathEscape(id), conn.Token, map[string]interface{}{"properties": properties}, nil)
+		return id, err
+	}
+
+	contact, err := h.contact(ctx, conn.Token, activity.Email)
+	if err != nil {
+		return "", err
+	}
+	var created hubspotObject
+	err = call(ctx, h.client, http.MethodPost, hubspotAPI+"/meetings", conn.Token, map[string]interface{}{
+		"properties": properties,
+		"associations": []interface{}{map[string]interface{}{
+			"to": map[string]string{"id": contact},
+			"types": []interface{}{map[string]interface{}{
+				"associationCategory": "HUBSPOT_DEFINED",
+				"associationTypeId":   hubspotMeetingToContact,
+			}},
+		}},
+	}, &created)
+	return created.ID, err
+}
+
+// contact finds the ID of the contact with the email.
+func (h *hubspot) contact(ctx context.Context, token, email string) (string, error) {
+	var found struct {
+		Results []hubspotObject `json:"results"`
+	}
+	err := call(ctx, h.client, http.MethodPost, hubspotAPI+"/contacts/search", token, map[string]interface{}{
+		"filterGroups": []interface{}{map[string]interface{}{
+			"filters": []interface{}{map[string]string{"propertyName": "email", "operator": "EQ", "value": email}},
+		}},
+		"limit": 1,
+	}, &found)
+	if err != nil {
+		return "", err
+	}
+	if len(found.Results) == 0 {
+		return "", errNoContact
+	}
+	return found.Results[0].ID, nil
+}
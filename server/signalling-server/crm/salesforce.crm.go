@@ -0,0 +1,115 @@
+package crm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const salesforceAPI = "/services/data/v59.0"
+
+// salesforce records activities as events on the contact, or the lead,
+// with the email.
+type salesforce struct {
+	client *http.Client
+}
+
+// session is an access token for a Salesforce org and the instance to use
+// it with.
+type session struct {
+	AccessToken string `json:"access_token"`
+	InstanceURL string `json:"instance_url"`
+}
+
+func (s *salesforce) Save(ctx context.Context, conn Connection, id string, activity Activity) (string, error) {
+	session, err := s.login(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	event := map[string]string{
+		"Subject":       activity.Title,
+		"StartDateTime": activity.Start.UTC().Format(time.RFC3339),
+		"EndDateTime":   activity.End.UTC().Format(time.RFC3339),
+		"Location":      activity.URL,
+		"Description":   activity.Description(),
+	}
+	for field, value := range conn.fields(activity) {
+		event[field] = value
+	}
+	objects := session.InstanceURL + salesforceAPI + "/sobjects/Event"
+
+	if id != "" {
+		err := call(ctx, s.client, http.MethodPatch, objects+"/"+url.PathEscape(id), session.AccessToken, event, nil)
+		return id, err
+	}
+
+	who, err := s.who(ctx, session, activity.Email)
+	if err != nil {
+		return "", err
+	}
+	event["WhoId"] = who
+	var created struct {
+		ID string `json:"id"`
+	}
+	err = call(ctx, s.client, http.MethodPost, objects, session.AccessToken, event, &created)
+	return created.ID, err
+}
+
+// who finds the contact with the email, or else the lead.
+func (s *salesforce) who(ctx context.Context, session session, email string) (string, error) {
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(email)
+	for _, object := range []string{"Contact", "Lead"} {
+		query := fmt.Sprintf("SELECT Id FROM %s WHERE Email = '%s' LIMIT 1", object, quoted)
+		var found struct {
+			Records []struct {
+				ID string `json:"Id"`
+			} `json:"records"`
+		}
+		err := call(ctx, s.client, http.MethodGet, session.InstanceURL+salesforceAPI+"/query?q="+url.QueryEscape(query), session.AccessToken, nil, &found)
+		if err != nil {
+			return "", err
+		}
+		if len(found.Records) > 0 {
+			return found.Records[0].ID, nil
+		}
+	}
+	return "", errNoContact
+}
+
+// login trades the connection's refresh token for an access token. Syncs
+// are rare enough that the token is not kept.
+func (s *salesforce) login(ctx context.Context, conn Connection) (session, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {conn.Token},
+		"client_id":     {conn.ClientID},
+		"client_secret": {conn.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(conn.URL, "/")+"/services/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return session{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return session{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return session{}, fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+	var token session
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return session{}, err
+	}
+	if token.InstanceURL == "" {
+		token.InstanceURL = strings.TrimRight(conn.URL, "/")
+	}
+	return token, nil
+}
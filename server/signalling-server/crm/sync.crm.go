@@ -0,0 +1,354 @@
+package crm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recordingTTL is how long the recording links put in CRMs stay valid.
+// CRM records outlive webhook deliveries, so they get longer than
+// automations do.
+const recordingTTL = 30 * 24 * time.Hour
+
+// syncTimeout bounds the CRM calls made for one meeting or recording.
+const syncTimeout = 2 * time.Minute
+
+// record is an activity saved in an org's CRM, kept so that later syncs
+// update it rather than add another.
+type record struct {
+	ID         string    `bson:"_id"`
+	OrgID      string    `bson:"orgID"`
+	Provider   string    `bson:"provider"`
+	ExternalID string    `bson:"externalID"`
+	Activity   Activity  `bson:"activity"`
+	UpdatedAt  time.Time `bson:"updatedAt"`
+}
+
+func activityID(sessionID, email string) string {
+	return sessionID + "|" + email
+}
+
+// Sync keeps orgs' CRM connections in crm_connections and records their
+// meetings in them. A nil Sync records nothing.
+type Sync struct {
+	db     *mongo.Database
+	apis   map[string]api
+	signer *utils.URLSigner
+	brands *branding.Store
+}
+
+func NewSync(db *mongo.Client, signer *utils.URLSigner, brands *branding.Store) *Sync {
+	client := &http.Client{Timeout: 15 * time.Second}
+	return &Sync{
+		db: db.Database("vidchat"),
+		apis: map[string]api{
+			ProviderHubSpot:    &hubspot{client: client},
+			ProviderSalesforce: &salesforce{client: client},
+			ProviderWebhook:    &webhook{client: client},
+		},
+		signer: signer,
+		brands: brands,
+	}
+}
+
+// Connect sets the org's CRM. Secrets left out keep their stored values,
+// so fields can be changed without handing them over again. A webhook
+// without a secret is given one, returned this once.
+func (s *Sync) Connect(ctx context.Context, conn Connection) (Connection, error) {
+	var stored Connection
+	s.db.Collection("crm_connections").FindOne(ctx, bson.M{"_id": conn.OrgID}).Decode(&stored)
+	if stored.Provider == conn.Provider {
+		if conn.Token == "" {
+			conn.Token = stored.Token
+		}
+		if conn.ClientSecret == "" {
+			conn.ClientSecret = stored.ClientSecret
+		}
+	}
+	generated := false
+	if conn.Provider == ProviderWebhook && conn.Token == "" {
+		random := make([]byte, 24)
+		if _, err := rand.Read(random); err != nil {
+			return Connection{}, err
+		}
+		conn.Token = hex.EncodeToString(random)
+		generated = true
+	}
+	if err := conn.Validate(); err != nil {
+		return Connection{}, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	for i, domain := range conn.InternalDomains {
+		conn.InternalDomains[i] = strings.ToLower(domain)
+	}
+	conn.UpdatedAt = time.Now()
+
+	if _, err := s.db.Collection("crm_connections").ReplaceOne(ctx, bson.M{"_id": conn.OrgID}, conn, options.Replace().SetUpsert(true)); err != nil {
+		return Connection{}, err
+	}
+	if !generated {
+		conn.Token = ""
+	}
+	conn.ClientSecret = ""
+	return conn, nil
+}
+
+// Connection returns the org's CRM, without its secrets.
+func (s *Sync) Connection(ctx context.Context, orgID string) (Connection, error) {
+	var conn Connection
+	if err := s.db.Collection("crm_connections").FindOne(ctx, bson.M{"_id": orgID}).Decode(&conn); err != nil {
+		return Connection{}, err
+	}
+	conn.Token = ""
+	conn.ClientSecret = ""
+	return conn, nil
+}
+
+// Disconnect stops recording the org's meetings. Activities already in
+// the CRM stay there.
+func (s *Sync) Disconnect(ctx context.Context, orgID string) error {
+	result, err := s.db.Collection("crm_connections").DeleteOne(ctx, bson.M{"_id": orgID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	s.db.Collection("crm_activities").DeleteMany(ctx, bson.M{"orgID": orgID})
+	return nil
+}
+
+// MeetingEnded records the meeting in its org's CRM for each external
+// participant: anyone whose email, from their account or the "email"
+// metadata they joined with, is not at one of the org's domains or the
+// owner's. Meetings without any are not recorded, nor are guests who gave
+// no email.
+func (s *Sync) MeetingEnded(session interfaces.Session, sessionID, hashedURL string, meeting analytics.Meeting) {
+	if s == nil || session.OrgID == "" || len(meeting.Attendees) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	var conn Connection
+	if err := s.db.Collection("crm_connections").FindOne(ctx, bson.M{"_id": session.OrgID}).Decode(&conn); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("CRM: loading the connection of %s: %s", session.OrgID, err)
+		}
+		return
+	}
+
+	emails := s.emails(ctx, meeting.Attendees, session.OwnerID)
+	internal := s.internalDomains(ctx, conn, emails[session.OwnerID])
+	recordings := s.recordings(ctx, sessionID)
+	url := s.brands.Links(ctx, session.OrgID).Join(hashedURL)
+
+	// Someone who reconnected under another participant is recorded once,
+	// with the time of each added up.
+	activities := make(map[string]*Activity)
+	var order []string
+	for _, attendee := range meeting.Attendees {
+		email := emails[attendee.Record.Account]
+		if attendee.Record.Account == "" {
+			email = strings.ToLower(strings.TrimSpace(attendee.Record.Metadata["email"]))
+		}
+		at := strings.LastIndex(email, "@")
+		if at < 1 || internal[email[at+1:]] {
+			continue
+		}
+
+		activity, ok := activities[email]
+		if !ok {
+			activity = &Activity{
+				SessionID:  sessionID,
+				Title:      session.Title,
+				URL:        url,
+				Email:      email,
+				Name:       attendee.Record.Name,
+				Start:      meeting.Start,
+				End:        meeting.End,
+				Recordings: recordings,
+			}
+			activities[email] = activity
+			order = append(order, email)
+		}
+		activity.Minutes += automation.Minutes(attendee.Attended)
+		activity.Late = activity.Late || attendee.Late > automation.AttendanceGrace
+		activity.LeftEarly = activity.LeftEarly || attendee.Early > automation.AttendanceGrace
+	}
+
+	for _, email := range order {
+		s.save(ctx, conn, *activities[email])
+	}
+}
+
+// RecordingReady adds a link to the recording to the activities of its
+// meeting, once the meeting was recorded in a CRM.
+func (s *Sync) RecordingReady(recording interfaces.Recording) {
+	if s == nil || recording.Output == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	cursor, err := s.db.Collection("crm_activities").Find(ctx, bson.M{"activity.sessionID": recording.SessionID})
+	if err != nil {
+		log.Printf("CRM: loading the activities of %s: %s", recording.SessionID, err)
+		return
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil || len(records) == 0 {
+		return
+	}
+	var conn Connection
+	if err := s.db.Collection("crm_connections").FindOne(ctx, bson.M{"_id": records[0].OrgID}).Decode(&conn); err != nil {
+		return
+	}
+
+	link := s.playURL(recording.ID)
+	for _, record := range records {
+		activity := record.Activity
+		// Links are signed when made, so compare by the recording's path.
+		linked := false
+		for _, existing := range activity.Recordings {
+			linked = linked || strings.Contains(existing, "/recordings/"+recording.ID+"/")
+		}
+		if !linked {
+			activity.Recordings = append(activity.Recordings, link)
+			s.save(ctx, conn, activity)
+		}
+	}
+}
+
+// save creates or updates the activity in the CRM and remembers it.
+func (s *Sync) save(ctx context.Context, conn Connection, activity Activity) {
+	id := activityID(activity.SessionID, activity.Email)
+	var existing record
+	s.db.Collection("crm_activities").FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+	externalID := ""
+	if existing.Provider == conn.Provider {
+		externalID = existing.ExternalID
+	}
+
+	externalID, err := s.apis[conn.Provider].Save(ctx, conn, externalID, activity)
+	switch {
+	case err == errNoContact:
+		return
+	case err == errNotFound:
+		// Deleted in the CRM by someone who did not want it there.
+		s.db.Collection("crm_activities").DeleteOne(ctx, bson.M{"_id": id})
+		return
+	case err != nil:
+		log.Printf("CRM: recording %s in the %s of %s: %s", activity.SessionID, conn.Provider, conn.OrgID, err)
+		return
+	}
+
+	_, err = s.db.Collection("crm_activities").ReplaceOne(ctx, bson.M{"_id": id}, record{
+		ID:         id,
+		OrgID:      conn.OrgID,
+		Provider:   conn.Provider,
+		ExternalID: externalID,
+		Activity:   activity,
+		UpdatedAt:  time.Now(),
+	}, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("CRM: saving activity %s: %s", id, err)
+	}
+}
+
+// emails looks up the email of every signed-in attendee, and of the owner,
+// by account.
+func (s *Sync) emails(ctx context.Context, attendees []analytics.AttendanceSummary, owner string) map[string]string {
+	var ids []primitive.ObjectID
+	for _, account := range append([]string{owner}, accounts(attendees)...) {
+		if id, err := primitive.ObjectIDFromHex(account); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	emails := make(map[string]string)
+	if len(ids) == 0 {
+		return emails
+	}
+	cursor, err := s.db.Collection("users").Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		log.Printf("CRM: loading attendees' emails: %s", err)
+		return emails
+	}
+	var users []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Email string             `bson:"email"`
+	}
+	cursor.All(ctx, &users)
+	for _, user := range users {
+		emails[user.ID.Hex()] = strings.ToLower(user.Email)
+	}
+	return emails
+}
+
+func accounts(attendees []analytics.AttendanceSummary) []string {
+	var accounts []string
+	for _, attendee := range attendees {
+		if attendee.Record.Account != "" {
+			accounts = append(accounts, attendee.Record.Account)
+		}
+	}
+	return accounts
+}
+
+// internalDomains is the set of the org's own email domains: the
+// connection's, or else the org's allowed signup domains, and the
+// owner's.
+func (s *Sync) internalDomains(ctx context.Context, conn Connection, ownerEmail string) map[string]bool {
+	domains := conn.InternalDomains
+	if len(domains) == 0 {
+		var org interfaces.Organization
+		s.db.Collection("orgs").FindOne(ctx, bson.M{"_id": conn.OrgID}).Decode(&org)
+		domains = org.AllowedDomains
+	}
+	internal := make(map[string]bool, len(domains)+1)
+	for _, domain := range domains {
+		internal[strings.ToLower(domain)] = true
+	}
+	if at := strings.LastIndex(ownerEmail, "@"); at >= 0 {
+		internal[ownerEmail[at+1:]] = true
+	}
+	return internal
+}
+
+// recordings returns playback links to the session's ready recordings.
+func (s *Sync) recordings(ctx context.Context, sessionID string) []string {
+	cursor, err := s.db.Collection("recordings").Find(ctx, bson.M{"sessionID": sessionID, "status": interfaces.RecordingReady}, options.Find().SetSort(bson.M{"startedAt": 1}))
+	if err != nil {
+		return nil
+	}
+	var recordings []interfaces.Recording
+	cursor.All(ctx, &recordings)
+	var links []string
+	for _, recording := range recordings {
+		if recording.Output != "" {
+			links = append(links, s.playURL(recording.ID))
+		}
+	}
+	return links
+}
+
+func (s *Sync) playURL(recordingID string) string {
+	public := strings.TrimRight(s.brands.Default().PublicURL, "/")
+	return public + s.signer.Sign("/recordings/"+recordingID+"/play", "crm", recordingTTL)
+}
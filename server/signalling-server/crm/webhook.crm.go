@@ -0,0 +1,51 @@
+package crm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+)
+
+// webhook posts activities to the org's endpoint, signed like automation
+// hooks under the connection's token. The body is the activity, or the
+// connection's Fields when it has any. An update carries the ID of the
+// first call, so the endpoint can tell it apart from a new activity.
+type webhook struct {
+	client *http.Client
+}
+
+func (w *webhook) Save(ctx context.Context, conn Connection, id string, activity Activity) (string, error) {
+	if id == "" {
+		id = activityID(activity.SessionID, activity.Email)
+	}
+	var data interface{} = activity
+	if len(conn.Fields) > 0 {
+		data = conn.fields(activity)
+	}
+	body, err := json.Marshal(map[string]interface{}{"id": id, "event": "crm.activity", "data": data})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, conn.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Videoconf-Event", "crm.activity")
+	automation.Sign(req, conn.Token, body)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return id, nil
+}
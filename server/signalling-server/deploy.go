@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
+)
+
+// minSwitchDelay leaves every node time to poll Consul and see a
+// deployment switch before it is due.
+const minSwitchDelay = 15 * time.Second
+
+// getDeployment shows which version owns rooms and which nodes run it or
+// stand by.
+func getDeployment(ctx *gin.Context) {
+	deployment, err := placement.LoadDeployment(discovery)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not read deployment."})
+		return
+	}
+	members, standby := ring.Members()
+	ctx.JSON(http.StatusOK, gin.H{
+		"deployment": deployment,
+		"active":     deployment.Active(time.Now()),
+		"members":    members,
+		"standby":    standby,
+	})
+}
+
+// postDeployment switches rooms to the nodes running another version, for
+// blue/green deploys and their rollback. Every node applies the switch at
+// the same time: the old owners flush their rooms' snapshots and redirect
+// their clients, who resume on the new owners with their resume tokens.
+func postDeployment(ctx *gin.Context) {
+	var input struct {
+		Version string `json:"version"`
+		Delay   string `json:"delay"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	delay := minSwitchDelay
+	if input.Delay != "" {
+		parsed, err := time.ParseDuration(input.Delay)
+		if err != nil || parsed < minSwitchDelay {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Delay must be a duration of at least 15s."})
+			return
+		}
+		delay = parsed
+	}
+
+	if input.Version != "" {
+		members, standby := ring.Members()
+		found := false
+		for _, node := range append(members, standby...) {
+			found = found || node.Version == input.Version
+		}
+		if !found {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "No healthy node runs that version."})
+			return
+		}
+	}
+
+	deployment, err := placement.Activate(discovery, input.Version, delay)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not switch deployment."})
+		return
+	}
+	log.Printf("Deployment switching to version %q at %s", deployment.Version, deployment.At.Format(time.RFC3339))
+	getDeployment(ctx)
+}
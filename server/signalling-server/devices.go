@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+)
+
+// claim applies the session's Devices policy to a connect from a user who
+// is already connected on another connection, such as a second tab. It
+// returns the user ID the connection joins as, and false when it must not
+// join and should be dropped.
+//
+// A user ID the room already knows, whether its participant is connected,
+// suspended waiting to resume or has left, is only given to a connection
+// proving it is the same person: signed in to their account, presenting
+// their resume token, on their embed socket or carrying their identity
+// token. Anyone else is refused, so the user IDs shown in the roster cannot
+// be used to take over a place. LTI user IDs, which carry host rights on
+// their course's meetings, are only ever given to their identity token.
+func claim(clients *interfaces.Room, connection *interfaces.Connection, userID, token string) (string, bool) {
+	existing := clients.Get(userID)
+	if existing == connection {
+		return userID, true
+	}
+	bound := connection.Identity == userID
+	if lti.Reserved(userID) && !bound {
+		connection.Send(interfaces.Message{Type: "error", UserID: userID, Text: "identity_required"})
+		connection.Disconnect(interfaces.CloseNotAllowed, "identity_required")
+		return "", false
+	}
+	if connection.Embed == nil && !bound && !clients.Proves(userID, connection, token) {
+		connection.Send(interfaces.Message{Type: "error", UserID: userID, Text: "user_id_taken"})
+		connection.Disconnect(interfaces.CloseNotAllowed, "user_id_taken")
+		return "", false
+	}
+	if existing == nil {
+		return userID, true
+	}
+
+	switch clients.Settings.Devices {
+	case interfaces.DevicesReject:
+		connection.Send(interfaces.Message{Type: "error", UserID: userID, Text: "already_connected"})
+		connection.Disconnect(interfaces.CloseNotAllowed, "already_connected")
+		return "", false
+
+	case interfaces.DevicesAllow:
+		return clients.Device(userID), true
+
+	default:
+		// The participant keeps their place and ID; the old connection is
+		// told why it is closed so it does not try to reconnect.
+		if old := clients.Replace(userID, connection); old != nil && old != connection {
+			go func() {
+				old.Send(interfaces.Message{Type: "session_replaced", UserID: userID})
+				old.Disconnect(interfaces.CloseReplaced, "session_replaced")
+			}()
+		}
+		return userID, true
+	}
+}
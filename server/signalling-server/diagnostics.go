@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// Bounds on a diagnostics upload. Logs and stats beyond their limit are cut
+// from the front, keeping the most recent.
+const (
+	maxDiagnosticsBytes = 4 << 20
+	maxDiagnosticsLogs  = 2000
+	maxDiagnosticsStats = 120
+	maxDiagnosticsNote  = 2000
+)
+
+// uploadDiagnostics stores a diagnostics bundle from a participant's
+// client, linked to their participant record. The participant proves who
+// they are with the resume token they were given in session_joined, so it
+// works for guests too.
+func uploadDiagnostics(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDiagnosticsBytes)
+	var input struct {
+		UserID      string                   `json:"userID" binding:"required"`
+		ResumeToken string                   `json:"resumeToken" binding:"required"`
+		Note        string                   `json:"note"`
+		Logs        []string                 `json:"logs"`
+		Stats       []map[string]interface{} `json:"stats"`
+		PreflightID string                   `json:"preflightID"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Diagnostics bundle too large."})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	socket, clients, ok := ownedRoom(c)
+	if !ok {
+		return
+	}
+	participant, ok := clients.Participant(input.UserID)
+	if !ok || subtle.ConstantTimeCompare([]byte(participant.ResumeToken), []byte(input.ResumeToken)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a participant of this session."})
+		return
+	}
+
+	preflights := database.Database("vidchat").Collection("preflight")
+	if input.PreflightID != "" {
+		count, err := preflights.CountDocuments(c, bson.M{"_id": input.PreflightID, "sessionID": clients.Session})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown preflight for this session."})
+			return
+		}
+	}
+
+	if runes := []rune(input.Note); len(runes) > maxDiagnosticsNote {
+		input.Note = string(runes[:maxDiagnosticsNote])
+	}
+	if len(input.Logs) > maxDiagnosticsLogs {
+		input.Logs = input.Logs[len(input.Logs)-maxDiagnosticsLogs:]
+	}
+	if len(input.Stats) > maxDiagnosticsStats {
+		input.Stats = input.Stats[len(input.Stats)-maxDiagnosticsStats:]
+	}
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	bundle := interfaces.DiagnosticsBundle{
+		ID:            hex.EncodeToString(id),
+		SessionID:     clients.Session,
+		Socket:        socket,
+		ParticipantID: participant.ID,
+		UserID:        participant.UserID,
+		Name:          participant.Name,
+		IP:            c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		CreatedAt:     time.Now(),
+		Note:          input.Note,
+		Logs:          input.Logs,
+		Stats:         input.Stats,
+		PreflightID:   input.PreflightID,
+	}
+	if _, err := database.Database("vidchat").Collection("diagnostics").InsertOne(c, bundle); err != nil {
+		log.Printf("Error saving diagnostics from %s in %s: %s", participant.ID, socket, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save diagnostics."})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": bundle.ID})
+}
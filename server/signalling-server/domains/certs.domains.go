@@ -0,0 +1,48 @@
+package domains
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// CertCache keeps autocert's account key and certificates in the
+// certificates collection, so every node serves the same certificates and
+// a restart does not request new ones.
+type CertCache struct {
+	collection *mongo.Collection
+}
+
+func NewCertCache(db *mongo.Client) *CertCache {
+	return &CertCache{collection: db.Database("vidchat").Collection("certificates")}
+}
+
+type certEntry struct {
+	Key       string    `bson:"_id"`
+	Data      []byte    `bson:"data"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+func (c *CertCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var entry certEntry
+	err := c.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return nil, autocert.ErrCacheMiss
+	}
+	return entry.Data, err
+}
+
+func (c *CertCache) Put(ctx context.Context, key string, data []byte) error {
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": key},
+		certEntry{Key: key, Data: data, UpdatedAt: time.Now()}, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (c *CertCache) Delete(ctx context.Context, key string) error {
+	_, err := c.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,255 @@
+// Package domains lets orgs serve their meeting links from their own domain:
+// proving they own it through DNS, mapping requests for it back to the org,
+// and getting it certificates.
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recordPrefix is the label the verification TXT record is set on, and
+// valuePrefix starts its value.
+const (
+	recordPrefix = "_videoconf-challenge."
+	valuePrefix  = "videoconf-verification="
+)
+
+var (
+	// ErrInvalid is returned for names that are not a registrable domain.
+	ErrInvalid = errors.New("invalid domain")
+	// ErrTaken is returned when another org already registered the domain.
+	ErrTaken = errors.New("domain already registered")
+	// ErrUnverified is returned when the verification record is missing.
+	ErrUnverified = errors.New("verification record not found")
+	// ErrNotFound is returned for domains the org has not registered.
+	ErrNotFound = errors.New("domain not found")
+)
+
+var hostname = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Normalize lowercases name and strips a trailing dot and port.
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// Record returns the TXT record name and value that verify the domain.
+func Record(domain interfaces.Domain) (string, string) {
+	return recordPrefix + domain.Name, valuePrefix + domain.Token
+}
+
+type cachedOrg struct {
+	org     string
+	fetched time.Time
+}
+
+// Registry keeps the domains orgs registered in the domains collection and
+// resolves request hosts to the org owning them, caching lookups for a short
+// while.
+type Registry struct {
+	collection *mongo.Collection
+	// reserved are the deployment's own hosts, which no org can register.
+	reserved map[string]bool
+	lookup   func(ctx context.Context, name string) ([]string, error)
+
+	mu    sync.Mutex
+	hosts map[string]cachedOrg
+}
+
+func NewRegistry(db *mongo.Client, reserved ...string) *Registry {
+	r := &Registry{
+		collection: db.Database("vidchat").Collection("domains"),
+		reserved:   make(map[string]bool),
+		lookup:     net.DefaultResolver.LookupTXT,
+		hosts:      make(map[string]cachedOrg),
+	}
+	for _, host := range reserved {
+		if host = Normalize(host); host != "" {
+			r.reserved[host] = true
+		}
+	}
+	return r
+}
+
+// Add registers name for org, returning it with the token its TXT record
+// must carry. Registering a domain the org already has returns it as is. A
+// domain another org registered but never verified is handed over with a
+// new token, so nobody can hold on to a domain they do not control.
+func (r *Registry) Add(ctx context.Context, org, name string) (interfaces.Domain, error) {
+	name = Normalize(name)
+	if !hostname.MatchString(name) || r.reserved[name] {
+		return interfaces.Domain{}, ErrInvalid
+	}
+
+	var existing interfaces.Domain
+	err := r.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&existing)
+	switch {
+	case err == nil && existing.OrgID == org:
+		return existing, nil
+	case err == nil && existing.VerifiedAt != nil:
+		return interfaces.Domain{}, ErrTaken
+	case err != nil && err != mongo.ErrNoDocuments:
+		return interfaces.Domain{}, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return interfaces.Domain{}, err
+	}
+	domain := interfaces.Domain{Name: name, OrgID: org, Token: hex.EncodeToString(token), CreatedAt: time.Now()}
+	if existing.Name == "" {
+		_, err = r.collection.InsertOne(ctx, domain)
+	} else {
+		var result *mongo.UpdateResult
+		result, err = r.collection.ReplaceOne(ctx, bson.M{"_id": name, "orgID": existing.OrgID, "verifiedAt": bson.M{"$exists": false}}, domain)
+		if err == nil && result.MatchedCount == 0 {
+			return interfaces.Domain{}, ErrTaken
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return interfaces.Domain{}, ErrTaken
+	}
+	return domain, err
+}
+
+// List returns the org's domains.
+func (r *Registry) List(ctx context.Context, org string) ([]interfaces.Domain, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"orgID": org}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	domains := []interfaces.Domain{}
+	err = cursor.All(ctx, &domains)
+	return domains, err
+}
+
+// Verify looks up the domain's TXT record and, when it carries the
+// domain's token, marks it verified.
+func (r *Registry) Verify(ctx context.Context, org, name string) (interfaces.Domain, error) {
+	var domain interfaces.Domain
+	err := r.collection.FindOne(ctx, bson.M{"_id": Normalize(name), "orgID": org}).Decode(&domain)
+	if err == mongo.ErrNoDocuments {
+		return domain, ErrNotFound
+	}
+	if err != nil {
+		return domain, err
+	}
+
+	record, value := Record(domain)
+	values, err := r.lookup(ctx, record)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return domain, ErrUnverified
+		}
+		return domain, err
+	}
+	found := false
+	for _, txt := range values {
+		found = found || strings.TrimSpace(txt) == value
+	}
+	if !found {
+		return domain, ErrUnverified
+	}
+
+	if domain.VerifiedAt == nil {
+		now := time.Now()
+		domain.VerifiedAt = &now
+		if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": domain.Name}, bson.M{"$set": bson.M{"verifiedAt": now}}); err != nil {
+			return domain, err
+		}
+		r.forget(domain.Name)
+	}
+	return domain, nil
+}
+
+// Remove unregisters the org's domain.
+func (r *Registry) Remove(ctx context.Context, org, name string) error {
+	name = Normalize(name)
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": name, "orgID": org})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	r.forget(name)
+	return nil
+}
+
+// Org returns the org owning the verified domain host, or "" for any
+// other host, including the deployment's own.
+func (r *Registry) Org(ctx context.Context, host string) string {
+	host = Normalize(host)
+	if host == "" || r.reserved[host] || !hostname.MatchString(host) {
+		return ""
+	}
+
+	r.mu.Lock()
+	cached, ok := r.hosts[host]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < 30*time.Second {
+		return cached.org
+	}
+
+	var domain interfaces.Domain
+	err := r.collection.FindOne(ctx, bson.M{"_id": host, "verifiedAt": bson.M{"$exists": true}}).Decode(&domain)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Error resolving domain %s: %s", host, err)
+		return ""
+	}
+
+	r.mu.Lock()
+	r.hosts[host] = cachedOrg{org: domain.OrgID, fetched: time.Now()}
+	r.mu.Unlock()
+	return domain.OrgID
+}
+
+// Primary returns the org's first verified domain, or "" if it has none.
+func (r *Registry) Primary(ctx context.Context, org string) string {
+	if org == "" {
+		return ""
+	}
+	var domain interfaces.Domain
+	err := r.collection.FindOne(ctx,
+		bson.M{"orgID": org, "verifiedAt": bson.M{"$exists": true}},
+		options.FindOne().SetSort(bson.M{"verifiedAt": 1}),
+	).Decode(&domain)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Error loading domains of %s: %s", org, err)
+	}
+	return domain.Name
+}
+
+// HostPolicy only lets certificates be requested for the deployment's own
+// hosts and verified domains. It has autocert.HostPolicy's signature.
+func (r *Registry) HostPolicy(ctx context.Context, host string) error {
+	if r.reserved[Normalize(host)] || r.Org(ctx, host) != "" {
+		return nil
+	}
+	return errors.New("domains: host " + host + " is not registered")
+}
+
+func (r *Registry) forget(host string) {
+	r.mu.Lock()
+	delete(r.hosts, host)
+	r.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// drain takes this node out of the placement ring and hands every room it
+// holds to the nodes that own them now. New joins are redirected while
+// draining, and /health reports unavailable so load balancers and
+// readiness probes stop routing here.
+func drain() {
+	if ring.Drain() {
+		handoff()
+	}
+}
+
+// stats counts the rooms and connections held by this node.
+func stats() (rooms int, connections int) {
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+
+	for _, clients := range sockets {
+		if n := clients.Len(); n > 0 {
+			rooms++
+			connections += n
+		}
+	}
+	return rooms, connections
+}
+
+// awaitDrained waits until no rooms are left on this node or timeout passes.
+func awaitDrained(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if rooms, _ := stats(); rooms == 0 {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	rooms, connections := stats()
+	log.Printf("Drain timed out with %d rooms and %d connections left", rooms, connections)
+}
+
+func getDrain(ctx *gin.Context) {
+	rooms, connections := stats()
+	ctx.JSON(http.StatusOK, gin.H{
+		"node":        ring.Self(),
+		"draining":    ring.Draining(),
+		"rooms":       rooms,
+		"connections": connections,
+	})
+}
+
+func postDrain(ctx *gin.Context) {
+	log.Println("Drain requested through admin API")
+	drain()
+	getDrain(ctx)
+}
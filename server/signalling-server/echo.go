@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// expireEchoTests ends the echo tests past their expiry every interval, so
+// a user who closed the page does not leave a media node echoing. Each test
+// is claimed by marking it stopped, so only one node ends it.
+func expireEchoTests(db *mongo.Client, topology *media.Topology, interval time.Duration) {
+	collection := db.Database("vidchat").Collection("echo_tests")
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		for {
+			var test interfaces.EchoTest
+			err := collection.FindOneAndUpdate(ctx,
+				bson.M{"stoppedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$lt": time.Now()}},
+				bson.M{"$set": bson.M{"stoppedAt": time.Now(), "expired": true}},
+			).Decode(&test)
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			if err != nil {
+				log.Printf("Error expiring echo tests: %s", err)
+				break
+			}
+			if stats := topology.EndEchoTest(ctx, test); stats != nil {
+				collection.UpdateOne(ctx, bson.M{"_id": test.ID}, bson.M{"$set": bson.M{"stats": stats}})
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// embedSocket resolves the socket parameter of a WebSocket to the room it
+// connects to. Embed token holders connect to the embed socket
+// ConnectSession issued them, returned along with the room's socket; an
+// unknown or expired one is refused with 401 and reported as not ok.
+// Everyone else names the room's socket and gets a nil embed socket.
+func embedSocket(w http.ResponseWriter, r *http.Request, param string) (string, *interfaces.EmbedSocket, bool) {
+	id, ok := strings.CutPrefix(param, interfaces.EmbedSocketPrefix)
+	if !ok {
+		return param, nil, true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	var embed interfaces.EmbedSocket
+	err := database.Database("vidchat").Collection("embed_sockets").FindOne(ctx, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&embed)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", nil, false
+	}
+	return embed.Socket, &embed, true
+}
+
+// embedIdentity reports whether a frame from an embedded connection is
+// sent as the user its embed socket was issued to, or one of their other
+// devices, so the grant's restrictions cannot be escaped by acting as
+// someone else.
+func embedIdentity(connection *interfaces.Connection, envelope interfaces.Envelope) bool {
+	if connection.Embed == nil {
+		return true
+	}
+	userID := connection.Embed.UserID
+	return envelope.UserID == userID || strings.HasPrefix(envelope.UserID, userID+"#")
+}
+
+// embedPath is the path a client reconnects to the room on: its embed
+// socket when it has one, the room's socket otherwise.
+func embedPath(socket string, connection *interfaces.Connection) string {
+	if connection.Embed != nil {
+		return "/ws/" + interfaces.EmbedSocketPrefix + connection.Embed.ID
+	}
+	return "/ws/" + socket
+}
+
+// embedJoined gives a participant connecting on an embed socket the role
+// and restrictions its grant carries. They outlive the connection, so
+// resuming does not lift them.
+func embedJoined(clients *interfaces.Room, grant *interfaces.EmbedGrant, userID string) {
+	if grant.Role != "" {
+		clients.SetRole(userID, grant.Role)
+	}
+	clients.SetDisabled(userID, grant.Disabled)
+}
+
+// refuseDisabled tells a participant the feature they tried to use was
+// disabled by their embed token.
+func refuseDisabled(connection *interfaces.Connection, envelope interfaces.Envelope) {
+	connection.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "feature_disabled", Data: gin.H{"type": envelope.Type}})
+}
@@ -0,0 +1,276 @@
+// Package export builds data portability archives: a zip of everything the
+// services store about a user, plus the recordings of meetings they own.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StaleAfter is how long an export may stay pending before it is assumed
+// lost, e.g. because the node building it restarted.
+const StaleAfter = time.Hour
+
+// Retention is how long a finished archive can be downloaded.
+const Retention = 7 * 24 * time.Hour
+
+// readme is included in every archive to explain its layout.
+const readme = `This archive holds the data stored about your account:
+
+  profile.json      your account, without the password
+  preferences.json  your meeting preferences
+  contacts.json     your contacts and blocked users
+  devices.json      the devices you signed in on
+  meetings.json     the meetings you created
+  recordings.json   recordings of those meetings; files under recordings/
+
+Chat messages are relayed between participants and never stored, so there
+are none to export.
+`
+
+type Exporter struct {
+	db    *mongo.Database
+	store storage.BlobStore
+}
+
+func NewExporter(db *mongo.Client, store storage.BlobStore) *Exporter {
+	return &Exporter{db: db.Database("vidchat"), store: store}
+}
+
+// Run builds the archive for a pending export and records the outcome.
+func (e *Exporter) Run(export interfaces.Export) {
+	ctx, cancel := context.WithTimeout(context.Background(), StaleAfter)
+	defer cancel()
+
+	update := bson.M{"completedAt": time.Now()}
+	key, size, err := e.build(ctx, export)
+	if err != nil {
+		log.Printf("Export %s failed: %s", export.ID, err)
+		update["status"] = interfaces.ExportFailed
+		update["error"] = "Could not build the archive."
+	} else {
+		update["status"] = interfaces.ExportReady
+		update["key"] = key
+		update["size"] = size
+		update["expiresAt"] = time.Now().Add(Retention)
+	}
+
+	_, err = e.db.Collection("exports").UpdateOne(context.Background(), bson.M{"_id": export.ID}, bson.M{"$set": update})
+	if err != nil {
+		log.Printf("Error saving export %s: %s", export.ID, err)
+	}
+}
+
+// build writes the archive to a temporary file, then uploads it.
+func (e *Exporter) build(ctx context.Context, export interfaces.Export) (string, int64, error) {
+	userID, err := primitive.ObjectIDFromHex(export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	file, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	if err := e.write(ctx, archive, userID); err != nil {
+		return "", 0, err
+	}
+	if err := archive.Close(); err != nil {
+		return "", 0, err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	key := "exports/" + export.ID + "/export.zip"
+	if err := e.store.Put(ctx, key, file, size, "application/zip"); err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+func (e *Exporter) write(ctx context.Context, archive *zip.Writer, userID primitive.ObjectID) error {
+	if err := writeFile(archive, "README.txt", []byte(readme)); err != nil {
+		return err
+	}
+
+	var profile bson.M
+	if err := e.db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&profile); err != nil {
+		return err
+	}
+	delete(profile, "password")
+	if err := writeJSON(archive, "profile.json", profile); err != nil {
+		return err
+	}
+
+	var preferences bson.M
+	err := e.db.Collection("preferences").FindOne(ctx, bson.M{"_id": userID}).Decode(&preferences)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err := writeJSON(archive, "preferences.json", preferences); err != nil {
+		return err
+	}
+
+	sections := []struct {
+		name       string
+		collection string
+		filter     bson.M
+		omit       []string
+	}{
+		{"contacts.json", "contacts", bson.M{"ownerID": userID}, []string{"listed"}},
+		{"devices.json", "login_sessions", bson.M{"userID": userID}, []string{"refreshHash"}},
+		{"meetings.json", "sessions", bson.M{"ownerID": userID.Hex()}, []string{"password"}},
+	}
+	for _, section := range sections {
+		documents, err := e.find(ctx, section.collection, section.filter)
+		if err != nil {
+			return err
+		}
+		for _, document := range documents {
+			for _, field := range section.omit {
+				delete(document, field)
+			}
+		}
+		if err := writeJSON(archive, section.name, documents); err != nil {
+			return err
+		}
+	}
+
+	return e.writeRecordings(ctx, archive, userID.Hex())
+}
+
+// writeRecordings adds the recordings of the user's meetings, with the
+// processed video of each one that is ready.
+func (e *Exporter) writeRecordings(ctx context.Context, archive *zip.Writer, owner string) error {
+	meetings, err := e.find(ctx, "sessions", bson.M{"ownerID": owner})
+	if err != nil {
+		return err
+	}
+	sessionIDs := make([]string, 0, len(meetings))
+	for _, meeting := range meetings {
+		if id, ok := meeting["_id"].(primitive.ObjectID); ok {
+			sessionIDs = append(sessionIDs, id.Hex())
+		}
+	}
+
+	recordings := []interfaces.Recording{}
+	if len(sessionIDs) > 0 {
+		cursor, err := e.db.Collection("recordings").Find(ctx, bson.M{"sessionID": bson.M{"$in": sessionIDs}})
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &recordings); err != nil {
+			return err
+		}
+	}
+	if err := writeJSON(archive, "recordings.json", recordings); err != nil {
+		return err
+	}
+
+	for _, recording := range recordings {
+		if recording.Status != interfaces.RecordingReady || recording.Output == "" {
+			continue
+		}
+		if err := e.copyBlob(ctx, archive, "recordings/"+recording.ID+path.Ext(recording.Output), recording.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) copyBlob(ctx context.Context, archive *zip.Writer, name, key string) error {
+	body, err := e.store.Get(ctx, key, 0, -1)
+	if err == storage.ErrNotFound {
+		log.Printf("Export: %s is missing, skipping it", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Video is already compressed; storing it avoids wasting CPU.
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (e *Exporter) find(ctx context.Context, collection string, filter bson.M) ([]bson.M, error) {
+	cursor, err := e.db.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	documents := []bson.M{}
+	err = cursor.All(ctx, &documents)
+	return documents, err
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(archive, name, data)
+}
+
+func writeFile(archive *zip.Writer, name string, data []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Sweep deletes archives past their retention, every interval.
+func (e *Exporter) Sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		cursor, err := e.db.Collection("exports").Find(ctx, bson.M{"expiresAt": bson.M{"$lt": time.Now()}})
+		if err != nil {
+			log.Printf("Error listing expired exports: %s", err)
+			cancel()
+			continue
+		}
+		var expired []interfaces.Export
+		if err := cursor.All(ctx, &expired); err != nil {
+			log.Printf("Error listing expired exports: %s", err)
+		}
+		for _, old := range expired {
+			if old.Key != "" {
+				if err := e.store.Delete(ctx, old.Key); err != nil && err != storage.ErrNotFound {
+					log.Printf("Error deleting export %s: %s", old.ID, err)
+					continue
+				}
+			}
+			e.db.Collection("exports").DeleteOne(ctx, bson.M{"_id": old.ID})
+		}
+		cancel()
+	}
+}
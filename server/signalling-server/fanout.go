@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// fanout delivers frames through each recipient's bounded outbound queue.
+// Queues are drained by a fixed pool of workers shared by all rooms, bounding
+// the number of concurrent writes on the node regardless of room sizes, and a
+// reader never waits on a slow recipient.
+type fanout struct {
+	flushes chan *interfaces.Connection
+	timeout time.Duration
+	policy  *interfaces.QueuePolicy
+}
+
+func newFanout(workers int, timeout time.Duration, policy *interfaces.QueuePolicy) *fanout {
+	f := &fanout{
+		flushes: make(chan *interfaces.Connection, workers*4),
+		timeout: timeout,
+		policy:  policy,
+	}
+
+	for i := 0; i < workers; i++ {
+		go f.work()
+	}
+	return f
+}
+
+func (f *fanout) work() {
+	for client := range f.flushes {
+		if err := client.Flush(f.timeout, f.policy); err != nil {
+			client.Close()
+		}
+	}
+}
+
+// schedule hands client to a worker, after the batch window if one is set.
+func (f *fanout) schedule(client *interfaces.Connection) {
+	if f.policy.BatchWindow <= 0 {
+		f.hand(client)
+		return
+	}
+	time.AfterFunc(f.policy.BatchWindow, func() {
+		f.hand(client)
+	})
+}
+
+// flushRetry is how long a flush waits when every worker is busy.
+const flushRetry = 10 * time.Millisecond
+
+// hand queues client for a worker without waiting, so a saturated pool
+// never stalls the reader relaying to it. Its frames stay queued on the
+// connection, and are handed again shortly when the pool is full.
+func (f *fanout) hand(client *interfaces.Connection) {
+	select {
+	case f.flushes <- client:
+	default:
+		time.AfterFunc(flushRetry, func() {
+			f.hand(client)
+		})
+	}
+}
+
+// Broadcast queues frame, a message of the given type, for every client,
+// stamped with the time it is sent. It returns the clients that are gone,
+// either closed or disconnected as slow consumers.
+func (f *fanout) Broadcast(clients map[string]*interfaces.Connection, frame json.RawMessage, messageType string) map[string]*interfaces.Connection {
+	return f.Relay(clients, stamp(frame, 0, time.Now()), messageType, "", 0)
+}
+
+// Relay is Broadcast for a frame sender relays, numbered seq, which every
+// client gets after the sender's earlier frames. The frame must already be
+// stamped, and must not be modified afterwards.
+func (f *fanout) Relay(clients map[string]*interfaces.Connection, frame json.RawMessage, messageType, sender string, seq uint64) map[string]*interfaces.Connection {
+	failed := make(map[string]*interfaces.Connection)
+
+	for user, client := range clients {
+		schedule, err := client.Enqueue(frame, messageType, sender, seq, f.policy)
+		if err == interfaces.ErrOutOfOrder {
+			log.Printf("Dropping %s %d from %s to %s: a later message was already sent", messageType, seq, sender, user)
+			continue
+		}
+		if err == interfaces.ErrSlowConsumer {
+			log.Printf("Disconnecting slow consumer %s (%d frames dropped)", user, client.Dropped)
+			go client.Disconnect(interfaces.CloseSlowConsumer, "slow_consumer")
+		}
+		if err != nil {
+			failed[user] = client
+			continue
+		}
+
+		if schedule {
+			f.schedule(client)
+		}
+	}
+
+	return failed
+}
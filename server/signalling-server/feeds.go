@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// feedBuffer is how many events a feed holds for a target that fell
+// behind; later events are dropped until it catches up.
+const feedBuffer = 256
+
+// A feed posts to its target every feedBatch, or as soon as it has
+// feedBatchSize events, so overlays lag the room by a second at most.
+const (
+	feedBatch     = time.Second
+	feedBatchSize = 100
+)
+
+// feedStream runs an active feed of a room on this node.
+type feedStream struct {
+	feed   interfaces.Feed
+	events chan interfaces.FeedEvent
+	done   chan struct{}
+	seq    atomic.Int64
+}
+
+var (
+	feedsMu sync.Mutex
+	// feedStreams holds the running feeds of each local room, by ID.
+	feedStreams = make(map[string]map[string]*feedStream)
+	// feedViewers holds the WebSockets opened on each feed, by feed ID.
+	// They may connect before the room starts.
+	feedViewers = make(map[string]map[*websocket.Conn]bool)
+	// feedsAsked holds the hosts asked about each pending feed of each
+	// local room.
+	feedsAsked = make(map[string]map[string]map[string]bool)
+
+	feedClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// publishFeed hands a room event to the room's running feeds that want it.
+func publishFeed(socket string, event interfaces.FeedEvent) {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	for _, stream := range feedStreams[socket] {
+		if !stream.feed.Wants(event.Type) {
+			continue
+		}
+		event.Seq = stream.seq.Add(1)
+		select {
+		case stream.events <- event:
+		default:
+		}
+	}
+}
+
+// feedParticipant returns an event about the participant, who is known by
+// their ID in the room and their display name only.
+func feedParticipant(eventType string, participant interfaces.Participant) interfaces.FeedEvent {
+	return interfaces.FeedEvent{
+		At:            time.Now(),
+		Type:          eventType,
+		ParticipantID: participant.ID,
+		Name:          participant.Name,
+		Role:          participant.Role,
+	}
+}
+
+// feedRelayed hands a message relayed to the whole room to its feeds, when
+// feeds carry its type. Direct messages never reach feeds.
+func feedRelayed(socket string, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) {
+	if envelope.To != "" || !interfaces.ValidFeedEvent(envelope.Type) {
+		return
+	}
+	participant, ok := clients.Participant(envelope.UserID)
+	if !ok {
+		return
+	}
+	event := feedParticipant(envelope.Type, participant)
+	switch envelope.Type {
+	case interfaces.FeedChat:
+		var message interfaces.Message
+		json.Unmarshal(frame, &message)
+		event.Text = message.Text
+	case interfaces.FeedReaction:
+		var reaction struct {
+			Data struct {
+				Emoji string `json:"emoji"`
+			} `json:"data"`
+		}
+		json.Unmarshal(frame, &reaction)
+		event.Emoji = reaction.Data.Emoji
+	}
+	publishFeed(socket, event)
+}
+
+// runningFeeds lists the room's running feeds, so everyone joining knows
+// what its events are streamed to.
+func runningFeeds(socket string) []gin.H {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	feeds := []gin.H{}
+	for id, stream := range feedStreams[socket] {
+		feeds = append(feeds, gin.H{"id": id, "name": stream.feed.Name, "events": stream.feed.Events})
+	}
+	return feeds
+}
+
+// feedControl handles a host's approve_feed, deny_feed and stop_feed,
+// which decide on a pending feed or stop an active one.
+func feedControl(socket string, clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if !hostOn(clients, connection, envelope.UserID) {
+		return
+	}
+	var request struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &request)
+	id, err := primitive.ObjectIDFromHex(request.Data.ID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	filter := bson.M{"_id": id, "socket": socket, "status": interfaces.FeedPending}
+	update := bson.M{"decidedBy": envelope.UserID, "decidedAt": now}
+	switch envelope.Type {
+	case "approve_feed":
+		update["status"] = interfaces.FeedActive
+	case "deny_feed":
+		update["status"] = interfaces.FeedDenied
+	case "stop_feed":
+		filter["status"] = interfaces.FeedActive
+		update = bson.M{"status": interfaces.FeedStopped, "stoppedAt": now}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := database.Database("vidchat").Collection("feeds").UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		log.Printf("Error deciding on feed %s: %s", request.Data.ID, err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		go syncFeeds(map[string]*interfaces.Room{socket: clients})
+	}
+}
+
+// watchFeeds keeps the feeds of this node's rooms running as hosts decide
+// on them, checking every interval.
+func watchFeeds(interval time.Duration) {
+	for range time.Tick(interval) {
+		rooms := localRooms()
+		feedsMu.Lock()
+		var gone []*feedStream
+		for socket, streams := range feedStreams {
+			if rooms[socket] != nil {
+				continue
+			}
+			for _, stream := range streams {
+				gone = append(gone, stream)
+			}
+			delete(feedStreams, socket)
+		}
+		for socket := range feedsAsked {
+			if rooms[socket] == nil {
+				delete(feedsAsked, socket)
+			}
+		}
+		feedsMu.Unlock()
+		for _, stream := range gone {
+			close(stream.done)
+		}
+
+		syncFeeds(rooms)
+		closeStoppedViewers()
+	}
+}
+
+// syncFeeds starts the rooms' approved feeds and stops those that no
+// longer are, telling the room either way. Hosts are asked about new
+// requests, each once.
+func syncFeeds(rooms map[string]*interfaces.Room) {
+	if len(rooms) == 0 {
+		return
+	}
+	sockets := make([]string, 0, len(rooms))
+	for socket := range rooms {
+		sockets = append(sockets, socket)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := database.Database("vidchat").Collection("feeds").Find(ctx, bson.M{
+		"socket": bson.M{"$in": sockets},
+		"status": bson.M{"$in": bson.A{interfaces.FeedPending, interfaces.FeedActive}},
+	})
+	if err != nil {
+		log.Printf("Error loading feeds: %s", err)
+		return
+	}
+	var feeds []interfaces.Feed
+	if err := cursor.All(ctx, &feeds); err != nil {
+		log.Printf("Error loading feeds: %s", err)
+		return
+	}
+
+	active := make(map[string]interfaces.Feed)
+	pending := make(map[string]bool)
+	for _, feed := range feeds {
+		switch feed.Status {
+		case interfaces.FeedActive:
+			active[feed.ID.Hex()] = feed
+		case interfaces.FeedPending:
+			pending[feed.ID.Hex()] = true
+			askHosts(rooms[feed.Socket], feed)
+		}
+	}
+
+	var started, stopped []*feedStream
+	feedsMu.Lock()
+	for socket := range rooms {
+		for id := range feedsAsked[socket] {
+			if !pending[id] {
+				delete(feedsAsked[socket], id)
+			}
+		}
+		for id, stream := range feedStreams[socket] {
+			if _, ok := active[id]; !ok {
+				stopped = append(stopped, stream)
+				delete(feedStreams[socket], id)
+			}
+		}
+	}
+	for id, feed := range active {
+		if feedStreams[feed.Socket][id] != nil {
+			continue
+		}
+		if feedStreams[feed.Socket] == nil {
+			feedStreams[feed.Socket] = make(map[string]*feedStream)
+		}
+		stream := &feedStream{feed: feed, events: make(chan interfaces.FeedEvent, feedBuffer), done: make(chan struct{})}
+		feedStreams[feed.Socket][id] = stream
+		started = append(started, stream)
+	}
+	feedsMu.Unlock()
+
+	for _, stream := range stopped {
+		close(stream.done)
+		broadcast(stream.feed.Socket, interfaces.Message{Type: "feed_stopped", Data: gin.H{"id": stream.feed.ID.Hex(), "name": stream.feed.Name}})
+	}
+	for _, stream := range started {
+		go stream.run()
+		broadcast(stream.feed.Socket, interfaces.Message{Type: "feed_started", Data: gin.H{"id": stream.feed.ID.Hex(), "name": stream.feed.Name, "events": stream.feed.Events}})
+	}
+}
+
+// askHosts asks the room's hosts to approve or deny a pending feed, unless
+// they were asked already.
+func askHosts(clients *interfaces.Room, feed interfaces.Feed) {
+	id := feed.ID.Hex()
+	message := interfaces.Message{Type: "feed_requested", Data: gin.H{
+		"id":      id,
+		"name":    feed.Name,
+		"events":  feed.Events,
+		"webhook": feed.TargetURL != "",
+	}}
+	for userID, client := range clients.Clients() {
+		if clients.Role(userID) != interfaces.RoleHost {
+			continue
+		}
+		feedsMu.Lock()
+		if feedsAsked[feed.Socket] == nil {
+			feedsAsked[feed.Socket] = make(map[string]map[string]bool)
+		}
+		if feedsAsked[feed.Socket][id] == nil {
+			feedsAsked[feed.Socket][id] = make(map[string]bool)
+		}
+		asked := feedsAsked[feed.Socket][id][userID]
+		feedsAsked[feed.Socket][id][userID] = true
+		feedsMu.Unlock()
+		if !asked {
+			client.Send(message)
+		}
+	}
+}
+
+// run delivers the feed's events until it is stopped: to its WebSockets as
+// they come, and to its target in batches.
+func (s *feedStream) run() {
+	ticker := time.NewTicker(feedBatch)
+	defer ticker.Stop()
+
+	var batch []interfaces.FeedEvent
+	for {
+		select {
+		case event := <-s.events:
+			s.send(event)
+			if s.feed.TargetURL == "" {
+				continue
+			}
+			batch = append(batch, event)
+			if len(batch) >= feedBatchSize {
+				s.post(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.post(batch)
+				batch = nil
+			}
+		case <-s.done:
+			if len(batch) > 0 {
+				s.post(batch)
+			}
+			return
+		}
+	}
+}
+
+// send writes the event to the feed's WebSockets, dropping those that fail.
+func (s *feedStream) send(event interfaces.FeedEvent) {
+	id := s.feed.ID.Hex()
+	feedsMu.Lock()
+	viewers := make([]*websocket.Conn, 0, len(feedViewers[id]))
+	for conn := range feedViewers[id] {
+		viewers = append(viewers, conn)
+	}
+	feedsMu.Unlock()
+
+	for _, conn := range viewers {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteJSON(event); err != nil {
+			conn.Close()
+			feedsMu.Lock()
+			delete(feedViewers[id], conn)
+			feedsMu.Unlock()
+		}
+	}
+}
+
+// post delivers a batch to the feed's target, signed like automation hooks.
+// A target answering 410 Gone stops the feed; other failures lose the
+// batch, since overlays have no use for late events.
+func (s *feedStream) post(batch []interfaces.FeedEvent) {
+	body, err := json.Marshal(gin.H{"feedID": s.feed.ID.Hex(), "sessionID": s.feed.SessionID, "events": batch})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), feedClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.feed.TargetURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Videoconf-Event", "feed.events")
+	automation.Sign(req, s.feed.Secret, body)
+
+	resp, err := feedClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusGone:
+			database.Database("vidchat").Collection("feeds").UpdateOne(ctx,
+				bson.M{"_id": s.feed.ID, "status": interfaces.FeedActive},
+				bson.M{"$set": bson.M{"status": interfaces.FeedStopped, "stoppedAt": time.Now()}})
+			return
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			err = fmt.Errorf("target answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		log.Printf("Error posting feed %s to %s: %s", s.feed.ID.Hex(), s.feed.TargetURL, err)
+	}
+}
+
+// closeStoppedViewers disconnects the WebSockets of feeds that were
+// denied or stopped, or whose room moved to another node.
+func closeStoppedViewers() {
+	feedsMu.Lock()
+	ids := make([]primitive.ObjectID, 0, len(feedViewers))
+	for id := range feedViewers {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			ids = append(ids, objectID)
+		}
+	}
+	feedsMu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := database.Database("vidchat").Collection("feeds").Find(ctx, bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": bson.M{"$in": bson.A{interfaces.FeedPending, interfaces.FeedActive}},
+	})
+	if err != nil {
+		return
+	}
+	var feeds []interfaces.Feed
+	if cursor.All(ctx, &feeds) != nil {
+		return
+	}
+	active := make(map[string]string, len(feeds))
+	for _, feed := range feeds {
+		active[feed.ID.Hex()] = feed.Socket
+	}
+
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	for id, viewers := range feedViewers {
+		socket, ok := active[id]
+		if ok && ring.Owns(socket) {
+			continue
+		}
+		// Viewers of a room that moved reconnect to their URL, which
+		// redirects them to its new node.
+		code, reason := websocket.CloseNormalClosure, "feed stopped"
+		if ok {
+			code, reason = interfaces.CloseMoved, "moved"
+		}
+		for conn := range viewers {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+			conn.Close()
+		}
+		delete(feedViewers, id)
+	}
+}
+
+// feedhandler serves the WebSocket an integrator follows a feed on, at the
+// signed URL it was given. It only carries events down, once a host
+// approved the feed; the feed's room must be on this node, or the
+// integrator is redirected like a participant would be.
+func feedhandler(w http.ResponseWriter, r *http.Request, signer *utils.URLSigner, id string) {
+	if !signer.Verify(interfaces.FeedSocketPath(id), r.URL.Query()) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var feed interfaces.Feed
+	err = database.Database("vidchat").Collection("feeds").FindOne(r.Context(), bson.M{
+		"_id":    objectID,
+		"status": bson.M{"$in": bson.A{interfaces.FeedPending, interfaces.FeedActive}},
+	}).Decode(&feed)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error handling feed connection: %s", err)
+		return
+	}
+	if !ring.Owns(feed.Socket) {
+		conn.WriteJSON(interfaces.Message{Type: "redirect", URL: ring.Owner(feed.Socket).URL + r.URL.RequestURI()})
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(interfaces.CloseMoved, "moved"), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+
+	feedsMu.Lock()
+	if feedViewers[id] == nil {
+		feedViewers[id] = make(map[*websocket.Conn]bool)
+	}
+	feedViewers[id][conn] = true
+	feedsMu.Unlock()
+	defer func() {
+		feedsMu.Lock()
+		delete(feedViewers[id], conn)
+		if len(feedViewers[id]) == 0 {
+			delete(feedViewers, id)
+		}
+		feedsMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
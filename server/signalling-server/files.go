@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// fileRelayLimit caps the bytes of a file the server relays when the peers
+// cannot connect directly; zero is no cap beyond the file's size.
+var fileRelayLimit int64
+
+// fileMessages are the messages of a file transfer. Each carries the
+// transfer's ID in data.id and is addressed to the other peer.
+var fileMessages = map[string]bool{
+	"file_offer":    true,
+	"file_accept":   true,
+	"file_reject":   true,
+	"file_cancel":   true,
+	"file_progress": true,
+	"file_complete": true,
+	"file_chunk":    true,
+}
+
+// screenFile checks a file transfer message against the room's file policy
+// and the transfer's state, and reports whether to relay it to the other
+// peer. A message that is not relayed is answered with a file_refused
+// error.
+//
+// The sender offers a file with file_offer (data: id, name, size, type);
+// the recipient answers with file_accept or file_reject. Either peer may
+// send file_progress and file_cancel, and the recipient file_complete. When
+// the peers' DataChannel cannot connect, the sender can send the file
+// through the server in file_chunk messages (data: id, seq, chunk in
+// base64), each acknowledged with a file_progress counting the bytes
+// relayed so far.
+func screenFile(connection *interfaces.Connection, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) bool {
+	var message struct {
+		Data struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			Size  int64  `json:"size"`
+			Type  string `json:"type"`
+			Chunk string `json:"chunk"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &message) != nil || message.Data.ID == "" {
+		refuseFile(connection, envelope, "", "invalid_message")
+		return false
+	}
+	id, user := message.Data.ID, envelope.UserID
+	policy := clients.Settings.Files
+	// Messages for a peer who left are not held for them.
+	if clients.Get(envelope.To) == nil {
+		refuseFile(connection, envelope, id, "peer_unavailable")
+		return false
+	}
+
+	if envelope.Type == "file_offer" {
+		if reason := policy.Allows(message.Data.Name, message.Data.Type, message.Data.Size); reason != "" {
+			refuseFile(connection, envelope, id, reason)
+			return false
+		}
+		err := clients.OfferFile(interfaces.FileTransfer{
+			ID:   id,
+			From: user,
+			To:   envelope.To,
+			Name: message.Data.Name,
+			Type: message.Data.Type,
+			Size: message.Data.Size,
+			At:   time.Now(),
+		})
+		if err != nil {
+			refuseFile(connection, envelope, id, err.Error())
+			return false
+		}
+		return true
+	}
+
+	transfer, ok := clients.File(id, user)
+	if !ok {
+		refuseFile(connection, envelope, id, "unknown_transfer")
+		return false
+	}
+	peer := transfer.To
+	if peer == user {
+		peer = transfer.From
+	}
+	if envelope.To != peer {
+		refuseFile(connection, envelope, id, "wrong_recipient")
+		return false
+	}
+
+	switch envelope.Type {
+	case "file_accept":
+		if _, ok := clients.AcceptFile(id, user); !ok {
+			refuseFile(connection, envelope, id, "not_recipient")
+			return false
+		}
+	case "file_reject", "file_cancel", "file_complete":
+		clients.EndFile(id, user)
+	case "file_chunk":
+		if policy.NoRelay {
+			refuseFile(connection, envelope, id, "relay_disabled")
+			return false
+		}
+		chunk, err := base64.StdEncoding.DecodeString(message.Data.Chunk)
+		if err != nil || len(chunk) == 0 {
+			refuseFile(connection, envelope, id, "invalid_message")
+			return false
+		}
+		if transfer, err = clients.RelayFile(id, user, int64(len(chunk)), fileRelayLimit); err != nil {
+			refuseFile(connection, envelope, id, err.Error())
+			return false
+		}
+		connection.Send(interfaces.Message{
+			Type:   "file_progress",
+			UserID: user,
+			Data:   gin.H{"id": id, "bytes": transfer.Relayed, "relayed": true},
+		})
+	}
+	return true
+}
+
+func refuseFile(connection *interfaces.Connection, envelope interfaces.Envelope, id, reason string) {
+	connection.Send(interfaces.Message{
+		Type:   "error",
+		UserID: envelope.UserID,
+		Text:   "file_refused",
+		Data:   gin.H{"type": envelope.Type, "id": id, "reason": reason},
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// stage is the media backend when it can stop webinar attendees from
+// publishing.
+var stage media.Stage
+
+// Floor transitions, sent in floor messages and recorded in the timeline.
+const (
+	floorRequested = "requested"
+	floorWithdrawn = "withdrawn"
+	floorGranted   = "granted"
+	floorDenied    = "denied"
+	floorRevoked   = "revoked"
+	floorReleased  = "released"
+)
+
+// floorControl handles webinar floor control. Attendees send request_floor
+// to join the queue and withdraw_floor to leave it, or to give the floor
+// back; hosts send grant_floor, deny_floor and revoke_floor naming the
+// attendee in data.userID. Every transition is broadcast as a floor message
+// carrying the queue, and recorded in the room's timeline.
+func floorControl(socket string, clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	user := envelope.UserID
+	switch envelope.Type {
+	case "request_floor":
+		if clients.RequestFloor(user) > 0 {
+			announceFloor(socket, clients, floorRequested, user, "")
+		}
+		return
+	case "withdraw_floor":
+		if clients.WithdrawFloor(user) {
+			announceFloor(socket, clients, floorWithdrawn, user, "")
+		} else if clients.RevokeFloor(user) {
+			announceFloor(socket, clients, floorReleased, user, "")
+			go publish(clients, user, false)
+		}
+		return
+	}
+
+	if !hostOn(clients, connection, user) {
+		return
+	}
+	var decision struct {
+		Data struct {
+			UserID string `json:"userID"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &decision) != nil || decision.Data.UserID == "" {
+		return
+	}
+	attendee := decision.Data.UserID
+
+	switch envelope.Type {
+	case "grant_floor":
+		if clients.GrantFloor(attendee) {
+			announceFloor(socket, clients, floorGranted, attendee, user)
+			go publish(clients, attendee, true)
+		}
+	case "deny_floor":
+		if clients.WithdrawFloor(attendee) {
+			announceFloor(socket, clients, floorDenied, attendee, user)
+		}
+	case "revoke_floor":
+		if clients.RevokeFloor(attendee) {
+			announceFloor(socket, clients, floorRevoked, attendee, user)
+			go publish(clients, attendee, false)
+		}
+	}
+}
+
+// announceFloor tells everyone in the room about a floor transition of the
+// attendee, made by host unless they made it themselves.
+func announceFloor(socket string, clients *interfaces.Room, event, attendee, host string) {
+	participant, _ := clients.Participant(attendee)
+	data := gin.H{
+		"event":         event,
+		"participantID": participant.ID,
+		"name":          participant.Name,
+		"role":          participant.Role,
+		"queue":         clients.Floor(),
+	}
+	audit := map[string]interface{}{"event": event, "role": participant.Role}
+	if by, ok := clients.Participant(host); ok {
+		data["by"] = by.ID
+		audit["by"] = by.ID
+	}
+	recordEvent(clients, analytics.EventFloor, attendee, audit)
+
+	frame, err := json.Marshal(interfaces.Message{Type: "floor", UserID: attendee, Data: data})
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+	for _, failed := range broadcaster.Broadcast(clients.Clients(), frame, "floor") {
+		suspend(clients, failed)
+	}
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+}
+
+// publish lets the participant publish through the media backend, or
+// stops them, when it can enforce that.
+func publish(clients *interfaces.Room, userID string, allowed bool) {
+	if stage == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := stage.SetPublish(ctx, clients.Session, userID, allowed); err != nil {
+		log.Printf("Error setting publishing of %s in %s: %s", userID, clients.Session, err)
+	}
+}
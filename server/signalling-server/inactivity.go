@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// speechLevel is the audio level at which a participant counts as
+// speaking, from SPEECH_THRESHOLD.
+var speechLevel float64
+
+// automaticFrames are the messages clients send on their own, without the
+// participant doing anything, so they do not count as activity. Audio
+// levels count only when the participant is speaking.
+var automaticFrames = map[string]bool{
+	"quality_stats":   true,
+	"connection_path": true,
+	"audio_level":     true,
+	"offer":           true,
+	"answer":          true,
+	"candidate":       true,
+}
+
+// touch records the participant's activity from a frame they sent. A
+// participant who had been warned of being inactive is told the warning
+// is over.
+func touch(clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if automaticFrames[envelope.Type] {
+		var level struct {
+			Data struct {
+				Level float64 `json:"level"`
+			} `json:"data"`
+		}
+		if envelope.Type != "audio_level" || json.Unmarshal(frame, &level) != nil || level.Data.Level < speechLevel {
+			return
+		}
+	}
+	if clients.Touch(envelope.UserID) {
+		connection.Send(interfaces.Message{Type: "inactivity_cleared", UserID: envelope.UserID})
+	}
+}
+
+// watchInactivity checks the rooms whose sessions have an inactivity policy
+// every interval. Participants inactive for the policy's period are sent
+// inactivity_warning; any message they send, such as still_here, answers
+// it. Those who do not answer within the grace period are removed when the
+// policy says so, but hosts never are.
+func watchInactivity(interval time.Duration) {
+	for range time.Tick(interval) {
+		socketsMu.Lock()
+		rooms := make(map[string]*interfaces.Room, len(sockets))
+		for socket, clients := range sockets {
+			rooms[socket] = clients
+		}
+		socketsMu.Unlock()
+
+		for socket, clients := range rooms {
+			if clients.Settings.Inactivity.Minutes > 0 {
+				checkInactivity(socket, clients, time.Now())
+			}
+		}
+	}
+}
+
+func checkInactivity(socket string, clients *interfaces.Room, now time.Time) {
+	policy := clients.Settings.Inactivity
+	removes := policy.Remove == interfaces.InactivityRemoveAlways ||
+		policy.Remove == interfaces.InactivityRemoveWhenFull && clients.Settings.MaxParticipants > 0 && clients.Len() >= clients.Settings.MaxParticipants
+
+	for _, user := range clients.Inactive(now.Add(-policy.After()), now) {
+		data := gin.H{"minutes": policy.Minutes}
+		if policy.Remove != "" && clients.Role(user) != interfaces.RoleHost {
+			data["removeIn"] = int(policy.Grace().Seconds())
+		}
+		if client := clients.Get(user); client != nil {
+			client.Send(interfaces.Message{Type: "inactivity_warning", UserID: user, Data: data})
+		}
+		recordEvent(clients, analytics.EventInactive, user, map[string]interface{}{"removed": false})
+	}
+
+	if !removes {
+		return
+	}
+	for _, user := range clients.Unresponsive(now.Add(-policy.Grace())) {
+		if clients.Role(user) != interfaces.RoleHost {
+			removeInactive(socket, clients, user)
+		}
+	}
+}
+
+// removeInactive takes a participant who did not answer their inactivity
+// warning out of the room, as if they had left, and closes their
+// connection.
+func removeInactive(socket string, clients *interfaces.Room, user string) {
+	client := clients.Get(user)
+	recordEvent(clients, analytics.EventInactive, user, map[string]interface{}{"removed": true})
+	clients.Remove(user)
+	topology.Leave(socket, user)
+	broadcast(socket, interfaces.Message{Type: "disconnect", UserID: user, Text: "inactive"})
+	if client != nil {
+		client.Disconnect(interfaces.CloseInactive, "inactive")
+	}
+
+	if clients.Len() == 0 {
+		go snapshots.Delete(socket)
+	} else {
+		snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+	}
+}
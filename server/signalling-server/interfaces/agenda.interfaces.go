@@ -0,0 +1,183 @@
+package interfaces
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Bounds on an agenda.
+const (
+	MaxAgendaItems     = 50
+	MaxAgendaTitle     = 200
+	MaxAgendaItemHours = 10
+)
+
+// AgendaWarnings are the time left on an agenda item at which the room is
+// warned, the last when the item's time is up. Warnings longer than the
+// item are skipped.
+var AgendaWarnings = []time.Duration{5 * time.Minute, time.Minute, 0}
+
+// ErrAgendaRunning is returned when changing an agenda an item of which is
+// running.
+var ErrAgendaRunning = errors.New("agenda_running")
+
+// AgendaItem is a time-boxed part of a meeting. StartedAt and EndedAt are
+// when the item actually ran, for comparing with its planned Minutes.
+type AgendaItem struct {
+	ID        string     `bson:"id" json:"id"`
+	Title     string     `bson:"title" json:"title"`
+	Minutes   int        `bson:"minutes" json:"minutes"`
+	StartedAt *time.Time `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	EndedAt   *time.Time `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+}
+
+// Planned is how long the item is meant to take.
+func (i AgendaItem) Planned() time.Duration {
+	return time.Duration(i.Minutes) * time.Minute
+}
+
+// ValidateAgenda checks agenda items against the bounds, giving items
+// without an ID one.
+func ValidateAgenda(items []AgendaItem) error {
+	if len(items) > MaxAgendaItems {
+		return errors.New("an agenda holds at most 50 items")
+	}
+	for i := range items {
+		if items[i].Title == "" || len(items[i].Title) > MaxAgendaTitle {
+			return errors.New("agenda item titles must be 1 to 200 characters")
+		}
+		if items[i].Minutes < 1 || items[i].Minutes > MaxAgendaItemHours*60 {
+			return errors.New("agenda items must take 1 minute to 10 hours")
+		}
+		if items[i].ID == "" {
+			id := make([]byte, 4)
+			rand.Read(id)
+			items[i].ID = hex.EncodeToString(id)
+		}
+		items[i].StartedAt, items[i].EndedAt = nil, nil
+	}
+	return nil
+}
+
+// Agenda is a room's agenda as the meeting goes through it.
+type Agenda struct {
+	Items []AgendaItem `bson:"items" json:"items"`
+	// Current is the index of the running item, -1 when none is.
+	Current int `bson:"current" json:"current"`
+	// Warned counts the AgendaWarnings passed for the running item.
+	Warned int `bson:"warned" json:"-"`
+}
+
+// SetAgenda replaces the room's agenda with validated items. It fails while
+// an item is running.
+func (r *Room) SetAgenda(items []AgendaItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.agenda != nil && r.agenda.Current >= 0 {
+		return ErrAgendaRunning
+	}
+	if len(items) == 0 {
+		r.agenda = nil
+		return nil
+	}
+	r.agenda = &Agenda{Items: append([]AgendaItem{}, items...), Current: -1}
+	return nil
+}
+
+// Agenda returns a copy of the room's agenda, nil when it has none.
+func (r *Room) Agenda() *Agenda {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.agendaCopy()
+}
+
+func (r *Room) agendaCopy() *Agenda {
+	if r.agenda == nil {
+		return nil
+	}
+	agenda := *r.agenda
+	agenda.Items = append([]AgendaItem{}, r.agenda.Items...)
+	return &agenda
+}
+
+// StartAgendaItem starts the item at index, ending the running one, which
+// it returns. Starting an item again starts its time over.
+func (r *Room) StartAgendaItem(index int, now time.Time) (*AgendaItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.agenda == nil || index < 0 || index >= len(r.agenda.Items) {
+		return nil, errors.New("no_agenda_item")
+	}
+	ended := r.endAgendaItem(now)
+	item := &r.agenda.Items[index]
+	item.StartedAt, item.EndedAt = &now, nil
+	r.agenda.Current = index
+	r.agenda.Warned = 0
+	for r.agenda.Warned < len(AgendaWarnings) && AgendaWarnings[r.agenda.Warned] >= item.Planned() {
+		r.agenda.Warned++
+	}
+	return ended, nil
+}
+
+// NextAgendaItem starts the item after the running one, or the first when
+// none is running, returning the item it ended. After the last item the
+// agenda just ends.
+func (r *Room) NextAgendaItem(now time.Time) (*AgendaItem, error) {
+	r.mu.RLock()
+	next := -1
+	if r.agenda != nil {
+		next = r.agenda.Current + 1
+		if next == len(r.agenda.Items) {
+			next = -1
+		}
+	}
+	r.mu.RUnlock()
+
+	if next < 0 {
+		return r.EndAgendaItem(now), nil
+	}
+	return r.StartAgendaItem(next, now)
+}
+
+// EndAgendaItem ends the running item, returning it, or nil when none is
+// running.
+func (r *Room) EndAgendaItem(now time.Time) *AgendaItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.endAgendaItem(now)
+}
+
+func (r *Room) endAgendaItem(now time.Time) *AgendaItem {
+	if r.agenda == nil || r.agenda.Current < 0 {
+		return nil
+	}
+	item := &r.agenda.Items[r.agenda.Current]
+	item.EndedAt = &now
+	r.agenda.Current = -1
+	ended := *item
+	return &ended
+}
+
+// AgendaWarning returns the running item and the time left on it when that
+// passed the next of AgendaWarnings since the last call. Warnings passed
+// together, e.g. while the room was moving between nodes, give one.
+func (r *Room) AgendaWarning(now time.Time) (AgendaItem, time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.agenda == nil || r.agenda.Current < 0 {
+		return AgendaItem{}, 0, false
+	}
+	item := r.agenda.Items[r.agenda.Current]
+	left := item.Planned() - now.Sub(*item.StartedAt)
+	passed := false
+	for r.agenda.Warned < len(AgendaWarnings) && left <= AgendaWarnings[r.agenda.Warned] {
+		r.agenda.Warned++
+		passed = true
+	}
+	return item, left, passed
+}
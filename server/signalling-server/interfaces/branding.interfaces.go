@@ -0,0 +1,41 @@
+package interfaces
+
+import "time"
+
+// Emails an org can rewrite with its own template.
+const (
+	EmailInvite = "invite"
+	EmailSignup = "signup"
+)
+
+// EmailPlaceholders lists what each email's template may refer to.
+var EmailPlaceholders = map[string][]string{
+	EmailInvite: {"{org}", "{link}", "{expires}"},
+	EmailSignup: {"{org}", "{link}", "{expires}"},
+}
+
+// Branding is an org's white-labeling: what clients show in its sessions,
+// the prefix its meeting links start with, and the emails the users
+// service sends on its behalf. Empty fields fall back to the defaults.
+type Branding struct {
+	OrgID   string `bson:"_id" json:"orgID"`
+	Name    string `bson:"name,omitempty" json:"name,omitempty"`
+	LogoURL string `bson:"logoUrl,omitempty" json:"logoUrl,omitempty"`
+	Colors  struct {
+		Primary    string `bson:"primary,omitempty" json:"primary,omitempty"`
+		Accent     string `bson:"accent,omitempty" json:"accent,omitempty"`
+		Background string `bson:"background,omitempty" json:"background,omitempty"`
+	} `bson:"colors" json:"colors"`
+	// MeetingURLPrefix replaces the join page for the org's sessions: the
+	// hashed URL is appended to it, e.g. https://video.example.com/m/.
+	MeetingURLPrefix string                   `bson:"meetingUrlPrefix,omitempty" json:"meetingUrlPrefix,omitempty"`
+	EmailTemplates   map[string]EmailTemplate `bson:"emailTemplates,omitempty" json:"emailTemplates,omitempty"`
+	UpdatedAt        time.Time                `bson:"updatedAt" json:"updatedAt"`
+}
+
+// EmailTemplate overrides an email's subject and plain text body. Either
+// may be left empty to keep the default.
+type EmailTemplate struct {
+	Subject string `bson:"subject,omitempty" json:"subject,omitempty"`
+	Body    string `bson:"body,omitempty" json:"body,omitempty"`
+}
@@ -1,17 +1,314 @@
 package interfaces
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
-	"github.com/gorilla/websocket"
+	"time"
 )
 
+// CloseSlowConsumer is the WebSocket close code sent to a client that could
+// not keep up with its outbound queue.
+const CloseSlowConsumer = 4008
+
+// CloseMoved is sent after a redirect when the room is owned by another node.
+const CloseMoved = 4010
+
+// CloseSessionRevoked is sent when the login session behind a socket is
+// signed out.
+const CloseSessionRevoked = 4011
+
+// CloseReplaced is sent to a connection whose participant resumed on
+// another one.
+const CloseReplaced = 4012
+
+// CloseMaintenance is sent to every connection when platform maintenance
+// begins.
+const CloseMaintenance = 4013
+
+// CloseInactive is sent to a participant removed for not answering an
+// inactivity warning.
+const CloseInactive = 4014
+
+// CloseCapacityExceeded is sent when a quota rejects a join.
+const CloseCapacityExceeded = 4029
+
+// CloseNotAllowed is sent when a session's settings refuse a join.
+const CloseNotAllowed = 4003
+
+var (
+	ErrConnectionClosed = errors.New("connection closed")
+	ErrSlowConsumer     = errors.New("slow_consumer")
+	ErrOutOfOrder       = errors.New("out_of_order")
+)
+
+// QueuePolicy bounds a connection's outbound queue. Frames whose type is in
+// Droppable (audio levels, typing indicators...) are dropped oldest-first
+// when the queue is full; every other frame, notably SDP and ICE, is always
+// queued, letting the queue overflow. A connection that stays overflowed for
+// longer than Grace, or reaches HardLimit frames, is disconnected.
+//
+// Flushes are delayed by BatchWindow so that frames arriving close together
+// are written together; batching connections receive them as a single frame
+// of at most BatchBytes.
+type QueuePolicy struct {
+	Size        int
+	HardLimit   int
+	Grace       time.Duration
+	Droppable   map[string]bool
+	BatchWindow time.Duration
+	BatchBytes  int
+}
+
+type queued struct {
+	frame     json.RawMessage
+	droppable bool
+	sender    string
+	seq       uint64
+}
+
 type Connection struct {
-	Socket *websocket.Conn
+	Socket Transport
 	mu sync.Mutex
+
+	// Batch lets Flush coalesce queued frames into a single JSON array
+	// frame. Clients opt in when connecting.
+	Batch bool
+
+	// Account is the user signed in on the socket, empty for guests.
+	Account string
+
+	// RequestID is the correlation ID of the request that opened the
+	// socket. Messages the server sends on it carry it.
+	RequestID string
+
+	// Protocol is the protocol version the client said it speaks when
+	// connecting, for support.
+	Protocol string
+
+	// Embed is the embed socket the socket was opened on, nil for
+	// everyone else.
+	Embed *EmbedSocket
+
+	// Identity is the user ID an identity token the socket was opened
+	// with binds it to, such as an LTI learner's. Empty for everyone else.
+	Identity string
+
+	// OnClose, when set, closes the socket in place of Close, for
+	// transports that must release it elsewhere first.
+	OnClose func()
+
+	qmu           sync.Mutex
+	queue         []queued
+	scheduled     bool
+	closed        bool
+	overflowSince time.Time
+	Dropped       int
+
+	// written is the sequence number of the last frame handed to the
+	// socket from each sender.
+	written map[string]uint64
+}
+
+func NewConnection(socket Transport, batch bool) *Connection {
+	return &Connection{Socket: socket, Batch: batch}
 }
 
 func (c *Connection) Send(message Message) error {
+	if message.RequestID == "" {
+		message.RequestID = c.RequestID
+	}
+	message.TS = time.Now().UnixMilli()
+	frame, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.SendRaw(frame)
+}
+
+// SendRaw writes an already encoded frame, used to relay client messages
+// without re-marshalling them.
+func (c *Connection) SendRaw(frame json.RawMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Socket.WriteText(frame)
+}
+
+// SendRawWithin is SendRaw bounded by a write deadline, so one stalled
+// client cannot hold up a broadcast.
+func (c *Connection) SendRawWithin(frame json.RawMessage, timeout time.Duration) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.Socket.WriteJSON(message)
+	c.Socket.SetWriteDeadline(time.Now().Add(timeout))
+	defer c.Socket.SetWriteDeadline(time.Time{})
+	return c.Socket.WriteText(frame)
+}
+
+// Enqueue adds a frame of the given message type to the outbound queue,
+// applying policy when it is full. It reports whether the caller must
+// schedule a Flush, which is the case when no flush is pending.
+//
+// Frames relayed from a participant carry the sender's sequence number,
+// and are written in sequence order whatever order they are queued in: a
+// frame goes before any queued frame from the same sender with a higher
+// number. One queued after a later frame from its sender was written is
+// refused with ErrOutOfOrder. Frames with seq 0 are unordered.
+func (c *Connection) Enqueue(frame json.RawMessage, messageType, sender string, seq uint64, policy *QueuePolicy) (bool, error) {
+	c.qmu.Lock()
+	defer c.qmu.Unlock()
+
+	if c.closed {
+		return false, ErrConnectionClosed
+	}
+	if seq > 0 && seq <= c.written[sender] {
+		return false, ErrOutOfOrder
+	}
+
+	droppable := policy.Droppable[messageType]
+	if len(c.queue) >= policy.Size {
+		if c.dropOldest() {
+			c.Dropped++
+		} else if droppable {
+			c.Dropped++
+			return false, nil
+		}
+	}
+
+	c.insert(queued{frame: frame, droppable: droppable, sender: sender, seq: seq})
+
+	if len(c.queue) > policy.Size {
+		if c.overflowSince.IsZero() {
+			c.overflowSince = time.Now()
+		}
+		if len(c.queue) >= policy.HardLimit || time.Since(c.overflowSince) > policy.Grace {
+			c.closed = true
+			c.queue = nil
+			return false, ErrSlowConsumer
+		}
+	}
+
+	if c.scheduled {
+		return false, nil
+	}
+	c.scheduled = true
+	return true, nil
+}
+
+// insert queues item behind everything but the frames from its sender with
+// a higher sequence number.
+func (c *Connection) insert(item queued) {
+	at := len(c.queue)
+	if item.seq > 0 {
+		for i, other := range c.queue {
+			if other.seq > item.seq && other.sender == item.sender {
+				at = i
+				break
+			}
+		}
+	}
+	c.queue = append(c.queue, queued{})
+	copy(c.queue[at+1:], c.queue[at:])
+	c.queue[at] = item
+}
+
+// dropOldest removes the oldest droppable frame from the queue.
+func (c *Connection) dropOldest() bool {
+	for i, item := range c.queue {
+		if item.droppable {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Flush writes queued frames until the queue is empty, bounding each write
+// by timeout. Batching connections get everything queued so far, up to
+// policy.BatchBytes, as one array frame. On error the connection is marked
+// closed and later Enqueue calls fail.
+func (c *Connection) Flush(timeout time.Duration, policy *QueuePolicy) error {
+	for {
+		c.qmu.Lock()
+		if c.closed || len(c.queue) == 0 {
+			c.scheduled = false
+			c.qmu.Unlock()
+			return nil
+		}
+
+		n, size := 1, len(c.queue[0].frame)
+		if c.Batch {
+			for n < len(c.queue) && size+len(c.queue[n].frame) <= policy.BatchBytes {
+				size += len(c.queue[n].frame)
+				n++
+			}
+		}
+		items := c.queue[:n]
+		c.queue = c.queue[n:]
+		for _, item := range items {
+			if item.seq > 0 {
+				if c.written == nil {
+					c.written = make(map[string]uint64)
+				}
+				c.written[item.sender] = item.seq
+			}
+		}
+		if len(c.queue) <= policy.Size {
+			c.overflowSince = time.Time{}
+		}
+		c.qmu.Unlock()
+
+		frame := items[0].frame
+		if n > 1 {
+			frame = batch(items, size)
+		}
+
+		if err := c.SendRawWithin(frame, timeout); err != nil {
+			c.qmu.Lock()
+			c.closed = true
+			c.scheduled = false
+			c.queue = nil
+			c.qmu.Unlock()
+			return err
+		}
+	}
+}
+
+// batch joins frames into a JSON array.
+func batch(items []queued, size int) json.RawMessage {
+	frame := make(json.RawMessage, 0, size+len(items)+1)
+	frame = append(frame, '[')
+	for i, item := range items {
+		if i > 0 {
+			frame = append(frame, ',')
+		}
+		frame = append(frame, item.frame...)
+	}
+	return append(frame, ']')
+}
+
+// Locked runs write holding the connection's write lock, for frames
+// written around the Transport, such as replies to WebSocket pings, so
+// they cannot interleave with queued frames.
+func (c *Connection) Locked(write func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return write()
+}
+
+// Disconnect sends a close frame with code and reason, then closes the socket.
+func (c *Connection) Disconnect(code int, reason string) {
+	c.mu.Lock()
+	c.Socket.WriteClose(code, reason)
+	c.mu.Unlock()
+	c.Close()
+}
+
+// Close closes the socket without the close handshake, through OnClose
+// when set.
+func (c *Connection) Close() {
+	if c.OnClose != nil {
+		c.OnClose()
+		return
+	}
+	c.Socket.Close()
 }
\ No newline at end of file
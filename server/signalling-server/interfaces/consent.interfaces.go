@@ -0,0 +1,102 @@
+package interfaces
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Kinds of consent notice.
+const (
+	ConsentTerms     = "terms"
+	ConsentRecording = "recording"
+	ConsentNotice    = "notice"
+)
+
+// Consent is what an org asks participants to accept before they join its
+// sessions, e.g. terms of use, a disclosure that meetings may be recorded,
+// or a notice that only applies in some countries.
+type Consent struct {
+	OrgID     string        `bson:"_id" json:"orgID"`
+	Notices   []ConsentItem `bson:"notices" json:"notices"`
+	UpdatedAt time.Time     `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ConsentItem is one notice. Changing its text should come with a new
+// Version, so participants who accepted the old one are asked again.
+type ConsentItem struct {
+	ID      string `bson:"id" json:"id"`
+	Kind    string `bson:"kind" json:"kind"`
+	Version int    `bson:"version" json:"version"`
+	Title   string `bson:"title" json:"title"`
+	Text    string `bson:"text,omitempty" json:"text,omitempty"`
+	URL     string `bson:"url,omitempty" json:"url,omitempty"`
+	// Required notices must be accepted to join; the others are only
+	// shown.
+	Required bool `bson:"required" json:"required"`
+	// Regions limits the notice to participants in these deployment
+	// regions or ISO country codes, e.g. ["eu-west", "CH"]. Empty shows it
+	// everywhere.
+	Regions []string `bson:"regions,omitempty" json:"regions,omitempty"`
+}
+
+func (c Consent) Validate() error {
+	seen := make(map[string]bool, len(c.Notices))
+	for _, notice := range c.Notices {
+		if notice.ID == "" || strings.TrimSpace(notice.Title) == "" {
+			return errors.New("Every notice needs an id and a title.")
+		}
+		if seen[notice.ID] {
+			return errors.New("Notice ids must be unique.")
+		}
+		seen[notice.ID] = true
+		switch notice.Kind {
+		case ConsentTerms, ConsentRecording, ConsentNotice:
+		default:
+			return errors.New("Notice kind must be terms, recording or notice.")
+		}
+		if notice.Version < 1 {
+			return errors.New("Notice versions start at 1.")
+		}
+	}
+	return nil
+}
+
+// For returns the notices shown to a participant in the given region and
+// country.
+func (c Consent) For(region, country string) []ConsentItem {
+	notices := []ConsentItem{}
+	for _, notice := range c.Notices {
+		if len(notice.Regions) == 0 {
+			notices = append(notices, notice)
+			continue
+		}
+		for _, applies := range notice.Regions {
+			if (region != "" && applies == region) || (country != "" && strings.EqualFold(applies, country)) {
+				notices = append(notices, notice)
+				break
+			}
+		}
+	}
+	return notices
+}
+
+// ConsentRecord proves a participant accepted a notice before joining a
+// session, for compliance audits. Records are never updated.
+type ConsentRecord struct {
+	ID        string `bson:"_id" json:"id"`
+	OrgID     string `bson:"orgID" json:"orgID"`
+	SessionID string `bson:"sessionID" json:"sessionID"`
+	UserID    string `bson:"userID" json:"userID"`
+	// Account is the signed in user, if any; UserID is what the client
+	// joins the room as.
+	Account    string    `bson:"account,omitempty" json:"account,omitempty"`
+	NoticeID   string    `bson:"noticeID" json:"noticeID"`
+	Kind       string    `bson:"kind" json:"kind"`
+	Version    int       `bson:"version" json:"version"`
+	Region     string    `bson:"region,omitempty" json:"region,omitempty"`
+	Country    string    `bson:"country,omitempty" json:"country,omitempty"`
+	IP         string    `bson:"ip" json:"ip"`
+	UserAgent  string    `bson:"userAgent" json:"userAgent"`
+	AcceptedAt time.Time `bson:"acceptedAt" json:"acceptedAt"`
+}
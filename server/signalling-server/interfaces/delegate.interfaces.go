@@ -0,0 +1,12 @@
+package interfaces
+
+import "time"
+
+// Delegate lets DelegateID, such as an assistant, schedule, reschedule and
+// cancel meetings on behalf of OwnerID.
+type Delegate struct {
+	ID         string    `bson:"_id" json:"id"`
+	OwnerID    string    `bson:"ownerID" json:"ownerID"`
+	DelegateID string    `bson:"delegateID" json:"delegateID"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+}
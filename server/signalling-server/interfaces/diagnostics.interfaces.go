@@ -0,0 +1,28 @@
+package interfaces
+
+import "time"
+
+// DiagnosticsBundle is what a participant's client uploaded when they
+// reported a problem, kept for support to investigate the complaint.
+type DiagnosticsBundle struct {
+	ID            string    `bson:"_id" json:"id"`
+	SessionID     string    `bson:"sessionID" json:"sessionID"`
+	Socket        string    `bson:"socket" json:"-"`
+	ParticipantID string    `bson:"participantID" json:"participantID"`
+	UserID        string    `bson:"userID" json:"userID"`
+	Name          string    `bson:"name,omitempty" json:"name,omitempty"`
+	IP            string    `bson:"ip" json:"ip"`
+	UserAgent     string    `bson:"userAgent" json:"userAgent"`
+	CreatedAt     time.Time `bson:"createdAt" json:"createdAt"`
+
+	// Note is the participant's description of the problem.
+	Note string `bson:"note,omitempty" json:"note,omitempty"`
+	// Logs are the client's most recent log lines, oldest first.
+	Logs []string `bson:"logs,omitempty" json:"logs,omitempty"`
+	// Stats are getStats snapshots of the client's peer connections,
+	// oldest first, as the browser reported them.
+	Stats []map[string]interface{} `bson:"stats,omitempty" json:"stats,omitempty"`
+	// PreflightID is the participant's preflight report for the session,
+	// see PreflightReport.
+	PreflightID string `bson:"preflightID,omitempty" json:"preflightID,omitempty"`
+}
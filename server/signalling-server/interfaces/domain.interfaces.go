@@ -0,0 +1,13 @@
+package interfaces
+
+import "time"
+
+// Domain is a vanity domain an org serves its meeting links from. It is
+// only used once VerifiedAt is set, which proves the org controls its DNS.
+type Domain struct {
+	Name       string     `bson:"_id" json:"name"`
+	OrgID      string     `bson:"orgID" json:"orgID"`
+	Token      string     `bson:"token" json:"-"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	VerifiedAt *time.Time `bson:"verifiedAt,omitempty" json:"verifiedAt,omitempty"`
+}
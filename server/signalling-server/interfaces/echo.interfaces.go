@@ -0,0 +1,48 @@
+package interfaces
+
+import "time"
+
+// EchoTest is a user testing their camera, microphone and connection
+// against a media node that sends their media straight back to them. It
+// ends when the user stops it or at ExpiresAt.
+type EchoTest struct {
+	ID     string `bson:"_id" json:"id"`
+	UserID string `bson:"userID,omitempty" json:"userID,omitempty"`
+	Room   string `bson:"room" json:"room"`
+	// Identity is who the user publishes as in Room.
+	Identity  string    `bson:"identity" json:"identity"`
+	NodeID    string    `bson:"nodeID" json:"nodeID"`
+	NodeURL   string    `bson:"nodeURL" json:"-"`
+	Region    string    `bson:"region" json:"region"`
+	IP        string    `bson:"ip" json:"ip"`
+	UserAgent string    `bson:"userAgent" json:"userAgent"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+
+	StoppedAt *time.Time `bson:"stoppedAt,omitempty" json:"stoppedAt,omitempty"`
+	// Expired is set when the test ran out rather than being stopped.
+	Expired bool `bson:"expired,omitempty" json:"expired,omitempty"`
+	// Stats are what the media node measured of the looped media.
+	Stats *EchoStats `bson:"stats,omitempty" json:"stats,omitempty"`
+	// Reported is what the user's client observed.
+	Reported *EchoReport `bson:"reported,omitempty" json:"reported,omitempty"`
+}
+
+// EchoStats is what a media node measured while echoing a user's media:
+// the round trip to the user and back, its jitter, the share of packets
+// lost, and which kinds of media it received.
+type EchoStats struct {
+	RTTMs      float64 `bson:"rttMs" json:"rttMs"`
+	JitterMs   float64 `bson:"jitterMs" json:"jitterMs"`
+	PacketLoss float64 `bson:"packetLoss" json:"packetLoss"`
+	Audio      bool    `bson:"audio" json:"audio"`
+	Video      bool    `bson:"video" json:"video"`
+}
+
+// EchoReport is what the user's client observed of its own media coming
+// back: whether it heard and saw it, and the delay it measured.
+type EchoReport struct {
+	Audio     bool    `bson:"audio" json:"audio"`
+	Video     bool    `bson:"video" json:"video"`
+	LatencyMs float64 `bson:"latencyMs,omitempty" json:"latencyMs,omitempty"`
+}
@@ -0,0 +1,98 @@
+package interfaces
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// EmbedFeatures maps the features an embed token can disable to the
+// messages a participant sends to use them.
+var EmbedFeatures = map[string][]string{
+	"chat":         {"chat"},
+	"screen_share": {"screen_share_start"},
+	"reactions":    {"reaction"},
+	"files":        {"file_offer", "file_accept"},
+	"floor":        {"request_floor"},
+}
+
+// EmbedGrant is what an embed token admits its holder to a room as: a
+// fixed display name, the role they take, the host's or the default when
+// empty, and the features they may not use. A SaaS backend mints it for
+// its own users so they join without an account of ours.
+type EmbedGrant struct {
+	Name     string   `json:"name"`
+	Role     string   `json:"role,omitempty"`
+	Disabled []string `json:"disabled,omitempty"`
+}
+
+// Validate checks the grant, trimming its name.
+func (g *EmbedGrant) Validate() error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" || utf8.RuneCountInString(g.Name) > 80 || strings.ContainsAny(g.Name, "\r\n") {
+		return errors.New("Name must be a single line of at most 80 characters.")
+	}
+	switch g.Role {
+	case "", RoleHost, RoleParticipant, RoleAttendee:
+	default:
+		return errors.New("Role must be host, participant or attendee.")
+	}
+	for _, feature := range g.Disabled {
+		if _, ok := EmbedFeatures[feature]; !ok {
+			return errors.New("Unknown feature " + feature + ".")
+		}
+	}
+	return nil
+}
+
+// EmbedPath is what embed tokens to a session are signed over.
+func EmbedPath(hashedURL string) string {
+	return "/embed/" + hashedURL
+}
+
+// EmbedSocketPrefix marks the socket parameter of a WebSocket opened on an
+// embed socket rather than on the room's own socket URL.
+const EmbedSocketPrefix = "embed-"
+
+// EmbedSocket is what an embed token holder connects to in place of the
+// room's socket URL, which they are never told. It binds the connection to
+// the grant and the user ID it was issued for, so the restrictions hold
+// whatever the client puts in the URL or its frames.
+type EmbedSocket struct {
+	ID        string     `bson:"_id"`
+	Socket    string     `bson:"socket"`
+	UserID    string     `bson:"userID"`
+	Grant     EmbedGrant `bson:"grant"`
+	ExpiresAt time.Time  `bson:"expiresAt"`
+}
+
+// SetDisabled replaces the features the participant may not use.
+func (r *Room) SetDisabled(userID string, features []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		participant.Disabled = features
+	}
+}
+
+// Disables reports whether the participant joined with a token disabling
+// the feature messages of the type belong to.
+func (r *Room) Disables(userID, messageType string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participant := r.participants[userID]
+	if participant == nil {
+		return false
+	}
+	for _, feature := range participant.Disabled {
+		for _, disabled := range EmbedFeatures[feature] {
+			if disabled == messageType {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package interfaces
+
+import "time"
+
+// An export is "pending" while its archive is built, then "ready" or "failed".
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export is a user's request for a copy of their data.
+type Export struct {
+	ID          string     `bson:"_id" json:"id"`
+	UserID      string     `bson:"userID" json:"-"`
+	Status      string     `bson:"status" json:"status"`
+	Key         string     `bson:"key,omitempty" json:"-"`
+	Size        int64      `bson:"size,omitempty" json:"size,omitempty"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	CompletedAt *time.Time `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   time.Time  `bson:"expiresAt" json:"expiresAt"`
+}
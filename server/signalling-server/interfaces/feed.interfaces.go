@@ -0,0 +1,100 @@
+package interfaces
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A feed is "pending" until a host of its session approves it, which makes
+// it "active", or denies it. A feed is "stopped" when a host, the session's
+// owner or the integrator ends it, whether or not it was approved.
+const (
+	FeedPending = "pending"
+	FeedActive  = "active"
+	FeedDenied  = "denied"
+	FeedStopped = "stopped"
+)
+
+// Events a feed can carry.
+const (
+	FeedJoin             = "join"
+	FeedLeave            = "leave"
+	FeedChat             = "chat"
+	FeedReaction         = "reaction"
+	FeedMute             = "mute"
+	FeedUnmute           = "unmute"
+	FeedScreenShareStart = "screen_share_start"
+	FeedScreenShareStop  = "screen_share_stop"
+)
+
+// FeedEvents lists every event a feed can carry.
+var FeedEvents = []string{FeedJoin, FeedLeave, FeedChat, FeedReaction, FeedMute, FeedUnmute, FeedScreenShareStart, FeedScreenShareStop}
+
+// Feed streams a session's room events to an integrator, such as a live
+// production tool drawing overlays: posted to TargetURL, when set, and sent
+// to any WebSocket opened on it. Events is the subset wanted, all when
+// empty. Calls to TargetURL are signed with Secret like automation hooks.
+type Feed struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	SessionID string             `bson:"sessionID" json:"sessionID"`
+	Socket    string             `bson:"socket" json:"-"`
+	OwnerID   string             `bson:"ownerID" json:"-"`
+	Name      string             `bson:"name" json:"name"`
+	TargetURL string             `bson:"targetUrl,omitempty" json:"targetUrl,omitempty"`
+	Secret    string             `bson:"secret" json:"secret,omitempty"`
+	Events    []string           `bson:"events,omitempty" json:"events,omitempty"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+
+	// DecidedBy is the host who approved or denied the feed.
+	DecidedBy string     `bson:"decidedBy,omitempty" json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `bson:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+	StoppedAt *time.Time `bson:"stoppedAt,omitempty" json:"stoppedAt,omitempty"`
+}
+
+// Wants reports whether the feed carries events of the type.
+func (f Feed) Wants(eventType string) bool {
+	if len(f.Events) == 0 {
+		return true
+	}
+	for _, wanted := range f.Events {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedSocketPath is the path of the WebSocket a feed's events can be
+// followed on; its URL is signed for the integrator.
+func FeedSocketPath(id string) string {
+	return "/feeds/" + id + "/socket"
+}
+
+// ValidFeedEvent reports whether feeds can carry events of the type.
+func ValidFeedEvent(eventType string) bool {
+	for _, known := range FeedEvents {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedEvent is a room event as a feed carries it: participants are known
+// by their ID in the room and display name only, never by their account,
+// metadata or phone number. Seq numbers the feed's events, with gaps where
+// events were dropped because the integrator fell behind.
+type FeedEvent struct {
+	Seq           int64     `json:"seq"`
+	At            time.Time `json:"at"`
+	Type          string    `json:"type"`
+	ParticipantID string    `json:"participantID,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	// Text is a chat message sent to the whole room; direct messages are
+	// never carried.
+	Text  string `json:"text,omitempty"`
+	Emoji string `json:"emoji,omitempty"`
+}
@@ -0,0 +1,184 @@
+package interfaces
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// File transfers go peer to peer over a DataChannel. The server relays the
+// offer, the answer and progress between the two peers, enforces the
+// room's FilePolicy, and relays the file itself in file_chunk messages when
+// the peers cannot connect directly.
+
+// maxOpenFiles bounds the transfers a participant may have offered and not
+// yet finished.
+const maxOpenFiles = 10
+
+// maxFileName bounds the length of an offered file name, in bytes.
+const maxFileName = 255
+
+// FilePolicy limits the files participants may send each other.
+type FilePolicy struct {
+	// Disabled turns file transfer off.
+	Disabled bool `bson:"disabled,omitempty" json:"disabled,omitempty"`
+	// MaxBytes caps the size of a file. Zero is no cap.
+	MaxBytes int64 `bson:"maxBytes,omitempty" json:"maxBytes,omitempty"`
+	// Types lists the files allowed, by MIME type ("application/pdf"),
+	// MIME type family ("image/*") or extension (".pdf"). Empty allows any.
+	Types []string `bson:"types,omitempty" json:"types,omitempty"`
+	// NoRelay stops the server from relaying files between peers that
+	// cannot connect directly.
+	NoRelay bool `bson:"noRelay,omitempty" json:"noRelay,omitempty"`
+}
+
+func (p FilePolicy) Validate() error {
+	if p.MaxBytes < 0 {
+		return errors.New("files.maxBytes cannot be negative.")
+	}
+	for _, allowed := range p.Types {
+		if strings.TrimSpace(allowed) == "" {
+			return errors.New("files.types cannot contain empty types.")
+		}
+	}
+	return nil
+}
+
+// Allows returns why the policy refuses a file, one of "disabled",
+// "too_large" or "type", or "" when it allows it.
+func (p FilePolicy) Allows(name, mime string, size int64) string {
+	switch {
+	case p.Disabled:
+		return "disabled"
+	case p.MaxBytes > 0 && size > p.MaxBytes:
+		return "too_large"
+	case len(p.Types) == 0:
+		return ""
+	}
+	extension := strings.ToLower(path.Ext(name))
+	mime = strings.ToLower(mime)
+	for _, allowed := range p.Types {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case strings.HasPrefix(allowed, "."):
+			if extension == allowed {
+				return ""
+			}
+		case strings.HasSuffix(allowed, "/*"):
+			if strings.HasPrefix(mime, strings.TrimSuffix(allowed, "*")) {
+				return ""
+			}
+		case mime == allowed:
+			return ""
+		}
+	}
+	return "type"
+}
+
+// FileTransfer is a file offered by one participant to another.
+type FileTransfer struct {
+	ID       string
+	From     string
+	To       string
+	Name     string
+	Type     string
+	Size     int64
+	Accepted bool
+	// Relayed counts the bytes the server relayed in file_chunk messages.
+	Relayed int64
+	At      time.Time
+}
+
+// OfferFile records a transfer offered to another participant.
+func (r *Room) OfferFile(transfer FileTransfer) error {
+	if transfer.ID == "" || transfer.To == "" || transfer.To == transfer.From {
+		return errors.New("invalid_offer")
+	}
+	if transfer.Size <= 0 || transfer.Name == "" || len(transfer.Name) > maxFileName {
+		return errors.New("invalid_offer")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.files[transfer.ID] != nil {
+		return errors.New("duplicate_id")
+	}
+	open := 0
+	for _, other := range r.files {
+		if other.From == transfer.From {
+			open++
+		}
+	}
+	if open >= maxOpenFiles {
+		return errors.New("too_many_transfers")
+	}
+	r.files[transfer.ID] = &transfer
+	return nil
+}
+
+// File returns the transfer with the ID if userID takes part in it.
+func (r *Room) File(id, userID string) (FileTransfer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	transfer := r.files[id]
+	if transfer == nil || (transfer.From != userID && transfer.To != userID) {
+		return FileTransfer{}, false
+	}
+	return *transfer, true
+}
+
+// AcceptFile marks the transfer accepted, if userID is its recipient.
+func (r *Room) AcceptFile(id, userID string) (FileTransfer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transfer := r.files[id]
+	if transfer == nil || transfer.To != userID {
+		return FileTransfer{}, false
+	}
+	transfer.Accepted = true
+	return *transfer, true
+}
+
+// EndFile forgets the transfer, if userID takes part in it, once it is
+// rejected, cancelled or complete.
+func (r *Room) EndFile(id, userID string) (FileTransfer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transfer := r.files[id]
+	if transfer == nil || (transfer.From != userID && transfer.To != userID) {
+		return FileTransfer{}, false
+	}
+	delete(r.files, id)
+	return *transfer, true
+}
+
+// RelayFile counts n more bytes of an accepted transfer relayed by the
+// server from its sender. It refuses chunks that would take the transfer
+// past its size or past limit bytes relayed.
+func (r *Room) RelayFile(id, userID string, n, limit int64) (FileTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	transfer := r.files[id]
+	if transfer == nil || transfer.From != userID {
+		return FileTransfer{}, errors.New("unknown_transfer")
+	}
+	if !transfer.Accepted {
+		return FileTransfer{}, errors.New("not_accepted")
+	}
+	if transfer.Relayed+n > transfer.Size || (limit > 0 && transfer.Relayed+n > limit) {
+		return FileTransfer{}, errors.New("too_large")
+	}
+	transfer.Relayed += n
+	return *transfer, nil
+}
+
+// dropFiles forgets the transfers the user takes part in. Callers must
+// hold r.mu.
+func (r *Room) dropFiles(userID string) {
+	for id, transfer := range r.files {
+		if transfer.From == userID || transfer.To == userID {
+			delete(r.files, id)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package interfaces
+
+// Floor control lets webinar attendees ask to speak. Requests wait in a
+// queue in the order they were made until a host grants or denies them; a
+// granted attendee becomes a participant, who may publish, until the floor
+// is revoked or they give it back.
+
+// RequestFloor queues the attendee's request to speak. It returns their
+// position in the queue, counting from 1, or 0 if they are not an attendee.
+// Asking again keeps their place.
+func (r *Room) RequestFloor(userID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if participant == nil || participant.Role != RoleAttendee {
+		return 0
+	}
+	for i, queued := range r.floor {
+		if queued == userID {
+			return i + 1
+		}
+	}
+	r.floor = append(r.floor, userID)
+	return len(r.floor)
+}
+
+// WithdrawFloor takes the user's request out of the queue, reporting
+// whether they had one.
+func (r *Room) WithdrawFloor(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queued := len(r.floor)
+	r.floor = remove(r.floor, userID)
+	return len(r.floor) < queued
+}
+
+// GrantFloor promotes the queued attendee to participant, reporting
+// whether they were queued.
+func (r *Room) GrantFloor(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queued := len(r.floor)
+	r.floor = remove(r.floor, userID)
+	participant := r.participants[userID]
+	if len(r.floor) == queued || participant == nil {
+		return false
+	}
+	participant.Role = RoleParticipant
+	r.promoted[userID] = true
+	return true
+}
+
+// RevokeFloor returns a promoted attendee to attendee, reporting whether
+// they had the floor. Participants who joined as such keep their role.
+func (r *Room) RevokeFloor(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if !r.promoted[userID] || participant == nil {
+		return false
+	}
+	delete(r.promoted, userID)
+	participant.Role = RoleAttendee
+	return true
+}
+
+// Floor returns the participant IDs of the queued attendees, in order.
+func (r *Room) Floor() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.floorIDs()
+}
+
+func (r *Room) floorIDs() []string {
+	ids := make([]string, 0, len(r.floor))
+	for _, user := range r.floor {
+		if participant := r.participants[user]; participant != nil {
+			ids = append(ids, participant.ID)
+		}
+	}
+	return ids
+}
+
+// remove returns list without user.
+func remove(list []string, user string) []string {
+	kept := list[:0]
+	for _, item := range list {
+		if item != user {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
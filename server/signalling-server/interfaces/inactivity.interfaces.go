@@ -0,0 +1,126 @@
+package interfaces
+
+import (
+	"errors"
+	"time"
+)
+
+// When participants who do not answer an inactivity warning are removed.
+const (
+	// InactivityRemoveAlways removes them whatever the room's size.
+	InactivityRemoveAlways = "always"
+	// InactivityRemoveWhenFull removes them only while the room is at its
+	// MaxParticipants, to make room for others.
+	InactivityRemoveWhenFull = "when_full"
+)
+
+// DefaultInactivityGrace is how long a warned participant has to answer
+// when the policy does not say.
+const DefaultInactivityGrace = time.Minute
+
+// InactivityPolicy finds participants who joined and walked away: neither
+// speaking nor doing anything for a while. They are warned, and may be
+// removed if they do not answer.
+type InactivityPolicy struct {
+	// Minutes a participant may go inactive before they are warned. Zero
+	// turns detection off.
+	Minutes int `bson:"minutes,omitempty" json:"minutes,omitempty"`
+	// Remove is when participants who do not answer are removed, one of
+	// the InactivityRemove constants. Empty never removes them.
+	Remove string `bson:"remove,omitempty" json:"remove,omitempty"`
+	// GraceSeconds is how long they have to answer. Zero is
+	// DefaultInactivityGrace.
+	GraceSeconds int `bson:"graceSeconds,omitempty" json:"graceSeconds,omitempty"`
+}
+
+func (p InactivityPolicy) Validate() error {
+	if p.Minutes < 0 {
+		return errors.New("inactivity.minutes cannot be negative.")
+	}
+	if p.GraceSeconds < 0 {
+		return errors.New("inactivity.graceSeconds cannot be negative.")
+	}
+	switch p.Remove {
+	case "", InactivityRemoveAlways, InactivityRemoveWhenFull:
+	default:
+		return errors.New("inactivity.remove must be always or when_full.")
+	}
+	if p.Remove != "" && p.Minutes == 0 {
+		return errors.New("inactivity.remove needs inactivity.minutes.")
+	}
+	return nil
+}
+
+// After is how long a participant may go inactive before being warned.
+func (p InactivityPolicy) After() time.Duration {
+	return time.Duration(p.Minutes) * time.Minute
+}
+
+// Grace is how long a warned participant has to answer.
+func (p InactivityPolicy) Grace() time.Duration {
+	if p.GraceSeconds == 0 {
+		return DefaultInactivityGrace
+	}
+	return time.Duration(p.GraceSeconds) * time.Second
+}
+
+// Touch records that the user spoke or did something, reporting whether
+// they had been warned of being inactive.
+func (r *Room) Touch(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active[userID] = time.Now()
+	if _, warned := r.warned[userID]; warned {
+		delete(r.warned, userID)
+		return true
+	}
+	return false
+}
+
+// Inactive returns the connected participants who have not been active
+// since cutoff and were not warned yet, marking them warned at now.
+// Attendees, who are expected to watch quietly, and those sharing their
+// screen are never inactive.
+func (r *Room) Inactive(cutoff, now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []string
+	for user := range r.clients {
+		participant := r.participants[user]
+		if participant == nil || participant.Role == RoleAttendee || r.sharing[user] {
+			continue
+		}
+		if _, warned := r.warned[user]; warned {
+			continue
+		}
+		// Participants restored from a snapshot were not seen on this
+		// node yet, so they are given a full period.
+		active, ok := r.active[user]
+		if !ok {
+			r.active[user] = now
+			continue
+		}
+		if active.Before(cutoff) {
+			r.warned[user] = now
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// Unresponsive returns the connected participants warned before cutoff who
+// have not been active since.
+func (r *Room) Unresponsive(cutoff time.Time) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []string
+	for user, warned := range r.warned {
+		if r.clients[user] != nil && warned.Before(cutoff) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
@@ -0,0 +1,52 @@
+package interfaces
+
+import (
+	"errors"
+	"time"
+)
+
+// Layout modes.
+const (
+	// LayoutGrid shows everyone in equal tiles.
+	LayoutGrid = "grid"
+	// LayoutSpeaker shows the active speaker, or the pinned participants,
+	// large with the others in a strip.
+	LayoutSpeaker = "speaker"
+	// LayoutSpotlight shows only the single pinned participant.
+	LayoutSpotlight = "spotlight"
+)
+
+// maxLayoutParticipants bounds Pinned and Order.
+const maxLayoutParticipants = 100
+
+// Layout is how a host recommends the room be arranged on screen. Clients
+// apply it unless their user chose otherwise, and recordings follow it.
+// Participants are referred to by participant ID.
+type Layout struct {
+	Mode string `bson:"mode" json:"mode"`
+	// Pinned participants are shown large, in this order.
+	Pinned []string `bson:"pinned,omitempty" json:"pinned,omitempty"`
+	// Order is the order of the tiles. Participants left out follow in the
+	// order they joined.
+	Order []string `bson:"order,omitempty" json:"order,omitempty"`
+
+	// SetBy is the participant ID of the host who set the layout.
+	SetBy     string    `bson:"setBy" json:"setBy"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+func (l Layout) Validate() error {
+	switch l.Mode {
+	case LayoutGrid, LayoutSpeaker:
+	case LayoutSpotlight:
+		if len(l.Pinned) != 1 {
+			return errors.New("spotlight needs exactly one pinned participant")
+		}
+	default:
+		return errors.New("mode must be grid, speaker or spotlight")
+	}
+	if len(l.Pinned) > maxLayoutParticipants || len(l.Order) > maxLayoutParticipants {
+		return errors.New("too many participants in layout")
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package interfaces
+
+import "time"
+
+// ShortLink maps a short code to a session's join page. Clicks counts
+// redirects by source ("qr" for scans of the session's QR code, "link"
+// otherwise).
+type ShortLink struct {
+	Code          string         `bson:"_id" json:"code"`
+	HashedURL     string         `bson:"hashedUrl" json:"-"`
+	CreatedAt     time.Time      `bson:"createdAt" json:"createdAt"`
+	Clicks        map[string]int `bson:"clicks,omitempty" json:"clicks"`
+	LastClickedAt *time.Time     `bson:"lastClickedAt,omitempty" json:"lastClickedAt,omitempty"`
+}
+
+// JoinCode is a single-use numeric code a room device enters to join a
+// session without its URL or password. Redeeming deletes it.
+type JoinCode struct {
+	Code      string    `bson:"_id" json:"code"`
+	HashedURL string    `bson:"hashedUrl" json:"-"`
+	CreatedBy string    `bson:"createdBy" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
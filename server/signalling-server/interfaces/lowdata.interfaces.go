@@ -0,0 +1,40 @@
+package interfaces
+
+// MaxThumbnails is how many participants' video a participant in low data
+// mode may receive. Publishers send them their lowest layer only.
+const MaxThumbnails = 4
+
+// SetLowData records whether the participant asked for low data mode when
+// joining, and reports whether that changed. Entering it stops the video
+// they receive, switching them to managed subscriptions; leaving it
+// restores everyone's.
+func (r *Room) SetLowData(userID string, lowData bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if participant == nil || participant.LowData == lowData {
+		return false
+	}
+	participant.LowData = lowData
+	if lowData {
+		r.subscriptions[userID] = make(map[string]bool)
+	} else {
+		delete(r.subscriptions, userID)
+	}
+	return true
+}
+
+// LowData returns the connected users in low data mode.
+func (r *Room) LowData() map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[string]bool)
+	for user := range r.clients {
+		if participant := r.participants[user]; participant != nil && participant.LowData {
+			users[user] = true
+		}
+	}
+	return users
+}
@@ -0,0 +1,39 @@
+package interfaces
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Limits on the metadata participants attach when joining. It travels in
+// every roster event, so it has to stay small.
+const (
+	MaxMetadataKeys  = 16
+	MaxMetadataValue = 256
+	MaxMetadataBytes = 2048
+)
+
+// MetadataKey matches the keys metadata may use, e.g. "crmId" or
+// "org.department".
+var MetadataKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,39}$`)
+
+// ValidateMetadata checks participant metadata against the limits.
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataKeys {
+		return fmt.Errorf("at most %d metadata keys are allowed", MaxMetadataKeys)
+	}
+	size := 0
+	for key, value := range metadata {
+		if !MetadataKey.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q", key)
+		}
+		if len(value) > MaxMetadataValue {
+			return fmt.Errorf("metadata value of %q is longer than %d bytes", key, MaxMetadataValue)
+		}
+		size += len(key) + len(value)
+	}
+	if size > MaxMetadataBytes {
+		return fmt.Errorf("metadata is larger than %d bytes", MaxMetadataBytes)
+	}
+	return nil
+}
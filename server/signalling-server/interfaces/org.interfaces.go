@@ -0,0 +1,37 @@
+package interfaces
+
+// Organization groups sessions for quota purposes. Zero limits fall back to
+// the plan's limits; Unlimited is an admin override lifting all org quotas.
+type Organization struct {
+	ID              string `bson:"_id" json:"id"`
+	Plan            string `bson:"plan" json:"plan"`
+	MaxMeetings     int    `bson:"maxMeetings" json:"maxMeetings"`
+	MaxParticipants int    `bson:"maxParticipants" json:"maxParticipants"`
+	Unlimited       bool   `bson:"unlimited" json:"unlimited"`
+
+	// MaxStorageBytes caps what the org's recordings take up in storage.
+	// StoragePolicy says what happens past it: "block" (the default) stops
+	// new recordings, "delete_oldest" deletes the oldest recordings until
+	// the org is back under.
+	MaxStorageBytes int64  `bson:"maxStorageBytes,omitempty" json:"maxStorageBytes,omitempty"`
+	StoragePolicy   string `bson:"storagePolicy,omitempty" json:"storagePolicy,omitempty"`
+
+	// Registration is "open", "invite" (the default) or "domain"; the users
+	// service enforces it on signup. AllowedDomains applies to "domain".
+	Registration   string   `bson:"registration,omitempty" json:"registration,omitempty"`
+	AllowedDomains []string `bson:"allowedDomains,omitempty" json:"allowedDomains,omitempty"`
+
+	// AdmissionURL, when set, is asked before every join and recording in
+	// the org's sessions. Requests are signed with AdmissionSecret.
+	AdmissionURL    string `bson:"admissionURL,omitempty" json:"admissionURL,omitempty"`
+	AdmissionSecret string `bson:"admissionSecret,omitempty" json:"admissionSecret,omitempty"`
+
+	// RelayOnly makes every session of the org relay only, whatever its
+	// own settings say. See SessionSettings.RelayOnly.
+	RelayOnly bool `bson:"relayOnly,omitempty" json:"relayOnly,omitempty"`
+
+	// Retention of the org's audit log, which the users service keeps, and
+	// of its recording access log, in days. Zero keeps entries forever.
+	AuditRetentionDays  int `bson:"auditRetentionDays,omitempty" json:"auditRetentionDays,omitempty"`
+	AccessRetentionDays int `bson:"accessRetentionDays,omitempty" json:"accessRetentionDays,omitempty"`
+}
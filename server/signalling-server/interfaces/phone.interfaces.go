@@ -0,0 +1,46 @@
+package interfaces
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A phone participant is "active" from the moment it is dialed until it is
+// hung up, which ends it.
+const (
+	PhoneActive = "active"
+	PhoneEnded  = "ended"
+)
+
+// PhoneCall is a phone number dialed into a session, kept for the session's
+// history. Only the masked number is stored.
+type PhoneCall struct {
+	ID        string     `bson:"_id" json:"id"`
+	SessionID string     `bson:"sessionID" json:"sessionID"`
+	Socket    string     `bson:"socket" json:"-"`
+	Name      string     `bson:"name" json:"name"`
+	Number    string     `bson:"number" json:"number"`
+	DialedBy  string     `bson:"dialedBy" json:"dialedBy"`
+	Status    string     `bson:"status" json:"status"`
+	Muted     bool       `bson:"muted" json:"muted"`
+	StartedAt time.Time  `bson:"startedAt" json:"startedAt"`
+	EndedAt   *time.Time `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+}
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ParsePhoneNumber normalizes a number to E.164, dropping the spaces,
+// dashes and brackets people type. It reports false for anything else.
+func ParsePhoneNumber(number string) (string, bool) {
+	number = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(number)
+	return number, e164.MatchString(number)
+}
+
+// MaskPhoneNumber hides all but the last four digits of a number.
+func MaskPhoneNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("•", len(number)-4) + number[len(number)-4:]
+}
@@ -0,0 +1,98 @@
+package interfaces
+
+import (
+	"errors"
+	"strings"
+)
+
+// MediaPolicy bounds what participants publish, so large meetings degrade
+// predictably instead of overwhelming clients. Zero values leave a limit
+// off.
+type MediaPolicy struct {
+	// MaxBitrate caps each participant's video publish bitrate, in kbps.
+	MaxBitrate int `bson:"maxBitrate,omitempty" json:"maxBitrate,omitempty"`
+	// MaxResolution caps published video, e.g. "720p".
+	MaxResolution string `bson:"maxResolution,omitempty" json:"maxResolution,omitempty"`
+	// VideoOffAbove turns cameras off while more than this many
+	// participants are connected. Screen shares are unaffected.
+	VideoOffAbove int `bson:"videoOffAbove,omitempty" json:"videoOffAbove,omitempty"`
+}
+
+// AudioPolicy turns on Opus resilience features for lossy links. Features
+// left off are negotiated by the peers as usual.
+type AudioPolicy struct {
+	// FEC carries in-band forward error correction.
+	FEC bool `bson:"fec" json:"fec"`
+	// DTX stops sending during silence.
+	DTX bool `bson:"dtx" json:"dtx"`
+	// RED sends redundant audio where the peers support it.
+	RED bool `bson:"red" json:"red"`
+}
+
+// CodecPolicy restricts and orders the codecs negotiated in a room, e.g. to
+// force H.264 for Safari-heavy audiences. Empty lists leave the deployment
+// defaults.
+type CodecPolicy struct {
+	Allowed   []string `bson:"allowed,omitempty" json:"allowed,omitempty"`
+	Preferred []string `bson:"preferred,omitempty" json:"preferred,omitempty"`
+}
+
+// Within narrows the deployment's codec policy by the room's. A room can
+// only restrict the codecs the deployment allows, never add to them.
+func (p CodecPolicy) Within(deployment CodecPolicy) CodecPolicy {
+	effective := deployment
+	if len(p.Allowed) > 0 {
+		if len(deployment.Allowed) == 0 {
+			effective.Allowed = p.Allowed
+		} else {
+			var both []string
+			for _, codec := range p.Allowed {
+				for _, permitted := range deployment.Allowed {
+					if strings.EqualFold(codec, permitted) {
+						both = append(both, codec)
+					}
+				}
+			}
+			if len(both) > 0 {
+				effective.Allowed = both
+			}
+		}
+	}
+	if len(p.Preferred) > 0 {
+		effective.Preferred = p.Preferred
+	}
+	return effective
+}
+
+// MediaLimits is a policy applied to a room of a given size, as sent to
+// clients.
+type MediaLimits struct {
+	Video      bool `json:"video"`
+	MaxBitrate int  `json:"maxBitrate,omitempty"`
+	MaxHeight  int  `json:"maxHeight,omitempty"`
+}
+
+var resolutions = map[string]int{"180p": 180, "360p": 360, "540p": 540, "720p": 720, "1080p": 1080}
+
+func (p MediaPolicy) Validate() error {
+	if p.MaxBitrate < 0 {
+		return errors.New("maxBitrate cannot be negative.")
+	}
+	if p.MaxResolution != "" && resolutions[p.MaxResolution] == 0 {
+		return errors.New("maxResolution must be one of 180p, 360p, 540p, 720p or 1080p.")
+	}
+	if p.VideoOffAbove < 0 {
+		return errors.New("videoOffAbove cannot be negative.")
+	}
+	return nil
+}
+
+// Limits applies the policy to a room with the given number of connected
+// participants.
+func (p MediaPolicy) Limits(participants int) MediaLimits {
+	return MediaLimits{
+		Video:      p.VideoOffAbove == 0 || participants <= p.VideoOffAbove,
+		MaxBitrate: p.MaxBitrate,
+		MaxHeight:  resolutions[p.MaxResolution],
+	}
+}
@@ -0,0 +1,13 @@
+package interfaces
+
+// Preferences are a user's meeting defaults, saved by the users service.
+type Preferences struct {
+	MuteOnJoin      bool   `bson:"muteOnJoin" json:"muteOnJoin"`
+	VideoOffOnJoin  bool   `bson:"videoOffOnJoin" json:"videoOffOnJoin"`
+	VideoQuality    string `bson:"videoQuality" json:"videoQuality"`
+	CaptionLanguage string `bson:"captionLanguage" json:"captionLanguage"`
+	DoNotDisturb    bool   `bson:"doNotDisturb" json:"doNotDisturb"`
+}
+
+// DefaultPreferences apply to guests and to users who never saved any.
+var DefaultPreferences = Preferences{VideoQuality: "auto", CaptionLanguage: "en"}
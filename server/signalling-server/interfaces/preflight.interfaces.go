@@ -0,0 +1,32 @@
+package interfaces
+
+import "time"
+
+// PreflightReport is what a client measured before joining, kept with the
+// session and user so support can look it up after a complaint.
+type PreflightReport struct {
+	ID        string    `bson:"_id" json:"id"`
+	SessionID string    `bson:"sessionID,omitempty" json:"sessionID,omitempty"`
+	UserID    string    `bson:"userID,omitempty" json:"userID,omitempty"`
+	Region    string    `bson:"region,omitempty" json:"region,omitempty"`
+	IP        string    `bson:"ip" json:"ip"`
+	UserAgent string    `bson:"userAgent" json:"userAgent"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+
+	SubmittedAt *time.Time       `bson:"submittedAt,omitempty" json:"submittedAt,omitempty"`
+	Results     *PreflightResult `bson:"results,omitempty" json:"results,omitempty"`
+}
+
+// PreflightResult is submitted by the client once its checks finish.
+type PreflightResult struct {
+	// SignallingRTT lists round trips of the WebSocket echo probe, in ms.
+	SignallingRTT []float64 `bson:"signallingRTT" json:"signallingRTT"`
+	// UDP reports whether a STUN binding to the media node succeeded; nil
+	// when the check was skipped.
+	UDP *bool `bson:"udp,omitempty" json:"udp,omitempty"`
+	// Candidates counts gathered ICE candidates by type (host, srflx,
+	// relay) and protocol, e.g. "srflx/udp".
+	Candidates map[string]int `bson:"candidates,omitempty" json:"candidates,omitempty"`
+	TURN       *bool          `bson:"turn,omitempty" json:"turn,omitempty"`
+	Errors     []string       `bson:"errors,omitempty" json:"errors,omitempty"`
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+// SetProfile applies a profile change of the participant's account: the
+// display name, numbered as SetName does and kept when empty, and the
+// avatar. It reports whether anything changed.
+func (r *Room) SetProfile(userID, name, avatar string) (Participant, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if participant == nil {
+		return Participant{}, false
+	}
+	previous := *participant
+	r.name(participant, name)
+	participant.Avatar = avatar
+	changed := participant.Name != previous.Name || participant.Avatar != previous.Avatar
+	return *participant, changed
+}
@@ -0,0 +1,120 @@
+package interfaces
+
+import "time"
+
+// A recording is "recording" while the egress runs, "processing" while it
+// waits for or goes through transcoding, then "ready" or, once retries are
+// exhausted, "failed". A ready recording whose files were deleted to keep
+// its org within its storage quota is "deleted".
+const (
+	RecordingActive     = "recording"
+	RecordingProcessing = "processing"
+	RecordingReady      = "ready"
+	RecordingFailed     = "failed"
+	RecordingDeleted    = "deleted"
+)
+
+// Recording tracks an egress started for a session.
+type Recording struct {
+	ID        string     `bson:"_id" json:"id"`
+	SessionID string     `bson:"sessionID" json:"sessionID"`
+	OrgID     string     `bson:"orgID,omitempty" json:"-"`
+	Socket    string     `bson:"socket" json:"-"`
+	Backend   string     `bson:"backend" json:"backend"`
+	Status    string     `bson:"status" json:"status"`
+	Location  string     `bson:"location,omitempty" json:"location,omitempty"`
+	Streams   []string   `bson:"streams,omitempty" json:"streams,omitempty"`
+	Watermark string     `bson:"watermark,omitempty" json:"watermark,omitempty"`
+	StartedAt time.Time  `bson:"startedAt" json:"startedAt"`
+	StoppedAt *time.Time `bson:"stoppedAt,omitempty" json:"stoppedAt,omitempty"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	// Assets are recorded next to the composite, e.g. each screen share.
+	Assets []RecordingAsset `bson:"assets,omitempty" json:"assets,omitempty"`
+	// Markers are chapters for playback, in the order they were added.
+	Markers []RecordingMarker `bson:"markers,omitempty" json:"markers,omitempty"`
+	// Highlights are short clips cut from the recording once it is
+	// processed.
+	Highlights []RecordingHighlight `bson:"highlights,omitempty" json:"highlights,omitempty"`
+	// Redactions are the spans redacted since the recording was made, and
+	// by whom, in the order they were made.
+	Redactions []RecordingRedaction `bson:"redactions,omitempty" json:"redactions,omitempty"`
+
+	Output          string  `bson:"output,omitempty" json:"-"`
+	Thumbnail       string  `bson:"thumbnail,omitempty" json:"-"`
+	DurationSeconds float64 `bson:"durationSeconds,omitempty" json:"durationSeconds,omitempty"`
+	Size            int64   `bson:"size,omitempty" json:"size,omitempty"`
+
+	Attempts      int       `bson:"attempts" json:"-"`
+	Error         string    `bson:"error,omitempty" json:"error,omitempty"`
+	NextAttemptAt time.Time `bson:"nextAttemptAt,omitempty" json:"-"`
+	LockedUntil   time.Time `bson:"lockedUntil,omitempty" json:"-"`
+}
+
+// Kinds of recording asset.
+const (
+	AssetScreenShare = "screen_share"
+)
+
+// RecordingAsset is a track recorded on its own during a recording, at full
+// resolution. Offsets are in seconds from the start of the recording, so
+// players can line the asset up with the composite.
+type RecordingAsset struct {
+	ID          string     `bson:"id" json:"id"`
+	Kind        string     `bson:"kind" json:"kind"`
+	UserID      string     `bson:"userID" json:"userID"`
+	Location    string     `bson:"location,omitempty" json:"location,omitempty"`
+	StartOffset float64    `bson:"startOffset" json:"startOffset"`
+	EndOffset   *float64   `bson:"endOffset,omitempty" json:"endOffset,omitempty"`
+	StartedAt   time.Time  `bson:"startedAt" json:"startedAt"`
+	StoppedAt   *time.Time `bson:"stoppedAt,omitempty" json:"stoppedAt,omitempty"`
+}
+
+// Kinds of recording marker.
+const (
+	// MarkerManual is a marker a host dropped with add_marker.
+	MarkerManual      = "manual"
+	MarkerScreenShare = "screen_share"
+)
+
+// RecordingMarker is a chapter of a recording. Offset is in seconds from
+// the start of the recording.
+type RecordingMarker struct {
+	Offset float64   `bson:"offset" json:"offset"`
+	Kind   string    `bson:"kind" json:"kind"`
+	Title  string    `bson:"title" json:"title"`
+	UserID string    `bson:"userID,omitempty" json:"userID,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// Reasons a highlight was cut.
+const (
+	HighlightMarker    = "marker"
+	HighlightReactions = "reactions"
+)
+
+// RecordingHighlight is a clip of a recording around a marker a host
+// dropped or a spike in reactions. Offsets are in seconds from the start of
+// the recording.
+type RecordingHighlight struct {
+	ID          string  `bson:"id" json:"id"`
+	Reason      string  `bson:"reason" json:"reason"`
+	Title       string  `bson:"title,omitempty" json:"title,omitempty"`
+	StartOffset float64 `bson:"startOffset" json:"startOffset"`
+	EndOffset   float64 `bson:"endOffset" json:"endOffset"`
+	Output      string  `bson:"output" json:"-"`
+	Size        int64   `bson:"size" json:"size"`
+}
+
+// RecordingRedaction is a span of a recording redacted by its session's
+// owner or an admin. Bleep replaces the span's audio with a tone when the
+// recording is processed. Offsets are in seconds from the start of the
+// recording.
+type RecordingRedaction struct {
+	ID          string    `bson:"id" json:"id"`
+	StartOffset float64   `bson:"startOffset" json:"startOffset"`
+	EndOffset   float64   `bson:"endOffset" json:"endOffset"`
+	Bleep       bool      `bson:"bleep" json:"bleep"`
+	Reason      string    `bson:"reason" json:"reason"`
+	By          string    `bson:"by" json:"by"`
+	At          time.Time `bson:"at" json:"at"`
+}
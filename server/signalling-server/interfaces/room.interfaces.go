@@ -0,0 +1,1016 @@
+package interfaces
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	RoleHost        = "host"
+	RoleParticipant = "participant"
+	// RoleAttendee watches a webinar without publishing until a host gives
+	// them the floor.
+	RoleAttendee = "attendee"
+)
+
+// maxNameLength bounds display names, in characters.
+const maxNameLength = 64
+
+// Participant is a user known to a room, connected or not. Roles outlive a
+// connection so a host who drops and reconnects is still the host.
+type Participant struct {
+	// ID is assigned by the server and identifies the participant in the
+	// roster even when clients reuse a UserID or a display name.
+	ID       string    `bson:"id" json:"id"`
+	UserID   string    `bson:"userID" json:"userID"`
+	Role     string    `bson:"role" json:"role"`
+	JoinedAt time.Time `bson:"joinedAt" json:"joinedAt"`
+
+	// ResumeToken proves a new connection belongs to the participant, e.g.
+	// after the device moved from Wi-Fi to cellular.
+	ResumeToken string `bson:"resumeToken" json:"-"`
+
+	// Account is the account the participant joined signed in as, empty
+	// for guests. Connections signed in to it may take their place.
+	Account string `bson:"account,omitempty" json:"-"`
+
+	// Name is the display name, unique within the room.
+	Name string `bson:"name,omitempty" json:"name,omitempty"`
+	// Avatar is the picture of a signed in participant, from their profile.
+	Avatar string `bson:"avatar,omitempty" json:"avatar,omitempty"`
+	// Metadata holds tags the client attached when joining, such as a CRM
+	// ID or pronouns. See ValidateMetadata.
+	Metadata map[string]string `bson:"metadata,omitempty" json:"metadata,omitempty"`
+
+	// Phone is the masked number of a participant dialed in by phone. They
+	// have no connection; the media backend carries their audio.
+	Phone string `bson:"phone,omitempty" json:"phone,omitempty"`
+	Muted bool   `bson:"muted,omitempty" json:"muted,omitempty"`
+
+	// LowData is set for participants on a constrained network, who
+	// receive audio and a few thumbnails only. See SetLowData.
+	LowData bool `bson:"lowData,omitempty" json:"lowData,omitempty"`
+
+	// Disabled lists the features an embed token took away from the
+	// participant. See EmbedFeatures.
+	Disabled []string `bson:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+func newParticipant(userID, role string) *Participant {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return &Participant{ID: newParticipantID(), UserID: userID, Role: role, JoinedAt: time.Now(), ResumeToken: hex.EncodeToString(token)}
+}
+
+func newParticipantID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "p-" + hex.EncodeToString(id)
+}
+
+// cleanName trims a requested display name and drops control characters,
+// keeping at most maxNameLength characters.
+func cleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = strings.TrimSpace(string(runes[:maxNameLength]))
+	}
+	return name
+}
+
+// numbered reports whether name is requested, or requested with a
+// duplicate's suffix such as "Alex (2)".
+func numbered(name, requested string) bool {
+	if name == requested {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(name, requested+" (")
+	if !ok || !strings.HasSuffix(suffix, ")") {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSuffix(suffix, ")"))
+	return err == nil
+}
+
+// RoomSnapshot is the part of a room's state that survives a signalling node
+// restart.
+type RoomSnapshot struct {
+	Socket       string        `bson:"_id" json:"-"`
+	Participants []Participant `bson:"participants" json:"participants"`
+	Locked       bool          `bson:"locked" json:"locked"`
+	Lobby        []string      `bson:"lobby" json:"lobby"`
+	Layout       *Layout       `bson:"layout,omitempty" json:"layout,omitempty"`
+	Floor        []string      `bson:"floor,omitempty" json:"floor,omitempty"`
+	Promoted     []string      `bson:"promoted,omitempty" json:"-"`
+	Sharing      []string      `bson:"sharing,omitempty" json:"-"`
+	Agenda       *Agenda       `bson:"agenda,omitempty" json:"agenda,omitempty"`
+	UpdatedAt    time.Time     `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Room is the set of connections sharing a socket URL. It is accessed from
+// every connection's reader goroutine and from the fan-out workers, so all
+// access goes through its lock.
+type Room struct {
+	// Session is the ID of the session the room belongs to.
+	Session string
+
+	// Org owns the session the room belongs to, if any.
+	Org string
+
+	// Settings of the session, loaded when the room is created.
+	Settings SessionSettings
+
+	// OnLeave is called after a user's connection is removed, with whether
+	// the room is now empty.
+	OnLeave func(userID string, empty bool)
+
+	mu           sync.RWMutex
+	clients      map[string]*Connection
+	participants map[string]*Participant
+	locked       bool
+	lobby        []string
+	layout       *Layout
+	waiting      map[string]*Connection
+	away         map[string]bool
+	videoOff     bool
+
+	// admitted holds the connections users were admitted from the lobby
+	// on, until they join on them.
+	admitted map[string]*Connection
+
+	// floor is the queue of attendees asking to speak, and promoted the
+	// attendees a host gave the floor to.
+	floor    []string
+	promoted map[string]bool
+
+	// subscriptions holds, for participants who manage their video
+	// subscriptions, the publishers whose video they receive. Participants
+	// without an entry receive everyone's.
+	subscriptions map[string]map[string]bool
+
+	// pending holds messages addressed to users who are not connected, for
+	// when they join.
+	pending map[string][]PendingFrame
+
+	// seq is the sequence number of the last message relayed from each
+	// user. It is kept for the life of the room so that a user rejoining
+	// does not start over below what others have already received.
+	seq map[string]uint64
+
+	// files holds the file transfers in progress, by ID.
+	files map[string]*FileTransfer
+
+	// sharing holds the users sharing their screen.
+	sharing map[string]bool
+
+	// active holds when each participant last spoke or did something, and
+	// warned when those found inactive were warned. See Inactive.
+	active map[string]time.Time
+	warned map[string]time.Time
+
+	// agenda is the meeting's agenda, nil when it has none.
+	agenda *Agenda
+
+	// hosts holds the users made hosts since Settings were loaded. See
+	// AddHost.
+	hosts map[string]bool
+}
+
+// PendingFrame is a message held for a user who is not connected.
+type PendingFrame struct {
+	Frame  json.RawMessage
+	Type   string
+	Sender string
+	Seq    uint64
+	At     time.Time
+}
+
+// SubscriptionStats summarizes how much video a room's subscribers opted
+// out of.
+type SubscriptionStats struct {
+	Participants int `json:"participants"`
+	Managed      int `json:"managed"`
+	// Streams is the number of video streams being received; Possible is
+	// the number everyone receiving everyone would take.
+	Streams  int     `json:"streams"`
+	Possible int     `json:"possible"`
+	Saved    float64 `json:"saved"`
+}
+
+func NewRoom() *Room {
+	return &Room{
+		clients:      make(map[string]*Connection),
+		participants: make(map[string]*Participant),
+		waiting:      make(map[string]*Connection),
+		away:         make(map[string]bool),
+		admitted:     make(map[string]*Connection),
+
+		subscriptions: make(map[string]map[string]bool),
+		pending:       make(map[string][]PendingFrame),
+		seq:           make(map[string]uint64),
+		promoted:      make(map[string]bool),
+		files:         make(map[string]*FileTransfer),
+		sharing:       make(map[string]bool),
+		active:        make(map[string]time.Time),
+		warned:        make(map[string]time.Time),
+		hosts:         make(map[string]bool),
+	}
+}
+
+// Join registers connection for userID unless the user is already connected
+// and returns the user's connection. The first participant of a room becomes
+// its host, unless the session does not allow hosts or names its hosts.
+func (r *Room) Join(userID string, connection *Connection) *Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[userID] == nil {
+		r.clients[userID] = connection
+		delete(r.away, userID)
+		delete(r.admitted, userID)
+		r.active[userID] = time.Now()
+	}
+
+	if r.participants[userID] == nil {
+		r.participants[userID] = newParticipant(userID, r.newRole(userID))
+		r.participants[userID].Account = connection.Account
+	}
+	return r.clients[userID]
+}
+
+func (r *Room) newRole(userID string) string {
+	if r.hosts[userID] {
+		return RoleHost
+	}
+	if len(r.Settings.Hosts) > 0 {
+		for _, host := range r.Settings.Hosts {
+			if host == userID {
+				return RoleHost
+			}
+		}
+	} else if len(r.participants) == 0 && r.Settings.Allows(RoleHost) {
+		return RoleHost
+	}
+	if r.Settings.Webinar {
+		return RoleAttendee
+	}
+	return RoleParticipant
+}
+
+// AddHost names the user a host of the room after its Settings were
+// loaded, as when an instructor enrolls in a course meeting already
+// running. A participant already in the room is made host.
+func (r *Room) AddHost(userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hosts[userID] = true
+	if participant := r.participants[userID]; participant != nil {
+		participant.Role = RoleHost
+	}
+}
+
+// Admits reports whether a user who is not yet a participant would get a
+// role the session allows. Known participants are always admitted.
+func (r *Room) Admits(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.participants[userID] != nil || r.Settings.Allows(r.newRole(userID))
+}
+
+// RoleFor returns the user's role, or the role they would get by joining
+// now.
+func (r *Room) RoleFor(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if participant := r.participants[userID]; participant != nil {
+		return participant.Role
+	}
+	return r.newRole(userID)
+}
+
+// Known reports whether the user is a participant, connected or not.
+func (r *Room) Known(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.participants[userID] != nil
+}
+
+// Started reports whether anyone has joined the room yet.
+func (r *Room) Started() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.participants) > 0
+}
+
+// Wait puts the user in the lobby until a host admits them.
+func (r *Room) Wait(userID string, connection *Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A restored lobby lists users whose connections were lost with the
+	// node; they keep their place when they reconnect.
+	for _, waiting := range r.lobby {
+		if waiting == userID {
+			r.waiting[userID] = connection
+			return
+		}
+	}
+	r.lobby = append(r.lobby, userID)
+	r.waiting[userID] = connection
+}
+
+func (r *Room) Waiting(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.waiting[userID] != nil
+}
+
+// Lobby lists the users waiting to be admitted, longest waiting first.
+func (r *Room) Lobby() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string{}, r.lobby...)
+}
+
+// Admit moves the user from the lobby into the room as a participant and
+// returns the connection they waited on, or nil if they were not waiting.
+func (r *Room) Admit(userID string) *Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	connection := r.unwait(userID)
+	if connection != nil && r.participants[userID] == nil {
+		r.participants[userID] = newParticipant(userID, r.newRole(userID))
+		r.participants[userID].Account = connection.Account
+		r.admitted[userID] = connection
+	}
+	return connection
+}
+
+// Deny removes the user from the lobby and returns their connection.
+func (r *Room) Deny(userID string) *Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.unwait(userID)
+}
+
+func (r *Room) unwait(userID string) *Connection {
+	connection := r.waiting[userID]
+	delete(r.waiting, userID)
+	for i, waiting := range r.lobby {
+		if waiting == userID {
+			r.lobby = append(r.lobby[:i], r.lobby[i+1:]...)
+			break
+		}
+	}
+	return connection
+}
+
+// Hosts returns the connections of the hosts in the room.
+func (r *Room) Hosts() []*Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var hosts []*Connection
+	for user, client := range r.clients {
+		if participant := r.participants[user]; participant != nil && participant.Role == RoleHost {
+			hosts = append(hosts, client)
+		}
+	}
+	return hosts
+}
+
+// Holds reports whether connection is the one the user joined, or is
+// waiting in the lobby, on.
+func (r *Room) Holds(userID string, connection *Connection) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clients[userID] == connection || r.waiting[userID] == connection
+}
+
+func (r *Room) Get(userID string) *Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clients[userID]
+}
+
+// Leave drops the user's connection. Their participant record is kept so
+// that a reconnect restores their role.
+func (r *Room) Leave(userID string) {
+	r.mu.Lock()
+	_, ok := r.clients[userID]
+	delete(r.clients, userID)
+	empty := len(r.clients) == 0
+	r.mu.Unlock()
+
+	if ok && r.OnLeave != nil {
+		r.OnLeave(userID, empty)
+	}
+}
+
+// Remove forgets the user entirely, as when they leave the meeting on purpose.
+func (r *Room) Remove(userID string) {
+	r.Leave(userID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.participants, userID)
+	delete(r.subscriptions, userID)
+	for _, publishers := range r.subscriptions {
+		delete(publishers, userID)
+	}
+	r.floor = remove(r.floor, userID)
+	delete(r.promoted, userID)
+	r.dropFiles(userID)
+	delete(r.admitted, userID)
+	delete(r.sharing, userID)
+	delete(r.active, userID)
+	delete(r.warned, userID)
+}
+
+// Detach drops every user registered with connection, used when its socket
+// closes without the client saying goodbye.
+func (r *Room) Detach(connection *Connection) {
+	r.mu.RLock()
+	var users []string
+	for user, client := range r.clients {
+		if client == connection {
+			users = append(users, user)
+		}
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	for user, waiting := range r.waiting {
+		if waiting == connection {
+			r.unwait(user)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, user := range users {
+		r.Leave(user)
+	}
+}
+
+// Suspend takes the users of a closed connection out of the room without
+// leaving it, so a client switching networks can resume within a grace
+// period instead of dropping out of the roster. It returns the users, for
+// Expire once the grace period ends.
+func (r *Room) Suspend(connection *Connection) []string {
+	r.mu.Lock()
+	var users []string
+	for user, client := range r.clients {
+		if client == connection {
+			users = append(users, user)
+			delete(r.clients, user)
+			r.away[user] = true
+		}
+	}
+	for user, waiting := range r.waiting {
+		if waiting == connection {
+			r.unwait(user)
+		}
+	}
+	r.mu.Unlock()
+	return users
+}
+
+// Away reports whether the user is suspended and may still resume.
+func (r *Room) Away(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.away[userID]
+}
+
+// Expire completes the leave of a suspended user who did not come back.
+func (r *Room) Expire(userID string) {
+	r.mu.Lock()
+	away := r.away[userID]
+	delete(r.away, userID)
+	empty := len(r.clients) == 0
+	r.mu.Unlock()
+
+	if away && r.OnLeave != nil {
+		r.OnLeave(userID, empty)
+	}
+}
+
+// ResumeToken returns the token the user presents to resume on another
+// connection.
+func (r *Room) ResumeToken(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if participant := r.participants[userID]; participant != nil {
+		return participant.ResumeToken
+	}
+	return ""
+}
+
+// Resume moves the user onto connection if token is theirs, whether their
+// previous connection is suspended or has not noticed it is dead yet. It
+// returns the replaced connection, if any.
+func (r *Room) Resume(userID, token string, connection *Connection) (*Connection, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if participant == nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(participant.ResumeToken)) != 1 {
+		return nil, false
+	}
+	old := r.clients[userID]
+	if old == nil && !r.away[userID] {
+		return nil, false
+	}
+	r.clients[userID] = connection
+	delete(r.away, userID)
+	if old == connection {
+		old = nil
+	}
+	return old, true
+}
+
+// Proves reports whether connection, presenting token, is the participant
+// userID names, and so may take their place. Signed-in participants are
+// proved by their account, anyone by their resume token, and users just
+// admitted from the lobby by the connection they waited on. A user ID that
+// is an account is always the account's.
+func (r *Room) Proves(userID string, connection *Connection, token string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participant := r.participants[userID]
+	if participant == nil || r.admitted[userID] == connection {
+		return true
+	}
+	if account := connection.Account; account != "" && (account == participant.Account || account == userID) {
+		return true
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(participant.ResumeToken)) == 1
+}
+
+// NextSeq numbers the next message relayed from the user, starting at 1.
+func (r *Room) NextSeq(userID string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq[userID]++
+	return r.seq[userID]
+}
+
+// Replace makes connection the user's, returning the connection it
+// replaces, if any.
+func (r *Room) Replace(userID string, connection *Connection) *Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.clients[userID]
+	r.clients[userID] = connection
+	delete(r.away, userID)
+	return old
+}
+
+// Device returns a user ID, derived from userID, that nobody in the room
+// uses, for another device of the same user: "alex#2", "alex#3"...
+func (r *Room) Device(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for n := 2; ; n++ {
+		device := userID + "#" + strconv.Itoa(n)
+		if r.clients[device] == nil && !r.away[device] {
+			return device
+		}
+	}
+}
+
+// Hold keeps a frame addressed to a user who is not connected, for Take.
+// Frames older than window are discarded, as are the oldest frames beyond
+// limit. It returns the user's connection instead of holding the frame if
+// they connected in the meantime.
+func (r *Room) Hold(userID string, frame PendingFrame, window time.Duration, limit int) *Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if client := r.clients[userID]; client != nil {
+		return client
+	}
+
+	r.prunePending(frame.At.Add(-window))
+	held := append(r.pending[userID], frame)
+	if len(held) > limit {
+		held = held[len(held)-limit:]
+	}
+	r.pending[userID] = held
+	return nil
+}
+
+// Take returns and forgets the frames held for the user that are not older
+// than window, oldest first.
+func (r *Room) Take(userID string, window time.Duration) []PendingFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := r.pending[userID]
+	delete(r.pending, userID)
+	cutoff := time.Now().Add(-window)
+	for len(held) > 0 && held[0].At.Before(cutoff) {
+		held = held[1:]
+	}
+	return held
+}
+
+// prunePending drops frames held since before cutoff.
+func (r *Room) prunePending(cutoff time.Time) {
+	for user, held := range r.pending {
+		for len(held) > 0 && held[0].At.Before(cutoff) {
+			held = held[1:]
+		}
+		if len(held) == 0 {
+			delete(r.pending, user)
+		} else {
+			r.pending[user] = held
+		}
+	}
+}
+
+// SetVideo records whether the room's media policy currently allows video
+// and reports whether that changed.
+func (r *Room) SetVideo(allowed bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := r.videoOff == allowed
+	r.videoOff = !allowed
+	return changed
+}
+
+// Subscribe adds publishers to the video the subscriber receives, switching
+// them to managed subscriptions. Subscribers in low data mode receive at
+// most MaxThumbnails publishers. It returns the publishers that were added.
+func (r *Room) Subscribe(subscriber string, publishers []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribed := r.subscriptions[subscriber]
+	if subscribed == nil {
+		subscribed = make(map[string]bool)
+		r.subscriptions[subscriber] = subscribed
+	}
+	limit := len(r.participants)
+	if participant := r.participants[subscriber]; participant != nil && participant.LowData {
+		limit = MaxThumbnails
+	}
+	var added []string
+	for _, publisher := range publishers {
+		if len(subscribed) >= limit {
+			break
+		}
+		if publisher != subscriber && r.participants[publisher] != nil && !subscribed[publisher] {
+			subscribed[publisher] = true
+			added = append(added, publisher)
+		}
+	}
+	return added
+}
+
+// Unsubscribe stops the subscriber receiving the publishers' video. A
+// subscriber that was receiving everyone now receives everyone else. It
+// returns the publishers that were removed.
+func (r *Room) Unsubscribe(subscriber string, publishers []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscribed := r.subscriptions[subscriber]
+	if subscribed == nil {
+		subscribed = make(map[string]bool)
+		for user := range r.clients {
+			if user != subscriber {
+				subscribed[user] = true
+			}
+		}
+		r.subscriptions[subscriber] = subscribed
+	}
+	var removed []string
+	for _, publisher := range publishers {
+		if subscribed[publisher] {
+			delete(subscribed, publisher)
+			removed = append(removed, publisher)
+		}
+	}
+	return removed
+}
+
+// Subscriptions returns the publishers whose video the subscriber receives,
+// and false if they receive everyone's.
+func (r *Room) Subscriptions(subscriber string) ([]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscribed := r.subscriptions[subscriber]
+	if subscribed == nil {
+		return nil, false
+	}
+	publishers := make([]string, 0, len(subscribed))
+	for publisher := range subscribed {
+		publishers = append(publishers, publisher)
+	}
+	sort.Strings(publishers)
+	return publishers, true
+}
+
+// SubscriptionStats counts the video streams the connected participants
+// receive.
+func (r *Room) SubscriptionStats() SubscriptionStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := SubscriptionStats{Participants: len(r.clients)}
+	stats.Possible = stats.Participants * (stats.Participants - 1)
+	for user := range r.clients {
+		subscribed := r.subscriptions[user]
+		if subscribed == nil {
+			stats.Streams += stats.Participants - 1
+			continue
+		}
+		stats.Managed++
+		for publisher := range subscribed {
+			if r.clients[publisher] != nil {
+				stats.Streams++
+			}
+		}
+	}
+	if stats.Possible > 0 {
+		stats.Saved = 1 - float64(stats.Streams)/float64(stats.Possible)
+	}
+	return stats
+}
+
+// AddPhone adds a phone participant to the roster and returns it.
+func (r *Room) AddPhone(userID, name, phone string) Participant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := newParticipant(userID, RoleParticipant)
+	participant.Phone = phone
+	r.name(participant, name)
+	r.participants[userID] = participant
+	return *participant
+}
+
+// Phone reports whether the user is a phone participant.
+func (r *Room) Phone(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	participant := r.participants[userID]
+	return participant != nil && participant.Phone != ""
+}
+
+// Phones returns the phone participants in the room.
+func (r *Room) Phones() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var phones []string
+	for user, participant := range r.participants {
+		if participant.Phone != "" {
+			phones = append(phones, user)
+		}
+	}
+	return phones
+}
+
+// SetMuted records whether a phone participant is muted.
+func (r *Room) SetMuted(userID string, muted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		participant.Muted = muted
+	}
+}
+
+// Clients returns a snapshot of the room's connections keyed by user.
+func (r *Room) Clients() map[string]*Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make(map[string]*Connection, len(r.clients))
+	for user, client := range r.clients {
+		clients[user] = client
+	}
+	return clients
+}
+
+func (r *Room) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// Participant returns the user's participant record.
+func (r *Room) Participant(userID string) (Participant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		return *participant, true
+	}
+	return Participant{}, false
+}
+
+// SetName gives the participant the display name they asked for, numbered
+// when another participant already has it: the second Alex becomes
+// "Alex (2)". Participants asking again for the name they already have,
+// e.g. on reconnecting, keep their number. An empty name keeps the current
+// one. It returns the name the participant ends up with.
+func (r *Room) SetName(userID, name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participant := r.participants[userID]
+	if participant == nil {
+		return ""
+	}
+	r.name(participant, name)
+	return participant.Name
+}
+
+// SetMetadata replaces the participant's metadata, which must be valid.
+func (r *Room) SetMetadata(userID string, metadata map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		participant.Metadata = metadata
+	}
+}
+
+func (r *Room) name(participant *Participant, requested string) {
+	requested = cleanName(requested)
+	if requested == "" || numbered(participant.Name, requested) {
+		return
+	}
+
+	taken := make(map[string]bool, len(r.participants))
+	for _, other := range r.participants {
+		if other != participant {
+			taken[other.Name] = true
+		}
+	}
+	name := requested
+	for n := 2; taken[name]; n++ {
+		name = fmt.Sprintf("%s (%d)", requested, n)
+	}
+	participant.Name = name
+}
+
+func (r *Room) Role(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		return participant.Role
+	}
+	return ""
+}
+
+func (r *Room) SetRole(userID string, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if participant := r.participants[userID]; participant != nil {
+		participant.Role = role
+	}
+}
+
+func (r *Room) Locked() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.locked
+}
+
+func (r *Room) SetLocked(locked bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.locked = locked
+}
+
+// Snapshot captures the room's recoverable state.
+func (r *Room) Snapshot(socket string) RoomSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := RoomSnapshot{
+		Socket:       socket,
+		Participants: make([]Participant, 0, len(r.participants)),
+		Locked:       r.locked,
+		Lobby:        append([]string{}, r.lobby...),
+		Layout:       r.layout,
+		Floor:        r.floorIDs(),
+		Agenda:       r.agendaCopy(),
+		UpdatedAt:    time.Now(),
+	}
+	for user := range r.promoted {
+		snapshot.Promoted = append(snapshot.Promoted, user)
+	}
+	for user := range r.sharing {
+		snapshot.Sharing = append(snapshot.Sharing, user)
+	}
+	for _, participant := range r.participants {
+		snapshot.Participants = append(snapshot.Participants, *participant)
+	}
+	sort.Slice(snapshot.Participants, func(i, j int) bool {
+		return snapshot.Participants[i].JoinedAt.Before(snapshot.Participants[j].JoinedAt)
+	})
+	return snapshot
+}
+
+// Restore loads state saved by Snapshot into an empty room.
+func (r *Room) Restore(snapshot RoomSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range snapshot.Participants {
+		participant := snapshot.Participants[i]
+		if participant.ID == "" {
+			participant.ID = newParticipantID()
+		}
+		r.participants[participant.UserID] = &participant
+	}
+	r.locked = snapshot.Locked
+	r.lobby = append([]string{}, snapshot.Lobby...)
+	r.layout = snapshot.Layout
+	for _, id := range snapshot.Floor {
+		for user, participant := range r.participants {
+			if participant.ID == id {
+				r.floor = append(r.floor, user)
+			}
+		}
+	}
+	for _, user := range snapshot.Promoted {
+		r.promoted[user] = true
+	}
+	for _, user := range snapshot.Sharing {
+		r.sharing[user] = true
+	}
+	if snapshot.Agenda != nil {
+		r.agenda = snapshot.Agenda
+	}
+}
+
+// SetLayout makes layout the room's, once every participant it refers to
+// is known to the room.
+func (r *Room) SetLayout(layout Layout) error {
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known := make(map[string]bool, len(r.participants))
+	for _, participant := range r.participants {
+		known[participant.ID] = true
+	}
+	for _, ids := range [][]string{layout.Pinned, layout.Order} {
+		for _, id := range ids {
+			if !known[id] {
+				return fmt.Errorf("unknown participant %s", id)
+			}
+		}
+	}
+	r.layout = &layout
+	return nil
+}
+
+// Identities returns the user IDs of the participants with the given IDs
+// in snapshot, which is how the media backend knows them. Unknown IDs are
+// skipped.
+func (s RoomSnapshot) Identities(ids []string) []string {
+	users := make(map[string]string, len(s.Participants))
+	for _, participant := range s.Participants {
+		users[participant.ID] = participant.UserID
+	}
+	var identities []string
+	for _, id := range ids {
+		if user, ok := users[id]; ok {
+			identities = append(identities, user)
+		}
+	}
+	return identities
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import "time"
+
+// Rule is an org policy evaluated before an action in the org's sessions.
+// When Condition holds, the action is refused with Message, e.g. a "join"
+// rule `user.guest && !room.host_present` keeps guests out until a host
+// arrives.
+type Rule struct {
+	ID        string    `bson:"_id" json:"id"`
+	OrgID     string    `bson:"orgID" json:"orgID"`
+	Name      string    `bson:"name" json:"name"`
+	Action    string    `bson:"action" json:"action"`
+	Condition string    `bson:"condition" json:"condition"`
+	Message   string    `bson:"message" json:"message"`
+	Disabled  bool      `bson:"disabled,omitempty" json:"disabled"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
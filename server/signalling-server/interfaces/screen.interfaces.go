@@ -0,0 +1,33 @@
+package interfaces
+
+import "sort"
+
+// SetSharing records whether the user is sharing their screen, reporting
+// whether that changed.
+func (r *Room) SetSharing(userID string, sharing bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sharing[userID] == sharing {
+		return false
+	}
+	if sharing {
+		r.sharing[userID] = true
+	} else {
+		delete(r.sharing, userID)
+	}
+	return true
+}
+
+// Sharing lists the users sharing their screen.
+func (r *Room) Sharing() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]string, 0, len(r.sharing))
+	for user := range r.sharing {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
@@ -2,9 +2,58 @@
 
 package interfaces
 
+import "time"
+
+// Session access modes. Invite-only and org sessions have no password:
+// AccessInvite admits holders of a signed invite, AccessOrg signed-in
+// members of the session's org as well.
+const (
+	AccessPassword = "password"
+	AccessInvite = "invite"
+	AccessOrg = "org"
+)
 
 type Session struct {
 	Host string
 	Title string
 	Password string
+	Access string `bson:"access,omitempty" json:"access,omitempty"`
+	MatrixRoom string
+	// OrgID is the org of the session's template or owner; callers cannot
+	// choose it.
+	OrgID string `bson:"orgID,omitempty" json:"-"`
+	OwnerID string `bson:"ownerID,omitempty" json:"-"`
+	// CreatorID is who created the session: the owner, or a delegate
+	// scheduling it on the owner's behalf.
+	CreatorID string `bson:"creatorID,omitempty" json:"-"`
+	TemplateID string `bson:"templateID,omitempty" json:"templateID,omitempty"`
+	Settings SessionSettings `bson:"settings" json:"settings"`
+	Watermark *Watermark `bson:"watermark,omitempty" json:"watermark,omitempty"`
+	EndedAt *time.Time `bson:"endedAt,omitempty" json:"-"`
+	// StartsAt is when a scheduled session is due to start, and Devices the
+	// room devices booked for it, which join it on their own.
+	StartsAt *time.Time `bson:"startsAt,omitempty" json:"startsAt,omitempty"`
+	EndsAt *time.Time `bson:"endsAt,omitempty" json:"endsAt,omitempty"`
+	Devices []string `bson:"devices,omitempty" json:"devices,omitempty"`
+	// CancelledAt is set when the owner called a scheduled session off.
+	CancelledAt *time.Time `bson:"cancelledAt,omitempty" json:"-"`
+	// OwnerDeactivatedAt is set by the users service on scheduled sessions
+	// whose owner was deactivated before they started.
+	OwnerDeactivatedAt *time.Time `bson:"ownerDeactivatedAt,omitempty" json:"ownerDeactivatedAt,omitempty"`
+	// Agenda is the meeting's planned agenda, which its room starts with.
+	Agenda []AgendaItem `bson:"agenda,omitempty" json:"agenda,omitempty"`
+}
+
+// NeedsPassword reports whether joining takes the shared password. Sessions
+// created before access modes existed do.
+func (s Session) NeedsPassword() bool {
+	return s.Access == "" || s.Access == AccessPassword
+}
+
+// Watermark marks a confidential session. Text may use the {name}, {email}
+// and {session} placeholders, filled in per viewer.
+type Watermark struct {
+	Text string `bson:"text" json:"text"`
+	Opacity float64 `bson:"opacity" json:"opacity"`
+	Position string `bson:"position" json:"position"`
 }
\ No newline at end of file
@@ -1,9 +1,19 @@
 package interfaces
 
 type Socket struct {
-	SessionID string
-	HashedURL string
-	SocketURL string
+	SessionID string `bson:"sessionID"`
+	HashedURL string `bson:"hashedUrl"`
+	SocketURL string `bson:"socketUrl"`
+	MatrixRoom string `bson:"matrixRoom,omitempty"`
+	OrgID string `bson:"orgID,omitempty"`
+}
+
+// Envelope is the routing part of a Message. The relay decodes only these
+// fields and forwards the rest of the frame untouched.
+type Envelope struct {
+	Type string `json:"type"`
+	UserID string `json:"userID"`
+	To string `json:"to"`
 }
 
 type Message struct {
@@ -12,4 +22,17 @@ type Message struct {
 	Description string `json:"description"`
 	Candidate string `json:"candidate"`
 	To string `json:"to"`
+	Text string `json:"text,omitempty"`
+	URL string `json:"url,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+	// RequestID correlates the message with the request that caused it.
+	RequestID string `json:"requestID,omitempty"`
+	// Seq numbers the messages the server relays from a participant. Each
+	// recipient gets a sender's messages in increasing Seq order, with gaps
+	// where messages were dropped. Messages from the server itself have
+	// none.
+	Seq uint64 `json:"seq,omitempty"`
+	// TS is the server's clock, in Unix milliseconds, when it received a
+	// relayed message or sent its own.
+	TS int64 `json:"ts,omitempty"`
 }
\ No newline at end of file
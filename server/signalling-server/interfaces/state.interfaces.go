@@ -0,0 +1,32 @@
+package interfaces
+
+// ConnectionState describes a connection of a room for support.
+type ConnectionState struct {
+	UserID   string `json:"userID"`
+	Protocol string `json:"protocol,omitempty"`
+	Batch    bool   `json:"batch"`
+	SignedIn bool   `json:"signedIn"`
+	Queued   int    `json:"queued"`
+	Dropped  int    `json:"dropped"`
+}
+
+// ConnectionStates describes the room's connections.
+func (r *Room) ConnectionStates() []ConnectionState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	states := make([]ConnectionState, 0, len(r.clients))
+	for userID, connection := range r.clients {
+		connection.qmu.Lock()
+		states = append(states, ConnectionState{
+			UserID:   userID,
+			Protocol: connection.Protocol,
+			Batch:    connection.Batch,
+			SignedIn: connection.Account != "",
+			Queued:   len(connection.queue),
+			Dropped:  connection.Dropped,
+		})
+		connection.qmu.Unlock()
+	}
+	return states
+}
@@ -0,0 +1,119 @@
+package interfaces
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// SessionSettings control how a session's room admits people and what
+// they may publish.
+type SessionSettings struct {
+	// WaitingRoom holds joiners in the lobby until a host admits them.
+	WaitingRoom bool `bson:"waitingRoom" json:"waitingRoom"`
+	// Webinar makes everyone but the first host an attendee, who watches
+	// without publishing and asks a host for the floor to speak.
+	Webinar bool `bson:"webinar" json:"webinar"`
+	// AutoRecord starts a recording when the first participant joins.
+	AutoRecord bool `bson:"autoRecord" json:"autoRecord"`
+	// MaxParticipants caps the room, on top of any org quota. Zero is no cap.
+	MaxParticipants int `bson:"maxParticipants" json:"maxParticipants"`
+	// AllowedRoles lists the roles participants may be given. Empty allows
+	// all of them.
+	AllowedRoles []string `bson:"allowedRoles,omitempty" json:"allowedRoles,omitempty"`
+	// Hosts lists the users who join as hosts, such as a course's
+	// instructors. When set, the first to join is no longer made host.
+	Hosts []string `bson:"hosts,omitempty" json:"hosts,omitempty"`
+	// Media limits what participants publish.
+	Media MediaPolicy `bson:"media" json:"media"`
+	// Audio configures Opus on lossy links.
+	Audio AudioPolicy `bson:"audio" json:"audio"`
+	// Codecs narrows the deployment's codec policy for the room.
+	Codecs CodecPolicy `bson:"codecs" json:"codecs"`
+	// Devices is what happens when a user already in the room connects
+	// again, e.g. from a second tab or device: one of the Devices
+	// constants. Empty is DevicesReplace.
+	Devices string `bson:"devices,omitempty" json:"devices,omitempty"`
+	// RelayOnly routes all media through TURN, so participants never learn
+	// each other's IP addresses. Clients are told to gather relay
+	// candidates only, and any other candidate is dropped by the server.
+	RelayOnly bool `bson:"relayOnly,omitempty" json:"relayOnly,omitempty"`
+	// Capabilities lists what the room's media nodes must be able to do,
+	// e.g. "transcription", or "recording" for sessions that may be
+	// recorded without AutoRecord. AutoRecord implies "recording".
+	Capabilities []string `bson:"capabilities,omitempty" json:"capabilities,omitempty"`
+	// Files limits the files participants may send each other.
+	Files FilePolicy `bson:"files" json:"files"`
+	// Inactivity warns, and may remove, participants who walked away.
+	Inactivity InactivityPolicy `bson:"inactivity" json:"inactivity"`
+}
+
+const (
+	// DevicesReplace moves the participant to the new connection and
+	// closes the old one.
+	DevicesReplace = "replace"
+	// DevicesReject refuses the new connection.
+	DevicesReject = "reject"
+	// DevicesAllow lets the new connection join as another participant,
+	// under a user ID the server assigns in session_joined.
+	DevicesAllow = "allow"
+)
+
+func (s SessionSettings) Validate() error {
+	if s.MaxParticipants < 0 {
+		return errors.New("maxParticipants cannot be negative.")
+	}
+	for _, role := range s.AllowedRoles {
+		if role != RoleHost && role != RoleParticipant && role != RoleAttendee {
+			return errors.New("Unknown role " + role + ".")
+		}
+	}
+	switch s.Devices {
+	case "", DevicesReplace, DevicesReject, DevicesAllow:
+	default:
+		return errors.New("devices must be replace, reject or allow.")
+	}
+	if err := s.Files.Validate(); err != nil {
+		return err
+	}
+	if err := s.Inactivity.Validate(); err != nil {
+		return err
+	}
+	return s.Media.Validate()
+}
+
+// Allows reports whether participants may be given role.
+func (s SessionSettings) Allows(role string) bool {
+	if len(s.AllowedRoles) == 0 {
+		return true
+	}
+	for _, allowed := range s.AllowedRoles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Template is a reusable session configuration owned by a user, or by an
+// organization when OrgID is set.
+type Template struct {
+	ID           string          `bson:"_id" json:"id"`
+	OwnerID      string          `bson:"ownerID,omitempty" json:"-"`
+	OrgID        string          `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	Name         string          `bson:"name" json:"name"`
+	TitlePattern string          `bson:"titlePattern" json:"titlePattern"`
+	Settings     SessionSettings `bson:"settings" json:"settings"`
+	CreatedAt    time.Time       `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time       `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Title fills in the {host}, {date} and {time} placeholders of the
+// template's title pattern.
+func (t Template) Title(host string, now time.Time) string {
+	return strings.NewReplacer(
+		"{host}", host,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04"),
+	).Replace(t.TitlePattern)
+}
@@ -0,0 +1,47 @@
+package interfaces
+
+import (
+	"net"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/gorilla/websocket"
+)
+
+// Transport is the write side of a client's WebSocket. Connections accepted
+// by the gorilla handler and by the epoll listener implement it differently.
+type Transport interface {
+	WriteText(frame []byte) error
+	WriteClose(code int, reason string) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// WebsocketTransport wraps a gorilla connection.
+type WebsocketTransport struct {
+	*websocket.Conn
+}
+
+func (t WebsocketTransport) WriteText(frame []byte) error {
+	return t.WriteMessage(websocket.TextMessage, frame)
+}
+
+func (t WebsocketTransport) WriteClose(code int, reason string) error {
+	return t.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// NetTransport wraps a raw connection upgraded with gobwas/ws, framing
+// writes itself.
+type NetTransport struct {
+	net.Conn
+}
+
+func (t NetTransport) WriteText(frame []byte) error {
+	return wsutil.WriteServerText(t.Conn, frame)
+}
+
+func (t NetTransport) WriteClose(code int, reason string) error {
+	t.SetWriteDeadline(time.Now().Add(time.Second))
+	return ws.WriteFrame(t.Conn, ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusCode(code), reason)))
+}
@@ -0,0 +1,37 @@
+package interfaces
+
+import "time"
+
+// Watchlist is a list of keywords and regular expressions an org's
+// compliance team watches its meetings for. Keywords match whole words,
+// ignoring case; Patterns are RE2 expressions. Matches raise a KeywordAlert
+// and notify the users in Notify.
+type Watchlist struct {
+	ID        string    `bson:"_id" json:"id"`
+	OrgID     string    `bson:"orgID" json:"orgID"`
+	Name      string    `bson:"name" json:"name"`
+	Keywords  []string  `bson:"keywords,omitempty" json:"keywords"`
+	Patterns  []string  `bson:"patterns,omitempty" json:"patterns"`
+	Notify    []string  `bson:"notify,omitempty" json:"notify"`
+	Disabled  bool      `bson:"disabled,omitempty" json:"disabled"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// KeywordAlert is something said in a meeting that matched a watchlist,
+// kept for the compliance team to review. Source is where it was said, e.g.
+// "chat".
+type KeywordAlert struct {
+	ID          string     `bson:"_id" json:"id"`
+	OrgID       string     `bson:"orgID" json:"orgID"`
+	WatchlistID string     `bson:"watchlistID" json:"watchlistID"`
+	Watchlist   string     `bson:"watchlist" json:"watchlist"`
+	SessionID   string     `bson:"sessionID" json:"sessionID"`
+	Source      string     `bson:"source" json:"source"`
+	UserID      string     `bson:"userID" json:"userID"`
+	Text        string     `bson:"text" json:"text"`
+	Matches     []string   `bson:"matches" json:"matches"`
+	At          time.Time  `bson:"at" json:"at"`
+	ReviewedAt  *time.Time `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	ReviewedBy  string     `bson:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// compositor is the media backend when recordings can follow the room's
+// layout.
+var compositor media.Compositor
+
+// setLayout lets a host recommend a layout to the room. Everyone is sent
+// it, as are participants joining later in their room snapshot, and running
+// recordings switch to it.
+func setLayout(socket string, clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if !hostOn(clients, connection, envelope.UserID) {
+		return
+	}
+	var request struct {
+		Data interfaces.Layout `json:"data"`
+	}
+	if json.Unmarshal(frame, &request) != nil {
+		return
+	}
+	layout := request.Data
+	host, _ := clients.Participant(envelope.UserID)
+	layout.SetBy, layout.UpdatedAt = host.ID, time.Now()
+
+	if err := clients.SetLayout(layout); err != nil {
+		if client := clients.Get(envelope.UserID); client != nil {
+			client.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "invalid_layout", Data: gin.H{"reason": err.Error()}})
+		}
+		return
+	}
+
+	message, err := json.Marshal(interfaces.Message{Type: "layout", UserID: envelope.UserID, Data: layout})
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+	for _, failed := range broadcaster.Broadcast(clients.Clients(), message, "layout") {
+		suspend(clients, failed)
+	}
+	snapshot := clients.Snapshot(socket)
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+	go composite(clients.Session, snapshot)
+}
+
+// compositeLayout translates the room's layout for the media backend, nil
+// when no host set one.
+func compositeLayout(snapshot interfaces.RoomSnapshot) *media.Layout {
+	if snapshot.Layout == nil {
+		return nil
+	}
+	return &media.Layout{
+		Mode:   snapshot.Layout.Mode,
+		Pinned: snapshot.Identities(snapshot.Layout.Pinned),
+		Order:  snapshot.Identities(snapshot.Layout.Order),
+	}
+}
+
+// composite applies the room's layout to its running recordings.
+func composite(session string, snapshot interfaces.RoomSnapshot) {
+	layout := compositeLayout(snapshot)
+	if compositor == nil || database == nil || layout == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var running []string
+	cursor, err := database.Database("vidchat").Collection("recordings").Find(ctx, bson.M{"sessionID": session, "status": interfaces.RecordingActive})
+	if err == nil {
+		var recordings []interfaces.Recording
+		err = cursor.All(ctx, &recordings)
+		for _, recording := range recordings {
+			running = append(running, recording.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("Error loading recordings of %s: %s", session, err)
+	}
+	if err := compositor.SetLayout(ctx, session, running, *layout); err != nil {
+		log.Printf("Error applying layout to %s: %s", session, err)
+	}
+}
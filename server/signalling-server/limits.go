@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// messageLimits bounds what clients may send, so malformed or malicious
+// clients cannot make the relay buffer, forward or store huge payloads.
+// Frames over MaxFrame close the connection with 1009 Message Too Big;
+// fields over their limit drop the frame with a message_too_large error.
+type messageLimits struct {
+	MaxFrame     int64 // bytes of a WebSocket message
+	MaxSDP       int   // bytes of a session description
+	MaxCandidate int   // bytes of an ICE candidate
+	MaxChat      int   // characters of a chat message
+}
+
+var limits messageLimits
+
+// parseLimits reads the limits from the environment.
+func parseLimits() (messageLimits, error) {
+	var parsed messageLimits
+	for _, setting := range []struct {
+		key      string
+		fallback string
+		value    *int
+	}{
+		{"MAX_SDP_BYTES", "32768", &parsed.MaxSDP},
+		{"MAX_CANDIDATE_BYTES", "1024", &parsed.MaxCandidate},
+		{"MAX_CHAT_LENGTH", "4000", &parsed.MaxChat},
+	} {
+		value, err := strconv.Atoi(getenv(setting.key, setting.fallback))
+		if err != nil || value <= 0 {
+			return parsed, errors.New("invalid " + setting.key)
+		}
+		*setting.value = value
+	}
+	frame, err := strconv.ParseInt(getenv("WS_MAX_MESSAGE_BYTES", "65536"), 10, 64)
+	if err != nil || frame <= 0 {
+		return parsed, errors.New("invalid WS_MAX_MESSAGE_BYTES")
+	}
+	parsed.MaxFrame = frame
+	return parsed, nil
+}
+
+// oversized returns the field of the frame over its limit, with the limit,
+// or "" when the frame is within them. A frame no longer than the smallest
+// field limit cannot hold an oversized field and is not decoded.
+func (l messageLimits) oversized(envelope interfaces.Envelope, frame json.RawMessage) (string, int) {
+	if len(frame) <= min(l.MaxSDP, l.MaxCandidate, l.MaxChat) {
+		return "", 0
+	}
+	var message struct {
+		Description string `json:"description"`
+		Candidate   string `json:"candidate"`
+		Text        string `json:"text"`
+	}
+	if json.Unmarshal(frame, &message) != nil {
+		return "", 0
+	}
+	switch {
+	case len(message.Description) > l.MaxSDP:
+		return "description", l.MaxSDP
+	case len(message.Candidate) > l.MaxCandidate:
+		return "candidate", l.MaxCandidate
+	case envelope.Type == "chat" && utf8.RuneCountInString(message.Text) > l.MaxChat:
+		return "text", l.MaxChat
+	}
+	return "", 0
+}
+
+// refuseOversized tells the sender which field of their message was too
+// long.
+func refuseOversized(connection *interfaces.Connection, envelope interfaces.Envelope, field string, limit int) {
+	connection.Send(interfaces.Message{
+		Type:   "error",
+		UserID: envelope.UserID,
+		Text:   "message_too_large",
+		Data:   gin.H{"type": envelope.Type, "field": field, "limit": limit},
+	})
+}
+
+// readClientFrame reads the next data message of a client like
+// wsutil.ReadClientData, but refuses messages over limit bytes with
+// wsutil.ErrFrameTooLarge instead of buffering them. Replies to control
+// frames are written under the connection's write lock.
+func readClientFrame(conn io.ReadWriter, connection *interfaces.Connection, limit int64) ([]byte, ws.OpCode, error) {
+	var replies bytes.Buffer
+	handle := wsutil.ControlFrameHandler(&replies, ws.StateServerSide)
+	control := func(header ws.Header, r io.Reader) error {
+		replies.Reset()
+		err := handle(header, r)
+		if replies.Len() > 0 {
+			if werr := connection.Locked(func() error {
+				_, err := conn.Write(replies.Bytes())
+				return err
+			}); err == nil {
+				err = werr
+			}
+		}
+		return err
+	}
+	reader := wsutil.Reader{
+		Source:         conn,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		MaxFrameSize:   limit,
+		OnIntermediate: control,
+	}
+	for {
+		header, err := reader.NextFrame()
+		if err != nil {
+			return nil, 0, err
+		}
+		if header.OpCode.IsControl() {
+			if err := control(header, &reader); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		// Fragmented messages are bounded as a whole.
+		data, err := io.ReadAll(io.LimitReader(&reader, limit+1))
+		if err == nil && int64(len(data)) > limit {
+			err = wsutil.ErrFrameTooLarge
+		}
+		return data, header.OpCode, err
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/admission"
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/rules"
+)
+
+// screen applies the session's settings to a user who is not connected to
+// the room yet. It reports whether the frame should go on to the room; users
+// held in the waiting room or refused are handled here.
+func screen(connection *interfaces.Connection, clients *interfaces.Room, envelope interfaces.Envelope) (bool, bool) {
+	settings := clients.Settings
+
+	if settings.WaitingRoom && !clients.Known(envelope.UserID) && clients.Started() {
+		if envelope.Type == "disconnect" {
+			if clients.Deny(envelope.UserID) != nil {
+				notifyLobby(clients)
+			}
+			return false, true
+		}
+		if clients.Waiting(envelope.UserID) && envelope.Type != "connect" {
+			return false, true
+		}
+		clients.Wait(envelope.UserID, connection)
+		connection.Send(interfaces.Message{Type: "waiting", UserID: envelope.UserID})
+		notifyLobby(clients)
+		return false, true
+	}
+
+	if settings.MaxParticipants > 0 && clients.Len() >= settings.MaxParticipants {
+		connection.Send(interfaces.Message{Type: "error", Text: "capacity_exceeded", Data: gin.H{"scope": "meeting"}})
+		connection.Disconnect(interfaces.CloseCapacityExceeded, "capacity_exceeded")
+		return false, false
+	}
+
+	if !clients.Admits(envelope.UserID) {
+		connection.Send(interfaces.Message{Type: "error", Text: "role_not_allowed"})
+		connection.Disconnect(interfaces.CloseNotAllowed, "role_not_allowed")
+		return false, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if rule := policies.Check(ctx, clients.Org, rules.Join, ruleVars(clients, envelope.UserID, connection)); rule != nil {
+		connection.Send(interfaces.Message{Type: "error", Text: "rule_denied", Data: gin.H{"rule": rule.Name, "message": rule.Message}})
+		connection.Disconnect(interfaces.CloseNotAllowed, "rule_denied")
+		return false, false
+	}
+	return true, true
+}
+
+// ruleVars describes a user and the room to the org's rules. The user's
+// connection may be nil, e.g. when nobody in particular triggered the
+// action.
+func ruleVars(clients *interfaces.Room, userID string, connection *interfaces.Connection) map[string]interface{} {
+	return map[string]interface{}{
+		"user.id":           userID,
+		"user.role":         clients.RoleFor(userID),
+		"user.guest":        connection == nil || connection.Account == "",
+		"room.participants": clients.Len(),
+		"room.host_present": len(clients.Hosts()) > 0,
+	}
+}
+
+// hostOn reports whether userID is a host of the room joined on
+// connection, for host-only messages: the user ID of a frame is the
+// client's to write, and only the connection shows who sent it.
+func hostOn(clients *interfaces.Room, connection *interfaces.Connection, userID string) bool {
+	return clients.Get(userID) == connection && clients.Role(userID) == interfaces.RoleHost
+}
+
+// lobbyDecision lets a host admit or deny a user waiting in the lobby. An
+// admitted user is told so and joins by sending connect again.
+func lobbyDecision(clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if !hostOn(clients, connection, envelope.UserID) {
+		return
+	}
+	var decision struct {
+		Data struct {
+			UserID string `json:"userID"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &decision) != nil || decision.Data.UserID == "" {
+		return
+	}
+
+	if envelope.Type == "admit" {
+		if waiting := clients.Admit(decision.Data.UserID); waiting != nil {
+			waiting.Send(interfaces.Message{Type: "admitted", UserID: decision.Data.UserID})
+		}
+	} else if waiting := clients.Deny(decision.Data.UserID); waiting != nil {
+		waiting.Send(interfaces.Message{Type: "denied", UserID: decision.Data.UserID})
+		waiting.Disconnect(interfaces.CloseNotAllowed, "denied")
+	}
+	notifyLobby(clients)
+}
+
+// notifyLobby tells the hosts who is waiting.
+func notifyLobby(clients *interfaces.Room) {
+	message := interfaces.Message{Type: "lobby", Data: gin.H{"waiting": clients.Lobby()}}
+	for _, host := range clients.Hosts() {
+		host.Send(message)
+	}
+}
+
+// autoRecord starts recording a session whose settings ask for it, unless a
+// recording is already running, e.g. from before the room moved nodes.
+func autoRecord(socket string, clients *interfaces.Room, userID string) {
+	if recorder == nil || database == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	recordings := database.Database("vidchat").Collection("recordings")
+	running, err := recordings.CountDocuments(ctx, bson.M{"sessionID": clients.Session, "status": interfaces.RecordingActive})
+	if err != nil || running > 0 {
+		return
+	}
+
+	if storageQuota.Admit(ctx, clients.Org) != nil {
+		log.Printf("Auto-recording of %s refused: storage quota exceeded", socket)
+		return
+	}
+
+	vars := ruleVars(clients, userID, clients.Get(userID))
+	vars["recording.auto"] = true
+	if rule := policies.Check(ctx, clients.Org, rules.Record, vars); rule != nil {
+		log.Printf("Auto-recording of %s refused by rule %s", socket, rule.ID)
+		return
+	}
+
+	var record interfaces.Socket
+	database.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"socketUrl": socket}).Decode(&record)
+
+	options := media.RecordingOptions{Layout: compositeLayout(clients.Snapshot(socket))}
+	decision, err := admissions.Check(ctx, admission.Request{
+		Action:  admission.ActionRecord,
+		Session: clients.Session,
+		Room:    record.HashedURL,
+		Org:     clients.Org,
+	})
+	if err != nil || !decision.Allow {
+		log.Printf("Auto-recording of %s refused by admission hook: %v %s", socket, err, decision.Reason)
+		return
+	}
+	if decision.Modify.Watermark != "" {
+		options.Watermark = &media.Overlay{Text: decision.Modify.Watermark, Opacity: 0.5}
+	}
+
+	started, err := recorder.StartRecording(ctx, clients.Session, options)
+	if err != nil {
+		log.Printf("Error auto-recording %s: %s", socket, err)
+		return
+	}
+	_, err = recordings.InsertOne(ctx, interfaces.Recording{
+		ID:        started.ID,
+		SessionID: clients.Session,
+		OrgID:     clients.Org,
+		Socket:    socket,
+		Backend:   started.Backend,
+		Status:    interfaces.RecordingActive,
+		Location:  started.Location,
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error saving auto-recording of %s: %s", socket, err)
+	}
+	for _, sharing := range clients.Sharing() {
+		screens.Start(ctx, clients.Session, sharing)
+	}
+	timeline.Record(clients.Session, analytics.TimelineEvent{Type: analytics.EventRecordingStart, Data: map[string]interface{}{"recordingID": started.ID, "auto": true}})
+}
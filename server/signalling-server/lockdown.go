@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Defaults that are fine on a laptop and unsafe anywhere else.
+const (
+	defaultDBUsername = "root"
+	defaultDBPassword = "rootpassword"
+	// defaultJWTSecret is the users service's fallback signing secret.
+	defaultJWTSecret = "Ankur Debnath"
+)
+
+// lockdown collects the reasons a node must not run in production. With
+// PRODUCTION set, the node refuses to start until every one is fixed;
+// otherwise they are only logged.
+type lockdown struct {
+	production bool
+	violations []string
+}
+
+func (l *lockdown) check(ok bool, violation string) {
+	if !ok {
+		l.violations = append(l.violations, violation)
+	}
+}
+
+// checkConfig records the insecure settings the node was started with.
+func (l *lockdown) checkConfig(corsOrigins, dbUsername, dbPassword, jwtSecret string) {
+	l.check(corsOrigins != "" && corsOrigins != "*",
+		"CORS_ORIGINS is not set, so every origin is allowed (AllowAllOrigins); set it to the origins of your web app.")
+	l.check(dbUsername != defaultDBUsername || dbPassword != defaultDBPassword,
+		"MongoDB is accessed with the default root/rootpassword credentials; set DB_USERNAME and DB_PASSWORD.")
+	l.check(jwtSecret != "",
+		"JWT_SECRET is not set, so sockets are not tied to login sessions.")
+	l.check(jwtSecret != defaultJWTSecret,
+		"JWT_SECRET is the users service's default; set a random secret in both services.")
+}
+
+// checkPasswords records sessions whose password is stored in plain text,
+// which only a plaintext comparison could admit anyone to.
+func (l *lockdown) checkPasswords(db *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	plain, err := db.Database("vidchat").Collection("sessions").CountDocuments(ctx, bson.M{
+		"password": bson.M{"$nin": bson.A{"", nil}, "$not": bson.M{"$regex": `^\$2[aby]\$`}},
+	})
+	if err != nil {
+		l.check(false, fmt.Sprintf("Could not check session passwords: %s.", err))
+		return
+	}
+	l.check(plain == 0,
+		fmt.Sprintf("%d sessions have a plain text password; recreate them or hash their passwords with bcrypt.", plain))
+}
+
+// enforce reports the violations. In production mode it prints the
+// checklist to stderr as well as the log, and exits.
+func (l *lockdown) enforce() {
+	if len(l.violations) == 0 {
+		return
+	}
+	if !l.production {
+		for _, violation := range l.violations {
+			log.Printf("Not fit for production: %s", violation)
+		}
+		return
+	}
+
+	checklist := "Refusing to start in production mode. Fix the following and try again:\n"
+	for _, violation := range l.violations {
+		checklist += "  [ ] " + violation + "\n"
+	}
+	fmt.Fprint(os.Stderr, checklist)
+	log.Fatal(checklist)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// Low data mode is asked for in the connect frame by clients on a
+// constrained network, e.g. {"type": "connect", "data": {"lowData": true}}.
+// They receive everyone's audio but no video until they subscribe to at
+// most interfaces.MaxThumbnails publishers, who send them thumbnails only,
+// and none of the droppable messages such as typing and audio levels.
+// Everyone else sees the mode on their participant.
+
+// joinedLowData reports whether a connect frame asks for low data mode.
+func joinedLowData(frame json.RawMessage) bool {
+	var request struct {
+		Data struct {
+			LowData bool `json:"lowData"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &request)
+	return request.Data.LowData
+}
+
+// setLowData puts the user in or out of low data mode. When that changes,
+// the other publishers start or stop sending them video, through the SFU
+// if there is one.
+func setLowData(socket string, clients *interfaces.Room, userID string, lowData bool) {
+	if !clients.SetLowData(userID, lowData) {
+		return
+	}
+
+	messageType := "video_subscribe"
+	if lowData {
+		messageType = "video_unsubscribe"
+	}
+	var publishers []string
+	for publisher, connection := range clients.Clients() {
+		if publisher == userID {
+			continue
+		}
+		publishers = append(publishers, publisher)
+		connection.Send(interfaces.Message{Type: messageType, UserID: userID, To: publisher})
+	}
+
+	if subscriber == nil || len(publishers) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := subscriber.SetSubscriptions(ctx, clients.Session, userID, publishers, !lowData); err != nil {
+			log.Printf("Error updating subscriptions of %s in %s: %s", userID, socket, err)
+		}
+	}()
+}
+
+// videoSubscribe is the message telling a publisher that the subscriber
+// now receives their video, as a thumbnail if the subscriber is in low
+// data mode.
+func videoSubscribe(clients *interfaces.Room, subscriber, publisher string) interfaces.Message {
+	message := interfaces.Message{Type: "video_subscribe", UserID: subscriber, To: publisher}
+	if participant, _ := clients.Participant(subscriber); participant.LowData {
+		message.Data = gin.H{"thumbnail": true}
+	}
+	return message
+}
+
+// withoutLowData removes the users in low data mode from recipients of a
+// droppable message.
+func withoutLowData(clients *interfaces.Room, recipients map[string]*interfaces.Connection, messageType string) {
+	if !broadcaster.policy.Droppable[messageType] {
+		return
+	}
+	for user := range clients.LowData() {
+		delete(recipients, user)
+	}
+}
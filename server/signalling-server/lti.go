@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ltiIdentity returns the LTI user ID the identity token a WebSocket to the
+// room is opened with binds it to, empty when it has none or the token is
+// invalid or expired. ConnectSession issues the token to launched users.
+func ltiIdentity(r *http.Request, socket string) string {
+	token := r.URL.Query().Get("identity")
+	if token == "" {
+		return ""
+	}
+	userID, ok := signer.VerifyToken(lti.IdentityPath(socket), token)
+	if !ok || !lti.Reserved(userID) {
+		return ""
+	}
+	return userID
+}
+
+// ltiEnrolled makes a launched user joining the room its host if they
+// were enrolled as an instructor after the room loaded its settings.
+// Enrolling adds them to the session's hosts, which the room only reads
+// when it is created.
+func ltiEnrolled(clients *interfaces.Room, userID string) {
+	if database == nil || clients.RoleFor(userID) == interfaces.RoleHost {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(clients.Session)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	count, err := database.Database("vidchat").Collection("sessions").CountDocuments(ctx, bson.M{"_id": id, "settings.hosts": userID})
+	if err == nil && count > 0 {
+		clients.AddHost(userID)
+	}
+}
@@ -0,0 +1,170 @@
+package lti
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scoreScope lets the tool post scores to a line item.
+const scoreScope = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+
+// PostScores posts the attendance of the session's meeting that just ended
+// to its course's gradebook, as a score of minutes attended out of the
+// meeting's length for each learner who launched it and attended.
+// Sessions not created by a launch, or whose platform does not take
+// scores, are skipped.
+func (t *Tool) PostScores(ctx context.Context, sessionID string, meeting analytics.Meeting) {
+	if t == nil {
+		return
+	}
+	var link Link
+	if err := t.db.Collection("lti_links").FindOne(ctx, bson.M{"sessionID": sessionID}).Decode(&link); err != nil || link.LineItem == "" {
+		return
+	}
+	var platform Platform
+	if err := t.db.Collection("lti_platforms").FindOne(ctx, bson.M{"_id": link.PlatformID}).Decode(&platform); err != nil {
+		log.Printf("LTI: loading platform %s to post scores of %s: %s", link.PlatformID, sessionID, err)
+		return
+	}
+
+	cursor, err := t.db.Collection("lti_learners").Find(ctx, bson.M{"sessionID": sessionID, "instructor": false})
+	if err != nil {
+		log.Printf("LTI: loading learners of %s: %s", sessionID, err)
+		return
+	}
+	var learners []learner
+	if err := cursor.All(ctx, &learners); err != nil {
+		log.Printf("LTI: loading learners of %s: %s", sessionID, err)
+		return
+	}
+	subjects := make(map[string]string, len(learners))
+	for _, learner := range learners {
+		subjects[learner.UserID] = learner.Subject
+	}
+
+	token, err := t.token(ctx, platform)
+	if err != nil {
+		log.Printf("LTI: getting a token from %s: %s", platform.Issuer, err)
+		return
+	}
+	now := time.Now()
+	for _, attendee := range meeting.Attendees {
+		subject, ok := subjects[attendee.Record.UserID]
+		if !ok {
+			continue
+		}
+		if err := t.postScore(ctx, token, link.LineItem, automation.Score(subject, attendee, meeting, now)); err != nil {
+			log.Printf("LTI: posting score of %s in %s: %s", attendee.Record.UserID, sessionID, err)
+		}
+	}
+}
+
+func (t *Tool) postScore(ctx context.Context, token, lineItem string, score automation.Item) error {
+	// Scores go to the line item's scores service, before its query.
+	scores, err := url.Parse(lineItem)
+	if err != nil {
+		return err
+	}
+	scores.Path = strings.TrimRight(scores.Path, "/") + "/scores"
+
+	body, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scores.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/vnd.ims.lis.v1.score+json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("platform answered %s", resp.Status)
+	}
+	return nil
+}
+
+// token gets an access token for posting scores from the platform, with a
+// client credentials grant asserted by a JWT signed with the tool's key.
+// Tokens are reused until shortly before they expire.
+func (t *Tool) token(ctx context.Context, platform Platform) (string, error) {
+	t.mu.Lock()
+	cached := t.tokens[platform.ID]
+	t.mu.Unlock()
+	if time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	jti := make([]byte, 16)
+	rand.Read(jti)
+	now := time.Now()
+	assertion := jwt_lib.NewWithClaims(jwt_lib.SigningMethodRS256, jwt_lib.MapClaims{
+		"iss": platform.ClientID,
+		"sub": platform.ClientID,
+		"aud": platform.AuthTokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": hex.EncodeToString(jti),
+	})
+	assertion.Header["kid"] = t.keyID
+	signed, err := assertion.SignedString(t.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {signed},
+		"scope":                 {scoreScope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, platform.AuthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+	var granted struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&granted); err != nil {
+		return "", err
+	}
+	if granted.AccessToken == "" {
+		return "", errors.New("token endpoint gave no access token")
+	}
+
+	t.mu.Lock()
+	t.tokens[platform.ID] = cachedToken{token: granted.AccessToken, expires: now.Add(time.Duration(granted.ExpiresIn)*time.Second - time.Minute)}
+	t.mu.Unlock()
+	return granted.AccessToken, nil
+}
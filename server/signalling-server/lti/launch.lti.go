@@ -0,0 +1,389 @@
+package lti
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	claims = "https://purl.imsglobal.org/spec/lti/claim/"
+	// agsEndpoint is the claim naming where a launch's scores go.
+	agsEndpoint = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+
+	// statePath is what login states are signed over.
+	statePath = "/lti/launch"
+	// stateTTL is how long a user has to come back from the platform's
+	// login with an id token.
+	stateTTL = 10 * time.Minute
+
+	// keySetTTL is how long a platform's keys are cached. A key that is
+	// not cached is fetched again, at most every keySetRefresh.
+	keySetTTL     = time.Hour
+	keySetRefresh = time.Minute
+)
+
+// Roles that make a launching user an instructor of the course.
+var instructorRoles = []string{
+	"http://purl.imsglobal.org/vocab/lis/v2/membership#Instructor",
+	"http://purl.imsglobal.org/vocab/lis/v2/membership#Administrator",
+	"http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#TeachingAssistant",
+}
+
+// Launch is a verified resource link launch: who launched from which
+// course link.
+type Launch struct {
+	Platform          Platform
+	DeploymentID      string
+	Subject           string
+	Name              string
+	Email             string
+	Roles             []string
+	ContextID         string
+	ContextTitle      string
+	ResourceLinkID    string
+	ResourceLinkTitle string
+	// LineItem is the gradebook column scores go to, when the platform
+	// lets the tool post them.
+	LineItem string
+}
+
+// Instructor reports whether the user teaches the course.
+func (l Launch) Instructor() bool {
+	for _, role := range l.Roles {
+		for _, instructor := range instructorRoles {
+			if role == instructor {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userPrefix starts the participant IDs of launched users.
+const userPrefix = "lti-"
+
+// UserID is the participant ID the user joins meetings as, the same on
+// every launch from the platform.
+func (l Launch) UserID() string {
+	sum := sha256.Sum256([]byte(l.Platform.Issuer + "\n" + l.Subject))
+	return userPrefix + hex.EncodeToString(sum[:8])
+}
+
+// Reserved reports whether userID is a launched user's. Only a connection
+// carrying their identity token may join as one.
+func Reserved(userID string) bool {
+	return strings.HasPrefix(userID, userPrefix)
+}
+
+// IdentityPath is what the identity tokens binding a connection to the
+// room at socket to a launched user's ID are signed over.
+func IdentityPath(socket string) string {
+	return "/lti/identity/" + socket
+}
+
+// audience is the aud claim, a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+type idToken struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Nonce           string   `json:"nonce"`
+	Name            string   `json:"name"`
+	Email           string   `json:"email"`
+	MessageType     string   `json:"https://purl.imsglobal.org/spec/lti/claim/message_type"`
+	Version         string   `json:"https://purl.imsglobal.org/spec/lti/claim/version"`
+	DeploymentID    string   `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+	Roles           []string `json:"https://purl.imsglobal.org/spec/lti/claim/roles"`
+	Context         struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+		Title string `json:"title"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/context"`
+	ResourceLink struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/resource_link"`
+	Endpoint *struct {
+		Scope    []string `json:"scope"`
+		LineItem string   `json:"lineitem"`
+	} `json:"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"`
+}
+
+type cachedKeys struct {
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// Tool verifies launches from registered platforms and posts scores back
+// to them. It signs its own requests with key, published at its JWKS.
+type Tool struct {
+	db        *mongo.Database
+	client    *http.Client
+	signer    *utils.URLSigner
+	key       *rsa.PrivateKey
+	keyID     string
+	launchURL string
+
+	mu     sync.Mutex
+	keys   map[string]cachedKeys
+	tokens map[string]cachedToken
+}
+
+// NewTool returns the tool, signing with the RSA private key in keyPEM.
+// Platforms send users back to launchURL.
+func NewTool(db *mongo.Client, signer *utils.URLSigner, keyPEM, launchURL string) (*Tool, error) {
+	key, err := jwt_lib.ParseRSAPrivateKeyFromPEM([]byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+	return &Tool{
+		db:        db.Database("vidchat"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		signer:    signer,
+		key:       key,
+		keyID:     hex.EncodeToString(sum[:8]),
+		launchURL: launchURL,
+		keys:      make(map[string]cachedKeys),
+		tokens:    make(map[string]cachedToken),
+	}, nil
+}
+
+// KeySet is the tool's public key as a JWKS, for platforms to verify its
+// requests.
+func (t *Tool) KeySet() map[string]interface{} {
+	return map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"kid": t.keyID,
+		"n":   base64.RawURLEncoding.EncodeToString(t.key.PublicKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(t.key.PublicKey.E)).Bytes()),
+	}}}
+}
+
+// Login answers a platform's third party login initiation with where to
+// send the user: the platform's authorization endpoint, asking for an id
+// token to be posted to the launch URL. The state carries the platform and
+// the nonce, signed, so nothing is stored until the launch.
+func (t *Tool) Login(ctx context.Context, params url.Values) (string, error) {
+	platform, err := t.platform(ctx, params.Get("iss"), params.Get("client_id"))
+	if err != nil {
+		return "", errors.New("unknown platform")
+	}
+	if params.Get("login_hint") == "" {
+		return "", errors.New("login_hint is required")
+	}
+
+	random := make([]byte, 16)
+	rand.Read(random)
+	nonce := hex.EncodeToString(random)
+	state := t.signer.Token(statePath, platform.ID+" "+nonce, stateTTL)
+
+	query := url.Values{
+		"scope":         {"openid"},
+		"response_type": {"id_token"},
+		"response_mode": {"form_post"},
+		"prompt":        {"none"},
+		"client_id":     {platform.ClientID},
+		"redirect_uri":  {t.launchURL},
+		"login_hint":    {params.Get("login_hint")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	if hint := params.Get("lti_message_hint"); hint != "" {
+		query.Set("lti_message_hint", hint)
+	}
+	separator := "?"
+	if strings.Contains(platform.AuthLoginURL, "?") {
+		separator = "&"
+	}
+	return platform.AuthLoginURL + separator + query.Encode(), nil
+}
+
+// Launch verifies the id token a platform posted with the state from Login
+// and returns the launch it describes. Each token is accepted once.
+func (t *Tool) Launch(ctx context.Context, token, encodedState string) (Launch, error) {
+	viewer, ok := t.signer.VerifyToken(statePath, encodedState)
+	if !ok {
+		return Launch{}, errors.New("invalid or expired state")
+	}
+	platformID, nonce, _ := strings.Cut(viewer, " ")
+
+	var platform Platform
+	if err := t.db.Collection("lti_platforms").FindOne(ctx, bson.M{"_id": platformID}).Decode(&platform); err != nil {
+		return Launch{}, errors.New("unknown platform")
+	}
+
+	parsed, err := jwt_lib.Parse(token, func(token *jwt_lib.Token) (interface{}, error) {
+		if token.Method != jwt_lib.SigningMethodRS256 {
+			return nil, errors.New("id token must be signed with RS256")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return t.platformKey(ctx, platform.KeySetURL, kid)
+	})
+	if err != nil || !parsed.Valid {
+		return Launch{}, fmt.Errorf("invalid id token: %v", err)
+	}
+	var claimed idToken
+	encoded, _ := json.Marshal(parsed.Claims)
+	if err := json.Unmarshal(encoded, &claimed); err != nil {
+		return Launch{}, fmt.Errorf("invalid id token: %v", err)
+	}
+
+	switch {
+	case claimed.Issuer != platform.Issuer:
+		return Launch{}, errors.New("id token is from another issuer")
+	case !claimed.Audience.has(platform.ClientID):
+		return Launch{}, errors.New("id token is for another client")
+	case len(claimed.Audience) > 1 && claimed.AuthorizedParty != platform.ClientID:
+		return Launch{}, errors.New("id token is authorized for another client")
+	case claimed.Nonce != nonce:
+		return Launch{}, errors.New("id token nonce does not match")
+	case !platform.deployed(claimed.DeploymentID):
+		return Launch{}, errors.New("unknown deployment")
+	case claimed.MessageType != "LtiResourceLinkRequest" || claimed.Version != "1.3.0":
+		return Launch{}, errors.New("only LTI 1.3 resource link launches are supported")
+	case claimed.Subject == "" || claimed.ResourceLink.ID == "":
+		return Launch{}, errors.New("launch needs a user and a resource link")
+	}
+
+	if _, err := t.db.Collection("lti_nonces").InsertOne(ctx, bson.M{"_id": nonce, "createdAt": time.Now()}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return Launch{}, errors.New("id token was already used")
+		}
+		return Launch{}, err
+	}
+
+	launch := Launch{
+		Platform:          platform,
+		DeploymentID:      claimed.DeploymentID,
+		Subject:           claimed.Subject,
+		Name:              claimed.Name,
+		Email:             claimed.Email,
+		Roles:             claimed.Roles,
+		ContextID:         claimed.Context.ID,
+		ContextTitle:      claimed.Context.Title,
+		ResourceLinkID:    claimed.ResourceLink.ID,
+		ResourceLinkTitle: claimed.ResourceLink.Title,
+	}
+	if claimed.Endpoint != nil {
+		for _, scope := range claimed.Endpoint.Scope {
+			if scope == scoreScope {
+				launch.LineItem = claimed.Endpoint.LineItem
+			}
+		}
+	}
+	return launch, nil
+}
+
+func (a audience) has(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// platformKey returns the platform's public key kid from its key set,
+// fetching the set again when the key is not cached.
+func (t *Tool) platformKey(ctx context.Context, keySetURL, kid string) (*rsa.PublicKey, error) {
+	t.mu.Lock()
+	cached, ok := t.keys[keySetURL]
+	t.mu.Unlock()
+	if key := cached.keys[kid]; ok && key != nil && time.Since(cached.fetched) < keySetTTL {
+		return key, nil
+	}
+	if ok && time.Since(cached.fetched) < keySetRefresh {
+		return nil, errors.New("unknown key " + kid)
+	}
+
+	keys, err := t.fetchKeys(ctx, keySetURL)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.keys[keySetURL] = cachedKeys{keys: keys, fetched: time.Now()}
+	t.mu.Unlock()
+	if keys[kid] == nil {
+		return nil, errors.New("unknown key " + kid)
+	}
+	return keys[kid], nil
+}
+
+func (t *Tool) fetchKeys(ctx context.Context, keySetURL string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keySetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key set answered %s", resp.Status)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
@@ -0,0 +1,113 @@
+package lti
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Link is the meeting of a resource link in a course, created on its first
+// launch.
+type Link struct {
+	// ID is the platform, deployment, course and resource link IDs.
+	ID             string    `bson:"_id" json:"id"`
+	PlatformID     string    `bson:"platformID" json:"platformID"`
+	ContextID      string    `bson:"contextID" json:"contextID"`
+	ContextTitle   string    `bson:"contextTitle,omitempty" json:"contextTitle,omitempty"`
+	ResourceLinkID string    `bson:"resourceLinkID" json:"resourceLinkID"`
+	SessionID      string    `bson:"sessionID" json:"sessionID"`
+	HashedURL      string    `bson:"hashedUrl" json:"url"`
+	LineItem       string    `bson:"lineItem,omitempty" json:"lineItem,omitempty"`
+	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// learner is a user who launched a course meeting, for posting their
+// score back under the platform's ID for them.
+type learner struct {
+	ID         string    `bson:"_id"`
+	SessionID  string    `bson:"sessionID"`
+	UserID     string    `bson:"userID"`
+	Subject    string    `bson:"subject"`
+	Instructor bool      `bson:"instructor"`
+	LaunchedAt time.Time `bson:"launchedAt"`
+}
+
+// LinkID identifies the launch's resource link across platforms.
+func LinkID(launch Launch) string {
+	return launch.Platform.ID + "|" + launch.DeploymentID + "|" + launch.ContextID + "|" + launch.ResourceLinkID
+}
+
+// Link returns the meeting of the launch's resource link, nil when it has
+// none yet.
+func (t *Tool) Link(ctx context.Context, launch Launch) (*Link, error) {
+	var link Link
+	err := t.db.Collection("lti_links").FindOne(ctx, bson.M{"_id": LinkID(launch)}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return &link, err
+}
+
+// SaveLink records the session created for the launch's resource link. When
+// a concurrent launch got there first, the link it saved is returned
+// instead, and the caller's session is left unused.
+func (t *Tool) SaveLink(ctx context.Context, launch Launch, sessionID, hashedURL string) (Link, error) {
+	link := Link{
+		ID:             LinkID(launch),
+		PlatformID:     launch.Platform.ID,
+		ContextID:      launch.ContextID,
+		ContextTitle:   launch.ContextTitle,
+		ResourceLinkID: launch.ResourceLinkID,
+		SessionID:      sessionID,
+		HashedURL:      hashedURL,
+		LineItem:       launch.LineItem,
+		CreatedAt:      time.Now(),
+	}
+	_, err := t.db.Collection("lti_links").InsertOne(ctx, link)
+	if mongo.IsDuplicateKeyError(err) {
+		existing, err := t.Link(ctx, launch)
+		if err != nil || existing == nil {
+			return link, err
+		}
+		return *existing, nil
+	}
+	return link, err
+}
+
+// Enroll records the launching user as a learner of the link's meeting,
+// or, for instructors, adds them to the session's hosts. The link keeps
+// the latest line item the platform gave.
+func (t *Tool) Enroll(ctx context.Context, launch Launch, link Link) error {
+	userID := launch.UserID()
+	_, err := t.db.Collection("lti_learners").UpdateOne(ctx,
+		bson.M{"_id": link.SessionID + "|" + userID},
+		bson.M{"$set": bson.M{
+			"sessionID":  link.SessionID,
+			"userID":     userID,
+			"subject":    launch.Subject,
+			"instructor": launch.Instructor(),
+			"launchedAt": time.Now(),
+		}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	if launch.Instructor() {
+		id, err := primitive.ObjectIDFromHex(link.SessionID)
+		if err != nil {
+			return err
+		}
+		if _, err := t.db.Collection("sessions").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$addToSet": bson.M{"settings.hosts": userID}}); err != nil {
+			return err
+		}
+	}
+	if launch.LineItem != "" && launch.LineItem != link.LineItem {
+		_, err = t.db.Collection("lti_links").UpdateOne(ctx, bson.M{"_id": link.ID}, bson.M{"$set": bson.M{"lineItem": launch.LineItem}})
+	}
+	return err
+}
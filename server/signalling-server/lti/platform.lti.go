@@ -0,0 +1,104 @@
+// Package lti makes the platform an LTI 1.3 tool, so learning platforms
+// such as Moodle and Canvas can embed course meetings. A launch from a
+// course opens the meeting of its link, creating it on first launch, and
+// meeting attendance goes back to the course gradebook.
+package lti
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Platform is a learning platform registered to launch the tool. Meetings
+// its courses create belong to OwnerID and OrgID.
+type Platform struct {
+	ID            string    `bson:"_id" json:"id"`
+	Name          string    `bson:"name" json:"name"`
+	Issuer        string    `bson:"issuer" json:"issuer"`
+	ClientID      string    `bson:"clientID" json:"clientID"`
+	DeploymentIDs []string  `bson:"deploymentIDs" json:"deploymentIDs"`
+	AuthLoginURL  string    `bson:"authLoginURL" json:"authLoginURL"`
+	AuthTokenURL  string    `bson:"authTokenURL" json:"authTokenURL"`
+	KeySetURL     string    `bson:"keySetURL" json:"keySetURL"`
+	OwnerID       string    `bson:"ownerID" json:"ownerID"`
+	OrgID         string    `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	CreatedAt     time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+func (p Platform) Validate() error {
+	if p.Issuer == "" || p.ClientID == "" {
+		return errors.New("issuer and clientID are required")
+	}
+	if len(p.DeploymentIDs) == 0 {
+		return errors.New("at least one deployment ID is required")
+	}
+	for _, endpoint := range []string{p.AuthLoginURL, p.AuthTokenURL, p.KeySetURL} {
+		parsed, err := url.Parse(endpoint)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return errors.New("authLoginURL, authTokenURL and keySetURL must be https URLs")
+		}
+	}
+	if p.OwnerID == "" {
+		return errors.New("ownerID is required, to own the meetings courses create")
+	}
+	return nil
+}
+
+func (p Platform) deployed(deploymentID string) bool {
+	for _, id := range p.DeploymentIDs {
+		if id == deploymentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Register saves a new platform.
+func (t *Tool) Register(ctx context.Context, platform Platform) (Platform, error) {
+	if err := platform.Validate(); err != nil {
+		return platform, err
+	}
+	platform.ID = primitive.NewObjectID().Hex()
+	platform.CreatedAt = time.Now()
+	_, err := t.db.Collection("lti_platforms").InsertOne(ctx, platform)
+	return platform, err
+}
+
+// Platforms lists the registered platforms.
+func (t *Tool) Platforms(ctx context.Context) ([]Platform, error) {
+	cursor, err := t.db.Collection("lti_platforms").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	platforms := []Platform{}
+	err = cursor.All(ctx, &platforms)
+	return platforms, err
+}
+
+// Unregister deletes a platform. Its courses' meetings are kept, but can no
+// longer be launched.
+func (t *Tool) Unregister(ctx context.Context, id string) error {
+	result, err := t.db.Collection("lti_platforms").DeleteOne(ctx, bson.M{"_id": id})
+	if err == nil && result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+// platform finds the platform with issuer, and clientID when the platform
+// gave one.
+func (t *Tool) platform(ctx context.Context, issuer, clientID string) (Platform, error) {
+	filter := bson.M{"issuer": issuer}
+	if clientID != "" {
+		filter["clientID"] = clientID
+	}
+	var platform Platform
+	err := t.db.Collection("lti_platforms").FindOne(ctx, filter).Decode(&platform)
+	return platform, err
+}
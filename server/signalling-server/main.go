@@ -1,19 +1,66 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/r3tr056/go-videoconf/signalling-server/admission"
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/assets"
+	"github.com/r3tr056/go-videoconf/signalling-server/auth"
+	"github.com/r3tr056/go-videoconf/signalling-server/automation"
+	"github.com/r3tr056/go-videoconf/signalling-server/branding"
+	"github.com/r3tr056/go-videoconf/signalling-server/bridges"
+	"github.com/r3tr056/go-videoconf/signalling-server/calendar"
+	"github.com/r3tr056/go-videoconf/signalling-server/calls"
+	"github.com/r3tr056/go-videoconf/signalling-server/chaos"
+	"github.com/r3tr056/go-videoconf/signalling-server/compliance"
+	"github.com/r3tr056/go-videoconf/signalling-server/contacts"
 	"github.com/r3tr056/go-videoconf/signalling-server/controllers"
+	"github.com/r3tr056/go-videoconf/signalling-server/crm"
+	"github.com/r3tr056/go-videoconf/signalling-server/domains"
+	"github.com/r3tr056/go-videoconf/signalling-server/export"
 	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/lti"
+	"github.com/r3tr056/go-videoconf/signalling-server/maintenance"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+	"github.com/r3tr056/go-videoconf/signalling-server/metering"
+	"github.com/r3tr056/go-videoconf/signalling-server/netpoll"
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
+	"github.com/r3tr056/go-videoconf/signalling-server/presence"
+	"github.com/r3tr056/go-videoconf/signalling-server/probe"
+	"github.com/r3tr056/go-videoconf/signalling-server/quality"
+	"github.com/r3tr056/go-videoconf/signalling-server/quota"
+	"github.com/r3tr056/go-videoconf/signalling-server/recovery"
+	"github.com/r3tr056/go-videoconf/signalling-server/rules"
+	"github.com/r3tr056/go-videoconf/signalling-server/storage"
+	"github.com/r3tr056/go-videoconf/signalling-server/transcode"
+	"github.com/r3tr056/go-videoconf/signalling-server/turn"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -22,11 +69,175 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	WriteBufferPool:   &sync.Pool{},
+	EnableCompression: os.Getenv("WS_COMPRESSION") == "true",
 }
 
-var sockets = make(map[string]map[string]*interfaces.Connection)
+// frames recycles the buffers incoming messages are read into. Relayed frames
+// are queued for writing asynchronously, so relay copies a frame out of its
+// buffer before broadcasting it.
+var frames = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+var (
+	socketsMu sync.Mutex
+	sockets   = make(map[string]*interfaces.Room)
+)
+
+var matrixBridge *bridges.MatrixBridge
+
+var broadcaster *fanout
+
+var ring *placement.Ring
+
+// discovery is the Consul client the node registers and finds its peers
+// with.
+var discovery *api.Client
+
+var topology *media.Topology
+
+var snapshots *recovery.Store
+
+var quotas *quota.Tracker
+
+var database *mongo.Client
+
+var speakers *analytics.Speakers
+
+// attendance records who attended each session.
+var attendance *analytics.Attendance
+
+// timeline records what happens in each room.
+var timeline *analytics.Timeline
+
+var logins *auth.Sessions
+
+// signer signs and verifies playback links, invites and identity tokens.
+var signer *utils.URLSigner
+
+var presences *presence.Tracker
+
+var directory *contacts.Directory
+
+var ringer *calls.Ringer
+
+// recorder is the media backend when it can record, for sessions that start
+// recording automatically.
+var recorder media.Recorder
+
+// screens records shared screens as assets of the session's recordings when
+// the media backend can.
+var screens *assets.Screens
+
+// markers adds chapter markers to the recordings running in a session.
+var markers *assets.Markers
+
+// storageQuota keeps orgs' recordings within their storage quota.
+var storageQuota *quota.Storage
+
+// admissions asks customers' admission hooks before joins and recordings.
+var admissions *admission.Hooks
+
+// prober runs synthetic meetings against this node when PROBE_INTERVAL is
+// set.
+var prober *probe.Prober
+
+// policies holds the rules org admins set for their sessions.
+var policies *rules.Engine
+
+// turnMonitor polls the coturn servers' allocations when TURN_ADMIN_ADDRS
+// is set.
+var turnMonitor *turn.Monitor
+
+// room returns the room for a socket URL, creating it on first use. A new
+// room is restored from its last snapshot, if any, so clients reconnecting
+// after a restart or handoff find the state they left.
+func room(socket string) *interfaces.Room {
+	socketsMu.Lock()
+	clients := sockets[socket]
+	socketsMu.Unlock()
+	if clients != nil {
+		return clients
+	}
+
+	restored := interfaces.NewRoom()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var record interfaces.Socket
+	if database != nil {
+		database.Database("vidchat").Collection("sockets").FindOne(ctx, bson.M{"socketUrl": socket}).Decode(&record)
+	}
+	restored.Session = record.SessionID
+	restored.Org = record.OrgID
+	if sessionID, err := primitive.ObjectIDFromHex(record.SessionID); err == nil {
+		var session interfaces.Session
+		if database.Database("vidchat").Collection("sessions").FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session) == nil {
+			restored.Settings = session.Settings
+			restored.SetAgenda(session.Agenda)
+		}
+	}
+	if record.OrgID != "" && !restored.Settings.RelayOnly {
+		var org interfaces.Organization
+		if database.Database("vidchat").Collection("orgs").FindOne(ctx, bson.M{"_id": record.OrgID}).Decode(&org) == nil {
+			restored.Settings.RelayOnly = org.RelayOnly
+		}
+	}
+	restored.OnLeave = func(userID string, empty bool) {
+		quotas.Release(restored.Org, empty)
+		speakers.Leave(socket, userID)
+		audience.Leave(socket, userID)
+		advisor.Forget(socket, userID)
+		if participant, ok := restored.Participant(userID); ok {
+			attendance.Leave(restored.Session, participant.ID)
+			publishFeed(socket, feedParticipant(interfaces.FeedLeave, participant))
+		}
+		recordEvent(restored, analytics.EventLeave, userID, nil)
+		if empty {
+			go speakers.End(socket)
+			go audience.End(socket)
+			go hangupPhones(socket, restored)
+			endAttendance(socket, restored)
+		} else {
+			go enforcePolicy(socket, restored, "")
+		}
+	}
+
+	snapshot, err := snapshots.Load(ctx, socket)
+	if err != nil {
+		log.Printf("Error loading snapshot for %s: %s", socket, err)
+	} else if snapshot != nil {
+		restored.Restore(*snapshot)
+		log.Printf("Restored room %s with %d participants", socket, len(snapshot.Participants))
+	}
+
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+	if sockets[socket] == nil {
+		sockets[socket] = restored
+	}
+	return sockets[socket]
+}
+
+// socketRequestID returns the correlation ID of a WebSocket upgrade. Browsers
+// cannot set headers on it, so a requestID query parameter is accepted too.
+func socketRequestID(r *http.Request) string {
+	if id := r.URL.Query().Get("requestID"); utils.ValidRequestID(id) {
+		return id
+	}
+	return utils.RequestID(r.Context())
+}
+
+func wshandler(w http.ResponseWriter, r *http.Request, socket string, embed *interfaces.EmbedSocket) {
+	claims, err := logins.Authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-func wshandler(w http.ResponseWriter, r *http.Request, socket string) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Fatal("Error handling websocket connection.")
@@ -34,16 +245,24 @@ func wshandler(w http.ResponseWriter, r *http.Request, socket string) {
 	}
 
 	defer conn.Close()
+	conn.SetReadLimit(limits.MaxFrame)
 
-	if sockets[socket] == nil {
-		sockets[socket] = make(map[string]*interfaces.Connection)
+	clients := room(socket)
+	connection := interfaces.NewConnection(interfaces.WebsocketTransport{Conn: conn}, r.URL.Query().Get("batch") == "1")
+	connection.Protocol = clientProtocol(r)
+	connection.RequestID = socketRequestID(r)
+	connection.Embed = embed
+	connection.Identity = ltiIdentity(r, socket)
+	defer suspend(clients, connection)
+	defer logins.Track(claims, connection)()
+	if claims != nil {
+		connection.Account = claims.Subject
+		presences.JoinMeeting(claims.Subject)
+		defer presences.LeaveMeeting(claims.Subject)
 	}
 
-	clients := sockets[socket]
-
-	var message interfaces.Message
 	for {
-		err = conn.ReadJSON(&message)
+		_, reader, err := conn.NextReader()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
@@ -51,38 +270,296 @@ func wshandler(w http.ResponseWriter, r *http.Request, socket string) {
 			break
 		}
 
-		if clients[message.UserID] == nil {
-			connection := new(interfaces.Connection)
-			connection.Socket = conn
-			clients[message.UserID] = connection
+		buf := frames.Get().(*bytes.Buffer)
+		buf.Reset()
+		if _, err = buf.ReadFrom(reader); err != nil {
+			frames.Put(buf)
+			log.Printf("error: %v", err)
+			break
+		}
+
+		if !relay(socket, connection, clients, buf.Bytes()) {
+			frames.Put(buf)
+			break
 		}
+		frames.Put(buf)
+	}
+}
 
-		switch message.Type {
-		case "connect":
-			message.Type = "session_joined"
-			err := conn.WriteJSON(message)
-			if err != nil {
-				log.Printf("Websocket error: %s", err)
-				delete(clients, message.UserID)
+// relay routes a single frame. Only the envelope is decoded; the frame itself
+// is forwarded untouched. It returns false when the frame is malformed and
+// the connection should be dropped.
+func relay(socket string, connection *interfaces.Connection, clients *interfaces.Room, frame json.RawMessage) bool {
+	received := time.Now()
+	var envelope interfaces.Envelope
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		log.Printf("error: %v", err)
+		return false
+	}
+
+	if injector.Disconnect() {
+		return false
+	}
+
+	if !embedIdentity(connection, envelope) {
+		connection.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "embed_user_mismatch"})
+		return true
+	}
+
+	if field, limit := limits.oversized(envelope, frame); field != "" {
+		refuseOversized(connection, envelope, field, limit)
+		return true
+	}
+
+	if envelope.Type == "clock_sync" {
+		clockSync(connection, frame, received)
+		return true
+	}
+
+	// Only connect names the user a connection joins as; every other frame
+	// must come from a user joined, or waiting, on this connection, so one
+	// participant cannot act as another.
+	if envelope.Type != "connect" && !clients.Holds(envelope.UserID, connection) {
+		connection.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "not_joined"})
+		return true
+	}
+
+	if envelope.Type == "connect" && resume(socket, connection, clients, envelope, frame) {
+		return true
+	}
+
+	// Invalid metadata is refused before the user takes up a place, so the
+	// client can fix it and connect again.
+	var metadata map[string]string
+	if envelope.Type == "connect" {
+		userID, ok := claim(clients, connection, envelope.UserID, resumeToken(frame))
+		if !ok {
+			return false
+		}
+		envelope.UserID = userID
+		if connection.Identity == userID {
+			ltiEnrolled(clients, userID)
+		}
+
+		var err error
+		if metadata, err = joinedMetadata(frame); err != nil {
+			connection.Send(interfaces.Message{Type: "error", UserID: envelope.UserID, Text: "invalid_metadata", Data: gin.H{"reason": err.Error()}})
+			return true
+		}
+	}
+
+	// Suspended participants coming back still hold their place and quota.
+	if clients.Get(envelope.UserID) == nil && !clients.Away(envelope.UserID) {
+		if envelope.Type == "admit" || envelope.Type == "deny" {
+			return true
+		}
+		if maintenances.Closed() {
+			connection.Send(interfaces.Message{Type: "error", Text: "maintenance"})
+			connection.Disconnect(interfaces.CloseMaintenance, "maintenance")
+			return false
+		}
+		if forward, ok := screen(connection, clients, envelope); !forward {
+			return ok
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := quotas.Admit(ctx, clients.Org, clients.Len() == 0)
+		cancel()
+		if capacity, ok := err.(*quota.CapacityError); ok {
+			connection.Send(interfaces.Message{Type: "error", Text: "capacity_exceeded", Data: gin.H{"scope": capacity.Scope}})
+			connection.Disconnect(interfaces.CloseCapacityExceeded, "capacity_exceeded")
+			return false
+		}
+	}
+
+	client := clients.Join(envelope.UserID, connection)
+	touch(clients, client, envelope, frame)
+
+	if clients.Disables(envelope.UserID, envelope.Type) {
+		refuseDisabled(connection, envelope)
+		return true
+	}
+
+	if fileMessages[envelope.Type] && !screenFile(connection, clients, envelope, frame) {
+		return true
+	}
+
+	switch envelope.Type {
+	case "connect":
+		var message interfaces.Message
+		json.Unmarshal(frame, &message)
+		// Under the allow policy a second device joins under another user
+		// ID, which the client uses from then on.
+		message.UserID = envelope.UserID
+		name := joinedName(frame)
+		if connection.Embed != nil {
+			name = connection.Embed.Grant.Name
+			embedJoined(clients, &connection.Embed.Grant, envelope.UserID)
+		}
+		clients.SetName(envelope.UserID, name)
+		if metadata != nil {
+			clients.SetMetadata(envelope.UserID, metadata)
+		}
+		setLowData(socket, clients, envelope.UserID, joinedLowData(frame))
+		participant, _ := clients.Participant(envelope.UserID)
+		message.Type = "session_joined"
+		message.Data = gin.H{
+			"participantID": participant.ID,
+			"name":          participant.Name,
+			"role":          participant.Role,
+			"room":          clients.Snapshot(socket),
+			"resumeToken":   participant.ResumeToken,
+			"policy":        clients.Settings.Media.Limits(clients.Len()),
+			"lowData":       participant.LowData,
+			"feeds":         runningFeeds(socket),
+		}
+		err := client.Send(message)
+		if err != nil {
+			log.Printf("Websocket error: %s", err)
+			clients.Leave(envelope.UserID)
+		} else {
+			announceJoin(clients, participant)
+			deliverPending(clients, envelope.UserID, client)
+			attendance.Join(clients.Session, socket, connection.Account, participant)
+			recordJoin(clients, participant)
+			publishFeed(socket, feedParticipant(interfaces.FeedJoin, participant))
+			viewerJoined(socket, clients, participant)
+			speakers.Join(socket, clients.Session, envelope.UserID)
+			go enforcePolicy(socket, clients, envelope.UserID)
+			if participant.Role == interfaces.RoleAttendee {
+				go publish(clients, envelope.UserID, false)
+			}
+			if clients.Len() == 1 {
+				go reopenSession(clients.Session)
+			}
+			if clients.Settings.AutoRecord && clients.Len() == 1 {
+				go autoRecord(socket, clients, envelope.UserID)
+			}
+		}
+		snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+
+	case "disconnect":
+		frame = append(json.RawMessage(nil), frame...)
+		if clients.SetSharing(envelope.UserID, false) {
+			go stopScreen(clients.Session, envelope.UserID)
+		}
+		for _, failed := range broadcaster.Broadcast(clients.Clients(), frame, envelope.Type) {
+			failed.Close()
+			suspend(clients, failed)
+		}
+		clients.Remove(envelope.UserID)
+		topology.Leave(socket, envelope.UserID)
+
+		if clients.Len() == 0 {
+			go snapshots.Delete(socket)
+		} else {
+			snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+		}
+	case "connection_path":
+		recordPath(socket, clients, envelope, frame)
+
+	case "quality_stats":
+		adviseQuality(socket, clients, envelope, frame)
+
+	case "set_layout":
+		setLayout(socket, clients, connection, envelope, frame)
+
+	case "request_floor", "withdraw_floor", "grant_floor", "deny_floor", "revoke_floor":
+		floorControl(socket, clients, connection, envelope, frame)
+
+	case "subscribe", "unsubscribe":
+		updateSubscriptions(socket, clients, envelope, frame)
+
+	case "add_marker":
+		addMarker(clients, connection, envelope, frame)
+
+	case "set_agenda", "agenda_start", "agenda_next", "agenda_stop":
+		agendaControl(socket, clients, connection, envelope, frame)
+
+	case "approve_feed", "deny_feed", "stop_feed":
+		feedControl(socket, clients, connection, envelope, frame)
+
+	case "still_here":
+		// Answers an inactivity warning, which touch took care of.
+
+	case "admit", "deny":
+		lobbyDecision(clients, connection, envelope, frame)
+		snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+
+	default:
+		if !relayable(clients, frame) || injector.Drop(envelope.Type) {
+			return true
+		}
+		if event, ok := relayedEvents[envelope.Type]; ok {
+			recordEvent(clients, event, envelope.UserID, nil)
+		}
+		shareScreen(socket, clients, envelope)
+		if envelope.Type == "reaction" {
+			react(socket, clients, frame)
+		}
+		injector.Delay(envelope.Type)
+		recipients := clients.Clients()
+		hold := false
+		if envelope.To != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if directory.Blocked(ctx, envelope.To, envelope.UserID) {
+				// Direct events from a blocked user never reach the blocker.
+				delete(recipients, envelope.To)
+			} else {
+				hold = recipients[envelope.To] == nil
 			}
+			cancel()
+		}
 
-		case "disconnect":
-			for user, client := range clients {
-				err := client.Send(message)
-				if err != nil {
-					client.Socket.Close()
-					delete(clients, user)
-				}
+		withoutLowData(clients, recipients, envelope.Type)
+
+		seq := clients.NextSeq(envelope.UserID)
+		frame = stamp(hideRelatedAddress(clients, rewriteSDP(clients, frame)), seq, received)
+		for _, failed := range broadcaster.Relay(recipients, frame, envelope.Type, envelope.UserID, seq) {
+			suspend(clients, failed)
+		}
+		if hold {
+			holdPending(clients, envelope.To, frame, envelope.Type, envelope.UserID, seq)
+		}
+
+		if envelope.Type == "audio_level" {
+			var level struct {
+				Data struct {
+					Level float64 `json:"level"`
+				} `json:"data"`
 			}
-			delete(clients, message.UserID)
-		default:
-			for user, client := range clients {
-				err := client.Send(message)
-				if err != nil {
-					delete(clients, user)
-				}
+			if json.Unmarshal(frame, &level) == nil {
+				speakers.Level(socket, clients.Session, envelope.UserID, level.Data.Level)
 			}
 		}
+
+		if envelope.Type == "chat" {
+			go watchChat(clients, envelope.UserID, frame)
+		}
+		feedRelayed(socket, clients, envelope, frame)
+
+		if envelope.Type == "chat" && matrixBridge != nil {
+			var message interfaces.Message
+			json.Unmarshal(frame, &message)
+			go matrixBridge.Forward(socket, message)
+		}
+	}
+
+	return true
+}
+
+// broadcast delivers a message originating outside the socket (e.g. a bridged
+// chat message) to every client connected to it.
+func broadcast(socket string, message interfaces.Message) {
+	frame, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+
+	clients := room(socket)
+	for _, failed := range broadcaster.Broadcast(clients.Clients(), frame, message.Type) {
+		suspend(clients, failed)
 	}
 }
 
@@ -95,21 +572,82 @@ func main() {
 	defer file.Close()
 	log.SetOutput(file)
 
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{getenv("HOST_URL", "localhost")}
+	production, err := strconv.ParseBool(getenv("PRODUCTION", "false"))
+	if err != nil {
+		log.Fatal("Invalid PRODUCTION: ", err)
+	}
+	checks := &lockdown{production: production}
+	// Importing room states is for development servers reproducing issues.
+	roomImport, err := strconv.ParseBool(getenv("ROOM_IMPORT", "false"))
+	if err != nil {
+		log.Fatal("Invalid ROOM_IMPORT: ", err)
+	}
+	if roomImport && production {
+		log.Fatal("ROOM_IMPORT is for development servers and cannot be set with PRODUCTION")
+	}
 
-	router := gin.Default()
-	router.Use(cors.Default())
+	router := gin.New()
+	router.Use(utils.RequestIDs(), gin.LoggerWithFormatter(utils.LogFormatter), gin.Recovery())
+	// Client IPs, which lookup throttling keys on, are read from
+	// X-Forwarded-For only on requests from TRUSTED_PROXIES, a comma
+	// separated list of addresses or CIDRs such as the load balancer's.
+	// Without it the connection's own address is used.
+	var proxies []string
+	if list := getenv("TRUSTED_PROXIES", ""); list != "" {
+		proxies = strings.Split(list, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	// Without CORS_ORIGINS, a comma separated list such as
+	// "https://meet.example.com", every origin is allowed, which only
+	// suits development.
+	origins := getenv("CORS_ORIGINS", "")
+	if origins == "" || origins == "*" {
+		router.Use(cors.Default())
+	} else {
+		config := cors.DefaultConfig()
+		config.AllowOrigins = strings.Split(origins, ",")
+		router.Use(cors.New(config))
+	}
 
 	credential := options.Credential{
-		Username: "root",
-		Password: "rootpassword",
+		Username: getenv("DB_USERNAME", defaultDBUsername),
+		Password: utils.Secret("DB_PASSWORD"),
+	}
+	if credential.Password == "" {
+		credential.Password = defaultDBPassword
+	}
+	checks.checkConfig(origins, credential.Username, credential.Password, utils.Secret("JWT_SECRET"))
+	ipFamily, err = utils.ParseIPFamily(getenv("IP_FAMILY", "dual"))
+	if err != nil {
+		log.Fatal("Invalid IP_FAMILY: ", err)
+	}
+
+	limits, err = parseLimits()
+	if err != nil {
+		log.Fatal("Invalid message limits: ", err)
+	}
+	fileRelayLimit, err = strconv.ParseInt(getenv("FILE_RELAY_MAX_BYTES", "26214400"), 10, 64)
+	if err != nil || fileRelayLimit < 0 {
+		log.Fatal("Invalid FILE_RELAY_MAX_BYTES: ", getenv("FILE_RELAY_MAX_BYTES", "26214400"))
+	}
+
+	injector = chaos.NewInjector()
+	if injector != nil {
+		log.Println("Built with the chaos tag: failures can be injected through /admin/chaos")
+	}
+
+	clientOptions := options.Client().ApplyURI("mongodb://" + net.JoinHostPort(getenv("DB_URL", "localhost"), getenv("DB_PORT", "27017"))).SetAuth(credential)
+	if injector != nil {
+		clientOptions.SetMonitor(injector.Monitor())
 	}
-	clientOptions := options.Client().ApplyURI("mongodb://" + getenv("DB_URL", "localhost") + ":" + getenv("DB_PORT", "27017")).SetAuth(credential)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		log.Fatal(err)
 	}
+	checks.checkPasswords(client)
+	checks.enforce()
 
 	// Consul Client
 	consulConfig := api.DefaultConfig()
@@ -119,13 +657,31 @@ func main() {
 		log.Fatal("Error creating Consul client:", err)
 	}
 
+	// In Kubernetes POD_NAME and POD_IP come from the downward API, so each
+	// pod registers and advertises its own WebSocket endpoint.
+	hostname, _ := os.Hostname()
+	// IPv6 pod addresses are bracketed in URLs.
+	podIP := getenv("POD_IP", ipFamily.Loopback())
+	port := getenv("PORT", "8080")
+	ring = placement.NewRing(placement.Node{
+		ID:      getenv("NODE_ID", "signalling-"+getenv("POD_NAME", hostname)),
+		URL:     getenv("NODE_URL", "ws://"+net.JoinHostPort(podIP, port)),
+		Version: getenv("NODE_VERSION", ""),
+	})
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		log.Fatal("Invalid PORT: ", port)
+	}
+
 	registration := &api.AgentServiceRegistration{
-		ID:      "signalling-service",
+		ID:      ring.Self().ID,
 		Name:    "signalling-service",
-		Address: "127.0.0.1",
-		Port:    8080,
+		Address: podIP,
+		Port:    portNumber,
+		Meta:    map[string]string{placement.MetaURL: ring.Self().URL, placement.MetaVersion: ring.Self().Version},
 		Check: &api.AgentServiceCheck{
-			HTTP:     "http://127.0.0.1:8080/health",
+			HTTP:     "http://" + net.JoinHostPort(podIP, port) + "/health",
 			Interval: "10s",
 		},
 	}
@@ -135,34 +691,711 @@ func main() {
 		log.Fatal("Error registering service with Consul: ", err)
 	}
 
+	discovery = consulClient
+	go ring.Watch(consulClient, "signalling-service", 10*time.Second, handoff)
+
+	topology = media.NewTopology()
+	topology.OnMigrate = func(migration media.Migration) {
+		broadcast(migration.Room, interfaces.Message{Type: "ice_restart", Data: migration})
+	}
+	mediaWatch, err := time.ParseDuration(getenv("MEDIA_WATCH_INTERVAL", "3s"))
+	if err != nil {
+		log.Fatal("Invalid MEDIA_WATCH_INTERVAL: ", err)
+	}
+	go topology.Watch(consulClient, "media-service", mediaWatch)
+
+	geo, err := utils.NewGeoResolver(getenv("GEOIP_DB", ""), getenv("GEO_REGIONS", ""))
+	if err != nil {
+		log.Fatal("Error opening GeoIP database: ", err)
+	}
+
 	err = client.Ping(context.TODO(), nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	log.Println("MongoDB connection ok...")
+	database = client
+
+	workers, err := strconv.Atoi(getenv("FANOUT_WORKERS", "64"))
+	if err != nil || workers < 1 {
+		log.Fatal("Invalid FANOUT_WORKERS: ", getenv("FANOUT_WORKERS", "64"))
+	}
+	writeTimeout, err := time.ParseDuration(getenv("FANOUT_WRITE_TIMEOUT", "2s"))
+	if err != nil {
+		log.Fatal("Invalid FANOUT_WRITE_TIMEOUT: ", err)
+	}
+	queueSize, err := strconv.Atoi(getenv("QUEUE_SIZE", "256"))
+	if err != nil || queueSize < 1 {
+		log.Fatal("Invalid QUEUE_SIZE: ", getenv("QUEUE_SIZE", "256"))
+	}
+	grace, err := time.ParseDuration(getenv("SLOW_CONSUMER_GRACE", "5s"))
+	if err != nil {
+		log.Fatal("Invalid SLOW_CONSUMER_GRACE: ", err)
+	}
+	droppable := make(map[string]bool)
+	for _, messageType := range strings.Split(getenv("QUEUE_DROPPABLE", "audio_level,typing"), ",") {
+		if messageType = strings.TrimSpace(messageType); messageType != "" {
+			droppable[messageType] = true
+		}
+	}
+	batchWindow, err := time.ParseDuration(getenv("BATCH_WINDOW", "0s"))
+	if err != nil {
+		log.Fatal("Invalid BATCH_WINDOW: ", err)
+	}
+	broadcaster = newFanout(workers, writeTimeout, &interfaces.QueuePolicy{
+		Size:        queueSize,
+		HardLimit:   queueSize * 4,
+		Grace:       grace,
+		Droppable:   droppable,
+		BatchWindow: batchWindow,
+		BatchBytes:  16 * 1024,
+	})
+
+	err = utils.EnsureIndexes(context.TODO(), client)
+	if err != nil {
+		log.Fatal("Error creating MongoDB indexes: ", err)
+	}
+
+	snapshotInterval, err := time.ParseDuration(getenv("SNAPSHOT_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatal("Invalid SNAPSHOT_INTERVAL: ", err)
+	}
+	snapshots = recovery.NewStore(client, snapshotInterval)
+
+	handoffGrace, err = time.ParseDuration(getenv("HANDOFF_GRACE", "15s"))
+	if err != nil {
+		log.Fatal("Invalid HANDOFF_GRACE: ", err)
+	}
+	pendingWindow, err = time.ParseDuration(getenv("PENDING_WINDOW", "30s"))
+	if err != nil {
+		log.Fatal("Invalid PENDING_WINDOW: ", err)
+	}
+
+	plans, err := quota.ParsePlans(getenv("PLAN_QUOTAS", ""))
+	if err != nil {
+		log.Fatal("Invalid PLAN_QUOTAS: ", err)
+	}
+	nodeCapacity, err := strconv.Atoi(getenv("NODE_MAX_CONNECTIONS", "0"))
+	if err != nil {
+		log.Fatal("Invalid NODE_MAX_CONNECTIONS: ", err)
+	}
+	// New rooms are placed on the least loaded node; see placement.Ring.Place.
+	go placement.Report(consulClient, ring.Self().ID, 5*time.Second, func() placement.Load {
+		rooms, connections := stats()
+		return placement.Load{Connections: connections, Rooms: rooms, Capacity: nodeCapacity}
+	})
+	if secret := utils.Secret("JWT_SECRET"); secret != "" {
+		logins = auth.NewSessions(client, secret)
+		go logins.Watch(5 * time.Second)
+	} else {
+		log.Println("JWT_SECRET is not set, sockets are not tied to login sessions")
+	}
+
+	directory = contacts.NewDirectory(client)
+	presences = presence.NewTracker(client, ring.Self().ID)
+	go presences.Run()
+
+	ringTimeout, err := time.ParseDuration(getenv("CALL_RING_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatal("Invalid CALL_RING_TIMEOUT: ", err)
+	}
+	ringer = calls.NewRinger(client, ringTimeout)
+	ringer.Blocked = directory.Blocked
+	go ringer.Run()
+
+	quotas = quota.NewTracker(client, ring.Self().ID, plans, nodeCapacity)
+
+	policies = rules.NewEngine(client)
+
+	maintenances = maintenance.NewScheduler(client, ring.Self().ID)
+	maintenances.OnAnnounce = announceMaintenance
+	maintenances.OnDeadline = startMaintenance
+	maintenances.OnCancel = cancelMaintenance
+	go maintenances.Run(5 * time.Second)
+
+	admissionTimeout, err := time.ParseDuration(getenv("ADMISSION_TIMEOUT", "2s"))
+	if err != nil {
+		log.Fatal("Invalid ADMISSION_TIMEOUT: ", err)
+	}
+	admissions = admission.NewHooks(client,
+		getenv("ADMISSION_WEBHOOK_URL", ""),
+		utils.Secret("ADMISSION_WEBHOOK_SECRET"),
+		admissionTimeout,
+		getenv("ADMISSION_FAIL_OPEN", "false") == "true")
+
+	speechThreshold, err := strconv.ParseFloat(getenv("SPEECH_THRESHOLD", "0.05"), 64)
+	if err != nil {
+		log.Fatal("Invalid SPEECH_THRESHOLD: ", err)
+	}
+	speakers = analytics.NewSpeakers(client, speechThreshold)
+	speechLevel = speechThreshold
+	attendance = analytics.NewAttendance(client)
+
+	thresholds, err := quality.ParseThresholds(os.Getenv("QUALITY_THRESHOLDS"))
+	if err != nil {
+		log.Fatal("Invalid QUALITY_THRESHOLDS: ", err)
+	}
+	advisor = quality.NewAdvisor(thresholds)
+	timeline = analytics.NewTimeline(client)
+
+	audienceInterval, err := time.ParseDuration(getenv("AUDIENCE_INTERVAL", "5s"))
+	if err != nil || audienceInterval <= 0 {
+		log.Fatal("Invalid AUDIENCE_INTERVAL: ", err)
+	}
+	audience = analytics.NewAudience(client)
+	go watchAudience(audienceInterval)
+	paths = analytics.NewPaths(client)
+
+	transcodeWorkers, err := strconv.Atoi(getenv("TRANSCODE_WORKERS", "1"))
+	if err != nil {
+		log.Fatal("Invalid TRANSCODE_WORKERS: ", err)
+	}
+	transcodeTimeout, err := time.ParseDuration(getenv("TRANSCODE_TIMEOUT", "1h"))
+	if err != nil {
+		log.Fatal("Invalid TRANSCODE_TIMEOUT: ", err)
+	}
+	highlightLength, err := time.ParseDuration(getenv("HIGHLIGHT_LENGTH", "30s"))
+	if err != nil {
+		log.Fatal("Invalid HIGHLIGHT_LENGTH: ", err)
+	}
+	maxHighlights, err := strconv.Atoi(getenv("MAX_HIGHLIGHTS", "10"))
+	if err != nil {
+		log.Fatal("Invalid MAX_HIGHLIGHTS: ", err)
+	}
+	blobs, err := storage.New(storage.Config{
+		Backend:        getenv("STORAGE_BACKEND", "local"),
+		Dir:            getenv("STORAGE_DIR", "/data"),
+		Bucket:         getenv("STORAGE_BUCKET", ""),
+		Endpoint:       getenv("STORAGE_ENDPOINT", ""),
+		Region:         getenv("STORAGE_REGION", ""),
+		AccessKey:      utils.Secret("STORAGE_ACCESS_KEY"),
+		SecretKey:      utils.Secret("STORAGE_SECRET_KEY"),
+		PathStyle:      getenv("STORAGE_PATH_STYLE", "false") == "true",
+		GCSCredentials: []byte(utils.Secret("GCS_CREDENTIALS")),
+	})
+	if err != nil {
+		log.Fatal("Error configuring storage: ", err)
+	}
+
+	matrixBridge, err = bridges.NewMatrixBridge(bridges.MatrixConfig{
+		HomeserverURL: getenv("MATRIX_HOMESERVER_URL", ""),
+		ServerName:    getenv("MATRIX_SERVER_NAME", ""),
+		ASToken:       getenv("MATRIX_AS_TOKEN", ""),
+		HSToken:       getenv("MATRIX_HS_TOKEN", ""),
+		PuppetPrefix:  getenv("MATRIX_PUPPET_PREFIX", "videoconf_"),
+	}, client, broadcast)
+	if err != nil {
+		log.Fatal("Error configuring the Matrix bridge: ", err)
+	}
+
+	playbackSecret := utils.Secret("PLAYBACK_SECRET")
+	if playbackSecret == "" {
+		log.Println("PLAYBACK_SECRET is not set, playback links will not survive a restart")
+		random := make([]byte, 32)
+		rand.Read(random)
+		playbackSecret = hex.EncodeToString(random)
+	}
+	signer = utils.NewURLSigner(playbackSecret)
+
+	// Failed session lookups and passwords are throttled per IP, so session
+	// URLs cannot be enumerated or passwords guessed at speed.
+	lookupFailures, err := strconv.Atoi(getenv("LOOKUP_FAILURES", "20"))
+	if err != nil || lookupFailures < 1 {
+		log.Fatal("Invalid LOOKUP_FAILURES: ", getenv("LOOKUP_FAILURES", "20"))
+	}
+	lookupWindow, err := time.ParseDuration(getenv("LOOKUP_WINDOW", "10m"))
+	if err != nil || lookupWindow <= 0 {
+		log.Fatal("Invalid LOOKUP_WINDOW: ", getenv("LOOKUP_WINDOW", "10m"))
+	}
+	lookups := utils.NewThrottle(lookupFailures, lookupWindow)
+
+	exports := export.NewExporter(client, blobs)
+	go exports.Sweep(time.Hour)
+	go expireAccessLogs(client, time.Hour)
+	idempotency := utils.NewIdempotency(client, func(r *http.Request) string {
+		claims, err := logins.Authenticate(r)
+		if err != nil || claims == nil {
+			return ""
+		}
+		return claims.Subject
+	})
+	go expireEchoTests(client, topology, 15*time.Second)
+	go watchInactivity(15 * time.Second)
+	go watchAgendas(5 * time.Second)
+	go watchFeeds(2 * time.Second)
+	go watchProfiles(client, time.Second)
+
+	iceTTL, err := time.ParseDuration(getenv("TURN_TTL", "12h"))
+	if err != nil {
+		log.Fatal("Invalid TURN_TTL: ", err)
+	}
+	// AV1 stays behind a flag while it is experimental.
+	codecs = interfaces.CodecPolicy{
+		Allowed:   media.ParseCodecs(getenv("CODECS_ALLOWED", "")),
+		Preferred: media.ParseCodecs(getenv("CODECS_PREFERRED", "")),
+	}
+	for _, codec := range append(append([]string{}, codecs.Allowed...), codecs.Preferred...) {
+		if !media.KnownCodec(codec) {
+			log.Fatal("Unknown codec in CODECS_ALLOWED or CODECS_PREFERRED: ", codec)
+		}
+	}
+	if getenv("ENABLE_AV1", "false") != "true" {
+		codecs.Allowed = withoutAV1(codecs.Allowed)
+	}
+
+	ice := &media.ICE{
+		STUN:       media.ParseURLs(getenv("STUN_URLS", "")),
+		TURN:       media.ParseURLs(getenv("TURN_URLS", "")),
+		TURNSecret: utils.Secret("TURN_SECRET"),
+		TTL:        iceTTL,
+		Family:     ipFamily,
+	}
+	meter := metering.NewMeter(client)
+	usageInterval, err := time.ParseDuration(getenv("MEDIA_USAGE_INTERVAL", "1m"))
+	if err != nil || usageInterval <= 0 {
+		log.Fatal("Invalid MEDIA_USAGE_INTERVAL: ", getenv("MEDIA_USAGE_INTERVAL", "1m"))
+	}
+	go metering.NewCollector(client, meter, topology, ring.Owns).Run(usageInterval)
+	// coturn reads rotated secrets from its mongo-userdb, TURN_DB here.
+	if turnDB := getenv("TURN_DB", ""); turnDB != "" {
+		rotation, err := time.ParseDuration(getenv("TURN_SECRET_ROTATION", "24h"))
+		if err != nil || rotation <= 0 {
+			log.Fatal("Invalid TURN_SECRET_ROTATION: ", getenv("TURN_SECRET_ROTATION", "24h"))
+		}
+		secrets := turn.NewSecrets(client.Database(turnDB), getenv("TURN_REALM", ""))
+		go secrets.Rotate(rotation, iceTTL)
+		ice.Secrets = secrets
+	}
+	if admins := turn.ParseAdmins(getenv("TURN_ADMIN_ADDRS", ""), utils.Secret("TURN_ADMIN_PASSWORD")); len(admins) > 0 {
+		turnInterval, err := time.ParseDuration(getenv("TURN_POLL_INTERVAL", "30s"))
+		if err != nil || turnInterval <= 0 {
+			log.Fatal("Invalid TURN_POLL_INTERVAL: ", getenv("TURN_POLL_INTERVAL", "30s"))
+		}
+		turnMonitor = turn.NewMonitor(client, meter, admins, ring.Owns, turnInterval)
+		go turnMonitor.Run()
+	}
+
+	links := utils.Links{
+		PublicURL: getenv("PUBLIC_URL", "http://localhost:"+port),
+		JoinURL:   getenv("JOIN_URL", "http://localhost:3000/join/{url}"),
+	}
+	registry := domains.NewRegistry(client, hostOf(links.PublicURL), hostOf(links.JoinURL))
+	brands := branding.NewStore(client, links, registry)
+
+	calendarInterval, err := time.ParseDuration(getenv("CALENDAR_SYNC_INTERVAL", "15m"))
+	if err != nil {
+		log.Fatal("Invalid CALENDAR_SYNC_INTERVAL: ", err)
+	}
+	var calendarProviders []*calendar.Provider
+	if id := getenv("GOOGLE_CLIENT_ID", ""); id != "" {
+		calendarProviders = append(calendarProviders, calendar.NewGoogle(id, utils.Secret("GOOGLE_CLIENT_SECRET"),
+			strings.TrimRight(links.PublicURL, "/")+"/calendar/google/callback"))
+	}
+	if id := getenv("MICROSOFT_CLIENT_ID", ""); id != "" {
+		calendarProviders = append(calendarProviders, calendar.NewMicrosoft(id, utils.Secret("MICROSOFT_CLIENT_SECRET"),
+			getenv("MICROSOFT_TENANT", "common"), strings.TrimRight(links.PublicURL, "/")+"/calendar/microsoft/callback"))
+	}
+	calendars := calendar.NewSyncer(client, brands, calendarInterval, calendarProviders...)
+
+	if key := utils.Secret("LTI_PRIVATE_KEY"); key != "" {
+		if courses, err = lti.NewTool(client, signer, key, strings.TrimRight(links.PublicURL, "/")+"/lti/launch"); err != nil {
+			log.Fatal("Invalid LTI_PRIVATE_KEY: ", err)
+		}
+	}
+	go calendars.Run(10 * time.Second)
+
+	keys := automation.NewKeys(client)
+	hooks := automation.NewHooks(client, signer, brands)
+	go hooks.Run(5 * time.Second)
+	automations = hooks
+	crms = crm.NewSync(client, signer, brands)
+	attendanceGrace, err := time.ParseDuration(getenv("ATTENDANCE_GRACE", "5m"))
+	if err != nil {
+		log.Fatal("Invalid ATTENDANCE_GRACE: ", err)
+	}
+	automation.AttendanceGrace = attendanceGrace
+
+	watchlists = compliance.NewMonitor(client, hooks)
+
+	storageQuota = quota.NewStorage(client, blobs, plans, func(usage quota.StorageUsage, threshold int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hooks.Fire(ctx, automation.OrgOwner(usage.OrgID), automation.EventStorageWarning, automation.Item{
+			"orgID":      usage.OrgID,
+			"threshold":  threshold,
+			"bytes":      usage.Bytes,
+			"limit":      usage.Limit,
+			"percent":    usage.Percent,
+			"policy":     usage.Policy,
+			"recordings": usage.Recordings,
+		})
+	})
+
+	transcode.NewPool(client, transcode.Config{
+		Dir:     getenv("RECORDINGS_DIR", "/recordings"),
+		Workers: transcodeWorkers,
+		Timeout: transcodeTimeout,
+		Poll:    5 * time.Second,
+		FFmpeg:  getenv("FFMPEG", "ffmpeg"),
+		FFprobe: getenv("FFPROBE", "ffprobe"),
+		Store:   blobs,
+		OnReady: func(recording interfaces.Recording) {
+			hooks.RecordingReady(recording)
+			crms.RecordingReady(recording)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			storageQuota.Enforce(ctx, recording.OrgID)
+		},
+
+		HighlightLength: highlightLength,
+		MaxHighlights:   maxHighlights,
+	}).Start()
+
+	mediaBackend, err := media.NewBackend(media.Config{
+		Backend:               getenv("MEDIA_BACKEND", "builtin"),
+		LiveKitURL:            getenv("LIVEKIT_URL", ""),
+		LiveKitAPIKey:         getenv("LIVEKIT_API_KEY", ""),
+		LiveKitAPISecret:      getenv("LIVEKIT_API_SECRET", ""),
+		LiveKitEgressTemplate: getenv("LIVEKIT_EGRESS_TEMPLATE_URL", ""),
+		LiveKitRecordingPath:  getenv("LIVEKIT_RECORDING_PATH", ""),
+		LiveKitSIPTrunk:       getenv("LIVEKIT_SIP_TRUNK_ID", ""),
+		JitsiDomain:           getenv("JITSI_DOMAIN", ""),
+		JitsiAppID:            getenv("JITSI_APP_ID", ""),
+		JitsiAppSecret:        getenv("JITSI_APP_SECRET", ""),
+	})
+	if err != nil {
+		log.Fatal("Error configuring media backend: ", err)
+	}
+
+	log.Printf("Using %s media backend", mediaBackend.Name())
+	recorder, _ = mediaBackend.(media.Recorder)
+	screens = assets.NewScreens(client, mediaBackend)
+	markers = assets.NewMarkers(client)
+	dialer, _ = mediaBackend.(media.Dialer)
+	videoGate, _ = mediaBackend.(media.VideoGate)
+	subscriber, _ = mediaBackend.(media.Subscriber)
+	compositor, _ = mediaBackend.(media.Compositor)
+	stage, _ = mediaBackend.(media.Stage)
 
 	// middleware - intercept requests to use our db controller
 	router.Use(func(context *gin.Context) {
 		context.Set("db", client)
+		context.Set("media", mediaBackend)
+		context.Set("screens", screens)
+		context.Set("storageQuota", storageQuota)
+		context.Set("compliance", watchlists)
+		context.Set("placement", ring)
+		context.Set("topology", topology)
+		context.Set("geo", geo)
+		context.Set("quota", quotas)
+		context.Set("speakers", speakers)
+		context.Set("signer", signer)
+		context.Set("lookups", lookups)
+		context.Set("storage", blobs)
+		context.Set("links", links)
+		context.Set("branding", brands)
+		context.Set("domains", registry)
+		context.Set("presence", presences)
+		context.Set("logins", logins)
+		context.Set("exports", exports)
+		context.Set("ice", ice)
+		context.Set("turn", turnMonitor)
+		context.Set("calls", ringer)
+		context.Set("codecs", codecs)
+		context.Set("admission", admissions)
+		context.Set("rules", policies)
+		context.Set("maintenance", maintenances)
+		context.Set("keys", keys)
+		context.Set("hooks", hooks)
+		context.Set("calendars", calendars)
+		context.Set("timeline", timeline)
+		context.Set("lti", courses)
+		context.Set("crm", crms)
 		context.Next()
 	})
 
-	router.POST("/session", controllers.CreateSession)
-	router.GET("/connect", controllers.GetSession)
-	router.POST("/connect/:url", controllers.ConnectSession)
+	router.POST("/session", idempotency.Guard(), controllers.CreateSession)
+	router.GET("/session/:url/join-info", lookups.Guard(), controllers.GetJoinInfo)
+	router.POST("/session/:url/invites", controllers.CreateInvite)
+	router.POST("/session/:url/join-codes", controllers.CreateJoinCode)
+	router.POST("/join-codes/redeem", controllers.RedeemJoinCode)
+	router.GET("/session/:url/analytics/speakers", controllers.GetSpeakerStats)
+	router.GET("/session/:url/attendance", controllers.GetAttendance)
+	router.GET("/session/:url/timeline", controllers.GetTimeline)
+	router.GET("/session/:url/audience", controllers.GetAudience)
+	router.GET("/session/:url/qr", controllers.GetSessionQR)
+	router.GET("/session/:url/short-link", controllers.GetShortLink)
+	router.GET("/j/:code", controllers.FollowShortLink)
+	router.GET("/orgs/:id/branding", controllers.GetBranding)
+	router.GET("/domain", controllers.GetDomain)
+	router.POST("/session/:url/phone", dialPhone)
+	router.POST("/session/:url/diagnostics", uploadDiagnostics)
+	router.POST("/session/:url/phone/:id/mute", mutePhone)
+	router.DELETE("/session/:url/phone/:id", kickPhone)
+	router.GET("/session/:url/subscriptions", getSubscriptionStats)
+	router.POST("/session/:url/recordings", lookups.Guard(), controllers.StartRecording)
+	router.POST("/session/:url/recordings/:id/stop", lookups.Guard(), controllers.StopRecording)
+	router.POST("/session/:url/recordings/:id/link", lookups.Guard(), controllers.CreatePlaybackLink)
+	router.POST("/session/:url/recordings/:id/redactions", controllers.RedactRecording)
+	router.GET("/recordings/:id/play", controllers.PlayRecording)
+	router.GET("/recordings/:id/thumbnail", controllers.GetRecordingThumbnail)
+	router.GET("/recordings/:id/highlights/:clip", controllers.PlayHighlight)
+	router.GET("/connect", lookups.Guard(), controllers.GetSession)
+	router.POST("/connect/:url", lookups.Guard(), controllers.ConnectSession)
+	router.POST("/session/:url/consent", lookups.Guard(), controllers.AcceptConsent)
+	router.GET("/media/regions", controllers.GetMediaRegions)
+	router.GET("/users/:id/presence", controllers.GetPresence)
+	router.GET("/devices/me/meetings", controllers.GetDeviceMeetings)
+	router.POST("/api-keys", controllers.CreateAPIKey)
+	router.GET("/api-keys", controllers.ListAPIKeys)
+	router.DELETE("/api-keys/:id", controllers.DeleteAPIKey)
+	router.GET("/automation/me", controllers.GetAutomationMe)
+	router.GET("/automation/triggers/meetings", controllers.ListMeetingsTrigger)
+	router.GET("/automation/triggers/recordings", controllers.ListRecordingsTrigger)
+	router.GET("/automation/hooks", controllers.ListHooks)
+	router.POST("/automation/hooks", controllers.SubscribeHook)
+	router.DELETE("/automation/hooks/:id", controllers.UnsubscribeHook)
+	router.POST("/automation/actions/meetings", controllers.CreateMeetingAction)
+	router.POST("/automation/actions/meetings/:url/invites", controllers.InviteAction)
+	router.POST("/automation/actions/meetings/:url/feeds", controllers.RequestFeedAction)
+	router.POST("/automation/actions/meetings/:url/embeds", controllers.EmbedAction)
+	router.GET("/automation/feeds/:id", controllers.GetFeedAction)
+	router.DELETE("/automation/feeds/:id", controllers.StopFeedAction)
+	router.GET("/calendar", controllers.ListCalendars)
+	router.GET("/calendar/:provider/connect", controllers.ConnectCalendar)
+	router.GET("/calendar/:provider/callback", controllers.CalendarCallback)
+	router.DELETE("/calendar/:provider", controllers.DisconnectCalendar)
+	router.PUT("/session/:url/schedule", controllers.RescheduleSession)
+	router.DELETE("/session/:url/schedule", controllers.CancelSession)
+	router.PUT("/session/:url/agenda", controllers.SetAgenda)
+	router.GET("/session/:url/feeds", controllers.ListSessionFeeds)
+	router.POST("/session/:url/feeds/:id/approve", controllers.ApproveSessionFeed)
+	router.POST("/session/:url/feeds/:id/deny", controllers.DenySessionFeed)
+	router.DELETE("/session/:url/feeds/:id", controllers.StopSessionFeed)
+	router.GET("/lti/login", controllers.LTILogin)
+	router.POST("/lti/login", controllers.LTILogin)
+	router.POST("/lti/launch", controllers.LTILaunch)
+	router.GET("/lti/jwks", controllers.LTIKeySet)
+	router.GET("/meetings/upcoming", controllers.ListUpcomingMeetings)
+	router.GET("/delegates", controllers.ListDelegates)
+	router.GET("/delegates/principals", controllers.ListPrincipals)
+	router.POST("/delegates", controllers.GrantDelegate)
+	router.DELETE("/delegates/:user", controllers.RevokeDelegate)
+	router.GET("/users/:id/export", controllers.GetExport)
+	router.GET("/calls", controllers.ListCalls)
+	router.GET("/preflight", controllers.StartPreflight)
+	router.POST("/preflight/:id/results", controllers.SubmitPreflight)
+	router.POST("/echo", controllers.StartEchoTest)
+	router.POST("/echo/:id/stop", controllers.StopEchoTest)
+	router.GET("/preflight/ws", func(c *gin.Context) {
+		preflighthandler(c.Writer, c.Request)
+	})
+	router.POST("/templates", controllers.CreateTemplate)
+	router.GET("/templates", controllers.ListTemplates)
+	router.GET("/templates/:id", controllers.GetTemplate)
+	router.PUT("/templates/:id", controllers.UpdateTemplate)
+	router.DELETE("/templates/:id", controllers.DeleteTemplate)
+	router.GET("/exports/:id/download", controllers.DownloadExport)
+	router.GET("/presence/ws", func(c *gin.Context) {
+		presencehandler(c.Writer, c.Request)
+	})
+	router.GET("/feeds/:id/socket", func(c *gin.Context) {
+		feedhandler(c.Writer, c.Request, signer, c.Param("id"))
+	})
+	router.GET("/metrics", metrics)
 	router.GET("/health", func(ctx *gin.Context) {
+		if ring.Draining() {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "Service is draining",
+			})
+			return
+		}
 		ctx.JSON(200, gin.H{
 			"message": "Service is Healthy",
 		})
 	})
 
-	router.GET("/ws/:socket", func(c *gin.Context) {
-		socket := c.Param("socket")
-		wshandler(c.Writer, c.Request, socket)
-	})
+	admin := router.Group("/admin", utils.AdminAuth(os.Getenv("ADMIN_TOKEN")))
+	admin.GET("/drain", getDrain)
+	admin.POST("/drain", postDrain)
+	admin.GET("/deployment", getDeployment)
+	admin.POST("/deployment", postDeployment)
+	if injector != nil {
+		admin.GET("/chaos", getChaos)
+		admin.PUT("/chaos", putChaos)
+		admin.POST("/chaos/disconnect", postChaosDisconnect)
+	}
+	admin.GET("/maintenance", getMaintenance)
+	admin.POST("/maintenance", postMaintenance)
+	admin.DELETE("/maintenance/:id", deleteMaintenance)
+	admin.GET("/orgs/:id", controllers.GetOrganization)
+	admin.PUT("/orgs/:id", controllers.UpdateOrganization)
+	admin.GET("/orgs/:id/branding", controllers.GetOrgBranding)
+	admin.PUT("/orgs/:id/branding", controllers.UpdateOrgBranding)
+	admin.GET("/orgs/:id/domains", controllers.ListOrgDomains)
+	admin.POST("/orgs/:id/domains", controllers.AddOrgDomain)
+	admin.POST("/orgs/:id/domains/:domain/verify", controllers.VerifyOrgDomain)
+	admin.DELETE("/orgs/:id/domains/:domain", controllers.DeleteOrgDomain)
+	admin.GET("/orgs/:id/consent", controllers.GetOrgConsent)
+	admin.PUT("/orgs/:id/consent", controllers.UpdateOrgConsent)
+	admin.GET("/orgs/:id/consent/records", controllers.ListConsentRecords)
+	admin.GET("/orgs/:id/turn-usage", controllers.GetOrgTURNUsage)
+	admin.GET("/orgs/:id/usage", controllers.GetOrgUsage)
+	admin.GET("/orgs/:id/storage", controllers.GetOrgStorage)
+	admin.POST("/recordings/:id/redactions", controllers.AdminRedactRecording)
+	admin.GET("/orgs/:id/hooks", controllers.ListOrgHooks)
+	admin.POST("/orgs/:id/hooks", controllers.SubscribeOrgHook)
+	admin.DELETE("/orgs/:id/hooks/:hook", controllers.UnsubscribeOrgHook)
+	admin.GET("/orgs/:id/crm", controllers.GetOrgCRM)
+	admin.PUT("/orgs/:id/crm", controllers.UpdateOrgCRM)
+	admin.DELETE("/orgs/:id/crm", controllers.DeleteOrgCRM)
+	admin.GET("/sessions/:url/preflight", controllers.GetPreflightReports)
+	admin.GET("/sessions/:url/diagnostics", controllers.ListDiagnostics)
+	admin.GET("/diagnostics/:id", controllers.GetDiagnostics)
+	admin.GET("/sessions/:url/quality", controllers.GetQualityReport)
+	admin.POST("/orgs/:id/templates", controllers.CreateOrgTemplate)
+	admin.DELETE("/orgs/:id/templates/:template", controllers.DeleteOrgTemplate)
+	admin.GET("/orgs/:id/rules", controllers.ListOrgRules)
+	admin.POST("/orgs/:id/rules", controllers.CreateOrgRule)
+	admin.PUT("/orgs/:id/rules/:rule", controllers.UpdateOrgRule)
+	admin.DELETE("/orgs/:id/rules/:rule", controllers.DeleteOrgRule)
+	admin.GET("/orgs/:id/watchlists", controllers.ListOrgWatchlists)
+	admin.POST("/orgs/:id/watchlists", controllers.CreateOrgWatchlist)
+	admin.PUT("/orgs/:id/watchlists/:watchlist", controllers.UpdateOrgWatchlist)
+	admin.DELETE("/orgs/:id/watchlists/:watchlist", controllers.DeleteOrgWatchlist)
+	admin.GET("/orgs/:id/alerts", controllers.ListOrgAlerts)
+	admin.GET("/lti/platforms", controllers.ListLTIPlatforms)
+	admin.POST("/lti/platforms", controllers.RegisterLTIPlatform)
+	admin.DELETE("/lti/platforms/:id", controllers.UnregisterLTIPlatform)
+	admin.GET("/rooms/:socket/state", exportRoomState)
+	if roomImport {
+		admin.POST("/rooms/:socket/state", importRoomState)
+	}
+	admin.POST("/orgs/:id/alerts/:alert/review", controllers.ReviewOrgAlert)
+
+	switch getenv("WS_MODE", "gorilla") {
+	case "epoll":
+		// The poller needs the raw TCP connection, which a TLS listener
+		// hides, and gobwas/ws is not set up to negotiate compression.
+		if getenv("TLS_PORT", "") != "" {
+			log.Fatal("WS_MODE=epoll cannot be used with TLS_PORT")
+		}
+		if os.Getenv("WS_COMPRESSION") == "true" {
+			log.Fatal("WS_MODE=epoll cannot be used with WS_COMPRESSION")
+		}
+		poller, err := netpoll.New()
+		if err != nil {
+			log.Fatal("Error starting epoll listener: ", err)
+		}
+		defer poller.Close()
+
+		router.GET("/ws/:socket", func(c *gin.Context) {
+			socket, embed, ok := embedSocket(c.Writer, c.Request, c.Param("socket"))
+			if !ok {
+				return
+			}
+			if !ring.Owns(socket) {
+				redirect(c.Writer, c.Request, socket, "/ws/"+c.Param("socket"))
+				return
+			}
+			epollhandler(poller, c.Writer, c.Request, socket, embed)
+		})
+	default:
+		router.GET("/ws/:socket", func(c *gin.Context) {
+			socket, embed, ok := embedSocket(c.Writer, c.Request, c.Param("socket"))
+			if !ok {
+				return
+			}
+			if !ring.Owns(socket) {
+				redirect(c.Writer, c.Request, socket, "/ws/"+c.Param("socket"))
+				return
+			}
+			wshandler(c.Writer, c.Request, socket, embed)
+		})
+	}
+
+	if matrixBridge != nil {
+		router.PUT("/_matrix/app/v1/transactions/:txnId", matrixBridge.Transactions)
+	}
+
+	// An empty LISTEN_HOST listens on every address of the IP family.
+	listener, err := net.Listen(ipFamily.Network(), net.JoinHostPort(getenv("LISTEN_HOST", ""), port))
+	if err != nil {
+		log.Fatal("Error listening: ", err)
+	}
+	if interval := getenv("PROBE_INTERVAL", ""); interval != "" {
+		probeInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal("Invalid PROBE_INTERVAL: ", err)
+		}
+		self := "http://" + net.JoinHostPort(ipFamily.Loopback(), port)
+		prober = probe.NewProber(getenv("PROBE_URL", self), probeInterval, 15*time.Second)
+		go prober.Run()
+	}
+
+	server := &http.Server{Handler: router}
 
-	router.Run(":" + getenv("PORT", "8080"))
+	// With TLS_PORT set, this node terminates TLS itself, getting
+	// certificates from ACME for its own hosts and orgs' verified domains.
+	// The plain listener keeps serving, and answers HTTP-01 challenges.
+	var tlsServer *http.Server
+	if tlsPort := getenv("TLS_PORT", ""); tlsPort != "" {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      domains.NewCertCache(client),
+			HostPolicy: registry.HostPolicy,
+			Email:      getenv("ACME_EMAIL", ""),
+		}
+		if directory := getenv("ACME_DIRECTORY_URL", ""); directory != "" {
+			manager.Client = &acme.Client{DirectoryURL: directory}
+		}
+		server.Handler = manager.HTTPHandler(router)
+
+		tlsListener, err := net.Listen(ipFamily.Network(), net.JoinHostPort(getenv("LISTEN_HOST", ""), tlsPort))
+		if err != nil {
+			log.Fatal("Error listening for TLS: ", err)
+		}
+		tlsServer = &http.Server{Handler: router, TLSConfig: manager.TLSConfig()}
+		go func() {
+			if err := tlsServer.ServeTLS(tlsListener, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGTERM (pod deletion, scale-down) leave discovery first, hand rooms
+	// to the remaining pods, then stop accepting requests.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	log.Println("Shutting down, draining rooms...")
+	if err := consulClient.Agent().ServiceDeregister(registration.ID); err != nil {
+		log.Printf("Error deregistering from Consul: %s", err)
+	}
+	drain()
+
+	drainTimeout, err := time.ParseDuration(getenv("DRAIN_TIMEOUT", "20s"))
+	if err != nil {
+		drainTimeout = 20 * time.Second
+	}
+	awaitDrained(drainTimeout)
+	snapshots.Flush()
+	speakers.Flush()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+	if tlsServer != nil {
+		tlsServer.Shutdown(ctx)
+	}
 }
 
 func getenv(key, fallback string) string {
@@ -172,3 +1405,13 @@ func getenv(key, fallback string) string {
 	}
 	return value
 }
+
+// hostOf returns the host a configured URL is served from, ignoring
+// placeholders in its path.
+func hostOf(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
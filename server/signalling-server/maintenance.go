@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/maintenance"
+)
+
+// maintenances follows the maintenance windows covering this node.
+var maintenances *maintenance.Scheduler
+
+// localRooms returns the rooms this node holds.
+func localRooms() map[string]*interfaces.Room {
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+	rooms := make(map[string]*interfaces.Room, len(sockets))
+	for socket, clients := range sockets {
+		rooms[socket] = clients
+	}
+	return rooms
+}
+
+func maintenanceScope(window maintenance.Window) string {
+	if window.ID == maintenance.Platform {
+		return "platform"
+	}
+	return "node"
+}
+
+// announceMaintenance counts down to the deadline in every room. Rooms on a
+// node under maintenance move to another node at the deadline; platform
+// maintenance ends them.
+func announceMaintenance(window maintenance.Window, remaining time.Duration) {
+	log.Printf("Maintenance %s in %s", window.ID, remaining.Round(time.Second))
+	message := interfaces.Message{Type: "maintenance", Text: window.Message, Data: gin.H{
+		"scope":     maintenanceScope(window),
+		"deadline":  window.Deadline,
+		"remaining": int(remaining.Seconds()),
+	}}
+	for socket := range localRooms() {
+		broadcast(socket, message)
+	}
+}
+
+func startMaintenance(window maintenance.Window) {
+	log.Printf("Maintenance %s started", window.ID)
+	if window.ID != maintenance.Platform {
+		drain()
+		return
+	}
+	for _, clients := range localRooms() {
+		for _, client := range clients.Clients() {
+			client.Send(interfaces.Message{Type: "maintenance_started", Text: window.Message})
+			client.Disconnect(interfaces.CloseMaintenance, "maintenance")
+		}
+	}
+}
+
+func cancelMaintenance(window maintenance.Window) {
+	log.Printf("Maintenance %s cancelled", window.ID)
+	for socket := range localRooms() {
+		broadcast(socket, interfaces.Message{Type: "maintenance_cancelled", Data: gin.H{"scope": maintenanceScope(window)}})
+	}
+}
+
+func getMaintenance(ctx *gin.Context) {
+	windows, err := maintenances.List(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load maintenance windows."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"node": ring.Self().ID, "windows": windows, "active": maintenances.Active()})
+}
+
+// postMaintenance schedules maintenance of the platform, or of a node (this
+// one by default), at a deadline given as a time or a delay from now. A
+// node's drain cannot be undone once its deadline passes; the node comes
+// back into the ring when it restarts.
+func postMaintenance(ctx *gin.Context) {
+	var input struct {
+		Scope    string    `json:"scope"`
+		Node     string    `json:"node"`
+		Message  string    `json:"message"`
+		Deadline time.Time `json:"deadline"`
+		In       string    `json:"in"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := maintenance.Window{Message: input.Message, Deadline: input.Deadline, CreatedAt: time.Now()}
+	switch input.Scope {
+	case "platform":
+		window.ID = maintenance.Platform
+	case "node", "":
+		window.Node = input.Node
+		if window.Node == "" {
+			window.Node = ring.Self().ID
+		}
+		window.ID = maintenance.NodeWindow(window.Node)
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be node or platform."})
+		return
+	}
+	if input.In != "" {
+		delay, err := time.ParseDuration(input.In)
+		if err != nil || delay < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delay."})
+			return
+		}
+		window.Deadline = time.Now().Add(delay)
+	}
+	if window.Deadline.IsZero() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A deadline or delay is required."})
+		return
+	}
+	if window.Message == "" {
+		window.Message = "Scheduled maintenance is about to begin."
+	}
+
+	if err := maintenances.Schedule(ctx, window); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not schedule maintenance."})
+		return
+	}
+	log.Printf("Maintenance %s scheduled for %s through admin API", window.ID, window.Deadline)
+	ctx.JSON(http.StatusOK, window)
+}
+
+func deleteMaintenance(ctx *gin.Context) {
+	found, err := maintenances.Cancel(ctx, ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel maintenance."})
+		return
+	}
+	if !found {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,227 @@
+// Package maintenance schedules maintenance windows for a single node or the
+// whole platform. Windows live in the maintenance collection, which every
+// replica polls, so scheduling one through any node reaches them all.
+package maintenance
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Platform is the ID of the window covering every node.
+const Platform = "platform"
+
+// Window is a scheduled maintenance. Node is empty for the platform window.
+type Window struct {
+	ID        string    `bson:"_id" json:"id"`
+	Node      string    `bson:"node,omitempty" json:"node,omitempty"`
+	Message   string    `bson:"message" json:"message"`
+	Deadline  time.Time `bson:"deadline" json:"deadline"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// NodeWindow returns the ID of the window covering node.
+func NodeWindow(node string) string {
+	return "node:" + node
+}
+
+// countdown lists how long before the deadline rooms are reminded.
+var countdown = []time.Duration{time.Hour, 30 * time.Minute, 15 * time.Minute, 10 * time.Minute, 5 * time.Minute, time.Minute, 30 * time.Second}
+
+// Scheduler follows the windows covering this node. OnAnnounce is called when
+// a window is first seen and at each countdown step, OnDeadline once its
+// deadline passes and OnCancel when it is removed before then. A nil
+// Scheduler has no windows.
+type Scheduler struct {
+	OnAnnounce func(window Window, remaining time.Duration)
+	OnDeadline func(window Window)
+	OnCancel   func(window Window)
+
+	collection *mongo.Collection
+	node       string
+
+	mu        sync.Mutex
+	windows   map[string]Window
+	announced map[string]time.Duration
+	passed    map[string]bool
+}
+
+func NewScheduler(db *mongo.Client, node string) *Scheduler {
+	return &Scheduler{
+		collection: db.Database("vidchat").Collection("maintenance"),
+		node:       node,
+		windows:    make(map[string]Window),
+		announced:  make(map[string]time.Duration),
+		passed:     make(map[string]bool),
+	}
+}
+
+// Schedule creates or replaces a window.
+func (s *Scheduler) Schedule(ctx context.Context, window Window) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": window.ID}, window, options.Replace().SetUpsert(true))
+	if err == nil {
+		s.poll()
+	}
+	return err
+}
+
+// Cancel removes a window, reporting whether it existed.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (bool, error) {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	s.poll()
+	return result.DeletedCount > 0, nil
+}
+
+// List returns every scheduled window, on any node.
+func (s *Scheduler) List(ctx context.Context) ([]Window, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	windows := []Window{}
+	return windows, cursor.All(ctx, &windows)
+}
+
+// Active returns the window covering this node, preferring the platform's,
+// or nil.
+func (s *Scheduler) Active() *Window {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range []string{Platform, NodeWindow(s.node)} {
+		if window, ok := s.windows[id]; ok {
+			return &window
+		}
+	}
+	return nil
+}
+
+// Closed reports whether the platform window's deadline has passed, after
+// which no meeting may run until it is cancelled.
+func (s *Scheduler) Closed() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.passed[Platform]
+}
+
+// Run polls for windows every interval and drives the callbacks.
+func (s *Scheduler) Run(interval time.Duration) {
+	if s == nil {
+		return
+	}
+	for {
+		s.poll()
+		time.Sleep(interval)
+	}
+}
+
+func (s *Scheduler) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": bson.A{Platform, NodeWindow(s.node)}}})
+	if err != nil {
+		log.Printf("Maintenance: polling windows: %s", err)
+		return
+	}
+	var found []Window
+	if err := cursor.All(ctx, &found); err != nil {
+		log.Printf("Maintenance: polling windows: %s", err)
+		return
+	}
+
+	var announce []func()
+	now := time.Now()
+
+	s.mu.Lock()
+	current := make(map[string]Window, len(found))
+	for _, window := range found {
+		current[window.ID] = window
+		if previous, ok := s.windows[window.ID]; ok && !previous.Deadline.Equal(window.Deadline) {
+			// Rescheduled: start the countdown over.
+			delete(s.announced, window.ID)
+			delete(s.passed, window.ID)
+		}
+
+		remaining := window.Deadline.Sub(now)
+		if remaining <= 0 {
+			if !s.passed[window.ID] {
+				s.passed[window.ID] = true
+				announce = append(announce, s.deadline(window))
+			}
+			continue
+		}
+		if step, ok := s.step(window.ID, remaining); ok {
+			s.announced[window.ID] = step
+			announce = append(announce, s.announce(window, remaining))
+		}
+	}
+	for id, window := range s.windows {
+		if _, ok := current[id]; !ok {
+			if !s.passed[id] {
+				announce = append(announce, s.cancel(window))
+			}
+			delete(s.announced, id)
+			delete(s.passed, id)
+		}
+	}
+	s.windows = current
+	s.mu.Unlock()
+
+	for _, f := range announce {
+		f()
+	}
+}
+
+// step returns the countdown step remaining falls in, and whether it has
+// not been announced yet. Windows further away than the first step share
+// one step, so they are announced once when first seen.
+func (s *Scheduler) step(id string, remaining time.Duration) (time.Duration, bool) {
+	step := time.Duration(math.MaxInt64)
+	for _, mark := range countdown {
+		if remaining <= mark {
+			step = mark
+		}
+	}
+	last, ok := s.announced[id]
+	return step, !ok || step < last
+}
+
+func (s *Scheduler) announce(window Window, remaining time.Duration) func() {
+	return func() {
+		if s.OnAnnounce != nil {
+			s.OnAnnounce(window, remaining)
+		}
+	}
+}
+
+func (s *Scheduler) deadline(window Window) func() {
+	return func() {
+		if s.OnDeadline != nil {
+			s.OnDeadline(window)
+		}
+	}
+}
+
+func (s *Scheduler) cancel(window Window) func() {
+	return func() {
+		if s.OnCancel != nil {
+			s.OnCancel(window)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// maxMarkerTitle bounds the characters of a marker's title.
+const maxMarkerTitle = 200
+
+// addMarker handles add_marker, with which hosts drop a chapter marker
+// titled data.title into the session's running recordings. The host is
+// answered with a marker message saying how many recordings were marked.
+func addMarker(clients *interfaces.Room, connection *interfaces.Connection, envelope interfaces.Envelope, frame json.RawMessage) {
+	if !hostOn(clients, connection, envelope.UserID) {
+		refuseMarker(connection, envelope, "not_host")
+		return
+	}
+	var message struct {
+		Data struct {
+			Title string `json:"title"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &message)
+	title := strings.TrimSpace(message.Data.Title)
+	if title == "" || utf8.RuneCountInString(title) > maxMarkerTitle {
+		refuseMarker(connection, envelope, "invalid_title")
+		return
+	}
+
+	marker := interfaces.RecordingMarker{Kind: interfaces.MarkerManual, Title: title, UserID: envelope.UserID, At: time.Now()}
+	go func() {
+		marked, err := mark(clients, marker)
+		if err != nil {
+			refuseMarker(connection, envelope, "unavailable")
+			return
+		}
+		connection.Send(interfaces.Message{
+			Type:   "marker",
+			UserID: envelope.UserID,
+			Data:   gin.H{"title": title, "kind": marker.Kind, "recordings": marked},
+		})
+	}()
+}
+
+// markScreen marks the start of a screen share in the running recordings.
+func markScreen(clients *interfaces.Room, userID string) {
+	title := "Screen share"
+	if participant, ok := clients.Participant(userID); ok && participant.Name != "" {
+		title = participant.Name + " is sharing their screen"
+	}
+	mark(clients, interfaces.RecordingMarker{Kind: interfaces.MarkerScreenShare, Title: title, UserID: userID, At: time.Now()})
+}
+
+// mark adds the marker to the session's running recordings and to its
+// timeline, so markers dropped while nothing records are not lost.
+func mark(clients *interfaces.Room, marker interfaces.RecordingMarker) (int64, error) {
+	recordEvent(clients, analytics.EventMarker, marker.UserID, map[string]interface{}{"kind": marker.Kind, "title": marker.Title})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	marked, err := markers.Add(ctx, clients.Session, marker)
+	if err != nil {
+		log.Printf("Error marking the recordings of %s: %s", clients.Session, err)
+	}
+	return marked, err
+}
+
+func refuseMarker(connection *interfaces.Connection, envelope interfaces.Envelope, reason string) {
+	connection.Send(interfaces.Message{
+		Type:   "error",
+		UserID: envelope.UserID,
+		Text:   "marker_refused",
+		Data:   gin.H{"reason": reason},
+	})
+}
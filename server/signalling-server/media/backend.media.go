@@ -0,0 +1,86 @@
+package media
+
+import (
+	"context"
+	"fmt"
+)
+
+// Room describes where the media for a session is hosted. Backend is one of
+// "builtin", "livekit" or "jitsi"; URL and Token are empty for the built-in
+// backend, whose media is negotiated over the signalling socket.
+type Room struct {
+	Backend string `json:"backend"`
+	Name    string `json:"room"`
+	URL     string `json:"url,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// Backend provisions rooms on a media server and issues join credentials for
+// them, so the session API stays the same regardless of the deployment.
+type Backend interface {
+	Name() string
+	CreateRoom(ctx context.Context, name string) (Room, error)
+	JoinRoom(ctx context.Context, name string, identity string, displayName string) (Room, error)
+	DeleteRoom(ctx context.Context, name string) error
+}
+
+type Config struct {
+	Backend string
+
+	LiveKitURL            string
+	LiveKitAPIKey         string
+	LiveKitAPISecret      string
+	LiveKitEgressTemplate string
+	LiveKitRecordingPath  string
+	LiveKitSIPTrunk       string
+
+	JitsiDomain    string
+	JitsiAppID     string
+	JitsiAppSecret string
+}
+
+// NewBackend selects the media backend named in the config.
+func NewBackend(config Config) (Backend, error) {
+	switch config.Backend {
+	case "", "builtin":
+		return &Builtin{}, nil
+	case "livekit":
+		if config.LiveKitURL == "" || config.LiveKitAPIKey == "" || config.LiveKitAPISecret == "" {
+			return nil, fmt.Errorf("livekit backend requires url, api key and api secret")
+		}
+		livekit := NewLiveKit(config.LiveKitURL, config.LiveKitAPIKey, config.LiveKitAPISecret)
+		livekit.EgressTemplate = config.LiveKitEgressTemplate
+		livekit.SIPTrunk = config.LiveKitSIPTrunk
+		if config.LiveKitRecordingPath != "" {
+			livekit.RecordingPath = config.LiveKitRecordingPath
+		}
+		return livekit, nil
+	case "jitsi":
+		if config.JitsiDomain == "" {
+			return nil, fmt.Errorf("jitsi backend requires a domain")
+		}
+		return NewJitsi(config.JitsiDomain, config.JitsiAppID, config.JitsiAppSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", config.Backend)
+	}
+}
+
+// Builtin keeps media on the peers themselves; the signalling socket carries
+// the offers, answers and candidates.
+type Builtin struct{}
+
+func (b *Builtin) Name() string {
+	return "builtin"
+}
+
+func (b *Builtin) CreateRoom(ctx context.Context, name string) (Room, error) {
+	return Room{Backend: b.Name(), Name: name}, nil
+}
+
+func (b *Builtin) JoinRoom(ctx context.Context, name string, identity string, displayName string) (Room, error) {
+	return Room{Backend: b.Name(), Name: name}, nil
+}
+
+func (b *Builtin) DeleteRoom(ctx context.Context, name string) error {
+	return nil
+}
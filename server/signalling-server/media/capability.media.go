@@ -0,0 +1,62 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capabilities a media node can advertise, beyond forwarding media.
+const (
+	CapabilityRecording     = "recording"
+	CapabilityTranscription = "transcription"
+)
+
+// KnownCapability reports whether rooms may require capability. Echo
+// tests, not rooms, require CapabilityEcho.
+func KnownCapability(capability string) bool {
+	return capability == CapabilityRecording || capability == CapabilityTranscription
+}
+
+// Has reports whether the node has every capability in required. A node
+// that advertises no capabilities is taken to have them all, so fleets
+// that do not advertise them place rooms as before.
+func (n SFUNode) Has(required []string) bool {
+	if n.Capabilities == nil {
+		return true
+	}
+	for _, capability := range required {
+		found := false
+		for _, has := range n.Capabilities {
+			found = found || has == capability
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseCapabilities reads what a node can do from its service meta:
+// capabilities, a comma separated list (set but empty for none), and
+// max_participants.
+func ParseCapabilities(meta map[string]string) ([]string, int, error) {
+	var capabilities []string
+	if value, ok := meta["capabilities"]; ok {
+		capabilities = []string{}
+		for _, capability := range strings.Split(value, ",") {
+			if capability = strings.TrimSpace(capability); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+
+	capacity := 0
+	if value := meta["max_participants"]; value != "" {
+		var err error
+		if capacity, err = strconv.Atoi(value); err != nil || capacity < 0 {
+			return capabilities, 0, fmt.Errorf("invalid max_participants %q", value)
+		}
+	}
+	return capabilities, capacity, nil
+}
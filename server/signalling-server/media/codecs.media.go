@@ -0,0 +1,172 @@
+package media
+
+import (
+	"strings"
+)
+
+// Codecs known to the codec policy, by media kind. Names are matched
+// case-insensitively against SDP rtpmap encoding names.
+var (
+	VideoCodecs = []string{"VP8", "VP9", "H264", "AV1", "H265"}
+	AudioCodecs = []string{"opus", "G722", "PCMU", "PCMA", "ISAC", "ILBC"}
+)
+
+// auxiliary payloads carry no media of their own and are kept unless what
+// they protect is removed.
+var auxiliary = map[string]bool{"RTX": true, "RED": true, "ULPFEC": true, "FLEXFEC-03": true, "TELEPHONE-EVENT": true, "CN": true}
+
+// ParseCodecs splits a comma separated list of codec names.
+func ParseCodecs(list string) []string {
+	var codecs []string
+	for _, codec := range strings.Split(list, ",") {
+		if codec = strings.TrimSpace(codec); codec != "" {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+// KnownCodec reports whether name is a codec the policy can allow.
+func KnownCodec(name string) bool {
+	for _, codec := range append(append([]string{}, VideoCodecs...), AudioCodecs...) {
+		if strings.EqualFold(codec, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterCodecs rewrites an SDP offer or answer so its audio and video
+// sections only carry allowed codecs, preferred ones first. An empty
+// allowed list allows every codec of the kind; so does a list naming no
+// codec of that kind. A section that would be left without any codec is
+// kept as it was rather than failing negotiation.
+func FilterCodecs(sdp string, allowed, preferred []string) string {
+	if len(allowed) == 0 && len(preferred) == 0 {
+		return sdp
+	}
+	newline := "\r\n"
+	if !strings.Contains(sdp, newline) {
+		newline = "\n"
+	}
+	lines := strings.Split(sdp, newline)
+
+	out := make([]string, 0, len(lines))
+	start := 0
+	for i := 1; i <= len(lines); i++ {
+		if i < len(lines) && !strings.HasPrefix(lines[i], "m=") {
+			continue
+		}
+		section := lines[start:i]
+		if strings.HasPrefix(section[0], "m=") {
+			section = filterSection(section, allowed, preferred)
+		}
+		out = append(out, section...)
+		start = i
+	}
+	return strings.Join(out, newline)
+}
+
+func filterSection(section []string, allowed, preferred []string) []string {
+	fields := strings.Fields(section[0])
+	if len(fields) < 4 {
+		return section
+	}
+	var kind []string
+	switch fields[0] {
+	case "m=audio":
+		kind = AudioCodecs
+	case "m=video":
+		kind = VideoCodecs
+	default:
+		return section
+	}
+
+	permitted := make(map[string]bool)
+	for _, name := range allowed {
+		for _, codec := range kind {
+			if strings.EqualFold(codec, name) {
+				permitted[strings.ToUpper(codec)] = true
+			}
+		}
+	}
+
+	codecs := make(map[string]string) // payload type -> upper-cased encoding name
+	protects := make(map[string]string)
+	for _, line := range section {
+		if pt, ok := rtpmapPayload(line); ok {
+			if mapping := strings.Fields(line); len(mapping) > 1 {
+				name, _, _ := strings.Cut(mapping[1], "/")
+				codecs[pt] = strings.ToUpper(name)
+			}
+		}
+		if pt, ok := fmtpPayload(line); ok {
+			for _, param := range strings.Split(strings.TrimPrefix(line, "a=fmtp:"+pt+" "), ";") {
+				if apt, found := strings.CutPrefix(strings.TrimSpace(param), "apt="); found {
+					protects[pt] = apt
+				}
+			}
+		}
+	}
+
+	removed := make(map[string]bool)
+	primary := 0
+	for pt, name := range codecs {
+		if auxiliary[name] {
+			continue
+		}
+		if len(permitted) > 0 && !permitted[name] {
+			removed[pt] = true
+		} else {
+			primary++
+		}
+	}
+	if primary == 0 {
+		return section
+	}
+	for pt, apt := range protects {
+		if removed[apt] {
+			removed[pt] = true
+		}
+	}
+
+	// Retransmission payloads rank with the codec they protect.
+	rank := func(pt string) int {
+		if apt, ok := protects[pt]; ok {
+			pt = apt
+		}
+		for i, name := range preferred {
+			if strings.EqualFold(name, codecs[pt]) {
+				return i
+			}
+		}
+		return len(preferred)
+	}
+	var formats []string
+	for _, pt := range fields[3:] {
+		if !removed[pt] {
+			formats = append(formats, pt)
+		}
+	}
+	// Stable insertion sort keeps the offerer's order among equals.
+	for i := 1; i < len(formats); i++ {
+		for j := i; j > 0 && rank(formats[j]) < rank(formats[j-1]); j-- {
+			formats[j], formats[j-1] = formats[j-1], formats[j]
+		}
+	}
+
+	filtered := []string{strings.Join(append(fields[:3:3], formats...), " ")}
+	for _, line := range section[1:] {
+		if pt, ok := attributePayload(line, "a=rtpmap:"); ok && removed[pt] {
+			continue
+		}
+		if pt, ok := attributePayload(line, "a=fmtp:"); ok && removed[pt] {
+			continue
+		}
+		if pt, ok := attributePayload(line, "a=rtcp-fb:"); ok && removed[pt] {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	return filtered
+}
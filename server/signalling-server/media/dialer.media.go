@@ -0,0 +1,18 @@
+package media
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoTrunk is returned by Dial when no outbound SIP trunk is configured.
+var ErrNoTrunk = errors.New("no outbound sip trunk configured")
+
+// Dialer is implemented by backends that can bridge phone calls into a
+// room's audio through a SIP gateway. The phone participant joins the room
+// under identity once the call is answered.
+type Dialer interface {
+	Dial(ctx context.Context, room, number, identity, displayName string) error
+	MutePhone(ctx context.Context, room, identity string, muted bool) error
+	Hangup(ctx context.Context, room, identity string) error
+}
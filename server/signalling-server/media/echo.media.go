@@ -0,0 +1,95 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// CapabilityEcho is advertised by nodes that can send a participant's media
+// straight back to them, for echo tests.
+const CapabilityEcho = "echo"
+
+// EchoNode picks a node that runs echo tests for room, in region or else in
+// the nearest region that has one.
+func (t *Topology) EchoNode(room, region string) (SFUNode, bool) {
+	regions := []string{region}
+	for _, node := range t.Nearest(nil, region) {
+		regions = append(regions, node.Region)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, region := range regions {
+		if node, ok := t.pick(room, region, []string{CapabilityEcho}); ok {
+			return node, true
+		}
+	}
+	return SFUNode{}, false
+}
+
+// Echo asks node to start or stop sending identity's media in room back to
+// them, through its POST /echo endpoint.
+func (t *Topology) Echo(ctx context.Context, node SFUNode, room, identity string, enable bool) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"room":     room,
+		"identity": identity,
+		"enabled":  enable,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node.URL+"/echo", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("echo: %s", resp.Status)
+	}
+	return nil
+}
+
+// EchoStats asks node what it measured of the media it echoed in room, from
+// its GET /echo endpoint.
+func (t *Topology) EchoStats(ctx context.Context, node SFUNode, room string) (interfaces.EchoStats, error) {
+	var stats interfaces.EchoStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.URL+"/echo?room="+url.QueryEscape(room), nil)
+	if err != nil {
+		return stats, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("echo stats: %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+// EndEchoTest reads what the test's node measured and has it stop echoing.
+// The stats are nil when the node could not tell.
+func (t *Topology) EndEchoTest(ctx context.Context, test interfaces.EchoTest) *interfaces.EchoStats {
+	node := SFUNode{ID: test.NodeID, Region: test.Region, URL: test.NodeURL}
+	var result *interfaces.EchoStats
+	if stats, err := t.EchoStats(ctx, node, test.Room); err == nil {
+		result = &stats
+	} else {
+		log.Printf("Error reading stats of echo test %s from %s: %s", test.ID, node.ID, err)
+	}
+	if err := t.Echo(ctx, node, test.Room, test.Identity, false); err != nil {
+		log.Printf("Error stopping echo test %s on %s: %s", test.ID, node.ID, err)
+	}
+	return result
+}
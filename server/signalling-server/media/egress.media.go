@@ -0,0 +1,49 @@
+package media
+
+import (
+	"context"
+	"strings"
+)
+
+// Overlay is a text watermark burned into composited output.
+type Overlay struct {
+	Text     string  `json:"text" bson:"text"`
+	Opacity  float64 `json:"opacity" bson:"opacity"`
+	Position string  `json:"position" bson:"position"`
+}
+
+// RecordingOptions controls an egress. Streams are RTMP URLs to publish to
+// live; without any the room is recorded to a file. Layout is the room's
+// layout, if a host set one.
+type RecordingOptions struct {
+	Watermark *Overlay
+	Streams   []string
+	Layout    *Layout
+}
+
+// Recording is a running egress.
+type Recording struct {
+	ID       string `json:"id"`
+	Backend  string `json:"backend"`
+	Location string `json:"location,omitempty"`
+}
+
+// Recorder is implemented by backends that can composite a room into a
+// recording or live stream.
+type Recorder interface {
+	StartRecording(ctx context.Context, room string, options RecordingOptions) (Recording, error)
+	StopRecording(ctx context.Context, id string) error
+}
+
+// ScreenRecorder is implemented by backends that can record a participant's
+// screen share on its own, next to the composite. The egress it starts is
+// stopped with Recorder.StopRecording.
+type ScreenRecorder interface {
+	StartScreenRecording(ctx context.Context, room, identity string) (Recording, error)
+}
+
+// RenderWatermark fills the {name}, {email} and {session} placeholders of a
+// watermark template.
+func RenderWatermark(template, name, email, session string) string {
+	return strings.NewReplacer("{name}", name, "{email}", email, "{session}", session).Replace(template)
+}
@@ -0,0 +1,200 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// ICEServer is an entry of RTCConfiguration.iceServers.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICE hands clients the STUN and TURN servers to use. TURN credentials
+// follow the TURN REST API convention coturn implements with
+// use-auth-secret: the username is "<expiry>:<user>" and the password its
+// HMAC-SHA1 under the shared secret, so nothing has to be provisioned per
+// user.
+type ICE struct {
+	STUN       []string
+	TURN       []string
+	TURNSecret string
+	TTL        time.Duration
+	// Secrets, when set, rotates the shared secret and replaces TURNSecret;
+	// see turn.Secrets.
+	Secrets interface{ Current() string }
+
+	// Family drops servers given by an IP literal of a disabled IP version.
+	// Servers given by hostname are resolved by the client as usual.
+	Family utils.IPFamily
+}
+
+// ParseURLs splits a comma separated list of ICE server URLs.
+func ParseURLs(list string) []string {
+	var urls []string
+	for _, url := range strings.Split(list, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// Servers returns the ICE servers for user, with TURN credentials valid for
+// the configured TTL.
+func (i *ICE) Servers(user string) []ICEServer {
+	servers := []ICEServer{}
+	if stun := i.filter(i.STUN); len(stun) > 0 {
+		servers = append(servers, ICEServer{URLs: stun})
+	}
+	return append(servers, i.RelayServers(user)...)
+}
+
+// RelayServers returns the TURN servers only, for clients that must not
+// reveal their own addresses; it is empty without TURN.
+func (i *ICE) RelayServers(user string) []ICEServer {
+	servers := []ICEServer{}
+	if urls, secret := i.filter(i.TURN), i.secret(); len(urls) > 0 && secret != "" {
+		username := strconv.FormatInt(time.Now().Add(i.TTL).Unix(), 10) + ":" + user
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write([]byte(username))
+		servers = append(servers, ICEServer{
+			URLs:       urls,
+			Username:   username,
+			Credential: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		})
+	}
+	return servers
+}
+
+func (i *ICE) secret() string {
+	if i.Secrets != nil {
+		return i.Secrets.Current()
+	}
+	return i.TURNSecret
+}
+
+func (i *ICE) filter(urls []string) []string {
+	var allowed []string
+	for _, url := range urls {
+		if i.Family.Allows(urlIP(url)) {
+			allowed = append(allowed, url)
+		}
+	}
+	return allowed
+}
+
+// CandidateIP returns the connection address of an ICE candidate line
+// ("candidate:<foundation> <component> <transport> <priority> <address> ..."),
+// or nil when it is a hostname such as an mDNS .local name.
+func CandidateIP(candidate string) net.IP {
+	fields := strings.Fields(strings.TrimPrefix(candidate, "a="))
+	if len(fields) < 5 || !strings.HasPrefix(fields[0], "candidate:") {
+		return nil
+	}
+	return net.ParseIP(fields[4])
+}
+
+// CandidateType returns the type of an ICE candidate line, e.g. "host",
+// "srflx" or "relay", or "" when the line has none.
+func CandidateType(candidate string) string {
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "typ" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// HideRelatedAddress blanks the raddr and rport of a candidate line. On a
+// relayed candidate they are the address the TURN server saw the peer
+// connect from, which the other peer has no use for.
+func HideRelatedAddress(candidate string) string {
+	fields := strings.Fields(candidate)
+	changed := false
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "raddr":
+			fields[i+1], changed = "0.0.0.0", true
+		case "rport":
+			fields[i+1], changed = "0", true
+		}
+	}
+	if !changed {
+		return candidate
+	}
+	return strings.Join(fields, " ")
+}
+
+// RelayCandidates removes every candidate but relayed ones from an SDP
+// offer or answer, hiding their related addresses, and blanks the default
+// addresses in its c= and a=rtcp lines, which ICE ignores, so it reveals no
+// address of the peer that wrote it.
+func RelayCandidates(sdp string) string {
+	newline := "\r\n"
+	if !strings.Contains(sdp, newline) {
+		newline = "\n"
+	}
+	lines := strings.Split(sdp, newline)
+	kept := lines[:0]
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "a=candidate:"):
+			if CandidateType(line) != "relay" {
+				continue
+			}
+			line = HideRelatedAddress(line)
+		case strings.HasPrefix(line, "c="), strings.HasPrefix(line, "a=rtcp:"):
+			line = blankAddress(line)
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, newline)
+}
+
+// blankAddress replaces the address after "IN IP4" or "IN IP6" in an SDP
+// line with the unspecified address.
+func blankAddress(line string) string {
+	fields := strings.Fields(line)
+	for i := 0; i+2 < len(fields); i++ {
+		if fields[i] != "IN" && fields[i] != "c=IN" {
+			continue
+		}
+		switch fields[i+1] {
+		case "IP4":
+			fields[i+2] = "0.0.0.0"
+		case "IP6":
+			fields[i+2] = "::"
+		default:
+			return line
+		}
+		return strings.Join(fields, " ")
+	}
+	return line
+}
+
+// urlIP returns the IP literal host of an ICE server URL such as
+// "turn:[2001:db8::1]:3478?transport=udp", or nil for a hostname.
+func urlIP(url string) net.IP {
+	_, host, _ := strings.Cut(url, ":")
+	host, _, _ = strings.Cut(host, "?")
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end < 0 {
+			return nil
+		}
+		return net.ParseIP(host[1:end])
+	}
+	host, _, _ = strings.Cut(host, ":")
+	return net.ParseIP(host)
+}
@@ -0,0 +1,72 @@
+package media
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+)
+
+// Jitsi creates rooms lazily on first join, so provisioning only computes the
+// room URL. When an app id and secret are configured, joins are authorised
+// with the JWT format understood by prosody's token auth module.
+type Jitsi struct {
+	domain    string
+	appID     string
+	appSecret string
+}
+
+type jitsiClaims struct {
+	Room    string                 `json:"room"`
+	Context map[string]interface{} `json:"context,omitempty"`
+	jwt_lib.StandardClaims
+}
+
+func NewJitsi(domain, appID, appSecret string) *Jitsi {
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	return &Jitsi{domain: strings.TrimRight(domain, "/"), appID: appID, appSecret: appSecret}
+}
+
+func (j *Jitsi) Name() string {
+	return "jitsi"
+}
+
+func (j *Jitsi) CreateRoom(ctx context.Context, name string) (Room, error) {
+	return Room{Backend: j.Name(), Name: name, URL: j.roomURL(name)}, nil
+}
+
+func (j *Jitsi) JoinRoom(ctx context.Context, name string, identity string, displayName string) (Room, error) {
+	room := Room{Backend: j.Name(), Name: name, URL: j.roomURL(name)}
+	if j.appID == "" || j.appSecret == "" {
+		return room, nil
+	}
+
+	claims := jitsiClaims{
+		name,
+		map[string]interface{}{
+			"user": map[string]string{"id": identity, "name": displayName},
+		},
+		jwt_lib.StandardClaims{
+			Audience:  "jitsi",
+			Issuer:    j.appID,
+			Subject:   j.domain,
+			ExpiresAt: time.Now().Add(6 * time.Hour).Unix(),
+		},
+	}
+
+	token, err := jwt_lib.NewWithClaims(jwt_lib.SigningMethodHS256, claims).SignedString([]byte(j.appSecret))
+	if err != nil {
+		return Room{}, err
+	}
+	room.Token = token
+	return room, nil
+}
+
+func (j *Jitsi) DeleteRoom(ctx context.Context, name string) error {
+	return nil
+}
+
+func (j *Jitsi) roomURL(name string) string {
+	return "https://" + j.domain + "/" + name
+}
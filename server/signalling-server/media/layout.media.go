@@ -0,0 +1,18 @@
+package media
+
+import "context"
+
+// Layout is a composite layout in terms of the backend's identities.
+type Layout struct {
+	// Mode is "grid", "speaker" or "spotlight".
+	Mode   string   `json:"mode"`
+	Pinned []string `json:"pinned,omitempty"`
+	Order  []string `json:"order,omitempty"`
+}
+
+// Compositor is implemented by recorders whose composite layout can follow
+// the room's while recording. recordings are the IDs of the room's running
+// recordings.
+type Compositor interface {
+	SetLayout(ctx context.Context, room string, recordings []string, layout Layout) error
+}
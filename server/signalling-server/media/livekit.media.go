@@ -0,0 +1,373 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	jwt_lib "github.com/dgrijalva/jwt-go"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// LiveKit provisions rooms through the LiveKit RoomService Twirp API and
+// records them through its Egress service.
+type LiveKit struct {
+	url       string
+	apiKey    string
+	apiSecret string
+	client    *http.Client
+
+	// EgressTemplate is the base URL of the composite layout page. Watermark
+	// settings are passed to it as query parameters.
+	EgressTemplate string
+
+	// RecordingPath is the egress file path, e.g. "recordings/{room_name}-{time}.mp4".
+	RecordingPath string
+
+	// ScreenRecordingPath is the file path of screen share recordings.
+	ScreenRecordingPath string
+
+	// SIPTrunk is the ID of the outbound SIP trunk phone numbers are dialed
+	// through. Dial-out is disabled without one.
+	SIPTrunk string
+}
+
+type liveKitVideoGrant struct {
+	RoomCreate bool   `json:"roomCreate,omitempty"`
+	RoomAdmin  bool   `json:"roomAdmin,omitempty"`
+	RoomJoin   bool   `json:"roomJoin,omitempty"`
+	RoomRecord bool   `json:"roomRecord,omitempty"`
+	Room       string `json:"room,omitempty"`
+}
+
+type liveKitSIPGrant struct {
+	Admin bool `json:"admin,omitempty"`
+	Call  bool `json:"call,omitempty"`
+}
+
+type liveKitClaims struct {
+	Name  string            `json:"name,omitempty"`
+	Video liveKitVideoGrant `json:"video"`
+	SIP   *liveKitSIPGrant  `json:"sip,omitempty"`
+	jwt_lib.StandardClaims
+}
+
+func NewLiveKit(url, apiKey, apiSecret string) *LiveKit {
+	return &LiveKit{
+		url:       strings.TrimRight(url, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		client:    &http.Client{Timeout: 10 * time.Second},
+
+		RecordingPath:       "recordings/{room_name}-{time}.mp4",
+		ScreenRecordingPath: "recordings/{room_name}-{publisher_identity}-screen-{time}.mp4",
+	}
+}
+
+func (l *LiveKit) Name() string {
+	return "livekit"
+}
+
+func (l *LiveKit) CreateRoom(ctx context.Context, name string) (Room, error) {
+	err := l.call(ctx, "RoomService", "CreateRoom", map[string]interface{}{"name": name, "empty_timeout": 300}, nil)
+	if err != nil {
+		return Room{}, err
+	}
+	return Room{Backend: l.Name(), Name: name, URL: l.wsURL()}, nil
+}
+
+func (l *LiveKit) JoinRoom(ctx context.Context, name string, identity string, displayName string) (Room, error) {
+	token, err := l.token(identity, displayName, liveKitVideoGrant{RoomJoin: true, Room: name}, 6*time.Hour)
+	if err != nil {
+		return Room{}, err
+	}
+	return Room{Backend: l.Name(), Name: name, URL: l.wsURL(), Token: token}, nil
+}
+
+func (l *LiveKit) DeleteRoom(ctx context.Context, name string) error {
+	return l.call(ctx, "RoomService", "DeleteRoom", map[string]interface{}{"room": name}, nil)
+}
+
+// StartRecording starts a room composite egress. A watermark is rendered by
+// the layout page at EgressTemplate, so it ends up in every frame of the
+// recording or stream.
+func (l *LiveKit) StartRecording(ctx context.Context, room string, options RecordingOptions) (Recording, error) {
+	request := map[string]interface{}{
+		"room_name": room,
+		"layout":    "grid",
+	}
+	if options.Layout != nil {
+		request["layout"] = liveKitLayout(options.Layout.Mode)
+	}
+
+	if options.Watermark != nil {
+		if l.EgressTemplate == "" {
+			return Recording{}, fmt.Errorf("livekit watermarks require an egress template url")
+		}
+		query := url.Values{}
+		query.Set("watermark", options.Watermark.Text)
+		query.Set("opacity", strconv.FormatFloat(options.Watermark.Opacity, 'f', -1, 64))
+		query.Set("position", options.Watermark.Position)
+		request["custom_base_url"] = l.EgressTemplate + "?" + query.Encode()
+	}
+
+	if len(options.Streams) > 0 {
+		request["stream_outputs"] = []map[string]interface{}{{"protocol": "RTMP", "urls": options.Streams}}
+	} else {
+		request["file_outputs"] = []map[string]interface{}{{"file_type": "MP4", "filepath": l.RecordingPath}}
+	}
+
+	var info struct {
+		EgressID string `json:"egress_id"`
+		File     struct {
+			Filename string `json:"filename"`
+		} `json:"file"`
+	}
+	if err := l.call(ctx, "Egress", "StartRoomCompositeEgress", request, &info); err != nil {
+		return Recording{}, err
+	}
+	return Recording{ID: info.EgressID, Backend: l.Name(), Location: info.File.Filename}, nil
+}
+
+// StartScreenRecording records the participant's screen share, with its
+// audio, through a participant egress at 1080p, whatever the composite's
+// resolution.
+func (l *LiveKit) StartScreenRecording(ctx context.Context, room, identity string) (Recording, error) {
+	request := map[string]interface{}{
+		"room_name":    room,
+		"identity":     identity,
+		"screen_share": true,
+		"preset":       "H264_1080P_30",
+		"file_outputs": []map[string]interface{}{{"file_type": "MP4", "filepath": l.ScreenRecordingPath}},
+	}
+	var info struct {
+		EgressID string `json:"egress_id"`
+		File     struct {
+			Filename string `json:"filename"`
+		} `json:"file"`
+	}
+	if err := l.call(ctx, "Egress", "StartParticipantEgress", request, &info); err != nil {
+		return Recording{}, err
+	}
+	return Recording{ID: info.EgressID, Backend: l.Name(), Location: info.File.Filename}, nil
+}
+
+func (l *LiveKit) StopRecording(ctx context.Context, id string) error {
+	return l.call(ctx, "Egress", "StopEgress", map[string]interface{}{"egress_id": id}, nil)
+}
+
+// liveKitLayout maps a layout mode to the egress layout closest to it.
+func liveKitLayout(mode string) string {
+	switch mode {
+	case "speaker":
+		return "speaker"
+	case "spotlight":
+		return "single-speaker"
+	}
+	return "grid"
+}
+
+// SetLayout switches the room's running egresses to the layout, and puts
+// the whole layout, pins and tile order included, in the room's metadata
+// for a custom layout page at EgressTemplate to follow.
+func (l *LiveKit) SetLayout(ctx context.Context, room string, recordings []string, layout Layout) error {
+	metadata, err := json.Marshal(map[string]interface{}{"layout": layout})
+	if err != nil {
+		return err
+	}
+	failed := l.call(ctx, "RoomService", "UpdateRoomMetadata", map[string]interface{}{"room": room, "metadata": string(metadata)}, nil)
+	for _, id := range recordings {
+		err := l.call(ctx, "Egress", "UpdateLayout", map[string]interface{}{"egress_id": id, "layout": liveKitLayout(layout.Mode)}, nil)
+		if err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// Dial places an outbound call through the SIP service. It returns once the
+// call is placed; the participant appears in the room when it is answered.
+func (l *LiveKit) Dial(ctx context.Context, room, number, identity, displayName string) error {
+	if l.SIPTrunk == "" {
+		return ErrNoTrunk
+	}
+	return l.call(ctx, "SIP", "CreateSIPParticipant", map[string]interface{}{
+		"sip_trunk_id":         l.SIPTrunk,
+		"sip_call_to":          number,
+		"room_name":            room,
+		"participant_identity": identity,
+		"participant_name":     displayName,
+		"hide_phone_number":    true,
+	}, nil)
+}
+
+// MutePhone stops the phone participant from publishing audio, or lets it
+// again.
+func (l *LiveKit) MutePhone(ctx context.Context, room, identity string, muted bool) error {
+	return l.call(ctx, "RoomService", "UpdateParticipant", map[string]interface{}{
+		"room":       room,
+		"identity":   identity,
+		"permission": map[string]interface{}{"can_publish": !muted, "can_subscribe": true},
+	}, nil)
+}
+
+// Hangup removes the phone participant, which ends the call.
+func (l *LiveKit) Hangup(ctx context.Context, room, identity string) error {
+	return l.call(ctx, "RoomService", "RemoveParticipant", map[string]interface{}{"room": room, "identity": identity}, nil)
+}
+
+// SetVideo limits the participants to publishing their microphone and
+// screen, or lifts the limit. Participants that have not reached the media
+// server yet are skipped.
+func (l *LiveKit) SetVideo(ctx context.Context, room string, identities []string, allowed bool) error {
+	sources := []string{}
+	if !allowed {
+		sources = []string{"MICROPHONE", "SCREEN_SHARE", "SCREEN_SHARE_AUDIO"}
+	}
+
+	var failed error
+	for _, identity := range identities {
+		err := l.call(ctx, "RoomService", "UpdateParticipant", map[string]interface{}{
+			"room":     room,
+			"identity": identity,
+			"permission": map[string]interface{}{
+				"can_publish":         true,
+				"can_subscribe":       true,
+				"can_publish_data":    true,
+				"can_publish_sources": sources,
+			},
+		}, nil)
+		if err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// SetPublish lets the participant publish, or stops them from publishing
+// anything while still receiving the room.
+func (l *LiveKit) SetPublish(ctx context.Context, room, identity string, allowed bool) error {
+	return l.call(ctx, "RoomService", "UpdateParticipant", map[string]interface{}{
+		"room":     room,
+		"identity": identity,
+		"permission": map[string]interface{}{
+			"can_publish":      allowed,
+			"can_subscribe":    true,
+			"can_publish_data": true,
+		},
+	}, nil)
+}
+
+// SetSubscriptions subscribes identity to the publishers' video tracks, or
+// unsubscribes it. Publishers without video tracks are skipped.
+func (l *LiveKit) SetSubscriptions(ctx context.Context, room, identity string, publishers []string, subscribe bool) error {
+	var listing struct {
+		Participants []struct {
+			Identity string `json:"identity"`
+			Tracks   []struct {
+				SID  string `json:"sid"`
+				Type string `json:"type"`
+			} `json:"tracks"`
+		} `json:"participants"`
+	}
+	if err := l.call(ctx, "RoomService", "ListParticipants", map[string]interface{}{"room": room}, &listing); err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(publishers))
+	for _, publisher := range publishers {
+		wanted[publisher] = true
+	}
+	var tracks []string
+	for _, participant := range listing.Participants {
+		if !wanted[participant.Identity] {
+			continue
+		}
+		for _, track := range participant.Tracks {
+			if track.Type == "VIDEO" {
+				tracks = append(tracks, track.SID)
+			}
+		}
+	}
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	return l.call(ctx, "RoomService", "UpdateSubscriptions", map[string]interface{}{
+		"room":       room,
+		"identity":   identity,
+		"track_sids": tracks,
+		"subscribe":  subscribe,
+	}, nil)
+}
+
+func (l *LiveKit) wsURL() string {
+	return strings.Replace(strings.Replace(l.url, "https://", "wss://", 1), "http://", "ws://", 1)
+}
+
+func (l *LiveKit) token(identity, displayName string, grant liveKitVideoGrant, ttl time.Duration) (string, error) {
+	return l.sign(l.claims(identity, displayName, grant, ttl))
+}
+
+func (l *LiveKit) claims(identity, displayName string, grant liveKitVideoGrant, ttl time.Duration) liveKitClaims {
+	return liveKitClaims{
+		Name:  displayName,
+		Video: grant,
+		StandardClaims: jwt_lib.StandardClaims{
+			Issuer:    l.apiKey,
+			Subject:   identity,
+			NotBefore: time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+}
+
+func (l *LiveKit) sign(claims liveKitClaims) (string, error) {
+	token := jwt_lib.NewWithClaims(jwt_lib.SigningMethodHS256, claims)
+	return token.SignedString([]byte(l.apiSecret))
+}
+
+func (l *LiveKit) call(ctx context.Context, service, method string, body, out interface{}) error {
+	claims := l.claims("", "", liveKitVideoGrant{RoomCreate: true, RoomAdmin: true, RoomRecord: true}, time.Minute)
+	if service == "SIP" {
+		claims.SIP = &liveKitSIPGrant{Admin: true, Call: true}
+	}
+	token, err := l.sign(claims)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url+"/twirp/livekit."+service+"/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	utils.PropagateRequestID(req)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("livekit %s: %s", method, resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
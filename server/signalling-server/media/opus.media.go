@@ -0,0 +1,145 @@
+package media
+
+import (
+	"strings"
+)
+
+// OpusOptions turns on Opus resilience features in negotiated audio. False
+// leaves a feature as the peers negotiate it.
+type OpusOptions struct {
+	// FEC has the encoder carry in-band forward error correction.
+	FEC bool
+	// DTX stops sending during silence.
+	DTX bool
+	// RED prefers redundant audio encoding (RFC 2198) where the peers
+	// offered it.
+	RED bool
+}
+
+func (o OpusOptions) Enabled() bool {
+	return o.FEC || o.DTX || o.RED
+}
+
+// MungeOpus rewrites an SDP offer or answer to apply the options to its
+// Opus payloads. SDP without Opus is returned unchanged.
+func MungeOpus(sdp string, options OpusOptions) string {
+	if !options.Enabled() {
+		return sdp
+	}
+	newline := "\r\n"
+	if !strings.Contains(sdp, newline) {
+		newline = "\n"
+	}
+	lines := strings.Split(sdp, newline)
+
+	opus := payloadTypes(lines, "opus/48000")
+	red := payloadTypes(lines, "red/48000")
+	if len(opus) == 0 {
+		return sdp
+	}
+
+	var params []string
+	if options.FEC {
+		params = append(params, "useinbandfec=1")
+	}
+	if options.DTX {
+		params = append(params, "usedtx=1")
+	}
+
+	out := make([]string, 0, len(lines)+len(opus))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "m=audio ") && options.RED && len(red) > 0 {
+			line = preferPayloads(line, red)
+		}
+		if pt, ok := fmtpPayload(line); ok && opus[pt] && len(params) > 0 {
+			line = setFmtp(line, params)
+			delete(opus, pt)
+		}
+		out = append(out, line)
+
+		// Opus payloads without an fmtp line get one after their rtpmap.
+		if pt, ok := rtpmapPayload(line); ok && opus[pt] && len(params) > 0 && !hasFmtp(lines, pt) {
+			out = append(out, "a=fmtp:"+pt+" "+strings.Join(params, ";"))
+			delete(opus, pt)
+		}
+	}
+	return strings.Join(out, newline)
+}
+
+// payloadTypes returns the payload types mapped to codec, e.g. "opus/48000".
+func payloadTypes(lines []string, codec string) map[string]bool {
+	types := make(map[string]bool)
+	for _, line := range lines {
+		if pt, ok := rtpmapPayload(line); ok {
+			if mapping := strings.Fields(line); len(mapping) > 1 && strings.HasPrefix(strings.ToLower(mapping[1]), codec) {
+				types[pt] = true
+			}
+		}
+	}
+	return types
+}
+
+func rtpmapPayload(line string) (string, bool) {
+	return attributePayload(line, "a=rtpmap:")
+}
+
+func fmtpPayload(line string) (string, bool) {
+	return attributePayload(line, "a=fmtp:")
+}
+
+func attributePayload(line, prefix string) (string, bool) {
+	if !strings.HasPrefix(line, prefix) {
+		return "", false
+	}
+	pt, _, ok := strings.Cut(strings.TrimPrefix(line, prefix), " ")
+	return pt, ok
+}
+
+func hasFmtp(lines []string, pt string) bool {
+	for _, line := range lines {
+		if found, ok := fmtpPayload(line); ok && found == pt {
+			return true
+		}
+	}
+	return false
+}
+
+// setFmtp sets params on an fmtp line, replacing values already there.
+func setFmtp(line string, params []string) string {
+	head, existing, _ := strings.Cut(line, " ")
+	var kept []string
+	for _, param := range strings.Split(existing, ";") {
+		if param = strings.TrimSpace(param); param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		overridden := false
+		for _, set := range params {
+			if strings.HasPrefix(set, name+"=") {
+				overridden = true
+			}
+		}
+		if !overridden {
+			kept = append(kept, param)
+		}
+	}
+	return head + " " + strings.Join(append(kept, params...), ";")
+}
+
+// preferPayloads moves the preferred payload types to the front of an m=
+// line's format list.
+func preferPayloads(line string, preferred map[string]bool) string {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return line
+	}
+	var first, rest []string
+	for _, pt := range fields[3:] {
+		if preferred[pt] {
+			first = append(first, pt)
+		} else {
+			rest = append(rest, pt)
+		}
+	}
+	return strings.Join(append(append(fields[:3:3], first...), rest...), " ")
+}
@@ -0,0 +1,22 @@
+package media
+
+import "context"
+
+// VideoGate is implemented by backends that can stop participants from
+// publishing their camera, to enforce a session's media policy on the
+// server rather than trusting clients to.
+type VideoGate interface {
+	SetVideo(ctx context.Context, room string, identities []string, allowed bool) error
+}
+
+// Stage is implemented by backends that can stop participants from
+// publishing anything, for webinar attendees without the floor.
+type Stage interface {
+	SetPublish(ctx context.Context, room, identity string, allowed bool) error
+}
+
+// Subscriber is implemented by SFU backends that can choose which
+// publishers' video a participant receives.
+type Subscriber interface {
+	SetSubscriptions(ctx context.Context, room, identity string, publishers []string, subscribe bool) error
+}
@@ -0,0 +1,452 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/placement"
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// SFUNode is a media server in a region. URL is its base URL; cascade links
+// are configured through POST <URL>/cascade. STUN, when the node answers
+// STUN binding requests, lets clients check UDP reachability before joining.
+type SFUNode struct {
+	ID        string     `json:"id"`
+	Region    string     `json:"region"`
+	URL       string     `json:"url"`
+	STUN      string     `json:"stun,omitempty"`
+	Transport *Transport `json:"transport,omitempty"`
+	// Capabilities the node advertises, see Has; nil when it advertises
+	// none, as nodes did before capabilities existed.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Capacity is the most participants the node takes, or 0 for no limit.
+	Capacity int `json:"capacity,omitempty"`
+}
+
+// Link relays a room's media once between two regions.
+type Link struct {
+	From SFUNode `json:"from"`
+	To   SFUNode `json:"to"`
+}
+
+// Migration reports that participants of Room placed in Region must move to
+// Node after their SFU was lost.
+type Migration struct {
+	Room   string  `json:"-"`
+	Region string  `json:"region"`
+	Node   SFUNode `json:"sfu"`
+}
+
+type roomTopology struct {
+	origin       string
+	required     []string           // capabilities every node of the room needs
+	nodes        map[string]SFUNode // region -> node serving the room there
+	participants map[string]string  // identity -> region
+}
+
+// Topology places each participant on the SFU in their nearest region and
+// cascades every other region of a room to the room's origin region, so media
+// crosses between two regions at most once.
+type Topology struct {
+	client *http.Client
+
+	// OnMigrate is called for every room region moved to another node, so
+	// the room's participants can be told to restart ICE against it.
+	OnMigrate func(migration Migration)
+
+	mu      sync.RWMutex
+	regions map[string][]SFUNode
+	loads   map[string]placement.Load
+	rooms   map[string]*roomTopology
+}
+
+func NewTopology() *Topology {
+	return &Topology{
+		client:  &http.Client{Timeout: 5 * time.Second},
+		regions: make(map[string][]SFUNode),
+		rooms:   make(map[string]*roomTopology),
+	}
+}
+
+// SetNodes replaces the known SFU nodes. Rooms served by a node that is no
+// longer present are migrated to a healthy one.
+func (t *Topology) SetNodes(nodes []SFUNode) {
+	regions := make(map[string][]SFUNode)
+	healthy := make(map[string]bool)
+	for _, node := range nodes {
+		regions[node.Region] = append(regions[node.Region], node)
+		healthy[node.ID] = true
+	}
+	for _, list := range regions {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+
+	t.mu.Lock()
+	t.regions = regions
+	migrations := t.failover(healthy)
+	t.mu.Unlock()
+
+	for _, migration := range migrations {
+		log.Printf("Migrating room %s in %s to %s", migration.Room, migration.Region, migration.Node.ID)
+		if t.OnMigrate != nil {
+			t.OnMigrate(migration)
+		}
+	}
+}
+
+// failover reassigns every room region whose node is not healthy. A region
+// left without a node the room can use is folded into the nearest remaining
+// choice, the room's origin when possible. Callers must hold t.mu.
+func (t *Topology) failover(healthy map[string]bool) []Migration {
+	var migrations []Migration
+
+	for room, topology := range t.rooms {
+		changed := false
+		for region, node := range topology.nodes {
+			if healthy[node.ID] {
+				continue
+			}
+			delete(topology.nodes, region)
+			changed = true
+
+			target, replacement, _, ok := t.place(room, topology, region)
+			if !ok {
+				log.Printf("No media node left for room %s in %s", room, region)
+				continue
+			}
+			if region == topology.origin {
+				topology.origin = target
+			}
+			for identity, participantRegion := range topology.participants {
+				if participantRegion == region {
+					topology.participants[identity] = target
+				}
+			}
+
+			migrations = append(migrations, Migration{Room: room, Region: region, Node: replacement})
+		}
+
+		if !changed {
+			continue
+		}
+		for region, node := range topology.nodes {
+			if region != topology.origin {
+				go t.cascade(room, Link{From: topology.nodes[topology.origin], To: node}, true)
+			}
+		}
+	}
+
+	return migrations
+}
+
+// place finds the node serving room for participants in region: the node
+// already serving it there, or a new one the room can use. When region has
+// none, the room's origin region is tried, then the other regions in order.
+// It returns the region and node chosen, and whether the node is new to the
+// room. Callers must hold t.mu.
+func (t *Topology) place(room string, topology *roomTopology, region string) (string, SFUNode, bool, bool) {
+	candidates := []string{region, topology.origin}
+	others := make([]string, 0, len(t.regions))
+	for other := range t.regions {
+		others = append(others, other)
+	}
+	sort.Strings(others)
+	candidates = append(candidates, others...)
+
+	for _, candidate := range candidates {
+		if node, ok := topology.nodes[candidate]; ok {
+			return candidate, node, false, true
+		}
+		if node, ok := t.pick(room, candidate, topology.required); ok {
+			topology.nodes[candidate] = node
+			return candidate, node, true, true
+		}
+	}
+	return "", SFUNode{}, false, false
+}
+
+// placed counts the participants on each node. Callers must hold t.mu.
+func (t *Topology) placed() map[string]int {
+	counts := make(map[string]int)
+	for _, topology := range t.rooms {
+		for _, region := range topology.participants {
+			counts[topology.nodes[region].ID]++
+		}
+	}
+	return counts
+}
+
+// SetLoads replaces the load reports of the SFU nodes, by node ID.
+func (t *Topology) SetLoads(loads map[string]placement.Load) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loads = loads
+}
+
+// pick chooses a node for room within region among those with the
+// required capabilities and room for another participant, by hashing the
+// room onto the least loaded of them when they report their load, or else
+// onto all of them. Callers must hold t.mu.
+func (t *Topology) pick(room, region string, required []string) (SFUNode, bool) {
+	counts := t.placed()
+	var nodes []SFUNode
+	for _, node := range t.regions[region] {
+		if node.Has(required) && (node.Capacity == 0 || counts[node.ID] < node.Capacity) {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return SFUNode{}, false
+	}
+
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	if lightest := placement.Lightest(t.loads, ids); len(lightest) > 0 {
+		light := make(map[string]bool, len(lightest))
+		for _, id := range lightest {
+			light[id] = true
+		}
+		var candidates []SFUNode
+		for _, node := range nodes {
+			if light[node.ID] {
+				candidates = append(candidates, node)
+			}
+		}
+		nodes = candidates
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(room))
+	return nodes[int(h.Sum32())%len(nodes)], true
+}
+
+// Regions lists one probe target per region so clients can measure RTT.
+func (t *Topology) Regions() []SFUNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	probes := make([]SFUNode, 0, len(t.regions))
+	for _, nodes := range t.regions {
+		probes = append(probes, nodes[0])
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Region < probes[j].Region })
+	return probes
+}
+
+// SelectRegion picks the region with the lowest measured RTT, falling back
+// to hint (e.g. a GeoIP region) and then to any region with nodes.
+func (t *Topology) SelectRegion(rtts map[string]float64, hint string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	best, bestRTT := "", 0.0
+	for region, rtt := range rtts {
+		if len(t.regions[region]) == 0 {
+			continue
+		}
+		if best == "" || rtt < bestRTT || (rtt == bestRTT && region < best) {
+			best, bestRTT = region, rtt
+		}
+	}
+	if best != "" {
+		return best
+	}
+	if len(t.regions[hint]) > 0 {
+		return hint
+	}
+	for _, node := range t.Regions() {
+		return node.Region
+	}
+	return ""
+}
+
+// Nearest orders one node per region by preference: measured RTT first,
+// then the preferred region, then the remaining regions.
+func (t *Topology) Nearest(rtts map[string]float64, preferred string) []SFUNode {
+	nodes := t.Regions()
+	rank := func(node SFUNode) (int, float64) {
+		if rtt, ok := rtts[node.Region]; ok {
+			return 0, rtt
+		}
+		if node.Region == preferred {
+			return 1, 0
+		}
+		return 2, 0
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		ci, ri := rank(nodes[i])
+		cj, rj := rank(nodes[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return ri < rj
+	})
+	return nodes
+}
+
+// Join places identity in room on a node for region, adding a cascade link
+// when the region is new to the room. The room is only placed on nodes
+// with the required capabilities, fixed when its first participant joins;
+// when region has none, the participant is placed where the room can go.
+func (t *Topology) Join(room, identity, region string, required []string) (SFUNode, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	topology := t.rooms[room]
+	if topology == nil {
+		topology = &roomTopology{
+			origin:       region,
+			required:     required,
+			nodes:        make(map[string]SFUNode),
+			participants: make(map[string]string),
+		}
+	}
+
+	placed, node, fresh, ok := t.place(room, topology, region)
+	if !ok {
+		return SFUNode{}, false
+	}
+	if t.rooms[room] == nil {
+		topology.origin = placed
+		t.rooms[room] = topology
+	} else if fresh && placed != topology.origin {
+		go t.cascade(room, Link{From: topology.nodes[topology.origin], To: node}, true)
+	}
+	topology.participants[identity] = placed
+	return node, true
+}
+
+// Leave removes identity from room, tearing down its region's link once the
+// region has no participants left.
+func (t *Topology) Leave(room, identity string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	topology := t.rooms[room]
+	if topology == nil {
+		return
+	}
+
+	region, ok := topology.participants[identity]
+	if !ok {
+		return
+	}
+	delete(topology.participants, identity)
+
+	if len(topology.participants) == 0 {
+		delete(t.rooms, room)
+		return
+	}
+
+	for _, other := range topology.participants {
+		if other == region {
+			return
+		}
+	}
+	if region != topology.origin {
+		go t.cascade(room, Link{From: topology.nodes[topology.origin], To: topology.nodes[region]}, false)
+		delete(topology.nodes, region)
+	}
+}
+
+// Links returns the cascade links currently configured for room.
+func (t *Topology) Links(room string) []Link {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	topology := t.rooms[room]
+	if topology == nil {
+		return nil
+	}
+
+	links := []Link{}
+	for region, node := range topology.nodes {
+		if region != topology.origin {
+			links = append(links, Link{From: topology.nodes[topology.origin], To: node})
+		}
+	}
+	return links
+}
+
+// cascade asks the downstream node to start or stop relaying room from the
+// upstream node.
+func (t *Topology) cascade(room string, link Link, enable bool) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"room":     room,
+		"upstream": link.From,
+		"enabled":  enable,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, link.To.URL+"/cascade", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Cascade %s %s -> %s: %s", room, link.From.Region, link.To.Region, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		log.Printf("Cascade %s %s -> %s: %s", room, link.From.Region, link.To.Region, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// Watch refreshes the SFU nodes from the healthy Consul instances of
+// serviceName, which carry their region, URL, transport and capabilities in
+// service meta, and their load from the reports under placement.LoadPrefix.
+func (t *Topology) Watch(client *api.Client, serviceName string, interval time.Duration) {
+	for {
+		services, err := utils.HealthyInstances(client, serviceName)
+		if err != nil {
+			log.Printf("Topology: discovering %s: %s", serviceName, err)
+		} else {
+			nodes := make([]SFUNode, 0, len(services))
+			for _, service := range services {
+				if service.Meta["region"] == "" || service.Meta["url"] == "" {
+					continue
+				}
+				transport, err := ParseTransport(service.Meta)
+				if err != nil {
+					log.Printf("Topology: %s advertises %s, ignoring its transport", service.ID, err)
+				}
+				capabilities, capacity, err := ParseCapabilities(service.Meta)
+				if err != nil {
+					log.Printf("Topology: %s advertises %s, ignoring its capacity", service.ID, err)
+				}
+				nodes = append(nodes, SFUNode{
+					ID:           service.ID,
+					Region:       service.Meta["region"],
+					URL:          service.Meta["url"],
+					STUN:         service.Meta["stun"],
+					Transport:    transport,
+					Capabilities: capabilities,
+					Capacity:     capacity,
+				})
+			}
+			t.SetNodes(nodes)
+		}
+		if loads, err := placement.Loads(client); err != nil {
+			log.Printf("Topology: reading loads: %s", err)
+		} else {
+			t.SetLoads(loads)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,80 @@
+package media
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Transport is how clients reach a media node. Firewall-friendly nodes mux
+// every ICE session over one UDP port; others use a port range. TCP and TLS
+// ports offer ICE-TCP fallbacks for networks that block UDP. PublicIP and,
+// on dual-stack nodes, PublicIPv6 are the addresses advertised by nodes
+// behind NAT.
+type Transport struct {
+	PublicIP   string `json:"publicIP,omitempty"`
+	PublicIPv6 string `json:"publicIPv6,omitempty"`
+	UDPPort    int    `json:"udpPort,omitempty"`
+	PortMin    int    `json:"portMin,omitempty"`
+	PortMax    int    `json:"portMax,omitempty"`
+	TCPPort    int    `json:"tcpPort,omitempty"`
+	TLSPort    int    `json:"tlsPort,omitempty"`
+}
+
+// ParseTransport reads a node's transport from its service meta: public_ip,
+// public_ip6, udp_port, port_range ("50000-60000"), tcp_port and tls_port. It returns
+// nil when the node advertises none of them.
+func ParseTransport(meta map[string]string) (*Transport, error) {
+	var transport Transport
+	var err error
+
+	if ip := meta["public_ip"]; ip != "" {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid public_ip %q", ip)
+		}
+		transport.PublicIP = ip
+	}
+	if ip := meta["public_ip6"]; ip != "" {
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() != nil {
+			return nil, fmt.Errorf("invalid public_ip6 %q", ip)
+		}
+		transport.PublicIPv6 = ip
+	}
+	if transport.UDPPort, err = parsePort(meta, "udp_port"); err != nil {
+		return nil, err
+	}
+	if transport.TCPPort, err = parsePort(meta, "tcp_port"); err != nil {
+		return nil, err
+	}
+	if transport.TLSPort, err = parsePort(meta, "tls_port"); err != nil {
+		return nil, err
+	}
+	if ports := meta["port_range"]; ports != "" {
+		min, max, ok := strings.Cut(ports, "-")
+		transport.PortMin, err = strconv.Atoi(strings.TrimSpace(min))
+		if err == nil && ok {
+			transport.PortMax, err = strconv.Atoi(strings.TrimSpace(max))
+		}
+		if err != nil || !ok || transport.PortMin < 1 || transport.PortMax > 65535 || transport.PortMin > transport.PortMax {
+			return nil, fmt.Errorf("invalid port_range %q", ports)
+		}
+	}
+
+	if transport == (Transport{}) {
+		return nil, nil
+	}
+	return &transport, nil
+}
+
+func parsePort(meta map[string]string, key string) (int, error) {
+	value := meta[key]
+	if value == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return port, nil
+}
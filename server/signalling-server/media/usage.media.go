@@ -0,0 +1,62 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ParticipantUsage is what an SFU node relayed for one participant's
+// connection to it. Counters start at zero when the connection does, and
+// ID changes whenever they restart, e.g. when the participant reconnects.
+type ParticipantUsage struct {
+	ID       string `json:"id"`
+	Room     string `json:"room"`
+	Identity string `json:"identity"`
+	// BytesIn is what the node received from the participant, BytesOut what
+	// it forwarded to them.
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+// Nodes lists every SFU node, in every region.
+func (t *Topology) Nodes() []SFUNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var nodes []SFUNode
+	for _, region := range t.regions {
+		nodes = append(nodes, region...)
+	}
+	return nodes
+}
+
+// Usage asks node for the bytes it relayed for each participant connected
+// to it, from its GET /usage endpoint. Nodes without one report nothing.
+func (t *Topology) Usage(ctx context.Context, node SFUNode) ([]ParticipantUsage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.URL+"/usage", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// The node does not account usage.
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("usage: %s", resp.Status)
+	}
+
+	var usage struct {
+		Participants []ParticipantUsage `json:"participants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		return nil, err
+	}
+	return usage.Participants, nil
+}
@@ -0,0 +1,140 @@
+package metering
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Connection is what is kept of a participant's connection to an SFU node
+// in the bandwidth collection. Byte counts are the connection's latest
+// totals.
+type Connection struct {
+	ID        string    `bson:"_id" json:"id"`
+	Node      string    `bson:"node" json:"node"`
+	SessionID string    `bson:"sessionID,omitempty" json:"sessionID,omitempty"`
+	OrgID     string    `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	UserID    string    `bson:"userID" json:"userID"`
+	StartedAt time.Time `bson:"startedAt" json:"startedAt"`
+	SeenAt    time.Time `bson:"seenAt" json:"seenAt"`
+	BytesIn   int64     `bson:"bytesIn" json:"bytesIn"`
+	BytesOut  int64     `bson:"bytesOut" json:"bytesOut"`
+}
+
+// ParticipantBandwidth is a participant's total over a session, across
+// their connections and nodes.
+type ParticipantBandwidth struct {
+	UserID   string `bson:"_id" json:"userID"`
+	BytesIn  int64  `bson:"bytesIn" json:"bytesIn"`
+	BytesOut int64  `bson:"bytesOut" json:"bytesOut"`
+}
+
+// Collector polls the SFU nodes for the bytes they relayed per participant,
+// records them per connection and meters what is new against the org.
+// Each node is polled by the signalling node that owns it on the placement
+// ring, so nothing is metered twice.
+type Collector struct {
+	db       *mongo.Database
+	meter    *Meter
+	topology *media.Topology
+	owns     func(key string) bool
+}
+
+func NewCollector(db *mongo.Client, meter *Meter, topology *media.Topology, owns func(key string) bool) *Collector {
+	return &Collector{db: db.Database("vidchat"), meter: meter, topology: topology, owns: owns}
+}
+
+// Run polls the SFU nodes every interval.
+func (c *Collector) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, node := range c.topology.Nodes() {
+			if !c.owns("sfu/" + node.ID) {
+				continue
+			}
+			if err := c.poll(node); err != nil {
+				log.Printf("Metering: polling %s: %s", node.ID, err)
+			}
+		}
+	}
+}
+
+func (c *Collector) poll(node media.SFUNode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	participants, err := c.topology.Usage(ctx, node)
+	if err != nil {
+		return err
+	}
+	sockets := make(map[string]interfaces.Socket)
+	now := time.Now()
+	for _, participant := range participants {
+		socket, ok := sockets[participant.Room]
+		if !ok {
+			socket = c.socketOf(ctx, participant.Room)
+			sockets[participant.Room] = socket
+		}
+
+		var before Connection
+		err := c.db.Collection("bandwidth").FindOneAndUpdate(ctx,
+			bson.M{"_id": node.ID + "/" + participant.ID},
+			bson.M{
+				"$set": bson.M{"seenAt": now},
+				"$max": bson.M{"bytesIn": participant.BytesIn, "bytesOut": participant.BytesOut},
+				"$setOnInsert": bson.M{
+					"node":      node.ID,
+					"sessionID": socket.SessionID,
+					"orgID":     socket.OrgID,
+					"userID":    participant.Identity,
+					"startedAt": now,
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&before)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		added := max(participant.BytesIn-before.BytesIn, 0) + max(participant.BytesOut-before.BytesOut, 0)
+		if err := c.meter.Add(ctx, socket.OrgID, MediaBytes, added, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// socketOf returns the session of the room, empty when it is unknown.
+func (c *Collector) socketOf(ctx context.Context, room string) interfaces.Socket {
+	var socket interfaces.Socket
+	err := c.db.Collection("sockets").FindOne(ctx, bson.M{"socketUrl": room}).Decode(&socket)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Metering: finding the session of room %s: %s", room, err)
+	}
+	return socket
+}
+
+// SessionBandwidth returns the bytes each participant of a session sent and
+// received through the SFU, most first.
+func SessionBandwidth(ctx context.Context, db *mongo.Client, sessionID string) ([]ParticipantBandwidth, error) {
+	cursor, err := db.Database("vidchat").Collection("bandwidth").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"sessionID": sessionID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$userID",
+			"bytesIn":  bson.M{"$sum": "$bytesIn"},
+			"bytesOut": bson.M{"$sum": "$bytesOut"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "bytesOut", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	participants := []ParticipantBandwidth{}
+	err = cursor.All(ctx, &participants)
+	return participants, err
+}
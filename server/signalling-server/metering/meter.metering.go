@@ -0,0 +1,75 @@
+// Package metering keeps the usage orgs are billed for, as daily totals per
+// metric, and accounts the media bandwidth each participant uses.
+package metering
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Metrics.
+const (
+	// MediaBytes counts bytes SFU nodes relayed, both directions.
+	MediaBytes = "media_bytes"
+	// TURNBytes counts bytes TURN servers relayed, both directions.
+	TURNBytes = "turn_bytes"
+)
+
+// Reading is an org's total of one metric over a day (UTC).
+type Reading struct {
+	OrgID  string `bson:"orgID" json:"orgID"`
+	Day    string `bson:"day" json:"day"`
+	Metric string `bson:"metric" json:"metric"`
+	Value  int64  `bson:"value" json:"value"`
+}
+
+// Meter adds to the readings in the meters collection.
+type Meter struct {
+	db *mongo.Database
+}
+
+func NewMeter(db *mongo.Client) *Meter {
+	return &Meter{db: db.Database("vidchat")}
+}
+
+// Add adds value to the org's metric for the day of at. Usage without an
+// org is not metered; a nil Meter meters nothing.
+func (m *Meter) Add(ctx context.Context, orgID, metric string, value int64, at time.Time) error {
+	if m == nil || orgID == "" || value <= 0 {
+		return nil
+	}
+	day := at.UTC().Format("2006-01-02")
+	_, err := m.db.Collection("meters").UpdateOne(ctx,
+		bson.M{"_id": orgID + "/" + day + "/" + metric},
+		bson.M{
+			"$inc":         bson.M{"value": value},
+			"$setOnInsert": bson.M{"orgID": orgID, "day": day, "metric": metric},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// Readings returns the org's daily readings for the days from and to fall
+// in and every day between, oldest first, and their totals per metric.
+func Readings(ctx context.Context, db *mongo.Client, orgID string, from, to time.Time) ([]Reading, map[string]int64, error) {
+	cursor, err := db.Database("vidchat").Collection("meters").Find(ctx, bson.M{
+		"orgID": orgID,
+		"day":   bson.M{"$gte": from.UTC().Format("2006-01-02"), "$lte": to.UTC().Format("2006-01-02")},
+	}, options.Find().SetSort(bson.D{{Key: "day", Value: 1}, {Key: "metric", Value: 1}}))
+	if err != nil {
+		return nil, nil, err
+	}
+	readings := []Reading{}
+	if err := cursor.All(ctx, &readings); err != nil {
+		return nil, nil, err
+	}
+	totals := make(map[string]int64)
+	for _, reading := range readings {
+		totals[reading.Metric] += reading.Value
+	}
+	return readings, totals, nil
+}
@@ -0,0 +1,41 @@
+// Package netpoll watches many idle connections for readability from a
+// single goroutine, so a connection only costs a goroutine while it has data
+// to process.
+package netpoll
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var ErrUnsupported = errors.New("netpoll: not supported on this platform")
+
+// Poller calls a connection's handler once each time it becomes readable.
+// Notifications are one-shot: after handling, the caller must Resume the
+// connection to receive the next one, so a handler never runs concurrently
+// with itself.
+type Poller interface {
+	Add(conn net.Conn, onReadable func()) error
+	Resume(conn net.Conn) error
+	Remove(conn net.Conn) error
+	Close() error
+}
+
+func fd(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("netpoll: connection does not expose a file descriptor")
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var descriptor int
+	err = raw.Control(func(f uintptr) {
+		descriptor = int(f)
+	})
+	return descriptor, err
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package netpoll
+
+import (
+	"log"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const events = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+type epoll struct {
+	fd       int
+	mu       sync.RWMutex
+	handlers map[int]func()
+}
+
+// New creates an epoll instance and starts its wait loop.
+func New() (Poller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &epoll{fd: fd, handlers: make(map[int]func())}
+	go p.wait()
+	return p, nil
+}
+
+func (p *epoll) Add(conn net.Conn, onReadable func()) error {
+	descriptor, err := fd(conn)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.handlers[descriptor] = onReadable
+	p.mu.Unlock()
+
+	err = syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, descriptor, &syscall.EpollEvent{Events: events, Fd: int32(descriptor)})
+	if err != nil {
+		p.mu.Lock()
+		delete(p.handlers, descriptor)
+		p.mu.Unlock()
+	}
+	return err
+}
+
+func (p *epoll) Resume(conn net.Conn) error {
+	descriptor, err := fd(conn)
+	if err != nil {
+		return err
+	}
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, descriptor, &syscall.EpollEvent{Events: events, Fd: int32(descriptor)})
+}
+
+func (p *epoll) Remove(conn net.Conn) error {
+	descriptor, err := fd(conn)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.handlers, descriptor)
+	p.mu.Unlock()
+
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, descriptor, nil)
+}
+
+func (p *epoll) Close() error {
+	return syscall.Close(p.fd)
+}
+
+func (p *epoll) wait() {
+	ready := make([]syscall.EpollEvent, 128)
+	for {
+		n, err := syscall.EpollWait(p.fd, ready, -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			log.Printf("netpoll: epoll_wait: %s", err)
+			return
+		}
+
+		p.mu.RLock()
+		for i := 0; i < n; i++ {
+			if handler := p.handlers[int(ready[i].Fd)]; handler != nil {
+				go handler()
+			}
+		}
+		p.mu.RUnlock()
+	}
+}
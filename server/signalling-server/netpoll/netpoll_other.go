@@ -0,0 +1,8 @@
+//go:build !linux
+
+package netpoll
+
+// New reports ErrUnsupported outside Linux; use the default WebSocket mode.
+func New() (Poller, error) {
+	return nil, ErrUnsupported
+}
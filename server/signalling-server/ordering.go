@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Ordering model: every message the server relays from a participant is
+// stamped with a "seq" field, counting up from 1 per sender for the life of
+// the room, and each recipient's write pump hands them to the socket in that
+// order, whether they were relayed live or held until the recipient joined.
+// Recipients may see gaps (droppable messages shed under load, messages
+// delivered to others only) but never a sender's messages out of order.
+// Messages the server originates, such as session_joined, participant
+// events and errors, carry no seq and are not ordered relative to relayed
+// ones.
+//
+// Every message also carries a "ts" field: the server's clock, in Unix
+// milliseconds, when it received a relayed message or sent its own. Clients
+// convert it to their own clock with the offset measured by clock_sync (see
+// clock.go), to order events from different senders and to measure one-way
+// latencies.
+
+// stamp returns a copy of a frame stamped with seq, unless it is 0, and
+// with at as its ts, safe to queue after the read buffer is reused. The
+// fields are appended last, so they take precedence over any the client
+// put in the frame. Frames that are not JSON objects are copied as they
+// are.
+func stamp(frame json.RawMessage, seq uint64, at time.Time) json.RawMessage {
+	trimmed := bytes.TrimSpace(frame)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return append(json.RawMessage(nil), frame...)
+	}
+
+	stamped := make(json.RawMessage, 0, len(trimmed)+48)
+	stamped = append(stamped, trimmed[:len(trimmed)-1]...)
+	if len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) > 0 {
+		stamped = append(stamped, ',')
+	}
+	if seq > 0 {
+		stamped = append(stamped, `"seq":`...)
+		stamped = strconv.AppendUint(stamped, seq, 10)
+		stamped = append(stamped, ',')
+	}
+	stamped = append(stamped, `"ts":`...)
+	stamped = strconv.AppendInt(stamped, at.UnixMilli(), 10)
+	return append(stamped, '}')
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+var paths *analytics.Paths
+
+// recordPath stores the candidate pair a client reports its connection to a
+// peer, or to the SFU, settled on. Clients send connection_path once ICE
+// completes and again after every ICE restart.
+func recordPath(socket string, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) {
+	var report struct {
+		Data analytics.Path `json:"data"`
+	}
+	if json.Unmarshal(frame, &report) != nil || !report.Data.Valid() {
+		return
+	}
+	path := report.Data
+	path.SessionID, path.Socket, path.UserID = clients.Session, socket, envelope.UserID
+	if path.Peer == "" {
+		path.Peer = "sfu"
+	}
+	go paths.Record(path)
+}
+
+// metrics serves the connection path counters, the results of the
+// built-in prober when it runs, and the TURN allocations this node polls,
+// in the Prometheus text format.
+func metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	paths.WriteMetrics(c.Writer)
+	prober.WriteMetrics(c.Writer)
+	turnMonitor.WriteMetrics(c.Writer)
+}
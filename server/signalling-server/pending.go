@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// pendingWindow is how long messages addressed to a user who is not
+// connected, e.g. an offer sent just before they join or while they are
+// switching networks, are held for them. Zero drops them as before.
+var pendingWindow = 30 * time.Second
+
+// pendingLimit bounds the messages held for one user; the oldest go first.
+const pendingLimit = 64
+
+// holdPending keeps a frame from sender, numbered seq, addressed to a user
+// who is not connected, for deliverPending. Droppable messages, such as
+// audio levels, are stale by then and not held. If the user connected since
+// the frame was relayed, it is sent to them instead. The frame must not be
+// modified afterwards.
+func holdPending(clients *interfaces.Room, to string, frame json.RawMessage, messageType, sender string, seq uint64) {
+	if pendingWindow <= 0 || broadcaster.policy.Droppable[messageType] {
+		return
+	}
+	held := interfaces.PendingFrame{Frame: frame, Type: messageType, Sender: sender, Seq: seq, At: time.Now()}
+	if client := clients.Hold(to, held, pendingWindow, pendingLimit); client != nil {
+		for _, failed := range broadcaster.Relay(map[string]*interfaces.Connection{to: client}, frame, messageType, sender, seq) {
+			suspend(clients, failed)
+		}
+	}
+}
+
+// deliverPending sends the user the messages held for them. Their write
+// pump puts each sender's messages in order with any relayed since they
+// joined.
+func deliverPending(clients *interfaces.Room, userID string, client *interfaces.Connection) {
+	recipient := map[string]*interfaces.Connection{userID: client}
+	for _, held := range clients.Take(userID, pendingWindow) {
+		if failed := broadcaster.Relay(recipient, held.Frame, held.Type, held.Sender, held.Seq); len(failed) > 0 {
+			suspend(clients, client)
+			return
+		}
+	}
+}
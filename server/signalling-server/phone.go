@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// dialer is the media backend when it can bridge phone calls into rooms.
+var dialer media.Dialer
+
+// hostRoom resolves the room behind the :url param for a request from one of
+// its hosts, writing the error response itself when that fails.
+func hostRoom(c *gin.Context) (string, *interfaces.Room, bool) {
+	claims, err := logins.Authenticate(c.Request)
+	if err != nil || claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized."})
+		return "", nil, false
+	}
+
+	socket, clients, ok := ownedRoom(c)
+	if !ok {
+		return "", nil, false
+	}
+	if clients.Role(claims.Subject) != interfaces.RoleHost {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only hosts can do that."})
+		return "", nil, false
+	}
+	return socket, clients, true
+}
+
+// ownedRoom resolves the room behind the :url param, writing the error
+// response itself when that fails. Rooms live on the node owning their
+// socket, so requests reaching another node are redirected there.
+func ownedRoom(c *gin.Context) (string, *interfaces.Room, bool) {
+	var record interfaces.Socket
+	err := database.Database("vidchat").Collection("sockets").FindOne(c, bson.M{"hashedUrl": c.Param("url")}).Decode(&record)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return "", nil, false
+	}
+
+	if !ring.Owns(record.SocketURL) {
+		owner := ring.Owner(record.SocketURL).URL
+		owner = strings.Replace(strings.Replace(owner, "wss://", "https://", 1), "ws://", "http://", 1)
+		c.Redirect(http.StatusTemporaryRedirect, owner+c.Request.URL.RequestURI())
+		return "", nil, false
+	}
+	return record.SocketURL, room(record.SocketURL), true
+}
+
+// dialPhone has the media backend call a phone number and bridge it into the
+// room's audio. The phone participant is in the roster from the moment it
+// is dialed.
+func dialPhone(c *gin.Context) {
+	var input struct {
+		Number string `json:"number"`
+		Name   string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	number, ok := interfaces.ParsePhoneNumber(input.Number)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone numbers must be in international format, e.g. +14155550100."})
+		return
+	}
+
+	socket, clients, ok := hostRoom(c)
+	if !ok {
+		return
+	}
+	if dialer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Dial-out is not supported by this media backend."})
+		return
+	}
+
+	claims, _ := logins.Authenticate(c.Request)
+	call := interfaces.PhoneCall{
+		ID:        "phone-" + phoneID(),
+		SessionID: clients.Session,
+		Socket:    socket,
+		Name:      input.Name,
+		Number:    interfaces.MaskPhoneNumber(number),
+		DialedBy:  claims.Subject,
+		Status:    interfaces.PhoneActive,
+		StartedAt: time.Now(),
+	}
+	if call.Name == "" {
+		call.Name = call.Number
+	}
+
+	err := dialer.Dial(c, clients.Session, number, call.ID, call.Name)
+	if err == media.ErrNoTrunk {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Dial-out is not configured."})
+		return
+	}
+	if err != nil {
+		log.Printf("Error dialing out of %s: %s", socket, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not place the call."})
+		return
+	}
+
+	participant := clients.AddPhone(call.ID, call.Name, call.Number)
+	call.Name = participant.Name
+	if _, err := database.Database("vidchat").Collection("phone_calls").InsertOne(c, call); err != nil {
+		log.Printf("Error saving phone call %s: %s", call.ID, err)
+	}
+
+	broadcast(socket, interfaces.Message{Type: "phone_joined", UserID: call.ID, Data: call})
+	announceJoin(clients, participant)
+	attendance.Join(clients.Session, socket, "", participant)
+	recordJoin(clients, participant)
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+
+	c.JSON(http.StatusCreated, call)
+}
+
+// mutePhone mutes or unmutes a phone participant.
+func mutePhone(c *gin.Context) {
+	var input struct {
+		Muted bool `json:"muted"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	socket, clients, ok := hostRoom(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	if !clients.Phone(id) || dialer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Phone participant not found."})
+		return
+	}
+
+	if err := dialer.MutePhone(c, clients.Session, id, input.Muted); err != nil {
+		log.Printf("Error muting %s in %s: %s", id, socket, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not mute the phone participant."})
+		return
+	}
+	clients.SetMuted(id, input.Muted)
+	event := analytics.EventUnmute
+	if input.Muted {
+		event = analytics.EventMute
+	}
+	recordEvent(clients, event, id, map[string]interface{}{"phone": true})
+	database.Database("vidchat").Collection("phone_calls").UpdateOne(c, bson.M{"_id": id}, bson.M{"$set": bson.M{"muted": input.Muted}})
+
+	broadcast(socket, interfaces.Message{Type: "phone_muted", UserID: id, Data: gin.H{"muted": input.Muted}})
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "muted": input.Muted})
+}
+
+// kickPhone hangs up on a phone participant.
+func kickPhone(c *gin.Context) {
+	socket, clients, ok := hostRoom(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	if !clients.Phone(id) || dialer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Phone participant not found."})
+		return
+	}
+
+	if err := dialer.Hangup(c, clients.Session, id); err != nil {
+		log.Printf("Error hanging up %s in %s: %s", id, socket, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not hang up."})
+		return
+	}
+	endPhone(socket, clients, id)
+
+	c.Status(http.StatusNoContent)
+}
+
+// hangupPhones ends every phone call into a room everyone else has left.
+func hangupPhones(socket string, clients *interfaces.Room) {
+	if dialer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, id := range clients.Phones() {
+		if err := dialer.Hangup(ctx, clients.Session, id); err != nil {
+			log.Printf("Error hanging up %s in %s: %s", id, socket, err)
+		}
+		endPhone(socket, clients, id)
+	}
+}
+
+func endPhone(socket string, clients *interfaces.Room, id string) {
+	if participant, ok := clients.Participant(id); ok {
+		attendance.Leave(clients.Session, participant.ID)
+	}
+	recordEvent(clients, analytics.EventLeave, id, map[string]interface{}{"phone": true})
+	clients.Remove(id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	database.Database("vidchat").Collection("phone_calls").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"status": interfaces.PhoneEnded, "endedAt": time.Now()}})
+
+	broadcast(socket, interfaces.Message{Type: "phone_left", UserID: id})
+	if clients.Len() > 0 {
+		snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+	}
+}
+
+func phoneID() string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
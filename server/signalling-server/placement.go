@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// redirect completes the WebSocket handshake for a client that reached a node
+// not owning its room, tells it where the room lives and closes the socket.
+// path is what the client connected on, which for embedded clients is their
+// embed socket rather than the room's.
+func redirect(w http.ResponseWriter, r *http.Request, socket, path string) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error handling websocket connection: %s", err)
+		return
+	}
+
+	connection := interfaces.NewConnection(interfaces.WebsocketTransport{Conn: conn}, false)
+	connection.Send(interfaces.Message{Type: "redirect", URL: ring.Owner(socket).URL + path})
+	connection.Disconnect(interfaces.CloseMoved, "moved")
+}
+
+// handoffSpread is the longest clients of a handed off room are asked to
+// wait before reconnecting, so a node taking over many rooms at once, e.g.
+// in a deployment switch, is not hit by all their clients in the same
+// instant.
+const handoffSpread = 2 * time.Second
+
+// handoff moves rooms this node no longer owns after the ring changed. Every
+// client is sent a redirect to the new owner, with a random delay to wait
+// before following it, and disconnected. They resume there with their
+// resume tokens, keeping their place in the room restored from its
+// snapshot; peer-to-peer media is unaffected while signalling moves.
+func handoff() {
+	// The new owners restore the rooms from their snapshots.
+	snapshots.Flush()
+
+	socketsMu.Lock()
+	moved := make(map[string]*interfaces.Room)
+	for socket, clients := range sockets {
+		if !ring.Owns(socket) {
+			moved[socket] = clients
+			delete(sockets, socket)
+		}
+	}
+	socketsMu.Unlock()
+
+	for socket, clients := range moved {
+		owner := ring.Owner(socket).URL
+		log.Printf("Handing off room %s to %s", socket, owner)
+
+		for _, client := range clients.Clients() {
+			delay := rand.Int63n(handoffSpread.Milliseconds())
+			client.Send(interfaces.Message{Type: "redirect", URL: owner + embedPath(socket, client), Data: map[string]int64{"delay": delay}})
+			client.Disconnect(interfaces.CloseMoved, "moved")
+		}
+	}
+}
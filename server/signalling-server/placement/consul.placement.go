@@ -0,0 +1,70 @@
+package placement
+
+import (
+	"log"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/utils"
+)
+
+// MetaURL is the Consul service meta key holding a node's public base URL.
+const MetaURL = "ws_url"
+
+// Watch refreshes the ring from the healthy Consul instances of serviceName,
+// their load reports and the deployment every interval, calling onChange
+// after membership changes. A pending deployment switch is applied when it
+// is due.
+func (r *Ring) Watch(client *api.Client, serviceName string, interval time.Duration, onChange func()) {
+	for {
+		wait := interval
+		if due := r.refresh(client, serviceName, onChange); !due.IsZero() && time.Until(due) < wait {
+			wait = time.Until(due)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// refresh updates the ring, returning when a pending deployment switch is
+// due, if there is one.
+func (r *Ring) refresh(client *api.Client, serviceName string, onChange func()) time.Time {
+	services, err := utils.HealthyInstances(client, serviceName)
+	if err != nil {
+		log.Printf("Placement: discovering %s: %s", serviceName, err)
+		return time.Time{}
+	}
+
+	nodes := make([]Node, 0, len(services))
+	for _, service := range services {
+		if url := service.Meta[MetaURL]; url != "" {
+			nodes = append(nodes, Node{ID: service.ID, URL: url, Version: service.Meta[MetaVersion]})
+		}
+	}
+
+	if loads, err := Loads(client); err != nil {
+		log.Printf("Placement: reading loads: %s", err)
+	} else {
+		r.SetLoads(loads)
+	}
+
+	var due time.Time
+	if deployment, err := LoadDeployment(client); err != nil {
+		log.Printf("Placement: reading deployment: %s", err)
+	} else {
+		now := time.Now()
+		r.SetActive(deployment.Active(now))
+		if now.Before(deployment.At) {
+			due = deployment.At
+		}
+	}
+
+	if r.Set(nodes) {
+		members, standby := r.Members()
+		log.Printf("Placement: ring now has %d nodes, %d standing by", len(members), len(standby))
+		if onChange != nil {
+			onChange()
+		}
+	}
+	return due
+}
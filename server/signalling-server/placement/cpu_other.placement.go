@@ -0,0 +1,15 @@
+//go:build !unix
+
+package placement
+
+// cpuSampler reports no CPU use where the platform does not tell; nodes
+// are then compared by connections alone.
+type cpuSampler struct{}
+
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{}
+}
+
+func (c *cpuSampler) sample() float64 {
+	return 0
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package placement
+
+import (
+	"math"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// cpuSampler measures the CPU time the process used between samples.
+type cpuSampler struct {
+	used time.Duration
+	at   time.Time
+}
+
+func newCPUSampler() *cpuSampler {
+	c := &cpuSampler{}
+	c.sample()
+	return c
+}
+
+// sample returns the share of the CPUs the process may run on that it used
+// since the last sample.
+func (c *cpuSampler) sample() float64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	used := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	now := time.Now()
+
+	busy := 0.0
+	if elapsed := now.Sub(c.at); !c.at.IsZero() && elapsed > 0 {
+		busy = float64(used-c.used) / float64(elapsed) / float64(runtime.GOMAXPROCS(0))
+	}
+	c.used, c.at = used, now
+	return math.Max(0, math.Min(1, busy))
+}
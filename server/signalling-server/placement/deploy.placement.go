@@ -0,0 +1,64 @@
+package placement
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// MetaVersion is the Consul service meta key holding the version a node
+// runs.
+const MetaVersion = "version"
+
+// DeploymentKey is the Consul KV key of the current Deployment.
+const DeploymentKey = "placement/deployment"
+
+// Deployment selects the version whose nodes own rooms, for blue/green
+// deploys. Nodes running another version stay up as warm standbys: they
+// redirect every join to the active nodes and take over if the deployment
+// is switched back to them.
+//
+// A switch takes effect on every node at At, rather than whenever each
+// node next polls Consul, so the old owners hand their rooms off at the
+// same moment the new ones start accepting them.
+type Deployment struct {
+	Version  string    `json:"version"`
+	Previous string    `json:"previous,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Active returns the version in effect at now.
+func (d Deployment) Active(now time.Time) string {
+	if now.Before(d.At) {
+		return d.Previous
+	}
+	return d.Version
+}
+
+// LoadDeployment returns the current deployment; with none, every version
+// is active.
+func LoadDeployment(client *api.Client) (Deployment, error) {
+	var deployment Deployment
+	pair, _, err := client.KV().Get(DeploymentKey, nil)
+	if err != nil || pair == nil {
+		return deployment, err
+	}
+	err = json.Unmarshal(pair.Value, &deployment)
+	return deployment, err
+}
+
+// Activate switches rooms to the nodes running version after delay, which
+// should be longer than the interval nodes poll Consul at. An empty
+// version makes every version active again.
+func Activate(client *api.Client, version string, delay time.Duration) (Deployment, error) {
+	current, err := LoadDeployment(client)
+	if err != nil {
+		return current, err
+	}
+	now := time.Now()
+	deployment := Deployment{Version: version, Previous: current.Active(now), At: now.Add(delay)}
+	value, _ := json.Marshal(deployment)
+	_, err = client.KV().Put(&api.KVPair{Key: DeploymentKey, Value: value}, nil)
+	return deployment, err
+}
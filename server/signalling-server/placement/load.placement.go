@@ -0,0 +1,95 @@
+package placement
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// LoadPrefix is the Consul KV prefix nodes report their load under, one key
+// per Consul service ID. Signalling nodes report themselves; media nodes
+// are expected to write the same JSON under their own service ID.
+const LoadPrefix = "placement/load/"
+
+// loadSlack is how much busier than the least loaded node a node may be and
+// still get new rooms, so a burst of rooms created between two load reports
+// spreads out instead of piling onto one node.
+const loadSlack = 0.1
+
+// staleLoad is how old a report may be before the node's load counts as
+// unknown.
+const staleLoad = 30 * time.Second
+
+// Load is what a node reports about how busy it is.
+type Load struct {
+	Connections int `json:"connections"`
+	Rooms       int `json:"rooms"`
+	// CPU is the share of the node's CPUs in use, from 0 to 1.
+	CPU float64 `json:"cpu"`
+	// Capacity is the most connections the node takes, or 0 when unknown.
+	Capacity int       `json:"capacity,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Score is the node's utilization from 0 (idle) up: the busier of its CPU
+// and its connections against its capacity.
+func (l Load) Score() float64 {
+	score := l.CPU
+	if l.Capacity > 0 {
+		score = math.Max(score, float64(l.Connections)/float64(l.Capacity))
+	}
+	return score
+}
+
+// Lightest returns the IDs among ids whose load is within loadSlack of the
+// lowest, in the order given, or none when none of them reported a load.
+func Lightest(loads map[string]Load, ids []string) []string {
+	best := -1.0
+	for _, id := range ids {
+		if load, ok := loads[id]; ok && (best < 0 || load.Score() < best) {
+			best = load.Score()
+		}
+	}
+	var lightest []string
+	for _, id := range ids {
+		if load, ok := loads[id]; ok && load.Score() <= best+loadSlack {
+			lightest = append(lightest, id)
+		}
+	}
+	return lightest
+}
+
+// Loads returns the recent load reports, by node ID.
+func Loads(client *api.Client) (map[string]Load, error) {
+	pairs, _, err := client.KV().List(LoadPrefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	loads := make(map[string]Load, len(pairs))
+	for _, pair := range pairs {
+		var load Load
+		if err := json.Unmarshal(pair.Value, &load); err != nil || time.Since(load.At) > staleLoad {
+			continue
+		}
+		loads[pair.Key[len(LoadPrefix):]] = load
+	}
+	return loads, nil
+}
+
+// Report writes this node's load every interval. load supplies everything
+// but the CPU, which Report measures itself.
+func Report(client *api.Client, id string, interval time.Duration, load func() Load) {
+	cpu := newCPUSampler()
+	for range time.Tick(interval) {
+		current := load()
+		current.CPU = cpu.sample()
+		current.At = time.Now()
+		value, _ := json.Marshal(current)
+		if _, err := client.KV().Put(&api.KVPair{Key: LoadPrefix + id, Value: value}, nil); err != nil {
+			log.Printf("Placement: reporting load: %s", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package placement assigns rooms to signalling nodes with a consistent hash
+// ring, so every node agrees on which one owns a room and a node joining or
+// leaving only moves the rooms adjacent to it on the ring.
+package placement
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// replicas is the number of virtual points each node gets on the ring.
+const replicas = 128
+
+// maxPlaceAttempts bounds the keys Place tries.
+const maxPlaceAttempts = 1000
+
+// Node is a signalling server instance and the base URL clients use to reach
+// its WebSocket endpoint. Version is the release it runs, see Deployment.
+type Node struct {
+	ID      string
+	URL     string
+	Version string
+}
+
+type point struct {
+	hash uint64
+	node Node
+}
+
+type Ring struct {
+	self Node
+
+	mu       sync.RWMutex
+	points   []point
+	nodes    map[string]Node
+	standby  []Node
+	loads    map[string]Load
+	active   string
+	draining bool
+}
+
+// NewRing returns a ring containing only self.
+func NewRing(self Node) *Ring {
+	r := &Ring{self: self}
+	r.Set([]Node{self})
+	return r
+}
+
+func (r *Ring) Self() Node {
+	return r.self
+}
+
+// Set replaces the ring's members. self is always kept, unless draining, so
+// a node never redirects everything away when discovery is briefly
+// unavailable. While a version is active, nodes running any other version
+// stand by instead, unless no node runs the active one. It reports whether
+// membership changed.
+func (r *Ring) Set(nodes []Node) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	candidates := make(map[string]Node)
+	if !r.draining {
+		candidates[r.self.ID] = r.self
+	}
+	for _, node := range nodes {
+		if node.ID != r.self.ID || !r.draining {
+			candidates[node.ID] = node
+		}
+	}
+
+	members := candidates
+	r.standby = nil
+	if r.active != "" {
+		active := make(map[string]Node)
+		var standby []Node
+		for id, node := range candidates {
+			if node.Version == r.active {
+				active[id] = node
+			} else {
+				standby = append(standby, node)
+			}
+		}
+		if len(active) > 0 {
+			members = active
+			sort.Slice(standby, func(i, j int) bool { return standby[i].ID < standby[j].ID })
+			r.standby = standby
+		}
+	}
+
+	if sameMembers(r.nodes, members) {
+		return false
+	}
+
+	points := make([]point, 0, len(members)*replicas)
+	for _, node := range members {
+		for i := 0; i < replicas; i++ {
+			points = append(points, point{hash: hash(node.ID + "#" + strconv.Itoa(i)), node: node})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	r.points = points
+	r.nodes = members
+	return true
+}
+
+// SetActive sets the version whose nodes make up the ring, or "" for
+// every version. It takes effect with the next Set.
+func (r *Ring) SetActive(version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = version
+}
+
+// Members returns the nodes rooms are placed on, and the healthy nodes
+// standing by because they run another version than the active one.
+func (r *Ring) Members() (members []Node, standby []Node) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, node := range r.nodes {
+		members = append(members, node)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, append([]Node{}, r.standby...)
+}
+
+// Drain removes this node from the ring so that every room maps to another
+// node. It reports whether membership changed.
+func (r *Ring) Drain() bool {
+	r.mu.Lock()
+	r.draining = true
+	nodes := append([]Node{}, r.standby...)
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	r.mu.Unlock()
+
+	return r.Set(nodes)
+}
+
+func (r *Ring) Draining() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.draining
+}
+
+// Owner returns the node responsible for room. A draining node that is the
+// last one left keeps its rooms.
+func (r *Ring) Owner(room string) Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return r.self
+	}
+
+	h := hash(room)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// SetLoads replaces the load reports of the nodes. Loads do not change
+// which node owns a room, only where Place starts new ones.
+func (r *Ring) SetLoads(loads map[string]Load) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loads = loads
+}
+
+// LeastLoaded returns a member with about the lowest load, picked at random
+// among those Lightest returns. It reports false when no member has
+// reported its load.
+func (r *Ring) LeastLoaded() (Node, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.nodes))
+	for id := range r.nodes {
+		ids = append(ids, id)
+	}
+	lightest := Lightest(r.loads, ids)
+	if len(lightest) == 0 {
+		return Node{}, false
+	}
+	return r.nodes[lightest[rand.Intn(len(lightest))]], true
+}
+
+// Place returns the first of key(0), key(1), ... owned by the least loaded
+// node, so a new room starts there while every node still finds its owner
+// by hashing alone. Without load reports it returns key(0).
+func (r *Ring) Place(key func(attempt int) string) string {
+	target, ok := r.LeastLoaded()
+	if !ok {
+		return key(0)
+	}
+	for attempt := 0; attempt < maxPlaceAttempts; attempt++ {
+		if candidate := key(attempt); r.Owner(candidate).ID == target.ID {
+			return candidate
+		}
+	}
+	return key(0)
+}
+
+// Owns reports whether this node is responsible for room.
+func (r *Ring) Owns(room string) bool {
+	return r.Owner(room).ID == r.self.ID
+}
+
+func sameMembers(a, b map[string]Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, node := range a {
+		if b[id] != node {
+			return false
+		}
+	}
+	return true
+}
+
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// videoGate is the media backend when it can enforce video limits itself.
+var videoGate media.VideoGate
+
+// enforcePolicy applies the session's media policy after the room changed
+// size. When the room crosses its video threshold everyone is sent the new
+// limits and, where the backend allows, their cameras are gated; a user who
+// just joined a room already over it is gated on their own.
+func enforcePolicy(socket string, clients *interfaces.Room, joined string) {
+	policy := clients.Settings.Media
+	if policy.VideoOffAbove == 0 {
+		return
+	}
+	limits := policy.Limits(clients.Len())
+
+	var gated []string
+	if clients.SetVideo(limits.Video) {
+		broadcast(socket, interfaces.Message{Type: "media_policy", Data: limits})
+		for user := range clients.Clients() {
+			gated = append(gated, user)
+		}
+	} else if joined != "" && !limits.Video {
+		gated = []string{joined}
+	}
+
+	if videoGate == nil || len(gated) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := videoGate.SetVideo(ctx, clients.Session, gated, limits.Video); err != nil {
+		log.Printf("Error applying media policy to %s: %s", socket, err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// preflightProbes and preflightTimeout bound a preflight echo socket.
+const (
+	preflightProbes  = 50
+	preflightTimeout = 30 * time.Second
+)
+
+// preflighthandler echoes every frame back with the server's receive time so
+// a client can measure its signalling round trip before joining.
+func preflighthandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(preflightTimeout))
+
+	for probes := 0; probes < preflightProbes; probes++ {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var probe struct {
+			Seq  int             `json:"seq"`
+			Sent json.RawMessage `json:"sent"`
+		}
+		if json.Unmarshal(frame, &probe) != nil {
+			return
+		}
+		err = conn.WriteJSON(interfaces.Message{Type: "pong", Data: map[string]interface{}{
+			"seq":      probe.Seq,
+			"sent":     probe.Sent,
+			"received": time.Now().UnixNano() / int64(time.Millisecond),
+		}})
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/calls"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// presencehandler serves the per-user socket a signed-in client keeps open
+// outside meetings. It carries heartbeats up and presence updates down.
+func presencehandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := logins.Authenticate(r)
+	if err != nil || claims == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error handling presence connection: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	user := claims.Subject
+	connection := interfaces.NewConnection(interfaces.WebsocketTransport{Conn: conn}, false)
+	defer logins.Track(claims, connection)()
+
+	presences.Connect(user)
+	defer presences.Disconnect(user)
+	defer presences.Unsubscribe(connection)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	contactIDs, err := directory.Contacts(ctx, user)
+	cancel()
+	if err != nil {
+		log.Printf("Error loading contacts of %s: %s", user, err)
+	}
+	presences.Subscribe(connection, contactIDs)
+	defer ringer.Register(user, connection)()
+
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			return
+		}
+
+		var message struct {
+			Type  string   `json:"type"`
+			Idle  bool     `json:"idle"`
+			Users []string `json:"users"`
+			To    string   `json:"to"`
+			Data  struct {
+				CallID string `json:"callID"`
+				Video  bool   `json:"video"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(frame, &message); err != nil {
+			return
+		}
+
+		switch message.Type {
+		case "heartbeat":
+			presences.Heartbeat(user, message.Idle)
+		case "presence_subscribe":
+			var visible []string
+			for _, other := range message.Users {
+				if !directory.Blocked(r.Context(), other, user) {
+					visible = append(visible, other)
+				}
+			}
+			presences.Subscribe(connection, visible)
+		case "call_invite", "call_accept", "call_reject", "call_cancel":
+			call(r.Context(), connection, user, message.Type, message.To, message.Data.CallID, message.Data.Video)
+		}
+	}
+}
+
+// call handles a direct call message from user. Call state changes reach
+// both parties through the ringer; only failures are answered here.
+func call(ctx context.Context, connection *interfaces.Connection, user, messageType, to, callID string, video bool) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var err error
+	switch messageType {
+	case "call_invite":
+		if to == "" || to == user {
+			connection.Send(interfaces.Message{Type: "call_error", Data: map[string]string{"error": "invalid_callee"}})
+			return
+		}
+		_, err = ringer.Invite(ctx, user, to, video)
+	case "call_accept":
+		err = ringer.Answer(ctx, user, callID, calls.Accepted)
+	case "call_reject":
+		err = ringer.Answer(ctx, user, callID, calls.Rejected)
+	case "call_cancel":
+		err = ringer.Answer(ctx, user, callID, calls.Cancelled)
+	}
+
+	switch {
+	case err == calls.ErrNotFound:
+		connection.Send(interfaces.Message{Type: "call_error", Data: map[string]string{"callID": callID, "error": "not_ringing"}})
+	case err != nil:
+		log.Printf("Error handling %s from %s: %s", messageType, user, err)
+		connection.Send(interfaces.Message{Type: "call_error", Data: map[string]string{"callID": callID, "error": "unavailable"}})
+	}
+}
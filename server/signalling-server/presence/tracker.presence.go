@@ -0,0 +1,352 @@
+// Package presence tracks whether signed-in users are online, idle, in a
+// meeting or offline, and pushes changes to the sockets watching them.
+package presence
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	Online    = "online"
+	Idle      = "idle"
+	InMeeting = "in_meeting"
+	Offline   = "offline"
+)
+
+// IdleAfter is how long a user may go without activity before they are idle.
+const IdleAfter = 5 * time.Minute
+
+// HeartbeatTTL is how long a node's record of a user counts without being
+// refreshed, so users on a node that died go offline.
+const HeartbeatTTL = 90 * time.Second
+
+const refreshInterval = 30 * time.Second
+
+// record is one node's view of a user; a user's presence combines the
+// records of every node they are connected to.
+type record struct {
+	ID        string    `bson:"_id"`
+	User      string    `bson:"user"`
+	Node      string    `bson:"node"`
+	Sockets   int       `bson:"sockets"`
+	Meetings  int       `bson:"meetings"`
+	Idle      bool      `bson:"idle"`
+	Heartbeat time.Time `bson:"heartbeat"`
+}
+
+type entry struct {
+	sockets    int
+	meetings   int
+	away       bool
+	lastActive time.Time
+	idle       bool
+}
+
+func (e *entry) isIdle(now time.Time) bool {
+	return e.away || now.Sub(e.lastActive) > IdleAfter
+}
+
+// Tracker keeps this node's share of everyone's presence in the presence
+// collection and relays changes to local watchers. A nil Tracker does
+// nothing.
+type Tracker struct {
+	node       string
+	collection *mongo.Collection
+
+	mu       sync.Mutex
+	local    map[string]*entry
+	watchers map[string]map[*interfaces.Connection]bool
+	watching map[*interfaces.Connection][]string
+	last     map[string]string
+}
+
+func NewTracker(db *mongo.Client, node string) *Tracker {
+	t := &Tracker{
+		node:       node,
+		collection: db.Database("vidchat").Collection("presence"),
+		local:      make(map[string]*entry),
+		watchers:   make(map[string]map[*interfaces.Connection]bool),
+		watching:   make(map[*interfaces.Connection][]string),
+		last:       make(map[string]string),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := t.collection.DeleteMany(ctx, bson.M{"node": node}); err != nil {
+		log.Printf("Presence: resetting %s: %s", node, err)
+	}
+	return t
+}
+
+// Connect counts a presence socket opened by user.
+func (t *Tracker) Connect(user string) {
+	t.update(user, func(e *entry) { e.sockets++ })
+}
+
+func (t *Tracker) Disconnect(user string) {
+	t.update(user, func(e *entry) { e.sockets-- })
+}
+
+// JoinMeeting marks user as being in a meeting until the matching LeaveMeeting.
+func (t *Tracker) JoinMeeting(user string) {
+	t.update(user, func(e *entry) { e.meetings++ })
+}
+
+func (t *Tracker) LeaveMeeting(user string) {
+	t.update(user, func(e *entry) { e.meetings-- })
+}
+
+// Heartbeat records that user is still connected. away reports that the
+// client itself considers the user idle, e.g. the window is hidden.
+func (t *Tracker) Heartbeat(user string, away bool) {
+	t.update(user, func(e *entry) { e.away = away })
+}
+
+func (t *Tracker) update(user string, change func(*entry)) {
+	if t == nil || user == "" {
+		return
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	e := t.local[user]
+	if e == nil {
+		e = &entry{}
+		t.local[user] = e
+	}
+	change(e)
+	if !e.away {
+		e.lastActive = now
+	}
+	e.idle = e.isIdle(now)
+	current := *e
+	if e.sockets <= 0 && e.meetings <= 0 {
+		delete(t.local, user)
+	}
+	t.mu.Unlock()
+
+	t.write(user, current, now)
+}
+
+func (t *Tracker) write(user string, e entry, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	id := user + "|" + t.node
+	var err error
+	if e.sockets <= 0 && e.meetings <= 0 {
+		_, err = t.collection.DeleteOne(ctx, bson.M{"_id": id})
+	} else {
+		_, err = t.collection.ReplaceOne(ctx, bson.M{"_id": id}, record{
+			ID:        id,
+			User:      user,
+			Node:      t.node,
+			Sockets:   e.sockets,
+			Meetings:  e.meetings,
+			Idle:      e.idle,
+			Heartbeat: now,
+		}, options.Replace().SetUpsert(true))
+	}
+	if err != nil {
+		log.Printf("Presence: writing %s: %s", user, err)
+	}
+}
+
+// Get returns the user's combined presence across nodes.
+func (t *Tracker) Get(ctx context.Context, user string) (string, error) {
+	if t == nil {
+		return Offline, nil
+	}
+	cursor, err := t.collection.Find(ctx, bson.M{"user": user, "heartbeat": bson.M{"$gt": time.Now().Add(-HeartbeatTTL)}})
+	if err != nil {
+		return Offline, err
+	}
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return Offline, err
+	}
+
+	status := Offline
+	for _, r := range records {
+		switch {
+		case r.Meetings > 0:
+			return InMeeting, nil
+		case !r.Idle:
+			status = Online
+		case status == Offline:
+			status = Idle
+		}
+	}
+	return status, nil
+}
+
+// Subscribe sends connection the presence of users now and whenever it
+// changes, until Unsubscribe.
+func (t *Tracker) Subscribe(connection *interfaces.Connection, users []string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	for _, user := range users {
+		if t.watchers[user] == nil {
+			t.watchers[user] = make(map[*interfaces.Connection]bool)
+		}
+		if !t.watchers[user][connection] {
+			t.watchers[user][connection] = true
+			t.watching[connection] = append(t.watching[connection], user)
+		}
+	}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, user := range users {
+		status, err := t.Get(ctx, user)
+		if err != nil {
+			log.Printf("Presence: reading %s: %s", user, err)
+			continue
+		}
+		connection.Send(message(user, status))
+	}
+}
+
+func (t *Tracker) Unsubscribe(connection *interfaces.Connection) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, user := range t.watching[connection] {
+		delete(t.watchers[user], connection)
+		if len(t.watchers[user]) == 0 {
+			delete(t.watchers, user)
+			delete(t.last, user)
+		}
+	}
+	delete(t.watching, connection)
+}
+
+// Run keeps this node's records fresh, expires those of dead nodes and
+// pushes changes to watchers. Changes are followed with a change stream
+// when MongoDB runs as a replica set, and by polling otherwise.
+func (t *Tracker) Run() {
+	if t == nil {
+		return
+	}
+	go t.refresh()
+
+	for {
+		stream, err := t.collection.Watch(context.Background(), mongo.Pipeline{})
+		if err != nil {
+			log.Printf("Presence: change stream unavailable, polling instead: %s", err)
+			t.poll()
+			return
+		}
+		for stream.Next(context.Background()) {
+			var change struct {
+				DocumentKey struct {
+					ID string `bson:"_id"`
+				} `bson:"documentKey"`
+			}
+			if stream.Decode(&change) == nil {
+				if i := strings.LastIndex(change.DocumentKey.ID, "|"); i > 0 {
+					t.notify(change.DocumentKey.ID[:i])
+				}
+			}
+		}
+		log.Printf("Presence: change stream closed: %v", stream.Err())
+		stream.Close(context.Background())
+		time.Sleep(time.Second)
+	}
+}
+
+func (t *Tracker) poll() {
+	for {
+		time.Sleep(refreshInterval / 3)
+		t.mu.Lock()
+		users := make([]string, 0, len(t.watchers))
+		for user := range t.watchers {
+			users = append(users, user)
+		}
+		t.mu.Unlock()
+		for _, user := range users {
+			t.notify(user)
+		}
+	}
+}
+
+// refresh rewrites this node's records so they don't go stale, flipping
+// users to idle once they have been inactive for IdleAfter, and deletes
+// records other nodes stopped refreshing.
+func (t *Tracker) refresh() {
+	for {
+		time.Sleep(refreshInterval)
+		now := time.Now()
+
+		t.mu.Lock()
+		snapshot := make(map[string]entry, len(t.local))
+		for user, e := range t.local {
+			e.idle = e.isIdle(now)
+			snapshot[user] = *e
+		}
+		t.mu.Unlock()
+
+		for user, e := range snapshot {
+			t.write(user, e, now)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := t.collection.DeleteMany(ctx, bson.M{"heartbeat": bson.M{"$lt": now.Add(-HeartbeatTTL)}})
+		cancel()
+		if err != nil {
+			log.Printf("Presence: expiring records: %s", err)
+		}
+	}
+}
+
+func (t *Tracker) notify(user string) {
+	t.mu.Lock()
+	_, watched := t.watchers[user]
+	t.mu.Unlock()
+	if !watched {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	status, err := t.Get(ctx, user)
+	cancel()
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	if t.last[user] == status {
+		t.mu.Unlock()
+		return
+	}
+	t.last[user] = status
+	var watchers []*interfaces.Connection
+	for connection := range t.watchers[user] {
+		watchers = append(watchers, connection)
+	}
+	t.mu.Unlock()
+
+	update := message(user, status)
+	for _, connection := range watchers {
+		connection.Send(update)
+	}
+}
+
+func message(user, status string) interfaces.Message {
+	return interfaces.Message{Type: "presence", UserID: user, Data: map[string]string{"status": status}}
+}
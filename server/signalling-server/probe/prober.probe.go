@@ -0,0 +1,325 @@
+// Package probe runs synthetic meetings against a signalling server: it
+// creates a session, joins it with two bots, has them exchange an offer and
+// an answer, checks the STUN server handed out and reports how each stage
+// went in the Prometheus text format.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// Stages of a probe, in order.
+const (
+	StageCreate  = "create"
+	StageConnect = "connect"
+	StageJoin    = "join"
+	StageSignal  = "signal"
+	StageSTUN    = "stun"
+)
+
+var stages = []string{StageCreate, StageConnect, StageJoin, StageSignal, StageSTUN}
+
+// offer is a minimal audio-only description, enough for the server's SDP
+// rewriting to treat it like a browser's.
+const offer = "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 0.0.0.0\r\na=mid:0\r\na=sendrecv\r\na=rtpmap:111 opus/48000/2\r\n"
+
+// Prober probes the server at URL, an http(s) base URL, every Interval.
+// Each probe must finish within Timeout.
+type Prober struct {
+	URL      string
+	Interval time.Duration
+	Timeout  time.Duration
+
+	client *http.Client
+
+	mu          sync.Mutex
+	successes   int
+	failures    map[string]int
+	durations   map[string]time.Duration
+	total       time.Duration
+	lastSuccess time.Time
+}
+
+func NewProber(url string, interval, timeout time.Duration) *Prober {
+	return &Prober{
+		URL:       strings.TrimSuffix(url, "/"),
+		Interval:  interval,
+		Timeout:   timeout,
+		client:    &http.Client{Timeout: timeout},
+		failures:  make(map[string]int),
+		durations: make(map[string]time.Duration),
+	}
+}
+
+// Run probes forever.
+func (p *Prober) Run() {
+	if p == nil {
+		return
+	}
+	for {
+		p.Probe()
+		time.Sleep(p.Interval)
+	}
+}
+
+// Probe runs one synthetic meeting and records the outcome.
+func (p *Prober) Probe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	durations := make(map[string]time.Duration)
+	stage, err := p.probe(ctx, durations)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, took := range durations {
+		p.durations[name] = took
+	}
+	if err != nil {
+		p.failures[stage]++
+		log.Printf("Probe failed at %s: %s", stage, err)
+		return err
+	}
+	p.successes++
+	p.total = time.Since(start)
+	p.lastSuccess = time.Now()
+	return nil
+}
+
+// probe returns the stage it failed at, if any.
+func (p *Prober) probe(ctx context.Context, durations map[string]time.Duration) (string, error) {
+	password := random()
+	timed := func(stage string, f func() error) error {
+		start := time.Now()
+		err := f()
+		durations[stage] = time.Since(start)
+		return err
+	}
+
+	var created struct {
+		Socket string `json:"socket"`
+	}
+	err := timed(StageCreate, func() error {
+		return p.post(ctx, "/session", object{"host": "prober", "title": "probe " + random(), "password": password}, &created)
+	})
+	if err != nil {
+		return StageCreate, err
+	}
+
+	var joined struct {
+		Socket     string `json:"socket"`
+		Node       string `json:"node"`
+		IceServers []struct {
+			URLs []string `json:"urls"`
+		} `json:"iceServers"`
+	}
+	err = timed(StageConnect, func() error {
+		return p.post(ctx, "/connect/"+created.Socket, object{"password": password}, &joined)
+	})
+	if err != nil {
+		return StageConnect, err
+	}
+
+	node := joined.Node
+	if node == "" {
+		node = p.URL
+	}
+	room := strings.Replace(strings.Replace(node, "https://", "wss://", 1), "http://", "ws://", 1) + "/ws/" + joined.Socket
+
+	var a, b *bot
+	err = timed(StageJoin, func() error {
+		if a, err = join(ctx, room, "probe-a"); err != nil {
+			return err
+		}
+		b, err = join(ctx, room, "probe-b")
+		return err
+	})
+	if a != nil {
+		defer a.leave()
+	}
+	if b != nil {
+		defer b.leave()
+	}
+	if err != nil {
+		return StageJoin, err
+	}
+
+	err = timed(StageSignal, func() error {
+		description, _ := json.Marshal(object{"type": "offer", "sdp": offer})
+		if err := a.send(interfaces.Message{Type: "offer", To: b.user, Description: string(description)}); err != nil {
+			return err
+		}
+		received, err := b.await(ctx, "offer")
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(received.Description, "m=audio") {
+			return fmt.Errorf("offer arrived without its description")
+		}
+		description, _ = json.Marshal(object{"type": "answer", "sdp": offer})
+		if err := b.send(interfaces.Message{Type: "answer", To: a.user, Description: string(description)}); err != nil {
+			return err
+		}
+		_, err = a.await(ctx, "answer")
+		return err
+	})
+	if err != nil {
+		return StageSignal, err
+	}
+
+	for _, server := range joined.IceServers {
+		for _, url := range server.URLs {
+			if !strings.HasPrefix(url, "stun:") {
+				continue
+			}
+			err = timed(StageSTUN, func() error {
+				return binding(ctx, strings.TrimPrefix(url, "stun:"))
+			})
+			if err != nil {
+				return StageSTUN, err
+			}
+			return "", nil
+		}
+	}
+	return "", nil
+}
+
+type object map[string]interface{}
+
+func (p *Prober) post(ctx context.Context, path string, body object, out interface{}) error {
+	encoded, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s: %s: %s", path, resp.Status, bytes.TrimSpace(detail))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// bot is a headless participant.
+type bot struct {
+	user string
+	conn *websocket.Conn
+}
+
+func join(ctx context.Context, room, user string) (*bot, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, room, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := &bot{user: user, conn: conn}
+	if err := b.send(interfaces.Message{Type: "connect", UserID: user}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := b.await(ctx, "session_joined"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *bot) send(message interfaces.Message) error {
+	message.UserID = b.user
+	return b.conn.WriteJSON(message)
+}
+
+// await reads until a message of the given type from someone else arrives.
+func (b *bot) await(ctx context.Context, kind string) (interfaces.Message, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		b.conn.SetReadDeadline(deadline)
+	}
+	for {
+		_, frame, err := b.conn.ReadMessage()
+		if err != nil {
+			return interfaces.Message{}, err
+		}
+		// Batched connections receive arrays; the bots never opt in.
+		var message interfaces.Message
+		if json.Unmarshal(frame, &message) != nil {
+			continue
+		}
+		if message.Type == "error" {
+			return message, fmt.Errorf("server error: %s", message.Text)
+		}
+		if message.Type == kind && (message.UserID != b.user || kind == "session_joined") {
+			return message, nil
+		}
+	}
+}
+
+func (b *bot) leave() {
+	b.send(interfaces.Message{Type: "disconnect"})
+	b.conn.Close()
+}
+
+func random() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// WriteMetrics writes the probe results in the Prometheus text format.
+func (p *Prober) WriteMetrics(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP videoconf_probe_success_total Synthetic meetings that completed every stage.")
+	fmt.Fprintln(w, "# TYPE videoconf_probe_success_total counter")
+	fmt.Fprintf(w, "videoconf_probe_success_total %d\n", p.successes)
+
+	fmt.Fprintln(w, "# HELP videoconf_probe_failures_total Synthetic meetings that failed, by the stage that failed.")
+	fmt.Fprintln(w, "# TYPE videoconf_probe_failures_total counter")
+	for _, stage := range stages {
+		fmt.Fprintf(w, "videoconf_probe_failures_total{stage=%q} %d\n", stage, p.failures[stage])
+	}
+
+	fmt.Fprintln(w, "# HELP videoconf_probe_stage_seconds Duration of each stage in the latest probe that reached it.")
+	fmt.Fprintln(w, "# TYPE videoconf_probe_stage_seconds gauge")
+	for _, stage := range stages {
+		if took, ok := p.durations[stage]; ok {
+			fmt.Fprintf(w, "videoconf_probe_stage_seconds{stage=%q} %g\n", stage, took.Seconds())
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP videoconf_probe_duration_seconds End-to-end duration of the latest successful probe.")
+	fmt.Fprintln(w, "# TYPE videoconf_probe_duration_seconds gauge")
+	fmt.Fprintf(w, "videoconf_probe_duration_seconds %g\n", p.total.Seconds())
+
+	fmt.Fprintln(w, "# HELP videoconf_probe_last_success_timestamp_seconds Unix time of the latest successful probe.")
+	fmt.Fprintln(w, "# TYPE videoconf_probe_last_success_timestamp_seconds gauge")
+	last := 0.0
+	if !p.lastSuccess.IsZero() {
+		last = float64(p.lastSuccess.Unix())
+	}
+	fmt.Fprintf(w, "videoconf_probe_last_success_timestamp_seconds %g\n", last)
+}
@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const stunMagicCookie = 0x2112A442
+
+// binding sends a STUN binding request to server (host[:port], with any
+// ?transport= suffix ignored) and waits for the matching success response.
+// It checks UDP reachability of the address clients gather reflexive
+// candidates from; no media flows.
+func binding(ctx context.Context, server string) error {
+	server, _, _ = strings.Cut(server, "?")
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "3478")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:], 0x0001)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	rand.Read(request[8:20])
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	// UDP may drop the request; retry until the deadline.
+	response := make([]byte, 1500)
+	for {
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, err := conn.Read(response)
+		if err != nil {
+			if timeout, ok := err.(net.Error); ok && timeout.Timeout() && time.Now().Before(deadline) {
+				continue
+			}
+			return err
+		}
+		if n < 20 || !bytes.Equal(response[8:20], request[8:20]) {
+			continue
+		}
+		if kind := binary.BigEndian.Uint16(response[0:]); kind != 0x0101 {
+			return fmt.Errorf("STUN server answered with message type %#04x", kind)
+		}
+		return nil
+	}
+}
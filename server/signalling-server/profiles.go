@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// profileEventSkew is how far back each poll looks again, so events the
+// users service stamped with a slightly late clock are not missed.
+const profileEventSkew = 5 * time.Second
+
+// profileEvent is a profile change the users service queued in
+// profile_events.
+type profileEvent struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	UserID      string             `bson:"userID"`
+	DisplayName string             `bson:"displayName"`
+	AvatarURL   string             `bson:"avatarURL"`
+	At          time.Time          `bson:"at"`
+}
+
+// watchProfiles applies the profile changes the users service queues to
+// the rooms on this node every interval, so rosters show a new name or
+// avatar without anyone rejoining. Every node reads every event and
+// updates the participants signed in to the account in its own rooms.
+func watchProfiles(db *mongo.Client, interval time.Duration) {
+	collection := db.Database("vidchat").Collection("profile_events")
+	since := time.Now()
+	seen := make(map[primitive.ObjectID]time.Time)
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		cursor, err := collection.Find(ctx, bson.M{"at": bson.M{"$gt": since.Add(-profileEventSkew)}},
+			options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+		var events []profileEvent
+		if err == nil {
+			err = cursor.All(ctx, &events)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Error reading profile events: %s", err)
+			continue
+		}
+
+		for _, event := range events {
+			if _, ok := seen[event.ID]; ok {
+				continue
+			}
+			seen[event.ID] = event.At
+			if event.At.After(since) {
+				since = event.At
+			}
+			applyProfile(event)
+		}
+		for id, at := range seen {
+			if at.Before(since.Add(-profileEventSkew)) {
+				delete(seen, id)
+			}
+		}
+	}
+}
+
+// applyProfile updates the participants signed in to the event's account
+// and tells their rooms with participant_updated.
+func applyProfile(event profileEvent) {
+	socketsMu.Lock()
+	rooms := make(map[string]*interfaces.Room, len(sockets))
+	for socket, clients := range sockets {
+		rooms[socket] = clients
+	}
+	socketsMu.Unlock()
+
+	for socket, clients := range rooms {
+		for userID, connection := range clients.Clients() {
+			if connection.Account != event.UserID {
+				continue
+			}
+			participant, changed := clients.SetProfile(userID, event.DisplayName, event.AvatarURL)
+			if !changed {
+				continue
+			}
+			frame, err := json.Marshal(interfaces.Message{Type: "participant_updated", UserID: userID, Data: gin.H{
+				"participantID": participant.ID,
+				"name":          participant.Name,
+				"avatar":        participant.Avatar,
+			}})
+			if err != nil {
+				log.Printf("error: %v", err)
+				continue
+			}
+			for _, failed := range broadcaster.Broadcast(clients.Clients(), frame, "participant_updated") {
+				suspend(clients, failed)
+			}
+			snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package quality turns the media statistics clients report into advice:
+// what a struggling participant should turn off, and when hosts should hear
+// about it.
+package quality
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stats is a client's summary of its media over the last few seconds,
+// computed from getStats.
+type Stats struct {
+	// PacketLoss is the fraction (0-1) of inbound packets lost.
+	PacketLoss float64 `json:"packetLoss"`
+	// RTT is the round trip time of the selected candidate pair, in ms.
+	RTT float64 `json:"rtt"`
+	// Bitrate is the available incoming bitrate estimate, in kbps. Zero
+	// when the browser does not report one.
+	Bitrate float64 `json:"bitrate"`
+}
+
+// Levels a participant's connection is rated at.
+const (
+	Good   = "good"
+	Poor   = "poor"
+	Severe = "severe"
+)
+
+// Suggestions sent in suggest_quality messages.
+const (
+	DisableIncomingVideo = "disable_incoming_video"
+	AudioOnly            = "audio_only"
+	Restore              = "restore"
+)
+
+// Limit is a pair of thresholds: reaching Poor rates a connection poor,
+// reaching Severe rates it severe.
+type Limit struct {
+	Poor   float64
+	Severe float64
+}
+
+// Thresholds rate connections. Bitrate limits are minimums; the others are
+// maximums. A connection changes level only after Samples reports in a row
+// at the new level, so a single bad report does not flip it back and forth.
+type Thresholds struct {
+	Loss    Limit
+	RTT     Limit
+	Bitrate Limit
+	Samples int
+}
+
+// DefaultThresholds suit typical conferencing: audio suffers beyond 5% loss
+// and becomes hard to follow beyond 15%.
+var DefaultThresholds = Thresholds{
+	Loss:    Limit{Poor: 0.05, Severe: 0.15},
+	RTT:     Limit{Poor: 400, Severe: 1000},
+	Bitrate: Limit{Poor: 300, Severe: 100},
+	Samples: 3,
+}
+
+// ParseThresholds parses "loss=0.05:0.15,rtt=400:1000,bitrate=300:100,samples=3"
+// (poor:severe per measure). Measures left out keep their defaults.
+func ParseThresholds(spec string) (Thresholds, error) {
+	thresholds := DefaultThresholds
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return thresholds, fmt.Errorf("invalid threshold %q", entry)
+		}
+		if name == "samples" {
+			samples, err := strconv.Atoi(value)
+			if err != nil || samples < 1 {
+				return thresholds, fmt.Errorf("invalid samples %q", value)
+			}
+			thresholds.Samples = samples
+			continue
+		}
+
+		var limit *Limit
+		switch name {
+		case "loss":
+			limit = &thresholds.Loss
+		case "rtt":
+			limit = &thresholds.RTT
+		case "bitrate":
+			limit = &thresholds.Bitrate
+		default:
+			return thresholds, fmt.Errorf("unknown measure %q", name)
+		}
+		poor, severe, ok := strings.Cut(value, ":")
+		p, err1 := strconv.ParseFloat(poor, 64)
+		s, err2 := strconv.ParseFloat(severe, 64)
+		if !ok || err1 != nil || err2 != nil || p < 0 || s < 0 {
+			return thresholds, fmt.Errorf("invalid %s thresholds %q", name, value)
+		}
+		*limit = Limit{Poor: p, Severe: s}
+	}
+	return thresholds, nil
+}
+
+// Rate returns the level stats fall in, and the measures responsible.
+func (t Thresholds) Rate(stats Stats) (string, []string) {
+	level := Good
+	var reasons []string
+	note := func(reason string, severe bool) {
+		reasons = append(reasons, reason)
+		if severe {
+			level = Severe
+		} else if level == Good {
+			level = Poor
+		}
+	}
+	if stats.PacketLoss >= t.Loss.Poor {
+		note("packet_loss", stats.PacketLoss >= t.Loss.Severe)
+	}
+	if stats.RTT >= t.RTT.Poor {
+		note("rtt", stats.RTT >= t.RTT.Severe)
+	}
+	if stats.Bitrate > 0 && stats.Bitrate <= t.Bitrate.Poor {
+		note("bitrate", stats.Bitrate <= t.Bitrate.Severe)
+	}
+	return level, reasons
+}
+
+// Advice is what a participant is told when their connection changes level.
+type Advice struct {
+	Level string `json:"level"`
+	// Previous is the level the connection was at before.
+	Previous   string   `json:"previous"`
+	Suggestion string   `json:"suggestion"`
+	Reasons    []string `json:"reasons,omitempty"`
+}
+
+type connection struct {
+	level     string
+	candidate string
+	streak    int
+}
+
+// Advisor rates the connections of participants on this node from the stats
+// they report.
+type Advisor struct {
+	thresholds Thresholds
+
+	mu          sync.Mutex
+	connections map[string]*connection
+}
+
+func NewAdvisor(thresholds Thresholds) *Advisor {
+	return &Advisor{thresholds: thresholds, connections: make(map[string]*connection)}
+}
+
+// Observe records a report from the user in the room and returns advice
+// when their connection changed level.
+func (a *Advisor) Observe(socket, userID string, stats Stats) (Advice, bool) {
+	level, reasons := a.thresholds.Rate(stats)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := socket + "|" + userID
+	c := a.connections[key]
+	if c == nil {
+		c = &connection{level: Good}
+		a.connections[key] = c
+	}
+	if level == c.level {
+		c.candidate, c.streak = "", 0
+		return Advice{}, false
+	}
+	if level != c.candidate {
+		c.candidate, c.streak = level, 0
+	}
+	c.streak++
+	if c.streak < a.thresholds.Samples {
+		return Advice{}, false
+	}
+
+	advice := Advice{Level: level, Previous: c.level, Reasons: reasons}
+	switch level {
+	case Severe:
+		advice.Suggestion = AudioOnly
+	case Poor:
+		advice.Suggestion = DisableIncomingVideo
+	default:
+		advice.Suggestion = Restore
+	}
+	c.level, c.candidate, c.streak = level, "", 0
+	return advice, true
+}
+
+// Forget drops the user's rating, e.g. when they leave the room.
+func (a *Advisor) Forget(socket, userID string) {
+	a.mu.Lock()
+	delete(a.connections, socket+"|"+userID)
+	a.mu.Unlock()
+}
@@ -0,0 +1,208 @@
+package quota
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What happens to an org past its storage quota.
+const (
+	StorageBlock        = "block"
+	StorageDeleteOldest = "delete_oldest"
+)
+
+// StorageWarnings are the shares of its storage quota, in percent, at which
+// an org is warned as its usage grows.
+var StorageWarnings = []int{80, 90, 100}
+
+// StorageUsage is what an org's recordings take up in storage, against its
+// quota. Limit is zero when the org has none.
+type StorageUsage struct {
+	OrgID      string `json:"orgID"`
+	Bytes      int64  `json:"bytes"`
+	Recordings int    `json:"recordings"`
+	Limit      int64  `json:"limit"`
+	Policy     string `json:"policy"`
+	Percent    int    `json:"percent"`
+}
+
+// Over reports whether the usage is at or past the quota.
+func (u StorageUsage) Over() bool {
+	return u.Limit > 0 && u.Bytes >= u.Limit
+}
+
+// Storage keeps orgs' recordings within their storage quota: it refuses new
+// recordings, or deletes the oldest ones, depending on the org's policy,
+// and warns orgs as they near their quota. A nil Storage allows everything.
+type Storage struct {
+	db    *mongo.Database
+	store storage.BlobStore
+	plans map[string]Limits
+	// warn is called when an org's usage grows past one of
+	// StorageWarnings.
+	warn func(usage StorageUsage, threshold int)
+}
+
+func NewStorage(db *mongo.Client, store storage.BlobStore, plans map[string]Limits, warn func(usage StorageUsage, threshold int)) *Storage {
+	return &Storage{db: db.Database("vidchat"), store: store, plans: plans, warn: warn}
+}
+
+// Usage sums the org's recordings not deleted: their video and their
+// highlights.
+func (s *Storage) Usage(ctx context.Context, orgID string) (StorageUsage, error) {
+	org := interfaces.Organization{ID: orgID}
+	err := s.db.Collection("orgs").FindOne(ctx, bson.M{"_id": orgID}).Decode(&org)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return StorageUsage{}, err
+	}
+	usage := StorageUsage{OrgID: orgID, Policy: org.StoragePolicy}
+	if usage.Policy == "" {
+		usage.Policy = StorageBlock
+	}
+	if !org.Unlimited {
+		usage.Limit = orgLimits(s.plans, org).MaxStorageBytes
+	}
+
+	cursor, err := s.db.Collection("recordings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"orgID": orgID, "status": bson.M{"$ne": interfaces.RecordingDeleted}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"bytes":      bson.M{"$sum": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$size", 0}}, bson.M{"$sum": "$highlights.size"}}}},
+			"recordings": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return usage, err
+	}
+	var totals []struct {
+		Bytes      int64 `bson:"bytes"`
+		Recordings int   `bson:"recordings"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return usage, err
+	}
+	if len(totals) > 0 {
+		usage.Bytes, usage.Recordings = totals[0].Bytes, totals[0].Recordings
+	}
+	if usage.Limit > 0 {
+		usage.Percent = int(usage.Bytes * 100 / usage.Limit)
+	}
+	return usage, nil
+}
+
+// Admit refuses a new recording for an org at its quota that blocks
+// recordings when full. Orgs deleting their oldest recordings always record.
+func (s *Storage) Admit(ctx context.Context, orgID string) error {
+	if s == nil || orgID == "" {
+		return nil
+	}
+	usage, err := s.Usage(ctx, orgID)
+	if err != nil {
+		log.Printf("Error reading storage usage of %s: %s", orgID, err)
+		return nil
+	}
+	if usage.Over() && usage.Policy != StorageDeleteOldest {
+		return &CapacityError{Scope: "org_storage"}
+	}
+	return nil
+}
+
+// Enforce applies the org's policy to its usage, once a recording added to
+// it, and warns the org of any threshold it grew past.
+func (s *Storage) Enforce(ctx context.Context, orgID string) {
+	if s == nil || orgID == "" {
+		return
+	}
+	usage, err := s.Usage(ctx, orgID)
+	if err != nil {
+		log.Printf("Error reading storage usage of %s: %s", orgID, err)
+		return
+	}
+	if usage.Over() && usage.Policy == StorageDeleteOldest {
+		if usage, err = s.deleteOldest(ctx, usage); err != nil {
+			log.Printf("Error freeing storage of %s: %s", orgID, err)
+		}
+	}
+	s.warnPast(ctx, usage)
+}
+
+// deleteOldest deletes the files of the org's oldest ready recordings until
+// it is under its quota. The recordings stay listed as deleted.
+func (s *Storage) deleteOldest(ctx context.Context, usage StorageUsage) (StorageUsage, error) {
+	recordings := s.db.Collection("recordings")
+	for usage.Over() {
+		var oldest interfaces.Recording
+		err := recordings.FindOne(ctx,
+			bson.M{"orgID": usage.OrgID, "status": interfaces.RecordingReady},
+			options.FindOne().SetSort(bson.D{{Key: "startedAt", Value: 1}}),
+		).Decode(&oldest)
+		if err == mongo.ErrNoDocuments {
+			return usage, nil
+		}
+		if err != nil {
+			return usage, err
+		}
+
+		keys := []string{oldest.Output, oldest.Thumbnail}
+		freed := oldest.Size
+		for _, highlight := range oldest.Highlights {
+			keys = append(keys, highlight.Output)
+			freed += highlight.Size
+		}
+		for _, key := range keys {
+			if key == "" {
+				continue
+			}
+			if err := s.store.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				return usage, err
+			}
+		}
+		_, err = recordings.UpdateOne(ctx, bson.M{"_id": oldest.ID}, bson.M{
+			"$set":   bson.M{"status": interfaces.RecordingDeleted, "deletedAt": time.Now()},
+			"$unset": bson.M{"output": "", "thumbnail": "", "highlights": ""},
+		})
+		if err != nil {
+			return usage, err
+		}
+		log.Printf("Deleted recording %s of %s to keep within its storage quota", oldest.ID, usage.OrgID)
+
+		usage.Bytes -= freed
+		usage.Recordings--
+		usage.Percent = int(usage.Bytes * 100 / usage.Limit)
+	}
+	return usage, nil
+}
+
+// warnPast warns the org once for the highest threshold its usage reached,
+// if it has not been warned of that one since its usage was last lower.
+func (s *Storage) warnPast(ctx context.Context, usage StorageUsage) {
+	level := 0
+	for _, threshold := range StorageWarnings {
+		if usage.Limit > 0 && usage.Percent >= threshold {
+			level = threshold
+		}
+	}
+	var previous struct {
+		Level int `bson:"level"`
+	}
+	err := s.db.Collection("storage_warnings").FindOneAndUpdate(ctx,
+		bson.M{"_id": usage.OrgID},
+		bson.M{"$set": bson.M{"level": level, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true),
+	).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Error saving storage warnings of %s: %s", usage.OrgID, err)
+		return
+	}
+	if level > previous.Level && s.warn != nil {
+		s.warn(usage, level)
+	}
+}
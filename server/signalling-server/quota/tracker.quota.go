@@ -0,0 +1,263 @@
+// Package quota enforces concurrency limits: live meetings and participants
+// per organization across all signalling nodes, and connections per node.
+// It also keeps each organization's recordings within its storage quota.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CapacityError is returned by Admit. Scope is "node", "org_meetings",
+// "org_participants" or, from Storage.Admit, "org_storage".
+type CapacityError struct {
+	Scope string
+}
+
+func (e *CapacityError) Error() string {
+	return "capacity_exceeded: " + e.Scope
+}
+
+type Limits struct {
+	MaxMeetings     int
+	MaxParticipants int
+	MaxStorageBytes int64
+}
+
+// ParsePlans parses "free=2:10,pro=20:200" (meetings:participants per plan),
+// optionally followed by the plan's storage quota in bytes, as in
+// "pro=20:200:107374182400".
+func ParsePlans(spec string) (map[string]Limits, error) {
+	plans := make(map[string]Limits)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		meetings, participants, ok2 := strings.Cut(value, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid plan quota %q", entry)
+		}
+		m, err := strconv.Atoi(meetings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan quota %q", entry)
+		}
+		participants, storage, hasStorage := strings.Cut(participants, ":")
+		p, err := strconv.Atoi(participants)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan quota %q", entry)
+		}
+		var bytes int64
+		if hasStorage {
+			if bytes, err = strconv.ParseInt(storage, 10, 64); err != nil || bytes < 0 {
+				return nil, fmt.Errorf("invalid plan quota %q", entry)
+			}
+		}
+		plans[name] = Limits{MaxMeetings: m, MaxParticipants: p, MaxStorageBytes: bytes}
+	}
+	return plans, nil
+}
+
+type usage struct {
+	Meetings     int `bson:"meetings"`
+	Participants int `bson:"participants"`
+}
+
+type cachedOrg struct {
+	org     interfaces.Organization
+	fetched time.Time
+}
+
+// Tracker counts live usage on this node and publishes it to the usage
+// collection, one document per org and node, so every node can check an
+// org's cluster-wide usage. Checks are best effort: two nodes admitting at
+// the same moment can overshoot a limit by one each.
+type Tracker struct {
+	db           *mongo.Database
+	node         string
+	plans        map[string]Limits
+	nodeCapacity int
+
+	mu    sync.Mutex
+	local map[string]*usage
+	total int
+	orgs  map[string]cachedOrg
+}
+
+func NewTracker(db *mongo.Client, node string, plans map[string]Limits, nodeCapacity int) *Tracker {
+	t := &Tracker{
+		db:           db.Database("vidchat"),
+		node:         node,
+		plans:        plans,
+		nodeCapacity: nodeCapacity,
+		local:        make(map[string]*usage),
+		orgs:         make(map[string]cachedOrg),
+	}
+
+	// Usage left behind by a previous run of this node is stale.
+	_, err := t.db.Collection("usage").DeleteMany(context.TODO(), bson.M{"node": node})
+	if err != nil {
+		log.Printf("Error resetting usage for %s: %s", node, err)
+	}
+	return t
+}
+
+// Admit reserves a participant slot, and a meeting slot when newMeeting is
+// set, for org. A nil Tracker admits everything.
+func (t *Tracker) Admit(ctx context.Context, org string, newMeeting bool) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	full := t.nodeCapacity > 0 && t.total >= t.nodeCapacity
+	t.mu.Unlock()
+	if full {
+		return &CapacityError{Scope: "node"}
+	}
+
+	if org != "" {
+		limits, unlimited := t.limits(ctx, org)
+		if !unlimited {
+			cluster, err := t.clusterUsage(ctx, org)
+			if err != nil {
+				log.Printf("Error reading usage for %s: %s", org, err)
+			}
+			if newMeeting && limits.MaxMeetings > 0 && cluster.Meetings+1 > limits.MaxMeetings {
+				return &CapacityError{Scope: "org_meetings"}
+			}
+			if limits.MaxParticipants > 0 && cluster.Participants+1 > limits.MaxParticipants {
+				return &CapacityError{Scope: "org_participants"}
+			}
+		}
+	}
+
+	t.adjust(org, 1, newMeeting)
+	return nil
+}
+
+// Release returns the slots taken by Admit.
+func (t *Tracker) Release(org string, endMeeting bool) {
+	if t == nil {
+		return
+	}
+	t.adjust(org, -1, endMeeting)
+}
+
+func (t *Tracker) adjust(org string, delta int, meeting bool) {
+	t.mu.Lock()
+	t.total += delta
+	current := t.local[org]
+	if current == nil {
+		current = &usage{}
+		t.local[org] = current
+	}
+	current.Participants += delta
+	if meeting {
+		current.Meetings += delta
+	}
+	snapshot := *current
+	t.mu.Unlock()
+
+	if org == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := t.db.Collection("usage").UpdateOne(ctx,
+			bson.M{"_id": org + "|" + t.node},
+			bson.M{"$set": bson.M{"org": org, "node": t.node, "meetings": snapshot.Meetings, "participants": snapshot.Participants, "updatedAt": time.Now()}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Error publishing usage for %s: %s", org, err)
+		}
+	}()
+}
+
+// clusterUsage sums the org's usage on other nodes with this node's live
+// counters.
+func (t *Tracker) clusterUsage(ctx context.Context, org string) (usage, error) {
+	t.mu.Lock()
+	total := usage{}
+	if local := t.local[org]; local != nil {
+		total = *local
+	}
+	t.mu.Unlock()
+
+	cursor, err := t.db.Collection("usage").Find(ctx, bson.M{"org": org, "node": bson.M{"$ne": t.node}})
+	if err != nil {
+		return total, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var other usage
+		if cursor.Decode(&other) == nil {
+			total.Meetings += other.Meetings
+			total.Participants += other.Participants
+		}
+	}
+	return total, cursor.Err()
+}
+
+// limits resolves the org's effective limits, caching the org document.
+func (t *Tracker) limits(ctx context.Context, org string) (Limits, bool) {
+	t.mu.Lock()
+	cached, ok := t.orgs[org]
+	t.mu.Unlock()
+
+	if !ok || time.Since(cached.fetched) > 30*time.Second {
+		cached = cachedOrg{org: interfaces.Organization{ID: org}, fetched: time.Now()}
+		err := t.db.Collection("orgs").FindOne(ctx, bson.M{"_id": org}).Decode(&cached.org)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Error loading org %s: %s", org, err)
+		}
+		t.mu.Lock()
+		t.orgs[org] = cached
+		t.mu.Unlock()
+	}
+
+	return orgLimits(t.plans, cached.org), cached.org.Unlimited
+}
+
+// orgLimits resolves the org's limits from its plan and its own overrides.
+func orgLimits(plans map[string]Limits, org interfaces.Organization) Limits {
+	limits := plans[org.Plan]
+	if org.Plan == "" {
+		limits = plans["default"]
+	}
+	if org.MaxMeetings > 0 {
+		limits.MaxMeetings = org.MaxMeetings
+	}
+	if org.MaxParticipants > 0 {
+		limits.MaxParticipants = org.MaxParticipants
+	}
+	if org.MaxStorageBytes > 0 {
+		limits.MaxStorageBytes = org.MaxStorageBytes
+	}
+	return limits
+}
+
+// Forget drops the cached org so an admin change applies immediately on
+// this node.
+func (t *Tracker) Forget(org string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.orgs, org)
+	t.mu.Unlock()
+}
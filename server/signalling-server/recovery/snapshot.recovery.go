@@ -0,0 +1,108 @@
+// Package recovery persists room snapshots so a restarted signalling node can
+// put reconnecting clients back into the room they left.
+package recovery
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store writes snapshots to the room_snapshots collection. Changes are
+// coalesced: a room marked dirty is written at most once per interval. A nil
+// Store persists nothing.
+type Store struct {
+	collection *mongo.Collection
+	interval   time.Duration
+
+	mu    sync.Mutex
+	dirty map[string]func() interfaces.RoomSnapshot
+}
+
+func NewStore(db *mongo.Client, interval time.Duration) *Store {
+	s := &Store{
+		collection: db.Database("vidchat").Collection("room_snapshots"),
+		interval:   interval,
+		dirty:      make(map[string]func() interfaces.RoomSnapshot),
+	}
+	go s.run()
+	return s
+}
+
+// MarkDirty schedules a write of the snapshot returned by capture.
+func (s *Store) MarkDirty(socket string, capture func() interfaces.RoomSnapshot) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.dirty[socket] = capture
+	s.mu.Unlock()
+}
+
+// Load returns the saved snapshot for socket, or nil if there is none.
+func (s *Store) Load(ctx context.Context, socket string) (*interfaces.RoomSnapshot, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var snapshot interfaces.RoomSnapshot
+	err := s.collection.FindOne(ctx, bson.M{"_id": socket}).Decode(&snapshot)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Delete forgets the room, e.g. once its last participant has left.
+func (s *Store) Delete(socket string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.dirty, socket)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": socket}); err != nil {
+		log.Printf("Error deleting snapshot for %s: %s", socket, err)
+	}
+}
+
+// Flush writes all pending snapshots now.
+func (s *Store) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = make(map[string]func() interfaces.RoomSnapshot)
+	s.mu.Unlock()
+
+	for socket, capture := range dirty {
+		snapshot := capture()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": socket}, snapshot, options.Replace().SetUpsert(true))
+		cancel()
+		if err != nil {
+			log.Printf("Error saving snapshot for %s: %s", socket, err)
+		}
+	}
+}
+
+func (s *Store) run() {
+	for {
+		time.Sleep(s.interval)
+		s.Flush()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// handoffGrace is how long a participant whose connection dropped stays in
+// the roster, waiting for them to resume from another network.
+var handoffGrace = 15 * time.Second
+
+// suspend handles a closed connection. Its users leave only if they do not
+// resume within handoffGrace.
+func suspend(clients *interfaces.Room, connection *interfaces.Connection) {
+	if handoffGrace <= 0 {
+		clients.Detach(connection)
+		return
+	}
+	users := clients.Suspend(connection)
+	if len(users) == 0 {
+		return
+	}
+	for _, user := range users {
+		recordEvent(clients, analytics.EventDropped, user, nil)
+	}
+	time.AfterFunc(handoffGrace, func() {
+		for _, user := range users {
+			clients.Expire(user)
+		}
+	})
+}
+
+// resume handles a connect that presents the participant's resume token,
+// typically from a client that changed networks. The participant keeps
+// their place without a leave and join being seen, their old connection is
+// closed if it is still around, and everyone is asked to restart ICE with
+// them. It reports whether the frame was handled.
+func resume(socket string, connection *interfaces.Connection, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) bool {
+	token := resumeToken(frame)
+	if token == "" {
+		return false
+	}
+
+	old, ok := clients.Resume(envelope.UserID, token, connection)
+	if !ok {
+		return false
+	}
+	if old != nil {
+		go old.Disconnect(interfaces.CloseReplaced, "replaced")
+	}
+
+	participant, _ := clients.Participant(envelope.UserID)
+	connection.Send(interfaces.Message{Type: "session_joined", UserID: envelope.UserID, Data: gin.H{
+		"participantID": participant.ID,
+		"name":          participant.Name,
+		"role":          participant.Role,
+		"room":          clients.Snapshot(socket),
+		"resumeToken":   participant.ResumeToken,
+		"policy":        clients.Settings.Media.Limits(clients.Len()),
+		"resumed":       true,
+	}})
+
+	deliverPending(clients, envelope.UserID, connection)
+	recordEvent(clients, analytics.EventResumed, envelope.UserID, nil)
+
+	restart, _ := json.Marshal(interfaces.Message{Type: "ice_restart", UserID: envelope.UserID, Data: gin.H{"reason": "network_change"}})
+	for _, failed := range broadcaster.Broadcast(clients.Clients(), restart, "ice_restart") {
+		suspend(clients, failed)
+	}
+	return true
+}
+
+// resumeToken returns the resume token a connect presents, if any.
+func resumeToken(frame json.RawMessage) string {
+	var request struct {
+		Data struct {
+			ResumeToken string `json:"resumeToken"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &request)
+	return request.Data.ResumeToken
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// expireAccessLogs removes recording views past their org's
+// accessRetentionDays every interval. The users service does the same for
+// the audit log.
+func expireAccessLogs(db *mongo.Client, interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		cursor, err := db.Database("vidchat").Collection("orgs").Find(ctx, bson.M{"accessRetentionDays": bson.M{"$gt": 0}})
+		if err != nil {
+			log.Printf("Error listing access log retention: %s", err)
+			cancel()
+			continue
+		}
+		var orgs []interfaces.Organization
+		if err := cursor.All(ctx, &orgs); err != nil {
+			log.Printf("Error listing access log retention: %s", err)
+		}
+		for _, org := range orgs {
+			cutoff := time.Now().AddDate(0, 0, -org.AccessRetentionDays)
+			_, err := db.Database("vidchat").Collection("recording_views").DeleteMany(ctx, bson.M{
+				"orgID":    org.ID,
+				"viewedAt": bson.M{"$lt": cutoff},
+			})
+			if err != nil {
+				log.Printf("Error expiring access log of %s: %s", org.ID, err)
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// roomStateVersion is the version of the room state format; imports of
+// other versions are refused.
+const roomStateVersion = 1
+
+// roomStateEvents bounds the timeline events a room state carries.
+const roomStateEvents = 200
+
+// maxClientProtocol bounds the protocol version a client may report.
+const maxClientProtocol = 32
+
+// roomState is a live room's state, exported for support to reproduce
+// reported issues on a development server. Participants are renamed and
+// stripped of what identifies them, so the state can be shared.
+type roomState struct {
+	Version      int                          `json:"version"`
+	Socket       string                       `json:"socket"`
+	NodeVersion  string                       `json:"nodeVersion,omitempty"`
+	ExportedAt   time.Time                    `json:"exportedAt"`
+	Settings     interfaces.SessionSettings   `json:"settings"`
+	Locked       bool                         `json:"locked"`
+	Participants []interfaces.Participant     `json:"participants"`
+	Lobby        []string                     `json:"lobby,omitempty"`
+	Layout       *interfaces.Layout           `json:"layout,omitempty"`
+	Floor        []string                     `json:"floor,omitempty"`
+	Promoted     []string                     `json:"promoted,omitempty"`
+	Sharing      []string                     `json:"sharing,omitempty"`
+	Agenda       *interfaces.Agenda           `json:"agenda,omitempty"`
+	Connections  []interfaces.ConnectionState `json:"connections"`
+	Events       []analytics.TimelineEvent    `json:"events"`
+}
+
+// clientProtocol returns the protocol version a client reports with the
+// protocol query parameter when opening its socket.
+func clientProtocol(r *http.Request) string {
+	protocol := r.URL.Query().Get("protocol")
+	if len(protocol) > maxClientProtocol {
+		return ""
+	}
+	return protocol
+}
+
+// pseudonyms gives each user ID a stable stand-in within one export.
+type pseudonyms map[string]string
+
+func (p pseudonyms) user(id string) string {
+	if id == "" {
+		return ""
+	}
+	if pseudonym, ok := p[id]; ok {
+		return pseudonym
+	}
+	p[id] = fmt.Sprintf("user-%d", len(p)+1)
+	return p[id]
+}
+
+func (p pseudonyms) users(ids []string) []string {
+	mapped := make([]string, len(ids))
+	for i, id := range ids {
+		mapped[i] = p.user(id)
+	}
+	return mapped
+}
+
+// exportRoomState returns the sanitized state of the room at :socket,
+// with its connections and its last timeline events. Rooms live on the
+// node owning them, so other nodes redirect there.
+func exportRoomState(c *gin.Context) {
+	socket := c.Param("socket")
+	if !ring.Owns(socket) {
+		c.Redirect(http.StatusTemporaryRedirect, ring.Owner(socket).URL+c.Request.URL.RequestURI())
+		return
+	}
+	socketsMu.Lock()
+	clients := sockets[socket]
+	socketsMu.Unlock()
+	if clients == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room is not live."})
+		return
+	}
+
+	snapshot := clients.Snapshot(socket)
+	names := pseudonyms{}
+	state := roomState{
+		Version:     roomStateVersion,
+		Socket:      socket,
+		NodeVersion: ring.Self().Version,
+		ExportedAt:  time.Now(),
+		Settings:    clients.Settings,
+		Locked:      snapshot.Locked,
+		Lobby:       names.users(snapshot.Lobby),
+		Layout:      snapshot.Layout,
+		Floor:       snapshot.Floor,
+		Promoted:    names.users(snapshot.Promoted),
+		Sharing:     names.users(snapshot.Sharing),
+		Agenda:      snapshot.Agenda,
+	}
+	for _, participant := range snapshot.Participants {
+		participant.UserID = names.user(participant.UserID)
+		participant.Name = "Participant " + strings.TrimPrefix(participant.UserID, "user-")
+		participant.Avatar = ""
+		if participant.Phone != "" {
+			participant.Phone = "redacted"
+		}
+		// The metadata map is the live participant's, so it is replaced.
+		metadata := make(map[string]string, len(participant.Metadata))
+		for key := range participant.Metadata {
+			metadata[key] = "redacted"
+		}
+		participant.Metadata = metadata
+		state.Participants = append(state.Participants, participant)
+	}
+	for _, connection := range clients.ConnectionStates() {
+		connection.UserID = names.user(connection.UserID)
+		state.Connections = append(state.Connections, connection)
+	}
+
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+	events, err := analytics.RecentTimeline(ctx, database, clients.Session, roomStateEvents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load the room's events."})
+		return
+	}
+	// Only numbers and flags are kept of what events carry: strings may be
+	// names or what was said.
+	for i := range events {
+		events[i].UserID = names.user(events[i].UserID)
+		for key, value := range events[i].Data {
+			switch value.(type) {
+			case bool, int, int32, int64, float64:
+			default:
+				delete(events[i].Data, key)
+			}
+		}
+	}
+	state.Events = events
+
+	c.JSON(http.StatusOK, state)
+}
+
+// importRoomState recreates an exported room at :socket, on development
+// servers started with ROOM_IMPORT, so a reported issue can be reproduced
+// by connecting clients as the exported users. The room has no session, so
+// nothing it does is recorded. The exported events are for reading along;
+// they are not replayed.
+func importRoomState(c *gin.Context) {
+	var state roomState
+	if err := c.ShouldBindJSON(&state); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if state.Version != roomStateVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Only version %d room states can be imported.", roomStateVersion)})
+		return
+	}
+
+	clients := interfaces.NewRoom()
+	clients.Settings = state.Settings
+	clients.Restore(interfaces.RoomSnapshot{
+		Participants: state.Participants,
+		Locked:       state.Locked,
+		Lobby:        state.Lobby,
+		Layout:       state.Layout,
+		Floor:        state.Floor,
+		Promoted:     state.Promoted,
+		Sharing:      state.Sharing,
+		Agenda:       state.Agenda,
+	})
+
+	socket := c.Param("socket")
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+	if sockets[socket] != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A room is already live at that socket."})
+		return
+	}
+	sockets[socket] = clients
+	c.JSON(http.StatusCreated, gin.H{"socket": socket, "participants": len(state.Participants)})
+}
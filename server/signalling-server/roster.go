@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// joinedName returns the display name a connect frame asks for.
+func joinedName(frame json.RawMessage) string {
+	var request struct {
+		Data struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	json.Unmarshal(frame, &request)
+	return request.Data.Name
+}
+
+// joinedMetadata returns the metadata a connect frame attaches to the
+// participant, nil if it has none.
+func joinedMetadata(frame json.RawMessage) (map[string]string, error) {
+	var request struct {
+		Data struct {
+			Metadata map[string]string `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(frame, &request); err != nil {
+		return nil, errors.New("metadata values must be strings")
+	}
+	return request.Data.Metadata, interfaces.ValidateMetadata(request.Data.Metadata)
+}
+
+// announceJoin tells everyone else in the room that the participant joined,
+// with the ID and display name the server gave them. Clients tell
+// participants apart by ID: neither UserIDs, which clients choose, nor
+// names are guaranteed to be unique.
+func announceJoin(clients *interfaces.Room, participant interfaces.Participant) {
+	frame, err := json.Marshal(interfaces.Message{Type: "participant_joined", UserID: participant.UserID, Data: gin.H{
+		"participantID": participant.ID,
+		"name":          participant.Name,
+		"avatar":        participant.Avatar,
+		"role":          participant.Role,
+		"phone":         participant.Phone != "",
+		"metadata":      participant.Metadata,
+		"lowData":       participant.LowData,
+	}})
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+
+	recipients := clients.Clients()
+	delete(recipients, participant.UserID)
+	for _, failed := range broadcaster.Broadcast(recipients, frame, "participant_joined") {
+		suspend(clients, failed)
+	}
+}
@@ -0,0 +1,134 @@
+// Package rules evaluates the policies org admins write for their sessions,
+// such as "guests cannot join before the host" or "only hosts may record".
+package rules
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Actions rules can apply to.
+const (
+	Join   = "join"
+	Record = "record"
+)
+
+// Variables lists what a rule's condition may refer to for each action.
+// now.hour (0-23) and now.weekday (0 is Sunday) are in UTC.
+var Variables = map[string][]string{
+	Join:   {"user.id", "user.role", "user.guest", "room.participants", "room.host_present", "now.hour", "now.weekday"},
+	Record: {"user.id", "user.role", "user.guest", "room.participants", "room.host_present", "now.hour", "now.weekday", "recording.auto"},
+}
+
+// Validate compiles rule's condition for its action.
+func Validate(rule interfaces.Rule) error {
+	_, err := Compile(rule.Condition, Variables[rule.Action])
+	return err
+}
+
+type compiled struct {
+	rule interfaces.Rule
+	expr *Expr
+}
+
+type cachedRules struct {
+	rules   []compiled
+	fetched time.Time
+}
+
+// Engine checks actions against their org's rules, caching each org's rules
+// for a short while. A nil Engine allows everything.
+type Engine struct {
+	collection *mongo.Collection
+
+	mu   sync.Mutex
+	orgs map[string]cachedRules
+}
+
+func NewEngine(db *mongo.Client) *Engine {
+	return &Engine{
+		collection: db.Database("vidchat").Collection("rules"),
+		orgs:       make(map[string]cachedRules),
+	}
+}
+
+// Check returns the first of the org's enabled rules for action whose
+// condition holds, or nil. A condition that fails to evaluate, e.g. on a
+// type mismatch, is logged and treated as not holding.
+func (e *Engine) Check(ctx context.Context, org, action string, vars map[string]interface{}) *interfaces.Rule {
+	if e == nil || org == "" {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	vars["now.hour"] = now.Hour()
+	vars["now.weekday"] = int(now.Weekday())
+
+	for _, c := range e.rules(ctx, org) {
+		if c.rule.Action != action {
+			continue
+		}
+		holds, err := c.expr.Eval(vars)
+		if err != nil {
+			log.Printf("Error evaluating rule %s of %s: %s", c.rule.ID, org, err)
+			continue
+		}
+		if holds {
+			rule := c.rule
+			return &rule
+		}
+	}
+	return nil
+}
+
+func (e *Engine) rules(ctx context.Context, org string) []compiled {
+	e.mu.Lock()
+	cached, ok := e.orgs[org]
+	e.mu.Unlock()
+	if ok && time.Since(cached.fetched) < 30*time.Second {
+		return cached.rules
+	}
+
+	cached = cachedRules{fetched: time.Now()}
+	cursor, err := e.collection.Find(ctx, bson.M{"orgID": org, "disabled": bson.M{"$ne": true}})
+	if err != nil {
+		log.Printf("Error loading rules of %s: %s", org, err)
+		return nil
+	}
+	var saved []interfaces.Rule
+	if err := cursor.All(ctx, &saved); err != nil {
+		log.Printf("Error loading rules of %s: %s", org, err)
+		return nil
+	}
+	for _, rule := range saved {
+		expr, err := Compile(rule.Condition, Variables[rule.Action])
+		if err != nil {
+			log.Printf("Skipping invalid rule %s of %s: %s", rule.ID, org, err)
+			continue
+		}
+		cached.rules = append(cached.rules, compiled{rule: rule, expr: expr})
+	}
+
+	e.mu.Lock()
+	e.orgs[org] = cached
+	e.mu.Unlock()
+	return cached.rules
+}
+
+// Forget drops the org's cached rules so an admin change applies
+// immediately on this node.
+func (e *Engine) Forget(org string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	delete(e.orgs, org)
+	e.mu.Unlock()
+}
@@ -0,0 +1,490 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled condition. The language is a small subset of CEL:
+//
+//	literals    true false 42 1.5 "text" 'text' ["a", "b"]
+//	variables   user.role room.participants ...
+//	operators   ! && || == != < <= > >= in ( )
+//	methods     s.startsWith(x) s.endsWith(x) s.contains(x) list.size()
+//
+// so policies written for it keep working under a full CEL implementation.
+type Expr struct {
+	source string
+	root   node
+}
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+// Compile parses source, rejecting references to variables not in known.
+func Compile(source string, known []string) (*Expr, error) {
+	p := &parser{known: make(map[string]bool, len(known))}
+	for _, name := range known {
+		p.known[name] = true
+	}
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p.tokens = tokens
+
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at %d", p.peek().text, p.peek().pos)
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// Eval evaluates the condition against vars. A condition that does not
+// produce a bool is an error.
+func (e *Expr) Eval(vars map[string]interface{}) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition is %T, not bool", value)
+	}
+	return result, nil
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+const (
+	tokenEnd = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(source) && (isIdent(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, source[start:i], start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, source[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			var text strings.Builder
+			for i++; i < len(source) && rune(source[i]) != c; i++ {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				text.WriteByte(source[i])
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, text.String(), start})
+		default:
+			op := source[i : i+1]
+			if i+1 < len(source) {
+				switch two := source[i : i+2]; two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			if !strings.Contains("&& || == != <= >= < > ! ( ) [ ] ,", op) || op == "&" || op == "|" || op == "=" {
+				return nil, fmt.Errorf("unexpected %q at %d", op, i)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEnd, "end of condition", len(source)}), nil
+}
+
+func isIdent(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
+
+type parser struct {
+	tokens []token
+	known  map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[0]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[0]
+	if t.kind != tokenEnd {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op || t.kind == tokenIdent && t.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return fmt.Errorf("expected %q at %d", op, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.and(); err == nil {
+			left = logical{"||", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.comparison()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.comparison(); err == nil {
+			left = logical{"&&", left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return compare{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literal{number}, nil
+	case tokenString:
+		return literal{t.text}, nil
+	case tokenIdent:
+		return p.ident(t)
+	case tokenOp:
+		switch t.text {
+		case "(":
+			inner, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			var items list
+			for !p.accept("]") {
+				if len(items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// ident resolves a dotted name to a literal, a variable or a method call on
+// a variable.
+func (p *parser) ident(t token) (node, error) {
+	switch t.text {
+	case "true":
+		return literal{true}, nil
+	case "false":
+		return literal{false}, nil
+	}
+
+	name, method := t.text, ""
+	if p.peek().kind == tokenOp && p.peek().text == "(" {
+		dot := strings.LastIndex(t.text, ".")
+		if dot < 0 {
+			return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+		}
+		name, method = t.text[:dot], t.text[dot+1:]
+	}
+	if !p.known[name] {
+		return nil, fmt.Errorf("unknown variable %q at %d", name, t.pos)
+	}
+	if method == "" {
+		return variable(name), nil
+	}
+
+	p.next()
+	var args []node
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	call := call{method: method, receiver: variable(name), args: args}
+	if arity, ok := methods[method]; !ok || arity != len(args) {
+		return nil, fmt.Errorf("unknown method %s/%d at %d", method, len(args), t.pos)
+	}
+	return call, nil
+}
+
+type literal struct{ value interface{} }
+
+func (n literal) eval(map[string]interface{}) (interface{}, error) { return n.value, nil }
+
+type variable string
+
+func (n variable) eval(vars map[string]interface{}) (interface{}, error) {
+	value, ok := vars[string(n)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not set", string(n))
+	}
+	return normalize(value), nil
+}
+
+// normalize maps Go values onto the types conditions work with: bool,
+// float64, string and []interface{}.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	}
+	return value
+}
+
+type list []node
+
+func (n list) eval(vars map[string]interface{}) (interface{}, error) {
+	items := make([]interface{}, len(n))
+	for i, item := range n {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = value
+	}
+	return items, nil
+}
+
+type not struct{ operand node }
+
+func (n not) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a bool, got %T", value)
+	}
+	return !b, nil
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n logical) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	left, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s needs bools, got %T", n.op, value)
+	}
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return left, nil
+	}
+	value, err = n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s needs bools, got %T", n.op, value)
+	}
+	return right, nil
+}
+
+type compare struct {
+	op          string
+	left, right node
+}
+
+func (n compare) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "in":
+		items, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in needs a list, got %T", right)
+		}
+		for _, item := range items {
+			if item == left {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("%s needs two numbers or two strings, got %T and %T", n.op, left, right)
+		}
+		l, r = float64(strings.Compare(ls, rs)), 0
+	}
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	}
+	return l >= r, nil
+}
+
+// methods maps the supported methods to their number of arguments.
+var methods = map[string]int{"startsWith": 1, "endsWith": 1, "contains": 1, "size": 0}
+
+type call struct {
+	method   string
+	receiver node
+	args     []node
+}
+
+func (n call) eval(vars map[string]interface{}) (interface{}, error) {
+	receiver, err := n.receiver.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.method == "size" {
+		switch v := receiver.(type) {
+		case string:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size needs a string or list, got %T", receiver)
+	}
+
+	s, ok := receiver.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string, got %T", n.method, receiver)
+	}
+	arg, err := n.args[0].eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	x, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string argument, got %T", n.method, arg)
+	}
+	switch n.method {
+	case "startsWith":
+		return strings.HasPrefix(s, x), nil
+	case "endsWith":
+		return strings.HasSuffix(s, x), nil
+	}
+	return strings.Contains(s, x), nil
+}
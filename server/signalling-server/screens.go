@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// shareScreen tracks who is sharing their screen from the
+// screen_share_start and screen_share_stop messages, so the running
+// recordings can record each share as its own asset.
+func shareScreen(socket string, clients *interfaces.Room, envelope interfaces.Envelope) {
+	var sharing bool
+	switch envelope.Type {
+	case "screen_share_start":
+		sharing = true
+	case "screen_share_stop":
+		sharing = false
+	default:
+		return
+	}
+	if !clients.SetSharing(envelope.UserID, sharing) {
+		return
+	}
+	snapshots.MarkDirty(socket, func() interfaces.RoomSnapshot { return clients.Snapshot(socket) })
+	if sharing {
+		go startScreen(clients.Session, envelope.UserID)
+		go markScreen(clients, envelope.UserID)
+	} else {
+		go stopScreen(clients.Session, envelope.UserID)
+	}
+}
+
+func startScreen(session, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	screens.Start(ctx, session, userID)
+}
+
+func stopScreen(session, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	screens.Stop(ctx, session, userID)
+}
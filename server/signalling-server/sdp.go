@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// codecs is the deployment's codec policy, which rooms can only narrow.
+var codecs interfaces.CodecPolicy
+
+var sdpMedia = []byte("m=")
+
+// rewriteSDP applies the room's codec policy and Opus settings to the
+// session description in a frame carrying SDP, so the peers negotiate the
+// codecs and FEC, DTX and RED the room asks for. In relay only rooms it also
+// strips every candidate but relayed ones. Descriptions are raw SDP or a
+// JSON RTCSessionDescription. Any other frame is returned as is.
+func rewriteSDP(clients *interfaces.Room, frame json.RawMessage) json.RawMessage {
+	policy := clients.Settings.Audio
+	options := media.OpusOptions{FEC: policy.FEC, DTX: policy.DTX, RED: policy.RED}
+	effective := clients.Settings.Codecs.Within(codecs)
+	filtering := len(effective.Allowed) > 0 || len(effective.Preferred) > 0
+	relayOnly := clients.Settings.RelayOnly
+	if (!options.Enabled() && !filtering && !relayOnly) || !bytes.Contains(frame, sdpMedia) {
+		return frame
+	}
+	rewrite := func(sdp string) string {
+		sdp = media.MungeOpus(media.FilterCodecs(sdp, effective.Allowed, effective.Preferred), options)
+		if relayOnly {
+			sdp = media.RelayCandidates(sdp)
+		}
+		return sdp
+	}
+
+	var message map[string]json.RawMessage
+	var description string
+	if json.Unmarshal(frame, &message) != nil || json.Unmarshal(message["description"], &description) != nil || description == "" {
+		return frame
+	}
+
+	var session map[string]interface{}
+	if json.Unmarshal([]byte(description), &session) == nil {
+		sdp, ok := session["sdp"].(string)
+		if !ok {
+			return frame
+		}
+		session["sdp"] = rewrite(sdp)
+		encoded, err := json.Marshal(session)
+		if err != nil {
+			return frame
+		}
+		description = string(encoded)
+	} else {
+		description = rewrite(description)
+	}
+
+	encoded, err := json.Marshal(description)
+	if err != nil {
+		return frame
+	}
+	message["description"] = encoded
+	rewritten, err := json.Marshal(message)
+	if err != nil {
+		return frame
+	}
+	return rewritten
+}
+
+// withoutAV1 removes AV1 from an allowed codec list. An empty list, which
+// allows everything, becomes every other video codec.
+func withoutAV1(allowed []string) []string {
+	hasVideo := false
+	for _, codec := range allowed {
+		for _, video := range media.VideoCodecs {
+			if strings.EqualFold(codec, video) {
+				hasVideo = true
+			}
+		}
+	}
+	if !hasVideo {
+		allowed = append(allowed, media.VideoCodecs...)
+	}
+
+	var kept []string
+	for _, codec := range allowed {
+		if !strings.EqualFold(codec, "AV1") {
+			kept = append(kept, codec)
+		}
+	}
+	return kept
+}
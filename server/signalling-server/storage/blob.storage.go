@@ -0,0 +1,159 @@
+// Package storage abstracts the object stores that hold recordings, avatars,
+// shared files and transcripts, so deployments can pick S3, MinIO, GCS or
+// plain disk without the callers knowing which.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+type Info struct {
+	Size        int64
+	ContentType string
+	Modified    time.Time
+}
+
+// BlobStore stores opaque objects under slash-separated keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get reads length bytes from offset; a negative length reads to the end.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type Config struct {
+	// Backend is one of "local", "s3", "minio" or "gcs".
+	Backend string
+
+	// Dir is the root directory of the local backend.
+	Dir string
+
+	Bucket string
+
+	// Endpoint of an S3-compatible service, e.g. https://minio:9000. Empty
+	// means AWS S3 in Region.
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+
+	// GCSCredentials is a service account JSON key. Without one the GCE
+	// metadata server is asked for tokens, as on GKE with workload identity.
+	GCSCredentials []byte
+}
+
+// New selects the store named in the config.
+func New(config Config) (BlobStore, error) {
+	switch config.Backend {
+	case "", "local":
+		if config.Dir == "" {
+			return nil, fmt.Errorf("local storage requires a directory")
+		}
+		return NewLocal(config.Dir), nil
+	case "s3", "minio":
+		if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+			return nil, fmt.Errorf("%s storage requires a bucket, access key and secret key", config.Backend)
+		}
+		if config.Backend == "minio" {
+			if config.Endpoint == "" {
+				return nil, fmt.Errorf("minio storage requires an endpoint")
+			}
+			config.PathStyle = true
+		}
+		return NewS3(config), nil
+	case "gcs":
+		if config.Bucket == "" {
+			return nil, fmt.Errorf("gcs storage requires a bucket")
+		}
+		return NewGCS(config.Bucket, config.GCSCredentials)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+}
+
+// Object reads a blob as an io.ReadSeeker, fetching only the ranges that
+// are actually read. It suits http.ServeContent.
+type Object struct {
+	Info
+
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	offset int64
+	body   io.ReadCloser
+}
+
+// Open stats key and returns a seekable reader for it.
+func Open(ctx context.Context, store BlobStore, key string) (*Object, error) {
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Info: info, ctx: ctx, store: store, key: key}, nil
+}
+
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.store.Get(o.ctx, o.key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek before start of %s", o.key)
+	}
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+func (o *Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// cleanKey rejects keys that could escape their bucket or directory.
+func cleanKey(key string) (string, error) {
+	key = strings.TrimLeft(key, "/")
+	if key == "" {
+		return "", fmt.Errorf("empty blob key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return key, nil
+}
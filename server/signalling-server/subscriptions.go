@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/media"
+)
+
+// subscriber is the media backend when it routes video through an SFU that
+// can choose what each participant receives.
+var subscriber media.Subscriber
+
+// updateSubscriptions handles a subscribe or unsubscribe from a client
+// choosing whose video it receives, e.g. the tiles on its current page.
+// Publishers are told so that peers in a mesh stop sending video nobody
+// renders; an SFU backend is also told to stop forwarding it.
+func updateSubscriptions(socket string, clients *interfaces.Room, envelope interfaces.Envelope, frame json.RawMessage) {
+	var request struct {
+		Data struct {
+			Users []string `json:"users"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(frame, &request) != nil {
+		return
+	}
+
+	var changed []string
+	if envelope.Type == "subscribe" {
+		changed = clients.Subscribe(envelope.UserID, request.Data.Users)
+	} else {
+		changed = clients.Unsubscribe(envelope.UserID, request.Data.Users)
+	}
+
+	publishers := clients.Clients()
+	for _, publisher := range changed {
+		connection := publishers[publisher]
+		if connection == nil {
+			continue
+		}
+		if envelope.Type == "subscribe" {
+			connection.Send(videoSubscribe(clients, envelope.UserID, publisher))
+		} else {
+			connection.Send(interfaces.Message{Type: "video_unsubscribe", UserID: envelope.UserID, To: publisher})
+		}
+	}
+
+	subscribed, _ := clients.Subscriptions(envelope.UserID)
+	if connection := clients.Get(envelope.UserID); connection != nil {
+		connection.Send(interfaces.Message{Type: "subscriptions", UserID: envelope.UserID, Data: gin.H{"users": subscribed}})
+	}
+
+	if subscriber == nil || len(changed) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := subscriber.SetSubscriptions(ctx, clients.Session, envelope.UserID, changed, envelope.Type == "subscribe"); err != nil {
+			log.Printf("Error updating subscriptions of %s in %s: %s", envelope.UserID, socket, err)
+		}
+	}()
+}
+
+// getSubscriptionStats reports how many video streams a room's participants
+// receive against everyone receiving everyone.
+func getSubscriptionStats(c *gin.Context) {
+	_, clients, ok := hostRoom(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, clients.SubscriptionStats())
+}
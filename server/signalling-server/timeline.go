@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// relayedEvents maps the messages clients relay about their own media, and
+// their reactions, to the timeline events they are recorded as.
+var relayedEvents = map[string]string{
+	"mute":               analytics.EventMute,
+	"unmute":             analytics.EventUnmute,
+	"screen_share_start": analytics.EventScreenShareStart,
+	"screen_share_stop":  analytics.EventScreenShareStop,
+	"reaction":           analytics.EventReaction,
+}
+
+// recordEvent adds an event about the user to the room's timeline.
+func recordEvent(clients *interfaces.Room, eventType, userID string, data map[string]interface{}) {
+	event := analytics.TimelineEvent{Type: eventType, UserID: userID, Data: data}
+	if participant, ok := clients.Participant(userID); ok {
+		event.ParticipantID = participant.ID
+	}
+	timeline.Record(clients.Session, event)
+}
+
+// recordJoin adds the participant's join to the room's timeline.
+func recordJoin(clients *interfaces.Room, participant interfaces.Participant) {
+	data := map[string]interface{}{"name": participant.Name, "role": participant.Role}
+	if participant.Phone != "" {
+		data["phone"] = true
+	}
+	timeline.Record(clients.Session, analytics.TimelineEvent{
+		Type:          analytics.EventJoin,
+		UserID:        participant.UserID,
+		ParticipantID: participant.ID,
+		Data:          data,
+	})
+}
@@ -0,0 +1,140 @@
+package transcode
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/analytics"
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// Reactions are counted over windows of reactionWindow; a window with at
+// least minSpike reactions and spikeFactor times the recording's average
+// is a spike worth a highlight.
+const (
+	reactionWindow = 10 * time.Second
+	minSpike       = 5
+	spikeFactor    = 3
+)
+
+// moment is a point of a recording worth a highlight, at an offset in
+// seconds.
+type moment struct {
+	at     float64
+	reason string
+	title  string
+}
+
+// highlights cuts clips of the processed video around the markers hosts
+// dropped and the spikes in reactions, markers first, and stores them. A
+// clip that fails ends the cutting and the ones already stored are kept.
+func (p *Pool) highlights(ctx context.Context, recording *interfaces.Recording, video string, duration float64) ([]interfaces.RecordingHighlight, error) {
+	if p.config.HighlightLength <= 0 || duration <= 0 {
+		return nil, nil
+	}
+	var moments []moment
+	for _, marker := range recording.Markers {
+		if marker.Kind == interfaces.MarkerManual {
+			moments = append(moments, moment{at: marker.Offset, reason: interfaces.HighlightMarker, title: marker.Title})
+		}
+	}
+	reactions, err := analytics.LoadTimeline(ctx, p.db, recording.SessionID, []string{analytics.EventReaction})
+	if err != nil {
+		return nil, err
+	}
+	moments = append(moments, spikes(recording.StartedAt, reactions, duration)...)
+
+	base := strings.TrimSuffix(video, filepath.Ext(video))
+	length := p.config.HighlightLength.Seconds()
+	var clips []interfaces.RecordingHighlight
+	for i, clip := range pickClips(moments, length, duration, p.config.MaxHighlights) {
+		clip.ID = strconv.Itoa(i + 1)
+		file := base + ".highlight-" + clip.ID + ".mp4"
+		err := p.exec(ctx, p.config.FFmpeg, "-y",
+			"-ss", strconv.FormatFloat(clip.StartOffset, 'f', 3, 64), "-i", video,
+			"-t", strconv.FormatFloat(clip.EndOffset-clip.StartOffset, 'f', 3, 64),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+			"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart", file)
+		if err != nil {
+			return clips, err
+		}
+		clip.Output = "recordings/" + recording.ID + "/highlights/" + clip.ID + ".mp4"
+		if clip.Size, err = p.upload(ctx, file, clip.Output, "video/mp4"); err != nil {
+			return clips, err
+		}
+		clips = append(clips, clip)
+	}
+	return clips, nil
+}
+
+// spikes finds the windows of the recording with a spike in reactions,
+// most reactions first.
+func spikes(startedAt time.Time, reactions []analytics.TimelineEvent, duration float64) []moment {
+	window := reactionWindow.Seconds()
+	counts := make(map[int]int)
+	total := 0
+	for _, reaction := range reactions {
+		offset := reaction.At.Sub(startedAt).Seconds()
+		if offset < 0 || offset >= duration {
+			continue
+		}
+		counts[int(offset/window)]++
+		total++
+	}
+	threshold := max(minSpike, spikeFactor*float64(total)/math.Ceil(duration/window))
+
+	var found []int
+	for index, count := range counts {
+		if float64(count) >= threshold {
+			found = append(found, index)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if counts[found[i]] != counts[found[j]] {
+			return counts[found[i]] > counts[found[j]]
+		}
+		return found[i] < found[j]
+	})
+	moments := make([]moment, 0, len(found))
+	for _, index := range found {
+		moments = append(moments, moment{
+			at:     (float64(index) + 0.5) * window,
+			reason: interfaces.HighlightReactions,
+			title:  strconv.Itoa(counts[index]) + " reactions",
+		})
+	}
+	return moments
+}
+
+// pickClips turns moments, in order of priority, into at most limit clips
+// of length seconds within the recording, starting a quarter of the way
+// before each moment. Moments whose clip would overlap one already picked
+// are skipped. The clips are returned in the order they play.
+func pickClips(moments []moment, length, duration float64, limit int) []interfaces.RecordingHighlight {
+	length = min(length, duration)
+	var clips []interfaces.RecordingHighlight
+	for _, moment := range moments {
+		if len(clips) >= limit {
+			break
+		}
+		start := min(max(moment.at-length/4, 0), duration-length)
+		end := start + length
+		overlaps := false
+		for _, clip := range clips {
+			if start < clip.EndOffset && clip.StartOffset < end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			clips = append(clips, interfaces.RecordingHighlight{Reason: moment.reason, Title: moment.title, StartOffset: start, EndOffset: end})
+		}
+	}
+	sort.Slice(clips, func(i, j int) bool { return clips[i].StartOffset < clips[j].StartOffset })
+	return clips
+}
@@ -0,0 +1,31 @@
+package transcode
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+)
+
+// bleepArgs returns the ffmpeg arguments that replace the audio of the
+// redactions to bleep with a 1 kHz tone, or nil when there are none.
+func bleepArgs(redactions []interfaces.RecordingRedaction) []string {
+	var spans []string
+	for _, redaction := range redactions {
+		if redaction.Bleep {
+			spans = append(spans, "between(t,"+seconds(redaction.StartOffset)+","+seconds(redaction.EndOffset)+")")
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	during := strings.Join(spans, "+")
+	filter := "[0:a]volume=0:enable='" + during + "'[muted];" +
+		"sine=frequency=1000:sample_rate=48000,volume=0:enable='not(" + during + ")'[tone];" +
+		"[muted][tone]amix=inputs=2:duration=first:normalize=0[a]"
+	return []string{"-filter_complex", filter, "-map", "0:v?", "-map", "[a]"}
+}
+
+func seconds(offset float64) string {
+	return strconv.FormatFloat(offset, 'f', 3, 64)
+}
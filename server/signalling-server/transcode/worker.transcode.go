@@ -0,0 +1,267 @@
+// Package transcode post-processes raw recordings: it re-encodes them to
+// MP4 (H.264 + AAC), grabs a thumbnail, records their duration and cuts
+// highlight clips.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Config struct {
+	// Dir is where egress writes raw recordings; relative locations are
+	// resolved against it and outputs are written next to them.
+	Dir string
+
+	Workers     int
+	MaxAttempts int
+	Timeout     time.Duration
+	Poll        time.Duration
+
+	FFmpeg  string
+	FFprobe string
+
+	// Store receives the processed video, thumbnail and highlights.
+	Store storage.BlobStore
+
+	// HighlightLength is the length of the highlight clips; zero cuts none.
+	// At most MaxHighlights are cut from a recording.
+	HighlightLength time.Duration
+	MaxHighlights   int
+
+	// OnReady, when set, is called with each recording once it is ready.
+	OnReady func(interfaces.Recording)
+}
+
+// Pool runs transcoding workers. Jobs live in the recordings collection, so
+// any number of nodes can run pools: a worker leases a job before working on
+// it and an expired lease makes it available again.
+type Pool struct {
+	config     Config
+	db         *mongo.Client
+	collection *mongo.Collection
+}
+
+func NewPool(db *mongo.Client, config Config) *Pool {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.FFmpeg == "" {
+		config.FFmpeg = "ffmpeg"
+	}
+	if config.FFprobe == "" {
+		config.FFprobe = "ffprobe"
+	}
+	if config.MaxHighlights <= 0 {
+		config.MaxHighlights = 10
+	}
+	return &Pool{config: config, db: db, collection: db.Database("vidchat").Collection("recordings")}
+}
+
+// Start launches the workers.
+func (p *Pool) Start() {
+	for i := 0; i < p.config.Workers; i++ {
+		go p.work()
+	}
+}
+
+func (p *Pool) work() {
+	for {
+		recording, err := p.claim()
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Printf("Transcode: claiming job: %s", err)
+		}
+		if recording == nil {
+			time.Sleep(p.config.Poll)
+			continue
+		}
+		p.run(recording)
+	}
+}
+
+func (p *Pool) claim() (*interfaces.Recording, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var recording interfaces.Recording
+	err := p.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"status":        interfaces.RecordingProcessing,
+			"nextAttemptAt": bson.M{"$lte": now},
+			"$or":           bson.A{bson.M{"lockedUntil": bson.M{"$exists": false}}, bson.M{"lockedUntil": bson.M{"$lt": now}}},
+		},
+		bson.M{"$set": bson.M{"lockedUntil": now.Add(p.config.Timeout)}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextAttemptAt": 1}).SetReturnDocument(options.After),
+	).Decode(&recording)
+	if err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+func (p *Pool) run(recording *interfaces.Recording) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+	defer cancel()
+
+	update, err := p.process(ctx, recording)
+	if err == nil {
+		update["status"] = interfaces.RecordingReady
+		log.Printf("Transcode: %s ready", recording.ID)
+	} else if recording.Attempts >= p.config.MaxAttempts {
+		update = bson.M{"status": interfaces.RecordingFailed, "error": err.Error()}
+		log.Printf("Transcode: %s failed after %d attempts: %s", recording.ID, recording.Attempts, err)
+	} else {
+		backoff := time.Duration(1<<uint(recording.Attempts)) * 30 * time.Second
+		update = bson.M{"error": err.Error(), "nextAttemptAt": time.Now().Add(backoff)}
+		log.Printf("Transcode: %s attempt %d failed, retrying in %s: %s", recording.ID, recording.Attempts, backoff, err)
+	}
+
+	done, cancelDone := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelDone()
+	filter := bson.M{"_id": recording.ID}
+	if update["status"] == interfaces.RecordingReady {
+		// A redaction made while this pass ran needs another one.
+		filter["redactions."+strconv.Itoa(len(recording.Redactions))] = bson.M{"$exists": false}
+	}
+	result, err := p.collection.UpdateOne(done, filter,
+		bson.M{"$set": update, "$unset": bson.M{"lockedUntil": ""}})
+	if err != nil {
+		log.Printf("Transcode: updating %s: %s", recording.ID, err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("Transcode: %s was redacted while processing, processing again", recording.ID)
+		_, err = p.collection.UpdateOne(done, bson.M{"_id": recording.ID},
+			bson.M{"$set": bson.M{"attempts": 0, "nextAttemptAt": time.Now()}, "$unset": bson.M{"lockedUntil": ""}})
+		if err != nil {
+			log.Printf("Transcode: requeueing %s: %s", recording.ID, err)
+		}
+		return
+	}
+
+	if p.config.OnReady != nil && update["status"] == interfaces.RecordingReady {
+		var ready interfaces.Recording
+		if p.collection.FindOne(done, bson.M{"_id": recording.ID}).Decode(&ready) == nil {
+			p.config.OnReady(ready)
+		}
+	}
+}
+
+func (p *Pool) process(ctx context.Context, recording *interfaces.Recording) (bson.M, error) {
+	if recording.Location == "" {
+		return nil, fmt.Errorf("recording has no raw output")
+	}
+	input := recording.Location
+	if !filepath.IsAbs(input) {
+		input = filepath.Join(p.config.Dir, input)
+	}
+
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	output := base + ".h264.mp4"
+	thumbnail := base + ".jpg"
+
+	// Redactions are applied to the raw recording, so each pass starts
+	// from the original audio and applies all of them.
+	args := append([]string{"-y", "-i", input}, bleepArgs(recording.Redactions)...)
+	args = append(args,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart", output)
+	err := p.exec(ctx, p.config.FFmpeg, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := p.duration(ctx, output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Grab the thumbnail a little way in, past any black lead-in.
+	at := strconv.FormatFloat(duration/10, 'f', 3, 64)
+	if err := p.exec(ctx, p.config.FFmpeg, "-y", "-ss", at, "-i", output, "-frames:v", "1", "-vf", "scale=640:-2", thumbnail); err != nil {
+		return nil, err
+	}
+
+	// Highlights are a bonus: a recording is ready without them.
+	highlights, err := p.highlights(ctx, recording, output, duration)
+	if err != nil {
+		log.Printf("Transcode: cutting highlights of %s: %s", recording.ID, err)
+	}
+
+	videoKey := "recordings/" + recording.ID + "/video.mp4"
+	size, err := p.upload(ctx, output, videoKey, "video/mp4")
+	if err != nil {
+		return nil, err
+	}
+	thumbnailKey := "recordings/" + recording.ID + "/thumbnail.jpg"
+	if _, err := p.upload(ctx, thumbnail, thumbnailKey, "image/jpeg"); err != nil {
+		return nil, err
+	}
+
+	return bson.M{
+		"output":          videoKey,
+		"thumbnail":       thumbnailKey,
+		"durationSeconds": duration,
+		"size":            size,
+		"highlights":      highlights,
+		"error":           "",
+	}, nil
+}
+
+// upload moves a local file into the blob store.
+func (p *Pool) upload(ctx context.Context, path, key, contentType string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path)
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.config.Store.Put(ctx, key, file, info.Size(), contentType); err != nil {
+		return 0, fmt.Errorf("storing %s: %s", key, err)
+	}
+	return info.Size(), nil
+}
+
+func (p *Pool) duration(ctx context.Context, path string) (float64, error) {
+	out, err := exec.CommandContext(ctx, p.config.FFprobe, "-v", "error",
+		"-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %s", err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+func (p *Pool) exec(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		tail := stderr.String()
+		if len(tail) > 512 {
+			tail = tail[len(tail)-512:]
+		}
+		return fmt.Errorf("%s: %s: %s", filepath.Base(name), err, strings.TrimSpace(tail))
+	}
+	return nil
+}
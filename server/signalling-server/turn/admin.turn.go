@@ -0,0 +1,134 @@
+package turn
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminTimeout bounds every exchange with a server's admin interface.
+const adminTimeout = 10 * time.Second
+
+// Allocation is a relay a client holds on a coturn server.
+type Allocation struct {
+	ID       string
+	Username string
+	Realm    string
+	Started  time.Time
+	// BytesReceived and BytesSent count what the allocation relayed so far.
+	BytesReceived int64
+	BytesSent     int64
+}
+
+// Admin talks to the telnet admin interface of one coturn server, its
+// cli-port, 5766 by default.
+type Admin struct {
+	Addr     string
+	Password string
+}
+
+// ParseAdmins parses a comma separated list of admin addresses, host:port.
+func ParseAdmins(list, password string) []Admin {
+	var admins []Admin
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			admins = append(admins, Admin{Addr: addr, Password: password})
+		}
+	}
+	return admins
+}
+
+// Allocations lists the server's current allocations.
+func (a Admin) Allocations() ([]Allocation, error) {
+	conn, err := net.DialTimeout("tcp", a.Addr, adminTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(adminTimeout))
+
+	reader := bufio.NewReader(conn)
+	greeting, err := readPrompt(reader)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(bytes.ToLower(greeting), []byte("password")) {
+		fmt.Fprintf(conn, "%s\r\n", a.Password)
+		if greeting, err = readPrompt(reader); err != nil {
+			return nil, err
+		}
+		if bytes.Contains(bytes.ToLower(greeting), []byte("password")) {
+			return nil, errors.New("admin password rejected")
+		}
+	}
+
+	fmt.Fprint(conn, "ps\r\n")
+	output, err := readPrompt(reader)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprint(conn, "quit\r\n")
+	return parseSessions(output, time.Now()), nil
+}
+
+// readPrompt reads until the CLI waits for input, after a "> " prompt or a
+// password question, and returns what it read.
+func readPrompt(reader *bufio.Reader) ([]byte, error) {
+	var output []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return output, err
+		}
+		output = append(output, b)
+		if bytes.HasSuffix(output, []byte("> ")) || bytes.HasSuffix(bytes.ToLower(output), []byte("password: ")) {
+			return output, nil
+		}
+	}
+}
+
+var (
+	sessionLine = regexp.MustCompile(`^\s*\d+\) id=(\S+), user <([^>]*)>:`)
+	realmLine   = regexp.MustCompile(`^\s*realm: (\S*)`)
+	startedLine = regexp.MustCompile(`^\s*started (\d+) secs ago`)
+	usageLine   = regexp.MustCompile(`^\s*usage: rp=\d+, rb=(\d+), sp=\d+, sb=(\d+)`)
+)
+
+// parseSessions reads the allocations from the output of the "ps" command,
+// which lists each session as a numbered block:
+//
+//	Total sessions: 1
+//	    1) id=001000000000000001, user <1700000000:abc/alice>:
+//	      realm: example.org
+//	      started 17 secs ago
+//	      usage: rp=21, rb=1008, sp=21, sb=1008
+func parseSessions(output []byte, now time.Time) []Allocation {
+	var allocations []Allocation
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if match := sessionLine.FindStringSubmatch(line); match != nil {
+			allocations = append(allocations, Allocation{ID: match[1], Username: match[2]})
+			continue
+		}
+		if len(allocations) == 0 {
+			continue
+		}
+		current := &allocations[len(allocations)-1]
+		if match := realmLine.FindStringSubmatch(line); match != nil {
+			current.Realm = match[1]
+		} else if match := startedLine.FindStringSubmatch(line); match != nil {
+			secs, _ := strconv.ParseInt(match[1], 10, 64)
+			current.Started = now.Add(-time.Duration(secs) * time.Second).Truncate(time.Second)
+		} else if match := usageLine.FindStringSubmatch(line); match != nil {
+			current.BytesReceived, _ = strconv.ParseInt(match[1], 10, 64)
+			current.BytesSent, _ = strconv.ParseInt(match[2], 10, 64)
+		}
+	}
+	return allocations
+}
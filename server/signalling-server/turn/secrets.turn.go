@@ -0,0 +1,125 @@
+// Package turn manages the coturn servers participants relay media through:
+// it rotates the shared secret TURN credentials are signed with, and reads
+// the servers' allocations to account relay usage per meeting and org.
+package turn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// secret is a document of coturn's turn_secret collection. coturn accepts
+// credentials signed with any secret of its realm, so a new secret can be
+// added before the old one is retired.
+type secret struct {
+	Realm     string    `bson:"realm"`
+	Value     string    `bson:"value"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// Secrets keeps the shared secrets in the database coturn reads them from
+// (its mongo-userdb), and knows the newest one to sign credentials with.
+type Secrets struct {
+	collection *mongo.Collection
+	realm      string
+
+	mu      sync.RWMutex
+	current string
+}
+
+// NewSecrets manages the secrets of realm in coturn's database db.
+func NewSecrets(db *mongo.Database, realm string) *Secrets {
+	return &Secrets{collection: db.Collection("turn_secret"), realm: realm}
+}
+
+// Current returns the secret new credentials are signed with, or "" before
+// the first one is loaded.
+func (s *Secrets) Current() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Rotate adds a new secret whenever the newest is older than every, and
+// removes secrets that stopped signing credentials more than ttl ago, once
+// every credential they signed has expired. Every node runs it: nodes that
+// rotate at the same moment add one secret each, which coturn accepts
+// equally, and the newest wins.
+func (s *Secrets) Rotate(every, ttl time.Duration) {
+	s.rotate(every, ttl)
+	for range time.Tick(time.Minute) {
+		s.rotate(every, ttl)
+	}
+}
+
+func (s *Secrets) rotate(every, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	secrets, err := s.load(ctx)
+	if err != nil {
+		log.Printf("TURN: loading secrets: %s", err)
+		return
+	}
+	now := time.Now()
+	if len(secrets) == 0 || now.Sub(secrets[0].CreatedAt) >= every {
+		created := secret{Realm: s.realm, Value: newSecret(), CreatedAt: now}
+		if _, err := s.collection.InsertOne(ctx, created); err != nil {
+			log.Printf("TURN: adding secret: %s", err)
+		} else {
+			log.Printf("TURN: rotated the shared secret of %s", s.realm)
+			secrets = append([]secret{created}, secrets...)
+		}
+	}
+	if len(secrets) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.current = secrets[0].Value
+	s.mu.Unlock()
+
+	// A secret signs credentials until the next one is created.
+	for i := 1; i < len(secrets); i++ {
+		if now.Sub(secrets[i-1].CreatedAt) < ttl {
+			continue
+		}
+		_, err := s.collection.DeleteOne(ctx, bson.M{"realm": s.realm, "value": secrets[i].Value})
+		if err != nil {
+			log.Printf("TURN: removing secret: %s", err)
+		}
+	}
+}
+
+// load returns the realm's secrets, newest first. Secrets added by hand,
+// without a creation time, sort last and are never retired.
+func (s *Secrets) load(ctx context.Context) ([]secret, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"realm": s.realm},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var secrets []secret
+	if err := cursor.All(ctx, &secrets); err != nil {
+		return nil, err
+	}
+	for len(secrets) > 1 && secrets[len(secrets)-1].CreatedAt.IsZero() {
+		secrets = secrets[:len(secrets)-1]
+	}
+	return secrets, nil
+}
+
+func newSecret() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(buf), "=")
+}
@@ -0,0 +1,224 @@
+package turn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/metering"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User is the user part of the TURN username handed to a participant of a
+// session, so the server's allocations can be traced back to the meeting.
+// The session ID is hex and never contains the "/" separating it from the
+// user ID.
+func User(sessionID, userID string) string {
+	if sessionID == "" {
+		return userID
+	}
+	return sessionID + "/" + userID
+}
+
+// parseUsername splits a TURN REST username, "<expiry>:<session>/<user>",
+// into its session and user IDs.
+func parseUsername(username string) (string, string) {
+	if _, user, ok := strings.Cut(username, ":"); ok {
+		username = user
+	}
+	if session, user, ok := strings.Cut(username, "/"); ok {
+		return session, user
+	}
+	return "", username
+}
+
+// AllocationRecord is what is kept of an allocation in the turn_allocations
+// collection, for billing. Byte counts are the allocation's latest totals.
+type AllocationRecord struct {
+	ID            string    `bson:"_id" json:"id"`
+	Server        string    `bson:"server" json:"server"`
+	SessionID     string    `bson:"sessionID,omitempty" json:"sessionID,omitempty"`
+	OrgID         string    `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	UserID        string    `bson:"userID" json:"userID"`
+	StartedAt     time.Time `bson:"startedAt" json:"startedAt"`
+	SeenAt        time.Time `bson:"seenAt" json:"seenAt"`
+	BytesReceived int64     `bson:"bytesReceived" json:"bytesReceived"`
+	BytesSent     int64     `bson:"bytesSent" json:"bytesSent"`
+}
+
+// Usage is the relay usage of an org over a period.
+type Usage struct {
+	Allocations   int     `bson:"allocations" json:"allocations"`
+	BytesReceived int64   `bson:"bytesReceived" json:"bytesReceived"`
+	BytesSent     int64   `bson:"bytesSent" json:"bytesSent"`
+	RelaySeconds  float64 `bson:"relaySeconds" json:"relaySeconds"`
+}
+
+// Monitor polls the admin interface of every coturn server, records their
+// allocations and meters what they relayed against the org. Each server is
+// polled by the signalling node that owns it on the placement ring, so
+// nothing is metered twice.
+type Monitor struct {
+	db       *mongo.Database
+	meter    *metering.Meter
+	admins   []Admin
+	owns     func(key string) bool
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[string]int // server -> current allocations
+}
+
+// NewMonitor polls admins every interval once Run is called.
+func NewMonitor(db *mongo.Client, meter *metering.Meter, admins []Admin, owns func(key string) bool, interval time.Duration) *Monitor {
+	return &Monitor{
+		db:       db.Database("vidchat"),
+		meter:    meter,
+		admins:   admins,
+		owns:     owns,
+		interval: interval,
+		counts:   make(map[string]int),
+	}
+}
+
+// Run polls the servers.
+func (m *Monitor) Run() {
+	for range time.Tick(m.interval) {
+		for _, admin := range m.admins {
+			if !m.owns("turn/" + admin.Addr) {
+				m.mu.Lock()
+				delete(m.counts, admin.Addr)
+				m.mu.Unlock()
+				continue
+			}
+			if err := m.poll(admin); err != nil {
+				log.Printf("TURN: polling %s: %s", admin.Addr, err)
+			}
+		}
+	}
+}
+
+func (m *Monitor) poll(admin Admin) error {
+	allocations, err := admin.Allocations()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.counts[admin.Addr] = len(allocations)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	orgs := make(map[string]string)
+	now := time.Now()
+	for _, allocation := range allocations {
+		session, user := parseUsername(allocation.Username)
+		if _, ok := orgs[session]; !ok && session != "" {
+			orgs[session] = m.orgOf(ctx, session)
+		}
+		started := allocation.Started
+		if started.IsZero() {
+			started = now
+		}
+		var before AllocationRecord
+		err := m.db.Collection("turn_allocations").FindOneAndUpdate(ctx,
+			bson.M{"_id": admin.Addr + "/" + allocation.ID},
+			bson.M{
+				"$set": bson.M{"seenAt": now},
+				"$max": bson.M{"bytesReceived": allocation.BytesReceived, "bytesSent": allocation.BytesSent},
+				"$setOnInsert": bson.M{
+					"server":    admin.Addr,
+					"sessionID": session,
+					"orgID":     orgs[session],
+					"userID":    user,
+					"startedAt": started,
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&before)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		added := max(allocation.BytesReceived-before.BytesReceived, 0) + max(allocation.BytesSent-before.BytesSent, 0)
+		if err := m.meter.Add(ctx, orgs[session], metering.TURNBytes, added, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orgOf returns the org of the session, or "" when it has none.
+func (m *Monitor) orgOf(ctx context.Context, sessionID string) string {
+	var socket interfaces.Socket
+	err := m.db.Collection("sockets").FindOne(ctx, bson.M{"sessionID": sessionID},
+		options.FindOne().SetProjection(bson.M{"orgID": 1})).Decode(&socket)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("TURN: finding the org of session %s: %s", sessionID, err)
+	}
+	return socket.OrgID
+}
+
+// Live returns the session's allocations seen by the latest polls. A nil
+// Monitor, without TURN servers to poll, returns none.
+func (m *Monitor) Live(ctx context.Context, sessionID string) ([]AllocationRecord, error) {
+	allocations := []AllocationRecord{}
+	if m == nil {
+		return allocations, nil
+	}
+	cursor, err := m.db.Collection("turn_allocations").Find(ctx, bson.M{
+		"sessionID": sessionID,
+		"seenAt":    bson.M{"$gte": time.Now().Add(-2 * m.interval)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &allocations)
+	return allocations, err
+}
+
+// OrgUsage sums the relay usage of the org's allocations started in
+// [from, to).
+func OrgUsage(ctx context.Context, db *mongo.Client, orgID string, from, to time.Time) (Usage, error) {
+	cursor, err := db.Database("vidchat").Collection("turn_allocations").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"orgID": orgID, "startedAt": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           nil,
+			"allocations":   bson.M{"$sum": 1},
+			"bytesReceived": bson.M{"$sum": "$bytesReceived"},
+			"bytesSent":     bson.M{"$sum": "$bytesSent"},
+			"relaySeconds":  bson.M{"$sum": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$seenAt", "$startedAt"}}, 1000}}},
+		}}},
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	var totals []Usage
+	if err := cursor.All(ctx, &totals); err != nil || len(totals) == 0 {
+		return Usage{}, err
+	}
+	return totals[0], nil
+}
+
+// WriteMetrics writes the current allocations of the servers this node
+// polls in the Prometheus text format.
+func (m *Monitor) WriteMetrics(w io.Writer) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP videoconf_turn_allocations Current allocations on the TURN servers this node polls.")
+	fmt.Fprintln(w, "# TYPE videoconf_turn_allocations gauge")
+	for server, count := range m.counts {
+		fmt.Fprintf(w, "videoconf_turn_allocations{server=%q} %d\n", server, count)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"log"
+	"net"
 	"strconv"
 
 	"github.com/hashicorp/consul/api"
@@ -22,7 +23,7 @@ func discoverService(serviceName string) (string, error) {
 
 	for _, service := range services {
 		if service.Service == serviceName {
-			return service.Address + ":" + strconv.Itoa(service.Port), nil
+			return net.JoinHostPort(service.Address, strconv.Itoa(service.Port)), nil
 		}
 	}
 
@@ -36,3 +37,18 @@ func fetchConfig(client *api.Client, key string) string {
 	}
 	return string(kv.Value)
 }
+
+// HealthyInstances returns the passing instances of serviceName registered in
+// Consul.
+func HealthyInstances(client *api.Client, serviceName string) ([]*api.AgentService, error) {
+	entries, _, err := client.Health().Service(serviceName, "", true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]*api.AgentService, 0, len(entries))
+	for _, entry := range entries {
+		services = append(services, entry.Service)
+	}
+	return services, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoResolver maps a caller to a deployment region. Regions are looked up by
+// ISO country code first, then by continent code, e.g.
+// "DE=eu-west,US=us-east,EU=eu-west,AS=ap-south".
+type GeoResolver struct {
+	db      *geoip2.Reader
+	regions map[string]string
+}
+
+// NewGeoResolver opens the MaxMind database at dbPath, if one is given, and
+// parses the region mapping.
+func NewGeoResolver(dbPath string, mapping string) (*GeoResolver, error) {
+	resolver := &GeoResolver{regions: make(map[string]string)}
+
+	for _, pair := range strings.Split(mapping, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) == 2 {
+			resolver.regions[strings.ToUpper(parts[0])] = parts[1]
+		}
+	}
+
+	if dbPath != "" {
+		db, err := geoip2.Open(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		resolver.db = db
+	}
+
+	return resolver, nil
+}
+
+// Region resolves the region for a client. An explicit region wins, then a
+// country code set by the edge (e.g. CF-IPCountry), then a GeoIP lookup of
+// the client address. It returns "" when nothing matches.
+func (g *GeoResolver) Region(explicit, country, clientIP string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if region, ok := g.regions[strings.ToUpper(country)]; ok && country != "" {
+		return region
+	}
+
+	ip := net.ParseIP(clientIP)
+	if g.db == nil || ip == nil {
+		return ""
+	}
+
+	record, err := g.db.Country(ip)
+	if err != nil {
+		return ""
+	}
+	if region, ok := g.regions[record.Country.IsoCode]; ok {
+		return region
+	}
+	return g.regions[record.Continent.Code]
+}
+
+// Country returns the ISO code of the client's country, from the edge's
+// country header or a GeoIP lookup, or "" when unknown.
+func (g *GeoResolver) Country(country, clientIP string) string {
+	if country != "" {
+		return strings.ToUpper(country)
+	}
+	ip := net.ParseIP(clientIP)
+	if g.db == nil || ip == nil {
+		return ""
+	}
+	record, err := g.db.Country(ip)
+	if err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
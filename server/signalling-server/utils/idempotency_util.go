@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyKeyHeader carries the key a client retries a request with. The
+// users service takes the same header.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyTTL is how long a key's response is kept for replay.
+const IdempotencyTTL int32 = 24 * 60 * 60
+
+// maxIdempotencyKey bounds the length of a key.
+const maxIdempotencyKey = 255
+
+// idempotentRequest is a request made with an idempotency key. Response is
+// empty until the request was handled.
+type idempotentRequest struct {
+	ID          string    `bson:"_id"`
+	RequestHash string    `bson:"requestHash"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Response    []byte    `bson:"response,omitempty"`
+	Done        bool      `bson:"done"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+// Idempotency lets clients retry requests that create things without
+// creating them twice. Requests with an Idempotency-Key header are handled
+// once per key, caller and route; retries get the first response back with
+// an Idempotent-Replayed header. Keys are kept in the idempotency_keys
+// collection, so they hold across nodes, for IdempotencyTTL.
+type Idempotency struct {
+	keys *mongo.Collection
+	// subject returns the signed-in caller of a request, empty for guests.
+	subject func(*http.Request) string
+}
+
+func NewIdempotency(client *mongo.Client, subject func(*http.Request) string) *Idempotency {
+	return &Idempotency{keys: client.Database("vidchat").Collection("idempotency_keys"), subject: subject}
+}
+
+// Guard is the middleware handling requests by their idempotency key. A
+// key reused with a different body is refused with 422, and a retry while
+// the first request is still being handled with 409. Keys of requests that
+// failed with a server error are forgotten so they can be retried.
+func (i *Idempotency) Guard() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long."})
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Could not read request."})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the caller, so one cannot replay another's
+		// response: the signed-in user, or the client's IP for guests.
+		caller := "ip:" + ctx.ClientIP()
+		if subject := i.subject(ctx.Request); subject != "" {
+			caller = "user:" + subject
+		}
+		id := sha256.Sum256([]byte(ctx.Request.Method + " " + ctx.FullPath() + "\n" + caller + "\n" + key))
+		hash := sha256.Sum256(body)
+		request := idempotentRequest{
+			ID:          hex.EncodeToString(id[:]),
+			RequestHash: hex.EncodeToString(hash[:]),
+			CreatedAt:   time.Now(),
+		}
+
+		if _, err := i.keys.InsertOne(ctx, request); mongo.IsDuplicateKeyError(err) {
+			var first idempotentRequest
+			if err := i.keys.FindOne(ctx, bson.M{"_id": request.ID}).Decode(&first); err != nil {
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key is in progress."})
+				return
+			}
+			switch {
+			case first.RequestHash != request.RequestHash:
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was used for a different request."})
+			case !first.Done:
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key is in progress."})
+			default:
+				ctx.Header("Idempotent-Replayed", "true")
+				ctx.Data(first.Status, first.ContentType, first.Response)
+				ctx.Abort()
+			}
+			return
+		} else if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not save Idempotency-Key."})
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+		ctx.Writer = recorder
+		ctx.Next()
+
+		// A context of its own, so the outcome is kept even if the client
+		// went away.
+		saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if recorder.Status() >= http.StatusInternalServerError {
+			i.keys.DeleteOne(saveCtx, bson.M{"_id": request.ID})
+			return
+		}
+		i.keys.UpdateOne(saveCtx, bson.M{"_id": request.ID}, bson.M{"$set": bson.M{
+			"status":      recorder.Status(),
+			"contentType": recorder.Header().Get("Content-Type"),
+			"response":    recorder.body.Bytes(),
+			"done":        true,
+		}})
+	}
+}
+
+// responseRecorder keeps a copy of the response body it writes.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	r.body.Write(body)
+	return r.ResponseWriter.Write(body)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+const shortCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// Links builds the public URLs handed out for a session: the client's join
+// page and the short links that redirect to it.
+type Links struct {
+	// PublicURL is where this API is reachable, e.g. https://meet.example.com/api.
+	PublicURL string
+	// JoinURL is the client's join page; {url} is replaced by the session's hashed URL.
+	JoinURL string
+}
+
+func (l Links) Join(hashedURL string) string {
+	return strings.Replace(l.JoinURL, "{url}", hashedURL, 1)
+}
+
+func (l Links) Short(code string) string {
+	return strings.TrimRight(l.PublicURL, "/") + "/j/" + code
+}
+
+// ShortCode returns a random code of n characters, avoiding ones easily
+// confused when typed from a screen (0/O, 1/l/I).
+func ShortCode(n int) string {
+	code := make([]byte, n)
+	max := big.NewInt(int64(len(shortCodeAlphabet)))
+	for i := range code {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		code[i] = shortCodeAlphabet[index.Int64()]
+	}
+	return string(code)
+}
+
+// NumericCode returns a random code of n decimal digits, for typing on
+// devices with only a keypad.
+func NumericCode(n int) string {
+	code := make([]byte, n)
+	for i := range code {
+		digit, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			panic(err)
+		}
+		code[i] = byte('0' + digit.Int64())
+	}
+	return string(code)
+}
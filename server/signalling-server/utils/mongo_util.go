@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EndedSessionTTL is how long an ended session is kept before MongoDB removes it.
+const EndedSessionTTL int32 = 7 * 24 * 60 * 60
+
+// RoomSnapshotTTL bounds how long a room abandoned without a clean leave can
+// be restored.
+const RoomSnapshotTTL int32 = 24 * 60 * 60
+
+// PreflightTTL is how long preflight results are kept for support.
+const PreflightTTL int32 = 30 * 24 * 60 * 60
+
+// ConnectionPathTTL is how long reported connection paths are kept for
+// quality reports.
+const ConnectionPathTTL int32 = 30 * 24 * 60 * 60
+
+// HookDeliveryTTL is how long webhook deliveries are kept for debugging.
+const HookDeliveryTTL int32 = 7 * 24 * 60 * 60
+
+// LTINonceTTL is how long the nonces of LTI launches are kept to refuse
+// replays, longer than a launch's state is valid.
+const LTINonceTTL int32 = 60 * 60
+
+// EnsureIndexes creates the indexes the controllers rely on. Creating an
+// index that already exists with the same options is a no-op, so it is safe
+// to run on every startup.
+func EnsureIndexes(ctx context.Context, client *mongo.Client) error {
+	db := client.Database("vidchat")
+
+	// The unique hashedUrl index cannot be built while sockets share one.
+	if err := dedupeHashedURLs(ctx, db); err != nil {
+		return err
+	}
+
+	indexes := map[string][]mongo.IndexModel{
+		"sockets": {
+			{
+				Keys:    bson.D{{Key: "hashedUrl", Value: 1}},
+				Options: options.Index().SetName("hashedUrl_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "socketUrl", Value: 1}},
+				Options: options.Index().SetName("socketUrl"),
+			},
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+			{
+				Keys:    bson.D{{Key: "matrixRoom", Value: 1}},
+				Options: options.Index().SetName("matrixRoom").SetSparse(true),
+			},
+		},
+		"sessions": {
+			{
+				Keys:    bson.D{{Key: "endedAt", Value: 1}},
+				Options: options.Index().SetName("endedAt_ttl").SetExpireAfterSeconds(EndedSessionTTL),
+			},
+			{
+				Keys:    bson.D{{Key: "ownerID", Value: 1}},
+				Options: options.Index().SetName("ownerID").SetSparse(true),
+			},
+			{
+				Keys:    bson.D{{Key: "devices", Value: 1}, {Key: "startsAt", Value: 1}},
+				Options: options.Index().SetName("devices_startsAt").SetSparse(true),
+			},
+		},
+		"room_snapshots": {
+			{
+				Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+				Options: options.Index().SetName("updatedAt_ttl").SetExpireAfterSeconds(RoomSnapshotTTL),
+			},
+		},
+		"recordings": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+				Options: options.Index().SetName("status_nextAttemptAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "status", Value: 1}, {Key: "startedAt", Value: 1}},
+				Options: options.Index().SetName("orgID_status_startedAt"),
+			},
+		},
+		"presence": {
+			{
+				Keys:    bson.D{{Key: "user", Value: 1}},
+				Options: options.Index().SetName("user"),
+			},
+			{
+				Keys:    bson.D{{Key: "heartbeat", Value: 1}},
+				Options: options.Index().SetName("heartbeat"),
+			},
+		},
+		"delegates": {
+			{
+				Keys:    bson.D{{Key: "ownerID", Value: 1}, {Key: "delegateID", Value: 1}},
+				Options: options.Index().SetName("ownerID_delegateID").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "delegateID", Value: 1}},
+				Options: options.Index().SetName("delegateID"),
+			},
+		},
+		"echo_tests": {
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("createdAt_ttl").SetExpireAfterSeconds(PreflightTTL),
+			},
+		},
+		"idempotency_keys": {
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("createdAt_ttl").SetExpireAfterSeconds(IdempotencyTTL),
+			},
+		},
+		"crm_activities": {
+			{
+				Keys:    bson.D{{Key: "activity.sessionID", Value: 1}},
+				Options: options.Index().SetName("activity_sessionID"),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}},
+				Options: options.Index().SetName("orgID"),
+			},
+		},
+		"feeds": {
+			{
+				Keys:    bson.D{{Key: "socket", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("socket_status"),
+			},
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("sessionID_createdAt"),
+			},
+		},
+		"lti_learners": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+		},
+		"lti_links": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+		},
+		"lti_nonces": {
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("createdAt_ttl").SetExpireAfterSeconds(LTINonceTTL),
+			},
+		},
+		"lti_platforms": {
+			{
+				Keys:    bson.D{{Key: "issuer", Value: 1}, {Key: "clientID", Value: 1}},
+				Options: options.Index().SetName("issuer_clientID").SetUnique(true),
+			},
+		},
+		"preflight": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "userID", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("sessionID_userID_createdAt").SetSparse(true),
+			},
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("createdAt_ttl").SetExpireAfterSeconds(PreflightTTL),
+			},
+		},
+		"recording_views": {
+			{
+				Keys:    bson.D{{Key: "recordingID", Value: 1}, {Key: "viewedAt", Value: -1}},
+				Options: options.Index().SetName("recordingID_viewedAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "viewedAt", Value: 1}},
+				Options: options.Index().SetName("orgID_viewedAt"),
+			},
+		},
+		"short_links": {
+			{
+				Keys:    bson.D{{Key: "hashedUrl", Value: 1}},
+				Options: options.Index().SetName("hashedUrl").SetUnique(true),
+			},
+		},
+		"join_codes": {
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		"embed_sockets": {
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		"speaker_stats": {
+			{
+				Keys:    bson.D{{Key: "socket", Value: 1}},
+				Options: options.Index().SetName("socket"),
+			},
+		},
+		"exports": {
+			{
+				Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("userID_createdAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt"),
+			},
+		},
+		"templates": {
+			{
+				Keys:    bson.D{{Key: "ownerID", Value: 1}},
+				Options: options.Index().SetName("ownerID").SetSparse(true),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}},
+				Options: options.Index().SetName("orgID").SetSparse(true),
+			},
+		},
+		"calls": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "ringUntil", Value: 1}},
+				Options: options.Index().SetName("status_ringUntil"),
+			},
+			{
+				Keys:    bson.D{{Key: "caller", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("caller_createdAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "callee", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("callee_createdAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+				Options: options.Index().SetName("updatedAt"),
+			},
+		},
+		"watchlists": {
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}},
+				Options: options.Index().SetName("orgID"),
+			},
+		},
+		"keyword_alerts": {
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "at", Value: -1}},
+				Options: options.Index().SetName("orgID_at"),
+			},
+		},
+		"notifications": {
+			{
+				Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("userID_createdAt"),
+			},
+		},
+		"connection_paths": {
+			{
+				Keys:    bson.D{{Key: "socket", Value: 1}},
+				Options: options.Index().SetName("socket"),
+			},
+			{
+				Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+				Options: options.Index().SetName("updatedAt_ttl").SetExpireAfterSeconds(ConnectionPathTTL),
+			},
+		},
+		"phone_calls": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+		},
+		"rules": {
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}},
+				Options: options.Index().SetName("orgID"),
+			},
+		},
+		"api_keys": {
+			{
+				Keys:    bson.D{{Key: "hash", Value: 1}},
+				Options: options.Index().SetName("hash").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "ownerID", Value: 1}},
+				Options: options.Index().SetName("ownerID"),
+			},
+		},
+		"hooks": {
+			{
+				Keys:    bson.D{{Key: "ownerID", Value: 1}, {Key: "event", Value: 1}},
+				Options: options.Index().SetName("ownerID_event"),
+			},
+		},
+		"hook_deliveries": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+				Options: options.Index().SetName("status_nextAttemptAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("createdAt_ttl").SetExpireAfterSeconds(HookDeliveryTTL),
+			},
+		},
+		"calendar_grants": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextSyncAt", Value: 1}},
+				Options: options.Index().SetName("status_nextSyncAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "userID", Value: 1}},
+				Options: options.Index().SetName("userID"),
+			},
+		},
+		"calendar_events": {
+			{
+				Keys:    bson.D{{Key: "grant", Value: 1}},
+				Options: options.Index().SetName("grant"),
+			},
+		},
+		"upcoming_meetings": {
+			{
+				Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "startsAt", Value: 1}},
+				Options: options.Index().SetName("userID_startsAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "grant", Value: 1}, {Key: "syncedAt", Value: 1}},
+				Options: options.Index().SetName("grant_syncedAt"),
+			},
+		},
+		"attendance": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "joinedAt", Value: 1}},
+				Options: options.Index().SetName("sessionID_joinedAt"),
+			},
+		},
+		"diagnostics": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("sessionID_createdAt"),
+			},
+		},
+		"audience": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "minute", Value: 1}},
+				Options: options.Index().SetName("sessionID_minute"),
+			},
+		},
+		"timeline": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "at", Value: 1}, {Key: "seq", Value: 1}},
+				Options: options.Index().SetName("sessionID_at_seq"),
+			},
+		},
+		"domains": {
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "verifiedAt", Value: 1}},
+				Options: options.Index().SetName("orgID_verifiedAt"),
+			},
+		},
+		"bandwidth": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}},
+				Options: options.Index().SetName("sessionID"),
+			},
+		},
+		"meters": {
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "day", Value: 1}},
+				Options: options.Index().SetName("orgID_day"),
+			},
+		},
+		"turn_allocations": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "seenAt", Value: -1}},
+				Options: options.Index().SetName("sessionID_seenAt"),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "startedAt", Value: 1}},
+				Options: options.Index().SetName("orgID_startedAt"),
+			},
+		},
+		"usage": {
+			{
+				Keys:    bson.D{{Key: "org", Value: 1}},
+				Options: options.Index().SetName("org"),
+			},
+		},
+		"consent_records": {
+			{
+				Keys:    bson.D{{Key: "sessionID", Value: 1}, {Key: "userID", Value: 1}, {Key: "noticeID", Value: 1}, {Key: "version", Value: 1}},
+				Options: options.Index().SetName("sessionID_userID_noticeID_version"),
+			},
+			{
+				Keys:    bson.D{{Key: "orgID", Value: 1}, {Key: "acceptedAt", Value: -1}},
+				Options: options.Index().SetName("orgID_acceptedAt"),
+			},
+		},
+	}
+
+	for collection, models := range indexes {
+		names, err := db.Collection(collection).Indexes().CreateMany(ctx, models)
+		if err != nil {
+			return err
+		}
+		log.Printf("Ensured indexes on %s: %v", collection, names)
+	}
+
+	return nil
+}
+
+// dedupeHashedURLs gives every socket sharing a hashed URL with an older
+// one a random URL of its own. Hashed URLs were once derived from the host
+// and title, so such sockets could be stored, but their URL only ever found
+// the oldest one.
+func dedupeHashedURLs(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("sockets")
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$hashedUrl", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		HashedURL string        `bson:"_id"`
+		IDs       []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		for _, id := range duplicate.IDs[1:] {
+			random := make([]byte, 20)
+			if _, err := rand.Read(random); err != nil {
+				return err
+			}
+			hashedURL := hex.EncodeToString(random)
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"hashedUrl": hashedURL}}); err != nil {
+				return err
+			}
+			log.Printf("Moved socket %v from duplicate hashed URL %s to %s", id, duplicate.HashedURL, hashedURL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+)
+
+// IPFamily restricts which IP versions the server listens on, hands out and
+// relays: "dual" (the default), "ipv4" or "ipv6".
+type IPFamily string
+
+const (
+	DualStack IPFamily = "dual"
+	IPv4Only  IPFamily = "ipv4"
+	IPv6Only  IPFamily = "ipv6"
+)
+
+func ParseIPFamily(value string) (IPFamily, error) {
+	switch family := IPFamily(value); family {
+	case "":
+		return DualStack, nil
+	case DualStack, IPv4Only, IPv6Only:
+		return family, nil
+	default:
+		return "", fmt.Errorf("unknown ip family %q", value)
+	}
+}
+
+// Network is the net.Listen network for the family.
+func (f IPFamily) Network() string {
+	switch f {
+	case IPv4Only:
+		return "tcp4"
+	case IPv6Only:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// Allows reports whether ip belongs to the family. Anything that is not an
+// IP literal, e.g. a hostname, is allowed.
+func (f IPFamily) Allows(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+	switch f {
+	case IPv4Only:
+		return ip.To4() != nil
+	case IPv6Only:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// Loopback is the family's loopback address.
+func (f IPFamily) Loopback() string {
+	if f == IPv6Only {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the correlation ID of a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random correlation ID.
+func NewRequestID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ValidRequestID reports whether an ID received from a caller is safe to
+// log and echo back.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") == ""
+}
+
+// WithRequestID returns ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the correlation ID carried by ctx, which may be a
+// *gin.Context, or "".
+func RequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id, ok := ctx.Value("requestID").(string); ok {
+		return id
+	}
+	return ""
+}
+
+// PropagateRequestID copies the correlation ID of req's context onto req, so
+// the service called logs it too.
+func PropagateRequestID(req *http.Request) {
+	if id := RequestID(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// RequestIDs is the edge middleware: it keeps the caller's X-Request-ID, or
+// generates one, stores it as "requestID" in the gin and request contexts,
+// returns it in the response header and adds it to JSON error bodies.
+func RequestIDs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		ctx.Set("requestID", id)
+		ctx.Request = ctx.Request.WithContext(WithRequestID(ctx.Request.Context(), id))
+		ctx.Header(RequestIDHeader, id)
+		ctx.Writer = &errorWriter{ResponseWriter: ctx.Writer, id: id}
+		ctx.Next()
+	}
+}
+
+// errorWriter adds "requestID" to JSON object bodies of error responses.
+type errorWriter struct {
+	gin.ResponseWriter
+	id      string
+	written bool
+}
+
+func (w *errorWriter) Write(body []byte) (int, error) {
+	first := !w.written
+	w.written = true
+	if !first || w.Status() < http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") || !bytes.HasPrefix(body, []byte("{")) {
+		return w.ResponseWriter.Write(body)
+	}
+
+	field := `"requestID":"` + w.id + `"`
+	if !bytes.HasPrefix(body, []byte("{}")) {
+		field += ","
+	}
+	if _, err := w.ResponseWriter.Write([]byte("{" + field)); err != nil {
+		return 0, err
+	}
+	n, err := w.ResponseWriter.Write(body[1:])
+	return n + 1, err
+}
+
+func (w *errorWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// LogFormatter is gin's access log line with the request ID appended.
+func LogFormatter(param gin.LogFormatterParams) string {
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		param.Keys["requestID"],
+		param.ErrorMessage,
+	)
+}
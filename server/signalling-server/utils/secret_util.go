@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Secret reads a credential from the environment. When KEY_FILE is set the
+// value is read from that file instead, which is how Docker and Kubernetes
+// secrets are mounted.
+func Secret(key string) string {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		value, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Error reading secret %s from %s: %s", key, path, err)
+			return ""
+		}
+		return strings.TrimSpace(string(value))
+	}
+	return os.Getenv(key)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Throttle limits the failures each client IP may cause, e.g. looking up
+// session URLs that do not exist, with a token bucket per IP: every failure
+// takes a token, and tokens come back at a steady rate. Requests that
+// succeed cost nothing, so people joining real meetings are never slowed
+// down by it. Buckets are kept per node.
+type Throttle struct {
+	burst  float64
+	refill float64 // tokens per second
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// NewThrottle allows limit failures per IP in a burst, refilled over
+// window.
+func NewThrottle(limit int, window time.Duration) *Throttle {
+	t := &Throttle{
+		burst:   float64(limit),
+		refill:  float64(limit) / window.Seconds(),
+		buckets: make(map[string]*bucket),
+	}
+	go t.prune(window)
+	return t
+}
+
+// take returns the IP's bucket brought up to now. The caller holds the
+// lock.
+func (t *Throttle) take(ip string, now time.Time) *bucket {
+	b := t.buckets[ip]
+	if b == nil {
+		b = &bucket{tokens: t.burst, at: now}
+		t.buckets[ip] = b
+	}
+	b.tokens = math.Min(t.burst, b.tokens+now.Sub(b.at).Seconds()*t.refill)
+	b.at = now
+	return b
+}
+
+// Fail records a failure by the IP.
+func (t *Throttle) Fail(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.take(ip, time.Now())
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+// Blocked reports whether the IP has used up its failures, and how long
+// until it may try again.
+func (t *Throttle) Blocked(ip string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.take(ip, time.Now())
+	if b.tokens >= 1 {
+		return false, 0
+	}
+	return true, time.Duration((1 - b.tokens) / t.refill * float64(time.Second))
+}
+
+// Guard refuses requests from IPs that have used up their failures with 429
+// Too Many Requests and a Retry-After header.
+func (t *Throttle) Guard() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if blocked, wait := t.Blocked(ctx.ClientIP()); blocked {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts, try again later."})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// prune forgets buckets that have filled up again.
+func (t *Throttle) prune(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		t.mu.Lock()
+		for ip, b := range t.buckets {
+			if b.tokens+now.Sub(b.at).Seconds()*t.refill >= t.burst {
+				delete(t.buckets, ip)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/r3tr056/go-videoconf/signalling-server/interfaces"
+	"github.com/r3tr056/go-videoconf/signalling-server/netpoll"
+)
+
+// epollhandler upgrades the request with gobwas/ws and hands the raw
+// connection to the poller instead of parking a reader goroutine on it. A
+// frame is read only when epoll reports the connection readable.
+// permessage-deflate is not negotiated in this mode, and TLS must be
+// terminated in front of the node.
+func epollhandler(poller netpoll.Poller, w http.ResponseWriter, r *http.Request, socket string, embed *interfaces.EmbedSocket) {
+	claims, err := logins.Authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		log.Printf("Error handling websocket connection: %s", err)
+		return
+	}
+
+	clients := room(socket)
+	connection := interfaces.NewConnection(interfaces.NetTransport{Conn: conn}, r.URL.Query().Get("batch") == "1")
+	connection.Protocol = clientProtocol(r)
+	connection.RequestID = socketRequestID(r)
+	connection.Embed = embed
+	connection.Identity = ltiIdentity(r, socket)
+
+	untrack := logins.Track(claims, connection)
+	if claims != nil {
+		connection.Account = claims.Subject
+		presences.JoinMeeting(claims.Subject)
+	}
+
+	var once sync.Once
+	closeConn := func() {
+		once.Do(func() {
+			// Removed first: a closed descriptor leaves epoll without an
+			// event, and its number may be reused by the next connection.
+			poller.Remove(conn)
+			conn.Close()
+			suspend(clients, connection)
+			untrack()
+			if claims != nil {
+				presences.LeaveMeeting(claims.Subject)
+			}
+		})
+	}
+
+	// Sockets the server closes itself, e.g. slow consumers or replaced
+	// connections, are cleaned up like ones the client closed. Callers may
+	// hold locks the cleanup takes, so it runs on its own goroutine.
+	connection.OnClose = func() { go closeConn() }
+
+	err = poller.Add(conn, func() {
+		frame, op, err := readClientFrame(conn, connection, limits.MaxFrame)
+		if err == wsutil.ErrFrameTooLarge {
+			connection.Disconnect(int(ws.StatusMessageTooBig), "message_too_large")
+			closeConn()
+			return
+		}
+		if err != nil {
+			if _, closed := err.(wsutil.ClosedError); !closed {
+				log.Printf("error: %v", err)
+			}
+			closeConn()
+			return
+		}
+
+		if op == ws.OpText && !relay(socket, connection, clients, frame) {
+			closeConn()
+			return
+		}
+
+		if err := poller.Resume(conn); err != nil {
+			log.Printf("error: %v", err)
+			closeConn()
+		}
+	})
+	if err != nil {
+		log.Printf("Error registering connection with poller: %s", err)
+		closeConn()
+	}
+}
@@ -1,5 +1,7 @@
 package common
 
+import "time"
+
 const Issuer string = "Ankur Debnath"
 const JwtSecretPassword string = "Ankur Debnath"
 const MgDBName string = "vidchat"
@@ -7,3 +9,22 @@ const MgAddress string = "127.0.0.1"
 const MgUsername string = "127.0.0.1"
 const MgPassword string = "127.0.0.1"
 const UsersCol string = "users"
+const SessionsCol string = "login_sessions"
+const MeetingsCol string = "sessions"
+const ContactsCol string = "contacts"
+const PreferencesCol string = "preferences"
+const InvitesCol string = "invites"
+const OrgsCol string = "orgs"
+const BrandingCol string = "branding"
+const AuditCol string = "audit_log"
+const AuditAnchorsCol string = "audit_anchors"
+const RateLimitsCol string = "rate_limits"
+const IdempotencyCol string = "idempotency_keys"
+const ProfileEventsCol string = "profile_events"
+const InviteTTL = 7 * 24 * time.Hour
+const IdempotencyTTL = 24 * time.Hour
+const ProfileEventTTL = 24 * time.Hour
+const ImpersonationTTL = 15 * time.Minute
+const AccessTokenTTL = 15 * time.Minute
+const RefreshTokenTTL = 30 * 24 * time.Hour
+const DeviceSessionTTL = 10 * 365 * 24 * time.Hour
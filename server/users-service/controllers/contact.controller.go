@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+type Contact struct {
+	dao   userdao.Contact
+	users userdao.User
+}
+
+// GetContacts lists the user's contacts, favorites first. With
+// favorites=true only favorites are returned.
+func (c *Contact) GetContacts(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	contacts, err := c.dao.GetAll(bson.ObjectIdHex(claims.Subject), ctx.Query("favorites") == "true")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load contacts."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.named(contacts))
+}
+
+// PutContact adds a user to the contact list or updates their favorite flag.
+func (c *Contact) PutContact(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	contactID, ok := c.target(ctx, claims)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Favorite bool `json:"favorite"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.dao.Set(bson.ObjectIdHex(claims.Subject), contactID, bson.M{"listed": true, "favorite": input.Favorite}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save contact."})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *Contact) DeleteContact(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	if !bson.IsObjectIdHex(ctx.Param("id")) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Contact not found."})
+		return
+	}
+
+	if err := c.dao.Remove(bson.ObjectIdHex(claims.Subject), bson.ObjectIdHex(ctx.Param("id"))); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove contact."})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *Contact) GetBlocked(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	contacts, err := c.dao.GetBlocked(bson.ObjectIdHex(claims.Subject))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load blocked users."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.named(contacts))
+}
+
+// Block stops a user from inviting or messaging the caller. The signalling
+// server reads the same contacts collection to drop their direct events.
+func (c *Contact) Block(ctx *gin.Context) {
+	c.setBlocked(ctx, true)
+}
+
+func (c *Contact) Unblock(ctx *gin.Context) {
+	c.setBlocked(ctx, false)
+}
+
+func (c *Contact) setBlocked(ctx *gin.Context, blocked bool) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	contactID, ok := c.target(ctx, claims)
+	if !ok {
+		return
+	}
+
+	fields := bson.M{"blocked": blocked}
+	if blocked {
+		fields["favorite"] = false
+	}
+	if err := c.dao.Set(bson.ObjectIdHex(claims.Subject), contactID, fields); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update blocked users."})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// target validates the :id param as another existing user.
+func (c *Contact) target(ctx *gin.Context, claims *utils.StdClaims) (bson.ObjectId, bool) {
+	id := ctx.Param("id")
+	if id == claims.Subject {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Cannot add yourself."})
+		return "", false
+	}
+	if _, err := c.users.GetByID(id); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found."})
+		return "", false
+	}
+	return bson.ObjectIdHex(id), true
+}
+
+func (c *Contact) named(contacts []database.Contact) []database.Contact {
+	for i := range contacts {
+		if user, err := c.users.GetByID(contacts[i].ContactID.Hex()); err == nil {
+			contacts[i].Name = user.Name
+		}
+	}
+	return contacts
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Deactivation struct {
+	users    userdao.User
+	sessions userdao.Session
+	audit    userdao.Audit
+}
+
+type deactivationInput struct {
+	Admin  string `json:"admin"`
+	Reason string `json:"reason"`
+}
+
+// DeactivateUser stops a person from signing in or joining meetings
+// without deleting anything of theirs: their sessions are signed out and
+// the meetings they scheduled are flagged, while their history stays. The
+// admin must name themselves and give a reason, both kept in the audit log.
+func (d *Deactivation) DeactivateUser(ctx *gin.Context) {
+	input, user, ok := d.prepare(ctx)
+	if !ok {
+		return
+	}
+	if user.Device() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Devices are deactivated through /admin/devices."})
+		return
+	}
+
+	now := time.Now()
+	if err := d.users.DeactivatePerson(user.ID, now); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User is already deactivated."})
+		return
+	}
+	d.record(ctx, "user_deactivated", input, user, now)
+
+	revoked, err := d.sessions.RevokeAll(user.ID, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign the user out."})
+		return
+	}
+	flagged, err := d.users.FlagMeetings(user.ID, &now)
+	if err != nil {
+		log.Printf("Error flagging meetings of deactivated user %s: %s", user.ID.Hex(), err)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"active": false, "deactivatedAt": now, "sessionsRevoked": revoked, "meetingsFlagged": flagged})
+}
+
+// ReactivateUser lets a deactivated person sign in again and clears the
+// flag from their upcoming meetings.
+func (d *Deactivation) ReactivateUser(ctx *gin.Context) {
+	input, user, ok := d.prepare(ctx)
+	if !ok {
+		return
+	}
+	if err := d.users.Reactivate(user.ID); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User is not deactivated."})
+		return
+	}
+	d.record(ctx, "user_reactivated", input, user, time.Now())
+
+	flagged, err := d.users.FlagMeetings(user.ID, nil)
+	if err != nil {
+		log.Printf("Error clearing meetings of reactivated user %s: %s", user.ID.Hex(), err)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"active": true, "meetingsCleared": flagged})
+}
+
+// prepare reads the admin and reason of a change and loads the user.
+func (d *Deactivation) prepare(ctx *gin.Context) (deactivationInput, database.UserModel, bool) {
+	var input deactivationInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return input, database.UserModel{}, false
+	}
+	input.Admin = strings.TrimSpace(input.Admin)
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Admin == "" || len(input.Reason) < minReasonLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "An admin name and a reason are required."})
+		return input, database.UserModel{}, false
+	}
+
+	user, err := d.users.GetByID(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found."})
+		return input, user, false
+	}
+	return input, user, true
+}
+
+func (d *Deactivation) record(ctx *gin.Context, action string, input deactivationInput, user database.UserModel, at time.Time) {
+	err := d.audit.Insert(database.AuditEntry{
+		ID:        bson.NewObjectId(),
+		At:        at,
+		Action:    action,
+		Actor:     input.Admin,
+		UserID:    user.ID.Hex(),
+		OrgID:     user.OrgID,
+		Reason:    input.Reason,
+		Service:   "users",
+		IP:        ctx.ClientIP(),
+		RequestID: ctx.GetString("requestID"),
+	})
+	if err != nil {
+		log.Printf("Error auditing %s of %s: %s", action, user.ID.Hex(), err)
+	}
+}
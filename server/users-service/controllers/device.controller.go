@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+type Device struct {
+	users    userdao.User
+	sessions userdao.Session
+	utils    utils.Utils
+}
+
+// ProvisionDevice creates an account for a piece of meeting-room hardware
+// and returns the key it signs in with. The key is only shown here; a lost
+// key means deactivating the device and provisioning it again.
+func (d *Device) ProvisionDevice(ctx *gin.Context) {
+	var input struct {
+		Name  string `json:"name"`
+		OrgID string `json:"orgID"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Name is required."})
+		return
+	}
+
+	key, keyHash, err := d.utils.GenerateRefreshToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not provision device."})
+		return
+	}
+
+	now := time.Now()
+	user := database.UserModel{
+		ID:            bson.NewObjectId(),
+		Name:          input.Name,
+		OrgID:         input.OrgID,
+		Kind:          database.KindDevice,
+		DeviceKeyHash: keyHash,
+		DeviceSession: bson.NewObjectId(),
+	}
+	session := database.LoginSession{
+		ID:        user.DeviceSession,
+		UserID:    user.ID,
+		Device:    input.Name,
+		UserAgent: ctx.Request.UserAgent(),
+		IP:        ctx.ClientIP(),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(common.DeviceSessionTTL),
+	}
+
+	if err := d.users.Insert(user); err != nil {
+		if mgo.IsDup(err) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Name is already taken."})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not provision device."})
+		return
+	}
+	if err := d.sessions.Insert(session); err != nil {
+		d.users.DeleteByID(user.ID.Hex())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not provision device."})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"id": user.ID, "name": user.Name, "orgID": user.OrgID, "key": key})
+}
+
+// ListDevices lists the provisioned devices, of one organization with
+// orgID.
+func (d *Device) ListDevices(ctx *gin.Context) {
+	devices, err := d.users.GetDevices(ctx.Query("orgID"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load devices."})
+		return
+	}
+	ctx.JSON(http.StatusOK, devices)
+}
+
+// DeactivateDevice revokes the device's key and signs it out, which drops
+// any meeting it is in.
+func (d *Device) DeactivateDevice(ctx *gin.Context) {
+	user, err := d.users.GetByID(ctx.Param("id"))
+	if err != nil || !user.Device() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Device not found."})
+		return
+	}
+	if err := d.users.Deactivate(user.ID); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Device is already deactivated."})
+		return
+	}
+	if err := d.sessions.Revoke(user.ID, user.DeviceSession); err != nil && err != mgo.ErrNotFound {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign the device out."})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeviceToken exchanges a device key for an access token. Device tokens
+// carry the "device" role, which the services only let join meetings.
+func (d *Device) DeviceToken(ctx *gin.Context) {
+	user, err := d.users.GetByDeviceKeyHash(d.utils.HashRefreshToken(ctx.PostForm("key")))
+	if err != nil || user.DeactivatedAt != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid device key."})
+		return
+	}
+
+	session, err := d.sessions.GetByID(user.DeviceSession)
+	if err != nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid device key."})
+		return
+	}
+	d.sessions.Touch(session.ID, ctx.ClientIP())
+
+	accessToken, err := d.utils.GenerateSessionJWT(user.Name, database.KindDevice, user.ID.Hex(), session.ID.Hex())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"accessToken": accessToken})
+}
+
+// NotDevice refuses device tokens on routes meant for people.
+func NotDevice(ctx *gin.Context) {
+	if claims := ctx.MustGet("claims").(*utils.StdClaims); claims.Role == database.KindDevice {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed for devices."})
+		return
+	}
+	ctx.Next()
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mgo "gopkg.in/mgo.v2"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// maxIdempotencyKey bounds the length of an Idempotency-Key.
+const maxIdempotencyKey = 255
+
+type Idempotency struct {
+	dao   userdao.Idempotency
+	utils utils.Utils
+}
+
+// Guard lets clients retry requests that create things without creating
+// them twice, as the signalling server does for sessions. Requests with an
+// Idempotency-Key header are handled once per key, caller and route;
+// retries get the first response back with an Idempotent-Replayed header.
+// A key reused with a different body is refused with 422, and a retry
+// while the first request is still being handled with 409. Keys of
+// requests that failed with a server error are forgotten so they can be
+// retried.
+func (i *Idempotency) Guard(ctx *gin.Context) {
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKey {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long."})
+		return
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Could not read request."})
+		return
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Keys are scoped to the caller, so one cannot replay another's
+	// response: the signed-in user, or the client's IP for everyone else.
+	caller := "ip:" + ctx.ClientIP()
+	if claims, err := i.utils.ParseJWT(strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")); err == nil && claims.Subject != "" {
+		caller = "user:" + claims.Subject
+	}
+	id := sha256.Sum256([]byte(ctx.Request.Method + " " + ctx.FullPath() + "\n" + caller + "\n" + key))
+	hash := sha256.Sum256(body)
+	request := database.IdempotentRequest{
+		ID:          hex.EncodeToString(id[:]),
+		RequestHash: hex.EncodeToString(hash[:]),
+		CreatedAt:   time.Now(),
+	}
+
+	if err := i.dao.Insert(request); mgo.IsDup(err) {
+		first, err := i.dao.GetByID(request.ID)
+		switch {
+		case err != nil || !first.Done && first.RequestHash == request.RequestHash:
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Request with this Idempotency-Key is in progress."})
+		case first.RequestHash != request.RequestHash:
+			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was used for a different request."})
+		default:
+			ctx.Header("Idempotent-Replayed", "true")
+			ctx.Data(first.Status, first.ContentType, first.Response)
+			ctx.Abort()
+		}
+		return
+	} else if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not save Idempotency-Key."})
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	ctx.Next()
+
+	if recorder.Status() >= http.StatusInternalServerError {
+		err = i.dao.Delete(request.ID)
+	} else {
+		err = i.dao.Complete(request.ID, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	}
+	if err != nil {
+		log.Printf("Error saving response of idempotent request %s: %s", request.ID, err)
+	}
+}
+
+// responseRecorder keeps a copy of the response body it writes.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	r.body.Write(body)
+	return r.ResponseWriter.Write(body)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// minReasonLength keeps reasons from being left as a placeholder.
+const minReasonLength = 10
+
+type Impersonation struct {
+	users    userdao.User
+	sessions userdao.Session
+	audit    userdao.Audit
+	utils    utils.Utils
+}
+
+// Impersonate mints a short-lived token to act as a user for support. The
+// admin must name themselves and give a reason; both go to the audit log,
+// and the session shows up in the user's device list.
+func (i *Impersonation) Impersonate(ctx *gin.Context) {
+	var input struct {
+		Admin  string `json:"admin"`
+		Reason string `json:"reason"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Admin = strings.TrimSpace(input.Admin)
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Admin == "" || len(input.Reason) < minReasonLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "An admin name and a reason are required."})
+		return
+	}
+
+	user, err := i.users.GetByID(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found."})
+		return
+	}
+	if !user.Active() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "User is deactivated."})
+		return
+	}
+
+	now := time.Now()
+	session := database.LoginSession{
+		ID:           bson.NewObjectId(),
+		UserID:       user.ID,
+		Device:       "Support session",
+		UserAgent:    ctx.Request.UserAgent(),
+		IP:           ctx.ClientIP(),
+		CreatedAt:    now,
+		LastSeen:     now,
+		ExpiresAt:    now.Add(common.ImpersonationTTL),
+		Impersonator: input.Admin,
+	}
+	if err := i.sessions.Insert(session); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start impersonation."})
+		return
+	}
+
+	// Nothing is issued unless the grant is on record.
+	err = i.audit.Insert(database.AuditEntry{
+		ID:        bson.NewObjectId(),
+		At:        now,
+		Action:    "impersonation_issued",
+		Actor:     input.Admin,
+		UserID:    user.ID.Hex(),
+		SessionID: session.ID.Hex(),
+		Reason:    input.Reason,
+		Service:   "users",
+		IP:        ctx.ClientIP(),
+		RequestID: ctx.GetString("requestID"),
+	})
+	if err != nil {
+		i.sessions.Revoke(user.ID, session.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start impersonation."})
+		return
+	}
+
+	token, err := i.utils.GenerateImpersonationJWT(user.Name, user.ID.Hex(), session.ID.Hex(), input.Admin)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start impersonation."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"accessToken": token, "sessionID": session.ID, "expiresAt": session.ExpiresAt})
+}
+
+// GetAuditLog lists the audit entries about a user, newest first.
+func (i *Impersonation) GetAuditLog(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit."})
+		return
+	}
+
+	entries, err := i.audit.GetByUser(ctx.Param("id"), limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load audit log."})
+		return
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// NotImpersonated refuses impersonation tokens on routes only the user
+// themselves may use.
+func NotImpersonated(ctx *gin.Context) {
+	if claims := ctx.MustGet("claims").(*utils.StdClaims); claims.Impersonator != "" {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating."})
+		return
+	}
+	ctx.Next()
+}
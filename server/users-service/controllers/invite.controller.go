@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+type Invite struct {
+	dao   userdao.Invite
+	utils utils.Utils
+}
+
+// CreateInvite emails a single-use signup link for the organization to the
+// given address.
+func (i *Invite) CreateInvite(ctx *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil || !strings.Contains(body.Email, "@") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A valid email is required."})
+		return
+	}
+
+	invite, err := sendInvite(i.dao, i.utils, ctx.Param("id"), normalizeEmail(body.Email), database.EmailInvite)
+	if err == errInviteMail {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "Could not send invite email."})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create invite."})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, invite)
+}
+
+// errInviteMail is returned by sendInvite when the invite was stored but
+// its email could not be sent.
+var errInviteMail = errors.New("could not send invite email")
+
+// inviteEmails holds the default subject and body of the emails carrying
+// a signup link.
+var inviteEmails = map[string][2]string{
+	database.EmailInvite: {
+		"You're invited to join {org}",
+		"You have been invited to join {org}.\r\n\r\nSign up here: {link}\r\n\r\nThis link expires on {expires}.\r\n",
+	},
+	database.EmailSignup: {
+		"Confirm your email to join {org}",
+		"This address was used to sign up to {org}.\r\n\r\nFinish signing up here: {link}\r\n\r\nThis link expires on {expires}. If it was not you, ignore this email.\r\n",
+	},
+}
+
+// sendInvite stores a single-use invite for email to sign up to the
+// organization and mails its link, as the email of the given kind.
+func sendInvite(invites userdao.Invite, u utils.Utils, orgID, email, kind string) (database.Invite, error) {
+	token, hash, err := u.GenerateRefreshToken()
+	if err != nil {
+		return database.Invite{}, err
+	}
+
+	now := time.Now()
+	invite := database.Invite{
+		ID:        bson.NewObjectId(),
+		OrgID:     orgID,
+		Email:     email,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(common.InviteTTL),
+	}
+	if err := invites.Insert(invite); err != nil {
+		return invite, err
+	}
+
+	// A branding lookup failure should not stop the invite; it goes out
+	// with the default wording.
+	branding, _ := invites.GetBranding(invite.OrgID)
+	subject, message := branding.Render(kind, inviteEmails[kind][0], inviteEmails[kind][1],
+		map[string]string{
+			"{org}":     branding.DisplayName(),
+			"{link}":    signupURL() + "?token=" + token,
+			"{expires}": invite.ExpiresAt.Format("2 Jan 2006"),
+		})
+	if err := u.SendMail(invite.Email, subject, message); err != nil {
+		return invite, errInviteMail
+	}
+	return invite, nil
+}
+
+func signupURL() string {
+	if url := os.Getenv("SIGNUP_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:3000/signup"
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
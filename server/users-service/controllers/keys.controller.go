@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+type Keys struct {
+	invites userdao.Invite
+}
+
+// RotateKeys rewraps the stored encrypted fields under the first key in
+// FIELD_KEYS. Run it after putting a new key first; the old key can be
+// removed once it succeeds.
+func (k *Keys) RotateKeys(ctx *gin.Context) {
+	if utils.Fields == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Field encryption is not configured."})
+		return
+	}
+	rotated, err := k.invites.RotateKeys()
+	if err != nil {
+		log.Printf("Error rotating field keys: %s", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not rotate keys.", "invites": rotated})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"invites": rotated})
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+type Preferences struct {
+	dao userdao.Preferences
+}
+
+func (p *Preferences) GetPreferences(ctx *gin.Context) {
+	userID, ok := self(ctx)
+	if !ok {
+		return
+	}
+
+	preferences, err := p.dao.Get(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load preferences."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
+
+// PutPreferences replaces the user's preferences. Fields left out of the
+// body fall back to the defaults.
+func (p *Preferences) PutPreferences(ctx *gin.Context) {
+	userID, ok := self(ctx)
+	if !ok {
+		return
+	}
+
+	preferences := database.DefaultPreferences(userID)
+	if err := ctx.ShouldBindJSON(&preferences); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	preferences.UserID = userID
+
+	if err := preferences.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := p.dao.Save(preferences); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save preferences."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preferences)
+}
+
+// self resolves the :id param, which must be the caller's own ID or "me".
+func self(ctx *gin.Context) (bson.ObjectId, bool) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	id := ctx.Param("id")
+	if id == "me" {
+		id = claims.Subject
+	}
+	if id != claims.Subject {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Forbidden."})
+		return "", false
+	}
+	return bson.ObjectIdHex(id), true
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mgo "gopkg.in/mgo.v2"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// How long a node trusts what it read of orgs' limits and users' orgs.
+const (
+	orgLimitsTTL = 30 * time.Second
+	userOrgTTL   = 5 * time.Minute
+	// maxCached bounds each cache; it is emptied when full.
+	maxCached = 10000
+)
+
+type cachedOrgLimits struct {
+	rates   map[string]utils.Rate
+	fetched time.Time
+}
+
+type cachedUserOrg struct {
+	org     string
+	fetched time.Time
+}
+
+// RateLimit limits the requests to each route, with token buckets shared by
+// every replica. Each caller, a user when the request carries a valid
+// token or else an IP, has buckets of its own. The members of an org also
+// share the org's buckets, so one tenant cannot take the service from the
+// others. Either bucket running out refuses the request.
+type RateLimit struct {
+	buckets userdao.RateLimit
+	utils   utils.Utils
+	// callers and orgs are the limits per route of callers, and of orgs
+	// without limits of their own.
+	callers map[string]utils.Rate
+	orgs    map[string]utils.Rate
+
+	mu        sync.Mutex
+	orgLimits map[string]cachedOrgLimits
+	userOrgs  map[string]cachedUserOrg
+}
+
+func NewRateLimit(callers, orgs map[string]utils.Rate) *RateLimit {
+	return &RateLimit{
+		callers:   callers,
+		orgs:      orgs,
+		orgLimits: make(map[string]cachedOrgLimits),
+		userOrgs:  make(map[string]cachedUserOrg),
+	}
+}
+
+// Limit is the middleware taking each request from its buckets. It answers
+// with the RateLimit-* headers of the tighter bucket, and refuses requests
+// with 429 and Retry-After once a bucket is empty. Should the buckets be
+// unreachable, requests are let through.
+func (r *RateLimit) Limit(ctx *gin.Context) {
+	if ctx.FullPath() == "" {
+		ctx.Next()
+		return
+	}
+	route := ctx.Request.Method + " " + ctx.FullPath()
+
+	caller := "ip:" + ctx.ClientIP()
+	org := ""
+	if claims, err := r.utils.ParseJWT(strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")); err == nil && claims.Subject != "" {
+		caller = "user:" + claims.Subject
+		org = r.userOrg(claims.Subject)
+	}
+
+	type taken struct {
+		rate      utils.Rate
+		remaining int
+		reset     time.Duration
+	}
+	var tightest *taken
+	take := func(rates map[string]utils.Rate, subject string) bool {
+		rate, bucket, ok := utils.RateFor(rates, route)
+		if !ok {
+			return true
+		}
+		allowed, remaining, reset, err := r.buckets.Take(bucket+"|"+subject, rate)
+		if err != nil {
+			log.Printf("Error taking from rate limit of %s: %s", subject, err)
+			return true
+		}
+		if !allowed {
+			utils.RateLimitHeaders(ctx, rate, 0, reset)
+			ctx.Header("Retry-After", strconv.Itoa(int((reset+time.Second-1)/time.Second)))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests."})
+			return false
+		}
+		if tightest == nil || remaining < tightest.remaining {
+			tightest = &taken{rate, remaining, reset}
+		}
+		return true
+	}
+
+	if !take(r.callers, caller) {
+		return
+	}
+	if org != "" && !take(r.orgRates(org), "org:"+org) {
+		return
+	}
+	if tightest != nil {
+		utils.RateLimitHeaders(ctx, tightest.rate, tightest.remaining, tightest.reset)
+	}
+	ctx.Next()
+}
+
+// userOrg returns the org of the user, cached for a while.
+func (r *RateLimit) userOrg(userID string) string {
+	r.mu.Lock()
+	cached, ok := r.userOrgs[userID]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < userOrgTTL {
+		return cached.org
+	}
+
+	org, err := r.buckets.GetUserOrg(userID)
+	if err != nil {
+		log.Printf("Error loading org of %s: %s", userID, err)
+		return cached.org
+	}
+	r.mu.Lock()
+	if len(r.userOrgs) >= maxCached {
+		r.userOrgs = make(map[string]cachedUserOrg)
+	}
+	r.userOrgs[userID] = cachedUserOrg{org: org, fetched: time.Now()}
+	r.mu.Unlock()
+	return org
+}
+
+// orgRates returns the org's limits per route, cached for a while: its own
+// where it has them, and the default ones for the other routes.
+func (r *RateLimit) orgRates(org string) map[string]utils.Rate {
+	r.mu.Lock()
+	cached, ok := r.orgLimits[org]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < orgLimitsTTL {
+		return cached.rates
+	}
+
+	cached = cachedOrgLimits{rates: r.orgs, fetched: time.Now()}
+	limits, err := r.buckets.GetOrgLimits(org)
+	if err != nil {
+		log.Printf("Error loading rate limits of %s: %s", org, err)
+		return r.orgs
+	}
+	if own, err := utils.ParseRates(limits.RateLimits); err != nil {
+		log.Printf("Ignoring invalid rate limits of %s: %s", org, err)
+	} else if len(own) > 0 {
+		cached.rates = make(map[string]utils.Rate, len(r.orgs)+len(own))
+		for route, rate := range r.orgs {
+			cached.rates[route] = rate
+		}
+		for route, rate := range own {
+			cached.rates[route] = rate
+		}
+	}
+
+	r.mu.Lock()
+	if len(r.orgLimits) >= maxCached {
+		r.orgLimits = make(map[string]cachedOrgLimits)
+	}
+	r.orgLimits[org] = cached
+	r.mu.Unlock()
+	return cached.rates
+}
+
+// GetOrgLimits returns the org's own rate limits per route.
+func (r *RateLimit) GetOrgLimits(ctx *gin.Context) {
+	limits, err := r.buckets.GetOrgLimits(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load rate limits."})
+		return
+	}
+	if limits.RateLimits == nil {
+		limits.RateLimits = map[string]string{}
+	}
+	ctx.JSON(http.StatusOK, limits)
+}
+
+// PutOrgLimits replaces the org's own rate limits per route, given as a
+// map of route to "<n>/<window>". Routes left out get the default org
+// limits. Every replica applies the change within orgLimitsTTL.
+func (r *RateLimit) PutOrgLimits(ctx *gin.Context) {
+	var input map[string]string
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := utils.ParseRates(input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rate limits: " + err.Error() + "."})
+		return
+	}
+
+	limits := database.OrgRateLimits{ID: ctx.Param("id"), RateLimits: input}
+	if err := r.buckets.SetOrgLimits(limits); err == mgo.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Organization not found."})
+		return
+	} else if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save rate limits."})
+		return
+	}
+	r.mu.Lock()
+	delete(r.orgLimits, limits.ID)
+	r.mu.Unlock()
+	ctx.JSON(http.StatusOK, limits)
+}
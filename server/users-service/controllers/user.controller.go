@@ -1,16 +1,404 @@
 package controllers
 
 import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
 )
 
+// lastSeenInterval bounds how often an authenticated request updates its
+// session's last seen time.
+const lastSeenInterval = time.Minute
+
 type User struct {
+	dao      userdao.User
+	profiles userdao.Profile
+	sessions userdao.Session
+	invites  userdao.Invite
+	audit    userdao.Audit
+	utils    utils.Utils
+}
+
+// CreateUser signs a new user up, enforcing the registration policy of the
+// organization they join: an invite token for invite-only organizations,
+// which are the default, or an email in one of the allowed domains. Joining
+// an organization without an invite token only emails one to the address,
+// so members' emails are always proven. Refusals carry a "code" clients
+// can act on.
+func (u *User) CreateUser(ctx *gin.Context) {
+	var input database.AddUser
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		signupError(ctx, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := input.Validate(); err != nil {
+		signupError(ctx, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	email := normalizeEmail(input.Email)
+	orgID := input.OrgID
+	var invite *database.Invite
+
+	if input.InviteToken != "" {
+		found, err := u.invites.GetByTokenHash(u.utils.HashRefreshToken(input.InviteToken))
+		switch {
+		case err != nil, found.AcceptedAt != nil, orgID != "" && orgID != found.OrgID:
+			signupError(ctx, http.StatusForbidden, "invite_invalid", "Invite is invalid or has already been used.")
+			return
+		case time.Now().After(found.ExpiresAt):
+			signupError(ctx, http.StatusForbidden, "invite_expired", "Invite has expired.")
+			return
+		case email != "" && email != found.Email:
+			signupError(ctx, http.StatusForbidden, "email_mismatch", "Email does not match the invite.")
+			return
+		}
+		invite, email, orgID = &found, found.Email, found.OrgID
+	} else if orgID != "" {
+		policy, err := u.invites.GetPolicy(orgID)
+		if err == mgo.ErrNotFound {
+			signupError(ctx, http.StatusNotFound, "org_not_found", "Organization does not exist.")
+			return
+		}
+		if err != nil {
+			signupError(ctx, http.StatusInternalServerError, "internal", "Could not load registration policy.")
+			return
+		}
+		switch policy.Registration {
+		case database.RegistrationOpen:
+		case database.RegistrationDomain:
+			if !allowedDomain(email, policy.AllowedDomains) {
+				signupError(ctx, http.StatusForbidden, "email_domain_not_allowed", "Email domain is not allowed to sign up to this organization.")
+				return
+			}
+		default:
+			signupError(ctx, http.StatusForbidden, "invite_required", "Signing up to this organization requires an invite.")
+			return
+		}
+
+		// Members join with an invite, so without one the email is proven
+		// first: it is sent a single-use invite to finish signing up with.
+		if email == "" {
+			signupError(ctx, http.StatusBadRequest, "email_required", "Signing up to an organization requires an email.")
+			return
+		}
+		if _, err := u.dao.GetByEmail(email); err == nil {
+			signupError(ctx, http.StatusConflict, "email_taken", "Email is already registered.")
+			return
+		}
+		if _, err := sendInvite(u.invites, u.utils, orgID, email, database.EmailSignup); err != nil {
+			signupError(ctx, http.StatusBadGateway, "internal", "Could not send the confirmation email.")
+			return
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{"code": "confirmation_sent", "email": email})
+		return
+	}
+
+	if _, err := u.dao.GetByName(input.Name); err == nil {
+		signupError(ctx, http.StatusConflict, "name_taken", "Name is already taken.")
+		return
+	}
+	if email != "" {
+		if _, err := u.dao.GetByEmail(email); err == nil {
+			signupError(ctx, http.StatusConflict, "email_taken", "Email is already registered.")
+			return
+		}
+	}
+
+	hash, err := u.utils.HashPassword(input.Password)
+	if err != nil {
+		signupError(ctx, http.StatusInternalServerError, "internal", "Could not create user.")
+		return
+	}
+
+	// Accepting first makes an invite single use even under concurrent
+	// signups.
+	if invite != nil {
+		if err := u.invites.Accept(invite.ID); err != nil {
+			signupError(ctx, http.StatusForbidden, "invite_invalid", "Invite is invalid or has already been used.")
+			return
+		}
+	}
+
+	user := database.UserModel{ID: bson.NewObjectId(), Name: input.Name, Password: hash, Email: email, OrgID: orgID}
+	if err := u.dao.Insert(user); err != nil {
+		if mgo.IsDup(err) {
+			signupError(ctx, http.StatusConflict, "name_taken", "Name or email is already registered.")
+			return
+		}
+		signupError(ctx, http.StatusInternalServerError, "internal", "Could not create user.")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"id": user.ID, "name": user.Name, "email": user.Email, "orgID": user.OrgID})
+}
+
+func signupError(ctx *gin.Context, status int, code string, message string) {
+	ctx.JSON(status, gin.H{"error": message, "code": code})
 }
 
+func allowedDomain(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range domains {
+		if strings.EqualFold(domain, strings.TrimPrefix(strings.TrimSpace(allowed), "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate signs a user in on a new device and returns an access token
+// and a refresh token for it.
 func (u *User) Authenticate(ctx *gin.Context) {
 	username := ctx.PostForm("user")
 	password := ctx.PostForm("password")
 
-	var err error
-	_, err = u.
+	user, err := u.dao.GetByName(username)
+	if err != nil || user.Device() || !u.utils.ComparePassword(user.Password, password) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user or password."})
+		return
+	}
+	if !user.Active() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "This account is deactivated."})
+		return
+	}
+
+	refreshToken, refreshHash, err := u.utils.GenerateRefreshToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in."})
+		return
+	}
+
+	device := ctx.PostForm("device")
+	if device == "" {
+		device = describeDevice(ctx.Request.UserAgent())
+	}
+
+	now := time.Now()
+	session := database.LoginSession{
+		ID:          bson.NewObjectId(),
+		UserID:      user.ID,
+		Device:      device,
+		UserAgent:   ctx.Request.UserAgent(),
+		IP:          ctx.ClientIP(),
+		CreatedAt:   now,
+		LastSeen:    now,
+		RefreshHash: refreshHash,
+		ExpiresAt:   now.Add(common.RefreshTokenTTL),
+	}
+	if err := u.sessions.Insert(session); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in."})
+		return
+	}
+
+	accessToken, err := u.utils.GenerateSessionJWT(user.Name, "user", user.ID.Hex(), session.ID.Hex())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, database.Token{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+// Refresh exchanges a refresh token for a new access token, rotating the
+// refresh token. Tokens of revoked sessions are refused.
+func (u *User) Refresh(ctx *gin.Context) {
+	session, err := u.sessions.GetByRefreshHash(u.utils.HashRefreshToken(ctx.PostForm("refreshToken")))
+	if err != nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token."})
+		return
+	}
+
+	user, err := u.dao.GetByID(session.UserID.Hex())
+	if err != nil || !user.Active() {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token."})
+		return
+	}
+
+	refreshToken, refreshHash, err := u.utils.GenerateRefreshToken()
+	if err == nil {
+		err = u.sessions.Rotate(session.ID, refreshHash)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token."})
+		return
+	}
+
+	accessToken, err := u.utils.GenerateSessionJWT(user.Name, "user", user.ID.Hex(), session.ID.Hex())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, database.Token{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+// Authorize requires a valid access token whose login session is still
+// active, and stores its claims as "claims". Requests made while
+// impersonating the user are written to the audit log.
+func (u *User) Authorize(ctx *gin.Context) {
+	claims, err := u.utils.ParseJWT(strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer "))
+	if err != nil || !bson.IsObjectIdHex(claims.SessionID) || !bson.IsObjectIdHex(claims.Subject) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized."})
+		return
+	}
+
+	session, err := u.sessions.GetByID(bson.ObjectIdHex(claims.SessionID))
+	if err != nil || session.RevokedAt != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been signed out."})
+		return
+	}
+
+	if time.Since(session.LastSeen) > lastSeenInterval {
+		u.sessions.Touch(session.ID, ctx.ClientIP())
+	}
+
+	ctx.Set("claims", claims)
+	ctx.Next()
+
+	if claims.Impersonator != "" {
+		u.auditImpersonated(ctx, claims)
+	}
+}
+
+// auditImpersonated records a request made with an impersonation token once
+// it has been handled.
+func (u *User) auditImpersonated(ctx *gin.Context, claims *utils.StdClaims) {
+	err := u.audit.Insert(database.AuditEntry{
+		ID:        bson.NewObjectId(),
+		At:        time.Now(),
+		Action:    "impersonated_request",
+		Actor:     claims.Impersonator,
+		UserID:    claims.Subject,
+		SessionID: claims.SessionID,
+		Service:   "users",
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Status:    ctx.Writer.Status(),
+		IP:        ctx.ClientIP(),
+		RequestID: ctx.GetString("requestID"),
+	})
+	if err != nil {
+		log.Printf("Error auditing impersonated request by %s: %s", claims.Impersonator, err)
+	}
+}
+
+// UpdateProfile changes the user's display name or avatar. Rooms the user
+// is in pick the change up from the profile event it queues.
+func (u *User) UpdateProfile(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	var input database.ProfileUpdate
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := u.profiles.Update(bson.ObjectIdHex(claims.Subject), input)
+	if err == mgo.ErrNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found."})
+		return
+	}
+	if err != nil {
+		// The profile may be saved though its event was not.
+		log.Printf("Error updating profile of %s: %s", claims.Subject, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update profile."})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"displayName": user.DisplayName, "avatarURL": user.AvatarURL})
+}
+
+// GetSessions lists the devices the user is signed in on.
+func (u *User) GetSessions(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	sessions, err := u.sessions.GetActive(bson.ObjectIdHex(claims.Subject))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load sessions."})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == claims.SessionID
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs one device out.
+func (u *User) RevokeSession(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	id := ctx.Param("id")
+	if !bson.IsObjectIdHex(id) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return
+	}
+
+	if err := u.sessions.Revoke(bson.ObjectIdHex(claims.Subject), bson.ObjectIdHex(id)); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found."})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs the user out everywhere, or everywhere else when
+// keepCurrent=true.
+func (u *User) RevokeAllSessions(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.StdClaims)
+
+	var keep bson.ObjectId
+	if ctx.Query("keepCurrent") == "true" {
+		keep = bson.ObjectIdHex(claims.SessionID)
+	}
+
+	revoked, err := u.sessions.RevokeAll(bson.ObjectIdHex(claims.Subject), keep)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke sessions."})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// describeDevice gives a rough, human-readable name for a user agent.
+func describeDevice(userAgent string) string {
+	platforms := []string{"iPhone", "iPad", "Android", "Windows", "Macintosh", "Linux"}
+	browsers := []string{"Edg", "Firefox", "Chrome", "Safari"}
+
+	platform, browser := "Unknown device", ""
+	for _, name := range platforms {
+		if strings.Contains(userAgent, name) {
+			platform = strings.Replace(name, "Macintosh", "Mac", 1)
+			break
+		}
+	}
+	for _, name := range browsers {
+		if strings.Contains(userAgent, name) {
+			browser = strings.Replace(name, "Edg", "Edge", 1)
+			break
+		}
+	}
+	if browser == "" {
+		return platform
+	}
+	return browser + " on " + platform
 }
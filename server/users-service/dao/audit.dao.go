@@ -0,0 +1,230 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+// sealBatch caps the entries one Seal call chains.
+const sealBatch = 1000
+
+type Audit struct {
+}
+
+func (a *Audit) Insert(entry database.AuditEntry) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.AuditCol)
+	return collection.Insert(&entry)
+}
+
+// GetByUser lists the newest entries about a user first.
+func (a *Audit) GetByUser(userID string, limit int) ([]database.AuditEntry, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.AuditCol)
+
+	entries := []database.AuditEntry{}
+	err := collection.Find(bson.M{"userID": userID}).Sort("-at").Limit(limit).All(&entries)
+	return entries, err
+}
+
+// head returns the last sealed entry of the org's chain, or the anchor
+// retention left, or the start of a new chain.
+func head(db *mgo.Database, orgID string) (database.AuditEntry, error) {
+	var last database.AuditEntry
+	err := db.C(common.AuditCol).Find(bson.M{"orgID": orgID, "seq": bson.M{"$exists": true}}).Sort("-seq").One(&last)
+	if err != mgo.ErrNotFound {
+		return last, err
+	}
+
+	var anchor database.AuditAnchor
+	err = db.C(common.AuditAnchorsCol).FindId(orgID).One(&anchor)
+	if err == mgo.ErrNotFound {
+		return database.AuditEntry{Hash: database.GenesisHash(orgID)}, nil
+	}
+	return database.AuditEntry{Seq: anchor.Seq, Hash: anchor.Hash}, err
+}
+
+// Seal chains the entries written since the last call, in the order they
+// were written, to the end of their org's chain, and returns how many it
+// sealed. Entries written without an org are filed under their user's.
+// Writers only insert, so the signalling server needs no part in this;
+// when two instances seal at once, the unique PrevHash index lets one
+// win and the other stops.
+func (a *Audit) Seal() (int, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	db := sessionCopy.DB(database.Database.DatabaseName)
+	collection := db.C(common.AuditCol)
+
+	var pending []database.AuditEntry
+	err := collection.Find(bson.M{"hash": bson.M{"$exists": false}}).Sort("_id").Limit(sealBatch).All(&pending)
+	if err != nil {
+		return 0, err
+	}
+
+	heads := make(map[string]database.AuditEntry)
+	for sealed, entry := range pending {
+		if entry.OrgID == "" && bson.IsObjectIdHex(entry.UserID) {
+			var user database.UserModel
+			if db.C(common.UsersCol).FindId(bson.ObjectIdHex(entry.UserID)).One(&user) == nil {
+				entry.OrgID = user.OrgID
+			}
+		}
+		last, ok := heads[entry.OrgID]
+		if !ok {
+			if last, err = head(db, entry.OrgID); err != nil {
+				return sealed, err
+			}
+		}
+
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+		entry.Hash = entry.Digest()
+		err = collection.Update(
+			bson.M{"_id": entry.ID, "hash": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"orgID": entry.OrgID, "seq": entry.Seq, "prevHash": entry.PrevHash, "hash": entry.Hash}},
+		)
+		if mgo.IsDup(err) || err == mgo.ErrNotFound {
+			// Another instance is sealing; it will finish the batch.
+			return sealed, nil
+		}
+		if err != nil {
+			return sealed, err
+		}
+		heads[entry.OrgID] = entry
+	}
+	return len(pending), nil
+}
+
+// Each calls fn with the org's sealed entries written in [from, to), in
+// chain order. Zero times leave that end open.
+func (a *Audit) Each(orgID string, from, to time.Time, fn func(database.AuditEntry) error) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.AuditCol)
+
+	query := bson.M{"orgID": orgID, "seq": bson.M{"$exists": true}}
+	at := bson.M{}
+	if !from.IsZero() {
+		at["$gte"] = from
+	}
+	if !to.IsZero() {
+		at["$lt"] = to
+	}
+	if len(at) > 0 {
+		query["at"] = at
+	}
+
+	iter := collection.Find(query).Sort("seq").Iter()
+	var entry database.AuditEntry
+	for iter.Next(&entry) {
+		if err := fn(entry); err != nil {
+			iter.Close()
+			return err
+		}
+		entry = database.AuditEntry{}
+	}
+	return iter.Close()
+}
+
+// Verify walks the org's chain from its start, or from where retention
+// cut it, and reports the first entry that was changed, removed or
+// inserted out of order.
+func (a *Audit) Verify(orgID string) (database.AuditVerification, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	db := sessionCopy.DB(database.Database.DatabaseName)
+
+	result := database.AuditVerification{OrgID: orgID, Head: database.GenesisHash(orgID)}
+	var anchor database.AuditAnchor
+	if err := db.C(common.AuditAnchorsCol).FindId(orgID).One(&anchor); err == nil {
+		result.Head = anchor.Hash
+	} else if err != mgo.ErrNotFound {
+		return result, err
+	}
+	expected := anchor.Seq + 1
+
+	iter := db.C(common.AuditCol).Find(bson.M{"orgID": orgID, "seq": bson.M{"$gt": anchor.Seq}}).Sort("seq").Iter()
+	var entry database.AuditEntry
+	for iter.Next(&entry) {
+		switch {
+		case entry.Seq != expected:
+			result.Problem = fmt.Sprintf("entries %d to %d are missing", expected, entry.Seq-1)
+		case entry.PrevHash != result.Head:
+			result.Problem = "the previous hash does not match the entry before it"
+		case entry.Digest() != entry.Hash:
+			result.Problem = "the entry does not match its hash"
+		}
+		if result.Problem != "" {
+			result.BrokenAt = entry.Seq
+			iter.Close()
+			return result, nil
+		}
+		result.Entries++
+		result.Head = entry.Hash
+		expected++
+		entry = database.AuditEntry{}
+	}
+	if err := iter.Close(); err != nil {
+		return result, err
+	}
+	result.Verified = true
+	return result, nil
+}
+
+// ApplyRetention removes the sealed entries older than their org's
+// auditRetentionDays. Entries are removed from the start of the chain
+// only, and the last one removed is kept as the chain's anchor, so what
+// remains still verifies.
+func (a *Audit) ApplyRetention() error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	db := sessionCopy.DB(database.Database.DatabaseName)
+
+	var orgs []database.OrgRetention
+	if err := db.C(common.OrgsCol).Find(bson.M{"auditRetentionDays": bson.M{"$gt": 0}}).All(&orgs); err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		cutoff := time.Now().AddDate(0, 0, -org.AuditDays)
+
+		var last database.AuditEntry
+		err := db.C(common.AuditCol).Find(bson.M{
+			"orgID": org.ID,
+			"seq":   bson.M{"$exists": true},
+			"at":    bson.M{"$lt": cutoff},
+		}).Sort("-seq").One(&last)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// The anchor goes first, so a failed removal leaves entries
+		// before the anchor, which Verify skips over, not a gap.
+		anchor := database.AuditAnchor{OrgID: org.ID, Seq: last.Seq, Hash: last.Hash}
+		if _, err := db.C(common.AuditAnchorsCol).UpsertId(org.ID, anchor); err != nil {
+			return err
+		}
+		_, err = db.C(common.AuditCol).RemoveAll(bson.M{"orgID": org.ID, "seq": bson.M{"$lte": last.Seq}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Contact struct {
+}
+
+// GetAll lists the owner's contacts, or only the favorites.
+func (c *Contact) GetAll(ownerID bson.ObjectId, favorites bool) ([]database.Contact, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.ContactsCol)
+
+	selector := bson.M{"ownerID": ownerID, "listed": true}
+	if favorites {
+		selector["favorite"] = true
+	}
+
+	var contacts []database.Contact
+	err := collection.Find(selector).Sort("-favorite", "createdAt").All(&contacts)
+	return contacts, err
+}
+
+func (c *Contact) GetBlocked(ownerID bson.ObjectId) ([]database.Contact, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.ContactsCol)
+
+	var contacts []database.Contact
+	err := collection.Find(bson.M{"ownerID": ownerID, "blocked": true}).All(&contacts)
+	return contacts, err
+}
+
+// Set creates or updates the owner's entry for contactID with fields.
+func (c *Contact) Set(ownerID, contactID bson.ObjectId, fields bson.M) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.ContactsCol)
+	_, err := collection.Upsert(
+		bson.M{"ownerID": ownerID, "contactID": contactID},
+		bson.M{
+			"$set":         fields,
+			"$setOnInsert": bson.M{"_id": bson.NewObjectId(), "createdAt": time.Now()},
+		},
+	)
+	return err
+}
+
+// Remove takes contactID off the owner's list, keeping any block in place.
+func (c *Contact) Remove(ownerID, contactID bson.ObjectId) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.ContactsCol)
+	selector := bson.M{"ownerID": ownerID, "contactID": contactID}
+
+	if _, err := collection.RemoveAll(bson.M{"ownerID": ownerID, "contactID": contactID, "blocked": false}); err != nil {
+		return err
+	}
+	err := collection.Update(selector, bson.M{"$set": bson.M{"listed": false, "favorite": false}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// IsBlocked reports whether ownerID has blocked otherID.
+func (c *Contact) IsBlocked(ownerID, otherID bson.ObjectId) (bool, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.ContactsCol)
+	count, err := collection.Find(bson.M{"ownerID": ownerID, "contactID": otherID, "blocked": true}).Count()
+	return count > 0, err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Idempotency struct {
+}
+
+// Insert records a request by its key. It fails with a duplicate key error
+// if the key was already used.
+func (i *Idempotency) Insert(request database.IdempotentRequest) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.IdempotencyCol)
+	return collection.Insert(&request)
+}
+
+func (i *Idempotency) GetByID(id string) (database.IdempotentRequest, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.IdempotencyCol)
+
+	var request database.IdempotentRequest
+	err := collection.FindId(id).One(&request)
+	return request, err
+}
+
+// Complete keeps the response a request got, for replay.
+func (i *Idempotency) Complete(id string, status int, contentType string, response []byte) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.IdempotencyCol)
+	return collection.UpdateId(id, bson.M{"$set": bson.M{
+		"status":      status,
+		"contentType": contentType,
+		"response":    response,
+		"done":        true,
+	}})
+}
+
+// Delete forgets a key, so the request can be made again.
+func (i *Idempotency) Delete(id string) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.IdempotencyCol)
+	return collection.RemoveId(id)
+}
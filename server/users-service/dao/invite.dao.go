@@ -0,0 +1,128 @@
+package database
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// inviteEmail names the encrypted email field; see utils.FieldKeys.
+const inviteEmail = "invites.email"
+
+type Invite struct {
+}
+
+// Insert stores the invite with its email encrypted.
+func (i *Invite) Insert(invite database.Invite) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	var err error
+	if invite.Email, err = utils.Fields.Encrypt(inviteEmail, invite.Email); err != nil {
+		return err
+	}
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.InvitesCol)
+	return collection.Insert(&invite)
+}
+
+func (i *Invite) GetByTokenHash(hash string) (database.Invite, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.InvitesCol)
+
+	var invite database.Invite
+	if err := collection.Find(bson.M{"tokenHash": hash}).One(&invite); err != nil {
+		return invite, err
+	}
+	var err error
+	invite.Email, err = utils.Fields.Decrypt(inviteEmail, invite.Email)
+	return invite, err
+}
+
+// RotateKeys rewraps every invite email under the active field key,
+// encrypting those still stored in plain text. It returns how many it
+// rewrote; the others were already up to date.
+func (i *Invite) RotateKeys() (int, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.InvitesCol)
+
+	rotated := 0
+	var invite database.Invite
+	iter := collection.Find(nil).Select(bson.M{"email": 1}).Iter()
+	for iter.Next(&invite) {
+		email, changed, err := utils.Fields.Rewrap(inviteEmail, invite.Email)
+		if err != nil {
+			iter.Close()
+			return rotated, err
+		}
+		if !changed {
+			continue
+		}
+		err = collection.Update(bson.M{"_id": invite.ID, "email": invite.Email}, bson.M{"$set": bson.M{"email": email}})
+		if err != nil && err != mgo.ErrNotFound {
+			iter.Close()
+			return rotated, err
+		}
+		if err == nil {
+			rotated++
+		}
+	}
+	return rotated, iter.Close()
+}
+
+// Accept marks the invite used. It fails if it was already accepted, so an
+// invite signs up exactly one user.
+func (i *Invite) Accept(id bson.ObjectId) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.InvitesCol)
+	return collection.Update(
+		bson.M{"_id": id, "acceptedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"acceptedAt": time.Now()}},
+	)
+}
+
+// GetPolicy returns the organization's registration policy, failing with
+// mgo.ErrNotFound for organizations that do not exist. Organizations that
+// set none are invite only.
+func (i *Invite) GetPolicy(orgID string) (database.OrgPolicy, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.OrgsCol)
+
+	var policy database.OrgPolicy
+	if err := collection.FindId(orgID).One(&policy); err != nil {
+		return policy, err
+	}
+	if policy.Registration == "" {
+		policy.Registration = database.RegistrationInvite
+	}
+	return policy, nil
+}
+
+// GetBranding returns the organization's branding; organizations without
+// any get the default emails.
+func (i *Invite) GetBranding(orgID string) (database.Branding, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.BrandingCol)
+
+	branding := database.Branding{ID: orgID}
+	err := collection.FindId(orgID).One(&branding)
+	if err == mgo.ErrNotFound {
+		return branding, nil
+	}
+	return branding, err
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Preferences struct {
+}
+
+// Get returns the user's preferences, or the defaults if none were saved.
+func (p *Preferences) Get(userID bson.ObjectId) (database.Preferences, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.PreferencesCol)
+
+	preferences := database.DefaultPreferences(userID)
+	err := collection.FindId(userID).One(&preferences)
+	if err == mgo.ErrNotFound {
+		return preferences, nil
+	}
+	return preferences, err
+}
+
+func (p *Preferences) Save(preferences database.Preferences) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.PreferencesCol)
+	_, err := collection.UpsertId(preferences.UserID, &preferences)
+	return err
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Profile struct {
+}
+
+// Update applies the update to the user's profile and queues a profile
+// event for the signalling servers. It returns the profile as updated.
+func (p *Profile) Update(id bson.ObjectId, update database.ProfileUpdate) (database.UserModel, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	set, unset := bson.M{}, bson.M{}
+	for field, value := range map[string]*string{"displayName": update.DisplayName, "avatarURL": update.AvatarURL} {
+		switch {
+		case value == nil:
+		case *value == "":
+			unset[field] = ""
+		default:
+			set[field] = *value
+		}
+	}
+	change := bson.M{}
+	if len(set) > 0 {
+		change["$set"] = set
+	}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+
+	var user database.UserModel
+	users := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+	_, err := users.FindId(id).Apply(mgo.Change{Update: change, ReturnNew: true}, &user)
+	if err != nil {
+		return user, err
+	}
+
+	events := sessionCopy.DB(database.Database.DatabaseName).C(common.ProfileEventsCol)
+	err = events.Insert(database.ProfileEvent{
+		ID:          bson.NewObjectId(),
+		UserID:      user.ID.Hex(),
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		At:          time.Now(),
+	})
+	return user, err
+}
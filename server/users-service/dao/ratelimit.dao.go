@@ -0,0 +1,110 @@
+package database
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// takeAttempts bounds the retries of a Take racing other replicas.
+const takeAttempts = 5
+
+type RateLimit struct {
+}
+
+// Take takes a request from the bucket named key, kept in MongoDB so every
+// replica shares it. Buckets are token buckets written as a generic cell
+// rate: each request moves the bucket's theoretical arrival time one
+// interval on, and a request that would move it more than a window past
+// now is refused. It returns whether the request is allowed, the requests
+// left and how long until the bucket is full again, or on refusal how long
+// until the next request is allowed.
+func (r *RateLimit) Take(key string, rate utils.Rate) (bool, int, time.Duration, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.RateLimitsCol)
+
+	interval := rate.Interval().Milliseconds()
+	window := rate.Window.Milliseconds()
+	var err error
+	for attempt := 0; attempt < takeAttempts; attempt++ {
+		now := time.Now().UnixMilli()
+		var bucket database.RateBucket
+		err = collection.FindId(key).One(&bucket)
+		if err != nil && err != mgo.ErrNotFound {
+			return true, 0, 0, err
+		}
+		found := err == nil
+
+		tat := max(bucket.TAT, now)
+		next := tat + interval
+		if next-window > now {
+			return false, 0, time.Duration(next-window-now) * time.Millisecond, nil
+		}
+
+		update := database.RateBucket{ID: key, TAT: next, ExpiresAt: time.UnixMilli(next)}
+		if found {
+			err = collection.Update(bson.M{"_id": key, "tat": bucket.TAT}, update)
+		} else {
+			err = collection.Insert(update)
+		}
+		if err == mgo.ErrNotFound || mgo.IsDup(err) {
+			continue
+		}
+		if err != nil {
+			return true, 0, 0, err
+		}
+		remaining := int((window - (next - now)) / interval)
+		return true, remaining, time.Duration(next-now) * time.Millisecond, nil
+	}
+	return true, 0, 0, err
+}
+
+// GetOrgLimits returns the org's own rate limits per route.
+func (r *RateLimit) GetOrgLimits(orgID string) (database.OrgRateLimits, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.OrgsCol)
+
+	limits := database.OrgRateLimits{ID: orgID}
+	err := collection.FindId(orgID).Select(bson.M{"rateLimits": 1}).One(&limits)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return limits, err
+}
+
+// SetOrgLimits replaces the org's own rate limits. It returns
+// mgo.ErrNotFound for orgs that do not exist.
+func (r *RateLimit) SetOrgLimits(limits database.OrgRateLimits) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.OrgsCol)
+	return collection.UpdateId(limits.ID, bson.M{"$set": bson.M{"rateLimits": limits.RateLimits}})
+}
+
+// GetUserOrg returns the org the user belongs to, empty for none.
+func (r *RateLimit) GetUserOrg(userID string) (string, error) {
+	if !bson.IsObjectIdHex(userID) {
+		return "", nil
+	}
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+
+	var user database.UserModel
+	err := collection.FindId(bson.ObjectIdHex(userID)).Select(bson.M{"orgID": 1}).One(&user)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return user.OrgID, err
+}
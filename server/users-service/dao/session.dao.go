@@ -0,0 +1,111 @@
+package database
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+)
+
+type Session struct {
+}
+
+func (s *Session) Insert(session database.LoginSession) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+	return collection.Insert(&session)
+}
+
+func (s *Session) GetByID(id bson.ObjectId) (database.LoginSession, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+
+	var session database.LoginSession
+	err := collection.FindId(id).One(&session)
+	return session, err
+}
+
+func (s *Session) GetByRefreshHash(hash string) (database.LoginSession, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+
+	var session database.LoginSession
+	err := collection.Find(bson.M{"refreshHash": hash}).One(&session)
+	return session, err
+}
+
+// GetActive lists the user's sessions that are neither revoked nor expired.
+func (s *Session) GetActive(userID bson.ObjectId) ([]database.LoginSession, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+
+	var sessions []database.LoginSession
+	err := collection.Find(bson.M{
+		"userID":    userID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Sort("-lastSeen").All(&sessions)
+	return sessions, err
+}
+
+// Rotate replaces the session's refresh token, so a leaked one can only be
+// used once.
+func (s *Session) Rotate(id bson.ObjectId, refreshHash string) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+	return collection.UpdateId(id, bson.M{"$set": bson.M{
+		"refreshHash": refreshHash,
+		"lastSeen":    time.Now(),
+		"expiresAt":   time.Now().Add(common.RefreshTokenTTL),
+	}})
+}
+
+func (s *Session) Touch(id bson.ObjectId, ip string) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+	return collection.UpdateId(id, bson.M{"$set": bson.M{"lastSeen": time.Now(), "ip": ip}})
+}
+
+// Revoke ends one of the user's sessions.
+func (s *Session) Revoke(userID, id bson.ObjectId) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+	return collection.Update(
+		bson.M{"_id": id, "userID": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}, "$unset": bson.M{"refreshHash": ""}},
+	)
+}
+
+// RevokeAll ends every session of the user except keep, which may be empty.
+func (s *Session) RevokeAll(userID bson.ObjectId, keep bson.ObjectId) (int, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.SessionsCol)
+
+	selector := bson.M{"userID": userID, "revokedAt": bson.M{"$exists": false}}
+	if keep != "" {
+		selector["_id"] = bson.M{"$ne": keep}
+	}
+	info, err := collection.UpdateAll(selector, bson.M{"$set": bson.M{"revokedAt": time.Now()}, "$unset": bson.M{"refreshHash": ""}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Updated, nil
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/r3tr056/go-videoconf/users-service/common"
@@ -14,7 +16,7 @@ type User struct {
 
 func (u *User) GetAll() ([]database.UserModel, error) {
 	sessionCopy := database.Database.MgDBSession.Copy()
-	defer sessionCopy.Copy()
+	defer sessionCopy.Close()
 
 	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
 
@@ -40,6 +42,129 @@ func (u *User) GetByID(id string) (database.UserModel, error) {
 	return user, err
 }
 
+func (u *User) GetByName(name string) (database.UserModel, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+
+	var user database.UserModel
+	err := collection.Find(bson.M{"name": name}).One(&user)
+	return user, err
+}
+
+func (u *User) GetByEmail(email string) (database.UserModel, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+
+	var user database.UserModel
+	err := collection.Find(bson.M{"email": email}).One(&user)
+	return user, err
+}
+
+func (u *User) GetByDeviceKeyHash(hash string) (database.UserModel, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+
+	var user database.UserModel
+	err := collection.Find(bson.M{"deviceKeyHash": hash, "kind": database.KindDevice}).One(&user)
+	return user, err
+}
+
+// GetDevices lists the device accounts, of one organization when orgID is
+// set.
+func (u *User) GetDevices(orgID string) ([]database.UserModel, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+
+	selector := bson.M{"kind": database.KindDevice}
+	if orgID != "" {
+		selector["orgID"] = orgID
+	}
+	devices := []database.UserModel{}
+	err := collection.Find(selector).Sort("name").All(&devices)
+	return devices, err
+}
+
+// Deactivate marks the device deactivated and forgets its key. It fails if
+// the device was already deactivated.
+func (u *User) Deactivate(id bson.ObjectId) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+	return collection.Update(
+		bson.M{"_id": id, "kind": database.KindDevice, "deactivatedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deactivatedAt": time.Now()}, "$unset": bson.M{"deviceKeyHash": ""}},
+	)
+}
+
+// DeactivatePerson deactivates an account that is not a device. It returns
+// mgo.ErrNotFound if there is none or it already is deactivated.
+func (u *User) DeactivatePerson(id bson.ObjectId, at time.Time) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+	return collection.Update(
+		bson.M{"_id": id, "kind": bson.M{"$ne": database.KindDevice}, "deactivatedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deactivatedAt": at}},
+	)
+}
+
+// Reactivate lets a deactivated person sign in again. Devices are
+// provisioned anew instead. It returns mgo.ErrNotFound if there is no such
+// deactivated person.
+func (u *User) Reactivate(id bson.ObjectId) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+	return collection.Update(
+		bson.M{"_id": id, "kind": bson.M{"$ne": database.KindDevice}, "deactivatedAt": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deactivatedAt": ""}},
+	)
+}
+
+// FlagMeetings marks the meetings the user scheduled that are yet to start
+// as owned by a deactivated user, or clears the mark with a nil at. It
+// returns how many it changed.
+func (u *User) FlagMeetings(id bson.ObjectId, at *time.Time) (int, error) {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.MeetingsCol)
+
+	selector := bson.M{
+		"ownerID":     id.Hex(),
+		"startsAt":    bson.M{"$gt": time.Now()},
+		"cancelledAt": bson.M{"$exists": false},
+	}
+	update := bson.M{"$unset": bson.M{"ownerDeactivatedAt": ""}}
+	if at != nil {
+		update = bson.M{"$set": bson.M{"ownerDeactivatedAt": *at}}
+	}
+	info, err := collection.UpdateAll(selector, update)
+	if err != nil {
+		return 0, err
+	}
+	return info.Updated, nil
+}
+
+func (u *User) Insert(user database.UserModel) error {
+	sessionCopy := database.Database.MgDBSession.Copy()
+	defer sessionCopy.Close()
+
+	collection := sessionCopy.DB(database.Database.DatabaseName).C(common.UsersCol)
+	return collection.Insert(&user)
+}
+
 func (u *User) DeleteByID(id string) error {
 	var err error
 	err = u.utils.ValidateObjectId(id)
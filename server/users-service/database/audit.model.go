@@ -0,0 +1,87 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AuditEntry records an impersonation being granted ("impersonation_issued")
+// or a request made with an impersonation token ("impersonated_request").
+// The signalling server writes entries of the second kind too.
+//
+// Entries are chained per organization: once sealed, each carries its
+// position in the org's chain and the hash of the entry before it, so
+// editing, removing or reordering entries breaks the chain. See
+// dao.Audit.Seal.
+type AuditEntry struct {
+	ID        bson.ObjectId `bson:"_id" json:"id"`
+	At        time.Time     `bson:"at" json:"at"`
+	Action    string        `bson:"action" json:"action"`
+	Actor     string        `bson:"actor" json:"actor"`
+	UserID    string        `bson:"userID" json:"userID"`
+	OrgID     string        `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	SessionID string        `bson:"sessionID,omitempty" json:"sessionID,omitempty"`
+	Reason    string        `bson:"reason,omitempty" json:"reason,omitempty"`
+	Service   string        `bson:"service" json:"service"`
+	Method    string        `bson:"method,omitempty" json:"method,omitempty"`
+	Path      string        `bson:"path,omitempty" json:"path,omitempty"`
+	Status    int           `bson:"status,omitempty" json:"status,omitempty"`
+	IP        string        `bson:"ip,omitempty" json:"ip,omitempty"`
+	RequestID string        `bson:"requestID,omitempty" json:"requestID,omitempty"`
+
+	Seq      int64  `bson:"seq,omitempty" json:"seq,omitempty"`
+	PrevHash string `bson:"prevHash,omitempty" json:"prevHash,omitempty"`
+	Hash     string `bson:"hash,omitempty" json:"hash,omitempty"`
+}
+
+// GenesisHash is the PrevHash of the first entry in an org's chain. It
+// differs per org, so no two entries anywhere share a PrevHash.
+func GenesisHash(orgID string) string {
+	sum := sha256.Sum256([]byte("audit:" + orgID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Digest returns the hash the entry should carry: SHA-256 over its
+// PrevHash and its JSON encoding without the hash. Times are hashed in UTC
+// to the millisecond, as MongoDB stores them.
+func (e AuditEntry) Digest() string {
+	e.Hash = ""
+	e.At = e.At.UTC().Truncate(time.Millisecond)
+	encoded, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), encoded...))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditAnchor is the last entry retention removed from an org's chain, so
+// the rest of the chain can still be verified, and entries removed from
+// its start by anything else noticed.
+type AuditAnchor struct {
+	OrgID string `bson:"_id" json:"orgID"`
+	Seq   int64  `bson:"seq" json:"seq"`
+	Hash  string `bson:"hash" json:"hash"`
+}
+
+// OrgRetention is the retention part of an organization document, which
+// the signalling server's admin API manages. Zero keeps entries forever.
+type OrgRetention struct {
+	ID        string `bson:"_id"`
+	AuditDays int    `bson:"auditRetentionDays"`
+}
+
+// AuditVerification is the result of checking an org's chain.
+type AuditVerification struct {
+	OrgID    string `json:"orgID"`
+	Entries  int    `json:"entries"`
+	Verified bool   `json:"verified"`
+	// BrokenAt is the sequence number of the first entry that does not
+	// check out, and Problem what is wrong with it.
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+	// Head is the hash of the last entry; auditors can keep it to check
+	// that later exports extend the same chain.
+	Head string `json:"head"`
+}
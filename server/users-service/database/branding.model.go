@@ -0,0 +1,55 @@
+package database
+
+import "strings"
+
+// Emails an organization's branding can rewrite.
+const (
+	EmailInvite = "invite"
+	// EmailSignup confirms the address of someone signing up to an
+	// organization without an invite.
+	EmailSignup = "signup"
+)
+
+// EmailTemplate overrides an email's subject and body; empty parts keep the
+// default.
+type EmailTemplate struct {
+	Subject string `bson:"subject"`
+	Body    string `bson:"body"`
+}
+
+// Branding is the part of an organization's branding the emails use. The
+// signalling server's admin API manages it.
+type Branding struct {
+	ID             string                   `bson:"_id"`
+	Name           string                   `bson:"name"`
+	EmailTemplates map[string]EmailTemplate `bson:"emailTemplates"`
+}
+
+// DisplayName is how emails name the organization.
+func (b Branding) DisplayName() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return b.ID
+}
+
+// Render fills in the email's subject and body, from the organization's
+// template where it has one and the given defaults otherwise. vars maps
+// placeholders such as "{link}" to their values.
+func (b Branding) Render(email, subject, body string, vars map[string]string) (string, string) {
+	if template, ok := b.EmailTemplates[email]; ok {
+		if template.Subject != "" {
+			subject = template.Subject
+		}
+		if template.Body != "" {
+			body = template.Body
+		}
+	}
+
+	pairs := make([]string, 0, 2*len(vars))
+	for placeholder, value := range vars {
+		pairs = append(pairs, placeholder, value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	return replacer.Replace(subject), replacer.Replace(body)
+}
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Contact is one entry in a user's contact list. A blocked entry stays in
+// the list so the block survives removing the contact.
+type Contact struct {
+	ID        bson.ObjectId `bson:"_id" json:"-"`
+	OwnerID   bson.ObjectId `bson:"ownerID" json:"-"`
+	ContactID bson.ObjectId `bson:"contactID" json:"id"`
+	Name      string        `bson:"-" json:"name,omitempty"`
+	Favorite  bool          `bson:"favorite" json:"favorite"`
+	Blocked   bool          `bson:"blocked" json:"blocked"`
+	Listed    bool          `bson:"listed" json:"-"`
+	CreatedAt time.Time     `bson:"createdAt" json:"createdAt"`
+}
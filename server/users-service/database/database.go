@@ -2,9 +2,11 @@ package database
 
 import (
 	"log"
+	"os"
 	"time"
 
 	"github.com/r3tr056/go-videoconf/users-service/common"
+	"golang.org/x/crypto/bcrypt"
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -22,11 +24,11 @@ func (db *MongoDB) Init() error {
 	db.DatabaseName = common.MgDBName
 
 	dialInfo := &mgo.DialInfo{
-		Addrs:    []string{common.MgAddress},
+		Addrs:    []string{getenv("DB_URL", common.MgAddress)},
 		Timeout:  60 * time.Second,
 		Database: db.DatabaseName,
-		Username: common.MgUsername,
-		Password: common.MgPassword,
+		Username: getenv("DB_USERNAME", common.MgUsername),
+		Password: getenv("DB_PASSWORD", common.MgPassword),
 	}
 
 	var err error
@@ -48,16 +50,146 @@ func (db *MongoDB) initData() error {
 	defer sessionCopy.Close()
 
 	collection := sessionCopy.DB(db.DatabaseName).C(common.UsersCol)
+
+	err = collection.EnsureIndex(mgo.Index{
+		Key:        []string{"name"},
+		Unique:     true,
+		Background: true,
+	})
+	if err != nil {
+		log.Print("Can't create users index, go error:", err)
+		return err
+	}
+
+	sessions := sessionCopy.DB(db.DatabaseName).C(common.SessionsCol)
+	for _, index := range []mgo.Index{
+		{Key: []string{"refreshHash"}, Unique: true, Sparse: true, Background: true},
+		{Key: []string{"userID", "-lastSeen"}, Background: true},
+		{Key: []string{"revokedAt"}, Sparse: true, Background: true},
+	} {
+		if err = sessions.EnsureIndex(index); err != nil {
+			log.Print("Can't create login session index, go error:", err)
+			return err
+		}
+	}
+
+	contacts := sessionCopy.DB(db.DatabaseName).C(common.ContactsCol)
+	for _, index := range []mgo.Index{
+		{Key: []string{"ownerID", "contactID"}, Unique: true, Background: true},
+		{Key: []string{"contactID", "blocked"}, Background: true},
+	} {
+		if err = contacts.EnsureIndex(index); err != nil {
+			log.Print("Can't create contacts index, go error:", err)
+			return err
+		}
+	}
+
+	err = collection.EnsureIndex(mgo.Index{
+		Key:        []string{"email"},
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+	})
+	if err != nil {
+		log.Print("Can't create users email index, go error:", err)
+		return err
+	}
+
+	err = collection.EnsureIndex(mgo.Index{
+		Key:        []string{"deviceKeyHash"},
+		Unique:     true,
+		Sparse:     true,
+		Background: true,
+	})
+	if err != nil {
+		log.Print("Can't create users device key index, go error:", err)
+		return err
+	}
+
+	invites := sessionCopy.DB(db.DatabaseName).C(common.InvitesCol)
+	for _, index := range []mgo.Index{
+		{Key: []string{"tokenHash"}, Unique: true, Background: true},
+		{Key: []string{"orgID", "email"}, Background: true},
+	} {
+		if err = invites.EnsureIndex(index); err != nil {
+			log.Print("Can't create invites index, go error:", err)
+			return err
+		}
+	}
+
+	audit := sessionCopy.DB(db.DatabaseName).C(common.AuditCol)
+	for _, index := range []mgo.Index{
+		{Key: []string{"userID", "-at"}, Background: true},
+		{Key: []string{"orgID", "seq"}, Background: true},
+		{Key: []string{"orgID", "at"}, Background: true},
+		// No two entries may follow the same one; see dao.Audit.Seal.
+		{Key: []string{"prevHash"}, Unique: true, Sparse: true, Background: true},
+	} {
+		if err = audit.EnsureIndex(index); err != nil {
+			log.Print("Can't create audit log index, go error:", err)
+			return err
+		}
+	}
+
+	buckets := sessionCopy.DB(db.DatabaseName).C(common.RateLimitsCol)
+	err = buckets.EnsureIndex(mgo.Index{
+		Key:         []string{"expiresAt"},
+		ExpireAfter: time.Second,
+		Background:  true,
+	})
+	if err != nil {
+		log.Print("Can't create rate limits index, go error:", err)
+		return err
+	}
+
+	idempotency := sessionCopy.DB(db.DatabaseName).C(common.IdempotencyCol)
+	err = idempotency.EnsureIndex(mgo.Index{
+		Key:         []string{"createdAt"},
+		ExpireAfter: common.IdempotencyTTL,
+		Background:  true,
+	})
+	if err != nil {
+		log.Print("Can't create idempotency keys index, go error:", err)
+		return err
+	}
+
+	profileEvents := sessionCopy.DB(db.DatabaseName).C(common.ProfileEventsCol)
+	err = profileEvents.EnsureIndex(mgo.Index{
+		Key:         []string{"at"},
+		ExpireAfter: common.ProfileEventTTL,
+		Background:  true,
+	})
+	if err != nil {
+		log.Print("Can't create profile events index, go error:", err)
+		return err
+	}
+
 	count, err = collection.Find(bson.M{}).Count()
 
 	if count < 1 {
-		user := UserModel{bson.NewObjectId(), "admin", "admin"}
+		// Passwords are stored as bcrypt hashes.
+		hash, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
+		user := UserModel{ID: bson.NewObjectId(), Name: "admin", Password: string(hash)}
 		err = collection.Insert(&user)
 	}
 
 	return err
 }
 
+// DefaultCredentials reports whether MongoDB is accessed with the built-in
+// development credentials.
+func DefaultCredentials() bool {
+	return getenv("DB_USERNAME", common.MgUsername) == common.MgUsername &&
+		getenv("DB_PASSWORD", common.MgPassword) == common.MgPassword
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 func (db *MongoDB) Close() {
 	if db.MgDBSession != nil {
 		db.MgDBSession.Close()
@@ -0,0 +1,16 @@
+package database
+
+import "time"
+
+// IdempotentRequest is a request made with an Idempotency-Key header, kept
+// for IdempotencyTTL so retries get its response back. The response is
+// empty until the request was handled.
+type IdempotentRequest struct {
+	ID          string    `bson:"_id"`
+	RequestHash string    `bson:"requestHash"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Response    []byte    `bson:"response,omitempty"`
+	Done        bool      `bson:"done"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Registration policies an organization can set. Organizations without one
+// are invite only.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationDomain = "domain"
+)
+
+// OrgPolicy is the registration part of an organization document, which
+// the signalling server's admin API manages.
+type OrgPolicy struct {
+	ID             string   `bson:"_id"`
+	Registration   string   `bson:"registration"`
+	AllowedDomains []string `bson:"allowedDomains"`
+}
+
+// Invite lets one email address sign up to an invite-only organization.
+// Only a hash of the emailed token is stored.
+type Invite struct {
+	ID         bson.ObjectId `bson:"_id" json:"id"`
+	OrgID      string        `bson:"orgID" json:"orgID"`
+	Email      string        `bson:"email" json:"email"`
+	TokenHash  string        `bson:"tokenHash" json:"-"`
+	CreatedAt  time.Time     `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time     `bson:"expiresAt" json:"expiresAt"`
+	AcceptedAt *time.Time    `bson:"acceptedAt,omitempty" json:"acceptedAt,omitempty"`
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"errors"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var videoQualities = map[string]bool{"auto": true, "low": true, "medium": true, "high": true}
+
+type NotificationSettings struct {
+	Email            bool `bson:"email" json:"email"`
+	Push             bool `bson:"push" json:"push"`
+	ChatSounds       bool `bson:"chatSounds" json:"chatSounds"`
+	MeetingReminders bool `bson:"meetingReminders" json:"meetingReminders"`
+}
+
+// Preferences are a user's meeting defaults. The signalling server reads the
+// same document to put the effective defaults in join responses.
+type Preferences struct {
+	UserID          bson.ObjectId        `bson:"_id" json:"-"`
+	MuteOnJoin      bool                 `bson:"muteOnJoin" json:"muteOnJoin"`
+	VideoOffOnJoin  bool                 `bson:"videoOffOnJoin" json:"videoOffOnJoin"`
+	VideoQuality    string               `bson:"videoQuality" json:"videoQuality"`
+	CaptionLanguage string               `bson:"captionLanguage" json:"captionLanguage"`
+	Notifications   NotificationSettings `bson:"notifications" json:"notifications"`
+	// DoNotDisturb declines incoming direct calls, which are recorded as
+	// missed instead of ringing.
+	DoNotDisturb bool `bson:"doNotDisturb" json:"doNotDisturb"`
+}
+
+// DefaultPreferences apply to users who never saved any.
+func DefaultPreferences(userID bson.ObjectId) Preferences {
+	return Preferences{
+		UserID:          userID,
+		VideoQuality:    "auto",
+		CaptionLanguage: "en",
+		Notifications:   NotificationSettings{Email: true, Push: true, ChatSounds: true, MeetingReminders: true},
+	}
+}
+
+func (p Preferences) Validate() error {
+	switch {
+	case !videoQualities[p.VideoQuality]:
+		return errors.New("videoQuality must be auto, low, medium or high")
+	case len(p.CaptionLanguage) < 2 || len(p.CaptionLanguage) > 16:
+		return errors.New("captionLanguage must be a language tag")
+	default:
+		return nil
+	}
+}
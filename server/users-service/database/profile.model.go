@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Bounds on a profile.
+const (
+	maxDisplayName = 64
+	maxAvatarURL   = 2048
+)
+
+// ProfileUpdate changes how the user is shown in meetings. Fields left nil
+// are kept; an empty string clears them.
+type ProfileUpdate struct {
+	DisplayName *string `json:"displayName"`
+	AvatarURL   *string `json:"avatarURL"`
+}
+
+func (p *ProfileUpdate) Validate() error {
+	if p.DisplayName != nil {
+		name := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayName {
+			return errors.New("displayName is longer than 64 characters")
+		}
+		p.DisplayName = &name
+	}
+	if p.AvatarURL != nil && *p.AvatarURL != "" {
+		parsed, err := url.Parse(*p.AvatarURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" || len(*p.AvatarURL) > maxAvatarURL {
+			return errors.New("avatarURL must be an https URL")
+		}
+	}
+	if p.DisplayName == nil && p.AvatarURL == nil {
+		return errors.New("nothing to update")
+	}
+	return nil
+}
+
+// ProfileEvent tells the signalling servers that a user's profile changed,
+// so the rooms the user is in can update their rosters. Events are kept for
+// ProfileEventTTL.
+type ProfileEvent struct {
+	ID          bson.ObjectId `bson:"_id"`
+	UserID      string        `bson:"userID"`
+	DisplayName string        `bson:"displayName"`
+	AvatarURL   string        `bson:"avatarURL"`
+	At          time.Time     `bson:"at"`
+}
@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// RateBucket is the state of one rate limit bucket, shared by every replica:
+// the theoretical arrival time of the next request, in Unix milliseconds.
+// A bucket is full again once TAT has passed, and is removed at ExpiresAt.
+type RateBucket struct {
+	ID        string    `bson:"_id"`
+	TAT       int64     `bson:"tat"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// OrgRateLimits is the rate limit part of an organization document: per
+// route, the requests its members may make together, as "<n>/<window>".
+type OrgRateLimits struct {
+	ID         string            `bson:"_id" json:"orgID"`
+	RateLimits map[string]string `bson:"rateLimits" json:"rateLimits"`
+}
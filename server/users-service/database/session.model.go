@@ -0,0 +1,27 @@
+package database
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// LoginSession is one signed-in device. Its refresh token is stored hashed;
+// revoking the session stops it from being refreshed and tells the
+// signalling servers to drop its sockets.
+type LoginSession struct {
+	ID          bson.ObjectId `bson:"_id" json:"id"`
+	UserID      bson.ObjectId `bson:"userID" json:"-"`
+	Device      string        `bson:"device" json:"device"`
+	UserAgent   string        `bson:"userAgent" json:"userAgent"`
+	IP          string        `bson:"ip" json:"ip"`
+	CreatedAt   time.Time     `bson:"createdAt" json:"createdAt"`
+	LastSeen    time.Time     `bson:"lastSeen" json:"lastSeen"`
+	RefreshHash string        `bson:"refreshHash,omitempty" json:"-"`
+	ExpiresAt   time.Time     `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt   *time.Time    `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	// Impersonator names the admin acting as the user in a support session.
+	// Such sessions have no refresh token and are shown to the user.
+	Impersonator string `bson:"impersonator,omitempty" json:"impersonator,omitempty"`
+	Current      bool   `bson:"-" json:"current"`
+}
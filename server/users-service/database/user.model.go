@@ -2,21 +2,55 @@ package database
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"gopkg.in/mgo.v2/bson"
 )
 
+// KindDevice marks the account of a piece of meeting-room hardware. Devices
+// have no password; they sign in with a key issued when an admin provisions
+// them.
+const KindDevice = "device"
+
 // user model
 type UserModel struct {
 	ID       bson.ObjectId `bson:"_id" json:"id"`
 	Name     string        `bson:"name" json:"name" example:"ankur"`
 	Password string        `bson:"password" json:"password" example:"test123"`
+	Email    string        `bson:"email,omitempty" json:"email,omitempty" example:"ankur@example.com"`
+	OrgID    string        `bson:"orgID,omitempty" json:"orgID,omitempty"`
+	Kind     string        `bson:"kind,omitempty" json:"kind,omitempty"`
+	// DisplayName and AvatarURL are how the user is shown in meetings.
+	DisplayName string `bson:"displayName,omitempty" json:"displayName,omitempty"`
+	AvatarURL   string `bson:"avatarURL,omitempty" json:"avatarURL,omitempty"`
+	// DeviceKeyHash and DeviceSession are set on device accounts: the hashed
+	// key the device signs in with and the login session its tokens belong
+	// to, revoked when the device is deactivated.
+	DeviceKeyHash string        `bson:"deviceKeyHash,omitempty" json:"-"`
+	DeviceSession bson.ObjectId `bson:"deviceSession,omitempty" json:"-"`
+	// DeactivatedAt is set on accounts that may no longer sign in or join
+	// meetings. Their data is kept, and people can be reactivated.
+	DeactivatedAt *time.Time `bson:"deactivatedAt,omitempty" json:"deactivatedAt,omitempty"`
+}
+
+// Device reports whether the account belongs to room hardware.
+func (u UserModel) Device() bool {
+	return u.Kind == KindDevice
+}
+
+// Active reports whether the account may sign in.
+func (u UserModel) Active() bool {
+	return u.DeactivatedAt == nil
 }
 
 // add user information
 type AddUser struct {
-	Name     string `json:"name" example:"User Name"`
-	Password string `json:"password" example:"User Password"`
+	Name        string `json:"name" example:"User Name"`
+	Password    string `json:"password" example:"User Password"`
+	Email       string `json:"email" example:"user@example.com"`
+	OrgID       string `json:"orgID"`
+	InviteToken string `json:"inviteToken"`
 }
 
 func (a AddUser) Validate() error {
@@ -25,6 +59,8 @@ func (a AddUser) Validate() error {
 		return errors.New("name is empty")
 	case len(a.Password) == 0:
 		return errors.New("password is empty")
+	case a.Email != "" && !strings.Contains(a.Email, "@"):
+		return errors.New("email is invalid")
 	default:
 		return nil
 	}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/r3tr056/go-videoconf/users-service/common"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+// lockdown lists the development defaults the service is running with.
+// With PRODUCTION set it refuses to start until every one is fixed;
+// otherwise they are only logged.
+func lockdown(production bool) {
+	var violations []string
+	check := func(ok bool, violation string) {
+		if !ok {
+			violations = append(violations, violation)
+		}
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	check(secret != "" && secret != common.JwtSecretPassword,
+		"JWT_SECRET is not set, so tokens are signed with a secret anyone can read in the source; set a random secret shared with the signalling server.")
+	check(!database.DefaultCredentials(),
+		"MongoDB is accessed with the built-in credentials; set DB_USERNAME and DB_PASSWORD.")
+	if admin, err := (&userdao.User{}).GetByName("admin"); err == nil {
+		check(!(&utils.Utils{}).ComparePassword(admin.Password, "admin"),
+			"The seeded admin user still has the password \"admin\"; change it.")
+	}
+	check(utils.Fields != nil,
+		"FIELD_KEYS is not set, so invite emails are stored unencrypted.")
+
+	if len(violations) == 0 {
+		return
+	}
+	if !production {
+		for _, violation := range violations {
+			log.Printf("Not fit for production: %s", violation)
+		}
+		return
+	}
+	checklist := "Refusing to start in production mode. Fix the following and try again:\n"
+	for _, violation := range violations {
+		checklist += "  [ ] " + violation + "\n"
+	}
+	fmt.Fprint(os.Stderr, checklist)
+	log.Fatal(checklist)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/r3tr056/go-videoconf/users-service/controllers"
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+	"github.com/r3tr056/go-videoconf/users-service/database"
+	"github.com/r3tr056/go-videoconf/users-service/utils"
+)
+
+func main() {
+	var err error
+	if utils.Fields, err = utils.LoadFieldKeys(); err != nil {
+		log.Fatal("Invalid FIELD_KEYS: ", err)
+	}
+
+	if err := database.Database.Init(); err != nil {
+		log.Fatal("Error connecting to MongoDB: ", err)
+	}
+	defer database.Database.Close()
+
+	production, err := strconv.ParseBool(getenv("PRODUCTION", "false"))
+	if err != nil {
+		log.Fatal("Invalid PRODUCTION: ", err)
+	}
+	lockdown(production)
+
+	user := controllers.User{}
+	contact := controllers.Contact{}
+	preferences := controllers.Preferences{}
+	invite := controllers.Invite{}
+	impersonation := controllers.Impersonation{}
+	device := controllers.Device{}
+	keys := controllers.Keys{}
+	audit := controllers.Audit{}
+	idempotency := controllers.Idempotency{}
+	deactivation := controllers.Deactivation{}
+
+	callerRates, err := utils.ParseRateList(getenv("RATE_LIMITS", "*=600/1m,POST /auth/login=20/1m,POST /auth/device=20/1m,POST /users=10/1m"))
+	if err != nil {
+		log.Fatal("Invalid RATE_LIMITS: ", err)
+	}
+	orgRates, err := utils.ParseRateList(getenv("ORG_RATE_LIMITS", "*=6000/1m"))
+	if err != nil {
+		log.Fatal("Invalid ORG_RATE_LIMITS: ", err)
+	}
+	rateLimit := controllers.NewRateLimit(callerRates, orgRates)
+
+	go sealAudit(&userdao.Audit{}, time.Minute)
+	go expireAudit(&userdao.Audit{}, time.Hour)
+
+	router := gin.New()
+	// Client IPs, which rate limits key anonymous callers on, are read from
+	// X-Forwarded-For only on requests from TRUSTED_PROXIES, a comma
+	// separated list of addresses or CIDRs such as the load balancer's.
+	var proxies []string
+	if list := getenv("TRUSTED_PROXIES", ""); list != "" {
+		proxies = strings.Split(list, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	router.Use(utils.RequestIDs(), gin.LoggerWithFormatter(utils.LogFormatter), gin.Recovery(), rateLimit.Limit)
+
+	auth := router.Group("/auth")
+	auth.POST("/login", user.Authenticate)
+	auth.POST("/refresh", user.Refresh)
+	auth.POST("/device", device.DeviceToken)
+
+	router.POST("/users", idempotency.Guard, user.CreateUser)
+
+	admin := router.Group("/admin", utils.AdminAuth(os.Getenv("ADMIN_TOKEN")))
+	admin.POST("/orgs/:id/invites", invite.CreateInvite)
+	admin.POST("/users/:id/impersonate", impersonation.Impersonate)
+	admin.GET("/users/:id/audit", impersonation.GetAuditLog)
+	admin.POST("/users/:id/deactivate", deactivation.DeactivateUser)
+	admin.POST("/users/:id/reactivate", deactivation.ReactivateUser)
+	admin.GET("/orgs/:id/audit/export", audit.ExportAuditLog)
+	admin.GET("/orgs/:id/audit/verify", audit.VerifyAuditLog)
+	admin.POST("/devices", device.ProvisionDevice)
+	admin.GET("/devices", device.ListDevices)
+	admin.DELETE("/devices/:id", device.DeactivateDevice)
+	admin.POST("/keys/rotate", keys.RotateKeys)
+	admin.GET("/orgs/:id/rate-limits", rateLimit.GetOrgLimits)
+	admin.PUT("/orgs/:id/rate-limits", rateLimit.PutOrgLimits)
+
+	me := router.Group("/users/me", user.Authorize, controllers.NotDevice)
+	me.PATCH("/profile", controllers.NotImpersonated, user.UpdateProfile)
+	me.GET("/sessions", user.GetSessions)
+	me.DELETE("/sessions/:id", controllers.NotImpersonated, user.RevokeSession)
+	me.POST("/sessions/revoke", controllers.NotImpersonated, user.RevokeAllSessions)
+	me.GET("/contacts", contact.GetContacts)
+	me.PUT("/contacts/:id", contact.PutContact)
+	me.DELETE("/contacts/:id", contact.DeleteContact)
+	me.GET("/blocks", contact.GetBlocked)
+	me.PUT("/blocks/:id", contact.Block)
+	me.DELETE("/blocks/:id", contact.Unblock)
+
+	users := router.Group("/users/:id", user.Authorize, controllers.NotDevice)
+	users.GET("/preferences", preferences.GetPreferences)
+	users.PUT("/preferences", preferences.PutPreferences)
+
+	log.Fatal(router.Run(":" + getenv("PORT", "8081")))
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	userdao "github.com/r3tr056/go-videoconf/users-service/dao"
+)
+
+// sealAudit chains new audit entries every interval, so they are tamper
+// evident soon after they are written, whichever service wrote them.
+func sealAudit(audit *userdao.Audit, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := audit.Seal(); err != nil {
+			log.Printf("Error sealing audit log: %s", err)
+		}
+	}
+}
+
+// expireAudit removes audit entries past their org's retention every
+// interval.
+func expireAudit(audit *userdao.Audit, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := audit.Seal(); err != nil {
+			log.Printf("Error sealing audit log: %s", err)
+			continue
+		}
+		if err := audit.ApplyRetention(); err != nil {
+			log.Printf("Error applying audit log retention: %s", err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks a field value encrypted by FieldKeys. Values without
+// it were written before encryption was turned on and are read as they are.
+const encryptedPrefix = "enc:v1:"
+
+// FieldKeys encrypts sensitive fields, such as invite emails, before they
+// are stored. Each value gets its own random data key, which encrypts it
+// with AES-256-GCM; the data key is stored next to it, wrapped by one of
+// the master keys from the secrets backend. Rotating a master key only
+// rewraps the data keys, see Rewrap.
+type FieldKeys struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// Fields encrypts the fields the repository layer stores. It is nil when no
+// keys are configured, in which case fields are stored in plain text.
+var Fields *FieldKeys
+
+// LoadFieldKeys reads the master keys from FIELD_KEYS, or the file named by
+// FIELD_KEYS_FILE, as a comma separated list of id:key pairs where key is a
+// base64 encoded 32 byte key. The first key encrypts new values; the others
+// are kept to decrypt values written before a rotation. It returns nil
+// when none are set.
+func LoadFieldKeys() (*FieldKeys, error) {
+	spec := os.Getenv("FIELD_KEYS")
+	if path := os.Getenv("FIELD_KEYS_FILE"); path != "" {
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(value)
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	k := &FieldKeys{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key %q, expected id:key", entry)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("duplicate key %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, base64 encoded", id)
+		}
+		if k.keys[id], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		if k.active == "" {
+			k.active = id
+		}
+	}
+	return k, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with aead under a fresh nonce, bound to field,
+// returning the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, field string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(field)), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, field string) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+}
+
+// Encrypt encrypts the value of field, e.g. "invites.email". The field name
+// is authenticated, so a value copied into another field does not decrypt.
+// Empty values and a nil FieldKeys leave the value as it is.
+func (k *FieldKeys) Encrypt(field, plaintext string) (string, error) {
+	if k == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.active], dataKey, field)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), field)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + k.active + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plain text of a value Encrypt returned for field.
+// Values that are not encrypted are returned as they are.
+func (k *FieldKeys) Decrypt(field, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	id, wrapped, sealed, err := k.parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(k.keys[id], wrapped, field)
+	if err != nil {
+		return "", fmt.Errorf("unwrapping data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, field)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap returns value with its data key wrapped by the active master key,
+// encrypting it if it was stored in plain text, and reports whether it
+// changed. Values already under the active key are left alone.
+func (k *FieldKeys) Rewrap(field, value string) (string, bool, error) {
+	if k == nil || value == "" {
+		return value, false, nil
+	}
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		encrypted, err := k.Encrypt(field, value)
+		return encrypted, err == nil, err
+	}
+	id, wrapped, sealed, err := k.parse(value)
+	if err != nil || id == k.active {
+		return value, false, err
+	}
+	dataKey, err := open(k.keys[id], wrapped, field)
+	if err != nil {
+		return value, false, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	if wrapped, err = seal(k.keys[k.active], dataKey, field); err != nil {
+		return value, false, err
+	}
+	return encryptedPrefix + k.active + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), true, nil
+}
+
+func (k *FieldKeys) parse(value string) (string, []byte, []byte, error) {
+	if k == nil {
+		return "", nil, nil, errors.New("value is encrypted but no field keys are configured")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if k.keys[parts[0]] == nil {
+		return "", nil, nil, fmt.Errorf("unknown field key %s", parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], wrapped, sealed, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SendMail sends a plain text email through SMTP_ADDR as SMTP_FROM,
+// authenticating when SMTP_USERNAME is set. Without SMTP_ADDR the message is
+// only logged, which is enough for development.
+func (u *Utils) SendMail(to string, subject string, body string) error {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		log.Printf("SMTP_ADDR not set, not sending %q to %s:\n%s", subject, to, body)
+		return nil
+	}
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	message := "From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(message))
+}
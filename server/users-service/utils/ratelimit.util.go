@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRoute names the rate limit of routes without one of their own.
+const DefaultRoute = "*"
+
+// Rate allows Limit requests per Window, in a burst or spread out.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Interval is how often a request is allowed once the burst is used up.
+func (r Rate) Interval() time.Duration {
+	return r.Window / time.Duration(r.Limit)
+}
+
+func (r Rate) String() string {
+	return strconv.Itoa(r.Limit) + "/" + r.Window.String()
+}
+
+// ParseRate reads a rate written as "<n>/<window>", e.g. "10/1m".
+func ParseRate(value string) (Rate, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate %q", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", value)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window < time.Second {
+		return Rate{}, fmt.Errorf("invalid rate %q", value)
+	}
+	return Rate{Limit: limit, Window: window}, nil
+}
+
+// ParseRates reads rates per route, keyed by method and route pattern as
+// gin matches it, e.g. "POST /auth/login", or DefaultRoute.
+func ParseRates(rates map[string]string) (map[string]Rate, error) {
+	parsed := make(map[string]Rate, len(rates))
+	for route, value := range rates {
+		if route != DefaultRoute && !strings.Contains(route, " /") {
+			return nil, fmt.Errorf("invalid route %q", route)
+		}
+		rate, err := ParseRate(value)
+		if err != nil {
+			return nil, err
+		}
+		parsed[route] = rate
+	}
+	return parsed, nil
+}
+
+// ParseRateList reads rates per route written as a comma separated list of
+// route=rate pairs, e.g. "*=600/1m,POST /auth/login=20/1m".
+func ParseRateList(list string) (map[string]Rate, error) {
+	rates := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rate limit %q", pair)
+		}
+		rates[strings.TrimSpace(parts[0])] = parts[1]
+	}
+	return ParseRates(rates)
+}
+
+// RateFor returns the rate of route and the name of the bucket it counts
+// against: its own, or the default one shared by routes without a rate.
+func RateFor(rates map[string]Rate, route string) (Rate, string, bool) {
+	if rate, ok := rates[route]; ok {
+		return rate, route, true
+	}
+	rate, ok := rates[DefaultRoute]
+	return rate, DefaultRoute, ok
+}
+
+// RateLimitHeaders sets the RateLimit-* response headers of the IETF draft:
+// the policy and limit applied, the requests remaining, and the seconds
+// until the bucket is full again.
+func RateLimitHeaders(ctx *gin.Context, rate Rate, remaining int, reset time.Duration) {
+	ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Limit, int(rate.Window.Seconds())))
+	ctx.Header("RateLimit-Limit", strconv.Itoa(rate.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the correlation ID of a request across services.
+// The signalling server uses the same header.
+const RequestIDHeader = "X-Request-ID"
+
+func newRequestID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") == ""
+}
+
+// RequestIDs keeps the caller's X-Request-ID, or generates one, stores it as
+// "requestID" in the context, returns it in the response header and adds it
+// to JSON error bodies.
+func RequestIDs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		ctx.Set("requestID", id)
+		ctx.Header(RequestIDHeader, id)
+		ctx.Writer = &errorWriter{ResponseWriter: ctx.Writer, id: id}
+		ctx.Next()
+	}
+}
+
+// errorWriter adds "requestID" to JSON object bodies of error responses.
+type errorWriter struct {
+	gin.ResponseWriter
+	id      string
+	written bool
+}
+
+func (w *errorWriter) Write(body []byte) (int, error) {
+	first := !w.written
+	w.written = true
+	if !first || w.Status() < http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") || !bytes.HasPrefix(body, []byte("{")) {
+		return w.ResponseWriter.Write(body)
+	}
+
+	field := `"requestID":"` + w.id + `"`
+	if !bytes.HasPrefix(body, []byte("{}")) {
+		field += ","
+	}
+	if _, err := w.ResponseWriter.Write([]byte("{" + field)); err != nil {
+		return 0, err
+	}
+	n, err := w.ResponseWriter.Write(body[1:])
+	return n + 1, err
+}
+
+func (w *errorWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// LogFormatter is gin's access log line with the request ID appended.
+func LogFormatter(param gin.LogFormatterParams) string {
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		param.Keys["requestID"],
+		param.ErrorMessage,
+	)
+}
@@ -1,17 +1,25 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"os"
 	"time"
 
 	jwt_lib "github.com/dgrijalva/jwt-go"
 	"github.com/r3tr056/go-videoconf/users-service/common"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type StdClaims struct {
-	Name string `json:"name"`
-	Role string `json:"role"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	// Impersonator is set on tokens an admin minted to act as the user.
+	Impersonator string `json:"imp,omitempty"`
 	jwt_lib.StandardClaims
 }
 
@@ -19,24 +27,98 @@ type Utils struct {
 }
 
 func (u *Utils) GenerateJWT(name string, role string) (string, error) {
-	claims := StdClaims{
-		name,
-		role,
-		jwt_lib.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 1).Unix(),
+	return u.GenerateSessionJWT(name, role, "", "")
+}
+
+// GenerateSessionJWT issues a short-lived access token tied to a login
+// session, so that revoking the session also invalidates the token.
+func (u *Utils) GenerateSessionJWT(name string, role string, userID string, sessionID string) (string, error) {
+	return u.signJWT(StdClaims{
+		Name:      name,
+		Role:      role,
+		SessionID: sessionID,
+		StandardClaims: jwt_lib.StandardClaims{
+			Subject:   userID,
+			ExpiresAt: time.Now().Add(common.AccessTokenTTL).Unix(),
 			Issuer:    common.Issuer,
 		},
-	}
+	})
+}
+
+// GenerateImpersonationJWT issues a token letting admin act as the user for
+// ImpersonationTTL. The "imp" claim marks it so every service can tell it
+// apart from the user's own tokens.
+func (u *Utils) GenerateImpersonationJWT(name string, userID string, sessionID string, admin string) (string, error) {
+	return u.signJWT(StdClaims{
+		Name:         name,
+		Role:         "user",
+		SessionID:    sessionID,
+		Impersonator: admin,
+		StandardClaims: jwt_lib.StandardClaims{
+			Subject:   userID,
+			ExpiresAt: time.Now().Add(common.ImpersonationTTL).Unix(),
+			Issuer:    common.Issuer,
+		},
+	})
+}
 
+func (u *Utils) signJWT(claims StdClaims) (string, error) {
 	token := jwt_lib.NewWithClaims(jwt_lib.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(common.JwtSecretPassword))
+	tokenString, err := token.SignedString(jwtSecret())
 
 	return tokenString, err
 }
 
+func (u *Utils) ParseJWT(tokenString string) (*StdClaims, error) {
+	claims := &StdClaims{}
+	_, err := jwt_lib.ParseWithClaims(tokenString, claims, func(token *jwt_lib.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt_lib.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return jwtSecret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// GenerateRefreshToken returns a random refresh token and the hash to store.
+func (u *Utils) GenerateRefreshToken() (string, string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(random)
+	return token, u.HashRefreshToken(token), nil
+}
+
+func (u *Utils) HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (u *Utils) HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (u *Utils) ComparePassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
 func (u *Utils) ValidateObjectId(id string) error {
 	if !bson.IsObjectIdHex(id) {
 		return errors.New("error object id not hex")
 	}
 	return nil
 }
+
+// jwtSecret is shared with the signalling server, which verifies the same
+// access tokens on socket connections.
+func jwtSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(common.JwtSecretPassword)
+}